@@ -0,0 +1,262 @@
+// Package ast exposes the syntax tree of TOML documents, with the comments
+// attached to its nodes, for static analysis and refactoring tools:
+//
+//	f, err := ast.Parse(src)
+//	if err != nil {
+//	  return err
+//	}
+//	ast.Inspect(f.Root, func(n *ast.Node) bool {
+//	  if n.Kind == ast.KeyValue && len(n.Leading) == 0 {
+//	    fmt.Printf("%s: undocumented key %s\n", n.Range.Start, n.Key)
+//	  }
+//	  return true
+//	})
+//
+// Positions hold byte offsets along with lines and columns, so that tools can
+// edit the text of documents. The tree is built on the parser of go-toml and
+// only describes valid documents.
+//
+// Nodes wrap the nodes of toml.ParseNodes, and have the same kinds. The
+// meaning of the fields of nodes for each kind is stable.
+package ast
+
+import (
+	"bytes"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Kind identifies the syntactic element described by a Node. The kinds are
+// those of go-toml.
+type Kind = toml.NodeKind
+
+// Kinds of nodes.
+const (
+	Document   = toml.NodeDocument
+	Table      = toml.NodeTable
+	ArrayTable = toml.NodeArrayTable
+	KeyValue   = toml.NodeKeyValue
+	Value      = toml.NodeValue
+)
+
+// Position is a position of go-toml, along with the offset of its byte in the
+// document.
+type Position struct {
+	toml.Position
+	Offset int
+}
+
+// Range is the part of a document between Start, included, and End,
+// excluded, as toml.Range, with offsets.
+type Range struct {
+	Start Position
+	End   Position
+}
+
+func (r Range) String() string {
+	return r.Start.String() + "-" + r.End.String()
+}
+
+// Text returns the text of the range in src, the document it was parsed from.
+func (r Range) Text(src []byte) []byte {
+	return src[r.Start.Offset:r.End.Offset]
+}
+
+// Comment is a comment of a document, from its # to the end of its line.
+type Comment struct {
+	Text  string // text of the comment, including its #
+	Range Range
+}
+
+// Node is an element of the syntax tree of a document: a node of go-toml,
+// whose Kind, Key and Value it keeps, with the offsets of its ranges and its
+// comments.
+type Node struct {
+	toml.Node
+	Range    Range
+	KeyRange Range
+	// Leading are the comments on the lines directly above tables, key/value
+	// pairs and elements of arrays, and Trailing the comment following them
+	// on their line, the header line for tables.
+	Leading  []*Comment
+	Trailing *Comment
+	Children []*Node
+}
+
+// File is a parsed document.
+type File struct {
+	Root *Node
+	// Comments are all the comments of the document, in order, including
+	// those that are not attached to a node.
+	Comments []*Comment
+}
+
+// Parse parses src into a syntax tree. An error is returned if the document
+// is invalid.
+func Parse(src []byte) (*File, error) {
+	root, err := toml.ParseNodes(src)
+	if err != nil {
+		return nil, err
+	}
+	b := newBuilder(src)
+	f := &File{Root: b.node(root)}
+	sort.Slice(b.opaque, func(i, j int) bool { return b.opaque[i].Start.Offset < b.opaque[j].Start.Offset })
+	f.Comments = b.comments()
+	b.attach(f.Root, false)
+	return f, nil
+}
+
+// Inspect traverses a syntax tree in depth-first order, as go/ast.Inspect: it
+// calls f(node), and then inspects the children of node if f returned true.
+func Inspect(node *Node, f func(*Node) bool) {
+	if !f(node) {
+		return
+	}
+	for _, child := range node.Children {
+		Inspect(child, f)
+	}
+}
+
+// Builder of the syntax tree of a document from the one of go-toml.
+type builder struct {
+	src        []byte
+	bom        int // length of the byte order mark of src, not part of the positions of go-toml
+	lineStarts []int
+	// ranges of the document that cannot hold comments: strings, other
+	// scalar values and keys
+	opaque []Range
+	// comments by line
+	lines map[int]*Comment
+	// comments already attached to a node
+	attached map[*Comment]bool
+}
+
+func newBuilder(src []byte) *builder {
+	b := &builder{src: src, lines: map[int]*Comment{}, attached: map[*Comment]bool{}}
+	if bytes.HasPrefix(src, []byte("\xef\xbb\xbf")) {
+		b.bom = 3
+	}
+	b.lineStarts = []int{0}
+	for i, c := range src {
+		if c == '\n' {
+			b.lineStarts = append(b.lineStarts, i+1)
+		}
+	}
+	return b
+}
+
+// Position of a position given by go-toml.
+func (b *builder) position(pos toml.Position) Position {
+	off := b.lineStarts[pos.Line-1]
+	if pos.Line == 1 {
+		off += b.bom
+	}
+	for col := 1; col < pos.Col && off < len(b.src); col++ {
+		_, size := utf8.DecodeRune(b.src[off:])
+		off += size
+	}
+	return Position{Position: pos, Offset: off}
+}
+
+func (b *builder) rangeOf(r toml.Range) Range {
+	return Range{Start: b.position(r.Start), End: b.position(r.End)}
+}
+
+func (b *builder) node(n *toml.Node) *Node {
+	node := &Node{Node: *n, Range: b.rangeOf(n.Range)}
+	if n.Kind == toml.NodeTable || n.Kind == toml.NodeArrayTable || n.Kind == toml.NodeKeyValue {
+		node.KeyRange = b.rangeOf(n.KeyRange)
+		b.opaque = append(b.opaque, node.KeyRange)
+	}
+	if n.Kind == toml.NodeValue && len(n.Children) == 0 {
+		if _, isArray := n.Value.AsArray(); !isArray {
+			if _, isTable := n.Value.AsTable(); !isTable {
+				b.opaque = append(b.opaque, node.Range)
+			}
+		}
+	}
+	for _, child := range n.Children {
+		node.Children = append(node.Children, b.node(child))
+	}
+	return node
+}
+
+// Find the comments of the document: the # characters outside of the opaque
+// ranges, sorted, start comments.
+func (b *builder) comments() []*Comment {
+	var comments []*Comment
+	next := 0
+	for i := b.bom; i < len(b.src); i++ {
+		for next < len(b.opaque) && b.opaque[next].End.Offset <= i {
+			next++
+		}
+		if next < len(b.opaque) && b.opaque[next].Start.Offset <= i {
+			i = b.opaque[next].End.Offset - 1
+			continue
+		}
+		if b.src[i] != '#' {
+			continue
+		}
+		end := i
+		for end < len(b.src) && b.src[end] != '\n' && b.src[end] != '\r' {
+			end++
+		}
+		c := &Comment{Text: string(b.src[i:end]), Range: Range{Start: b.offsetPosition(i), End: b.offsetPosition(end)}}
+		comments = append(comments, c)
+		b.lines[c.Range.Start.Line] = c
+		i = end
+	}
+	return comments
+}
+
+// Position of an offset of the document.
+func (b *builder) offsetPosition(off int) Position {
+	line := sort.Search(len(b.lineStarts), func(i int) bool { return b.lineStarts[i] > off })
+	start := b.lineStarts[line-1]
+	if line == 1 {
+		start += b.bom
+	}
+	return Position{Position: toml.Position{Line: line, Col: utf8.RuneCount(b.src[start:off]) + 1}, Offset: off}
+}
+
+// Attach the comments to node and its children. element is true for the
+// elements of arrays.
+func (b *builder) attach(node *Node, element bool) {
+	if node.Kind == Table || node.Kind == ArrayTable || node.Kind == KeyValue || element {
+		for line := node.Range.Start.Line - 1; line > 0; line-- {
+			c := b.lines[line]
+			if c == nil || b.attached[c] || !b.onlyOnLine(c) {
+				break
+			}
+			b.attached[c] = true
+			node.Leading = append([]*Comment{c}, node.Leading...)
+		}
+	}
+	for _, child := range node.Children {
+		b.attach(child, node.Kind == Value && child.Kind == Value)
+	}
+	// the comment following the node, or the header of tables, separated
+	// from it by spaces and the comma of elements of arrays
+	end, separators := node.Range.End, " \t,"
+	if node.Kind == Table || node.Kind == ArrayTable {
+		end, separators = node.KeyRange.End, " \t]"
+	} else if node.Kind != KeyValue && !element {
+		return
+	}
+	c := b.lines[end.Line]
+	if c == nil || b.attached[c] || c.Range.Start.Offset < end.Offset {
+		return
+	}
+	if len(bytes.Trim(b.src[end.Offset:c.Range.Start.Offset], separators)) == 0 {
+		b.attached[c] = true
+		node.Trailing = c
+	}
+}
+
+// Whether the comment is alone on its line.
+func (b *builder) onlyOnLine(c *Comment) bool {
+	start := b.lineStarts[c.Range.Start.Line-1]
+	return len(bytes.TrimLeft(b.src[start:c.Range.Start.Offset], " \t\xef\xbb\xbf")) == 0
+}
@@ -0,0 +1,88 @@
+package ast
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	src := "\xef\xbb\xbf" + `# the title
+title = "a # b" # trailing
+
+# detached
+
+# the server
+[server] # header
+  # the host
+  host = 'h#st'
+  ports = [
+    # first
+    80, # http
+    443,
+  ] # ports
+  opts = { "#" = 1, b = 2 } # opts
+`
+	f, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var comments []string
+	for _, c := range f.Comments {
+		comments = append(comments, c.Range.Start.String()+" "+c.Text)
+	}
+	expected := "(1, 1) # the title|(2, 17) # trailing|(4, 1) # detached|(6, 1) # the server|(7, 10) # header|(8, 3) # the host|" +
+		"(11, 5) # first|(12, 9) # http|(14, 5) # ports|(15, 29) # opts"
+	if got := strings.Join(comments, "|"); got != expected {
+		t.Errorf("expected comments %s, got %s", expected, got)
+	}
+
+	var nodes []string
+	Inspect(f.Root, func(n *Node) bool {
+		s := n.Kind.String() + " " + n.Key.String() + " " + string(n.Range.Text([]byte(src)))
+		for _, c := range n.Leading {
+			s += " leading:" + c.Text
+		}
+		if n.Trailing != nil {
+			s += " trailing:" + n.Trailing.Text
+		}
+		if n.Kind != Document && n.Kind != Value {
+			nodes = append(nodes, s)
+		}
+		return n.Kind != Value
+	})
+	expectedNodes := []string{
+		`key/value title title = "a # b" leading:# the title trailing:# trailing`,
+		"table server [server] # header\n  # the host\n  host = 'h#st'\n  ports = [\n    # first\n    80, # http\n    443,\n  ] # ports\n  opts = { \"#\" = 1, b = 2 } leading:# the server trailing:# header",
+		`key/value server.host host = 'h#st' leading:# the host`,
+		"key/value server.ports ports = [\n    # first\n    80, # http\n    443,\n  ] trailing:# ports",
+		`key/value server.opts opts = { "#" = 1, b = 2 } trailing:# opts`,
+	}
+	if len(nodes) != len(expectedNodes) {
+		t.Fatalf("expected nodes:\n%s\ngot:\n%s", strings.Join(expectedNodes, "\n"), strings.Join(nodes, "\n"))
+	}
+	for i := range nodes {
+		if nodes[i] != expectedNodes[i] {
+			t.Errorf("expected node %q, got %q", expectedNodes[i], nodes[i])
+		}
+	}
+
+	ports := f.Root.Children[1].Children[1].Children[0]
+	if ports.Kind != Value || len(ports.Children) != 2 {
+		t.Fatalf("unexpected ports %+v", ports)
+	}
+	if first := ports.Children[0]; len(first.Leading) != 1 || first.Leading[0].Text != "# first" || first.Trailing == nil || first.Trailing.Text != "# http" {
+		t.Errorf("unexpected comments of the first port: %v, %v", first.Leading, first.Trailing)
+	}
+	if second := ports.Children[1]; len(second.Leading) != 0 || second.Trailing != nil {
+		t.Errorf("unexpected comments of the second port: %v, %v", second.Leading, second.Trailing)
+	}
+	if pos := f.Root.Children[0].Range.Start; pos.Offset != 15 || pos.Line != 2 || pos.Col != 1 {
+		t.Errorf("unexpected position %+v", pos)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	if _, err := Parse([]byte("a = ")); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,70 @@
+//go:build go1.19
+// +build go1.19
+
+// Configurations shared between goroutines.
+
+package toml
+
+import "sync/atomic"
+
+// LoadAtomic decodes the file at path into a new T, which must be a struct or
+// a map type, and returns an atomic pointer to it. The pointer is a race-free
+// handle on the current configuration: readers call Load to get a snapshot
+// that never changes, and ReloadAtomic replaces it as a whole. To reload the
+// file when it changes, use the pointer returned by Watcher.Atomic instead.
+//
+// Snapshots must be treated as read-only, since they may be shared by several
+// goroutines.
+func LoadAtomic[T any](path string) (*atomic.Pointer[T], error) {
+	v, err := decodeFile[T](path)
+	if err != nil {
+		return nil, err
+	}
+	p := new(atomic.Pointer[T])
+	p.Store(v)
+	return p, nil
+}
+
+// ReloadAtomic decodes the file at path into a new T and stores it in p. If
+// the file cannot be read or decoded, p keeps its current value and the error
+// is returned, so that a broken edit of a configuration file does not affect
+// a running application.
+func ReloadAtomic[T any](p *atomic.Pointer[T], path string) error {
+	v, err := decodeFile[T](path)
+	if err != nil {
+		return err
+	}
+	p.Store(v)
+	return nil
+}
+
+// Atomic returns an atomic pointer to the current configuration of w, which
+// Reload, and thus Watch, update each time they accept a new version of the
+// file. Readers call Load on the pointer to get a snapshot, without locking
+// the Watcher:
+//
+//	w, err := toml.NewWatcher[Config]("config.toml")
+//	...
+//	current := w.Atomic()
+//	go func() {
+//	  for range w.Watch(ctx) {
+//	  }
+//	}()
+//
+// Rejected versions leave the pointer unchanged, as they do the Watcher.
+func (w *Watcher[T]) Atomic() *atomic.Pointer[T] {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	p := new(atomic.Pointer[T])
+	p.Store(w.current)
+	w.accepted = append(w.accepted, p.Store)
+	return p
+}
+
+func decodeFile[T any](path string) (*T, error) {
+	v := new(T)
+	if err := DecodeFile(path, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,118 @@
+//go:build go1.19
+// +build go1.19
+
+package toml
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestLoadAtomic(t *testing.T) {
+	type config struct {
+		Name string
+		Port int
+	}
+	dir, err := ioutil.TempDir("", "toml-atomic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.toml")
+	if err := ioutil.WriteFile(path, []byte("name = \"a\"\nport = 80\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := LoadAtomic[config](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := current.Load(); c.Name != "a" || c.Port != 80 {
+		t.Errorf("unexpected config %+v", c)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if c := current.Load(); c.Name == "" {
+					t.Error("readers should only see complete configurations")
+					return
+				}
+			}
+		}()
+	}
+	if err := ioutil.WriteFile(path, []byte("name = \"b\"\nport = 8080\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReloadAtomic(current, path); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if c := current.Load(); c.Name != "b" || c.Port != 8080 {
+		t.Errorf("unexpected config %+v", c)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("name = \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReloadAtomic(current, path); err == nil {
+		t.Error("expected an error for an invalid file")
+	}
+	if c := current.Load(); c.Name != "b" {
+		t.Errorf("a failed reload should keep the current config, got %+v", c)
+	}
+
+	if _, err := LoadAtomic[config](filepath.Join(dir, "missing.toml")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestWatcherAtomic(t *testing.T) {
+	type config struct {
+		Port int `toml:"port"`
+	}
+	dir, err := ioutil.TempDir("", "toml-atomic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.toml")
+	if err := WriteFile(path, []byte("port = 80\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewWatcher[config](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := w.Atomic()
+	if c := current.Load(); c.Port != 80 {
+		t.Errorf("unexpected config %+v", c)
+	}
+
+	if err := WriteFile(path, []byte("port = 8080\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if event, ok := w.Reload(); !ok || event.Err != nil {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if c := current.Load(); c.Port != 8080 || c != w.Current() {
+		t.Errorf("the pointer should follow the watcher, got %+v", c)
+	}
+
+	if err := WriteFile(path, []byte("port = \n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if event, ok := w.Reload(); !ok || event.Err == nil {
+		t.Fatalf("expected an error event, got %+v", event)
+	}
+	if c := current.Load(); c.Port != 8080 {
+		t.Errorf("a failed reload should keep the current config, got %+v", c)
+	}
+}
@@ -0,0 +1,72 @@
+// Decoding of many documents at once.
+
+package toml
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+)
+
+// NamedReader is a document to decode with DecodeAll, such as an *os.File.
+type NamedReader interface {
+	io.Reader
+	Name() string
+}
+
+// BatchReport is the outcome of DecodeAll.
+type BatchReport struct {
+	Results []BatchResult // in the order of the inputs
+}
+
+// BatchResult is the outcome of decoding one document with DecodeAll.
+type BatchResult struct {
+	Name     string
+	Err      error         // nil if the document was decoded
+	Warnings []LintWarning // found by Lint in the document
+}
+
+// Failed returns the results of the documents that could not be decoded.
+func (r *BatchReport) Failed() []BatchResult {
+	var failed []BatchResult
+	for _, result := range r.Results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// DecodeAll reads and decodes each input, carrying on past failures, and
+// reports the outcome for every input. Documents are decoded in the value
+// returned by target for their name, with Decoder.CollectErrors so that all
+// the errors of a document are reported. When target is nil or returns nil,
+// documents are only parsed and linted, which is useful to validate many
+// files.
+func DecodeAll(inputs []NamedReader, target func(name string) interface{}) *BatchReport {
+	report := &BatchReport{Results: make([]BatchResult, 0, len(inputs))}
+	for _, input := range inputs {
+		result := BatchResult{Name: input.Name()}
+		result.Warnings, result.Err = decodeNamed(input, target)
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+func decodeNamed(input NamedReader, target func(name string) interface{}) ([]LintWarning, error) {
+	b, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	warnings, err := Lint(b)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return warnings, nil
+	}
+	if v := target(input.Name()); v != nil {
+		err = NewDecoder(bytes.NewReader(b)).CollectErrors(true).Decode(v)
+	}
+	return warnings, err
+}
@@ -0,0 +1,57 @@
+package toml
+
+import (
+	"strings"
+	"testing"
+)
+
+type namedString struct {
+	*strings.Reader
+	name string
+}
+
+func (n namedString) Name() string {
+	return n.name
+}
+
+func TestDecodeAll(t *testing.T) {
+	type config struct {
+		Port int `toml:"port"`
+	}
+	inputs := []NamedReader{
+		namedString{strings.NewReader("port = 80\n"), "a.toml"},
+		namedString{strings.NewReader("port = \"x\"\n"), "b.toml"},
+		namedString{strings.NewReader("port = \n"), "c.toml"},
+		namedString{strings.NewReader("[t]\n[u]\n[t]\n"), "d.toml"},
+	}
+	decoded := map[string]*config{}
+	report := DecodeAll(inputs, func(name string) interface{} {
+		if name == "d.toml" {
+			return nil
+		}
+		decoded[name] = new(config)
+		return decoded[name]
+	})
+
+	if len(report.Results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(report.Results))
+	}
+	if r := report.Results[0]; r.Name != "a.toml" || r.Err != nil || decoded["a.toml"].Port != 80 {
+		t.Errorf("unexpected result %+v", r)
+	}
+	if _, ok := report.Results[1].Err.(DecodeErrors); !ok {
+		t.Errorf("expected DecodeErrors, got %v", report.Results[1].Err)
+	}
+	assertErrorString(t, "(2, 1): expecting a value", report.Results[2].Err)
+	if r := report.Results[3]; r.Err != nil || len(r.Warnings) != 1 || r.Warnings[0].Rule != LintDuplicateTable {
+		t.Errorf("unexpected result %+v", r)
+	}
+
+	var failed []string
+	for _, r := range report.Failed() {
+		failed = append(failed, r.Name)
+	}
+	if strings.Join(failed, ",") != "b.toml,c.toml" {
+		t.Errorf("unexpected failures %v", failed)
+	}
+}
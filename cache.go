@@ -0,0 +1,366 @@
+// Caching of parsed documents.
+
+package toml
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Version of the format of the cache entries, part of their file name so that
+// entries written by other versions are ignored.
+const cacheFormatVersion = "3"
+
+// CachingLoader loads documents like LoadBytes, memoizing the parsed trees by
+// the hash of their content. Tools repeatedly loading large documents that
+// rarely change only pay the cost of parsing them once.
+//
+// Each call returns a new Tree, so trees returned by the loader can be
+// modified freely. A CachingLoader is safe for concurrent use.
+type CachingLoader struct {
+	dir     string
+	mu      sync.Mutex
+	entries map[string]*cacheTree
+}
+
+// NewCachingLoader returns a loader keeping parsed documents in memory and, if
+// dir is not empty, in files of dir so that they persist across processes.
+// dir is created if it does not exist.
+func NewCachingLoader(dir string) (*CachingLoader, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &CachingLoader{dir: dir, entries: map[string]*cacheTree{}}, nil
+}
+
+// LoadBytes creates a Tree from a []byte, parsing it only if the same content
+// was not loaded before.
+func (c *CachingLoader) LoadBytes(b []byte) (*Tree, error) {
+	sum := sha256.Sum256(b)
+	key := hex.EncodeToString(sum[:])
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok {
+		return entry.toTree(), nil
+	}
+
+	entry = c.readEntry(key)
+	if entry == nil {
+		tree, err := LoadBytes(b)
+		if err != nil {
+			return nil, err
+		}
+		entry = newCacheTree(tree)
+		if err := c.writeEntry(key, entry); err != nil {
+			return nil, err
+		}
+	}
+
+	c.mu.Lock()
+	c.entries[key] = entry
+	c.mu.Unlock()
+	return entry.toTree(), nil
+}
+
+// LoadReader creates a Tree from any io.Reader, using the cache.
+func (c *CachingLoader) LoadReader(r io.Reader) (*Tree, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return c.LoadBytes(b)
+}
+
+// LoadFile creates a Tree from a file, using the cache. The path of the file
+// is the source of the tree.
+func (c *CachingLoader) LoadFile(path string) (*Tree, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := c.LoadBytes(b)
+	if err == nil {
+		tree.source = path
+	}
+	return tree, err
+}
+
+func (c *CachingLoader) entryPath(key string) string {
+	return filepath.Join(c.dir, key+".v"+cacheFormatVersion+".gob")
+}
+
+// Read an entry from the cache directory. Missing or unreadable entries are
+// reported as absent, so that the document gets parsed again.
+func (c *CachingLoader) readEntry(key string) *cacheTree {
+	if c.dir == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(c.entryPath(key))
+	if err != nil {
+		return nil
+	}
+	var entry cacheTree
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&entry); err != nil {
+		return nil
+	}
+	return &entry
+}
+
+// Write an entry to the cache directory, through a temporary file so that
+// concurrent readers never see a partial entry.
+func (c *CachingLoader) writeEntry(key string, entry *cacheTree) error {
+	if c.dir == "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(entry); err != nil {
+		return fmt.Errorf("cannot encode cache entry: %s", err)
+	}
+	tmp, err := ioutil.TempFile(c.dir, key+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.entryPath(key))
+}
+
+// cacheTree is the serializable form of a Tree.
+type cacheTree struct {
+	Position  Position
+	Comment   string
+	Commented bool
+	Inline    bool
+	Source    string
+	Keys      []string
+	Nodes     []cacheNode
+}
+
+// cacheNode is the serializable form of the values of a Tree: exactly one of
+// the fields is set.
+type cacheNode struct {
+	Tree  *cacheTree
+	Trees []*cacheTree
+	Value *cacheValue
+}
+
+type cacheValue struct {
+	Value          cacheScalar
+	Comment        string
+	Commented      bool
+	Multiline      bool
+	Literal        bool
+	Position       Position
+	Elements       []Position
+	WrapWidth      int
+	Base           int
+	Grouping       int
+	StyleGrouping  int
+	StyleLiteral   bool
+	Source         string
+	FloatFormat    *cacheFloatFormat
+	ArrayWrapItems int
+	ArrayWrapWidth int
+}
+
+type cacheFloatFormat struct {
+	Precision    int
+	Exponent     int
+	DecimalPoint bool
+}
+
+// cacheScalar is the serializable form of the Go values stored in a
+// tomlValue, Kind telling which field holds the value.
+type cacheScalar struct {
+	Kind          Kind
+	String        string
+	Int           int64
+	Uint          uint64
+	Unsigned      bool
+	Float         float64
+	Bool          bool
+	Time          time.Time
+	LocalDate     LocalDate
+	LocalTime     LocalTime
+	LocalDateTime LocalDateTime
+	Array         []cacheScalar
+	Table         *cacheTree
+}
+
+func newCacheTree(t *Tree) *cacheTree {
+	result := &cacheTree{
+		Position:  t.position,
+		Comment:   t.comment,
+		Commented: t.commented,
+		Inline:    t.inline,
+		Source:    t.source,
+	}
+	for _, k := range t.Keys() {
+		var node cacheNode
+		switch v := t.values[k].(type) {
+		case *Tree:
+			node.Tree = newCacheTree(v)
+		case []*Tree:
+			node.Trees = make([]*cacheTree, len(v))
+			for i, tree := range v {
+				node.Trees[i] = newCacheTree(tree)
+			}
+		case *tomlValue:
+			node.Value = &cacheValue{
+				Value:          newCacheScalar(v.value),
+				Comment:        v.comment,
+				Commented:      v.commented,
+				Multiline:      v.multiline,
+				Literal:        v.literal,
+				Position:       v.position,
+				Elements:       v.elementPositions,
+				WrapWidth:      v.wrapWidth,
+				Base:           v.base,
+				Grouping:       v.grouping,
+				StyleGrouping:  v.style.grouping,
+				StyleLiteral:   v.style.literal,
+				Source:         v.source,
+				ArrayWrapItems: v.arrayWrapItems,
+				ArrayWrapWidth: v.arrayWrapWidth,
+			}
+			if f := v.floatFormat; f != nil {
+				node.Value.FloatFormat = &cacheFloatFormat{Precision: f.precision, Exponent: f.exponent, DecimalPoint: f.decimalPoint}
+			}
+		}
+		result.Keys = append(result.Keys, k)
+		result.Nodes = append(result.Nodes, node)
+	}
+	return result
+}
+
+func newCacheScalar(v interface{}) cacheScalar {
+	switch value := v.(type) {
+	case string:
+		return cacheScalar{Kind: KindString, String: value}
+	case int64:
+		return cacheScalar{Kind: KindInteger, Int: value}
+	case uint64:
+		return cacheScalar{Kind: KindInteger, Uint: value, Unsigned: true}
+	case float64:
+		return cacheScalar{Kind: KindFloat, Float: value}
+	case bool:
+		return cacheScalar{Kind: KindBool, Bool: value}
+	case time.Time:
+		return cacheScalar{Kind: KindOffsetDateTime, Time: value}
+	case LocalDate:
+		return cacheScalar{Kind: KindLocalDate, LocalDate: value}
+	case LocalTime:
+		return cacheScalar{Kind: KindLocalTime, LocalTime: value}
+	case LocalDateTime:
+		return cacheScalar{Kind: KindLocalDateTime, LocalDateTime: value}
+	case *Tree:
+		return cacheScalar{Kind: KindTable, Table: newCacheTree(value)}
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return cacheScalar{Kind: KindInvalid}
+	}
+	array := make([]cacheScalar, rv.Len())
+	for i := range array {
+		array[i] = newCacheScalar(rv.Index(i).Interface())
+	}
+	return cacheScalar{Kind: KindArray, Array: array}
+}
+
+func (c *cacheTree) toTree() *Tree {
+	t := newTreeWithPosition(c.Position)
+	t.comment = c.Comment
+	t.commented = c.Commented
+	t.inline = c.Inline
+	t.source = c.Source
+	for i, k := range c.Keys {
+		node := c.Nodes[i]
+		switch {
+		case node.Tree != nil:
+			t.values[k] = node.Tree.toTree()
+		case node.Value != nil:
+			v := node.Value
+			value := &tomlValue{
+				value:            v.Value.toValue(),
+				comment:          v.Comment,
+				commented:        v.Commented,
+				multiline:        v.Multiline,
+				literal:          v.Literal,
+				position:         v.Position,
+				elementPositions: v.Elements,
+				wrapWidth:        v.WrapWidth,
+				base:             v.Base,
+				grouping:         v.Grouping,
+				style:            valueStyle{grouping: v.StyleGrouping, literal: v.StyleLiteral},
+				source:           v.Source,
+				arrayWrapItems:   v.ArrayWrapItems,
+				arrayWrapWidth:   v.ArrayWrapWidth,
+			}
+			if f := v.FloatFormat; f != nil {
+				value.floatFormat = &floatFormat{precision: f.Precision, exponent: f.Exponent, decimalPoint: f.DecimalPoint}
+			}
+			t.values[k] = value
+		default:
+			trees := make([]*Tree, len(node.Trees))
+			for j, tree := range node.Trees {
+				trees[j] = tree.toTree()
+			}
+			t.values[k] = trees
+		}
+	}
+	return t
+}
+
+func (s cacheScalar) toValue() interface{} {
+	switch s.Kind {
+	case KindString:
+		return s.String
+	case KindInteger:
+		if s.Unsigned {
+			return s.Uint
+		}
+		return s.Int
+	case KindFloat:
+		return s.Float
+	case KindBool:
+		return s.Bool
+	case KindOffsetDateTime:
+		return s.Time
+	case KindLocalDate:
+		return s.LocalDate
+	case KindLocalTime:
+		return s.LocalTime
+	case KindLocalDateTime:
+		return s.LocalDateTime
+	case KindTable:
+		return s.Table.toTree()
+	case KindArray:
+		array := make([]interface{}, len(s.Array))
+		for i, element := range s.Array {
+			array[i] = element.toValue()
+		}
+		return array
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package toml
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const cachedDoc = `# comment
+title = "cached"
+big = 18446744073709551615
+odt = 1979-05-27T07:32:00-07:00
+ld = 1979-05-27
+lt = 07:32:00
+ldt = 1979-05-27T07:32:00
+mixed = [1, [2.5, "x"], { a = true }]
+
+[server]
+inline = { x = 1 }
+
+[[items]]
+id = 1
+
+[[items]]
+id = 2
+`
+
+func TestCachingLoader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "toml-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	reference, err := Load(cachedDoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := reference.String()
+
+	loader, err := NewCachingLoader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := loader.LoadBytes([]byte(cachedDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.String() != expected {
+		t.Errorf("unexpected tree:\n%s\nexpected:\n%s", first, expected)
+	}
+
+	first.Set("title", "modified")
+	second, err := loader.LoadBytes([]byte(cachedDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Get("title") != "cached" {
+		t.Error("trees returned by the loader should be independent")
+	}
+
+	entries, _ := filepath.Glob(filepath.Join(dir, "*.gob"))
+	if len(entries) != 1 {
+		t.Fatalf("expected one cache entry, got %v", entries)
+	}
+
+	// a new loader reads the entry written by the first one
+	other, _ := NewCachingLoader(dir)
+	fromDisk, err := other.LoadBytes([]byte(cachedDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromDisk.String() != expected {
+		t.Errorf("unexpected tree from disk:\n%s\nexpected:\n%s", fromDisk, expected)
+	}
+	for _, key := range []string{"title", "server", "items"} {
+		if fromDisk.GetPosition(key) != reference.GetPosition(key) {
+			t.Errorf("position of %s should be cached, got %s", key, fromDisk.GetPosition(key))
+		}
+	}
+
+	// corrupted entries are ignored
+	if err := ioutil.WriteFile(entries[0], []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	other, _ = NewCachingLoader(dir)
+	if tree, err := other.LoadBytes([]byte(cachedDoc)); err != nil || tree.String() != expected {
+		t.Errorf("corrupted entries should be replaced, got %v", err)
+	}
+}
+
+func TestCachingLoaderErrors(t *testing.T) {
+	loader, err := NewCachingLoader("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loader.LoadBytes([]byte("a = ")); err == nil {
+		t.Error("invalid documents should be rejected")
+	}
+	if _, err := loader.LoadFile("does-not-exist.toml"); err == nil {
+		t.Error("missing files should be reported")
+	}
+}
+
+func TestCachingLoaderValueFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "toml-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	doc := "big = 1_000_000\nhex = 0xff\npath = 'C:\\dir'\n"
+	loader, _ := NewCachingLoader(dir)
+	if _, err := loader.LoadBytes([]byte(doc)); err != nil {
+		t.Fatal(err)
+	}
+	reference, _ := LoadBytes([]byte(doc))
+	other, _ := NewCachingLoader(dir)
+	fromDisk, err := other.LoadBytes([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromDisk.String() != reference.String() {
+		t.Errorf("unexpected tree from disk:\n%s\nexpected:\n%s", fromDisk, reference)
+	}
+
+	tests := []struct {
+		name  string
+		value tomlValue
+	}{
+		{"base", tomlValue{value: int64(255), base: 16}},
+		{"grouping", tomlValue{value: int64(1000000), grouping: 3}},
+		{"style", tomlValue{value: "C:\\dir", style: valueStyle{grouping: 3, literal: true}}},
+		{"source", tomlValue{value: "x", source: "base.toml"}},
+		{"wrapWidth", tomlValue{value: "long", wrapWidth: 40}},
+		{"floatFormat", tomlValue{value: 1.5, floatFormat: &floatFormat{precision: 2, exponent: 6, decimalPoint: true}}},
+		{"arrayWrap", tomlValue{value: []interface{}{int64(1)}, arrayWrapItems: 4, arrayWrapWidth: 60}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree := newTree()
+			value := test.value
+			tree.values["key"] = &value
+			tree.source = "doc.toml"
+			if err := loader.writeEntry(test.name, newCacheTree(tree)); err != nil {
+				t.Fatal(err)
+			}
+			entry := loader.readEntry(test.name)
+			if entry == nil {
+				t.Fatal("entry should be read back")
+			}
+			result := entry.toTree()
+			if result.source != "doc.toml" {
+				t.Errorf("source of the tree should be cached, got %q", result.source)
+			}
+			if got := result.values["key"]; !reflect.DeepEqual(got, &value) {
+				t.Errorf("expected %+v, got %+v", value, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pelletier/go-toml"
+)
+
+// visitFunc is a toml.Visitor visiting the children of the nodes for which it
+// returns true.
+type visitFunc func(node *toml.Node) bool
+
+func (f visitFunc) Visit(node *toml.Node) toml.Visitor {
+	if node != nil && f(node) {
+		return f
+	}
+	return nil
+}
+
+// Syntax tree of the valid parts of the document, and its syntax errors.
+func (d *document) nodes() (*toml.Node, []byte, []*toml.ParseError) {
+	partial, errs := toml.LoadDocumentPartial([]byte(d.text))
+	return partial.Nodes(), partial.Bytes(), errs
+}
+
+// Diagnostics of the document: its syntax errors, and the warnings of the
+// linter and the violations of the schema in its valid parts.
+func (d *document) diagnostics(uri string, s validator) []diagnostic {
+	diagnostics := []diagnostic{}
+	root, doc, errs := d.nodes()
+	for _, e := range errs {
+		diagnostics = append(diagnostics, diagnostic{
+			Range:    d.pointRange(nil, e.Position),
+			Severity: severityError,
+			Source:   "toml",
+			Message:  e.Message,
+		})
+	}
+
+	warnings, err := toml.Lint(doc)
+	if err == nil {
+		for _, w := range warnings {
+			diag := diagnostic{
+				Range:    d.pointRange(root, w.Position),
+				Severity: severityWarning,
+				Code:     w.Rule,
+				Source:   "toml",
+				Message:  w.Message,
+			}
+			for _, pos := range w.Related {
+				var related diagnosticRelatedInformation
+				related.Location.URI = uri
+				related.Location.Range = d.pointRange(root, pos)
+				related.Message = "related location"
+				diag.RelatedInformation = append(diag.RelatedInformation, related)
+			}
+			diagnostics = append(diagnostics, diag)
+		}
+	}
+	if s != nil {
+		violations, err := s.Validate(doc)
+		if err == nil {
+			for _, v := range violations {
+				message := v.Message
+				if len(v.Key) > 0 {
+					message = v.Key.String() + ": " + message
+				}
+				diagnostics = append(diagnostics, diagnostic{
+					Range:    d.pointRange(root, v.Position),
+					Severity: severityError,
+					Source:   "schema",
+					Message:  message,
+				})
+			}
+		}
+	}
+	return diagnostics
+}
+
+// Range of the key or of the node starting at pos, or of the rest of its line.
+func (d *document) pointRange(root *toml.Node, pos toml.Position) lspRange {
+	var found *toml.Range
+	if root != nil {
+		toml.Walk(visitFunc(func(node *toml.Node) bool {
+			switch {
+			case found != nil:
+			case node.KeyRange.Start == pos:
+				found = &node.KeyRange
+			case node.Kind != toml.NodeDocument && node.Range.Start == pos:
+				found = &node.Range
+			}
+			return found == nil
+		}), root)
+	}
+	if found != nil {
+		return d.toLSPRange(*found)
+	}
+	start := d.toLSP(pos)
+	end := start
+	if start.Line < len(d.lines) {
+		end = d.toLSP(toml.Position{Line: pos.Line, Col: utf8.RuneCountInString(strings.TrimRight(d.lines[start.Line], " \t\r")) + 1})
+		if end.Character < start.Character {
+			end = start
+		}
+	}
+	return lspRange{Start: start, End: end}
+}
+
+// Hover of the key or value at p: its complete key and its type.
+func (d *document) hover(p position) *hover {
+	root, _, _ := d.nodes()
+	pos := d.fromLSP(p)
+	var found *toml.Node
+	var r toml.Range
+	toml.Walk(visitFunc(func(node *toml.Node) bool {
+		switch {
+		case node.Kind == toml.NodeDocument:
+		case contains(node.KeyRange, pos):
+			found, r = node, node.KeyRange
+		case contains(node.Range, pos):
+			found, r = node, node.Range
+		}
+		return true
+	}), root)
+	if found == nil {
+		return nil
+	}
+	kind := found.Value.Kind().String()
+	if found.Kind == toml.NodeArrayTable {
+		kind = "table of an array of tables"
+	}
+	h := &hover{Range: d.toLSPRange(r)}
+	h.Contents.Kind = "markdown"
+	h.Contents.Value = fmt.Sprintf("`%s`: %s", found.Key, kind)
+	return h
+}
+
+// Whether the range r contains the position p.
+func contains(r toml.Range, p toml.Position) bool {
+	before := func(a, b toml.Position) bool {
+		return a.Line < b.Line || a.Line == b.Line && a.Col < b.Col
+	}
+	return !r.Start.Invalid() && !before(p, r.Start) && before(p, r.End)
+}
+
+// Outline of the document: its tables and their keys.
+func (d *document) symbols() []documentSymbol {
+	symbols := []documentSymbol{}
+	root, _, _ := d.nodes()
+	for _, node := range root.Children {
+		if node.Kind == toml.NodeKeyValue {
+			symbols = append(symbols, d.keyValueSymbol(node, toml.Key{}))
+			continue
+		}
+		symbol := documentSymbol{
+			Name:           node.Key.String(),
+			Detail:         "table",
+			Kind:           symbolObject,
+			Range:          d.toLSPRange(node.Range),
+			SelectionRange: d.toLSPRange(node.KeyRange),
+		}
+		if node.Kind == toml.NodeArrayTable {
+			symbol.Detail = "table of an array of tables"
+		}
+		for _, child := range node.Children {
+			symbol.Children = append(symbol.Children, d.keyValueSymbol(child, node.Key))
+		}
+		symbols = append(symbols, symbol)
+	}
+	return symbols
+}
+
+// Symbol of a key/value pair of the table whose key is prefix.
+func (d *document) keyValueSymbol(node *toml.Node, prefix toml.Key) documentSymbol {
+	symbol := documentSymbol{
+		Name:           node.Key[len(prefix):].String(),
+		Detail:         node.Value.Kind().String(),
+		Kind:           symbolProperty,
+		Range:          d.toLSPRange(node.Range),
+		SelectionRange: d.toLSPRange(node.KeyRange),
+	}
+	switch node.Value.Kind() {
+	case toml.KindString:
+		symbol.Kind = symbolString
+	case toml.KindInteger, toml.KindFloat:
+		symbol.Kind = symbolNumber
+	case toml.KindBool:
+		symbol.Kind = symbolBoolean
+	case toml.KindArray:
+		symbol.Kind = symbolArray
+	case toml.KindTable:
+		symbol.Kind = symbolObject
+		// keys of inline tables
+		for _, child := range node.Children[0].Children {
+			symbol.Children = append(symbol.Children, d.keyValueSymbol(child, node.Key))
+		}
+	}
+	return symbol
+}
+
+// Edits formatting the document, replacing its whole text if it changes.
+func (d *document) formatting() ([]textEdit, error) {
+	formatted, err := format([]byte(d.text))
+	if err != nil {
+		return nil, err
+	}
+	if formatted == d.text {
+		return []textEdit{}, nil
+	}
+	return []textEdit{{Range: lspRange{End: d.end()}, NewText: formatted}}, nil
+}
+
+// Format doc: write its key/value pairs as "key = value", remove trailing
+// spaces and collapse runs of blank lines. The lines of multiline strings are
+// left untouched.
+func format(doc []byte) (string, error) {
+	root, err := toml.ParseNodes(doc)
+	if err != nil {
+		return "", err
+	}
+	bom := string(doc[:len(doc)-len(strings.TrimPrefix(string(doc), "\ufeff"))])
+	src := string(doc[len(bom):])
+	lineStarts := []int{0}
+	for i, c := range src {
+		if c == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	offset := func(pos toml.Position) int {
+		off := lineStarts[pos.Line-1]
+		for col := 1; col < pos.Col && off < len(src); col++ {
+			_, size := utf8.DecodeRuneInString(src[off:])
+			off += size
+		}
+		return off
+	}
+
+	var b strings.Builder
+	last := 0
+	protected := map[int]bool{}
+	toml.Walk(visitFunc(func(node *toml.Node) bool {
+		switch node.Kind {
+		case toml.NodeKeyValue:
+			// nodes are visited in document order
+			start, end := offset(node.KeyRange.End), offset(node.Children[0].Range.Start)
+			b.WriteString(src[last:start])
+			b.WriteString(" = ")
+			last = end
+		case toml.NodeValue:
+			if node.Value.Kind() == toml.KindString {
+				for line := node.Range.Start.Line; line <= node.Range.End.Line && node.Range.Start.Line != node.Range.End.Line; line++ {
+					protected[line] = true
+				}
+			}
+		}
+		return true
+	}), root)
+	b.WriteString(src[last:])
+
+	var lines []string
+	for i, line := range strings.Split(b.String(), "\n") {
+		if !protected[i+1] {
+			cr := strings.HasSuffix(line, "\r")
+			line = strings.TrimRight(line, " \t\r")
+			if line == "" && (len(lines) == 0 || lines[len(lines)-1] == "" || lines[len(lines)-1] == "\r") {
+				continue
+			}
+			if cr {
+				line += "\r"
+			}
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) > 0 && strings.TrimSuffix(lines[len(lines)-1], "\r") == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return bom, nil
+	}
+	return bom + strings.Join(lines, "\n") + "\n", nil
+}
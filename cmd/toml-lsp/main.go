@@ -0,0 +1,208 @@
+// Toml-lsp is a language server for TOML files, giving editors the
+// diagnostics, hovers, outline and formatting of go-toml.
+//
+// Usage:
+//
+//	toml-lsp [-schema schema.toml|schema.json]
+//
+// Toml-lsp speaks the Language Server Protocol on its standard input and
+// output, and is started by editors rather than by hand. It reports the
+// syntax errors of documents and the warnings of the TOML linter as they are
+// edited, and, given a schema, the values that do not follow it. The schema
+// is read by schema.Load, or as a JSON Schema if its name ends with .json.
+// Documents are parsed by toml.LoadDocumentPartial, so that all their errors
+// are reported, and that their valid parts keep their hovers and outline.
+//
+// Hovering a key or a value shows its complete key and its type, the outline
+// of a document lists its tables and keys, and formatting a document writes
+// its keys and values as "key = value", removes trailing spaces and collapses
+// runs of blank lines, keeping comments and the order of the document.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pelletier/go-toml/schema"
+)
+
+func main() {
+	schemaPath := flag.String("schema", "", "validate documents against a schema, read by schema.Load or as a JSON Schema if the file name ends with .json.")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "toml-lsp is a language server for TOML files, speaking on its standard input and output:")
+		fmt.Fprintln(os.Stderr, "  toml-lsp [-schema schema.toml|schema.json]")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Flags:")
+		fmt.Fprintln(os.Stderr, "-schema      validate documents against a schema, read by schema.Load or as a JSON Schema if the file name ends with .json.")
+	}
+	flag.Parse()
+	os.Exit(processMain(*schemaPath, os.Stdin, os.Stdout, os.Stderr))
+}
+
+// validator checks documents against a schema.
+type validator interface {
+	Validate(doc []byte) ([]schema.Violation, error)
+}
+
+func processMain(schemaPath string, input io.Reader, output io.Writer, errorOutput io.Writer) int {
+	s := &server{output: output, documents: map[string]*document{}}
+	if schemaPath != "" {
+		var err error
+		if s.schema, err = loadSchema(schemaPath); err != nil {
+			fmt.Fprintln(errorOutput, err)
+			return 2
+		}
+	}
+	r := bufio.NewReader(input)
+	for {
+		b, err := readMessage(r)
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintln(errorOutput, err)
+			}
+			return 1
+		}
+		var msg message
+		if err := json.Unmarshal(b, &msg); err != nil {
+			s.replyError(nil, codeParseError, err.Error())
+			continue
+		}
+		if msg.Method == "exit" {
+			if s.shutdown {
+				return 0
+			}
+			return 1
+		}
+		if err := s.handle(&msg); err != nil {
+			fmt.Fprintln(errorOutput, err)
+			return 1
+		}
+	}
+}
+
+func loadSchema(path string) (validator, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(path, ".json") {
+		return schema.CompileJSONSchema(b)
+	}
+	return schema.Load(b)
+}
+
+type server struct {
+	output    io.Writer
+	schema    validator
+	documents map[string]*document // open documents, by URI
+	shutdown  bool
+}
+
+// Handle a request or a notification. An error is returned if the output
+// cannot be written.
+func (s *server) handle(msg *message) error {
+	var result interface{}
+	var err error
+	switch msg.Method {
+	case "initialize":
+		result = map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":           1, // full content of documents
+				"hoverProvider":              true,
+				"documentSymbolProvider":     true,
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "toml-lsp"},
+		}
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil
+		}
+		s.documents[params.TextDocument.URI] = newDocument(params.TextDocument.Text)
+		return s.publishDiagnostics(params.TextDocument.URI)
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil || len(params.ContentChanges) == 0 {
+			return nil
+		}
+		s.documents[params.TextDocument.URI] = newDocument(params.ContentChanges[len(params.ContentChanges)-1].Text)
+		return s.publishDiagnostics(params.TextDocument.URI)
+	case "textDocument/didClose":
+		var params documentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil
+		}
+		delete(s.documents, params.TextDocument.URI)
+		return s.notify("textDocument/publishDiagnostics", map[string]interface{}{
+			"uri":         params.TextDocument.URI,
+			"diagnostics": []diagnostic{},
+		})
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return s.replyError(msg.ID, codeInvalidParams, err.Error())
+		}
+		if d, ok := s.documents[params.TextDocument.URI]; ok {
+			if h := d.hover(params.Position); h != nil {
+				result = h
+			}
+		}
+	case "textDocument/documentSymbol":
+		var params documentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return s.replyError(msg.ID, codeInvalidParams, err.Error())
+		}
+		if d, ok := s.documents[params.TextDocument.URI]; ok {
+			result = d.symbols()
+		}
+	case "textDocument/formatting":
+		var params documentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return s.replyError(msg.ID, codeInvalidParams, err.Error())
+		}
+		if d, ok := s.documents[params.TextDocument.URI]; ok {
+			result, err = d.formatting()
+		}
+	default:
+		if msg.ID != nil {
+			return s.replyError(msg.ID, codeMethodNotFound, "method not supported: "+msg.Method)
+		}
+		// other notifications are ignored
+		return nil
+	}
+	if msg.ID == nil {
+		return nil
+	}
+	if err != nil {
+		return s.replyError(msg.ID, codeRequestFailed, err.Error())
+	}
+	return writeMessage(s.output, map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "result": result})
+}
+
+func (s *server) replyError(id *json.RawMessage, code int, text string) error {
+	return writeMessage(s.output, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error":   responseError{Code: code, Message: text},
+	})
+}
+
+func (s *server) notify(method string, params interface{}) error {
+	return writeMessage(s.output, map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+func (s *server) publishDiagnostics(uri string) error {
+	return s.notify("textDocument/publishDiagnostics", map[string]interface{}{
+		"uri":         uri,
+		"diagnostics": s.documents[uri].diagnostics(uri, s.schema),
+	})
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Run the server on the messages, and return the messages it wrote with the
+// exit code.
+func runServer(t *testing.T, schemaPath string, messages ...string) ([]map[string]interface{}, int) {
+	input := new(bytes.Buffer)
+	for _, m := range messages {
+		fmt.Fprintf(input, "Content-Length: %d\r\n\r\n%s", len(m), m)
+	}
+	output := new(bytes.Buffer)
+	errorOutput := new(bytes.Buffer)
+	code := processMain(schemaPath, input, output, errorOutput)
+	if errorOutput.Len() > 0 {
+		t.Errorf("unexpected error output %q", errorOutput)
+	}
+	var replies []map[string]interface{}
+	r := bufio.NewReader(output)
+	for {
+		b, err := readMessage(r)
+		if err != nil {
+			break
+		}
+		var reply map[string]interface{}
+		if err := json.Unmarshal(b, &reply); err != nil {
+			t.Fatal(err)
+		}
+		replies = append(replies, reply)
+	}
+	return replies, code
+}
+
+func request(id int, method string, params interface{}) string {
+	b, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+	return string(b)
+}
+
+func notification(method string, params interface{}) string {
+	b, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+	return string(b)
+}
+
+// JSON representation of v, for comparisons with decoded messages.
+func jsonValue(t *testing.T, v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value interface{}
+	json.Unmarshal(b, &value)
+	return value
+}
+
+func lspPos(line, character int) map[string]int {
+	return map[string]int{"line": line, "character": character}
+}
+
+func TestServer(t *testing.T) {
+	const uri = "file:///config.toml"
+	doc := "title  =\"app\"   \n\n\n[server]\nhost = \"é\"\nport = 80\nPort = 81\n"
+	replies, code := runServer(t, "",
+		request(1, "initialize", map[string]interface{}{}),
+		notification("initialized", map[string]interface{}{}),
+		notification("textDocument/didOpen", map[string]interface{}{
+			"textDocument": map[string]string{"uri": uri, "languageId": "toml", "text": "a = [1,\n"},
+		}),
+		notification("textDocument/didChange", map[string]interface{}{
+			"textDocument":   map[string]string{"uri": uri},
+			"contentChanges": []map[string]string{{"text": doc}},
+		}),
+		request(2, "textDocument/hover", map[string]interface{}{
+			"textDocument": map[string]string{"uri": uri},
+			"position":     lspPos(5, 8),
+		}),
+		request(3, "textDocument/documentSymbol", map[string]interface{}{
+			"textDocument": map[string]string{"uri": uri},
+		}),
+		request(4, "textDocument/formatting", map[string]interface{}{
+			"textDocument": map[string]string{"uri": uri},
+		}),
+		request(5, "textDocument/definition", map[string]interface{}{}),
+		request(6, "shutdown", nil),
+		notification("exit", nil),
+	)
+	if code != 0 {
+		t.Errorf("unexpected exit code %d", code)
+	}
+	if len(replies) != 8 {
+		t.Fatalf("unexpected replies %v", replies)
+	}
+
+	capabilities := replies[0]["result"].(map[string]interface{})["capabilities"].(map[string]interface{})
+	if capabilities["hoverProvider"] != true || capabilities["textDocumentSync"] != 1.0 {
+		t.Errorf("unexpected capabilities %v", capabilities)
+	}
+
+	syntaxError := []diagnostic{{
+		Range:    lspRange{Start: position{1, 0}, End: position{1, 0}},
+		Severity: severityError,
+		Source:   "toml",
+		Message:  "unterminated array",
+	}}
+	if got, expected := replies[1]["params"].(map[string]interface{})["diagnostics"], jsonValue(t, syntaxError); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected diagnostics %v, got %v", expected, got)
+	}
+	warnings := replies[2]["params"].(map[string]interface{})["diagnostics"].([]interface{})
+	if len(warnings) != 1 {
+		t.Fatalf("unexpected diagnostics %v", warnings)
+	}
+	warning := warnings[0].(map[string]interface{})
+	if warning["code"] != "suspicious-key" || !reflect.DeepEqual(warning["range"], jsonValue(t, lspRange{position{6, 0}, position{6, 4}})) {
+		t.Errorf("unexpected diagnostic %v", warning)
+	}
+
+	hover := replies[3]["result"].(map[string]interface{})
+	expectedHover := map[string]interface{}{
+		"contents": map[string]interface{}{"kind": "markdown", "value": "`server.port`: integer"},
+		"range":    jsonValue(t, lspRange{position{5, 7}, position{5, 9}}),
+	}
+	if !reflect.DeepEqual(hover, expectedHover) {
+		t.Errorf("expected hover %v, got %v", expectedHover, hover)
+	}
+
+	symbols := []documentSymbol{
+		{Name: "title", Detail: "string", Kind: symbolString, Range: lspRange{position{0, 0}, position{0, 13}}, SelectionRange: lspRange{position{0, 0}, position{0, 5}}},
+		{Name: "server", Detail: "table", Kind: symbolObject, Range: lspRange{position{3, 0}, position{6, 9}}, SelectionRange: lspRange{position{3, 1}, position{3, 7}}, Children: []documentSymbol{
+			{Name: "host", Detail: "string", Kind: symbolString, Range: lspRange{position{4, 0}, position{4, 10}}, SelectionRange: lspRange{position{4, 0}, position{4, 4}}},
+			{Name: "port", Detail: "integer", Kind: symbolNumber, Range: lspRange{position{5, 0}, position{5, 9}}, SelectionRange: lspRange{position{5, 0}, position{5, 4}}},
+			{Name: "Port", Detail: "integer", Kind: symbolNumber, Range: lspRange{position{6, 0}, position{6, 9}}, SelectionRange: lspRange{position{6, 0}, position{6, 4}}},
+		}},
+	}
+	if got, expected := replies[4]["result"], jsonValue(t, symbols); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected symbols %v, got %v", expected, got)
+	}
+
+	edits := []textEdit{{
+		Range:   lspRange{End: position{7, 0}},
+		NewText: "title = \"app\"\n\n[server]\nhost = \"é\"\nport = 80\nPort = 81\n",
+	}}
+	if got, expected := replies[5]["result"], jsonValue(t, edits); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected edits %v, got %v", expected, got)
+	}
+
+	if replies[6]["error"].(map[string]interface{})["code"] != float64(codeMethodNotFound) {
+		t.Errorf("unexpected reply %v", replies[6])
+	}
+	if replies[7]["id"] != 6.0 || replies[7]["result"] != nil {
+		t.Errorf("unexpected reply %v", replies[7])
+	}
+}
+
+func TestServerSchema(t *testing.T) {
+	dir, err := ioutil.TempDir("", "toml-lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "schema.json")
+	if err := ioutil.WriteFile(path, []byte(`{"properties": {"port": {"type": "integer", "maximum": 65535}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	replies, code := runServer(t, path,
+		notification("textDocument/didOpen", map[string]interface{}{
+			"textDocument": map[string]string{"uri": "file:///a.toml", "text": "port = 100000\n"},
+		}),
+	)
+	if code != 1 {
+		t.Errorf("unexpected exit code %d without shutdown", code)
+	}
+	diagnostics := replies[0]["params"].(map[string]interface{})["diagnostics"].([]interface{})
+	if len(diagnostics) != 1 {
+		t.Fatalf("unexpected diagnostics %v", diagnostics)
+	}
+	diag := diagnostics[0].(map[string]interface{})
+	if diag["source"] != "schema" || !reflect.DeepEqual(diag["range"], jsonValue(t, lspRange{position{0, 0}, position{0, 4}})) {
+		t.Errorf("unexpected diagnostic %v", diag)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	doc := "\n\na   =  { b= 1 }  # comment\ns = \"\"\"  \nx   \n\n\n\"\"\"\n\n\n\n[t]\t\r\nc=2\r\n\r\n\r\n"
+	expected := "a = { b = 1 }  # comment\ns = \"\"\"  \nx   \n\n\n\"\"\"\n\n[t]\r\nc = 2\r\n"
+	formatted, err := format([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if formatted != expected {
+		t.Errorf("expected %q, got %q", expected, formatted)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pelletier/go-toml"
+)
+
+// JSON-RPC error codes.
+const (
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeRequestFailed  = -32803
+)
+
+// message is a JSON-RPC request, notification or response.
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Read a message preceded by its Content-Length header.
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, fmt.Errorf("invalid message header: %s", err)
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, errors.New("invalid message header: missing Content-Length")
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func writeMessage(w io.Writer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(b), b)
+	return err
+}
+
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type textDocumentPositionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     position               `json:"position"`
+}
+
+type didOpenParams struct {
+	TextDocument struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"textDocument"`
+}
+
+type didChangeParams struct {
+	TextDocument   textDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type documentParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type diagnostic struct {
+	Range              lspRange                       `json:"range"`
+	Severity           int                            `json:"severity"`
+	Code               string                         `json:"code,omitempty"`
+	Source             string                         `json:"source"`
+	Message            string                         `json:"message"`
+	RelatedInformation []diagnosticRelatedInformation `json:"relatedInformation,omitempty"`
+}
+
+type diagnosticRelatedInformation struct {
+	Location struct {
+		URI   string   `json:"uri"`
+		Range lspRange `json:"range"`
+	} `json:"location"`
+	Message string `json:"message"`
+}
+
+// Severities of diagnostics.
+const (
+	severityError   = 1
+	severityWarning = 2
+)
+
+type hover struct {
+	Contents struct {
+		Kind  string `json:"kind"`
+		Value string `json:"value"`
+	} `json:"contents"`
+	Range lspRange `json:"range"`
+}
+
+type documentSymbol struct {
+	Name           string           `json:"name"`
+	Detail         string           `json:"detail,omitempty"`
+	Kind           int              `json:"kind"`
+	Range          lspRange         `json:"range"`
+	SelectionRange lspRange         `json:"selectionRange"`
+	Children       []documentSymbol `json:"children,omitempty"`
+}
+
+// Kinds of symbols.
+const (
+	symbolProperty = 7
+	symbolString   = 15
+	symbolNumber   = 16
+	symbolBoolean  = 17
+	symbolArray    = 18
+	symbolObject   = 19
+)
+
+type textEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+// document is an open text document. Positions of the protocol count UTF-16
+// code units from the start of lines, while those of go-toml count runes.
+type document struct {
+	text  string
+	lines []string
+}
+
+func newDocument(text string) *document {
+	return &document{text: text, lines: strings.Split(text, "\n")}
+}
+
+// Protocol position of a position of the document.
+func (d *document) toLSP(p toml.Position) position {
+	if p.Invalid() {
+		return position{}
+	}
+	if p.Line > len(d.lines) {
+		return d.end()
+	}
+	line := d.lines[p.Line-1]
+	character := 0
+	for col := 1; col < p.Col && line != ""; col++ {
+		r, size := utf8.DecodeRuneInString(line)
+		character += utf16Len(r)
+		line = line[size:]
+	}
+	return position{Line: p.Line - 1, Character: character}
+}
+
+// Position in the document of a protocol position.
+func (d *document) fromLSP(p position) toml.Position {
+	if p.Line >= len(d.lines) {
+		return toml.Position{Line: len(d.lines), Col: utf8.RuneCountInString(d.lines[len(d.lines)-1]) + 1}
+	}
+	line := d.lines[p.Line]
+	col, character := 1, 0
+	for character < p.Character && line != "" {
+		r, size := utf8.DecodeRuneInString(line)
+		character += utf16Len(r)
+		line = line[size:]
+		col++
+	}
+	return toml.Position{Line: p.Line + 1, Col: col}
+}
+
+func (d *document) toLSPRange(r toml.Range) lspRange {
+	return lspRange{Start: d.toLSP(r.Start), End: d.toLSP(r.End)}
+}
+
+// Position of the end of the document.
+func (d *document) end() position {
+	last := d.lines[len(d.lines)-1]
+	character := 0
+	for _, r := range last {
+		character += utf16Len(r)
+	}
+	return position{Line: len(d.lines) - 1, Character: character}
+}
+
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
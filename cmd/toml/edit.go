@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Print the value at path in file, or the values matching path if it is a
+// query.
+func runGet(file string, path string, output io.Writer, errorOutput io.Writer) int {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		printError(err, errorOutput)
+		return 1
+	}
+	doc, err := toml.LoadDocument(b)
+	if err != nil {
+		printError(err, errorOutput)
+		return 1
+	}
+	r := &repl{file: file, doc: doc, tree: doc.Tree(), path: toml.Key{}, output: output}
+	if strings.HasPrefix(path, "$") {
+		err = r.query(path)
+	} else {
+		err = r.get(path)
+	}
+	if err != nil {
+		printError(err, errorOutput)
+		return 1
+	}
+	return 0
+}
+
+// Set the value at path in file, or delete it if text is nil.
+func runEdit(file string, path string, text *string, errorOutput io.Writer) int {
+	key, err := toml.ParseKey(path)
+	if err != nil {
+		printError(err, errorOutput)
+		return 1
+	}
+	err = toml.EditFile(file, func(doc *toml.Document) error {
+		if text == nil {
+			if !doc.HasPath(key) {
+				return fmt.Errorf("%s does not exist", key)
+			}
+			return doc.DeletePath(key)
+		}
+		return doc.SetPath(key, inferValue(*text))
+	})
+	if err != nil {
+		printError(err, errorOutput)
+		return 1
+	}
+	return 0
+}
+
+// The value written as text on the command line: a TOML value, such as 8080,
+// true or [1, 2], or a string if text is not valid TOML.
+func inferValue(text string) interface{} {
+	if v, err := parseValue(text); err == nil {
+		return v
+	}
+	return text
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	path, cleanup := writeTempFile(t, replDocument)
+	defer cleanup()
+
+	expectProcessMainResults(t, []string{"get", path, "server.port"}, "", 0, "8080\n", "")
+	expectProcessMainResults(t, []string{"get", path, "server.routes.path"}, "", 0, "\"/b\"\n", "")
+	expectProcessMainResults(t, []string{"get", path, "$..path"}, "", 0, "server.routes.0.path = \"/a\"\nserver.routes.1.path = \"/b\"\n", "")
+	expectProcessMainResults(t, []string{"get", path, "server.user"}, "", 1, "", "server.user does not exist\n")
+	expectProcessMainResults(t, []string{"get", path + ".missing", "a"}, "", 1, "", "open "+path+".missing: no such file or directory\n")
+}
+
+func TestSetUnset(t *testing.T) {
+	path, cleanup := writeTempFile(t, replDocument)
+	defer cleanup()
+
+	expectProcessMainResults(t, []string{"set", path, "server.port", "9090"}, "", 0, "", "")
+	expectProcessMainResults(t, []string{"set", path, "server.host", "example.com"}, "", 0, "", "")
+	expectProcessMainResults(t, []string{"set", path, "server.tls.enabled", "true"}, "", 0, "", "")
+	expectProcessMainResults(t, []string{"set", path, "server.tags", `["a", "b"]`}, "", 0, "", "")
+	expectProcessMainResults(t, []string{"unset", path, "title"}, "", 0, "", "")
+	expectProcessMainResults(t, []string{"unset", path, "title"}, "", 1, "", "title does not exist\n")
+	expectProcessMainResults(t, []string{"set", path, "server.port.x", "1"}, "", 1, "", "key server.port is not a table\n")
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `# settings
+
+[server]
+host = "example.com" # the host
+port = 9090
+tls.enabled = true
+tags = ["a", "b"]
+
+[[server.routes]]
+path = "/a"
+
+[[server.routes]]
+path = "/b"
+`
+	if string(b) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, string(b))
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Print the lint warnings of file, after fixing in place the problems that
+// can be fixed if fix is true. The exit code is 1 when warnings remain.
+func runLint(file string, fix bool, output io.Writer, errorOutput io.Writer) int {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		printError(err, errorOutput)
+		return 1
+	}
+	if fix {
+		fixed, err := toml.LintFix(b)
+		if err != nil {
+			printError(err, errorOutput)
+			return 1
+		}
+		if !bytes.Equal(fixed, b) {
+			info, err := os.Stat(file)
+			if err != nil {
+				printError(err, errorOutput)
+				return 1
+			}
+			if err := toml.WriteFile(file, fixed, info.Mode().Perm()); err != nil {
+				printError(err, errorOutput)
+				return 1
+			}
+		}
+		b = fixed
+	}
+	warnings, err := toml.Lint(b)
+	if err != nil {
+		printError(err, errorOutput)
+		return 1
+	}
+	for _, w := range warnings {
+		fmt.Fprintf(output, "%s:%s\n", file, w)
+	}
+	if len(warnings) > 0 {
+		return 1
+	}
+	return 0
+}
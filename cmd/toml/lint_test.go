@@ -0,0 +1,24 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	doc := "[a]\r\nx = 1\r\n[b]\r\ny = 2\r\n[a]\r\nz = 3\r\n"
+	path, cleanup := writeTempFile(t, doc)
+	defer cleanup()
+
+	expectProcessMainResults(t, []string{"lint", path}, "", 1, path+":(5, 1): table a is already defined at (1, 1) [duplicate-table]\n", "")
+
+	expectProcessMainResults(t, []string{"lint", "--fix", path}, "", 0, "", "")
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "[a]\r\nx = 1\r\nz = 3\r\n[b]\r\ny = 2\r\n"
+	if string(b) != expected {
+		t.Errorf("expected %q, got %q", expected, b)
+	}
+}
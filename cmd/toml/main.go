@@ -0,0 +1,101 @@
+// Toml is a tool to explore and edit TOML files.
+//
+// Usage:
+//
+//	toml get file.toml path
+//	toml set file.toml path value
+//	toml unset file.toml path
+//	toml repl file.toml
+//	toml lint [-fix] file.toml
+//
+// The get command prints the value at a dotted key, such as server.port, or
+// the values matching a query, such as $..port. The set command sets the value
+// at a key, creating the tables it needs, and unset deletes it. The value is
+// given in TOML syntax, such as 8080, true or ["a", "b"]; text that is not a
+// valid TOML value is set as a string, so that strings do not need to be
+// quoted. Files are edited in place, preserving their comments and layout.
+//
+// The repl command opens an interactive session on the file. The document is
+// edited in memory, preserving its comments and layout, until the :write
+// command saves it. Type help in the session for the list of commands.
+//
+// The lint command prints the problems found in the file, such as tables
+// defined several times, and exits with status 1 if there are any. With -fix,
+// the problems that can be fixed automatically are fixed in place first,
+// preserving comments and layout.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "toml explores and edits TOML files:")
+		fmt.Fprintln(os.Stderr, "  toml get file.toml path          print the value at path, or matching a query")
+		fmt.Fprintln(os.Stderr, "  toml set file.toml path value    set the value at path")
+		fmt.Fprintln(os.Stderr, "  toml unset file.toml path        delete the value at path")
+		fmt.Fprintln(os.Stderr, "  toml repl file.toml              open an interactive session on file.toml")
+		fmt.Fprintln(os.Stderr, "  toml lint [-fix] file.toml       print the lint problems of file.toml, fixing them in place with -fix")
+	}
+	flag.Parse()
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		interactive = true
+	}
+	os.Exit(processMain(flag.Args(), os.Stdin, os.Stdout, os.Stderr))
+}
+
+// Whether the standard input is a terminal, in which case prompts are shown.
+var interactive bool
+
+func processMain(args []string, input io.Reader, output io.Writer, errorOutput io.Writer) int {
+	if len(args) == 0 {
+		flag.Usage()
+		return 2
+	}
+	switch args[0] {
+	case "get":
+		if len(args) != 3 {
+			flag.Usage()
+			return 2
+		}
+		return runGet(args[1], args[2], output, errorOutput)
+	case "set":
+		if len(args) != 4 {
+			flag.Usage()
+			return 2
+		}
+		return runEdit(args[1], args[2], &args[3], errorOutput)
+	case "unset":
+		if len(args) != 3 {
+			flag.Usage()
+			return 2
+		}
+		return runEdit(args[1], args[2], nil, errorOutput)
+	case "repl":
+		if len(args) != 2 {
+			flag.Usage()
+			return 2
+		}
+		return runRepl(args[1], input, output, errorOutput)
+	case "lint":
+		flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+		flags.SetOutput(errorOutput)
+		fix := flags.Bool("fix", false, "fix the problems that can be fixed automatically")
+		if err := flags.Parse(args[1:]); err != nil || flags.NArg() != 1 {
+			flag.Usage()
+			return 2
+		}
+		return runLint(flags.Arg(0), *fix, output, errorOutput)
+	default:
+		printError(fmt.Errorf("unknown command %q", args[0]), errorOutput)
+		return 2
+	}
+}
+
+func printError(err error, output io.Writer) {
+	io.WriteString(output, err.Error()+"\n")
+}
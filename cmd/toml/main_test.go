@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const replDocument = `# settings
+title = "x"
+
+[server]
+host = "localhost" # the host
+port = 8080
+
+[[server.routes]]
+path = "/a"
+
+[[server.routes]]
+path = "/b"
+`
+
+func writeTempFile(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.toml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func expectProcessMainResults(t *testing.T, args []string, input string, exitCode int, expectedOutput string, expectedError string) {
+	outputBuffer := new(bytes.Buffer)
+	errorBuffer := new(bytes.Buffer)
+
+	returnCode := processMain(args, strings.NewReader(input), outputBuffer, errorBuffer)
+
+	if outputBuffer.String() != expectedOutput {
+		t.Errorf("incorrect output:\n%s\n\nexpected output:\n%s", outputBuffer.String(), expectedOutput)
+	}
+	if errorBuffer.String() != expectedError {
+		t.Errorf("incorrect error:\n%s\n\nexpected error:\n%s", errorBuffer.String(), expectedError)
+	}
+	if returnCode != exitCode {
+		t.Error("incorrect return code:", returnCode, "expected", exitCode)
+	}
+}
+
+func TestReplNavigation(t *testing.T) {
+	path, cleanup := writeTempFile(t, replDocument)
+	defer cleanup()
+
+	input := `ls
+cd server
+pwd
+ls
+get port
+type host
+cd ..
+get server.routes.path
+cd nothing
+query $..path
+`
+	expectedOutput := `server	table
+title	string
+/server
+host	string
+port	integer
+routes	array of tables
+8080
+string
+"/b"
+server.routes.0.path = "/a"
+server.routes.1.path = "/b"
+`
+	expectProcessMainResults(t, []string{"repl", path}, input, 0, expectedOutput, "nothing is not a table\n")
+}
+
+func TestReplCompletion(t *testing.T) {
+	path, cleanup := writeTempFile(t, replDocument)
+	defer cleanup()
+
+	input := "g\t\nget \t\nget server.\t\ncd server\nls ../t\t\nget /server.routes.\t\n"
+	expectedOutput := `get
+server. title
+server.host server.port server.routes.
+../title
+/server.routes.path
+`
+	expectProcessMainResults(t, []string{"repl", path}, input, 0, expectedOutput, "")
+}
+
+func TestReplEdit(t *testing.T) {
+	path, cleanup := writeTempFile(t, replDocument)
+	defer cleanup()
+
+	input := `set server.port 9090
+set title
+rm title
+set server.tags ["a", "b"]
+:quit
+:write
+:quit
+`
+	expectProcessMainResults(t, []string{"repl", path}, input, 0, "wrote "+path+"\n",
+		"usage: set path value\nunsaved edits, use :write to save them or :quit! to discard them\n")
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `# settings
+
+[server]
+host = "localhost" # the host
+port = 9090
+tags = ["a", "b"]
+
+[[server.routes]]
+path = "/a"
+
+[[server.routes]]
+path = "/b"
+`
+	if string(b) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, string(b))
+	}
+}
+
+func TestReplDiscard(t *testing.T) {
+	path, cleanup := writeTempFile(t, replDocument)
+	defer cleanup()
+
+	expectProcessMainResults(t, []string{"repl", path}, "rm title\n", 0, "", "unsaved edits discarded\n")
+	expectProcessMainResults(t, []string{"repl", path}, "rm title\n:quit!\nls\n", 0, "", "")
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != replDocument {
+		t.Errorf("document should not have been written, got:\n%s", string(b))
+	}
+}
+
+func TestProcessMainErrors(t *testing.T) {
+	path, cleanup := writeTempFile(t, "a = \n")
+	defer cleanup()
+
+	expectProcessMainResults(t, []string{"repl", path}, "", 1, "", "(2, 1): expecting a value\n")
+	expectProcessMainResults(t, []string{"edit", path}, "", 2, "", "unknown command \"edit\"\n")
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"github.com/pelletier/go-toml/query"
+)
+
+const replHelp = `Paths are dotted keys relative to the current table. A path starting with /
+is relative to the root of the document, and .. designates the parent table.
+
+  ls [path]           list the keys of a table and their types
+  cd [path]           change the current table, to the root if path is empty
+  pwd                 print the path of the current table
+  get [path]          print a value or a table
+  type path           print the TOML type of a value
+  query expr          print the values matching a query, such as $..port
+  set path value      set a value, given in TOML syntax
+  rm path             delete a key
+  :write              save the document to the file
+  :quit, :q           end the session; :quit! discards unsaved edits
+  help                print this help
+
+A line ending with a tab lists the completions of its last word.
+`
+
+// Interactive session on a document.
+type repl struct {
+	file   string
+	doc    *toml.Document
+	tree   *toml.Tree
+	path   toml.Key
+	dirty  bool
+	output io.Writer
+}
+
+// Returned by exec to end the session. Other errors are printed and the
+// session goes on.
+var errQuit = errors.New("quit")
+
+func runRepl(file string, input io.Reader, output io.Writer, errorOutput io.Writer) int {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		printError(err, errorOutput)
+		return 1
+	}
+	doc, err := toml.LoadDocument(b)
+	if err != nil {
+		printError(err, errorOutput)
+		return 1
+	}
+	r := &repl{file: file, doc: doc, tree: doc.Tree(), path: toml.Key{}, output: output}
+
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(nil, 1<<20)
+	for {
+		if interactive {
+			fmt.Fprintf(output, "%s> ", r.path)
+		}
+		if !scanner.Scan() {
+			break
+		}
+		line := scanner.Text()
+		if strings.HasSuffix(line, "\t") {
+			fmt.Fprintln(output, strings.Join(r.complete(strings.TrimRight(line, "\t")), " "))
+			continue
+		}
+		if err := r.exec(line); err == errQuit {
+			return 0
+		} else if err != nil {
+			printError(err, errorOutput)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		printError(err, errorOutput)
+		return 1
+	}
+	if r.dirty {
+		printError(errors.New("unsaved edits discarded"), errorOutput)
+	}
+	return 0
+}
+
+// Execute a command line.
+func (r *repl) exec(line string) error {
+	command, arg := splitCommand(line)
+	switch command {
+	case "":
+		return nil
+	case "help":
+		io.WriteString(r.output, replHelp)
+	case "pwd":
+		fmt.Fprintln(r.output, "/"+r.path.String())
+	case "ls":
+		return r.list(arg)
+	case "cd":
+		if arg == "" {
+			arg = "/"
+		}
+		key, err := r.resolve(arg)
+		if err != nil {
+			return err
+		}
+		if r.table(key) == nil {
+			return fmt.Errorf("%s is not a table", key)
+		}
+		r.path = key
+	case "get":
+		return r.get(arg)
+	case "type":
+		key, err := r.resolve(arg)
+		if err != nil {
+			return err
+		}
+		v := r.tree.GetValuePath(key)
+		if v == nil {
+			return fmt.Errorf("%s does not exist", key)
+		}
+		fmt.Fprintln(r.output, v.Kind())
+	case "query":
+		return r.query(arg)
+	case "set":
+		path, text := splitCommand(arg)
+		if text == "" {
+			return errors.New("usage: set path value")
+		}
+		key, err := r.resolve(path)
+		if err != nil {
+			return err
+		}
+		value, err := parseValue(text)
+		if err != nil {
+			return err
+		}
+		return r.edit(r.doc.SetPath(key, value))
+	case "rm":
+		key, err := r.resolve(arg)
+		if err != nil {
+			return err
+		}
+		return r.edit(r.doc.DeletePath(key))
+	case ":write", ":w":
+		return r.write()
+	case ":quit", ":q":
+		if r.dirty {
+			return errors.New("unsaved edits, use :write to save them or :quit! to discard them")
+		}
+		return errQuit
+	case ":quit!", ":q!":
+		return errQuit
+	default:
+		return fmt.Errorf("unknown command %q, type help for the list of commands", command)
+	}
+	return nil
+}
+
+// Split a line into its first word and the rest.
+func splitCommand(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	i := strings.IndexAny(line, " \t")
+	if i < 0 {
+		return line, ""
+	}
+	return line[:i], strings.TrimSpace(line[i+1:])
+}
+
+// Resolve a path given to a command into the key of the document it
+// designates.
+func (r *repl) resolve(path string) (toml.Key, error) {
+	base := r.path
+	if strings.HasPrefix(path, "/") {
+		base = toml.Key{}
+		path = path[1:]
+	}
+	for {
+		if path == ".." || strings.HasPrefix(path, "../") {
+			base = base.Parent()
+			path = strings.TrimPrefix(path[2:], "/")
+			continue
+		}
+		break
+	}
+	if path == "" {
+		return base.Append(), nil
+	}
+	key, err := toml.ParseKey(path)
+	if err != nil {
+		return nil, err
+	}
+	return base.Append(key...), nil
+}
+
+// The table at key, or the last table of the array of tables at key, or nil.
+func (r *repl) table(key toml.Key) *toml.Tree {
+	switch node := r.tree.GetPath(key).(type) {
+	case *toml.Tree:
+		return node
+	case []*toml.Tree:
+		if len(node) > 0 {
+			return node[len(node)-1]
+		}
+	}
+	return nil
+}
+
+// Sorted keys of a table.
+func sortedKeys(t *toml.Tree) []string {
+	keys := t.Keys()
+	sort.Strings(keys)
+	return keys
+}
+
+func (r *repl) list(arg string) error {
+	key, err := r.resolve(arg)
+	if err != nil {
+		return err
+	}
+	t := r.table(key)
+	if t == nil {
+		return fmt.Errorf("%s is not a table", key)
+	}
+	for _, k := range sortedKeys(t) {
+		kind := t.GetValuePath([]string{k}).Kind().String()
+		if _, ok := t.GetPath([]string{k}).([]*toml.Tree); ok {
+			kind = "array of tables"
+		}
+		fmt.Fprintf(r.output, "%s\t%s\n", toml.Key{k}, kind)
+	}
+	return nil
+}
+
+func (r *repl) get(arg string) error {
+	key, err := r.resolve(arg)
+	if err != nil {
+		return err
+	}
+	switch node := r.tree.GetPath(key).(type) {
+	case nil:
+		return fmt.Errorf("%s does not exist", key)
+	case *toml.Tree:
+		io.WriteString(r.output, node.String())
+	case []*toml.Tree:
+		for _, t := range node {
+			fmt.Fprintf(r.output, "[[%s]]\n%s", key, t.String())
+		}
+	default:
+		s, err := toml.ValueStringRepresentation(node, "", "", toml.OrderAlphabetical, false)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(r.output, s)
+	}
+	return nil
+}
+
+func (r *repl) query(expr string) error {
+	result, err := query.CompileAndExecute(expr, r.tree)
+	if err != nil {
+		return err
+	}
+	keys := result.Keys()
+	for i, v := range result.Values() {
+		s, err := toml.ValueStringRepresentation(v, "", "", toml.OrderAlphabetical, false)
+		if err != nil {
+			s = fmt.Sprintf("%v", v)
+		}
+		if t, ok := v.(*toml.Tree); ok {
+			s = "{" + strings.Join(sortedKeys(t), ", ") + "}"
+		}
+		fmt.Fprintf(r.output, "%s = %s\n", keys[i], s)
+	}
+	return nil
+}
+
+// Parse a value written in TOML syntax.
+func parseValue(text string) (interface{}, error) {
+	tree, err := toml.Load("v = " + text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %s", text)
+	}
+	return tree.ToMap()["v"], nil
+}
+
+// Record the result of an edit of the document.
+func (r *repl) edit(err error) error {
+	if err != nil {
+		return err
+	}
+	r.tree = r.doc.Tree()
+	r.dirty = true
+	if r.table(r.path) == nil {
+		r.path = toml.Key{}
+	}
+	return nil
+}
+
+func (r *repl) write() error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(r.file); err == nil {
+		mode = info.Mode()
+	}
+	if err := ioutil.WriteFile(r.file, r.doc.Bytes(), mode); err != nil {
+		return err
+	}
+	r.dirty = false
+	fmt.Fprintf(r.output, "wrote %s\n", r.file)
+	return nil
+}
+
+var replCommands = []string{"cd", "get", "help", "ls", "pwd", "query", "rm", "set", "type", ":quit", ":write"}
+
+// Complete the last word of line: a command name if it is the first word,
+// or a path otherwise. Completions of tables end with a dot.
+func (r *repl) complete(line string) []string {
+	i := strings.LastIndexAny(line, " \t")
+	word := line[i+1:]
+	var candidates []string
+	if strings.TrimSpace(line[:i+1]) == "" {
+		for _, c := range replCommands {
+			if strings.HasPrefix(c, word) {
+				candidates = append(candidates, c)
+			}
+		}
+		return candidates
+	}
+
+	// The leading / and ../ of the word and the part up to its last dot, if
+	// any, designate the table whose keys are completed.
+	rest := strings.TrimPrefix(word, "/")
+	for strings.HasPrefix(rest, "../") {
+		rest = rest[3:]
+	}
+	prefix, partial := word[:len(word)-len(rest)], rest
+	if dot := strings.LastIndex(rest, "."); dot >= 0 {
+		prefix, partial = prefix+rest[:dot+1], rest[dot+1:]
+	}
+	key, err := r.resolve(strings.TrimSuffix(prefix, "."))
+	if err != nil {
+		return nil
+	}
+	t := r.table(key)
+	if t == nil {
+		return nil
+	}
+	for _, k := range sortedKeys(t) {
+		if !strings.HasPrefix(k, partial) {
+			continue
+		}
+		c := prefix + toml.Key{k}.String()
+		if r.table(key.Append(k)) != nil {
+			c += "."
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates
+}
@@ -0,0 +1,59 @@
+// Tomldiff compares two TOML files and prints the keys that differ.
+//
+// Usage:
+//
+//	tomldiff old.toml new.toml
+//
+// Each line of the output describes an added (+), removed (-) or changed (~)
+// key. The exit code is 0 if the documents are equivalent, 1 if they differ,
+// and 2 if an error occurred.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pelletier/go-toml"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "tomldiff compares two TOML files:")
+		fmt.Fprintln(os.Stderr, "  tomldiff old.toml new.toml")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Exit code is 0 if the files are equivalent, 1 if they differ, 2 on error.")
+	}
+	flag.Parse()
+	os.Exit(processMain(flag.Args(), os.Stdout, os.Stderr))
+}
+
+func processMain(files []string, output io.Writer, errorOutput io.Writer) int {
+	if len(files) != 2 {
+		flag.Usage()
+		return 2
+	}
+	before, err := toml.LoadFile(files[0])
+	if err != nil {
+		printError(err, errorOutput)
+		return 2
+	}
+	after, err := toml.LoadFile(files[1])
+	if err != nil {
+		printError(err, errorOutput)
+		return 2
+	}
+	diffs := toml.Diff(before, after)
+	for _, d := range diffs {
+		io.WriteString(output, d.String()+"\n")
+	}
+	if len(diffs) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func printError(err error, output io.Writer) {
+	io.WriteString(output, err.Error()+"\n")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTempFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func expectProcessMainResults(t *testing.T, args []string, exitCode int, expectedOutput string, expectedError string) {
+	outputBuffer := new(bytes.Buffer)
+	errorBuffer := new(bytes.Buffer)
+
+	returnCode := processMain(args, outputBuffer, errorBuffer)
+
+	if outputBuffer.String() != expectedOutput {
+		t.Errorf("incorrect output:\n%s\n\nexpected output:\n%s", outputBuffer.String(), expectedOutput)
+	}
+	if errorBuffer.String() != expectedError {
+		t.Errorf("incorrect error:\n%s\n\nexpected error:\n%s", errorBuffer.String(), expectedError)
+	}
+	if returnCode != exitCode {
+		t.Error("incorrect return code:", returnCode, "expected", exitCode)
+	}
+}
+
+func TestProcessMainDifferences(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tomldiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	before := writeTempFile(t, dir, "old.toml", "a = 1\nb = 2\n[c]\nd = \"x\"\n")
+	after := writeTempFile(t, dir, "new.toml", "a = 1\n[c]\nd = \"y\"\ne = true\n")
+
+	expectedOutput := `- b = 2
+~ c.d = "x" -> "y"
++ c.e = true
+`
+	expectProcessMainResults(t, []string{before, after}, 1, expectedOutput, "")
+	expectProcessMainResults(t, []string{before, before}, 0, "", "")
+}
+
+func TestProcessMainInvalidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tomldiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	valid := writeTempFile(t, dir, "valid.toml", "a = 1\n")
+	invalid := writeTempFile(t, dir, "invalid.toml", "a = \n")
+
+	expectProcessMainResults(t, []string{valid, invalid}, 2, "", "(2, 1): expecting a value\n")
+}
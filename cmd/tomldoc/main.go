@@ -0,0 +1,428 @@
+// Tomldoc generates the reference documentation of a configuration struct.
+//
+// Usage:
+//
+//	tomldoc [-dir path] [-format markdown|toml] Type
+//
+// Tomldoc reads the Go package in dir, the current directory by default, and
+// documents the keys Type is unmarshaled from: their TOML type, their value
+// from the default tag, and their description from the doc comment of the
+// field or its comment tag. Fields of struct types declared in the package
+// are documented as tables. The markdown format is a table of every key, the
+// toml format an annotated configuration file where keys without a default
+// are commented out.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "directory of the Go package declaring the type")
+	format := flag.String("format", "markdown", "output format: markdown or toml")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "tomldoc documents the TOML keys of a Go configuration struct:")
+		fmt.Fprintln(os.Stderr, "  tomldoc [-dir path] [-format markdown|toml] Type")
+		fmt.Fprintln(os.Stderr, "")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	os.Exit(processMain(*dir, *format, flag.Args(), os.Stdout, os.Stderr))
+}
+
+func processMain(dir, format string, args []string, output io.Writer, errorOutput io.Writer) int {
+	if len(args) != 1 {
+		flag.Usage()
+		return 2
+	}
+	doc, err := extract(dir, args[0])
+	if err != nil {
+		printError(err, errorOutput)
+		return 1
+	}
+	switch format {
+	case "markdown":
+		err = writeMarkdown(output, doc)
+	case "toml":
+		err = writeToml(output, doc)
+	default:
+		err = fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		printError(err, errorOutput)
+		return 1
+	}
+	return 0
+}
+
+func printError(err error, output io.Writer) {
+	io.WriteString(output, err.Error()+"\n")
+}
+
+// Documentation of a struct type.
+type typeDoc struct {
+	name string
+	doc  string
+	keys []keyDoc
+}
+
+// Documentation of a key.
+type keyDoc struct {
+	path         toml.Key
+	typ          string // TOML type, or Go type when it has no TOML equivalent
+	doc          string
+	defaultValue string
+	hasDefault   bool
+	table        bool // a table, or an array of tables when array is set
+	array        bool
+}
+
+// Parse the package in dir and document the struct type named name.
+func extract(dir, name string) (*typeDoc, error) {
+	fset := token.NewFileSet()
+	notTest := func(fi os.FileInfo) bool { return !strings.HasSuffix(fi.Name(), "_test.go") }
+	pkgs, err := parser.ParseDir(fset, dir, notTest, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	e := extractor{types: map[string]*ast.TypeSpec{}, docs: map[string]string{}, visiting: map[string]bool{}}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					ts := spec.(*ast.TypeSpec)
+					e.types[ts.Name.Name] = ts
+					e.docs[ts.Name.Name] = commentText(ts.Doc)
+					if e.docs[ts.Name.Name] == "" && len(gen.Specs) == 1 {
+						e.docs[ts.Name.Name] = commentText(gen.Doc)
+					}
+				}
+			}
+		}
+	}
+	ts, ok := e.types[name]
+	if !ok {
+		return nil, fmt.Errorf("type %s not found in %s", name, dir)
+	}
+	st, ok := ts.Type.(*ast.StructType)
+	if !ok {
+		return nil, fmt.Errorf("type %s is not a struct", name)
+	}
+	doc := &typeDoc{name: name, doc: e.docs[name]}
+	e.visiting[name] = true
+	if err := e.fields(doc, nil, st); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+type extractor struct {
+	types    map[string]*ast.TypeSpec
+	docs     map[string]string
+	visiting map[string]bool // struct types being documented, to stop on recursive types
+}
+
+// Document the fields of st, whose keys are in the table at prefix.
+func (e *extractor) fields(doc *typeDoc, prefix toml.Key, st *ast.StructType) error {
+	for _, field := range st.Fields.List {
+		var tag reflect.StructTag
+		if field.Tag != nil {
+			unquoted, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				return err
+			}
+			tag = reflect.StructTag(unquoted)
+		}
+		parse := strings.Split(tag.Get("toml"), ",")
+		if parse[0] == "-" && len(parse) == 1 {
+			continue
+		}
+		name := strings.TrimSpace(parse[0])
+
+		if len(field.Names) == 0 {
+			// embedded structs without a name in their tag have their fields
+			// promoted, like the encoder does
+			if name == "" {
+				if nested, _ := e.structType(field.Type); nested != nil {
+					if err := e.fields(doc, prefix, nested); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+			if name == "" {
+				name = embeddedName(field.Type)
+			}
+			if err := e.field(doc, prefix, name, field, tag); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, ident := range field.Names {
+			if !ident.IsExported() {
+				continue
+			}
+			key := name
+			if key == "" {
+				key = ident.Name
+			}
+			if err := e.field(doc, prefix, key, field, tag); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Document the key of a field.
+func (e *extractor) field(doc *typeDoc, prefix toml.Key, name string, field *ast.Field, tag reflect.StructTag) error {
+	kd := keyDoc{
+		path: prefix.Append(name),
+		doc:  commentText(field.Doc),
+	}
+	if kd.doc == "" {
+		kd.doc = commentText(field.Comment)
+	}
+	if kd.doc == "" {
+		kd.doc = tag.Get("comment")
+	}
+	kd.defaultValue, kd.hasDefault = tag.Lookup("default")
+
+	fieldType := field.Type
+	if star, ok := fieldType.(*ast.StarExpr); ok {
+		fieldType = star.X
+	}
+	if array, ok := fieldType.(*ast.ArrayType); ok {
+		if nested, typeName := e.structType(array.Elt); nested != nil && !isByteSlice(array) {
+			kd.table, kd.array, kd.typ = true, true, "array of tables"
+			return e.table(doc, kd, typeName, nested)
+		}
+	}
+	if nested, typeName := e.structType(fieldType); nested != nil {
+		kd.table, kd.typ = true, "table"
+		return e.table(doc, kd, typeName, nested)
+	}
+	kd.typ = tomlType(fieldType)
+	doc.keys = append(doc.keys, kd)
+	return nil
+}
+
+// Document a table and its keys.
+func (e *extractor) table(doc *typeDoc, kd keyDoc, typeName string, st *ast.StructType) error {
+	if kd.doc == "" {
+		kd.doc = e.docs[typeName]
+	}
+	doc.keys = append(doc.keys, kd)
+	if typeName != "" {
+		if e.visiting[typeName] {
+			return nil
+		}
+		e.visiting[typeName] = true
+		defer delete(e.visiting, typeName)
+	}
+	return e.fields(doc, kd.path, st)
+}
+
+// The struct type of expr if it is declared in the package or anonymous, and
+// its name.
+func (e *extractor) structType(expr ast.Expr) (*ast.StructType, string) {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	switch t := expr.(type) {
+	case *ast.StructType:
+		return t, ""
+	case *ast.Ident:
+		if ts, ok := e.types[t.Name]; ok {
+			if st, ok := ts.Type.(*ast.StructType); ok {
+				return st, t.Name
+			}
+		}
+	}
+	return nil, ""
+}
+
+func embeddedName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.Ident:
+		return t.Name
+	}
+	return types.ExprString(expr)
+}
+
+func isByteSlice(array *ast.ArrayType) bool {
+	ident, ok := array.Elt.(*ast.Ident)
+	return ok && (ident.Name == "byte" || ident.Name == "uint8")
+}
+
+// The TOML type values of a Go type are encoded as.
+func tomlType(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return tomlType(t.X)
+	case *ast.Ident:
+		switch t.Name {
+		case "string":
+			return "string"
+		case "bool":
+			return "boolean"
+		case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr":
+			return "integer"
+		case "float32", "float64":
+			return "float"
+		}
+	case *ast.SelectorExpr:
+		switch types.ExprString(t) {
+		case "time.Time":
+			return "datetime"
+		case "toml.LocalDate":
+			return "local date"
+		case "toml.LocalTime":
+			return "local time"
+		case "toml.LocalDateTime":
+			return "local datetime"
+		}
+	case *ast.ArrayType:
+		if isByteSlice(t) {
+			return "string"
+		}
+		return "array of " + tomlType(t.Elt)
+	case *ast.MapType:
+		return "table"
+	}
+	return types.ExprString(expr)
+}
+
+func commentText(group *ast.CommentGroup) string {
+	return strings.TrimSpace(group.Text())
+}
+
+func writeMarkdown(w io.Writer, doc *typeDoc) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", doc.name)
+	if doc.doc != "" {
+		fmt.Fprintf(&b, "%s\n\n", doc.doc)
+	}
+	b.WriteString("| Key | Type | Default | Description |\n")
+	b.WriteString("|-----|------|---------|-------------|\n")
+	for _, kd := range doc.keys {
+		key := kd.path.String()
+		if kd.array {
+			key = "[[" + key + "]]"
+		} else if kd.table {
+			key = "[" + key + "]"
+		}
+		var def string
+		if kd.hasDefault {
+			def = "`" + kd.defaultValue + "`"
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | %s | %s |\n", key, kd.typ, def, markdownCell(kd.doc))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func markdownCell(s string) string {
+	s = strings.Replace(s, "|", `\|`, -1)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func writeToml(w io.Writer, doc *typeDoc) error {
+	tree, err := toml.TreeFromMap(map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	for i, kd := range doc.keys {
+		var value interface{}
+		switch {
+		case kd.array:
+			value = []*toml.Tree{newTable()}
+		case kd.table:
+			value = newTable()
+		default:
+			value, err = tomlValue(kd)
+			if err != nil {
+				return fmt.Errorf("%s: %s", kd.path, err)
+			}
+		}
+		tree.SetPathWithComment(kd.path, kd.doc, !kd.hasDefault && !kd.table, value)
+		// keys are written in the order of the fields
+		tree.SetPositionPath(kd.path, toml.Position{Line: i + 1, Col: 1})
+	}
+	var b strings.Builder
+	if doc.doc != "" {
+		for _, line := range strings.Split(doc.doc, "\n") {
+			b.WriteString(strings.TrimSpace("# "+line) + "\n")
+		}
+		b.WriteString("\n")
+	}
+	var body bytes.Buffer
+	if err := toml.NewEncoder(&body).Order(toml.OrderPreserve).Encode(tree); err != nil {
+		return err
+	}
+	b.WriteString(strings.TrimLeft(body.String(), "\n"))
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+func newTable() *toml.Tree {
+	tree, _ := toml.TreeFromMap(map[string]interface{}{})
+	return tree
+}
+
+// The default value of a key, or the zero value of its type when it has no
+// default.
+func tomlValue(kd keyDoc) (interface{}, error) {
+	if !kd.hasDefault {
+		switch {
+		case kd.typ == "boolean":
+			return false, nil
+		case kd.typ == "integer":
+			return int64(0), nil
+		case kd.typ == "float":
+			return 0.0, nil
+		case strings.HasPrefix(kd.typ, "array of "):
+			return []interface{}{}, nil
+		default:
+			return "", nil
+		}
+	}
+	switch kd.typ {
+	case "boolean":
+		return strconv.ParseBool(kd.defaultValue)
+	case "integer":
+		return strconv.ParseInt(kd.defaultValue, 10, 64)
+	case "float":
+		return strconv.ParseFloat(kd.defaultValue, 64)
+	case "datetime", "local date", "local time", "local datetime":
+		tree, err := toml.Load("value = " + kd.defaultValue)
+		if err != nil {
+			return nil, errors.New("invalid default " + kd.defaultValue)
+		}
+		return tree.Get("value"), nil
+	default:
+		return kd.defaultValue, nil
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testPackage = `package config
+
+// Config is the configuration of the server.
+type Config struct {
+	// Name of the service.
+	Name    string ` + "`toml:\"name\" default:\"api\"`" + `
+	Port    int    ` + "`toml:\"port\" default:\"8080\"`" + ` // port to listen on
+	Debug   bool   ` + "`comment:\"enable debug logs\"`" + `
+	Tags    []string
+	secret  string
+	Skipped string ` + "`toml:\"-\"`" + `
+	Common
+	// Database connection.
+	DB       Database   ` + "`toml:\"database\"`" + `
+	Backends []*Backend ` + "`toml:\"backend\"`" + `
+}
+
+type Common struct {
+	Region string ` + "`toml:\"region\" default:\"eu\"`" + `
+}
+
+type Database struct {
+	URL string ` + "`toml:\"url\"`" + `
+}
+
+// Backend is a server requests are sent to.
+type Backend struct {
+	Host   string  ` + "`toml:\"host\"`" + `
+	Weight float64 ` + "`toml:\"weight\" default:\"1.5\"`" + `
+	Next   *Backend
+}
+`
+
+func writeTestPackage(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "tomldoc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.go"), []byte(testPackage), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func expectProcessMainResults(t *testing.T, dir, format string, args []string, exitCode int, expectedOutput string, expectedError string) {
+	outputBuffer := new(bytes.Buffer)
+	errorBuffer := new(bytes.Buffer)
+
+	returnCode := processMain(dir, format, args, outputBuffer, errorBuffer)
+
+	if outputBuffer.String() != expectedOutput {
+		t.Errorf("incorrect output:\n%s\n\nexpected output:\n%s", outputBuffer.String(), expectedOutput)
+	}
+	if errorBuffer.String() != expectedError {
+		t.Errorf("incorrect error:\n%s\n\nexpected error:\n%s", errorBuffer.String(), expectedError)
+	}
+	if returnCode != exitCode {
+		t.Error("incorrect return code:", returnCode, "expected", exitCode)
+	}
+}
+
+func TestProcessMainMarkdown(t *testing.T) {
+	dir := writeTestPackage(t)
+	defer os.RemoveAll(dir)
+
+	expectedOutput := "# Config\n" +
+		"\n" +
+		"Config is the configuration of the server.\n" +
+		"\n" +
+		"| Key | Type | Default | Description |\n" +
+		"|-----|------|---------|-------------|\n" +
+		"| `name` | string | `api` | Name of the service. |\n" +
+		"| `port` | integer | `8080` | port to listen on |\n" +
+		"| `Debug` | boolean |  | enable debug logs |\n" +
+		"| `Tags` | array of string |  |  |\n" +
+		"| `region` | string | `eu` |  |\n" +
+		"| `[database]` | table |  | Database connection. |\n" +
+		"| `database.url` | string |  |  |\n" +
+		"| `[[backend]]` | array of tables |  | Backend is a server requests are sent to. |\n" +
+		"| `backend.host` | string |  |  |\n" +
+		"| `backend.weight` | float | `1.5` |  |\n" +
+		"| `[backend.Next]` | table |  | Backend is a server requests are sent to. |\n"
+	expectProcessMainResults(t, dir, "markdown", []string{"Config"}, 0, expectedOutput, "")
+}
+
+func TestProcessMainToml(t *testing.T) {
+	dir := writeTestPackage(t)
+	defer os.RemoveAll(dir)
+
+	expectedOutput := `# Config is the configuration of the server.
+
+# Name of the service.
+name = "api"
+
+# port to listen on
+port = 8080
+
+# enable debug logs
+# Debug = false
+# Tags = []
+region = "eu"
+
+# Database connection.
+[database]
+  # url = ""
+
+# Backend is a server requests are sent to.
+[[backend]]
+  # host = ""
+  weight = 1.5
+
+  # Backend is a server requests are sent to.
+  [backend.Next]
+`
+	expectProcessMainResults(t, dir, "toml", []string{"Config"}, 0, expectedOutput, "")
+}
+
+func TestProcessMainErrors(t *testing.T) {
+	dir := writeTestPackage(t)
+	defer os.RemoveAll(dir)
+
+	expectProcessMainResults(t, dir, "markdown", []string{"Missing"}, 1, "", "type Missing not found in "+dir+"\n")
+	expectProcessMainResults(t, dir, "yaml", []string{"Config"}, 1, "", "unknown format \"yaml\"\n")
+}
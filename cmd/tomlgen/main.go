@@ -0,0 +1,524 @@
+// Tomlgen generates MarshalTOML and UnmarshalTOML methods for struct types,
+// so that they are encoded and decoded without reflection.
+//
+// Usage:
+//
+//	tomlgen [-dir path] [-output file] Type...
+//
+// Tomlgen reads the Go package in dir, the current directory by default, and
+// writes the methods of the given types, and of the struct types of the
+// package they use, to output, types_toml.go by default. All the types of a
+// package must be generated in a single file.
+//
+// Fields can be strings, booleans, integers, floats, time.Time, other named
+// types of these, structs of the package, pointers to structs of the package,
+// and slices of all of these. Fields are named by their toml tag, or by their
+// Go name, with the omitempty option. UnmarshalTOML only matches keys exactly
+// and ignores keys without fields.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "directory of the Go package declaring the types")
+	output := flag.String("output", "types_toml.go", "file to write, relative to dir")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "tomlgen generates TOML marshaling methods for Go struct types:")
+		fmt.Fprintln(os.Stderr, "  tomlgen [-dir path] [-output file] Type...")
+		fmt.Fprintln(os.Stderr, "")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	os.Exit(processMain(*dir, *output, flag.Args(), os.Stderr))
+}
+
+func processMain(dir, output string, types []string, errorOutput io.Writer) int {
+	if len(types) == 0 {
+		flag.Usage()
+		return 2
+	}
+	src, err := generate(dir, types)
+	if err != nil {
+		printError(err, errorOutput)
+		return 1
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, output), src, 0644); err != nil {
+		printError(err, errorOutput)
+		return 1
+	}
+	return 0
+}
+
+func printError(err error, output io.Writer) {
+	io.WriteString(output, err.Error()+"\n")
+}
+
+// How a value is converted.
+type kind int
+
+const (
+	kindString kind = iota
+	kindBool
+	kindInt
+	kindUint
+	kindFloat
+	kindTime
+	kindStruct    // struct of the package, which gets generated methods
+	kindStructPtr // pointer to a struct of the package
+)
+
+// A value of a field or of the elements of a slice field.
+type valueType struct {
+	kind kind
+	expr string // Go type
+	bits int    // of integer types, 0 for int and uint
+}
+
+// A field of a generated type.
+type field struct {
+	name      string // Go name
+	key       string // TOML key
+	omitempty bool
+	slice     bool // the field is a slice of elem
+	elem      valueType
+}
+
+// A generated type.
+type structType struct {
+	name   string
+	fields []field
+}
+
+type generator struct {
+	pkg     string
+	types   map[string]*ast.TypeSpec
+	structs map[string]*structType
+	order   []string // names of the structs to generate
+	time    bool     // whether the generated code uses the time package
+}
+
+// Parse the package in dir and generate the methods of names.
+func generate(dir string, names []string) ([]byte, error) {
+	fset := token.NewFileSet()
+	notTest := func(fi os.FileInfo) bool { return !strings.HasSuffix(fi.Name(), "_test.go") }
+	pkgs, err := parser.ParseDir(fset, dir, notTest, 0)
+	if err != nil {
+		return nil, err
+	}
+	g := &generator{types: map[string]*ast.TypeSpec{}, structs: map[string]*structType{}}
+	for name, pkg := range pkgs {
+		g.pkg = name
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					ts := spec.(*ast.TypeSpec)
+					g.types[ts.Name.Name] = ts
+				}
+			}
+		}
+	}
+	for _, name := range names {
+		if _, ok := g.types[name]; !ok {
+			return nil, fmt.Errorf("type %s not found in %s", name, dir)
+		}
+		if err := g.addStruct(name); err != nil {
+			return nil, err
+		}
+	}
+
+	var b bytes.Buffer
+	g.write(&b)
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %s", err)
+	}
+	return src, nil
+}
+
+// Add the struct type name, and the struct types its fields use.
+func (g *generator) addStruct(name string) error {
+	if _, ok := g.structs[name]; ok {
+		return nil
+	}
+	st, ok := g.types[name].Type.(*ast.StructType)
+	if !ok {
+		return fmt.Errorf("type %s is not a struct", name)
+	}
+	s := &structType{name: name}
+	g.structs[name] = s
+	g.order = append(g.order, name)
+	for _, f := range st.Fields.List {
+		var tag reflect.StructTag
+		if f.Tag != nil {
+			unquoted, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return err
+			}
+			tag = reflect.StructTag(unquoted)
+		}
+		parse := strings.Split(tag.Get("toml"), ",")
+		if parse[0] == "-" && len(parse) == 1 {
+			continue
+		}
+		if len(f.Names) == 0 {
+			return fmt.Errorf("%s: embedded field %s is not supported", name, types.ExprString(f.Type))
+		}
+		fd := field{key: strings.TrimSpace(parse[0])}
+		for _, option := range parse[1:] {
+			if strings.TrimSpace(option) == "omitempty" {
+				fd.omitempty = true
+			}
+		}
+		typ := f.Type
+		if array, ok := typ.(*ast.ArrayType); ok && array.Len == nil {
+			fd.slice = true
+			typ = array.Elt
+		}
+		elem, err := g.valueType(typ)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %s", name, f.Names[0].Name, err)
+		}
+		fd.elem = elem
+		for _, ident := range f.Names {
+			if !ident.IsExported() {
+				continue
+			}
+			fd.name = ident.Name
+			if fd.key == "" || len(f.Names) > 1 {
+				fd.key = ident.Name
+			}
+			s.fields = append(s.fields, fd)
+		}
+		if elem.kind == kindStruct || elem.kind == kindStructPtr {
+			if err := g.addStruct(strings.TrimPrefix(elem.expr, "*")); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var basicTypes = map[string]valueType{
+	"string":  {kind: kindString},
+	"bool":    {kind: kindBool},
+	"int":     {kind: kindInt},
+	"int8":    {kind: kindInt, bits: 8},
+	"int16":   {kind: kindInt, bits: 16},
+	"int32":   {kind: kindInt, bits: 32},
+	"int64":   {kind: kindInt, bits: 64},
+	"uint":    {kind: kindUint},
+	"uint8":   {kind: kindUint, bits: 8},
+	"uint16":  {kind: kindUint, bits: 16},
+	"uint32":  {kind: kindUint, bits: 32},
+	"uint64":  {kind: kindUint, bits: 64},
+	"float32": {kind: kindFloat},
+	"float64": {kind: kindFloat},
+}
+
+// How values of the type expr are converted.
+func (g *generator) valueType(expr ast.Expr) (valueType, error) {
+	name := types.ExprString(expr)
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if vt, ok := basicTypes[t.Name]; ok {
+			vt.expr = name
+			return vt, nil
+		}
+		if ts, ok := g.types[t.Name]; ok {
+			if _, ok := ts.Type.(*ast.StructType); ok {
+				return valueType{kind: kindStruct, expr: name}, nil
+			}
+			// named types of basic types
+			if vt, err := g.valueType(ts.Type); err == nil && vt.kind != kindStruct && vt.kind != kindStructPtr {
+				vt.expr = name
+				return vt, nil
+			}
+		}
+	case *ast.StarExpr:
+		if ident, ok := t.X.(*ast.Ident); ok {
+			if ts, ok := g.types[ident.Name]; ok {
+				if _, ok := ts.Type.(*ast.StructType); ok {
+					return valueType{kind: kindStructPtr, expr: name}, nil
+				}
+			}
+		}
+	case *ast.SelectorExpr:
+		if name == "time.Time" {
+			g.time = true
+			return valueType{kind: kindTime, expr: name}, nil
+		}
+	}
+	return valueType{}, fmt.Errorf("unsupported type %s", name)
+}
+
+var bareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// The key as written in documents.
+func quoteKey(key string) string {
+	if bareKey.MatchString(key) {
+		return key
+	}
+	return strconv.Quote(key)
+}
+
+func (g *generator) write(b *bytes.Buffer) {
+	fmt.Fprintf(b, "// Code generated by tomlgen; DO NOT EDIT.\n\npackage %s\n\n", g.pkg)
+	b.WriteString("import (\n\t\"bytes\"\n\t\"fmt\"\n\t\"strconv\"\n\t\"strings\"\n")
+	if g.time {
+		b.WriteString("\t\"time\"\n")
+	}
+	b.WriteString("\n\t\"github.com/pelletier/go-toml\"\n)\n")
+	names := append([]string(nil), g.order...)
+	sort.Strings(names)
+	for _, name := range names {
+		g.writeMarshal(b, g.structs[name])
+		g.writeUnmarshal(b, g.structs[name])
+	}
+	b.WriteString(helpers)
+	if g.time {
+		b.WriteString(timeHelper)
+	}
+}
+
+func (g *generator) writeMarshal(b *bytes.Buffer, s *structType) {
+	fmt.Fprintf(b, "\n// MarshalTOML encodes v as a TOML document.\n")
+	fmt.Fprintf(b, "func (v %s) MarshalTOML() ([]byte, error) {\n", s.name)
+	b.WriteString("\tvar b bytes.Buffer\n\terr := v.marshalTOMLTo(&b, \"\")\n\treturn b.Bytes(), err\n}\n\n")
+	fmt.Fprintf(b, "func (v *%s) marshalTOMLTo(b *bytes.Buffer, prefix string) error {\n", s.name)
+
+	// key/values are written before the tables
+	for _, f := range s.fields {
+		if f.elem.kind == kindStruct || f.elem.kind == kindStructPtr {
+			continue
+		}
+		if f.slice {
+			if f.omitempty {
+				fmt.Fprintf(b, "\tif len(v.%s) > 0 {\n", f.name)
+			} else {
+				b.WriteString("\t{\n")
+			}
+			fmt.Fprintf(b, "\t\telems := make([]string, len(v.%s))\n", f.name)
+			fmt.Fprintf(b, "\t\tfor i, e := range v.%s {\n", f.name)
+			fmt.Fprintf(b, "\t\t\ts, err := toml.ValueStringRepresentation(%s, \"\", \"\", toml.OrderPreserve, false)\n", scalarValue(f.elem, "e"))
+			fmt.Fprintf(b, "\t\t\tif err != nil {\n\t\t\t\treturn err\n\t\t\t}\n\t\t\telems[i] = s\n\t\t}\n")
+			fmt.Fprintf(b, "\t\tb.WriteString(%s + strings.Join(elems, \", \") + \"]\\n\")\n\t}\n", strconv.Quote(quoteKey(f.key)+" = ["))
+			continue
+		}
+		if f.omitempty {
+			fmt.Fprintf(b, "\tif %s {\n", nonZero(f.elem, "v."+f.name))
+		} else {
+			b.WriteString("\t{\n")
+		}
+		fmt.Fprintf(b, "\t\ts, err := toml.ValueStringRepresentation(%s, \"\", \"\", toml.OrderPreserve, false)\n", scalarValue(f.elem, "v."+f.name))
+		fmt.Fprintf(b, "\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n")
+		fmt.Fprintf(b, "\t\tb.WriteString(%s + s + \"\\n\")\n\t}\n", strconv.Quote(quoteKey(f.key)+" = "))
+	}
+
+	for _, f := range s.fields {
+		if f.elem.kind != kindStruct && f.elem.kind != kindStructPtr {
+			continue
+		}
+		key := strconv.Quote(quoteKey(f.key))
+		switch {
+		case f.slice:
+			fmt.Fprintf(b, "\tfor _, e := range v.%s {\n", f.name)
+			if f.elem.kind == kindStructPtr {
+				b.WriteString("\t\tif e == nil {\n\t\t\tcontinue\n\t\t}\n")
+			}
+			fmt.Fprintf(b, "\t\tb.WriteString(\"\\n[[\" + prefix + %s + \"]]\\n\")\n", key)
+			fmt.Fprintf(b, "\t\tif err := e.marshalTOMLTo(b, prefix+%s+\".\"); err != nil {\n\t\t\treturn err\n\t\t}\n\t}\n", key)
+		case f.elem.kind == kindStructPtr:
+			fmt.Fprintf(b, "\tif v.%s != nil {\n", f.name)
+			fmt.Fprintf(b, "\t\tb.WriteString(\"\\n[\" + prefix + %s + \"]\\n\")\n", key)
+			fmt.Fprintf(b, "\t\tif err := v.%s.marshalTOMLTo(b, prefix+%s+\".\"); err != nil {\n\t\t\treturn err\n\t\t}\n\t}\n", f.name, key)
+		default:
+			fmt.Fprintf(b, "\tb.WriteString(\"\\n[\" + prefix + %s + \"]\\n\")\n", key)
+			fmt.Fprintf(b, "\tif err := v.%s.marshalTOMLTo(b, prefix+%s+\".\"); err != nil {\n\t\treturn err\n\t}\n", f.name, key)
+		}
+	}
+	b.WriteString("\treturn nil\n}\n")
+}
+
+// The expression converting the Go value expr to a value toml writes.
+func scalarValue(vt valueType, expr string) string {
+	switch vt.kind {
+	case kindString:
+		return "string(" + expr + ")"
+	case kindBool:
+		return "bool(" + expr + ")"
+	case kindInt:
+		return "int64(" + expr + ")"
+	case kindUint:
+		return "uint64(" + expr + ")"
+	case kindFloat:
+		return "float64(" + expr + ")"
+	}
+	return expr
+}
+
+// The condition for expr not to be omitted by omitempty.
+func nonZero(vt valueType, expr string) string {
+	switch vt.kind {
+	case kindString:
+		return expr + ` != ""`
+	case kindBool:
+		return expr
+	case kindTime:
+		return "!" + expr + ".IsZero()"
+	}
+	return expr + " != 0"
+}
+
+func (g *generator) writeUnmarshal(b *bytes.Buffer, s *structType) {
+	fmt.Fprintf(b, "\n// UnmarshalTOML decodes v from the table m, as given by Unmarshal.\n")
+	fmt.Fprintf(b, "func (v *%s) UnmarshalTOML(m interface{}) error {\n", s.name)
+	b.WriteString("\ttable, ok := m.(map[string]interface{})\n\tif !ok {\n")
+	fmt.Fprintf(b, "\t\treturn fmt.Errorf(\"expected a table for %s, got %%T\", m)\n\t}\n", s.name)
+	b.WriteString("\tfor key, value := range table {\n\t\tvar err error\n\t\tswitch key {\n")
+	for _, f := range s.fields {
+		fmt.Fprintf(b, "\t\tcase %s:\n", strconv.Quote(f.key))
+		if f.slice {
+			b.WriteString("\t\t\tvar elems []interface{}\n")
+			b.WriteString("\t\t\tif elems, err = tomlgenArray(value); err != nil {\n\t\t\t\tbreak\n\t\t\t}\n")
+			fmt.Fprintf(b, "\t\t\tv.%s = make([]%s, len(elems))\n", f.name, f.elem.expr)
+			b.WriteString("\t\t\tfor i, item := range elems {\n")
+			g.writeConversion(b, "\t\t\t\t", f.elem, fmt.Sprintf("v.%s[i]", f.name), "item", true)
+			b.WriteString("\t\t\t}\n")
+		} else {
+			g.writeConversion(b, "\t\t\t", f.elem, "v."+f.name, "value", false)
+		}
+	}
+	b.WriteString("\t\t}\n\t\tif err != nil {\n\t\t\treturn fmt.Errorf(\"%s: %s\", key, err)\n\t\t}\n\t}\n\treturn nil\n}\n")
+}
+
+// Write the statements converting the value src to dst, setting err and
+// breaking out of the enclosing loop on errors if inLoop is set.
+func (g *generator) writeConversion(b *bytes.Buffer, indent string, vt valueType, dst, src string, inLoop bool) {
+	exit := ""
+	if inLoop {
+		exit = indent + "\tbreak\n"
+	}
+	var call string
+	switch vt.kind {
+	case kindString:
+		call = "tomlgenString(" + src + ")"
+	case kindBool:
+		call = "tomlgenBool(" + src + ")"
+	case kindInt:
+		call = fmt.Sprintf("tomlgenInt(%s, %d)", src, vt.bits)
+	case kindUint:
+		call = fmt.Sprintf("tomlgenUint(%s, %d)", src, vt.bits)
+	case kindFloat:
+		call = "tomlgenFloat(" + src + ")"
+	case kindTime:
+		call = "tomlgenTime(" + src + ")"
+	case kindStruct, kindStructPtr:
+		if vt.kind == kindStructPtr {
+			fmt.Fprintf(b, "%s%s = new(%s)\n", indent, dst, strings.TrimPrefix(vt.expr, "*"))
+		}
+		fmt.Fprintf(b, "%serr = %s.UnmarshalTOML(%s)\n", indent, dst, src)
+		if inLoop {
+			fmt.Fprintf(b, "%sif err != nil {\n%s%s}\n", indent, exit, indent)
+		}
+		return
+	}
+	fmt.Fprintf(b, "%sif x, e := %s; e != nil {\n%s\terr = e\n%s%s} else {\n", indent, call, indent, exit, indent)
+	fmt.Fprintf(b, "%s\t%s = %s(x)\n%s}\n", indent, dst, vt.expr, indent)
+}
+
+// Conversion functions used by the generated methods.
+const helpers = `
+func tomlgenArray(v interface{}) ([]interface{}, error) {
+	a, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an array, got %T", v)
+	}
+	return a, nil
+}
+
+func tomlgenString(v interface{}) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("expected a string, got %T", v)
+	}
+	return s, nil
+}
+
+func tomlgenBool(v interface{}) (bool, error) {
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected a boolean, got %T", v)
+	}
+	return b, nil
+}
+
+func tomlgenInt(v interface{}, bits int) (int64, error) {
+	n, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("expected an integer, got %T", v)
+	}
+	if bits == 0 {
+		bits = strconv.IntSize
+	}
+	if bits < 64 && (n < -1<<uint(bits-1) || n >= 1<<uint(bits-1)) {
+		return 0, fmt.Errorf("%d overflows int%d", n, bits)
+	}
+	return n, nil
+}
+
+func tomlgenUint(v interface{}, bits int) (uint64, error) {
+	n, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("expected an integer, got %T", v)
+	}
+	if bits == 0 {
+		bits = strconv.IntSize
+	}
+	if n < 0 || bits < 64 && n >= 1<<uint(bits) {
+		return 0, fmt.Errorf("%d overflows uint%d", n, bits)
+	}
+	return uint64(n), nil
+}
+
+func tomlgenFloat(v interface{}) (float64, error) {
+	switch f := v.(type) {
+	case float64:
+		return f, nil
+	case int64:
+		return float64(f), nil
+	}
+	return 0, fmt.Errorf("expected a float, got %T", v)
+}
+`
+
+const timeHelper = `
+func tomlgenTime(v interface{}) (time.Time, error) {
+	t, ok := v.(time.Time)
+	if !ok {
+		return time.Time{}, fmt.Errorf("expected a datetime, got %T", v)
+	}
+	return t, nil
+}
+`
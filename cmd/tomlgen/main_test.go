@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	src, err := generate(filepath.Join("testdata", "config"), []string{"Config"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile(filepath.Join("testdata", "config_toml.go.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, expected) {
+		t.Errorf("generated code differs from testdata/config_toml.go.golden:\n%s", src)
+	}
+}
+
+func TestProcessMain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tomlgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src, err := ioutil.ReadFile(filepath.Join("testdata", "config", "config.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.go"), src, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	errorBuffer := new(bytes.Buffer)
+	if code := processMain(dir, "config_toml.go", []string{"Server"}, errorBuffer); code != 0 {
+		t.Fatalf("unexpected return code %d: %s", code, errorBuffer)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "config_toml.go")); err != nil {
+		t.Error(err)
+	}
+
+	for _, test := range []struct {
+		typ, err string
+	}{
+		{"Missing", "type Missing not found in " + dir + "\n"},
+		{"Mode", "type Mode is not a struct\n"},
+		{"Unsupported", "Unsupported.Values: unsupported type map[string]int\n"},
+	} {
+		errorBuffer.Reset()
+		if code := processMain(dir, "out.go", []string{test.typ}, errorBuffer); code != 1 {
+			t.Errorf("%s: unexpected return code %d", test.typ, code)
+		}
+		if errorBuffer.String() != test.err {
+			t.Errorf("%s: expected error %q, got %q", test.typ, test.err, errorBuffer)
+		}
+	}
+}
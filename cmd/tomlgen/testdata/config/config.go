@@ -0,0 +1,35 @@
+package config
+
+import "time"
+
+type Mode string
+
+type Config struct {
+	Name     string    `toml:"name"`
+	Port     uint16    `toml:"port"`
+	Ratio    float32   `toml:"ratio,omitempty"`
+	Debug    bool      `toml:"debug,omitempty"`
+	Mode     Mode      `toml:"mode"`
+	Tags     []string  `toml:"tags,omitempty"`
+	Started  time.Time `toml:"started,omitempty"`
+	Skipped  string    `toml:"-"`
+	internal int
+	DB       Database  `toml:"database"`
+	Cache    *Database `toml:"cache"`
+	Servers  []Server  `toml:"servers"`
+	Spaced   int       `toml:"spaced key"`
+}
+
+type Database struct {
+	URL  string `toml:"url"`
+	Pool int8   `toml:"pool"`
+}
+
+type Server struct {
+	Host  string
+	Ports []int `toml:"ports"`
+}
+
+type Unsupported struct {
+	Values map[string]int
+}
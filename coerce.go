@@ -0,0 +1,90 @@
+// Coercion of scalar values into the types of their fields.
+
+package toml
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// CoerceScalars makes the Decoder convert scalar values into the type of the
+// field they are decoded into when their TOML type does not match it, for
+// hand-written documents that cannot all be fixed at once: strings holding
+// numbers or booleans, such as port = "8080", are parsed, integers are
+// converted to floats, integral floats to integers, the integers 1 and 0 to
+// booleans, and numbers and booleans to strings. Values that cannot be
+// converted fail decoding as usual.
+//
+// Each conversion is reported by the Coercions method of MetaData, and by
+// Warnings.
+func (d *Decoder) CoerceScalars(v bool) *Decoder {
+	d.coerceScalars = v
+	return d
+}
+
+// Coercion describes a value of a document converted by a Decoder with
+// CoerceScalars.
+type Coercion struct {
+	Key      Key          // key of the value, with indexes for array elements
+	Position Position     // position of the value, invalid if unknown
+	Value    interface{}  // value of the document, as returned by Tree.Get
+	Type     reflect.Type // type of the field the value was converted to
+}
+
+func (c Coercion) String() string {
+	return fmt.Sprintf("%s: %s: converted %v(%T) to %v", c.Position, c.Key, c.Value, c.Value, c.Type)
+}
+
+// Coercions returns the values converted by CoerceScalars, in the order they
+// were decoded.
+func (m MetaData) Coercions() []Coercion {
+	return m.coercions
+}
+
+// Convert the scalar tval to the TOML type decoded into mtype when it does not
+// match it, recording the conversion. tval is returned unchanged otherwise.
+func (d *Decoder) coerceScalar(mtype reflect.Type, tval interface{}) interface{} {
+	if !d.coerceScalars || mtype == reflect.TypeOf(time.Duration(0)) {
+		return tval
+	}
+	var mismatch bool
+	switch mtype.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch tval.(type) {
+		case string, float64:
+			mismatch = true
+		}
+	case reflect.Float32, reflect.Float64:
+		switch tval.(type) {
+		case string, int64, uint64:
+			mismatch = true
+		}
+	case reflect.Bool:
+		switch tval.(type) {
+		case string, int64:
+			mismatch = true
+		}
+	case reflect.String:
+		switch tval.(type) {
+		case int64, uint64, float64, bool:
+			mismatch = true
+		}
+	}
+	if !mismatch {
+		return tval
+	}
+
+	converted, ok := convertArrayElement(mtype, tval)
+	if i, isInt := tval.(int64); isInt && mtype.Kind() == reflect.Bool {
+		converted, ok = i == 1, i == 0 || i == 1
+	}
+	if !ok {
+		return tval
+	}
+	c := Coercion{Key: d.path.Append(), Position: d.position, Value: tval, Type: mtype}
+	d.coercions = append(d.coercions, c)
+	d.warn("converted %v(%T) to %v", tval, tval, mtype)
+	return converted
+}
@@ -0,0 +1,63 @@
+package toml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecoderCoerceScalars(t *testing.T) {
+	doc := `port = "8080"
+ratio = 2
+debug = 1
+name = 42
+timeout = "5s"
+retries = 3.0
+ports = ["80", 443]
+ok = true
+`
+	var config struct {
+		Port    int
+		Ratio   float64
+		Debug   bool
+		Name    string
+		Timeout time.Duration
+		Retries uint8
+		Ports   []int
+		OK      bool
+	}
+	d := NewDecoder(strings.NewReader(doc)).CoerceScalars(true)
+	if err := d.Decode(&config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Port != 8080 || config.Ratio != 2 || !config.Debug || config.Name != "42" ||
+		config.Timeout != 5*time.Second || config.Retries != 3 || !reflect.DeepEqual(config.Ports, []int{80, 443}) || !config.OK {
+		t.Errorf("unexpected values %+v", config)
+	}
+	var coercions []string
+	for _, c := range d.MetaData().Coercions() {
+		coercions = append(coercions, c.String())
+	}
+	expected := []string{
+		"(1, 1): port: converted 8080(string) to int",
+		"(2, 1): ratio: converted 2(int64) to float64",
+		"(3, 1): debug: converted 1(int64) to bool",
+		"(4, 1): name: converted 42(int64) to string",
+		"(6, 1): retries: converted 3(float64) to uint8",
+		"(7, 11): ports.0: converted 80(string) to int",
+	}
+	if !reflect.DeepEqual(coercions, expected) {
+		t.Errorf("expected coercions\n%q\ngot\n%q", expected, coercions)
+	}
+	if len(d.Warnings()) != len(expected) {
+		t.Errorf("expected %d warnings, got %v", len(expected), d.Warnings())
+	}
+
+	err := NewDecoder(strings.NewReader(doc)).Decode(&config)
+	assertErrorString(t, "(1, 1): Can't convert 8080(string) to int", err)
+	err = NewDecoder(strings.NewReader(`port = "http"`)).CoerceScalars(true).Decode(&config)
+	assertErrorString(t, "(1, 1): Can't convert http(string) to int", err)
+	err = NewDecoder(strings.NewReader(`debug = 2`)).CoerceScalars(true).Decode(&config)
+	assertErrorString(t, "(1, 1): Can't convert 2(int64) to bool", err)
+}
@@ -0,0 +1,396 @@
+// Completion of partial documents.
+
+package toml
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// CompletionKind identifies what a Completion inserts.
+type CompletionKind int
+
+// Kinds of completions.
+const (
+	// CompletionKey is a key of a key/value pair.
+	CompletionKey CompletionKind = iota
+	// CompletionTable is the key of a table, in a table header or as the
+	// first part of a dotted key.
+	CompletionTable
+	// CompletionValue is a value.
+	CompletionValue
+)
+
+// Completion is a candidate returned by Complete.
+type Completion struct {
+	// Text replaces the text of the document from Start to the cursor.
+	Text  string
+	Start int
+	Kind  CompletionKind
+	// Detail is the TOML type of the key or value, such as "integer",
+	// "table" or "array of tables".
+	Detail string
+	// Doc is the comment tag of the field of the key, if any.
+	Doc string
+}
+
+// Complete returns the completions of the partial document doc at the byte
+// offset cursor, for a document decoded into v, a struct or a pointer to a
+// struct. The keys of the table the cursor is in are suggested after the
+// start of a line or a dotted key, except those already defined in the
+// table, and the keys of tables are suggested in table headers. After an
+// equal sign, true and false are suggested for booleans, and the Values
+// declared by the TypeOptions of the type of the key for other types. Only
+// the candidates starting with the text typed before the cursor are
+// returned, sorted by Text.
+//
+// The document does not need to be valid. Nothing is returned inside
+// comments, strings and multi-line arrays.
+func Complete(doc []byte, cursor int, v interface{}) []Completion {
+	root := derefType(reflect.TypeOf(v))
+	if root == nil || root.Kind() != reflect.Struct || cursor < 0 || cursor > len(doc) {
+		return nil
+	}
+	lineStart := bytes.LastIndexByte(doc[:cursor], '\n') + 1
+	lineEnd := len(doc)
+	if i := bytes.IndexByte(doc[cursor:], '\n'); i >= 0 {
+		lineEnd = cursor + i
+	}
+	ctx, ok := scanCompletionContext(doc[:lineStart], doc[lineEnd:])
+	if !ok {
+		return nil
+	}
+
+	line := string(doc[lineStart:cursor])
+	text := strings.TrimLeft(line, " \t")
+	var completions []Completion
+	switch {
+	case strings.HasPrefix(text, "#"):
+		return nil
+	case strings.HasPrefix(text, "[["):
+		completions = completeHeader(root, ctx, strings.TrimLeft(text[2:], " \t"), true)
+	case strings.HasPrefix(text, "["):
+		completions = completeHeader(root, ctx, strings.TrimLeft(text[1:], " \t"), false)
+	default:
+		if eq := indexOutsideQuotes(text, '='); eq >= 0 {
+			completions = completeValue(root, ctx, text[:eq], strings.TrimLeft(text[eq+1:], " \t"))
+		} else {
+			completions = completeKey(root, ctx, text)
+		}
+	}
+	for i := range completions {
+		completions[i].Start += cursor
+	}
+	sort.Slice(completions, func(i, j int) bool { return completions[i].Text < completions[j].Text })
+	return completions
+}
+
+// What surrounds the cursor line: the table it is in, and the keys already
+// defined in that table and as table headers.
+type completionContext struct {
+	table   Key
+	defined map[string]bool
+	headers map[string]bool
+}
+
+// Scan the document before and after the cursor line. The returned boolean
+// is false when the cursor line is inside a multi-line string or array.
+func scanCompletionContext(before, after []byte) (completionContext, bool) {
+	ctx := completionContext{table: Key{}, defined: map[string]bool{}, headers: map[string]bool{}}
+	tokens := lexToml(before)
+	defer putTokens(tokens)
+	open := 0 // brackets and braces of values
+	for i, tok := range tokens {
+		switch tok.typ {
+		case tokenKeyGroup, tokenKeyGroupArray:
+			if key, err := ParseKey(strings.TrimSpace(tok.val)); err == nil {
+				ctx.table = key
+				ctx.defined = map[string]bool{}
+				if tok.typ == tokenKeyGroup {
+					ctx.headers[key.String()] = true
+				}
+			}
+		case tokenKey:
+			// the lexer unescapes the quoted parts of keys
+			if key, err := parseKey(tok.val); err == nil && open == 0 {
+				ctx.defined[ctx.table.Append(key...).String()] = true
+			}
+		case tokenLeftBracket:
+			if i+1 == len(tokens) || tokens[i+1].typ != tokenKeyGroup {
+				open++
+			}
+		case tokenRightBracket:
+			if i == 0 || tokens[i-1].typ != tokenKeyGroup {
+				open--
+			}
+		case tokenLeftCurlyBrace:
+			open++
+		case tokenRightCurlyBrace:
+			open--
+		case tokenError:
+			if strings.HasPrefix(tok.val, "unclosed") {
+				return ctx, false
+			}
+		}
+	}
+	if open > 0 {
+		return ctx, false
+	}
+
+	// keys after the cursor line are in the same table until the next header
+	tokens = lexToml(after)
+	defer putTokens(tokens)
+	inTable := true
+	for _, tok := range tokens {
+		switch tok.typ {
+		case tokenKeyGroup, tokenKeyGroupArray:
+			inTable = false
+			if key, err := ParseKey(strings.TrimSpace(tok.val)); err == nil && tok.typ == tokenKeyGroup {
+				ctx.headers[key.String()] = true
+			}
+		case tokenKey:
+			if key, err := parseKey(tok.val); err == nil && inTable {
+				ctx.defined[ctx.table.Append(key...).String()] = true
+			}
+		}
+	}
+	return ctx, true
+}
+
+// Complete the key of a table header, from the root of the document.
+func completeHeader(root reflect.Type, ctx completionContext, text string, array bool) []Completion {
+	prefix, partial, ok := splitPartialKey(text)
+	if !ok {
+		return nil
+	}
+	mtype := typeAtKey(root, prefix)
+	if mtype == nil || mtype.Kind() != reflect.Struct {
+		return nil
+	}
+	var completions []Completion
+	for _, f := range completionFields(mtype) {
+		key := prefix.Append(f.name)
+		switch {
+		case !strings.HasPrefix(f.name, partial):
+			continue
+		case isTreeSequence(f.mtype) && !array:
+			continue
+		case !isTree(f.mtype) && !isTreeSequence(f.mtype):
+			continue
+		case !array && ctx.headers[key.String()]:
+			continue
+		}
+		completions = append(completions, Completion{
+			Text:   Key{f.name}.String(),
+			Start:  -len(partial),
+			Kind:   CompletionTable,
+			Detail: completionDetail(f.mtype),
+			Doc:    f.doc,
+		})
+	}
+	return completions
+}
+
+// Complete a key of the table of the cursor line.
+func completeKey(root reflect.Type, ctx completionContext, text string) []Completion {
+	prefix, partial, ok := splitPartialKey(text)
+	if !ok {
+		return nil
+	}
+	table := ctx.table.Append(prefix...)
+	mtype := typeAtKey(root, table)
+	if mtype == nil || mtype.Kind() != reflect.Struct {
+		return nil
+	}
+	var completions []Completion
+	for _, f := range completionFields(mtype) {
+		key := table.Append(f.name).String()
+		if !strings.HasPrefix(f.name, partial) || ctx.defined[key] || ctx.headers[key] {
+			continue
+		}
+		kind := CompletionKey
+		if isTree(f.mtype) {
+			kind = CompletionTable
+		}
+		completions = append(completions, Completion{
+			Text:   Key{f.name}.String(),
+			Start:  -len(partial),
+			Kind:   kind,
+			Detail: completionDetail(f.mtype),
+			Doc:    f.doc,
+		})
+	}
+	return completions
+}
+
+// Complete the value of the key keyText.
+func completeValue(root reflect.Type, ctx completionContext, keyText, partial string) []Completion {
+	key, err := ParseKey(strings.TrimSpace(keyText))
+	if err != nil {
+		return nil
+	}
+	mtype := typeAtKey(root, ctx.table.Append(key...))
+	if mtype == nil {
+		return nil
+	}
+	var values []string
+	if mtype.Kind() == reflect.Bool {
+		values = []string{"true", "false"}
+	} else if opts, ok := typeOptionsOf(mtype); ok {
+		for _, v := range opts.Values {
+			node, err := toTree(v)
+			if err != nil {
+				continue
+			}
+			if s, err := tomlValueStringRepresentation(node, "", "", OrderAlphabetical, false); err == nil {
+				values = append(values, s)
+			}
+		}
+	}
+	var completions []Completion
+	for _, v := range values {
+		if strings.HasPrefix(v, partial) {
+			completions = append(completions, Completion{
+				Text:   v,
+				Start:  -len(partial),
+				Kind:   CompletionValue,
+				Detail: completionDetail(mtype),
+			})
+		}
+	}
+	return completions
+}
+
+// Split a partially typed dotted key into its complete parts and the text
+// of its last part. The returned boolean is false if the key is invalid or
+// its last part is quoted.
+func splitPartialKey(text string) (Key, string, bool) {
+	dot := -1
+	for i := indexOutsideQuotes(text, '.'); i >= 0; i = indexOutsideQuotes(text[dot+1:], '.') {
+		dot += i + 1
+	}
+	partial := strings.TrimLeft(text[dot+1:], " \t")
+	if strings.ContainsAny(partial, " \t\"'") {
+		return nil, "", false
+	}
+	if dot < 0 {
+		return Key{}, partial, true
+	}
+	prefix, err := ParseKey(text[:dot])
+	if err != nil {
+		return nil, "", false
+	}
+	return prefix, partial, true
+}
+
+// Index of the first c of s outside of quoted strings, or -1.
+func indexOutsideQuotes(s string, c byte) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == '\\' && quote == '"' {
+				i++
+			} else if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case s[i] == c:
+			return i
+		}
+	}
+	return -1
+}
+
+// A key a struct type is decoded from.
+type completionField struct {
+	name  string
+	mtype reflect.Type
+	doc   string
+}
+
+// Keys of the struct type mtype, including those of embedded structs.
+func completionFields(mtype reflect.Type) []completionField {
+	var fields []completionField
+	for _, f := range promotedFields(mtype, annotationDefault).fields {
+		fields = append(fields, completionField{name: f.opts.name, mtype: derefType(f.Type), doc: f.opts.comment})
+	}
+	return fields
+}
+
+// Type of the value at key in a document decoded into root, or nil if it is
+// not known. Arrays of tables are traversed through their elements.
+func typeAtKey(root reflect.Type, key Key) reflect.Type {
+	mtype := root
+	for _, part := range key {
+		if isTreeSequence(mtype) {
+			mtype = derefType(mtype.Elem())
+		}
+		switch mtype.Kind() {
+		case reflect.Struct:
+			var found reflect.Type
+			for _, f := range completionFields(mtype) {
+				if strings.EqualFold(f.name, part) {
+					found = f.mtype
+					break
+				}
+			}
+			if found == nil {
+				return nil
+			}
+			mtype = found
+		case reflect.Map:
+			mtype = derefType(mtype.Elem())
+		default:
+			return nil
+		}
+	}
+	if isTreeSequence(mtype) && len(key) > 0 {
+		return derefType(mtype.Elem())
+	}
+	return mtype
+}
+
+func derefType(mtype reflect.Type) reflect.Type {
+	for mtype != nil && mtype.Kind() == reflect.Ptr {
+		mtype = mtype.Elem()
+	}
+	return mtype
+}
+
+// TOML type of the values of mtype.
+func completionDetail(mtype reflect.Type) string {
+	switch {
+	case mtype == timeType:
+		return KindOffsetDateTime.String()
+	case mtype == localDateType:
+		return KindLocalDate.String()
+	case mtype == localTimeType:
+		return KindLocalTime.String()
+	case mtype == localDateTimeType:
+		return KindLocalDateTime.String()
+	case isTreeSequence(mtype):
+		return "array of tables"
+	case isTextUnmarshaler(reflect.PtrTo(mtype)):
+		return KindString.String()
+	case isTree(mtype):
+		return KindTable.String()
+	}
+	switch mtype.Kind() {
+	case reflect.String:
+		return KindString.String()
+	case reflect.Bool:
+		return KindBool.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return KindInteger.String()
+	case reflect.Float32, reflect.Float64:
+		return KindFloat.String()
+	case reflect.Slice, reflect.Array:
+		return KindArray.String()
+	}
+	return ""
+}
@@ -0,0 +1,145 @@
+package toml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type completeLevel string
+
+func (completeLevel) TOMLTypeOptions() TypeOptions {
+	return TypeOptions{Values: []interface{}{"debug", "info", "error"}}
+}
+
+type completeConfig struct {
+	Title   string        `toml:"title"`
+	Level   completeLevel `toml:"level" comment:"Verbosity of the logs"`
+	Debug   bool          `toml:"debug"`
+	Ignored string        `toml:"-"`
+	Server  struct {
+		Host string `toml:"host"`
+		Port int    `toml:"port"`
+		TLS  struct {
+			Cert string `toml:"cert"`
+		} `toml:"tls"`
+	} `toml:"server"`
+	Routes []struct {
+		Path string `toml:"path"`
+	} `toml:"routes"`
+	CompleteEmbedded
+}
+
+type CompleteEmbedded struct {
+	Tags []string `toml:"tags"`
+}
+
+// Complete at the position of the | in doc.
+func completeAt(t *testing.T, doc string) []Completion {
+	cursor := strings.Index(doc, "|")
+	if cursor < 0 {
+		t.Fatal("no cursor in document")
+	}
+	return Complete([]byte(doc[:cursor]+doc[cursor+1:]), cursor, &completeConfig{})
+}
+
+func completionTexts(completions []Completion) []string {
+	texts := []string{}
+	for _, c := range completions {
+		texts = append(texts, c.Text)
+	}
+	return texts
+}
+
+func TestCompleteKeys(t *testing.T) {
+	examples := []struct {
+		doc      string
+		expected []string
+	}{
+		{"|", []string{"debug", "level", "routes", "server", "tags", "title"}},
+		{"title = \"x\"\nt|\n", []string{"tags"}},
+		{"t|\ntitle = \"x\"\n", []string{"tags"}},
+		{"[server]\n  |", []string{"host", "port", "tls"}},
+		{"[server]\nhost = \"h\"\n|\n[other]\nport = 1\n", []string{"port", "tls"}},
+		{"server.t|", []string{"tls"}},
+		{"[server]\ntls.|", []string{"cert"}},
+		{"[[routes]]\np|", []string{"path"}},
+		{"[[routes]]\npath = \"/a\"\n[[routes]]\n|", []string{"path"}},
+		{"[server.tls]\n[server]\n|", []string{"host", "port"}},
+		{"nothing.|", []string{}},
+		{"# |", []string{}},
+		{"a = \"\"\"\n|", []string{}},
+		{"a = [\n  1,\n  |", []string{}},
+	}
+	for _, e := range examples {
+		texts := completionTexts(completeAt(t, e.doc))
+		if !reflect.DeepEqual(texts, e.expected) {
+			t.Errorf("%q: expected %v, got %v", e.doc, e.expected, texts)
+		}
+	}
+}
+
+func TestCompleteHeaders(t *testing.T) {
+	examples := []struct {
+		doc      string
+		expected []string
+	}{
+		{"[|", []string{"server"}},
+		{"[[|", []string{"routes", "server"}},
+		{"[server]\n[|", []string{}},
+		{"[server.|", []string{"tls"}},
+		{"[ server . t|", []string{"tls"}},
+	}
+	for _, e := range examples {
+		texts := completionTexts(completeAt(t, e.doc))
+		if !reflect.DeepEqual(texts, e.expected) {
+			t.Errorf("%q: expected %v, got %v", e.doc, e.expected, texts)
+		}
+	}
+}
+
+func TestCompleteValues(t *testing.T) {
+	examples := []struct {
+		doc      string
+		expected []string
+	}{
+		{"debug = |", []string{"false", "true"}},
+		{"debug = t|", []string{"true"}},
+		{"level = |", []string{`"debug"`, `"error"`, `"info"`}},
+		{"level = \"d|", []string{`"debug"`}},
+		{"title = |", []string{}},
+	}
+	for _, e := range examples {
+		texts := completionTexts(completeAt(t, e.doc))
+		if !reflect.DeepEqual(texts, e.expected) {
+			t.Errorf("%q: expected %v, got %v", e.doc, e.expected, texts)
+		}
+	}
+}
+
+func TestCompleteDetails(t *testing.T) {
+	completions := completeAt(t, "[server]\nhost = \"h\"\n\nlevel = \"d|")
+	if len(completions) != 0 {
+		t.Errorf("level is not a key of server, got %v", completions)
+	}
+
+	completions = completeAt(t, "x = 1\nle|")
+	expected := []Completion{{Text: "level", Start: 6, Kind: CompletionKey, Detail: "string", Doc: "Verbosity of the logs"}}
+	if !reflect.DeepEqual(completions, expected) {
+		t.Errorf("expected %+v, got %+v", expected, completions)
+	}
+
+	completions = completeAt(t, "level = \"d|")
+	expected = []Completion{{Text: `"debug"`, Start: 8, Kind: CompletionValue, Detail: "string"}}
+	if !reflect.DeepEqual(completions, expected) {
+		t.Errorf("expected %+v, got %+v", expected, completions)
+	}
+
+	completions = completeAt(t, "[|")
+	if len(completions) != 1 || completions[0].Kind != CompletionTable || completions[0].Detail != "table" {
+		t.Errorf("unexpected completions %+v", completions)
+	}
+	if Complete([]byte("a"), 5, &completeConfig{}) != nil || Complete([]byte("a"), 1, 42) != nil {
+		t.Error("expected no completions for an invalid cursor or target")
+	}
+}
@@ -0,0 +1,179 @@
+package toml
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Stress tests of the concurrent use of the package, meant to be run with the
+// race detector: go test -race -run Concurrent.
+
+type concurrentConfig struct {
+	Title   string            `toml:"title" alt:"name"`
+	Port    int               `toml:"port" alt:"listen" default:"80"`
+	Tags    []string          `toml:"tags" alt:"labels"`
+	Limits  map[string]int    `toml:"limits" alt:"quotas"`
+	Servers []concurrentEntry `toml:"servers" alt:"backends"`
+}
+
+type concurrentEntry struct {
+	Host string  `toml:"host" alt:"address"`
+	Load float64 `toml:"load" alt:"weight"`
+}
+
+const concurrentDoc = `title = "a"
+tags = ["x", "y"]
+
+[limits]
+cpu = 2
+
+[[servers]]
+host = "h1"
+load = 0.5
+
+[[servers]]
+host = "h2"
+load = 1.5
+`
+
+var concurrentExpected = concurrentConfig{
+	Title:   "a",
+	Port:    80,
+	Tags:    []string{"x", "y"},
+	Limits:  map[string]int{"cpu": 2},
+	Servers: []concurrentEntry{{"h1", 0.5}, {"h2", 1.5}},
+}
+
+// Run f from several goroutines at once, several times each.
+func runConcurrently(t *testing.T, f func(i int) error) {
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < g+25; i++ {
+				if err := f(i); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestConcurrentMarshalUnmarshal(t *testing.T) {
+	alt := strings.NewReplacer("title", "name", "tags", "labels", "limits", "quotas",
+		"servers", "backends", "host", "address", "load", "weight").Replace(concurrentDoc)
+	runConcurrently(t, func(i int) error {
+		// alternate tag names and option sets, so that goroutines fill the
+		// caches with different entries for the same types
+		var c concurrentConfig
+		var err error
+		switch i % 3 {
+		case 0:
+			err = Unmarshal([]byte(concurrentDoc), &c)
+		case 1:
+			err = NewDecoder(strings.NewReader(alt)).SetTagName("alt").Decode(&c)
+		default:
+			err = NewDecoder(strings.NewReader(concurrentDoc)).Strict(true).CoerceScalars(true).Decode(&c)
+		}
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(c, concurrentExpected) {
+			return fmt.Errorf("decoded %+v", c)
+		}
+
+		var b []byte
+		if i%2 == 0 {
+			b, err = Marshal(&c)
+		} else {
+			var buf bytes.Buffer
+			err = NewEncoder(&buf).SetTagName("alt").Order(OrderPreserve).Encode(c)
+			b = buf.Bytes()
+		}
+		if err != nil {
+			return err
+		}
+		var back concurrentConfig
+		d := NewDecoder(bytes.NewReader(b))
+		if i%2 == 1 {
+			d.SetTagName("alt")
+		}
+		if err := d.Decode(&back); err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(back, concurrentExpected) {
+			return fmt.Errorf("round trip of\n%s\ngave %+v", b, back)
+		}
+		return nil
+	})
+}
+
+func TestConcurrentTreeReads(t *testing.T) {
+	tree, err := Load(concurrentDoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := tree.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared := concurrentExpected
+	runConcurrently(t, func(i int) error {
+		b, err := tree.Marshal()
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(b, expected) {
+			return fmt.Errorf("marshaled\n%s", b)
+		}
+		if host := tree.GetPath([]string{"servers"}).([]*Tree)[1].Get("host"); host != "h2" {
+			return fmt.Errorf("got host %v", host)
+		}
+		if m := tree.ToMap(); m["title"] != "a" {
+			return fmt.Errorf("got map %v", m)
+		}
+		var c concurrentConfig
+		if err := tree.Unmarshal(&c); err != nil {
+			return err
+		}
+		// values shared between goroutines are only read by Marshal
+		if _, err := Marshal(shared); err != nil {
+			return err
+		}
+		return NewEncoder(ioutil.Discard).Canonical(true).Encode(&shared)
+	})
+}
+
+func TestConcurrentCachingLoader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "toml-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	loader, err := NewCachingLoader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runConcurrently(t, func(i int) error {
+		doc := fmt.Sprintf("%s\n[extra]\nn = %d\n", concurrentDoc, i%4)
+		tree, err := loader.LoadBytes([]byte(doc))
+		if err != nil {
+			return err
+		}
+		if n := tree.Get("extra.n"); n != int64(i%4) {
+			return fmt.Errorf("got n = %v", n)
+		}
+		// trees returned by the loader are copies that can be modified
+		tree.Set("title", "changed")
+		return nil
+	})
+}
@@ -0,0 +1,48 @@
+// Decode plans: what the Decoder needs to know about types, computed once.
+
+package toml
+
+import (
+	"reflect"
+	"sync"
+)
+
+// How values of a type are decoded. Checking which interfaces a type
+// implements is slow and used to be repeated for every decoded value; a plan
+// is built at the first use of a type and shared by all Decoders.
+type decodePlan struct {
+	customUnmarshaler bool // pointers to the type implement Unmarshaler
+	textUnmarshaler   bool // pointers to the type implement encoding.TextUnmarshaler
+	tree              bool // see isTree
+	treeSequence      bool // see isTreeSequence
+	otherSequence     bool // see isOtherSequence
+	optional          bool // see isOptional
+	// options of the type, checkRange being set if they bound its values
+	options    TypeOptions
+	checkRange bool
+}
+
+// The decode plans by reflect.Type.
+var decodePlans sync.Map
+
+// The decode plan of mtype.
+func planFor(mtype reflect.Type) *decodePlan {
+	if plan, ok := decodePlans.Load(mtype); ok {
+		return plan.(*decodePlan)
+	}
+	ptype := reflect.PtrTo(mtype)
+	plan := &decodePlan{
+		customUnmarshaler: isCustomUnmarshaler(ptype),
+		textUnmarshaler:   isTextUnmarshaler(ptype) && !isTimeType(mtype),
+		tree:              isTree(mtype),
+		treeSequence:      isTreeSequence(mtype),
+		otherSequence:     isOtherSequence(mtype),
+		optional:          isOptional(mtype),
+	}
+	if opts, ok := typeOptionsOf(mtype); ok {
+		plan.options = opts
+		plan.checkRange = opts.Min < opts.Max
+	}
+	actual, _ := decodePlans.LoadOrStore(mtype, plan)
+	return actual.(*decodePlan)
+}
@@ -0,0 +1,41 @@
+package toml
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDecodePlansConcurrently(t *testing.T) {
+	type config struct {
+		Doc     docUnmarshalTOML
+		Wrapped intWrapper
+		Port    testPort
+		Retries int    `default:"3"`
+		Bad     []bool `default:"x"`
+	}
+	doc := "Wrapped = \"7\"\nPort = 80\nBad = [true]\n[Doc]\nkey = \"ok\"\n"
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var c config
+			if err := Unmarshal([]byte(doc), &c); err != nil {
+				t.Error(err)
+				return
+			}
+			if c.Doc.Decoded.Key != "ok" || c.Wrapped.Value != 7 || c.Port != 80 || c.Retries != 3 {
+				t.Errorf("unexpected result %+v", c)
+			}
+
+			// plans and defaults are shared, and so are their errors
+			err := Unmarshal([]byte(strings.Replace(doc, "Port = 80", "Port = 0", 1)), &c)
+			assertErrorString(t, "(2, 1): 0 is out of range [1, 65535] for toml.testPort", err)
+			err = Unmarshal([]byte("Port = 80\n"), &c)
+			assertErrorString(t, "unsupported field type for default option", err)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,74 @@
+// Values decoded later.
+
+package toml
+
+import (
+	"errors"
+	"reflect"
+)
+
+// Deferred is the TOML text of a value whose decoding is deferred, like
+// json.RawMessage. When unmarshaled, a Deferred field captures the value of
+// its key as written on the right side of a key/value pair, tables being
+// written as inline tables. It can be decoded later with Decode, once the
+// type of the value is known. When marshaled, the value is written back as
+// is, and an empty Deferred is omitted.
+//
+//	type Plugin struct {
+//	  Name   string
+//	  Config toml.Deferred
+//	}
+type Deferred []byte
+
+var deferredType = reflect.TypeOf(Deferred{})
+
+// Decode unmarshals the value in the value pointed at by v, which may be of
+// any type the value can be decoded into.
+func (r Deferred) Decode(v interface{}) error {
+	mval := reflect.ValueOf(v)
+	if mval.Kind() != reflect.Ptr || mval.IsNil() {
+		return errors.New("only a non-nil pointer can be decoded from a Deferred")
+	}
+	value, err := r.value()
+	if err != nil {
+		return err
+	}
+	d := Decoder{tagName: tagFieldName}
+	elem := mval.Elem()
+	val, err := d.valueFromToml(elem.Type(), value, &elem)
+	if err != nil {
+		return err
+	}
+	elem.Set(val)
+	return nil
+}
+
+// Parse the value: a node of a Tree, or the Go value of a scalar.
+func (r Deferred) value() (interface{}, error) {
+	if len(r) == 0 {
+		return nil, errors.New("empty Deferred")
+	}
+	tree, err := LoadBytes(append([]byte("value = "), r...))
+	if err != nil {
+		return nil, err
+	}
+	return tree.GetPath([]string{"value"}), nil
+}
+
+// Render a value of a Tree as a Deferred.
+func deferredFromToml(value interface{}) (Deferred, error) {
+	switch value.(type) {
+	case *Tree, []*Tree:
+	default:
+		node, err := documentNode(value)
+		if err != nil {
+			return nil, err
+		}
+		value = node
+	}
+	text, err := documentValueText(value)
+	if err != nil {
+		return nil, err
+	}
+	return Deferred(text), nil
+}
@@ -0,0 +1,92 @@
+package toml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshalDeferred(t *testing.T) {
+	type plugin struct {
+		Name   string   `toml:"name"`
+		Config Deferred `toml:"config"`
+		Limit  Deferred `toml:"limit"`
+		Hosts  Deferred `toml:"hosts"`
+		Absent Deferred `toml:"absent"`
+	}
+	type config struct {
+		Plugins []plugin `toml:"plugins"`
+	}
+	doc := `[[plugins]]
+name = "http"
+limit = 10
+hosts = [{ name = "a" }, { name = "b" }]
+
+[plugins.config]
+port = 80
+paths = ["/a", "/b"]
+`
+	var c config
+	if err := NewDecoder(strings.NewReader(doc)).Strict(true).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	p := c.Plugins[0]
+	if string(p.Config) != `{ port = 80, paths = ["/a", "/b"] }` {
+		t.Errorf("unexpected config %q", p.Config)
+	}
+	if string(p.Limit) != "10" || p.Absent != nil {
+		t.Errorf("unexpected values %q %q", p.Limit, p.Absent)
+	}
+
+	var http struct {
+		Port  int
+		Paths []string
+	}
+	if err := p.Config.Decode(&http); err != nil {
+		t.Fatal(err)
+	}
+	if http.Port != 80 || !reflect.DeepEqual(http.Paths, []string{"/a", "/b"}) {
+		t.Errorf("unexpected decoded config %+v", http)
+	}
+	var limit uint16
+	if err := p.Limit.Decode(&limit); err != nil || limit != 10 {
+		t.Errorf("unexpected limit %d: %v", limit, err)
+	}
+	var hosts []map[string]string
+	if err := p.Hosts.Decode(&hosts); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []map[string]string{{"name": "a"}, {"name": "b"}}; !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("expected %v, got %v", expected, hosts)
+	}
+
+	assertErrorString(t, "Can't convert 80(int64) to string", Deferred("80").Decode(new(string)))
+	assertErrorString(t, "empty Deferred", p.Absent.Decode(&limit))
+	assertErrorString(t, "only a non-nil pointer can be decoded from a Deferred", p.Limit.Decode(limit))
+}
+
+func TestMarshalDeferred(t *testing.T) {
+	type plugin struct {
+		Name   string
+		Config Deferred
+		Limit  Deferred
+		Absent Deferred
+	}
+	b, err := Marshal(plugin{Name: "http", Config: Deferred(`{ port = 80 }`), Limit: Deferred("10")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `Limit = 10
+Name = "http"
+
+[Config]
+  port = 80
+`
+	if string(b) != expected {
+		t.Errorf("Bad marshal: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, b)
+	}
+	_, err = Marshal(plugin{Config: Deferred("{ port = ")})
+	if err == nil {
+		t.Error("expected an error for an invalid Deferred")
+	}
+}
@@ -0,0 +1,174 @@
+// Reference documentation of configuration structs.
+
+package toml
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ConfigKey describes a key of a configuration struct, as returned by
+// DescribeConfig.
+type ConfigKey struct {
+	Key Key `json:"key"`
+	// TOML type of the values of the key, such as "integer", "array of
+	// strings", "table" or "array of tables", or the Go type of the field
+	// when it has no TOML equivalent
+	Type     string `json:"type"`
+	Default  string `json:"default,omitempty"` // value of the default tag
+	Comment  string `json:"comment,omitempty"` // value of the comment tag
+	Required bool   `json:"required"`
+}
+
+// ConfigKeys is the description of the keys of a configuration struct. It is
+// encoded to JSON by encoding/json as an array of keys, and to Markdown by
+// its Markdown method.
+type ConfigKeys []ConfigKey
+
+// DescribeConfig returns the description of every key v, a struct or a
+// pointer to a struct, is decoded from: their type, default value, comment
+// and whether they are required, as given by the tags of the fields. This
+// allows programs to generate the reference documentation of their
+// configuration files.
+//
+// Keys are in the order of the fields, each table being followed by its keys.
+// Fields of struct types are described as tables, and slices of structs as
+// arrays of tables. Recursive types are described down to their first
+// recursion.
+func DescribeConfig(v interface{}) (ConfigKeys, error) {
+	mtype := reflect.TypeOf(v)
+	if mtype != nil {
+		mtype = derefType(mtype)
+	}
+	if mtype == nil || !templateTable(mtype) {
+		return nil, errors.New("only a struct or a pointer to a struct can be described")
+	}
+	var keys ConfigKeys
+	describeTable(&keys, nil, mtype, map[reflect.Type]bool{})
+	return keys, nil
+}
+
+// Append the description of the keys of the struct type mtype, in the table
+// at prefix.
+func describeTable(keys *ConfigKeys, prefix Key, mtype reflect.Type, visiting map[reflect.Type]bool) {
+	if visiting[mtype] {
+		return
+	}
+	visiting[mtype] = true
+	defer delete(visiting, mtype)
+	for _, f := range promotedFields(mtype, annotationDefault).fields {
+		key := prefix.Append(f.opts.name)
+		if f.path != nil {
+			key = prefix.Append(f.path...)
+		}
+		ftype := derefType(f.Type)
+		typeName := configTypeName(ftype)
+		*keys = append(*keys, ConfigKey{
+			Key:      key,
+			Type:     typeName,
+			Default:  f.opts.defaultValue,
+			Comment:  f.opts.comment,
+			Required: f.opts.required,
+		})
+		switch typeName {
+		case "table":
+			if templateTable(ftype) {
+				describeTable(keys, key, ftype, visiting)
+			}
+		case "array of tables":
+			describeTable(keys, key, derefType(ftype.Elem()), visiting)
+		}
+	}
+}
+
+// Name of the TOML type of the values of type mtype.
+func configTypeName(mtype reflect.Type) string {
+	switch {
+	case mtype == timeType:
+		return "datetime"
+	case mtype == localDateType:
+		return "local date"
+	case mtype == localTimeType:
+		return "local time"
+	case mtype == localDateTimeType:
+		return "local datetime"
+	case mtype == reflect.TypeOf(time.Duration(0)), isTextMarshaler(mtype), isTextMarshaler(reflect.PtrTo(mtype)):
+		return "string"
+	case isOptional(mtype):
+		return configTypeName(derefType(mtype.Field(0).Type))
+	case templateTable(mtype):
+		return "table"
+	}
+	switch mtype.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Map:
+		return "table"
+	case reflect.Slice, reflect.Array:
+		switch elem := derefType(mtype.Elem()); {
+		case isByteSlice(mtype):
+			return "string"
+		case templateTable(elem):
+			return "array of tables"
+		case elem.Kind() == reflect.Interface:
+			return "array"
+		default:
+			return "array of " + pluralTypeName(configTypeName(elem))
+		}
+	case reflect.Interface:
+		return "any"
+	}
+	return mtype.String()
+}
+
+// Plural of a type name, for arrays.
+func pluralTypeName(name string) string {
+	switch {
+	case strings.HasPrefix(name, "array"):
+		return "arrays" + strings.TrimPrefix(name, "array")
+	case name == "string", name == "integer", name == "float", name == "boolean", name == "table",
+		name == "datetime", name == "local datetime", name == "local date", name == "local time":
+		return name + "s"
+	}
+	return name
+}
+
+// Markdown returns the description of the keys as a Markdown table.
+func (keys ConfigKeys) Markdown() string {
+	var b strings.Builder
+	b.WriteString("| Key | Type | Default | Required | Description |\n")
+	b.WriteString("|-----|------|---------|----------|-------------|\n")
+	for _, k := range keys {
+		key := k.Key.String()
+		switch k.Type {
+		case "table":
+			key = "[" + key + "]"
+		case "array of tables":
+			key = "[[" + key + "]]"
+		}
+		var def, required string
+		if k.Default != "" {
+			def = "`" + k.Default + "`"
+		}
+		if k.Required {
+			required = "yes"
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | %s | %s | %s |\n", key, k.Type, def, required, markdownCell(k.Comment))
+	}
+	return b.String()
+}
+
+func markdownCell(s string) string {
+	s = strings.Replace(s, "|", `\|`, -1)
+	return strings.Join(strings.Fields(s), " ")
+}
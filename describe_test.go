@@ -0,0 +1,73 @@
+package toml
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type describeNode struct {
+	Name     string
+	Children []describeNode
+}
+
+func TestDescribeConfig(t *testing.T) {
+	type config struct {
+		templateConfig
+		Matrix  [][]int
+		Started time.Time
+		Date    LocalDate
+		Secret  []byte
+		Labels  map[string]string `comment:"labels | annotations"`
+		Tree    describeNode
+		Ignored string `toml:"-"`
+	}
+	keys, err := DescribeConfig(&config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "| Key | Type | Default | Required | Description |\n" +
+		"|-----|------|---------|----------|-------------|\n" +
+		"| `Title` | string |  |  | title of the site |\n" +
+		"| `debug` | boolean |  |  | verbose logging |\n" +
+		"| `Timeout` | string | `5s` |  |  |\n" +
+		"| `Mode` | integer | `420` |  |  |\n" +
+		"| `Tags` | array of strings |  |  |  |\n" +
+		"| `[database]` | table |  |  |  |\n" +
+		"| `database.Host` | string |  | yes | host of the database server |\n" +
+		"| `database.Port` | integer | `5432` |  |  |\n" +
+		"| `database.User` | string |  |  |  |\n" +
+		"| `[Cache]` | table |  |  |  |\n" +
+		"| `Cache.Size` | integer |  |  |  |\n" +
+		"| `Cache.Path` | string |  |  |  |\n" +
+		"| `[[Backends]]` | array of tables |  |  | load balanced backends |\n" +
+		"| `Backends.Name` | string |  |  |  |\n" +
+		"| `Backends.url` | string |  |  |  |\n" +
+		"| `Any` | any |  |  |  |\n" +
+		"| `log.level` | string |  |  |  |\n" +
+		"| `Matrix` | array of arrays of integers |  |  |  |\n" +
+		"| `Started` | datetime |  |  |  |\n" +
+		"| `Date` | local date |  |  |  |\n" +
+		"| `Secret` | string |  |  |  |\n" +
+		"| `[Labels]` | table |  |  | labels \\| annotations |\n" +
+		"| `[Tree]` | table |  |  |  |\n" +
+		"| `Tree.Name` | string |  |  |  |\n" +
+		"| `[[Tree.Children]]` | array of tables |  |  |  |\n"
+	if keys.Markdown() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, keys.Markdown())
+	}
+
+	b, err := json.Marshal(keys[7:9])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedJSON := `[{"key":["database","Port"],"type":"integer","default":"5432","required":false},` +
+		`{"key":["database","User"],"type":"string","required":false}]`
+	if string(b) != expectedJSON {
+		t.Errorf("expected %s, got %s", expectedJSON, b)
+	}
+
+	if _, err := DescribeConfig(42); err == nil {
+		t.Error("expected an error for an integer")
+	}
+}
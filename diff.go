@@ -0,0 +1,147 @@
+// Structural comparison of documents.
+
+package toml
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// DiffKind identifies the kind of a difference between two documents.
+type DiffKind int
+
+const (
+	// DiffAdded is a key only present in the new document.
+	DiffAdded DiffKind = iota
+	// DiffRemoved is a key only present in the old document.
+	DiffRemoved
+	// DiffChanged is a key whose value differs between the documents.
+	DiffChanged
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	case DiffChanged:
+		return "changed"
+	}
+	return "unknown"
+}
+
+// Difference is a key whose value differs between two documents. Values are
+// of the types returned by Tree.ToMap.
+type Difference struct {
+	Kind DiffKind
+	Path Key
+	Old  interface{} // value in the old document, nil when added
+	New  interface{} // value in the new document, nil when removed
+}
+
+// String renders the difference on one line, prefixed by +, - or ~ depending
+// on its kind, with values written as in a TOML document.
+func (d Difference) String() string {
+	key := d.Path.String()
+	switch d.Kind {
+	case DiffAdded:
+		return fmt.Sprintf("+ %s = %s", key, diffValueString(d.New))
+	case DiffRemoved:
+		return fmt.Sprintf("- %s = %s", key, diffValueString(d.Old))
+	}
+	return fmt.Sprintf("~ %s = %s -> %s", key, diffValueString(d.Old), diffValueString(d.New))
+}
+
+// Diff compares two documents and returns the keys added, removed or changed
+// from before to after, sorted by key path. Tables present in both documents
+// are compared key by key, while other values, including arrays of tables, are
+// compared as a whole. Date-times designating the same instant are equal,
+// whatever their offset, and so are two NaN floats.
+func Diff(before, after *Tree) []Difference {
+	return diffMaps(nil, before.ToMap(), after.ToMap())
+}
+
+func diffMaps(path Key, before, after map[string]interface{}) []Difference {
+	var keys []string
+	for k := range before {
+		keys = append(keys, k)
+	}
+	for k := range after {
+		if _, ok := before[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var diffs []Difference
+	for _, k := range keys {
+		keyPath := path.Append(k)
+		o, inOld := before[k]
+		n, inNew := after[k]
+		switch {
+		case !inOld:
+			diffs = append(diffs, Difference{Kind: DiffAdded, Path: keyPath, New: n})
+		case !inNew:
+			diffs = append(diffs, Difference{Kind: DiffRemoved, Path: keyPath, Old: o})
+		default:
+			om, oIsTable := o.(map[string]interface{})
+			nm, nIsTable := n.(map[string]interface{})
+			if oIsTable && nIsTable {
+				diffs = append(diffs, diffMaps(keyPath, om, nm)...)
+			} else if !diffEqual(o, n) {
+				diffs = append(diffs, Difference{Kind: DiffChanged, Path: keyPath, Old: o, New: n})
+			}
+		}
+	}
+	return diffs
+}
+
+func diffEqual(a, b interface{}) bool {
+	switch av := a.(type) {
+	case float64:
+		bv, ok := b.(float64)
+		return ok && (av == bv || math.IsNaN(av) && math.IsNaN(bv))
+	case time.Time:
+		bv, ok := b.(time.Time)
+		return ok && av.Equal(bv)
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, v := range av {
+			other, ok := bv[k]
+			if !ok || !diffEqual(v, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !diffEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func diffValueString(v interface{}) string {
+	node, err := documentNode(v)
+	if err == nil {
+		var s string
+		if s, err = documentValueText(node); err == nil {
+			return s
+		}
+	}
+	return fmt.Sprint(v)
+}
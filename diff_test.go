@@ -0,0 +1,83 @@
+package toml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old, err := Load(`
+title = "old"
+removed = 1
+same = 1979-05-27T07:32:00Z
+nan = nan
+ports = [80, 443]
+
+[server]
+host = "localhost"
+port = 8080
+
+[[users]]
+name = "a"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := Load(`
+title = "new"
+same = 1979-05-27T00:32:00-07:00
+nan = nan
+ports = [80, 8443]
+"added key" = true
+
+[server]
+host = "localhost"
+port = 9090
+timeout = 30
+
+[[users]]
+name = "a"
+
+[[users]]
+name = "b"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diffs := Diff(old, new)
+	var lines []string
+	for _, d := range diffs {
+		lines = append(lines, d.String())
+	}
+	expected := []string{
+		`+ "added key" = true`,
+		`~ ports = [80, 443] -> [80, 8443]`,
+		`- removed = 1`,
+		`~ server.port = 8080 -> 9090`,
+		`+ server.timeout = 30`,
+		`~ title = "old" -> "new"`,
+		`~ users = [{ name = "a" }] -> [{ name = "a" }, { name = "b" }]`,
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("unexpected differences:\n%q\nexpected:\n%q", lines, expected)
+	}
+
+	if diffs[3].Kind != DiffChanged || !diffs[3].Path.Equal(Key{"server", "port"}) ||
+		diffs[3].Old != int64(8080) || diffs[3].New != int64(9090) {
+		t.Errorf("unexpected difference: %#v", diffs[3])
+	}
+
+	if diffs := Diff(old, old); len(diffs) != 0 {
+		t.Errorf("expected no difference between a document and itself, got %v", diffs)
+	}
+}
+
+func TestDiffTableReplacedByValue(t *testing.T) {
+	old, _ := Load("[a]\nb = 1")
+	new, _ := Load("a = 1")
+	diffs := Diff(old, new)
+	if len(diffs) != 1 || diffs[0].String() != "~ a = { b = 1 } -> 1" {
+		t.Errorf("unexpected differences: %v", diffs)
+	}
+}
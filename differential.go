@@ -0,0 +1,177 @@
+// Differential decoding of a document into several targets.
+
+package toml
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DecodeMismatch describes a value of the document on which a target of
+// DifferentialDecode disagrees with the reference decoding.
+type DecodeMismatch struct {
+	Target   int         // index of the target in the arguments
+	Path     Key         // path of the value in the document
+	Expected interface{} // value in the document
+	Actual   interface{} // value held by the target, nil if it is missing
+}
+
+func (m DecodeMismatch) String() string {
+	if m.Actual == nil {
+		return fmt.Sprintf("target %d: %s: expected %v, value is missing", m.Target, m.Path, m.Expected)
+	}
+	return fmt.Sprintf("target %d: %s: expected %v (%T), got %v (%T)", m.Target, m.Path, m.Expected, m.Expected, m.Actual, m.Actual)
+}
+
+// DifferentialError is the error returned by DifferentialDecode when some
+// targets do not agree with the document.
+type DifferentialError struct {
+	Mismatches []DecodeMismatch
+}
+
+func (e *DifferentialError) Error() string {
+	lines := make([]string, len(e.Mismatches))
+	for i, m := range e.Mismatches {
+		lines[i] = m.String()
+	}
+	return fmt.Sprintf("%d decoded value(s) differ from the document:\n%s", len(e.Mismatches), strings.Join(lines, "\n"))
+}
+
+// DifferentialDecode decodes data into each of the targets, which must be
+// pointers, and checks that every value of the document is found with the
+// same meaning in each of them. A target can be a pointer to a Tree, in which
+// case it receives the document model, or any value accepted by Unmarshal.
+//
+// A target is checked by encoding it back with Marshal, so a type implementing
+// both Marshaler and Unmarshaler is compared through its own encoding. Values
+// the target holds but the document does not define are ignored; values of
+// the document missing from the target are reported. Integers are compared
+// regardless of their Go type, floats with the precision of a float32, and
+// local dates and date-times decoded into time.Time are compared in the
+// time.Time location.
+//
+// An error is returned as soon as a target fails to decode. Otherwise, a
+// *DifferentialError lists all the disagreements found.
+func DifferentialDecode(data []byte, targets ...interface{}) error {
+	reference, err := LoadBytes(data)
+	if err != nil {
+		return err
+	}
+	expected := reference.ToMap()
+
+	var mismatches []DecodeMismatch
+	for i, target := range targets {
+		actual, err := differentialTarget(data, target)
+		if err != nil {
+			return fmt.Errorf("target %d (%T): %s", i, target, err)
+		}
+		mismatches = append(mismatches, compareDecoded(i, nil, expected, actual)...)
+	}
+	if len(mismatches) > 0 {
+		return &DifferentialError{Mismatches: mismatches}
+	}
+	return nil
+}
+
+// Decode data into target and return its generic representation.
+func differentialTarget(data []byte, target interface{}) (map[string]interface{}, error) {
+	if tree, ok := target.(*Tree); ok {
+		loaded, err := LoadBytes(data)
+		if err != nil {
+			return nil, err
+		}
+		*tree = *loaded
+		return tree.ToMap(), nil
+	}
+	if err := Unmarshal(data, target); err != nil {
+		return nil, err
+	}
+	encoded, err := Marshal(reflect.ValueOf(target).Elem().Interface())
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode decoded value: %s", err)
+	}
+	tree, err := LoadBytes(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load encoded value: %s", err)
+	}
+	return tree.ToMap(), nil
+}
+
+func compareDecoded(target int, path Key, expected, actual map[string]interface{}) []DecodeMismatch {
+	keys := make([]string, 0, len(expected))
+	for k := range expected {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var mismatches []DecodeMismatch
+	for _, k := range keys {
+		keyPath := path.Append(k)
+		mismatches = append(mismatches, compareDecodedValue(target, keyPath, expected[k], actual[k])...)
+	}
+	return mismatches
+}
+
+func compareDecodedValue(target int, path Key, expected, actual interface{}) []DecodeMismatch {
+	mismatch := []DecodeMismatch{{Target: target, Path: path, Expected: expected, Actual: actual}}
+	if actual == nil {
+		return mismatch
+	}
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			return mismatch
+		}
+		return compareDecoded(target, path, e, a)
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok || len(a) != len(e) {
+			return mismatch
+		}
+		var mismatches []DecodeMismatch
+		for i := range e {
+			elementPath := path.Append(fmt.Sprint(i))
+			mismatches = append(mismatches, compareDecodedValue(target, elementPath, e[i], a[i])...)
+		}
+		return mismatches
+	}
+	if !sameScalar(expected, actual) {
+		return mismatch
+	}
+	return nil
+}
+
+// Compare two scalar values of a document, tolerating the conversions done
+// when decoding into Go types.
+func sameScalar(expected, actual interface{}) bool {
+	switch e := expected.(type) {
+	case int64, uint64:
+		return fmt.Sprint(e) == fmt.Sprint(actual)
+	case float64:
+		a, ok := actual.(float64)
+		if !ok {
+			return false
+		}
+		if math.IsNaN(e) {
+			return math.IsNaN(a)
+		}
+		return e == a || float32(e) == float32(a)
+	case time.Time:
+		a, ok := actual.(time.Time)
+		return ok && e.Equal(a)
+	case LocalDate:
+		if a, ok := actual.(time.Time); ok {
+			return LocalDateOf(a) == e
+		}
+	case LocalDateTime:
+		if a, ok := actual.(time.Time); ok {
+			return LocalDateTimeOf(a) == e
+		}
+	}
+	return reflect.DeepEqual(expected, actual)
+}
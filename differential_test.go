@@ -0,0 +1,101 @@
+package toml
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var differentialDoc = []byte(`
+title = "example"
+ratio = 0.1
+created = 1979-05-27
+
+[owner]
+name = "Tom"
+ports = [8000, 8001]
+
+[[items]]
+id = 1
+
+[[items]]
+id = 2
+`)
+
+type differentialConfig struct {
+	Title   string    `toml:"title"`
+	Ratio   float32   `toml:"ratio"`
+	Created time.Time `toml:"created"`
+	Owner   struct {
+		Name  string `toml:"name"`
+		Ports []int  `toml:"ports"`
+	} `toml:"owner"`
+	Items []struct {
+		ID uint8 `toml:"id"`
+	} `toml:"items"`
+}
+
+// upperName decodes strings in upper case, which does not round-trip.
+type upperName string
+
+func (n *upperName) UnmarshalText(text []byte) error {
+	*n = upperName(strings.ToUpper(string(text)))
+	return nil
+}
+
+func TestDifferentialDecode(t *testing.T) {
+	var s differentialConfig
+	var m map[string]interface{}
+	var tree Tree
+	if err := DifferentialDecode(differentialDoc, &s, &m, &tree); err != nil {
+		t.Fatal(err)
+	}
+	if s.Owner.Name != "Tom" || len(m) != 5 || tree.Get("owner.name") != "Tom" {
+		t.Errorf("targets should be decoded, got %+v %v", s, m)
+	}
+}
+
+func TestDifferentialDecodeMismatch(t *testing.T) {
+	type partial struct {
+		Title upperName `toml:"title"`
+		Owner struct {
+			Ports []int `toml:"ports"`
+		} `toml:"owner"`
+	}
+	var m map[string]interface{}
+	var p partial
+	err := DifferentialDecode(differentialDoc, &m, &p)
+	diffErr, ok := err.(*DifferentialError)
+	if !ok {
+		t.Fatalf("expected a *DifferentialError, got %v", err)
+	}
+
+	var paths []string
+	for _, mismatch := range diffErr.Mismatches {
+		if mismatch.Target != 1 {
+			t.Errorf("only the second target should disagree: %s", mismatch)
+		}
+		paths = append(paths, mismatch.Path.String())
+	}
+	expected := "created,items,owner.name,ratio,title"
+	if strings.Join(paths, ",") != expected {
+		t.Errorf("expected mismatches for %s, got %s", expected, strings.Join(paths, ","))
+	}
+	if !strings.Contains(err.Error(), `target 1: title: expected example (string), got EXAMPLE (string)`) {
+		t.Errorf("unexpected error message: %s", err)
+	}
+}
+
+func TestDifferentialDecodeErrors(t *testing.T) {
+	var m map[string]interface{}
+	if err := DifferentialDecode([]byte("a = "), &m); err == nil {
+		t.Error("invalid documents should be rejected")
+	}
+	var i struct {
+		Title int `toml:"title"`
+	}
+	err := DifferentialDecode(differentialDoc, &m, &i)
+	if err == nil || !strings.HasPrefix(err.Error(), "target 1 (*struct") {
+		t.Errorf("decoding errors should identify the target, got %v", err)
+	}
+}
@@ -14,6 +14,14 @@
 // functions to parse TOML data and obtain a Tree instance, then one of its
 // methods to manipulate the tree.
 //
+// Concurrency
+//
+// Marshal, Unmarshal and the other functions of the package can be called
+// from several goroutines at once. The information they cache about Go types
+// is shared by all Encoders and Decoders, and is safe for concurrent use.
+// Encoders, Decoders and Documents must each be used by one goroutine at a
+// time, and Trees must not be modified while other goroutines read them.
+//
 // JSONPath-like queries
 //
 // The package github.com/pelletier/go-toml/query implements a system
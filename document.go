@@ -0,0 +1,602 @@
+// Editing of TOML documents preserving their formatting.
+
+package toml
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Document is a TOML document edited as text. Contrary to a Tree, which is
+// rewritten entirely when marshaled, modifications of a Document only touch
+// the lines of the values they change: comments, indentation and ordering of
+// the rest of the document are preserved. This makes it suitable for programs
+// changing a single setting of a configuration file written by hand.
+//
+// Every modification is checked to leave the document valid. A modification
+// that would not is rejected, and the document is left untouched.
+//
+// A Document must not be used by several goroutines at once, as even some of
+// its reading methods, such as Nodes, update it.
+type Document struct {
+	src  []byte
+	tree *Tree
+	// syntax tree, built by Nodes
+	syntax *docSyntax
+}
+
+// LoadDocument parses b into an editable Document.
+func LoadDocument(b []byte) (*Document, error) {
+	tree, err := LoadBytes(b)
+	if err != nil {
+		return nil, err
+	}
+	src := make([]byte, len(b))
+	copy(src, b)
+	return &Document{src: src, tree: tree}, nil
+}
+
+// Bytes returns the text of the document.
+func (d *Document) Bytes() []byte {
+	b := make([]byte, len(d.src))
+	copy(b, d.src)
+	return b
+}
+
+// String returns the text of the document.
+func (d *Document) String() string {
+	return string(d.src)
+}
+
+// Tree returns the document model of the document. Modifications of the
+// returned tree are not reflected in the document.
+func (d *Document) Tree() *Tree {
+	tree, _ := LoadBytes(d.src)
+	return tree
+}
+
+// Has returns a boolean indicating if the given key exists.
+// Key is a dotted key, as accepted in the documents (e.g. a."b.c").
+func (d *Document) Has(key string) bool {
+	keys, err := parseKey(key)
+	return err == nil && d.tree.HasPath(keys)
+}
+
+// Get returns the value at key, or nil if it does not exist. Key is a dotted
+// key, as accepted in the documents (e.g. a."b.c").
+func (d *Document) Get(key string) interface{} {
+	keys, err := parseKey(key)
+	if err != nil {
+		return nil
+	}
+	return d.GetPath(keys)
+}
+
+// GetPath returns the value at the path indicated by keys, or nil if it does
+// not exist. See Tree.GetPath for details.
+func (d *Document) GetPath(keys []string) interface{} {
+	return d.tree.GetPath(keys)
+}
+
+// Set sets the value at key, creating intermediate tables as needed. Key is
+// a dotted key, as accepted in the documents (e.g. a."b.c").
+//
+// See SetPath for details.
+func (d *Document) Set(key string, value interface{}) error {
+	keys, err := parseKey(key)
+	if err != nil {
+		return err
+	}
+	return d.SetPath(keys, value)
+}
+
+// SetPath sets the value at the path indicated by keys. Value can be of any
+// type accepted by TreeFromMap; maps are written as inline tables.
+//
+// The text of an existing value is replaced in place. A new key is added after
+// the last key of the deepest table of the path that is defined in the
+// document, as a dotted key if needed. If the top-level table of the key does
+// not exist, a new table is appended to the document instead. Values inside
+// inline tables are set by rewriting the inline table. Tables cannot be
+// replaced by a value.
+func (d *Document) SetPath(keys []string, value interface{}) error {
+	if len(keys) == 0 {
+		return errors.New("key path cannot be empty")
+	}
+	node, err := documentNode(value)
+	if err != nil {
+		return err
+	}
+	text, err := documentValueText(node)
+	if err != nil {
+		return err
+	}
+	s, err := scanDocument(d.src)
+	if err != nil {
+		return err
+	}
+
+	if e := s.entry(keys); e != nil {
+		return d.replace(e.valueStart, e.valueEnd, text)
+	}
+	if e := s.containingEntry(keys); e != nil {
+		return d.editInline(e, func(t *Tree) error {
+			setInlineNode(t, keys[len(e.path):], node)
+			return nil
+		})
+	}
+	switch d.tree.GetPath(keys).(type) {
+	case *Tree, []*Tree:
+		return fmt.Errorf("key %s is a table and cannot be replaced", Key(keys).String())
+	}
+	for i := 1; i < len(keys); i++ {
+		switch d.tree.GetPath(keys[:i]).(type) {
+		case nil, *Tree, []*Tree:
+		default:
+			return fmt.Errorf("key %s is not a table", Key(keys[:i]).String())
+		}
+	}
+
+	parent := keys[:len(keys)-1]
+	section := s.deepestSection(keys)
+	if len(parent) > 0 && section.path == nil && d.tree.GetPath(keys[:1]) == nil {
+		return d.appendTable(parent, keys[len(keys)-1], text)
+	}
+	relative := Key(keys[len(section.path):]).String()
+	if err := d.insertEntry(s, section, relative, text); err != nil {
+		// tables defined by headers cannot be extended by dotted keys
+		return d.appendTable(parent, keys[len(keys)-1], text)
+	}
+	return nil
+}
+
+// Delete removes the value or table at key. Key is a dotted key, as accepted
+// in the documents (e.g. a."b.c").
+//
+// See DeletePath for details.
+func (d *Document) Delete(key string) error {
+	keys, err := parseKey(key)
+	if err != nil {
+		return err
+	}
+	return d.DeletePath(keys)
+}
+
+// DeletePath removes the value or table at the path indicated by keys. The
+// lines of the removed key/value pairs are deleted; removing a table deletes
+// its sections, along with the comments directly above their headers, and all
+// the keys defined below it.
+func (d *Document) DeletePath(keys []string) error {
+	if len(keys) == 0 {
+		return errors.New("key path cannot be empty")
+	}
+	s, err := scanDocument(d.src)
+	if err != nil {
+		return err
+	}
+	if e := s.containingEntry(keys); e != nil {
+		return d.editInline(e, func(t *Tree) error {
+			return t.DeletePath(keys[len(e.path):])
+		})
+	}
+
+	type span struct{ start, end int }
+	var spans []span
+	removed := map[int]bool{}
+	for i, section := range s.sections {
+		if i > 0 && Key(section.path).HasPrefix(keys) {
+			removed[i] = true
+			spans = append(spans, span{section.start, section.end})
+		}
+	}
+	for _, e := range s.entries {
+		if !removed[e.section] && Key(e.path).HasPrefix(keys) {
+			spans = append(spans, span{e.start, e.end})
+		}
+	}
+	if len(spans) == 0 {
+		return errors.New("no such key to delete")
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	var buf bytes.Buffer
+	last := 0
+	for _, sp := range spans {
+		if sp.start < last {
+			continue
+		}
+		buf.Write(d.src[last:sp.start])
+		last = sp.end
+	}
+	buf.Write(d.src[last:])
+	return d.update(buf.Bytes())
+}
+
+// Replace the bytes between start and end by text.
+func (d *Document) replace(start, end int, text string) error {
+	var buf bytes.Buffer
+	buf.Write(d.src[:start])
+	buf.WriteString(text)
+	buf.Write(d.src[end:])
+	return d.update(buf.Bytes())
+}
+
+// Replace the text of the document, making sure it is still valid.
+func (d *Document) update(src []byte) error {
+	tree, err := LoadBytes(src)
+	if err != nil {
+		return fmt.Errorf("modification would produce an invalid document: %s", err)
+	}
+	d.src = src
+	d.tree = tree
+	d.syntax = nil
+	return nil
+}
+
+// Rewrite the inline table, or array of inline tables, held by the entry.
+func (d *Document) editInline(e *docEntry, edit func(*Tree) error) error {
+	tree, err := LoadBytes(d.src)
+	if err != nil {
+		return err
+	}
+	var target *Tree
+	switch node := tree.GetPath(e.path).(type) {
+	case *Tree:
+		target = node
+	case []*Tree:
+		if len(node) > 0 {
+			target = node[len(node)-1]
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("key %s is not a table", Key(e.path).String())
+	}
+	if err := edit(target); err != nil {
+		return err
+	}
+	text, err := documentValueText(tree.GetPath(e.path))
+	if err != nil {
+		return err
+	}
+	return d.replace(e.valueStart, e.valueEnd, text)
+}
+
+// Add a key/value pair at the end of the key/value pairs of the section.
+func (d *Document) insertEntry(s *docScan, section *docSection, key, value string) error {
+	var at int
+	var indent string
+	switch {
+	case section.lastEntry >= 0:
+		last := s.entries[section.lastEntry]
+		at, indent = last.end, last.indent
+	case section.path != nil:
+		at = section.bodyStart
+	case len(s.sections) > 1:
+		// keys of the root table go before the first table
+		at = s.sections[1].start
+	default:
+		at = len(d.src)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(d.src[:at])
+	if at > 0 && d.src[at-1] != '\n' {
+		buf.WriteString("\n")
+	}
+	buf.WriteString(indent + key + " = " + value + "\n")
+	if section.path == nil && section.lastEntry < 0 && at < len(d.src) {
+		buf.WriteString("\n")
+	}
+	buf.Write(d.src[at:])
+	return d.update(buf.Bytes())
+}
+
+// Append a new table at the end of the document.
+func (d *Document) appendTable(path []string, key, value string) error {
+	var buf bytes.Buffer
+	buf.Write(d.src)
+	if len(bytes.TrimSpace(d.src)) > 0 {
+		if !bytes.HasSuffix(d.src, []byte("\n")) {
+			buf.WriteString("\n")
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString("[" + Key(path).String() + "]\n")
+	buf.WriteString(quoteKeyIfNeeded(key) + " = " + value + "\n")
+	return d.update(buf.Bytes())
+}
+
+// Set a node in an inline table, keeping the place of the key when the inline
+// table is written in order. New keys go last.
+func setInlineNode(t *Tree, keys []string, node interface{}) {
+	parent := t
+	if len(keys) > 1 {
+		if tree, ok := t.GetPath(keys[:len(keys)-1]).(*Tree); ok {
+			parent = tree
+		}
+	}
+	position := Position{Line: parent.position.Line + len(parent.values) + 1}
+	switch old := parent.values[keys[len(keys)-1]].(type) {
+	case *tomlValue:
+		position = old.position
+	case *Tree:
+		position = old.position
+	}
+	switch n := node.(type) {
+	case *tomlValue:
+		n.position = position
+	case *Tree:
+		n.position = position
+	}
+	t.SetPath(keys, node)
+}
+
+// Convert a Go value to the node stored in a Tree for it.
+func documentNode(value interface{}) (interface{}, error) {
+	tree, err := TreeFromMap(map[string]interface{}{"value": value})
+	if err != nil {
+		return nil, err
+	}
+	return tree.values["value"], nil
+}
+
+// Render a node of a Tree as it is written on the right side of a key/value
+// pair. Tables are rendered as inline tables.
+func documentValueText(node interface{}) (string, error) {
+	switch n := node.(type) {
+	case *Tree:
+		return tomlTreeStringRepresentation(n, OrderPreserve)
+	case []*Tree:
+		values := make([]string, len(n))
+		for i, tree := range n {
+			repr, err := tomlTreeStringRepresentation(tree, OrderPreserve)
+			if err != nil {
+				return "", err
+			}
+			values[i] = repr
+		}
+		return "[" + strings.Join(values, ", ") + "]", nil
+	}
+	return tomlValueStringRepresentation(node, "", "", OrderPreserve, false)
+}
+
+// docScan locates the key/value pairs and the tables of a document.
+type docScan struct {
+	entries  []docEntry
+	sections []docSection // the first section is the root table
+}
+
+// docEntry is a key/value pair of a table section.
+type docEntry struct {
+	path       []string // full path of the key
+	section    int      // index of the section of the entry
+	start      int      // start of the lines of the entry
+	end        int      // end of the lines of the entry, after the newline
+	valueStart int
+	valueEnd   int
+	indent     string // indentation of the key
+}
+
+// docSection is the part of a document introduced by a table header.
+type docSection struct {
+	path      []string
+	array     bool // the header is that of an element of an array of tables
+	start     int  // start of the comment lines directly above the header
+	bodyStart int  // start of the line following the header
+	end       int  // start of the next section
+	lastEntry int  // index of the last entry of the section, -1 if none
+}
+
+func scanDocument(src []byte) (*docScan, error) {
+	lineStarts := []int{0}
+	for i, c := range src {
+		if c == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	offset := func(pos Position) int {
+		off := lineStarts[pos.Line-1]
+		for col := 1; col < pos.Col && off < len(src); col++ {
+			_, size := utf8.DecodeRune(src[off:])
+			off += size
+		}
+		return off
+	}
+	lineEnd := func(off int) int {
+		if i := bytes.IndexByte(src[off:], '\n'); i >= 0 {
+			return off + i + 1
+		}
+		return len(src)
+	}
+
+	s := &docScan{sections: []docSection{{lastEntry: -1}}}
+	depth := 0
+	for _, tok := range lexToml(src) {
+		switch tok.typ {
+		case tokenError:
+			return nil, errors.New(tok.Position.String() + ": " + tok.val)
+		case tokenLeftCurlyBrace:
+			depth++
+		case tokenRightCurlyBrace:
+			depth--
+		case tokenKeyGroup, tokenKeyGroupArray:
+			path, err := parseKey(tok.val)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid table key: %s", tok.Position, err)
+			}
+			line := tok.Line - 1
+			for line > 0 && bytes.HasPrefix(bytes.TrimSpace(src[lineStarts[line-1]:lineStarts[line]]), []byte("#")) {
+				line--
+			}
+			start := lineStarts[line]
+			if previous := &s.sections[len(s.sections)-1]; previous.lastEntry >= 0 && start < s.entries[previous.lastEntry].end {
+				start = lineStarts[tok.Line-1]
+			}
+			s.sections = append(s.sections, docSection{
+				path:      path,
+				array:     tok.typ == tokenKeyGroupArray,
+				start:     start,
+				bodyStart: lineEnd(offset(tok.Position)),
+				lastEntry: -1,
+			})
+		case tokenKey:
+			if depth > 0 {
+				continue
+			}
+			key, err := parseKey(tok.val)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid key: %s", tok.Position, err)
+			}
+			keyStart := offset(tok.Position)
+			i := skipDocumentSpaces(src, keyStart+len(tok.val))
+			if i >= len(src) || src[i] != '=' {
+				return nil, fmt.Errorf("%s: cannot locate the value of key %s", tok.Position, tok.val)
+			}
+			valueStart := skipDocumentSpaces(src, i+1)
+			valueEnd := skipDocumentValue(src, valueStart)
+
+			lineStart := lineStarts[tok.Line-1]
+			start := keyStart
+			indent := ""
+			if len(bytes.TrimSpace(src[lineStart:keyStart])) == 0 {
+				start = lineStart
+				indent = string(src[lineStart:keyStart])
+			}
+			current := len(s.sections) - 1
+			s.entries = append(s.entries, docEntry{
+				path:       append(append([]string{}, s.sections[current].path...), key...),
+				section:    current,
+				start:      start,
+				end:        lineEnd(valueEnd),
+				valueStart: valueStart,
+				valueEnd:   valueEnd,
+				indent:     indent,
+			})
+			s.sections[current].lastEntry = len(s.entries) - 1
+		}
+	}
+
+	for i := range s.sections {
+		if i+1 < len(s.sections) {
+			s.sections[i].end = s.sections[i+1].start
+		} else {
+			s.sections[i].end = len(src)
+		}
+	}
+	return s, nil
+}
+
+// Find the last key/value pair defining keys.
+func (s *docScan) entry(keys []string) *docEntry {
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		if len(s.entries[i].path) == len(keys) && Key(keys).HasPrefix(s.entries[i].path) {
+			return &s.entries[i]
+		}
+	}
+	return nil
+}
+
+// Find the last key/value pair whose value contains keys, such as an inline
+// table.
+func (s *docScan) containingEntry(keys []string) *docEntry {
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		if len(s.entries[i].path) < len(keys) && Key(keys).HasPrefix(s.entries[i].path) {
+			return &s.entries[i]
+		}
+	}
+	return nil
+}
+
+// Find the last section of the longest table header that is a prefix of the
+// parent of keys.
+func (s *docScan) deepestSection(keys []string) *docSection {
+	best := &s.sections[0]
+	for i := range s.sections {
+		section := &s.sections[i]
+		if len(section.path) < len(keys) && len(section.path) >= len(best.path) && Key(keys).HasPrefix(section.path) {
+			best = section
+		}
+	}
+	return best
+}
+
+func skipDocumentSpaces(src []byte, i int) int {
+	for i < len(src) && (src[i] == ' ' || src[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+// Return the offset following the value starting at offset i.
+func skipDocumentValue(src []byte, i int) int {
+	if i >= len(src) {
+		return i
+	}
+	switch {
+	case bytes.HasPrefix(src[i:], []byte(`"""`)), bytes.HasPrefix(src[i:], []byte(`'''`)):
+		delim := src[i : i+3]
+		escapes := src[i] == '"'
+		for j := i + 3; j < len(src); j++ {
+			if escapes && src[j] == '\\' {
+				j++
+				continue
+			}
+			if bytes.HasPrefix(src[j:], delim) {
+				end := j + 3
+				// up to two quotes can precede the closing delimiter
+				for k := 0; k < 2 && end < len(src) && src[end] == delim[0]; k++ {
+					end++
+				}
+				return end
+			}
+		}
+		return len(src)
+	case src[i] == '"', src[i] == '\'':
+		for j := i + 1; j < len(src); j++ {
+			if src[i] == '"' && src[j] == '\\' {
+				j++
+				continue
+			}
+			if src[j] == src[i] || src[j] == '\n' {
+				return j + 1
+			}
+		}
+		return len(src)
+	case src[i] == '[', src[i] == '{':
+		depth := 0
+		for j := i; j < len(src); {
+			switch src[j] {
+			case '[', '{':
+				depth++
+			case ']', '}':
+				depth--
+				if depth == 0 {
+					return j + 1
+				}
+			case '"', '\'':
+				j = skipDocumentValue(src, j)
+				continue
+			case '#':
+				for j < len(src) && src[j] != '\n' {
+					j++
+				}
+				continue
+			}
+			j++
+		}
+		return len(src)
+	}
+	j := i
+	for j < len(src) && !strings.ContainsRune(" \t\r\n,#]}", rune(src[j])) {
+		j++
+	}
+	// date-times can contain a space between the date and the time
+	if j+1 < len(src) && src[j] == ' ' && isDigit(rune(src[j+1])) && j-i == 10 && src[i+4] == '-' {
+		return skipDocumentValue(src, j+1)
+	}
+	return j
+}
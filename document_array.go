@@ -0,0 +1,151 @@
+// Arrays of tables of Documents.
+
+package toml
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// AppendTableArrayElement adds a table after the last element of the array
+// of tables at key, as a new [[key]] section holding values, which may be
+// nil. The array is created at the end of the document if it does not exist.
+// Key is a dotted key, as accepted in the documents (e.g. a."b.c").
+func (d *Document) AppendTableArrayElement(key string, values map[string]interface{}) error {
+	keys, err := parseKey(key)
+	if err != nil {
+		return err
+	}
+	elements, err := d.tableArray(keys)
+	if err != nil {
+		return err
+	}
+	return d.insertTableArrayElement(keys, elements, len(elements), values)
+}
+
+// InsertTableArrayElement adds a table at index i of the array of tables at
+// key, as a new [[key]] section holding values written before the section of
+// the current element i, and the comments above it. i may be the length of
+// the array, to append the table.
+func (d *Document) InsertTableArrayElement(key string, i int, values map[string]interface{}) error {
+	keys, err := parseKey(key)
+	if err != nil {
+		return err
+	}
+	elements, err := d.tableArray(keys)
+	if err != nil {
+		return err
+	}
+	if i < 0 || i > len(elements) {
+		return fmt.Errorf("index %d out of range for array of tables %s of length %d", i, Key(keys), len(elements))
+	}
+	return d.insertTableArrayElement(keys, elements, i, values)
+}
+
+// RemoveTableArrayElement removes the element at index i of the array of
+// tables at key: the lines of its [[key]] section, of the comments directly
+// above its header, and of the sub-tables defined below it.
+func (d *Document) RemoveTableArrayElement(key string, i int) error {
+	keys, err := parseKey(key)
+	if err != nil {
+		return err
+	}
+	elements, err := d.tableArray(keys)
+	if err != nil {
+		return err
+	}
+	if i < 0 || i >= len(elements) {
+		return fmt.Errorf("index %d out of range for array of tables %s of length %d", i, Key(keys), len(elements))
+	}
+	var buf bytes.Buffer
+	buf.Write(d.src[:elements[i].start])
+	buf.Write(d.src[elements[i].end:])
+	return d.update(buf.Bytes())
+}
+
+// docSpan is a part of a document.
+type docSpan struct {
+	start, end int
+}
+
+// Locate the elements of the array of tables at keys, each one spanning its
+// [[...]] section and the sections of its sub-tables. When keys is nested in
+// other arrays of tables, only the elements of their last table are
+// considered, as with GetPath.
+func (d *Document) tableArray(keys []string) ([]docSpan, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("key path cannot be empty")
+	}
+	trees, isArray := d.tree.GetPath(keys).([]*Tree)
+	if !isArray && d.tree.GetPath(keys) != nil {
+		return nil, fmt.Errorf("key %s is not an array of tables", Key(keys))
+	}
+	s, err := scanDocument(d.src)
+	if err != nil {
+		return nil, err
+	}
+
+	first := 1
+	for i := len(s.sections) - 1; i > 0; i-- {
+		section := s.sections[i]
+		if section.array && len(section.path) < len(keys) && Key(keys).HasPrefix(section.path) {
+			first = i + 1
+			break
+		}
+	}
+	var elements []docSpan
+	for i := first; i < len(s.sections); i++ {
+		section := s.sections[i]
+		switch {
+		case section.array && Key(section.path).Equal(keys):
+			elements = append(elements, docSpan{section.start, section.end})
+		case len(elements) > 0 && len(section.path) > len(keys) && Key(section.path).HasPrefix(keys):
+			// sub-table of the last element
+			if last := &elements[len(elements)-1]; last.end == section.start {
+				last.end = section.end
+			}
+		}
+	}
+	if len(elements) != len(trees) {
+		return nil, fmt.Errorf("array of tables %s is not written with [[%s]] headers", Key(keys), Key(keys))
+	}
+	return elements, nil
+}
+
+// Insert a [[keys]] section holding values before the element i, or after the
+// last element if i is the length of the array.
+func (d *Document) insertTableArrayElement(keys []string, elements []docSpan, i int, values map[string]interface{}) error {
+	tree, err := TreeFromMap(values)
+	if err != nil {
+		return err
+	}
+	var block bytes.Buffer
+	header := Key(keys).String()
+	block.WriteString("[[" + header + "]]\n")
+	if _, err := tree.writeToOrdered(&block, "", header, 0, false, OrderAlphabetical, "", defaultLayout, false, false, false); err != nil {
+		return err
+	}
+
+	at := len(d.src)
+	switch {
+	case i < len(elements):
+		at = elements[i].start
+	case len(elements) > 0:
+		at = elements[len(elements)-1].end
+	}
+	var buf bytes.Buffer
+	buf.Write(d.src[:at])
+	if at > 0 && !bytes.HasSuffix(d.src[:at], []byte("\n")) {
+		buf.WriteString("\n")
+	}
+	if len(bytes.TrimSpace(d.src[:at])) > 0 && !bytes.HasSuffix(d.src[:at], []byte("\n\n")) {
+		buf.WriteString("\n")
+	}
+	buf.Write(block.Bytes())
+	if at < len(d.src) {
+		buf.WriteString("\n")
+	}
+	buf.Write(d.src[at:])
+	return d.update(buf.Bytes())
+}
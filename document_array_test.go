@@ -0,0 +1,104 @@
+package toml
+
+import (
+	"testing"
+)
+
+func TestDocumentTableArrays(t *testing.T) {
+	d, err := LoadDocument([]byte(`title = "servers"
+
+# the main server
+[[servers]]
+name = "alpha"
+
+[servers.tls]
+cert = "alpha.pem"
+
+# the backup server
+[[servers]]
+name = "beta"
+
+[database]
+port = 5432
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.AppendTableArrayElement("servers", map[string]interface{}{"name": "gamma"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.InsertTableArrayElement("servers", 1, map[string]interface{}{"name": "delta", "port": 80}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `title = "servers"
+
+# the main server
+[[servers]]
+name = "alpha"
+
+[servers.tls]
+cert = "alpha.pem"
+
+[[servers]]
+name = "delta"
+port = 80
+
+# the backup server
+[[servers]]
+name = "beta"
+
+[[servers]]
+name = "gamma"
+
+[database]
+port = 5432
+`
+	if d.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, d)
+	}
+
+	if err := d.RemoveTableArrayElement("servers", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.RemoveTableArrayElement("servers", 1); err != nil {
+		t.Fatal(err)
+	}
+	expected = `title = "servers"
+
+[[servers]]
+name = "delta"
+port = 80
+
+[[servers]]
+name = "gamma"
+
+[database]
+port = 5432
+`
+	if d.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, d)
+	}
+
+	if err := d.AppendTableArrayElement("clients", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.InsertTableArrayElement("clients", 0, map[string]interface{}{"id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := expected + "\n[[clients]]\nid = 1\n\n[[clients]]\n"; d.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, d)
+	}
+
+	err = d.RemoveTableArrayElement("servers", 2)
+	assertErrorString(t, "index 2 out of range for array of tables servers of length 2", err)
+	err = d.AppendTableArrayElement("database", nil)
+	assertErrorString(t, "key database is not an array of tables", err)
+
+	d, err = LoadDocument([]byte("servers = [{name = \"alpha\"}]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.AppendTableArrayElement("servers", nil)
+	assertErrorString(t, "array of tables servers is not written with [[servers]] headers", err)
+}
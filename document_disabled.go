@@ -0,0 +1,232 @@
+// Key/value pairs of Documents disabled by commenting them out.
+
+package toml
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// DisabledEntry is a key/value pair of a document that is commented out, such
+// as "# port = 8080": a setting kept in the document, but not in effect.
+type DisabledEntry struct {
+	Key      Key      // full path of the key, were the pair enabled
+	Value    Value    // value of the key, were the pair enabled
+	Position Position // position of the comment
+	start    int      // offset of the first line of the comment
+	end      int      // offset following the last line of the comment
+}
+
+// DisabledEntries returns the key/value pairs of the document that are
+// commented out, in document order. A disabled entry is a comment made of a
+// key/value pair, possibly spanning several comment lines for multi-line
+// values, with the text of the comment starting right after the #, or after a
+// single space following it. Comments that do not parse as a key/value pair,
+// such as prose, are not disabled entries.
+func (d *Document) DisabledEntries() []DisabledEntry {
+	s, err := scanDocument(d.src)
+	if err != nil {
+		return nil
+	}
+	var entries []DisabledEntry
+	lines := documentLines(d.src)
+	for i := 0; i < len(lines); i++ {
+		line := d.src[lines[i]:lineEndOffset(d.src, lines[i])]
+		text, ok := uncommentLine(line)
+		if !ok || !pairLine.Match(text) || s.inValue(lines[i]) {
+			continue
+		}
+		// add comment lines until the pair parses, for multi-line values
+		var buf bytes.Buffer
+		for j := i; j < len(lines); j++ {
+			text, ok := uncommentLine(d.src[lines[j]:lineEndOffset(d.src, lines[j])])
+			if !ok || s.inValue(lines[j]) {
+				break
+			}
+			buf.Write(text)
+			key, value, ok := parseDisabledEntry(buf.Bytes())
+			if !ok {
+				continue
+			}
+			section := s.sectionAt(lines[i])
+			hash := bytes.IndexByte(line, '#')
+			pos := Position{Line: i + 1, Col: utf8.RuneCount(line[:hash]) + 1}
+			entries = append(entries, DisabledEntry{
+				Key:      Key(section.path).Append(key...),
+				Value:    nodeValue{node: value, position: pos},
+				Position: pos,
+				start:    lines[i],
+				end:      lineEndOffset(d.src, lines[j]),
+			})
+			i = j
+			break
+		}
+	}
+	return entries
+}
+
+// Enable uncomments the first disabled entry of key, a dotted key as accepted
+// in the documents (e.g. a."b.c"), putting it in effect.
+//
+// See EnablePath for details.
+func (d *Document) Enable(key string) error {
+	keys, err := parseKey(key)
+	if err != nil {
+		return err
+	}
+	return d.EnablePath(keys)
+}
+
+// EnablePath uncomments the first disabled entry of the key at the path
+// indicated by keys, as returned by DisabledEntries. An error is returned if
+// the key is already defined, or has no disabled entry.
+func (d *Document) EnablePath(keys []string) error {
+	if d.tree.GetPath(keys) != nil {
+		return fmt.Errorf("key %s is already defined", Key(keys))
+	}
+	for _, e := range d.DisabledEntries() {
+		if !e.Key.Equal(keys) {
+			continue
+		}
+		var buf bytes.Buffer
+		buf.Write(d.src[:e.start])
+		for off := e.start; off < e.end; {
+			end := lineEndOffset(d.src, off)
+			line := d.src[off:end]
+			hash := bytes.IndexByte(line, '#')
+			buf.Write(line[:hash])
+			text, _ := uncommentLine(line)
+			buf.Write(text)
+			off = end
+		}
+		buf.Write(d.src[e.end:])
+		return d.update(buf.Bytes())
+	}
+	return fmt.Errorf("no disabled entry for key %s", Key(keys))
+}
+
+// Disable comments out the key/value pair of key, a dotted key as accepted in
+// the documents (e.g. a."b.c"), so that it is no longer in effect.
+//
+// See DisablePath for details.
+func (d *Document) Disable(key string) error {
+	keys, err := parseKey(key)
+	if err != nil {
+		return err
+	}
+	return d.DisablePath(keys)
+}
+
+// DisablePath comments out the key/value pair of the key at the path indicated
+// by keys, keeping it in the document: the # is inserted after the indentation
+// of the key, and at the start of the following lines of multi-line values.
+// The pair can be put back in effect by EnablePath. Tables, and keys of inline
+// tables, cannot be disabled.
+func (d *Document) DisablePath(keys []string) error {
+	if len(keys) == 0 {
+		return errors.New("key path cannot be empty")
+	}
+	s, err := scanDocument(d.src)
+	if err != nil {
+		return err
+	}
+	e := s.entry(keys)
+	switch {
+	case e != nil:
+	case s.containingEntry(keys) != nil:
+		return fmt.Errorf("key %s is part of an inline table and cannot be disabled", Key(keys))
+	case d.tree.GetPath(keys) != nil:
+		return fmt.Errorf("key %s is a table and cannot be disabled", Key(keys))
+	default:
+		return fmt.Errorf("no such key to disable: %s", Key(keys))
+	}
+	if e.indent == "" && e.start > 0 && d.src[e.start-1] != '\n' {
+		return fmt.Errorf("key %s does not start its line and cannot be disabled", Key(keys))
+	}
+
+	var buf bytes.Buffer
+	buf.Write(d.src[:e.start])
+	buf.WriteString(e.indent)
+	buf.WriteString("# ")
+	body := d.src[e.start+len(e.indent) : e.end]
+	for i := 0; i < len(body); i++ {
+		buf.WriteByte(body[i])
+		if body[i] == '\n' && i+1 < len(body) {
+			buf.WriteString("# ")
+		}
+	}
+	buf.Write(d.src[e.end:])
+	return d.update(buf.Bytes())
+}
+
+// Offsets of the starts of the lines of src.
+func documentLines(src []byte) []int {
+	lines := []int{0}
+	for i, c := range src {
+		if c == '\n' && i+1 < len(src) {
+			lines = append(lines, i+1)
+		}
+	}
+	return lines
+}
+
+// Offset following the line starting at off, including its newline.
+func lineEndOffset(src []byte, off int) int {
+	if i := bytes.IndexByte(src[off:], '\n'); i >= 0 {
+		return off + i + 1
+	}
+	return len(src)
+}
+
+// Return the text of a comment line, following the # and the space after it,
+// and whether the line is a comment.
+func uncommentLine(line []byte) ([]byte, bool) {
+	i := skipDocumentSpaces(line, 0)
+	if i == len(line) || line[i] != '#' {
+		return nil, false
+	}
+	text := line[i+1:]
+	if len(text) > 0 && text[0] == ' ' {
+		text = text[1:]
+	}
+	return text, true
+}
+
+// Parse the text of a disabled entry, returning its key and value if it is a
+// single key/value pair.
+func parseDisabledEntry(text []byte) ([]string, interface{}, bool) {
+	tree, err := LoadBytes(text)
+	if err != nil {
+		return nil, nil, false
+	}
+	s, err := scanDocument(text)
+	if err != nil || len(s.entries) != 1 || len(s.sections) != 1 {
+		return nil, nil, false
+	}
+	return s.entries[0].path, tree.GetPath(s.entries[0].path), true
+}
+
+// Whether the offset off is inside the value of a key/value pair, such as a
+// multi-line string.
+func (s *docScan) inValue(off int) bool {
+	for _, e := range s.entries {
+		if e.valueStart < off && off < e.valueEnd {
+			return true
+		}
+	}
+	return false
+}
+
+// The section holding the line starting at off. Comments directly above a
+// header are part of the section before it.
+func (s *docScan) sectionAt(off int) *docSection {
+	section := &s.sections[0]
+	for i := range s.sections {
+		if s.sections[i].bodyStart <= off {
+			section = &s.sections[i]
+		}
+	}
+	return section
+}
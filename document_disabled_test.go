@@ -0,0 +1,138 @@
+package toml
+
+import (
+	"testing"
+)
+
+func TestDocumentDisabledEntries(t *testing.T) {
+	doc := `# the server
+# port = 8080
+host = "example.com"
+
+[server]
+  # the timeout is in seconds
+  #timeout = 30
+  # mirrors = [
+  #   "a",
+  #   "b",
+  # ]
+# log.level = "debug"
+
+[client]
+retries = 3
+`
+	d, err := LoadDocument([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := d.DisabledEntries()
+	expected := []struct {
+		key string
+		pos string
+	}{
+		{"port", "(2, 1)"},
+		{"server.timeout", "(7, 3)"},
+		{"server.mirrors", "(8, 3)"},
+		{"server.log.level", "(12, 1)"},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d disabled entries, got %v", len(expected), entries)
+	}
+	for i, e := range expected {
+		if entries[i].Key.String() != e.key || entries[i].Position.String() != e.pos {
+			t.Errorf("entry %d: expected %s at %s, got %s at %s", i, e.key, e.pos, entries[i].Key, entries[i].Position)
+		}
+	}
+	if n, ok := entries[1].Value.AsInteger(); !ok || n != 30 {
+		t.Errorf("expected timeout 30, got %v", entries[1].Value)
+	}
+	if elements, ok := entries[2].Value.AsArray(); !ok || len(elements) != 2 {
+		t.Errorf("expected mirrors with 2 elements, got %v", entries[2].Value)
+	}
+
+	if err := d.Enable("server.mirrors"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Enable("port"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Disable("client.retries"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Disable("host"); err != nil {
+		t.Fatal(err)
+	}
+	want := `# the server
+port = 8080
+# host = "example.com"
+
+[server]
+  # the timeout is in seconds
+  #timeout = 30
+  mirrors = [
+    "a",
+    "b",
+  ]
+# log.level = "debug"
+
+[client]
+# retries = 3
+`
+	if string(d.Bytes()) != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, d.Bytes())
+	}
+	if d.Tree().Get("port") != int64(8080) || d.Tree().Has("host") || d.Tree().Has("client.retries") {
+		t.Errorf("tree not updated: %v", d.Tree())
+	}
+	if entries := d.DisabledEntries(); len(entries) != 4 || entries[0].Key.String() != "host" || entries[3].Key.String() != "client.retries" {
+		t.Errorf("unexpected disabled entries %v", entries)
+	}
+
+	// round trip of a multi-line value
+	if err := d.Disable("server.mirrors"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Enable("server.mirrors"); err != nil {
+		t.Fatal(err)
+	}
+	if string(d.Bytes()) != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, d.Bytes())
+	}
+}
+
+func TestDocumentDisableErrors(t *testing.T) {
+	doc := `a = 1
+# b = 2
+t = { x = 1 }
+
+[table]
+y = """
+# z = 3
+"""
+`
+	d, err := LoadDocument([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := d.DisabledEntries(); len(entries) != 1 || entries[0].Key.String() != "b" {
+		t.Errorf("unexpected disabled entries %v", entries)
+	}
+	for _, test := range []struct {
+		err  error
+		want string
+	}{
+		{d.Enable("a"), "key a is already defined"},
+		{d.Enable("c"), "no disabled entry for key c"},
+		{d.Enable("table.z"), "no disabled entry for key table.z"},
+		{d.Disable("t.x"), "key t.x is part of an inline table and cannot be disabled"},
+		{d.Disable("table"), "key table is a table and cannot be disabled"},
+		{d.Disable("b"), "no such key to disable: b"},
+	} {
+		if test.err == nil || test.err.Error() != test.want {
+			t.Errorf("expected error %q, got %v", test.want, test.err)
+		}
+	}
+	if string(d.Bytes()) != doc {
+		t.Errorf("document modified by failed operations:\n%s", d.Bytes())
+	}
+}
@@ -0,0 +1,236 @@
+// Syntax trees of Documents, updated incrementally.
+
+package toml
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// Syntax tree of a Document, and the offsets of the lines of its text
+// following the byte order mark, if any.
+type docSyntax struct {
+	root       *Node
+	lineStarts []int
+}
+
+// Nodes returns the syntax tree of the document, as ParseNodes. It is built
+// at the first call, and kept up to date by Reparse.
+func (d *Document) Nodes() *Node {
+	if d.syntax == nil {
+		d.syntax = buildSyntax(d.src, d.tree)
+	}
+	return d.syntax.root
+}
+
+func buildSyntax(src []byte, tree *Tree) *docSyntax {
+	body := trimBOM(src)
+	b := &nodeBuilder{src: body, tokens: lexToml(body), lineStarts: lineStarts(body), arrays: map[string]int{}}
+	defer putTokens(b.tokens)
+	return &docSyntax{root: b.document(tree), lineStarts: b.lineStarts}
+}
+
+func lineStarts(src []byte) []int {
+	starts := []int{0}
+	for i, c := range src {
+		if c == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+// Reparse replaces the bytes of the document between the offsets start and
+// end by text, as typed in an editor, and returns the updated syntax tree.
+//
+// Only the region of the document touched by the edit is lexed and parsed
+// again into nodes: the sections of the tables it overlaps, or the key/value
+// pairs preceding the first table. The nodes of the other sections are kept,
+// their positions moved in place by the number of lines added or removed,
+// and their values taken from the new document. The whole syntax tree is
+// rebuilt when the edit changes the structure of the document beyond the
+// region, such as by opening a multiline string.
+//
+// As with other modifications, an error is returned and the document is left
+// untouched if the edit would make it invalid.
+func (d *Document) Reparse(start, end int, text string) (*Node, error) {
+	bom := len(d.src) - len(trimBOM(d.src))
+	if start < bom || start > end || end > len(d.src) {
+		return nil, fmt.Errorf("invalid edit range %d-%d for a document of %d bytes", start, end, len(d.src))
+	}
+	old := d.Nodes()
+	oldLines := d.syntax.lineStarts
+	body := d.src[bom:]
+	start, end = start-bom, end-bom
+
+	var buf bytes.Buffer
+	buf.Write(d.src[:bom+start])
+	buf.WriteString(text)
+	buf.Write(body[end:])
+	src := buf.Bytes()
+	tree, err := LoadBytes(src)
+	if err != nil {
+		return nil, fmt.Errorf("modification would produce an invalid document: %s", err)
+	}
+	newBody := src[bom:]
+	d.src, d.tree = src, tree
+
+	// the sections of the document start at offset 0 and at the lines of
+	// the table headers
+	units := []int{0}
+	for _, child := range old.Children {
+		if child.Kind == NodeTable || child.Kind == NodeArrayTable {
+			units = append(units, oldLines[child.Range.Start.Line-1])
+		}
+	}
+	unitAt := func(off int) int {
+		return sort.Search(len(units), func(i int) bool { return units[i] > off }) - 1
+	}
+	first, last := unitAt(start), unitAt(start)
+	if end > start {
+		last = unitAt(end - 1)
+	}
+	delta := len(text) - (end - start)
+	for {
+		regionStart, regionEnd := units[first], len(body)
+		if last+1 < len(units) {
+			regionEnd = units[last+1]
+		}
+		region := newBody[regionStart : regionEnd+delta]
+		switch {
+		case first > 0 && startsWithKey(region):
+			// key/value pairs belong to the preceding section
+			first--
+		case last+1 < len(units) && !bytes.HasSuffix(region, []byte("\n")):
+			// the next section header is no longer at the start of a line
+			last++
+		default:
+			if _, err := LoadBytes(region); err != nil {
+				// the edit changed the meaning of the rest of the document
+				d.syntax = buildSyntax(src, tree)
+				return d.syntax.root, nil
+			}
+			d.syntax = reparseRegion(old, oldLines, newBody, tree, regionStart, regionEnd, delta, first, last)
+			return d.syntax.root, nil
+		}
+	}
+}
+
+func startsWithKey(region []byte) bool {
+	tokens := lexToml(region)
+	defer putTokens(tokens)
+	return tokens[0].typ == tokenKey
+}
+
+// Build the syntax tree of src, whose text between regionStart and regionEnd
+// in the previous version, made of the sections first to last, was changed to
+// be delta bytes longer.
+func reparseRegion(old *Node, oldLines []int, src []byte, tree *Tree, regionStart, regionEnd, delta, first, last int) *docSyntax {
+	region := src[regionStart : regionEnd+delta]
+	startLine := sort.SearchInts(oldLines, regionStart) + 1
+
+	var lines []int
+	for _, off := range oldLines {
+		if off <= regionStart {
+			lines = append(lines, off)
+		}
+	}
+	for i, c := range region {
+		if c == '\n' {
+			lines = append(lines, regionStart+i+1)
+		}
+	}
+	oldCount := len(oldLines)
+	for _, off := range oldLines {
+		if off > regionEnd {
+			lines = append(lines, off+delta)
+		}
+	}
+	lineDelta := len(lines) - oldCount
+
+	b := &nodeBuilder{src: src, tokens: lexToml(region), lineStarts: lines, arrays: map[string]int{}}
+	defer putTokens(b.tokens)
+	for i := range b.tokens {
+		b.tokens[i].Line += startLine - 1
+	}
+	root := &Node{
+		Kind:  NodeDocument,
+		Key:   Key{},
+		Value: tree.AsValue(),
+		Range: Range{Start: Position{Line: 1, Col: 1}, End: b.position(len(src))},
+	}
+
+	// top-level nodes with the index of their section
+	unit := 0
+	built := false
+	for _, child := range old.Children {
+		if child.Kind == NodeTable || child.Kind == NodeArrayTable {
+			unit++
+		}
+		switch {
+		case unit < first:
+			b.relinkSection(child, tree, 0)
+			root.Children = append(root.Children, child)
+		case unit > last:
+			if !built {
+				b.sections(tree, root)
+				built = true
+			}
+			b.relinkSection(child, tree, lineDelta)
+			root.Children = append(root.Children, child)
+		}
+	}
+	if !built {
+		b.sections(tree, root)
+	}
+	return &docSyntax{root: root, lineStarts: lines}
+}
+
+// Update a top-level node kept from a previous syntax tree: move it by lines
+// and take its values from tree.
+func (b *nodeBuilder) relinkSection(node *Node, tree *Tree, lines int) {
+	if node.Kind == NodeKeyValue {
+		relinkKeyValue(node, tree, Key{}, lines)
+		return
+	}
+	moveNode(node, lines)
+	b.countTable(node)
+	table := b.tableOf(tree, node.Key)
+	node.Value = table.AsValue()
+	for _, child := range node.Children {
+		relinkKeyValue(child, table, node.Key, lines)
+	}
+}
+
+// Update a key/value pair of the table t, whose key is prefix.
+func relinkKeyValue(node *Node, t *Tree, prefix Key, lines int) {
+	moveNode(node, lines)
+	node.Value = t.GetValuePath(node.Key[len(prefix):])
+	relinkValue(node.Children[0], node.Value, lines)
+}
+
+func relinkValue(node *Node, v Value, lines int) {
+	moveNode(node, lines)
+	node.Value = v
+	switch v.Kind() {
+	case KindArray:
+		elements, _ := v.AsArray()
+		for i, child := range node.Children {
+			relinkValue(child, elements[i], lines)
+		}
+	case KindTable:
+		table, _ := v.AsTable()
+		for _, child := range node.Children {
+			relinkKeyValue(child, table, node.Key, lines)
+		}
+	}
+}
+
+func moveNode(node *Node, lines int) {
+	for _, pos := range []*Position{&node.Range.Start, &node.Range.End, &node.KeyRange.Start, &node.KeyRange.End} {
+		if !pos.Invalid() {
+			pos.Line += lines
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package toml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDocumentReparse(t *testing.T) {
+	doc := `title = "app"
+
+[server]
+host = "localhost"
+port = 80
+
+[[routes]]
+path = "/"
+limits = { rate = 10, burst = [1, 2] }
+
+[[routes]]
+path = "/api"
+
+[routes.auth]
+user = "admin"
+`
+	edits := []struct {
+		desc string
+		old  string
+		new  string
+	}{
+		{"value", `port = 80`, `port = 8080`},
+		{"new lines", "port = 80\n", "port = 80\ntimeout = 5\n\n# retries\nretries = 3\n"},
+		{"removed lines", "host = \"localhost\"\nport = 80\n", ""},
+		{"key before a header", "\n[server]", "\nversion = 2\n[server]"},
+		{"header", "[[routes]]\npath = \"/api\"", "[[routes]]\npath = \"/api\"\n\n[[routes]]\npath = \"/static\""},
+		{"removed header", "[server]\n", ""},
+		{"joined lines", "80\n\n[[routes]]", "80"},
+		{"multiline string", `path = "/api"`, "path = \"\"\"\n[x]\n/api\"\"\""},
+		{"last line", "user = \"admin\"\n", "user = \"root\"\npassword = \"secret\""},
+	}
+	for _, e := range edits {
+		t.Run(e.desc, func(t *testing.T) {
+			d, err := LoadDocument([]byte(doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.Nodes()
+			start := strings.Index(doc, e.old)
+			root, err := d.Reparse(start, start+len(e.old), e.new)
+			if err != nil {
+				t.Fatal(err)
+			}
+			edited := doc[:start] + e.new + doc[start+len(e.old):]
+			if string(d.Bytes()) != edited {
+				t.Fatalf("unexpected document %q", d.Bytes())
+			}
+			expected, err := ParseNodes([]byte(edited))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := printNodes(root), printNodes(expected); !reflect.DeepEqual(got, want) {
+				t.Errorf("expected nodes\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+			}
+			if d.Nodes() != root {
+				t.Error("syntax tree not kept")
+			}
+		})
+	}
+}
+
+func TestDocumentReparseInvalid(t *testing.T) {
+	d, err := LoadDocument([]byte("[a]\nb = 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := d.Nodes()
+	_, err = d.Reparse(8, 9, "[")
+	assertErrorString(t, "modification would produce an invalid document: (3, 1): unterminated array", err)
+	_, err = d.Reparse(4, 20, "")
+	assertErrorString(t, "invalid edit range 4-20 for a document of 10 bytes", err)
+	if string(d.Bytes()) != "[a]\nb = 1\n" || d.Nodes() != root {
+		t.Error("document modified by an invalid edit")
+	}
+}
+
+func printNodes(root *Node) []string {
+	var lines []string
+	Walk(printingVisitor{lines: &lines}, root)
+	return lines
+}
@@ -0,0 +1,166 @@
+// Loading of invalid Documents.
+
+package toml
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// ParseError is a syntax error of a document, as reported by
+// LoadDocumentPartial.
+type ParseError struct {
+	Position Position
+	Message  string
+}
+
+func (e *ParseError) Error() string {
+	return e.Position.String() + ": " + e.Message
+}
+
+// Position prefixed to the messages of the errors of the parser.
+var parseErrorPosition = regexp.MustCompile(`^\((\d+), (\d+)\): `)
+
+func newParseError(err error) *ParseError {
+	if e, ok := err.(*DuplicateKeyError); ok {
+		return &ParseError{Position: e.Position, Message: e.Error()[len(e.Position.String())+2:]}
+	}
+	text := err.Error()
+	m := parseErrorPosition.FindStringSubmatch(text)
+	if m == nil {
+		return &ParseError{Message: text}
+	}
+	e := &ParseError{Message: text[len(m[0]):]}
+	e.Position.Line, _ = strconv.Atoi(m[1])
+	e.Position.Col, _ = strconv.Atoi(m[2])
+	return e
+}
+
+// Lines of table headers and key/value pairs, which end the values left
+// unterminated.
+var (
+	headerLine = regexp.MustCompile(`^[ \t]*\[\[?[^\[\]=#\n]*\]\]?[ \t]*(#[^\n]*)?\r?$`)
+	pairLine   = regexp.MustCompile(`^[ \t]*([A-Za-z0-9_-]+|"[^"\n]*"|'[^'\n]*')([ \t]*\.[ \t]*([A-Za-z0-9_-]+|"[^"\n]*"|'[^'\n]*'))*[ \t]*=`)
+)
+
+// LoadDocumentPartial parses b into a Document as LoadDocument, but does not
+// stop at the first syntax error: it returns the document made of the valid
+// parts of b, along with the errors found, in document order. This is meant
+// for editors, whose documents are invalid most of the time they are edited.
+//
+// The parser recovers from an error at the next line, discarding the
+// key/value pair the error is in. Values spanning several lines, such as
+// unterminated arrays, are discarded up to the next table header at the
+// latest. An invalid table header discards its whole section. The lines of
+// the discarded parts are left empty in the document, so that the positions
+// of its values are those of b.
+//
+// The errors are nil if b is a valid document.
+func LoadDocumentPartial(b []byte) (*Document, []*ParseError) {
+	body := trimBOM(b)
+	bom := b[:len(b)-len(body)]
+	src := make([]byte, len(body))
+	copy(src, body)
+
+	var errs []*ParseError
+	for {
+		tree, err := LoadBytes(src)
+		if err == nil {
+			sort.SliceStable(errs, func(i, j int) bool {
+				a, b := errs[i].Position, errs[j].Position
+				return a.Line < b.Line || a.Line == b.Line && a.Col < b.Col
+			})
+			return &Document{src: append(append([]byte{}, bom...), src...), tree: tree}, errs
+		}
+		e := newParseError(err)
+		errs = append(errs, e)
+		src = discardError(src, e.Position)
+	}
+}
+
+// Return src without the text of the statement holding the error at pos: the
+// lines of the key/value pair or of the section it is in are emptied.
+func discardError(src []byte, pos Position) []byte {
+	lines := bytes.SplitAfter(src, []byte("\n"))
+	lineStarts := make([]int, len(lines))
+	for i := 1; i < len(lines); i++ {
+		lineStarts[i] = lineStarts[i-1] + len(lines[i-1])
+	}
+	errorLine := len(lines) - 1
+	if !pos.Invalid() && pos.Line <= len(lines) {
+		errorLine = pos.Line - 1
+	}
+
+	// the statement starts at the last key/value pair or header before the
+	// error
+	first, isHeader, depth := 0, false, 0
+	tokens := lexToml(src)
+	defer putTokens(tokens)
+	for _, tok := range tokens {
+		if tok.Line-1 > errorLine {
+			break
+		}
+		switch tok.typ {
+		case tokenLeftCurlyBrace:
+			depth++
+		case tokenRightCurlyBrace:
+			depth--
+		case tokenKey:
+			if depth == 0 {
+				first, isHeader = tok.Line-1, false
+			}
+		case tokenKeyGroup, tokenKeyGroupArray:
+			first, isHeader, depth = tok.Line-1, true, 0
+		}
+	}
+	if first < errorLine && Valid(bytes.Join(lines[first:errorLine], nil)) {
+		// the error is in a statement of its own
+		first = errorLine
+		isHeader = bytes.HasPrefix(bytes.TrimLeft(lines[first], " \t"), []byte("["))
+	}
+
+	// the statement ends at the next header, or at the next key/value pair
+	// if it is not a header
+	last := errorLine
+	for i := first + 1; i <= errorLine || isHeader && i < len(lines); i++ {
+		if headerLine.Match(bytes.TrimRight(lines[i], "\n")) || !isHeader && pairLine.Match(lines[i]) {
+			last = i - 1
+			break
+		}
+		if isHeader {
+			last = i
+		}
+	}
+
+	// when nothing is left to discard in the statement, give up on the rest
+	// of the document, and then on all of it
+	for _, r := range [][2]int{{first, last}, {first, len(lines) - 1}, {0, len(lines) - 1}} {
+		discarded := false
+		var buf bytes.Buffer
+		for i, line := range lines {
+			if i >= r[0] && i <= r[1] {
+				end := lineEnding(line)
+				discarded = discarded || len(end) < len(line)
+				line = end
+			}
+			buf.Write(line)
+		}
+		if discarded {
+			return buf.Bytes()
+		}
+	}
+	return src
+}
+
+// Return the line ending of line.
+func lineEnding(line []byte) []byte {
+	switch {
+	case bytes.HasSuffix(line, []byte("\r\n")):
+		return []byte("\r\n")
+	case bytes.HasSuffix(line, []byte("\n")):
+		return []byte("\n")
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package toml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoadDocumentPartial(t *testing.T) {
+	doc := `a = 1
+b = = 2
+c = [1,
+  2
+d = "ok"
+[t
+x = 1
+[u]
+y = 3
+y = 4
+z = { w = 1
+v = 2
+`
+	d, errs := LoadDocumentPartial([]byte(doc))
+	var messages []string
+	for _, e := range errs {
+		messages = append(messages, e.Error())
+	}
+	expected := []string{
+		"(2, 5): cannot have multiple equals for the same key",
+		"(5, 1): missing comma",
+		"(6, 2): unexpected token table key cannot contain ']', was expecting a table key",
+		"(10, 1): The following key was defined twice: u.y (previously defined at (9, 1))",
+		"(11, 12): unexpected token type in inline table: newlines are not allowed in inline tables",
+	}
+	if !reflect.DeepEqual(messages, expected) {
+		t.Errorf("expected errors\n%q\ngot\n%q", expected, messages)
+	}
+	if errs[3].Position != (Position{10, 1}) {
+		t.Errorf("unexpected position %s", errs[3].Position)
+	}
+	if d.String() != "a = 1\n\n\n\nd = \"ok\"\n\n\n[u]\ny = 3\n\n\nv = 2\n" {
+		t.Errorf("unexpected document %q", d.String())
+	}
+	if pos := d.tree.GetPosition("d"); pos != (Position{5, 1}) {
+		t.Errorf("unexpected position %s of d", pos)
+	}
+	if err := d.Set("u.y", 4); err != nil {
+		t.Error(err)
+	}
+
+	d, errs = LoadDocumentPartial([]byte("a = 1\n"))
+	if errs != nil || d.String() != "a = 1\n" {
+		t.Errorf("unexpected result %q, %v for a valid document", d.String(), errs)
+	}
+	// unterminated values end at the next key/value pair
+	d, errs = LoadDocumentPartial([]byte("a = '''\nb = 1\n"))
+	if len(errs) != 1 || d.String() != "\nb = 1\n" {
+		t.Errorf("unexpected result %q, %v", d.String(), errs)
+	}
+}
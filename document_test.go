@@ -0,0 +1,170 @@
+package toml
+
+import (
+	"strings"
+	"testing"
+)
+
+const editedDoc = `# Server configuration
+title = "example"   # the title
+
+[server]
+  host = "localhost"
+  # listening port
+  port = 8080
+
+# database settings
+[database]
+ports = [ 8000,
+  8001 ]
+options = { timeout = 5, retry = true }
+
+[[users]]
+name = "a"
+
+[[users]]
+name = "b"
+`
+
+func loadEditedDoc(t *testing.T) *Document {
+	d, err := LoadDocument([]byte(editedDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func assertDocument(t *testing.T, d *Document, expected string) {
+	t.Helper()
+	if d.String() != expected {
+		t.Errorf("unexpected document:\n%s\nexpected:\n%s", d, expected)
+	}
+}
+
+func TestDocumentSetExisting(t *testing.T) {
+	d := loadEditedDoc(t)
+	if err := d.Set("server.port", 9090); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set("title", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetPath([]string{"database", "ports"}, []int{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set("users.name", "c"); err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.NewReplacer(
+		"port = 8080", "port = 9090",
+		`title = "example"`, `title = "new"`,
+		"[ 8000,\n  8001 ]", "[1, 2]",
+		`name = "b"`, `name = "c"`,
+	).Replace(editedDoc)
+	assertDocument(t, d, expected)
+	if d.Get("server.port") != int64(9090) {
+		t.Errorf("the model should be updated, got %v", d.Get("server.port"))
+	}
+}
+
+func TestDocumentSetNew(t *testing.T) {
+	d := loadEditedDoc(t)
+	if err := d.Set("server.timeout", "5s"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set("debug", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set("server.tls.enabled", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set(`cache."max size"`, 10); err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.NewReplacer(
+		"port = 8080\n", "port = 8080\n  timeout = \"5s\"\n  tls.enabled = false\n",
+		"# the title\n", "# the title\ndebug = true\n",
+	).Replace(editedDoc) + "\n[cache]\n\"max size\" = 10\n"
+	assertDocument(t, d, expected)
+}
+
+func TestDocumentSetInline(t *testing.T) {
+	d := loadEditedDoc(t)
+	if err := d.Set("database.options.timeout", 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set("database.options.name", "db"); err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Replace(editedDoc, "{ timeout = 5, retry = true }", `{ timeout = 10, retry = true, name = "db" }`, 1)
+	assertDocument(t, d, expected)
+}
+
+func TestDocumentSetErrors(t *testing.T) {
+	d := loadEditedDoc(t)
+	if err := d.Set("server", 1); err == nil || err.Error() != "key server is a table and cannot be replaced" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := d.Set("title.sub", 1); err == nil || err.Error() != "key title is not a table" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := d.SetPath(nil, 1); err == nil {
+		t.Error("empty paths should be rejected")
+	}
+	assertDocument(t, d, editedDoc)
+}
+
+func TestDocumentDelete(t *testing.T) {
+	d := loadEditedDoc(t)
+	if err := d.Delete("server.port"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete("database"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete("title"); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# Server configuration
+
+[server]
+  host = "localhost"
+  # listening port
+
+[[users]]
+name = "a"
+
+[[users]]
+name = "b"
+`
+	assertDocument(t, d, expected)
+
+	if err := d.Delete("missing"); err == nil || err.Error() != "no such key to delete" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if d.Has("database") || !d.Has("server.host") {
+		t.Error("the model should be updated")
+	}
+}
+
+func TestDocumentDeleteInline(t *testing.T) {
+	d := loadEditedDoc(t)
+	if err := d.Delete("database.options.retry"); err != nil {
+		t.Fatal(err)
+	}
+	assertDocument(t, d, strings.Replace(editedDoc, "{ timeout = 5, retry = true }", "{ timeout = 5 }", 1))
+}
+
+func TestDocumentEmpty(t *testing.T) {
+	d, err := LoadDocument(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set("a", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set("b.c", "x"); err != nil {
+		t.Fatal(err)
+	}
+	assertDocument(t, d, "a = 1\n\n[b]\nc = \"x\"\n")
+}
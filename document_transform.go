@@ -0,0 +1,113 @@
+// Transformation of the values of Documents.
+
+package toml
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"unicode/utf8"
+)
+
+// ValueOf returns v as a Value. v can be of any type accepted by TreeFromMap,
+// such as the values returned by the Interface method of Values. It is meant
+// to build the values returned to Document.Transform.
+func ValueOf(v interface{}) (Value, error) {
+	if value, ok := v.(Value); ok {
+		return value, nil
+	}
+	node, err := documentNode(v)
+	if err != nil {
+		return nil, err
+	}
+	if n, ok := node.(*tomlValue); ok {
+		return nodeValue{node: n.value}, nil
+	}
+	return nodeValue{node: node}, nil
+}
+
+// Transform calls f with the path and the value of each key/value pair of the
+// document, in document order, and replaces the values f returns in place,
+// preserving the rest of the document. This allows bulk operations, such as
+// rewriting host names or encrypting secrets, over all the values of a
+// document. Use ValueOf to build the new values.
+//
+// Returning v itself, or a value equal to it, leaves the value untouched. f is
+// not called for tables, but for each of the values of inline tables, which
+// are rewritten when one of their values changes. Arrays are passed as a
+// whole. The keys of the tables of arrays of tables have no index, f being
+// called for each table of the array in turn.
+//
+// An error returned by f is returned as is, and the document is left
+// untouched, as it is when the transformed document would not be valid.
+func (d *Document) Transform(f func(path Key, v Value) (Value, error)) error {
+	s, err := scanDocument(d.src)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	last := 0
+	for _, e := range s.entries {
+		tree, err := LoadBytes(append([]byte("value = "), d.src[e.valueStart:e.valueEnd]...))
+		if err != nil {
+			return err
+		}
+		keyStart := e.start + len(e.indent)
+		line := bytes.Count(d.src[:keyStart], []byte("\n")) + 1
+		col := utf8.RuneCount(d.src[bytes.LastIndexByte(d.src[:keyStart], '\n')+1:keyStart]) + 1
+		node, changed, err := transformNode(Key(e.path), tree.values["value"], Position{line, col}, f)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			continue
+		}
+		text, err := documentValueText(node)
+		if err != nil {
+			return err
+		}
+		buf.Write(d.src[last:e.valueStart])
+		buf.WriteString(text)
+		last = e.valueEnd
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	buf.Write(d.src[last:])
+	return d.update(buf.Bytes())
+}
+
+// Transform the node of a Tree at path, returning the new node and whether it
+// changed. Values of inline tables are transformed one by one.
+func transformNode(path Key, node interface{}, pos Position, f func(Key, Value) (Value, error)) (interface{}, bool, error) {
+	if t, ok := node.(*Tree); ok {
+		keys := t.Keys()
+		sort.SliceStable(keys, func(i, j int) bool {
+			a, b := t.GetPositionPath([]string{keys[i]}), t.GetPositionPath([]string{keys[j]})
+			return a.Line < b.Line || a.Line == b.Line && a.Col < b.Col
+		})
+		changed := false
+		for _, k := range keys {
+			n, c, err := transformNode(path.Append(k), t.values[k], pos, f)
+			if err != nil {
+				return nil, false, err
+			}
+			if c {
+				setInlineNode(t, []string{k}, n)
+				changed = true
+			}
+		}
+		return t, changed, nil
+	}
+
+	v := nodeValue{node: node, position: pos}
+	if n, ok := node.(*tomlValue); ok {
+		v.node = n.value
+	}
+	result, err := f(path.Append(), v)
+	if err != nil || result == nil || reflect.DeepEqual(result.Interface(), v.node) {
+		return node, false, err
+	}
+	n, err := documentNode(result.Interface())
+	return n, err == nil, err
+}
@@ -0,0 +1,105 @@
+package toml
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDocumentTransform(t *testing.T) {
+	doc := `# servers
+[server]
+host = "old.example.com"   # main
+port = 0x1F90
+mirrors = ["a.old.example.com", "b"]
+
+[[backends]]
+url = "http://old.example.com"
+opts = { host = "old.example.com", retries = 3 }
+
+[[backends]]
+url = "http://other"
+version = 41
+`
+	d, err := LoadDocument([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var visited []string
+	err = d.Transform(func(path Key, v Value) (Value, error) {
+		visited = append(visited, v.Position().String()+" "+path.String())
+		if s, ok := v.AsString(); ok {
+			return ValueOf(strings.Replace(s, "old.example.com", "new.example.org", -1))
+		}
+		if elements, ok := v.AsArray(); ok {
+			var hosts []string
+			for _, e := range elements {
+				s, _ := e.AsString()
+				hosts = append(hosts, strings.Replace(s, "old.example.com", "new.example.org", -1))
+			}
+			return ValueOf(hosts)
+		}
+		if n, ok := v.AsInteger(); ok && path.Equal(Key{"backends", "version"}) {
+			return ValueOf(n + 1)
+		}
+		return v, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `# servers
+[server]
+host = "new.example.org"   # main
+port = 0x1F90
+mirrors = ["a.new.example.org", "b"]
+
+[[backends]]
+url = "http://new.example.org"
+opts = { host = "new.example.org", retries = 3 }
+
+[[backends]]
+url = "http://other"
+version = 42
+`
+	if d.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, d.String())
+	}
+	expectedVisits := []string{
+		"(3, 1) server.host",
+		"(4, 1) server.port",
+		"(5, 1) server.mirrors",
+		"(8, 1) backends.url",
+		"(9, 1) backends.opts.host",
+		"(9, 1) backends.opts.retries",
+		"(12, 1) backends.url",
+		"(13, 1) backends.version",
+	}
+	if strings.Join(visited, "\n") != strings.Join(expectedVisits, "\n") {
+		t.Errorf("expected visits\n%s\ngot\n%s", strings.Join(expectedVisits, "\n"), strings.Join(visited, "\n"))
+	}
+	if d.Tree().Get("server.host") != "new.example.org" {
+		t.Errorf("tree not updated: %v", d.Tree().Get("server.host"))
+	}
+}
+
+func TestDocumentTransformErrors(t *testing.T) {
+	doc := "a = 1\nb = \"secret\"\n"
+	d, err := LoadDocument([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Transform(func(path Key, v Value) (Value, error) {
+		if path.String() == "b" {
+			return nil, errors.New("cannot encrypt b")
+		}
+		return ValueOf(2)
+	})
+	assertErrorString(t, "cannot encrypt b", err)
+	if d.String() != doc {
+		t.Errorf("document modified: %q", d.String())
+	}
+
+	if _, err := ValueOf(struct{ C chan int }{}); err == nil {
+		t.Error("expected an error for a channel")
+	}
+}
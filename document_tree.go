@@ -0,0 +1,90 @@
+// Tree API of Documents.
+
+package toml
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+// The methods below mirror those of Tree, so that code written against the
+// Tree API can move to Documents, and keep the formatting of the files it
+// edits, by replacing LoadBytes with LoadDocument, LoadReader with
+// LoadDocumentReader and TreeFromMap with DocumentFromMap. Unlike their Tree
+// counterparts, Set, SetPath, Delete and DeletePath return an error when the
+// modification would leave the document invalid.
+
+// LoadDocumentReader reads and parses a Document from r.
+func LoadDocumentReader(r io.Reader) (*Document, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return LoadDocument(b)
+}
+
+// DocumentFromMap creates a Document from a map, as TreeFromMap creates a
+// Tree.
+func DocumentFromMap(m map[string]interface{}) (*Document, error) {
+	tree, err := TreeFromMap(m)
+	if err != nil {
+		return nil, err
+	}
+	b, err := tree.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return LoadDocument(b)
+}
+
+// HasPath returns true if the given path of keys exists, false otherwise.
+func (d *Document) HasPath(keys []string) bool {
+	return d.tree.HasPath(keys)
+}
+
+// Keys returns the keys of the top-level table of the document.
+func (d *Document) Keys() []string {
+	return d.tree.Keys()
+}
+
+// GetDefault works like Get but with a default value.
+func (d *Document) GetDefault(key string, def interface{}) interface{} {
+	if v := d.Get(key); v != nil {
+		return v
+	}
+	return def
+}
+
+// GetPosition returns the position of the value at key in the document, or
+// an invalid position if it does not exist.
+func (d *Document) GetPosition(key string) Position {
+	keys, err := parseKey(key)
+	if err != nil {
+		return Position{}
+	}
+	return d.tree.GetPositionPath(keys)
+}
+
+// GetPositionPath returns the position of the value at the path indicated by
+// keys, or an invalid position if it does not exist.
+func (d *Document) GetPositionPath(keys []string) Position {
+	return d.tree.GetPositionPath(keys)
+}
+
+// ToMap recursively generates a representation of the document using Go
+// built-in structures, as Tree.ToMap.
+func (d *Document) ToMap() map[string]interface{} {
+	return d.tree.ToMap()
+}
+
+// Unmarshal decodes the document in the value pointed at by v. See Unmarshal
+// for details.
+func (d *Document) Unmarshal(v interface{}) error {
+	return d.tree.Unmarshal(v)
+}
+
+// WriteTo writes the text of the document to w.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(d.src)
+	return int64(n), err
+}
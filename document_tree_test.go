@@ -0,0 +1,70 @@
+package toml
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDocumentTreeAPI(t *testing.T) {
+	doc, err := LoadDocumentReader(strings.NewReader(`# settings
+title = "app" # the name
+
+[server]
+port = 80
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !doc.HasPath([]string{"server", "port"}) || doc.HasPath([]string{"server", "host"}) {
+		t.Error("unexpected HasPath results")
+	}
+	keys := doc.Keys()
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"server", "title"}) {
+		t.Errorf("unexpected keys %v", keys)
+	}
+	if v := doc.GetDefault("server.host", "localhost"); v != "localhost" {
+		t.Errorf("unexpected default %v", v)
+	}
+	if p := doc.GetPosition("server.port"); p.Line != 5 || p.Col != 1 {
+		t.Errorf("unexpected position %v", p)
+	}
+
+	if err := doc.Set("server.port", int64(8080)); err != nil {
+		t.Fatal(err)
+	}
+	expectedMap := map[string]interface{}{
+		"title":  "app",
+		"server": map[string]interface{}{"port": int64(8080)},
+	}
+	if m := doc.ToMap(); !reflect.DeepEqual(m, expectedMap) {
+		t.Errorf("expected %v, got %v", expectedMap, m)
+	}
+	var c struct {
+		Title  string
+		Server struct{ Port int }
+	}
+	if err := doc.Unmarshal(&c); err != nil || c.Server.Port != 8080 {
+		t.Errorf("unexpected value %+v: %v", c, err)
+	}
+	var buf bytes.Buffer
+	if _, err := doc.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "# settings\ntitle = \"app\" # the name\n\n[server]\nport = 8080\n"; buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestDocumentFromMap(t *testing.T) {
+	doc, err := DocumentFromMap(map[string]interface{}{"a": 1, "t": map[string]interface{}{"b": "c"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Get("a") != int64(1) || doc.Get("t.b") != "c" {
+		t.Errorf("unexpected document %s", doc)
+	}
+}
@@ -0,0 +1,77 @@
+// Character encodings of documents.
+
+package toml
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Check that the document b, without its byte order mark, is encoded in
+// UTF-8 as required by the specification. Documents encoded in UTF-16 or
+// UTF-32, as written by some Windows editors, are rejected with an error
+// naming their encoding rather than parsed as garbage. If latin1 is set, the
+// bytes that are not valid UTF-8 are decoded as Latin-1 (ISO 8859-1) and the
+// transcoded document is returned.
+func checkEncoding(b []byte, latin1 bool) ([]byte, error) {
+	if encoding := wideEncoding(b); encoding != "" {
+		return nil, fmt.Errorf("%s: the document is encoded in %s, only UTF-8 is supported", Position{1, 1}, encoding)
+	}
+	body := trimBOM(b)
+	if utf8.Valid(body) {
+		return b, nil
+	}
+	if latin1 {
+		transcoded := make([]byte, 0, len(b)+len(b)/8)
+		transcoded = append(transcoded, b[:len(b)-len(body)]...)
+		for len(body) > 0 {
+			r, size := utf8.DecodeRune(body)
+			if r == utf8.RuneError && size == 1 {
+				// Latin-1 characters are the first 256 code points
+				r = rune(body[0])
+			}
+			transcoded = append(transcoded, string(r)...)
+			body = body[size:]
+		}
+		return transcoded, nil
+	}
+	off := 0
+	for {
+		r, size := utf8.DecodeRune(body[off:])
+		if r == utf8.RuneError && size == 1 {
+			break
+		}
+		off += size
+	}
+	lineStart := bytes.LastIndexByte(body[:off], '\n') + 1
+	pos := Position{
+		Line: bytes.Count(body[:off], []byte("\n")) + 1,
+		Col:  utf8.RuneCount(body[lineStart:off]) + 1,
+	}
+	return nil, fmt.Errorf("%s: invalid UTF-8 byte 0x%02x", pos, body[off])
+}
+
+// Return the name of the UTF-16 or UTF-32 encoding of b, or the empty string.
+// Such documents hold null bytes, which are never valid in TOML, and their
+// encoding is given by their byte order mark or by the null bytes of their
+// first character. A byte order mark followed by text without null bytes is
+// ignored.
+func wideEncoding(b []byte) string {
+	body := trimBOM(b)
+	if bytes.IndexByte(body, 0) < 0 {
+		return ""
+	}
+	bom := b[:len(b)-len(body)]
+	switch {
+	case len(bom) == 4 && bom[0] == 0, len(body) >= 4 && body[0] == 0 && body[1] == 0 && body[2] == 0:
+		return "UTF-32BE"
+	case len(bom) == 4, len(body) >= 4 && body[0] != 0 && body[1] == 0 && body[2] == 0 && body[3] == 0:
+		return "UTF-32LE"
+	case len(bom) == 2 && bom[0] == 0xFE, len(body) >= 2 && body[0] == 0 && body[1] != 0:
+		return "UTF-16BE"
+	case len(bom) == 2, len(body) >= 2 && body[0] != 0 && body[1] == 0:
+		return "UTF-16LE"
+	}
+	return ""
+}
@@ -0,0 +1,38 @@
+package toml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckEncoding(t *testing.T) {
+	errors := map[string]string{
+		"\xFE\xFF\x00a\x00=\x001":                 "(1, 1): the document is encoded in UTF-16BE, only UTF-8 is supported",
+		"a\x00=\x001\x00":                         "(1, 1): the document is encoded in UTF-16LE, only UTF-8 is supported",
+		"\xFF\xFE\x00\x00a\x00\x00\x00":           "(1, 1): the document is encoded in UTF-32LE, only UTF-8 is supported",
+		"\x00\x00\x00a\x00\x00\x00=":              "(1, 1): the document is encoded in UTF-32BE, only UTF-8 is supported",
+		"a = 1\nb = \"caf\xe9\"\n":                "(2, 9): invalid UTF-8 byte 0xe9",
+		"\xEF\xBB\xBFa = \"é\" # \xff":            "(1, 11): invalid UTF-8 byte 0xff",
+		"a = 1\n# comment \xc3\x28 with bad pair": "(2, 11): invalid UTF-8 byte 0xc3",
+	}
+	for doc, expected := range errors {
+		_, err := LoadBytes([]byte(doc))
+		assertErrorString(t, expected, err)
+	}
+}
+
+func TestDecoderLatin1Fallback(t *testing.T) {
+	var v struct {
+		City    string
+		Country string
+	}
+	doc := "City = \"Besan\xe7on\"\nCountry = \"France \xe9t\xe9 été\"\n"
+	if err := NewDecoder(strings.NewReader(doc)).Latin1Fallback(true).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.City != "Besançon" || v.Country != "France été été" {
+		t.Errorf("unexpected values %q, %q", v.City, v.Country)
+	}
+	err := NewDecoder(strings.NewReader(doc)).Decode(&v)
+	assertErrorString(t, "(1, 14): invalid UTF-8 byte 0xe7", err)
+}
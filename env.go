@@ -0,0 +1,127 @@
+// Interpolation of environment variables in decoded strings.
+
+package toml
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ExpandEnv makes the decoder expand references to variables in the string
+// values of the document, arrays and inline tables included, before decoding
+// them. lookup returns the value of a variable and whether it is set:
+// os.LookupEnv reads the environment of the process, and tests can provide
+// their own. A nil lookup, the default, disables the expansion.
+//
+// ${NAME} is replaced with the value of NAME, and decoding fails if NAME is not
+// set. ${NAME:-default} is replaced with default when NAME is not set or is
+// empty. $${ is written for a literal ${. Keys, and $ not followed by {, are
+// left as is.
+func (d *Decoder) ExpandEnv(lookup func(name string) (string, bool)) *Decoder {
+	d.lookupEnv = lookup
+	return d
+}
+
+// Expand the variables in the strings of t.
+func expandTree(t *Tree, lookup func(string) (string, bool)) error {
+	for _, v := range t.values {
+		switch node := v.(type) {
+		case *Tree:
+			if err := expandTree(node, lookup); err != nil {
+				return err
+			}
+		case []*Tree:
+			for _, table := range node {
+				if err := expandTree(table, lookup); err != nil {
+					return err
+				}
+			}
+		case *tomlValue:
+			value, err := expandValue(node.value, lookup)
+			if err != nil {
+				return fmt.Errorf("%s: %s", node.position, err)
+			}
+			node.value = value
+		}
+	}
+	return nil
+}
+
+// Expand the variables in v if it is a string, or in its elements if it is an
+// array.
+func expandValue(v interface{}, lookup func(string) (string, bool)) (interface{}, error) {
+	switch value := v.(type) {
+	case string:
+		return expandString(value, lookup)
+	case []interface{}:
+		for i, element := range value {
+			expanded, err := expandValue(element, lookup)
+			if err != nil {
+				return nil, err
+			}
+			value[i] = expanded
+		}
+	case *Tree:
+		return value, expandTree(value, lookup)
+	}
+	return v, nil
+}
+
+func expandString(s string, lookup func(string) (string, bool)) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var sb strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			sb.WriteString(s)
+			return sb.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			// escaped: $${ is a literal ${
+			sb.WriteString(s[:i-1])
+			sb.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+		sb.WriteString(s[:i])
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated variable reference in %q", s[i:])
+		}
+		reference := s[i+2 : i+end]
+		s = s[i+end+1:]
+
+		name, def, hasDefault := reference, "", false
+		if j := strings.Index(reference, ":-"); j >= 0 {
+			name, def, hasDefault = reference[:j], reference[j+2:], true
+		}
+		if !isVariableName(name) {
+			return "", fmt.Errorf("invalid variable name %q", name)
+		}
+		value, ok := lookup(name)
+		switch {
+		case hasDefault && value == "":
+			value = def
+		case !ok:
+			return "", errors.New("environment variable " + name + " is not set")
+		}
+		sb.WriteString(value)
+	}
+}
+
+// Whether name is made of letters, digits and underscores, not starting with
+// a digit.
+func isVariableName(name string) bool {
+	if name == "" || isDigit(rune(name[0])) {
+		return false
+	}
+	for _, r := range name {
+		if !isDigit(r) && r != '_' && !('a' <= r && r <= 'z') && !('A' <= r && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package toml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testLookup(name string) (string, bool) {
+	v, ok := map[string]string{"HOST": "example.com", "PORT": "8080", "EMPTY": ""}[name]
+	return v, ok
+}
+
+func TestDecoderExpandEnv(t *testing.T) {
+	doc := `
+url = "http://${HOST}:${PORT}/"
+user = "${USER:-nobody}"
+empty = "${EMPTY:-default}"
+literal = "$${HOST} costs $5"
+bare = "$HOST"
+hosts = ["${HOST}", ["${PORT}"]]
+inline = { host = "${HOST}" }
+"${HOST}" = "key"
+
+[[servers]]
+host = "${HOST}"
+`
+	var m map[string]interface{}
+	if err := NewDecoder(strings.NewReader(doc)).ExpandEnv(testLookup).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"url":     "http://example.com:8080/",
+		"user":    "nobody",
+		"empty":   "default",
+		"literal": "${HOST} costs $5",
+		"bare":    "$HOST",
+		"hosts":   []interface{}{"example.com", []interface{}{"8080"}},
+		"inline":  map[string]interface{}{"host": "example.com"},
+		"${HOST}": "key",
+		"servers": []map[string]interface{}{{"host": "example.com"}},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("expected %v, got %v", expected, m)
+	}
+
+	// without the option, strings are kept as is
+	m = nil
+	if err := NewDecoder(strings.NewReader(doc)).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m["url"] != "http://${HOST}:${PORT}/" {
+		t.Errorf("unexpected value %v", m["url"])
+	}
+}
+
+func TestDecoderExpandEnvErrors(t *testing.T) {
+	examples := []struct {
+		doc string
+		err string
+	}{
+		{"a = 1\nb = \"${MISSING}\"", "(2, 1): environment variable MISSING is not set"},
+		{"a = [\"${HOST\"]", `(1, 1): unterminated variable reference in "${HOST"`},
+		{"a = \"${1A}\"", `(1, 1): invalid variable name "1A"`},
+		{"a = \"${}\"", `(1, 1): invalid variable name ""`},
+	}
+	for _, e := range examples {
+		var m map[string]interface{}
+		err := NewDecoder(strings.NewReader(e.doc)).ExpandEnv(testLookup).Decode(&m)
+		assertErrorString(t, e.err, err)
+	}
+}
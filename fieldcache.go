@@ -0,0 +1,272 @@
+// Caching of the options of struct fields.
+
+package toml
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A field of a struct type with its options.
+type structField struct {
+	reflect.StructField
+	opts tomlOpts
+	// keys the field is decoded from, in order of preference
+	keysToTry []string
+	// parts of a dotted name, like server.http.port, nil otherwise
+	path []string
+	// value of the default tag, or the error parsing it
+	defaultVal reflect.Value
+	defaultErr error
+	// indexes of the field and of the embedded structs it is promoted from,
+	// as for reflect.Value.FieldByIndex
+	index []int
+}
+
+// Key of the fields cache: the options of a field depend on the tag names.
+type fieldsKey struct {
+	mtype reflect.Type
+	an    annotation
+}
+
+// The fields of struct types by fieldsKey, shared by all Encoders and
+// Decoders. Entries are never removed, like encoding/json's cache: programs
+// only decode a bounded set of types.
+var fieldsCache sync.Map
+
+// Fields of the struct type mtype, with their options for the tags of an. The
+// returned slice is shared and must not be modified.
+func cachedFields(mtype reflect.Type, an annotation) []structField {
+	key := fieldsKey{mtype, an}
+	if fields, ok := fieldsCache.Load(key); ok {
+		return fields.([]structField)
+	}
+	fields := make([]structField, mtype.NumField())
+	for i := range fields {
+		f := structField{StructField: mtype.Field(i)}
+		f.opts = tomlOptions(f.StructField, an)
+		if f.opts.include && strings.Contains(f.opts.name, ".") {
+			if path, err := parseKey(f.opts.name); err == nil && len(path) > 1 {
+				f.path = path
+				f.keysToTry = []string{path[len(path)-1]}
+			} else if err == nil {
+				// a quoted key containing dots
+				f.opts.name = path[0]
+			}
+		}
+		if f.opts.include && f.path == nil {
+			baseKey := f.opts.name
+			f.keysToTry = []string{
+				baseKey,
+				strings.ToLower(baseKey),
+				strings.ToTitle(baseKey),
+				strings.ToLower(string(baseKey[0])) + baseKey[1:],
+			}
+		}
+		if f.opts.defaultValue != "" {
+			f.defaultVal, f.defaultErr = parseDefaultValue(f.Type, f.opts.defaultValue)
+		}
+		f.index = []int{i}
+		fields[i] = f
+	}
+	// concurrent callers may both compute the fields: keep the first ones
+	actual, _ := fieldsCache.LoadOrStore(key, fields)
+	return actual.([]structField)
+}
+
+// Key of the promoted fields cache.
+type promotedKey fieldsKey
+
+// Fields of a struct type and of its embedded structs.
+type promoted struct {
+	fields []structField
+	// fields hidden by fields of the same name, which only get their default
+	// value
+	hidden []structField
+}
+
+// Fields of the struct type mtype with the fields of its embedded structs
+// promoted, following the rules of encoding/json: the exported fields of
+// embedded structs and pointers to structs without a name in their tag,
+// including unexported struct types, are fields of mtype. When several fields
+// have the same name, the least nested one is used, or else the one named by
+// a tag if there is only one, and otherwise none of them. Fields are in the
+// order of their declaration. The returned slices are shared and must not be
+// modified.
+func promotedFields(mtype reflect.Type, an annotation) promoted {
+	key := promotedKey{mtype, an}
+	if p, ok := fieldsCache.Load(key); ok {
+		return p.(promoted)
+	}
+
+	type embedded struct {
+		mtype reflect.Type
+		index []int
+	}
+	var fields []structField
+	current, visited := []embedded{{mtype: mtype}}, map[reflect.Type]bool{}
+	for len(current) > 0 {
+		var next []embedded
+		// types embedded at lower depths are hidden, and types embedded
+		// several times at the same depth have conflicting fields
+		level := map[reflect.Type]bool{}
+		for _, e := range current {
+			if visited[e.mtype] {
+				continue
+			}
+			level[e.mtype] = true
+			for _, f := range cachedFields(e.mtype, an) {
+				f.index = append(append([]int(nil), e.index...), f.Index[0])
+				if f.Anonymous && !f.opts.nameFromTag && isPromoted(f.StructField, an) {
+					next = append(next, embedded{mtype: derefType(f.Type), index: f.index})
+					continue
+				}
+				if f.opts.include {
+					fields = append(fields, f)
+				}
+			}
+		}
+		for t := range level {
+			visited[t] = true
+		}
+		current = next
+	}
+
+	// keep the dominant field of each name
+	sort.SliceStable(fields, func(i, j int) bool {
+		if fields[i].opts.name != fields[j].opts.name {
+			return fields[i].opts.name < fields[j].opts.name
+		}
+		return len(fields[i].index) < len(fields[j].index)
+	})
+	var p promoted
+	for i := 0; i < len(fields); {
+		j := i + 1
+		for j < len(fields) && fields[j].opts.name == fields[i].opts.name {
+			j++
+		}
+		d := dominantField(fields[i:j])
+		for k := i; k < j; k++ {
+			if k-i == d {
+				p.fields = append(p.fields, fields[k])
+			} else if fields[k].opts.defaultValue != "" {
+				p.hidden = append(p.hidden, fields[k])
+			}
+		}
+		i = j
+	}
+	sortByIndex(p.fields)
+	sortByIndex(p.hidden)
+
+	actual, _ := fieldsCache.LoadOrStore(key, p)
+	return actual.(promoted)
+}
+
+func sortByIndex(fields []structField) {
+	sort.Slice(fields, func(i, j int) bool {
+		a, b := fields[i].index, fields[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+}
+
+// Whether the fields of an embedded struct field are promoted: it is a struct
+// or a pointer to a struct, not excluded by its tag.
+func isPromoted(f reflect.StructField, an annotation) bool {
+	mtype := derefType(f.Type)
+	if mtype.Kind() != reflect.Struct || isPrimitive(mtype) || mtype == reflect.TypeOf(Tree{}) ||
+		isCustomMarshaler(f.Type) || isTextMarshaler(f.Type) {
+		return false
+	}
+	tag, ok := f.Tag.Lookup(an.tag)
+	if !ok && an.fallbackTag != "" {
+		tag = f.Tag.Get(an.fallbackTag)
+	}
+	return tag != "-"
+}
+
+// Index of the field used among fields of the same name, sorted by depth, or
+// -1 if none is.
+func dominantField(fields []structField) int {
+	if len(fields) == 1 || len(fields[0].index) < len(fields[1].index) {
+		return 0
+	}
+	tagged := -1
+	for i := 0; i < len(fields) && len(fields[i].index) == len(fields[0].index); i++ {
+		if fields[i].opts.nameFromTag {
+			if tagged >= 0 {
+				return -1
+			}
+			tagged = i
+		}
+	}
+	return tagged
+}
+
+// Field of the struct mval at index. Nil pointers to embedded structs on the
+// way are allocated if alloc is set, and otherwise an invalid value is
+// returned.
+func fieldByIndex(mval reflect.Value, index []int, alloc bool) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && mval.Kind() == reflect.Ptr {
+			if mval.IsNil() {
+				if !alloc {
+					return reflect.Value{}, nil
+				}
+				if !mval.CanSet() {
+					return reflect.Value{}, fmt.Errorf("cannot set embedded pointer to unexported struct type %v", mval.Type().Elem())
+				}
+				mval.Set(reflect.New(mval.Type().Elem()))
+			}
+			mval = mval.Elem()
+		}
+		mval = mval.Field(x)
+	}
+	return mval, nil
+}
+
+// Keys of tval matching the name of the field at index i of fields ignoring
+// case, that are not decoded into another field: keys matching a name exactly
+// belong to that field, and keys matching several names ignoring case to the
+// first field named by a tag, or else to the first field.
+func foldedKeys(fields []structField, i int, tval *Tree) []string {
+	var keys []string
+	for _, key := range tval.Keys() {
+		if strings.EqualFold(key, fields[i].opts.name) && foldedField(fields, key) == i {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Index of the field a key is decoded into when keys are matched ignoring
+// case, or -1.
+func foldedField(fields []structField, key string) int {
+	for i, f := range fields {
+		for _, k := range f.keysToTry {
+			if k == key {
+				return i
+			}
+		}
+	}
+	match := -1
+	for i, f := range fields {
+		if !f.opts.include || !strings.EqualFold(key, f.opts.name) {
+			continue
+		}
+		if f.opts.nameFromTag {
+			return i
+		}
+		if match < 0 {
+			match = i
+		}
+	}
+	return match
+}
@@ -0,0 +1,53 @@
+package toml
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+type cachedFieldsConfig struct {
+	Name    string `toml:"name" alt:"title"`
+	Port    int    `toml:"port" alt:"listen" default:"80"`
+	Servers []struct {
+		Host string `toml:"host" alt:"address"`
+	} `toml:"servers" alt:"backends"`
+}
+
+func TestUnmarshalConcurrently(t *testing.T) {
+	docs := map[string]string{
+		"toml": "name = \"a\"\n[[servers]]\nhost = \"h\"\n",
+		"alt":  "title = \"a\"\n[[backends]]\naddress = \"h\"\n",
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tag := "toml"
+			if i%2 == 1 {
+				tag = "alt"
+			}
+			var c cachedFieldsConfig
+			if err := NewDecoder(strings.NewReader(docs[tag])).SetTagName(tag).Decode(&c); err != nil {
+				t.Error(err)
+				return
+			}
+			if c.Name != "a" || c.Port != 80 || len(c.Servers) != 1 || c.Servers[0].Host != "h" {
+				t.Errorf("unexpected result with tag %s: %+v", tag, c)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	doc := []byte("name = \"a\"\nport = 8080\n[[servers]]\nhost = \"h1\"\n[[servers]]\nhost = \"h2\"\n")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var c cachedFieldsConfig
+		if err := Unmarshal(doc, &c); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Reading and writing files.
+
+package toml
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// DecodeFile reads the TOML document in the file at path and decodes it into
+// the value pointed at by v, like Unmarshal.
+func DecodeFile(path string, v interface{}) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return NewDecoder(file).Decode(v)
+}
+
+// MarshalFile writes the TOML encoding of v to the file at path with
+// WriteFile.
+func MarshalFile(path string, v interface{}, perm os.FileMode) error {
+	b, err := Marshal(v)
+	if err != nil {
+		return err
+	}
+	return WriteFile(path, b, perm)
+}
+
+// EditFile loads the file at path as a Document, calls edit with it and
+// writes the edited document back with WriteFile, keeping the permissions of
+// the file. Comments and layout of the parts of the file that are not changed
+// are preserved. The file is left untouched if edit returns an error, which
+// EditFile then returns, or if the document was not modified.
+func EditFile(path string, edit func(*Document) error) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	doc, err := LoadDocument(b)
+	if err != nil {
+		return err
+	}
+	if err := edit(doc); err != nil {
+		return err
+	}
+	if bytes.Equal(doc.src, b) {
+		return nil
+	}
+	return WriteFile(path, doc.src, info.Mode().Perm())
+}
+
+// WriteFile writes data to the file at path, creating it with permissions perm
+// if needed. The data is written to a temporary file of the same directory,
+// which then replaces the file, so that readers never see a partially written
+// file and the file is left unchanged if writing fails. A file replaced this
+// way gets the permissions perm.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	// the temporary file is removed unless it was renamed
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
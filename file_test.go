@@ -0,0 +1,118 @@
+package toml
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileHelpers(t *testing.T) {
+	type config struct {
+		Name string `toml:"name"`
+		Port int    `toml:"port"`
+	}
+	dir, err := ioutil.TempDir("", "toml-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.toml")
+
+	if err := MarshalFile(path, config{Name: "a", Port: 80}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected permissions 0600, got %v", info.Mode().Perm())
+	}
+
+	var c config
+	if err := DecodeFile(path, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c != (config{Name: "a", Port: 80}) {
+		t.Errorf("unexpected config %+v", c)
+	}
+
+	// a failed write leaves the file and the directory unchanged
+	if err := MarshalFile(path, 42, 0644); err == nil {
+		t.Error("expected an error")
+	}
+	if err := WriteFile(filepath.Join(dir, "missing", "config.toml"), []byte("a = 1"), 0644); err == nil {
+		t.Error("expected an error")
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "name = \"a\"\nport = 80\n" {
+		t.Errorf("unexpected content %q", b)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("temporary files should be removed, got %d files", len(files))
+	}
+
+	if err := DecodeFile(filepath.Join(dir, "missing.toml"), &c); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+	if err := WriteFile(path, []byte("name = "), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assertErrorString(t, "(1, 8): expecting a value", DecodeFile(path, &c))
+}
+
+func TestEditFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "toml-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.toml")
+	if err := WriteFile(path, []byte("# settings\nname = \"a\" # the name\n\n[server]\nport = 80\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	err = EditFile(path, func(doc *Document) error {
+		if err := doc.Set("server.port", int64(8080)); err != nil {
+			return err
+		}
+		return doc.Set("server.host", "localhost")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "# settings\nname = \"a\" # the name\n\n[server]\nport = 8080\nhost = \"localhost\"\n"
+	if string(b) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, b)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("permissions should be kept, got %v, %v", info.Mode().Perm(), err)
+	}
+
+	// an error of the callback leaves the file untouched
+	err = EditFile(path, func(doc *Document) error {
+		doc.Set("name", "b")
+		return errors.New("abort")
+	})
+	assertErrorString(t, "abort", err)
+	if b, _ := ioutil.ReadFile(path); string(b) != expected {
+		t.Errorf("file should be unchanged, got:\n%s", b)
+	}
+
+	if err := EditFile(filepath.Join(dir, "missing.toml"), func(*Document) error { return nil }); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+}
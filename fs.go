@@ -0,0 +1,18 @@
+//go:build go1.16
+// +build go1.16
+
+package toml
+
+import "io/fs"
+
+// DecodeFS reads the TOML document at name in fsys and decodes it into the
+// value pointed at by v, like Unmarshal. With an embed.FS, programs can decode
+// default configurations embedded in their binary.
+func DecodeFS(fsys fs.FS, name string, v interface{}) error {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return NewDecoder(file).Decode(v)
+}
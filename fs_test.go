@@ -0,0 +1,26 @@
+//go:build go1.16
+// +build go1.16
+
+package toml
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestDecodeFS(t *testing.T) {
+	fsys := fstest.MapFS{"config/default.toml": {Data: []byte("name = \"default\"\nport = 80\n")}}
+	var c struct {
+		Name string
+		Port int
+	}
+	if err := DecodeFS(fsys, "config/default.toml", &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "default" || c.Port != 80 {
+		t.Errorf("unexpected config %+v", c)
+	}
+	if err := DecodeFS(fsys, "config/missing.toml", &c); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,120 @@
+//go:build go1.18
+// +build go1.18
+
+package toml
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Run the fuzz targets with:
+//
+//	go test -run=NONE -fuzz=FuzzUnmarshal
+//
+// Without -fuzz, the targets run on their seed corpus only.
+
+// Add the documents of the repository and a few edge cases to the corpus.
+func addSeeds(f *testing.F) {
+	files, err := filepath.Glob("*.toml")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	for _, doc := range []string{
+		"",
+		"a = 1",
+		"a = [1, [2.5, 'b'], {c = 1979-05-27T07:32:00Z}]",
+		"[[a.b]]\nc = \"\"\"\nd\\\n  e\"\"\"\n[a]\n",
+		"a.'b c'.\"d\" = -inf\nb = 0x_1",
+		"a = \"\\uD800\"",
+		"[a\n",
+	} {
+		f.Add([]byte(doc))
+	}
+}
+
+// Fail if fn does not return within a few seconds, to catch infinite loops.
+func withTimeout(t *testing.T, fn func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out")
+	}
+}
+
+func FuzzLexer(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		withTimeout(t, func() {
+			tokens := lexToml(b)
+			defer putTokens(tokens)
+			if len(tokens) == 0 {
+				t.Fatal("no token")
+			}
+			if last := tokens[len(tokens)-1].typ; last != tokenEOF && last != tokenError {
+				t.Fatalf("last token is %s, expected EOF or an error", last)
+			}
+		})
+	})
+}
+
+func FuzzParser(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		withTimeout(t, func() {
+			tree, err := LoadBytes(b)
+			if err != nil && tree != nil {
+				t.Fatalf("tree must be nil if there is an error, got %v", tree)
+			}
+		})
+	})
+}
+
+func FuzzUnmarshal(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		withTimeout(t, func() {
+			if err := roundTrip(b); err != nil {
+				t.Fatal(err)
+			}
+		})
+	})
+}
+
+// Check that the values of a document are the same after being encoded and
+// decoded again: Unmarshal, Marshal, and Unmarshal. Invalid documents are
+// ignored.
+func roundTrip(b []byte) error {
+	var first map[string]interface{}
+	if err := Unmarshal(b, &first); err != nil {
+		return nil
+	}
+	encoded, err := Marshal(first)
+	if err != nil {
+		return fmt.Errorf("cannot encode %v: %s", first, err)
+	}
+	var second map[string]interface{}
+	if err := Unmarshal(encoded, &second); err != nil {
+		return fmt.Errorf("cannot decode the encoded document: %s\n%s", err, encoded)
+	}
+	// maps are printed sorted, and NaN floats are equal once printed
+	if expected, actual := fmt.Sprintf("%#v", first), fmt.Sprintf("%#v", second); expected != actual {
+		return fmt.Errorf("values differ after a round trip:\n%s\n%s\nencoded as:\n%s", expected, actual, encoded)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+//go:build go1.18
+// +build go1.18
+
+// Typed accessors.
+
+package toml
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Getter is the read API shared by Tree and Document, used by Get and GetOr.
+type Getter interface {
+	GetPath(keys []string) interface{}
+	GetPositionPath(keys []string) Position
+}
+
+// Get returns the value at key in doc converted to T, as Unmarshal would
+// decode it into a field of type T: integers are converted to any integer or
+// float type they fit in, tables to structs and maps, arrays to slices, and
+// types implementing encoding.TextUnmarshaler are decoded from strings. Key
+// is a dotted key, as accepted in the documents (e.g. a."b.c").
+//
+// An error is returned if key is invalid, does not exist, or if its value
+// cannot be converted to T.
+func Get[T any](doc Getter, key string) (T, error) {
+	var zero T
+	keys, err := parseKey(key)
+	if err != nil {
+		return zero, err
+	}
+	value := doc.GetPath(keys)
+	if value == nil {
+		return zero, fmt.Errorf("key %s not found", Key(keys))
+	}
+	if v, ok := value.(T); ok {
+		return v, nil
+	}
+
+	d := &Decoder{tagName: tagFieldName, path: Key(keys).Append()}
+	mval := reflect.New(reflect.TypeOf(&zero).Elem()).Elem()
+	val, err := d.valueFromToml(mval.Type(), value, &mval)
+	if err == nil && len(d.missing) > 0 {
+		err = &MissingKeysError{Keys: d.missing}
+	}
+	if err != nil {
+		return zero, &DecodeError{Key: Key(keys), Position: doc.GetPositionPath(keys), Err: err}
+	}
+	mval.Set(val)
+	return *mval.Addr().Interface().(*T), nil
+}
+
+// GetOr returns the value at key in doc converted to T, as Get, or fallback if
+// the key does not exist or its value cannot be converted.
+func GetOr[T any](doc Getter, key string, fallback T) T {
+	v, err := Get[T](doc, key)
+	if err != nil {
+		return fallback
+	}
+	return v
+}
@@ -0,0 +1,69 @@
+//go:build go1.18
+// +build go1.18
+
+package toml
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGet(t *testing.T) {
+	doc, err := LoadDocument([]byte(`title = "app"
+timeout = "5s"
+
+[server]
+port = 8080
+hosts = ["a", "b"]
+"dotted.key" = 1.5
+
+[server.tls]
+cert = "cert.pem"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if title, err := Get[string](doc, "title"); err != nil || title != "app" {
+		t.Errorf("unexpected title %q, %v", title, err)
+	}
+	if port, err := Get[uint16](doc, "server.port"); err != nil || port != 8080 {
+		t.Errorf("unexpected port %d, %v", port, err)
+	}
+	if timeout, err := Get[time.Duration](doc, "timeout"); err != nil || timeout != 5*time.Second {
+		t.Errorf("unexpected timeout %v, %v", timeout, err)
+	}
+	if hosts, err := Get[[]string](doc, "server.hosts"); err != nil || !reflect.DeepEqual(hosts, []string{"a", "b"}) {
+		t.Errorf("unexpected hosts %v, %v", hosts, err)
+	}
+	if f, err := Get[float64](doc.Tree(), `server."dotted.key"`); err != nil || f != 1.5 {
+		t.Errorf("unexpected float %v, %v", f, err)
+	}
+	type tls struct {
+		Cert string `toml:"cert"`
+	}
+	if v, err := Get[tls](doc, "server.tls"); err != nil || v.Cert != "cert.pem" {
+		t.Errorf("unexpected table %+v, %v", v, err)
+	}
+	if v, err := Get[interface{}](doc, "server.port"); err != nil || v != int64(8080) {
+		t.Errorf("unexpected value %#v, %v", v, err)
+	}
+
+	_, err = Get[int](doc, "server.host")
+	assertErrorString(t, "key server.host not found", err)
+	_, err = Get[int](doc, "title")
+	assertErrorString(t, "(1, 1): title: Can't convert app(string) to int", err)
+	_, err = Get[int8](doc, "server.port")
+	assertErrorString(t, "(5, 1): server.port: 8080(int64) would overflow int8", err)
+
+	if port := GetOr(doc, "server.port", 80); port != 8080 {
+		t.Errorf("unexpected port %d", port)
+	}
+	if host := GetOr(doc, "server.host", "localhost"); host != "localhost" {
+		t.Errorf("unexpected host %q", host)
+	}
+	if n := GetOr(doc, "title", 1); n != 1 {
+		t.Errorf("unexpected fallback %d", n)
+	}
+}
@@ -0,0 +1,287 @@
+// Classified tokens for syntax highlighting.
+
+package toml
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// TokenClass is the class of a Token, as shown by syntax highlighters.
+type TokenClass int
+
+// Classes of tokens.
+const (
+	// TokenInvalid is text that is not valid TOML, such as an unterminated
+	// string or a value that is neither a number nor a date-time.
+	TokenInvalid TokenClass = iota
+	TokenKey
+	TokenString
+	TokenNumber
+	TokenBool
+	TokenDateTime
+	TokenComment
+	// TokenPunctuation is the brackets of table headers, arrays and inline
+	// tables, the dots of dotted keys, equal signs and commas.
+	TokenPunctuation
+)
+
+var tokenClassNames = [...]string{
+	TokenInvalid:     "invalid",
+	TokenKey:         "key",
+	TokenString:      "string",
+	TokenNumber:      "number",
+	TokenBool:        "bool",
+	TokenDateTime:    "date-time",
+	TokenComment:     "comment",
+	TokenPunctuation: "punctuation",
+}
+
+func (c TokenClass) String() string {
+	if c < 0 || int(c) >= len(tokenClassNames) {
+		return "unknown"
+	}
+	return tokenClassNames[c]
+}
+
+// Token is a classified part of a document, between the byte offsets Start
+// and End.
+type Token struct {
+	Class      TokenClass
+	Start, End int
+}
+
+// Tokenize splits doc into classified tokens, for syntax highlighters and diff
+// viewers. Whitespace is not part of any token, while the text of comments
+// is.
+//
+// Contrary to the parser, Tokenize does not stop at errors: invalid text is
+// returned as TokenInvalid tokens, and the following lines are classified as
+// well as possible. Keys are recognized at the start of lines, after the
+// opening bracket of table headers and inside inline tables, and values after
+// equal signs and in arrays, so that a document being edited keeps most of
+// its highlighting.
+func Tokenize(doc []byte) []Token {
+	h := &highlighter{src: doc}
+	h.run()
+	return h.tokens
+}
+
+// Expected elements of the document.
+const (
+	expectKey = iota
+	expectValue
+	expectSeparator // comma or closing bracket after a value
+)
+
+// Containers of the elements being read.
+const (
+	inHeader = iota
+	inArray
+	inInlineTable
+)
+
+type highlighter struct {
+	src    []byte
+	tokens []Token
+	expect int
+	stack  []int
+}
+
+var (
+	highlightNumber   = regexp.MustCompile(`^[+-]?(inf|nan|0x[0-9A-Fa-f_]+|0o[0-7_]+|0b[01_]+|[0-9][0-9_]*(\.[0-9_]+)?([eE][+-]?[0-9_]+)?)$`)
+	highlightDateTime = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}([Tt ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?([Zz]|[+-]\d{2}:\d{2})?)?|\d{2}:\d{2}(:\d{2}(\.\d+)?)?)$`)
+	highlightDate     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	// lines of key/value pairs, which end unterminated arrays
+	highlightPair = regexp.MustCompile(`^[ \t]*[A-Za-z0-9_-]+[ \t]*=`)
+)
+
+func (h *highlighter) emit(class TokenClass, start, end int) int {
+	h.tokens = append(h.tokens, Token{Class: class, Start: start, End: end})
+	return end
+}
+
+func (h *highlighter) top() int {
+	if len(h.stack) == 0 {
+		return -1
+	}
+	return h.stack[len(h.stack)-1]
+}
+
+func (h *highlighter) run() {
+	src := h.src
+	i := len(src) - len(trimBOM(src))
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '\n':
+			i++
+			h.newline(i)
+		case c == '#':
+			end := bytes.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src)
+			} else {
+				end += i
+				if src[end-1] == '\r' {
+					end--
+				}
+			}
+			i = h.emit(TokenComment, i, end)
+		case h.expect == expectKey:
+			i = h.key(i)
+		case h.expect == expectValue:
+			i = h.value(i)
+		default:
+			i = h.separator(i)
+		}
+	}
+}
+
+// Update the state at the start of the line at i: key/value pairs and
+// headers end, as do inline tables, which cannot span several lines. Arrays
+// end at lines that look like key/value pairs.
+func (h *highlighter) newline(i int) {
+	if t := h.top(); t == inArray && !highlightPair.Match(h.src[i:]) {
+		return
+	}
+	h.stack = h.stack[:0]
+	h.expect = expectKey
+}
+
+func (h *highlighter) key(i int) int {
+	src := h.src
+	switch c := src[i]; {
+	case c == '[' && len(h.stack) == 0:
+		end := i + 1
+		if end < len(src) && src[end] == '[' {
+			end++
+		}
+		h.stack = append(h.stack, inHeader)
+		return h.emit(TokenPunctuation, i, end)
+	case c == ']' && h.top() == inHeader:
+		end := i + 1
+		if end < len(src) && src[end] == ']' {
+			end++
+		}
+		h.stack = h.stack[:len(h.stack)-1]
+		h.expect = expectSeparator
+		return h.emit(TokenPunctuation, i, end)
+	case c == '}' && h.top() == inInlineTable:
+		h.stack = h.stack[:len(h.stack)-1]
+		h.expect = expectSeparator
+		return h.emit(TokenPunctuation, i, i+1)
+	case c == '.':
+		return h.emit(TokenPunctuation, i, i+1)
+	case c == '=' && h.top() != inHeader:
+		h.expect = expectValue
+		return h.emit(TokenPunctuation, i, i+1)
+	case c == '"' || c == '\'':
+		end, ok := highlightString(src, i)
+		if !ok || end-i >= 6 && bytes.HasPrefix(src[i:], []byte{c, c, c}) {
+			// multiline strings cannot be keys
+			return h.emit(TokenInvalid, i, end)
+		}
+		return h.emit(TokenKey, i, end)
+	case isValidBareChar(rune(c)):
+		end := i
+		for end < len(src) && isValidBareChar(rune(src[end])) {
+			end++
+		}
+		return h.emit(TokenKey, i, end)
+	}
+	return h.emit(TokenInvalid, i, h.word(i))
+}
+
+func (h *highlighter) value(i int) int {
+	src := h.src
+	switch c := src[i]; c {
+	case '"', '\'':
+		end, ok := highlightString(src, i)
+		if !ok {
+			return h.emit(TokenInvalid, i, end)
+		}
+		h.expect = expectSeparator
+		return h.emit(TokenString, i, end)
+	case '[':
+		h.stack = append(h.stack, inArray)
+		return h.emit(TokenPunctuation, i, i+1)
+	case '{':
+		h.stack = append(h.stack, inInlineTable)
+		h.expect = expectKey
+		return h.emit(TokenPunctuation, i, i+1)
+	case ']':
+		// empty array, or trailing comma
+		if h.top() == inArray {
+			return h.separator(i)
+		}
+	}
+
+	end := h.word(i)
+	if highlightDate.Match(src[i:end]) && end+3 < len(src) && src[end] == ' ' && isDigit(rune(src[end+1])) && isDigit(rune(src[end+2])) && src[end+3] == ':' {
+		// date and time separated by a space
+		end = h.word(end + 1)
+	}
+	h.expect = expectSeparator
+	switch word := src[i:end]; {
+	case string(word) == "true" || string(word) == "false":
+		return h.emit(TokenBool, i, end)
+	case highlightNumber.Match(word):
+		return h.emit(TokenNumber, i, end)
+	case highlightDateTime.Match(word):
+		return h.emit(TokenDateTime, i, end)
+	}
+	return h.emit(TokenInvalid, i, end)
+}
+
+func (h *highlighter) separator(i int) int {
+	switch c := h.src[i]; {
+	case c == ',' && h.top() == inArray:
+		h.expect = expectValue
+		return h.emit(TokenPunctuation, i, i+1)
+	case c == ',' && h.top() == inInlineTable:
+		h.expect = expectKey
+		return h.emit(TokenPunctuation, i, i+1)
+	case c == ']' && h.top() == inArray, c == '}' && h.top() == inInlineTable:
+		h.stack = h.stack[:len(h.stack)-1]
+		h.expect = expectSeparator
+		return h.emit(TokenPunctuation, i, i+1)
+	}
+	return h.emit(TokenInvalid, i, h.word(i))
+}
+
+// Return the end of the word starting at i, made of at least one byte.
+func (h *highlighter) word(i int) int {
+	end := i + 1
+	for end < len(h.src) && !bytes.ContainsAny(h.src[end:end+1], " \t\r\n#,=[]{}") {
+		end++
+	}
+	return end
+}
+
+// Return the end of the string starting at i, and whether it is terminated.
+// Unterminated strings end with their line, or with the document for
+// multiline strings.
+func highlightString(src []byte, i int) (int, bool) {
+	if bytes.HasPrefix(src[i:], []byte(`"""`)) || bytes.HasPrefix(src[i:], []byte(`'''`)) {
+		end := skipDocumentValue(src, i)
+		closed := end-i >= 6 && bytes.HasSuffix(src[i:end], src[i:i+3])
+		return end, closed
+	}
+	for j := i + 1; j < len(src); j++ {
+		switch {
+		case src[i] == '"' && src[j] == '\\' && j+1 < len(src) && src[j+1] != '\n':
+			j++
+		case src[j] == src[i]:
+			return j + 1, true
+		case src[j] == '\n':
+			if src[j-1] == '\r' {
+				j--
+			}
+			return j, false
+		}
+	}
+	return len(src), false
+}
@@ -0,0 +1,67 @@
+package toml
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Classes and texts of the tokens of doc.
+func highlightTokens(doc string) []string {
+	var tokens []string
+	for _, tok := range Tokenize([]byte(doc)) {
+		tokens = append(tokens, tok.Class.String()+" "+doc[tok.Start:tok.End])
+	}
+	return tokens
+}
+
+func TestTokenize(t *testing.T) {
+	doc := "\ufeff# config\r\n" + `title = "a \"b\"" # comment
+"quoted".bare-key = 'x'
+[[servers . "main"]]
+ports = [ 80, +0x1F, 1_000.5e-3,
+  inf, ]
+when = { at = 1979-05-27 07:32:00Z, day = 1979-05-27, t = 07:32:00.5 }
+flag = true
+text = """
+[not a table]"""
+`
+	expected := []string{
+		"comment # config",
+		"key title", "punctuation =", `string "a \"b\""`, "comment # comment",
+		`key "quoted"`, "punctuation .", "key bare-key", "punctuation =", "string 'x'",
+		"punctuation [[", "key servers", "punctuation .", `key "main"`, "punctuation ]]",
+		"key ports", "punctuation =", "punctuation [", "number 80", "punctuation ,", "number +0x1F", "punctuation ,", "number 1_000.5e-3", "punctuation ,",
+		"number inf", "punctuation ,", "punctuation ]",
+		"key when", "punctuation =", "punctuation {",
+		"key at", "punctuation =", "date-time 1979-05-27 07:32:00Z", "punctuation ,",
+		"key day", "punctuation =", "date-time 1979-05-27", "punctuation ,",
+		"key t", "punctuation =", "date-time 07:32:00.5", "punctuation }",
+		"key flag", "punctuation =", "bool true",
+		"key text", "punctuation =", "string \"\"\"\n[not a table]\"\"\"",
+	}
+	if got := highlightTokens(doc); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected tokens\n%q\ngot\n%q", expected, got)
+	}
+}
+
+func TestTokenizeInvalid(t *testing.T) {
+	doc := `a = "unterminated
+b = 1 2
+c = [1, 2
+d = { e = 1
+[t
+f = nope
+g = '''open`
+	expected := []string{
+		"key a", "punctuation =", `invalid "unterminated`,
+		"key b", "punctuation =", "number 1", "invalid 2",
+		"key c", "punctuation =", "punctuation [", "number 1", "punctuation ,", "number 2",
+		"key d", "punctuation =", "punctuation {", "key e", "punctuation =", "number 1",
+		"punctuation [", "key t",
+		"key f", "punctuation =", "invalid nope",
+		"key g", "punctuation =", "invalid '''open",
+	}
+	if got := highlightTokens(doc); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected tokens\n%q\ngot\n%q", expected, got)
+	}
+}
@@ -0,0 +1,122 @@
+//go:build go1.16
+// +build go1.16
+
+// Composition of documents from several files.
+
+package toml
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// LoadWithIncludes parses the document at name in fsys, composing it with the
+// documents named by the values of key in its tables. The value of key is a
+// path, or an array of paths, relative to the directory of the document
+// holding it, such as:
+//
+//   include = ["defaults.toml", "../shared/logging.toml"]
+//
+// The included documents are merged in order into the table holding key, as
+// by Merge, and the values of the table itself override theirs. key is removed
+// from the result. Included documents can include others, and cycles are
+// reported as errors. The names of the documents are the sources of their
+// values, as reported by GetSource.
+func LoadWithIncludes(fsys fs.FS, name, key string) (*Tree, error) {
+	return loadIncluded(fsys, name, key, nil)
+}
+
+// Includes makes the decoder compose the document it reads with the documents
+// of fsys named by the values of key, as LoadWithIncludes does. Paths of the
+// document read by the decoder are relative to the root of fsys.
+func (d *Decoder) Includes(fsys fs.FS, key string) *Decoder {
+	d.includes = func(t *Tree) error {
+		return resolveIncludes(fsys, t, ".", key, "", nil)
+	}
+	return d
+}
+
+// Parse the document at name in fsys and resolve its includes. stack holds
+// the names of the documents including it.
+func loadIncluded(fsys fs.FS, name, key string, stack []string) (*Tree, error) {
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	t, err := LoadBytes(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	t.source = name
+	stack = append(stack[:len(stack):len(stack)], name)
+	if err := resolveIncludes(fsys, t, path.Dir(name), key, name, stack); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return t, nil
+}
+
+// Merge the documents included by t and its sub-tables into them, paths being
+// relative to dir and source being the name of the document of t.
+func resolveIncludes(fsys fs.FS, t *Tree, dir, key, source string, stack []string) error {
+	for k, v := range t.values {
+		if k == key {
+			continue
+		}
+		switch node := v.(type) {
+		case *Tree:
+			if err := resolveIncludes(fsys, node, dir, key, source, stack); err != nil {
+				return err
+			}
+		case []*Tree:
+			for _, table := range node {
+				if err := resolveIncludes(fsys, table, dir, key, source, stack); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	value, ok := t.values[key].(*tomlValue)
+	if !ok {
+		if _, exists := t.values[key]; exists {
+			return fmt.Errorf("%s: %s must be a string or an array of strings", t.GetPositionPath([]string{key}), key)
+		}
+		return nil
+	}
+	var names []string
+	switch v := value.value.(type) {
+	case string:
+		names = []string{v}
+	case []interface{}:
+		for _, element := range v {
+			name, ok := element.(string)
+			if !ok {
+				return fmt.Errorf("%s: %s must be a string or an array of strings", value.position, key)
+			}
+			names = append(names, name)
+		}
+	default:
+		return fmt.Errorf("%s: %s must be a string or an array of strings", value.position, key)
+	}
+	delete(t.values, key)
+
+	merged := newTree()
+	for _, name := range names {
+		name = path.Join(dir, name)
+		for _, including := range stack {
+			if including == name {
+				return fmt.Errorf("%s: include cycle: %s -> %s", value.position, strings.Join(stack, " -> "), name)
+			}
+		}
+		included, err := loadIncluded(fsys, name, key, stack)
+		if err != nil {
+			return fmt.Errorf("%s: %s", value.position, err)
+		}
+		mergeTree(merged, included, MergeOptions{}, included.source)
+	}
+	mergeTree(merged, t, MergeOptions{}, source)
+	t.values = merged.values
+	return nil
+}
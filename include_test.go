@@ -0,0 +1,105 @@
+//go:build go1.16
+// +build go1.16
+
+package toml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var includeFS = fstest.MapFS{
+	"app.toml": {Data: []byte(`
+include = ["defaults.toml", "conf.d/server.toml"]
+name = "app"
+
+[logging]
+level = "debug"
+`)},
+	"defaults.toml": {Data: []byte(`
+name = "default"
+timeout = 30
+
+[logging]
+level = "info"
+output = "stderr"
+`)},
+	"conf.d/server.toml": {Data: []byte(`
+[server]
+include = "tls.toml"
+port = 8080
+`)},
+	"conf.d/tls.toml": {Data: []byte(`
+cert = "cert.pem"
+port = 443
+`)},
+	"cycle/a.toml": {Data: []byte(`include = "b.toml"`)},
+	"cycle/b.toml": {Data: []byte("[t]\ninclude = \"a.toml\"")},
+	"invalid.toml": {Data: []byte(`include = 1`)},
+	"missing.toml": {Data: []byte("x = 1\ninclude = \"nothing.toml\"")},
+	"broken.toml":  {Data: []byte(`include = "syntax.toml"`)},
+	"syntax.toml":  {Data: []byte(`a = `)},
+}
+
+func TestLoadWithIncludes(t *testing.T) {
+	tree, err := LoadWithIncludes(includeFS, "app.toml", "include")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"name":    "app",
+		"timeout": int64(30),
+		"logging": map[string]interface{}{"level": "debug", "output": "stderr"},
+		"server":  map[string]interface{}{"cert": "cert.pem", "port": int64(8080)},
+	}
+	if m := tree.ToMap(); !reflect.DeepEqual(m, expected) {
+		t.Errorf("expected %v, got %v", expected, m)
+	}
+	for key, source := range map[string]string{
+		"name":           "app.toml",
+		"timeout":        "defaults.toml",
+		"logging":        "defaults.toml",
+		"logging.level":  "app.toml",
+		"logging.output": "defaults.toml",
+		"server.port":    "conf.d/server.toml",
+		"server.cert":    "conf.d/tls.toml",
+	} {
+		if s := tree.GetSource(key); s != source {
+			t.Errorf("expected %s to come from %s, got %q", key, source, s)
+		}
+	}
+}
+
+func TestLoadWithIncludesErrors(t *testing.T) {
+	examples := []struct {
+		name string
+		err  string
+	}{
+		{"cycle/a.toml", "cycle/a.toml: (1, 1): cycle/b.toml: (2, 1): include cycle: cycle/a.toml -> cycle/b.toml -> cycle/a.toml"},
+		{"invalid.toml", "invalid.toml: (1, 1): include must be a string or an array of strings"},
+		{"missing.toml", "missing.toml: (2, 1): open nothing.toml: file does not exist"},
+		{"broken.toml", "broken.toml: (1, 1): syntax.toml: (1, 5): expecting a value"},
+	}
+	for _, e := range examples {
+		_, err := LoadWithIncludes(includeFS, e.name, "include")
+		assertErrorString(t, e.err, err)
+	}
+}
+
+func TestDecoderIncludes(t *testing.T) {
+	type config struct {
+		Name    string
+		Timeout int
+		Server  struct{ Port int }
+	}
+	var c config
+	doc := "include = [\"defaults.toml\", \"conf.d/server.toml\"]\nname = \"decoded\"\n"
+	if err := NewDecoder(strings.NewReader(doc)).Includes(includeFS, "include").Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "decoded" || c.Timeout != 30 || c.Server.Port != 8080 {
+		t.Errorf("unexpected decoding %+v", c)
+	}
+}
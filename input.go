@@ -0,0 +1,136 @@
+// Reading of the input of Decoders.
+
+package toml
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+)
+
+// ReadError is returned by a Decoder when reading its input fails. Err is the
+// error of the reader, such as the timeout of a network connection.
+//
+// The Decoder keeps the data read before the error: decoding again, for
+// example after extending the deadline of the connection, resumes reading
+// where it stopped instead of losing the beginning of the document.
+type ReadError struct {
+	Offset int64 // number of bytes of the document read before the error
+	Err    error
+}
+
+func (e *ReadError) Error() string {
+	return fmt.Sprintf("reading input at byte %d: %s", e.Offset, e.Err)
+}
+
+// Unwrap returns the error of the reader.
+func (e *ReadError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports whether the error of the reader is a timeout, as reported
+// by the Timeout method of net.Error.
+func (e *ReadError) Timeout() bool {
+	t, ok := e.Err.(interface{ Timeout() bool })
+	return ok && t.Timeout()
+}
+
+// Number of consecutive reads returning no data and no error after which
+// reading fails with io.ErrNoProgress, as bufio does.
+const maxEmptyReads = 100
+
+// Input of a Decoder: the data read before a read error, and the reader
+// guarding against readers that never return and enforcing the limits of the
+// Decoder.
+type decoderInput struct {
+	pending *bytes.Buffer
+	r       io.Reader
+	ctx     context.Context
+	empty   int
+	read    int64 // bytes read, including pending ones
+	max     int64
+}
+
+func (in *decoderInput) Read(p []byte) (int, error) {
+	if in.ctx != nil {
+		if err := in.ctx.Err(); err != nil {
+			return 0, err
+		}
+	}
+	if in.max > 0 && int64(len(p)) > in.max-in.read+1 {
+		p = p[:in.max-in.read+1]
+	}
+	n, err := in.r.Read(p)
+	in.read += int64(n)
+	if in.max > 0 && in.read > in.max {
+		return n, errInputTooLarge
+	}
+	if n > 0 || err != nil {
+		in.empty = 0
+		return n, err
+	}
+	in.empty++
+	if in.empty >= maxEmptyReads {
+		in.empty = 0
+		return 0, io.ErrNoProgress
+	}
+	return 0, nil
+}
+
+// Drop the data kept after a read error.
+func (in *decoderInput) reset() {
+	if in.pending != nil {
+		putBuffer(in.pending)
+		in.pending = nil
+	}
+	in.empty = 0
+}
+
+// Read the input until EOF and parse it. Data read before an error is kept
+// for the next call.
+func (d *Decoder) load() (*Tree, error) {
+	buf := d.input.pending
+	if buf == nil {
+		buf = getBuffer()
+	}
+	d.input.pending = nil
+	d.input.r, d.input.ctx = d.r, d.ctx
+	d.input.read, d.input.max = int64(buf.Len()), d.limits.maxInputBytes
+	var err error
+	switch {
+	case d.separator != "":
+		// limits apply to the document, not to the data buffered ahead
+		d.input.max = 0
+		err = d.readDocument(buf)
+	case d.stream != nil:
+		// input buffered by More
+		_, err = buf.ReadFrom(d.stream)
+	default:
+		_, err = buf.ReadFrom(&d.input)
+	}
+	d.input.r, d.input.ctx = nil, nil
+	switch {
+	case err == io.EOF:
+		putBuffer(buf)
+		return nil, io.EOF
+	case err == errInputTooLarge:
+		putBuffer(buf)
+		return nil, inputTooLargeError(d.limits.maxInputBytes)
+	case err != nil && d.canceled():
+		putBuffer(buf)
+		return nil, d.ctx.Err()
+	case err != nil:
+		d.input.pending = buf
+		return nil, &ReadError{Offset: int64(buf.Len()), Err: err}
+	}
+	defer putBuffer(buf)
+	tree, err := loadBytes(buf.Bytes(), d.duplicates, d.parseOptions())
+	if err == nil && d.includes != nil {
+		err = d.includes(tree)
+	}
+	if err == nil && d.lookupEnv != nil {
+		err = expandTree(tree, d.lookupEnv)
+	}
+	return tree, err
+}
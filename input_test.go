@@ -0,0 +1,147 @@
+package toml
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+const streamDocument = `# a document using most tokens
+title = "TOML \"stream\" é"
+literal = 'C:\path'
+multiline = """
+line one
+line two"""
+int = 0xdead_beef
+float = 6.626e-34
+bool = true
+date = 1979-05-27T07:32:00.999-07:00
+array = [ 1, 2,
+  3 ]
+
+[table."quoted key"]
+inline = { a = 1, b = [ "x" ] }
+
+[[items]]
+name = "first"
+
+[[items]]
+name = "second"
+`
+
+func decodeStream(t *testing.T, r io.Reader) map[string]interface{} {
+	var m map[string]interface{}
+	if err := NewDecoder(r).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestDecodeShortReads(t *testing.T) {
+	expected := decodeStream(t, strings.NewReader(streamDocument))
+	readers := map[string]io.Reader{
+		"one byte": iotest.OneByteReader(strings.NewReader(streamDocument)),
+		"half":     iotest.HalfReader(strings.NewReader(streamDocument)),
+		"data err": iotest.DataErrReader(strings.NewReader(streamDocument)),
+	}
+	for name, r := range readers {
+		if m := decodeStream(t, r); !reflect.DeepEqual(m, expected) {
+			t.Errorf("%s: expected %v, got %v", name, expected, m)
+		}
+	}
+}
+
+func TestDecodeResumesAfterReadError(t *testing.T) {
+	expected := decodeStream(t, strings.NewReader(streamDocument))
+
+	// the second read fails with a timeout, the following ones succeed
+	d := NewDecoder(iotest.TimeoutReader(iotest.OneByteReader(strings.NewReader(streamDocument))))
+	var m map[string]interface{}
+	err := d.Decode(&m)
+	readErr, ok := err.(*ReadError)
+	if !ok {
+		t.Fatalf("expected a *ReadError, got %v", err)
+	}
+	if readErr.Err != iotest.ErrTimeout || readErr.Offset != 1 {
+		t.Errorf("unexpected error %+v", readErr)
+	}
+	if err := d.Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("expected %v, got %v", expected, m)
+	}
+}
+
+func TestDecodeNetworkTimeout(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	half := len(streamDocument) / 2
+	resume := make(chan struct{})
+	go func() {
+		client.Write([]byte(streamDocument[:half]))
+		<-resume
+		client.Write([]byte(streamDocument[half:]))
+		client.Close()
+	}()
+
+	d := NewDecoder(server)
+	var m map[string]interface{}
+	server.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	err := d.Decode(&m)
+	readErr, ok := err.(*ReadError)
+	if !ok || !readErr.Timeout() || readErr.Offset != int64(half) {
+		t.Fatalf("expected a timeout after %d bytes, got %v", half, err)
+	}
+	server.SetReadDeadline(time.Time{})
+	close(resume)
+	if err := d.Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m["title"] != "TOML \"stream\" é" || len(m["items"].([]map[string]interface{})) != 2 {
+		t.Errorf("unexpected document %v", m)
+	}
+}
+
+type emptyReader struct{}
+
+func (emptyReader) Read(p []byte) (int, error) {
+	return 0, nil
+}
+
+type failingReader struct{ err error }
+
+func (r failingReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+func TestDecodeNoProgress(t *testing.T) {
+	var m map[string]interface{}
+	err := NewDecoder(emptyReader{}).Decode(&m)
+	if readErr, ok := err.(*ReadError); !ok || readErr.Err != io.ErrNoProgress {
+		t.Errorf("expected io.ErrNoProgress, got %v", err)
+	}
+}
+
+func TestDecoderResetDropsPendingInput(t *testing.T) {
+	failing := io.MultiReader(strings.NewReader("a = "), failingReader{errors.New("broken")})
+	d := NewDecoder(failing)
+	var m map[string]interface{}
+	if err := d.Decode(&m); err == nil || err.Error() != "reading input at byte 4: broken" {
+		t.Errorf("unexpected error %v", err)
+	}
+	d.Reset(bytes.NewReader([]byte("b = 1\n")))
+	m = nil
+	if err := d.Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, map[string]interface{}{"b": int64(1)}) {
+		t.Errorf("unexpected document %v", m)
+	}
+}
@@ -0,0 +1,173 @@
+// Digests and signatures of documents.
+
+package toml
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prefix of the comment line holding the signature of a document.
+const signaturePrefix = "# signature: "
+
+// CanonicalHash returns the SHA-256 digest of the content of t. The digest
+// only depends on the keys and values of the document, not on how it is
+// written: documents differing only in comments, key order, whitespace,
+// quoting, number formats, or in the use of dotted keys and inline tables
+// rather than tables have the same digest. Values of different types, such
+// as 1 and 1.0, give different digests.
+func CanonicalHash(t *Tree) []byte {
+	h := sha256.New()
+	w := bufio.NewWriter(h)
+	writeCanonical(w, t)
+	w.Flush()
+	return h.Sum(nil)
+}
+
+// Copy of t for canonical encoding: comments, commented keys, inline tables
+// and the formatting options of the values are dropped.
+func canonicalTree(t *Tree) *Tree {
+	c := newTree()
+	for k, v := range t.values {
+		switch v := v.(type) {
+		case *Tree:
+			if !v.commented {
+				c.values[k] = canonicalTree(v)
+			}
+		case []*Tree:
+			trees := make([]*Tree, 0, len(v))
+			for _, t := range v {
+				if !t.commented {
+					trees = append(trees, canonicalTree(t))
+				}
+			}
+			if len(trees) > 0 {
+				c.values[k] = trees
+			}
+		case *tomlValue:
+			if !v.commented {
+				c.values[k] = &tomlValue{value: v.value}
+			}
+		}
+	}
+	return c
+}
+
+// Write an unambiguous representation of v: each value is tagged with its
+// type, tables are written with their keys in order, and strings are quoted.
+func writeCanonical(w *bufio.Writer, v interface{}) {
+	switch v := v.(type) {
+	case *Tree:
+		keys := make([]string, 0, len(v.values))
+		for k := range v.values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		w.WriteByte('{')
+		for _, k := range keys {
+			w.WriteString(strconv.Quote(k))
+			w.WriteByte('=')
+			writeCanonical(w, v.values[k])
+			w.WriteByte(';')
+		}
+		w.WriteByte('}')
+	case []*Tree:
+		w.WriteByte('[')
+		for _, t := range v {
+			writeCanonical(w, t)
+			w.WriteByte(',')
+		}
+		w.WriteByte(']')
+	case *tomlValue:
+		writeCanonical(w, v.value)
+	case []interface{}:
+		w.WriteByte('[')
+		for _, e := range v {
+			writeCanonical(w, e)
+			w.WriteByte(',')
+		}
+		w.WriteByte(']')
+	case string:
+		w.WriteString(strconv.Quote(v))
+	case bool:
+		w.WriteString(strconv.FormatBool(v))
+	case int64:
+		w.WriteString("i" + strconv.FormatInt(v, 10))
+	case uint64:
+		w.WriteString("i" + strconv.FormatUint(v, 10))
+	case float64:
+		w.WriteString("f" + strconv.FormatFloat(v, 'g', -1, 64))
+	case time.Time:
+		w.WriteString("t" + v.Format(time.RFC3339Nano))
+	case LocalDate:
+		w.WriteString("d" + v.String())
+	case LocalTime:
+		w.WriteString("l" + v.String())
+	case LocalDateTime:
+		w.WriteString("dt" + v.String())
+	default:
+		fmt.Fprintf(w, "%T(%v)", v, v)
+	}
+}
+
+// Sign prepends to the document b a comment line holding the signature of
+// its canonical hash, computed by sign, replacing the signature b may
+// already have. The signature being in a comment, the signed document can be
+// used as is, and edits that do not change its content keep it valid.
+func Sign(b []byte, sign func(digest []byte) ([]byte, error)) ([]byte, error) {
+	_, body := splitSignature(b)
+	tree, err := LoadBytes(body)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := sign(CanonicalHash(tree))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(signaturePrefix)
+	buf.WriteString(base64.StdEncoding.EncodeToString(signature))
+	buf.WriteByte('\n')
+	buf.Write(body)
+	return buf.Bytes(), nil
+}
+
+// VerifySignature checks the signature written by Sign in the document b.
+// verify is called with the canonical hash of the document and the
+// signature, and returns an error if the signature is invalid. An error is
+// also returned if b is not signed.
+func VerifySignature(b []byte, verify func(digest, signature []byte) error) error {
+	line, body := splitSignature(b)
+	if line == "" {
+		return errors.New("document is not signed")
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(strings.TrimPrefix(line, signaturePrefix)))
+	if err != nil {
+		return fmt.Errorf("invalid signature: %s", err)
+	}
+	tree, err := LoadBytes(body)
+	if err != nil {
+		return err
+	}
+	return verify(CanonicalHash(tree), signature)
+}
+
+// Split the signature line from the rest of the document.
+func splitSignature(b []byte) (string, []byte) {
+	if !bytes.HasPrefix(b, []byte(signaturePrefix)) {
+		return "", b
+	}
+	end := bytes.IndexByte(b, '\n') + 1
+	if end == 0 {
+		end = len(b)
+	}
+	return strings.TrimRight(string(b[:end]), "\r\n"), b[end:]
+}
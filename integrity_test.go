@@ -0,0 +1,90 @@
+package toml
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+func TestCanonicalHash(t *testing.T) {
+	hash := func(doc string) []byte {
+		tree, err := Load(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return CanonicalHash(tree)
+	}
+
+	reference := hash("a = 1\nb = \"x\"\n[t]\nk = [1, 2]\n")
+	for _, doc := range []string{
+		"# comment\nb = 'x'\na = 0x1\n\n[t]\n  k = [ 1, 2, ]\n",
+		"a = 1\nb = \"x\"\nt = { k = [1, 2] }\n",
+		"a = 1\nb = \"\"\"x\"\"\"\nt.k = [1, 2]\n",
+		"\"a\" = 1\nb = \"x\"\n[t]\nk = [1, 2]\n",
+	} {
+		if !bytes.Equal(hash(doc), reference) {
+			t.Errorf("expected the same hash for %q", doc)
+		}
+	}
+	for _, doc := range []string{
+		"a = 1.0\nb = \"x\"\n[t]\nk = [1, 2]\n",
+		"a = 1\nb = \"x\"\n[t]\nk = [2, 1]\n",
+		"a = 1\nb = \"x\"\n[[t]]\nk = [1, 2]\n",
+		"a = 1\nb = \"x\"\nc = \"\"\n[t]\nk = [1, 2]\n",
+	} {
+		if bytes.Equal(hash(doc), reference) {
+			t.Errorf("expected a different hash for %q", doc)
+		}
+	}
+}
+
+func TestSignature(t *testing.T) {
+	key := []byte("secret")
+	sign := func(digest []byte) ([]byte, error) {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(digest)
+		return mac.Sum(nil), nil
+	}
+	verify := func(digest, signature []byte) error {
+		expected, _ := sign(digest)
+		if !hmac.Equal(expected, signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+
+	signed, err := Sign([]byte("a = 1\n[t]\nk = \"v\"\n"), sign)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(signed, []byte("# signature: ")) {
+		t.Fatalf("expected a signature comment, got %s", signed)
+	}
+	if err := VerifySignature(signed, verify); err != nil {
+		t.Error(err)
+	}
+
+	// reformatting keeps the signature valid, changing values does not
+	reformatted := bytes.Replace(signed, []byte("a = 1\n"), []byte("a=1 # one\n"), 1)
+	if err := VerifySignature(reformatted, verify); err != nil {
+		t.Error(err)
+	}
+	tampered := bytes.Replace(signed, []byte("a = 1\n"), []byte("a = 2\n"), 1)
+	assertErrorString(t, "invalid signature", VerifySignature(tampered, verify))
+
+	// signing again replaces the signature
+	resigned, err := Sign(tampered, sign)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Count(resigned, []byte("# signature: ")) != 1 {
+		t.Errorf("expected a single signature, got %s", resigned)
+	}
+	if err := VerifySignature(resigned, verify); err != nil {
+		t.Error(err)
+	}
+
+	assertErrorString(t, "document is not signed", VerifySignature([]byte("a = 1\n"), verify))
+}
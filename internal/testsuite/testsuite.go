@@ -0,0 +1,375 @@
+// Package testsuite runs the toml-test suites against go-toml.
+//
+// toml-test (https://github.com/toml-lang/toml-test) is the language-agnostic
+// conformance suite of TOML. Its tests directory holds valid documents, each
+// with a JSON file of the values it defines, and invalid documents that must
+// be rejected. The JSON files describe values with their type:
+//
+//	{"port": {"type": "integer", "value": "8080"}}
+//
+// Load reads the cases of a checkout of the suite. Decoder cases parse the
+// document and compare its values to the JSON file, and encoder cases write
+// the values of the JSON file as TOML and parse them back.
+//
+// The tests of this package run the suite found in the directory named by the
+// TOML_TEST_DIR environment variable:
+//
+//	git clone https://github.com/toml-lang/toml-test
+//	TOML_TEST_DIR=$PWD/toml-test/tests go test ./internal/testsuite
+package testsuite
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Case is a test of the suite.
+type Case struct {
+	// Name is the path of the document in the suite, without its extension,
+	// like valid/integer/long.
+	Name string
+	// Valid is set for the documents that must be accepted.
+	Valid bool
+	// Input is the TOML document.
+	Input []byte
+	// Expected is the tagged JSON of the values of valid documents.
+	Expected []byte
+}
+
+// Load returns the cases of the suite in dir, the tests directory of
+// toml-test, sorted by name.
+func Load(dir string) ([]Case, error) {
+	var cases []Case
+	for _, valid := range []bool{true, false} {
+		sub := "invalid"
+		if valid {
+			sub = "valid"
+		}
+		root := filepath.Join(dir, sub)
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || filepath.Ext(path) != ".toml" {
+				return err
+			}
+			name, err := filepath.Rel(dir, strings.TrimSuffix(path, ".toml"))
+			if err != nil {
+				return err
+			}
+			c := Case{Name: filepath.ToSlash(name), Valid: valid}
+			if c.Input, err = ioutil.ReadFile(path); err != nil {
+				return err
+			}
+			if valid {
+				if c.Expected, err = ioutil.ReadFile(strings.TrimSuffix(path, ".toml") + ".json"); err != nil {
+					return err
+				}
+			}
+			cases = append(cases, c)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(cases, func(i, j int) bool { return cases[i].Name < cases[j].Name })
+	return cases, nil
+}
+
+// Decode checks that the document of a valid case is parsed into the expected
+// values, and that the document of an invalid case is rejected.
+func (c Case) Decode() error {
+	out, err := Decode(c.Input)
+	if !c.Valid {
+		if err == nil {
+			return fmt.Errorf("invalid document accepted, decoded as %s", out)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return Compare(c.Expected, out)
+}
+
+// Encode checks that the expected values of a valid case are encoded into a
+// document holding the same values.
+func (c Case) Encode() error {
+	if !c.Valid {
+		return nil
+	}
+	doc, err := Encode(c.Expected)
+	if err != nil {
+		return err
+	}
+	out, err := Decode(doc)
+	if err != nil {
+		return fmt.Errorf("cannot decode the encoded document: %s\n%s", err, doc)
+	}
+	if err := Compare(c.Expected, out); err != nil {
+		return fmt.Errorf("%s\n%s", err, doc)
+	}
+	return nil
+}
+
+// Decode parses a TOML document and returns its values as tagged JSON, as
+// the decoders tested by toml-test.
+func Decode(doc []byte) ([]byte, error) {
+	tree, err := toml.LoadBytes(doc)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(tagged(tree.AsValue()))
+}
+
+func tagged(v toml.Value) interface{} {
+	switch v.Kind() {
+	case toml.KindTable:
+		t, _ := v.AsTable()
+		m := map[string]interface{}{}
+		for _, k := range t.Keys() {
+			m[k] = tagged(t.GetValuePath([]string{k}))
+		}
+		return m
+	case toml.KindArray:
+		elements, _ := v.AsArray()
+		a := make([]interface{}, len(elements))
+		for i, e := range elements {
+			a[i] = tagged(e)
+		}
+		return a
+	case toml.KindFloat:
+		f, _ := v.AsFloat()
+		return tag("float", formatFloat(f))
+	case toml.KindOffsetDateTime:
+		t, _ := v.AsTime()
+		return tag("datetime", t.Format(time.RFC3339Nano))
+	case toml.KindLocalDateTime:
+		return tag("datetime-local", fmt.Sprint(v.Interface()))
+	case toml.KindLocalDate:
+		return tag("date-local", fmt.Sprint(v.Interface()))
+	case toml.KindLocalTime:
+		return tag("time-local", fmt.Sprint(v.Interface()))
+	}
+	return tag(v.Kind().String(), fmt.Sprint(v.Interface()))
+}
+
+func tag(typ, value string) map[string]string {
+	return map[string]string{"type": typ, "value": value}
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Encode writes the values of tagged JSON as a TOML document, as the encoders
+// tested by toml-test.
+func Encode(b []byte) ([]byte, error) {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a JSON object, got %s", b)
+	}
+	values, err := untagged(m)
+	if err != nil {
+		return nil, err
+	}
+	return toml.Marshal(values)
+}
+
+// Convert tagged JSON to the values encoded by Marshal.
+func untagged(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if typ, value, ok := isTagged(v); ok {
+			return untag(typ, value)
+		}
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			value, err := untagged(e)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = value
+		}
+		return m, nil
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, e := range v {
+			value, err := untagged(e)
+			if err != nil {
+				return nil, err
+			}
+			a[i] = value
+		}
+		return a, nil
+	}
+	return nil, fmt.Errorf("unexpected JSON value %v", v)
+}
+
+// Type and value of a tagged value.
+func isTagged(m map[string]interface{}) (string, string, bool) {
+	if len(m) != 2 {
+		return "", "", false
+	}
+	typ, ok := m["type"].(string)
+	if !ok {
+		return "", "", false
+	}
+	value, ok := m["value"].(string)
+	return typ, value, ok
+}
+
+func untag(typ, value string) (interface{}, error) {
+	switch typ {
+	case "string":
+		return value, nil
+	case "integer":
+		return strconv.ParseInt(value, 10, 64)
+	case "float":
+		return parseFloat(value)
+	case "bool":
+		return strconv.ParseBool(value)
+	case "datetime":
+		return time.Parse(time.RFC3339Nano, value)
+	case "datetime-local":
+		return toml.ParseLocalDateTime(value)
+	case "date-local":
+		return toml.ParseLocalDate(value)
+	case "time-local":
+		return toml.ParseLocalTime(value)
+	}
+	return nil, fmt.Errorf("unknown type %q", typ)
+}
+
+func parseFloat(s string) (float64, error) {
+	switch s {
+	case "nan", "+nan", "-nan":
+		return math.NaN(), nil
+	case "inf", "+inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// Compare returns an error describing the first difference between two tagged
+// JSON documents, or nil if they hold the same values. Numbers and date-times
+// are compared by value, so that 1e3 equals 1000.0.
+func Compare(expected, actual []byte) error {
+	var e, a interface{}
+	if err := json.Unmarshal(expected, &e); err != nil {
+		return fmt.Errorf("invalid expected JSON: %s", err)
+	}
+	if err := json.Unmarshal(actual, &a); err != nil {
+		return fmt.Errorf("invalid JSON: %s", err)
+	}
+	return compare(toml.Key{}, e, a)
+}
+
+func compare(key toml.Key, expected, actual interface{}) error {
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected a table, got %v", key, actual)
+		}
+		if typ, value, ok := isTagged(e); ok {
+			return compareValues(key, typ, value, a)
+		}
+		for k := range a {
+			if _, ok := e[k]; !ok {
+				return fmt.Errorf("%s: unexpected key", key.Append(k))
+			}
+		}
+		keys := make([]string, 0, len(e))
+		for k := range e {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if _, ok := a[k]; !ok {
+				return fmt.Errorf("%s: missing key", key.Append(k))
+			}
+			if err := compare(key.Append(k), e[k], a[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an array, got %v", key, actual)
+		}
+		if len(a) != len(e) {
+			return fmt.Errorf("%s: expected %d elements, got %d", key, len(e), len(a))
+		}
+		for i := range e {
+			if err := compare(key, e[i], a[i]); err != nil {
+				return fmt.Errorf("element %d: %s", i, err)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%s: unexpected JSON value %v", key, expected)
+}
+
+func compareValues(key toml.Key, typ, value string, actual map[string]interface{}) error {
+	actualType, actualValue, ok := isTagged(actual)
+	if !ok {
+		return fmt.Errorf("%s: expected a %s, got %v", key, typ, actual)
+	}
+	if actualType != typ {
+		return fmt.Errorf("%s: expected a %s, got a %s", key, typ, actualType)
+	}
+	equal := value == actualValue
+	switch typ {
+	case "integer":
+		e, err1 := strconv.ParseInt(value, 10, 64)
+		a, err2 := strconv.ParseInt(actualValue, 10, 64)
+		equal = err1 == nil && err2 == nil && e == a
+	case "float":
+		e, err1 := parseFloat(value)
+		a, err2 := parseFloat(actualValue)
+		equal = err1 == nil && err2 == nil && (e == a || math.IsNaN(e) && math.IsNaN(a))
+	case "datetime":
+		e, err1 := time.Parse(time.RFC3339Nano, value)
+		a, err2 := time.Parse(time.RFC3339Nano, actualValue)
+		equal = err1 == nil && err2 == nil && e.Equal(a)
+	case "datetime-local", "time-local":
+		equal = trimFraction(value) == trimFraction(actualValue)
+	}
+	if !equal {
+		return fmt.Errorf("%s: expected %s %q, got %q", key, typ, value, actualValue)
+	}
+	return nil
+}
+
+// Remove the trailing zeros of the fractional seconds of a local date-time or
+// time, which may be written or not.
+func trimFraction(s string) string {
+	if !strings.Contains(s, ".") {
+		return s
+	}
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
@@ -0,0 +1,63 @@
+package testsuite
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func runSuite(t *testing.T, dir string) {
+	cases, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) == 0 {
+		t.Fatalf("no test found in %s", dir)
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			if err := c.Decode(); err != nil {
+				t.Errorf("decoder: %s", err)
+			}
+			if err := c.Encode(); err != nil {
+				t.Errorf("encoder: %s", err)
+			}
+		})
+	}
+}
+
+func TestTestdata(t *testing.T) {
+	runSuite(t, "testdata")
+}
+
+// TestTOMLTest runs the suite of a checkout of toml-test.
+func TestTOMLTest(t *testing.T) {
+	dir := os.Getenv("TOML_TEST_DIR")
+	if dir == "" {
+		t.Skip("TOML_TEST_DIR is not set")
+	}
+	runSuite(t, dir)
+}
+
+func TestCompare(t *testing.T) {
+	examples := []struct {
+		expected, actual string
+		err              string
+	}{
+		{`{"a": {"type": "float", "value": "1e3"}}`, `{"a": {"type": "float", "value": "1000.0"}}`, ""},
+		{`{"a": {"type": "datetime", "value": "1979-05-27T07:32:00-08:00"}}`, `{"a": {"type": "datetime", "value": "1979-05-27T15:32:00Z"}}`, ""},
+		{`{"a": {"type": "integer", "value": "1"}}`, `{"a": {"type": "float", "value": "1"}}`, "a: expected a integer, got a float"},
+		{`{"a": [{"type": "integer", "value": "1"}]}`, `{"a": []}`, "a: expected 1 elements, got 0"},
+		{`{"a": {"b": {"type": "bool", "value": "true"}}}`, `{"a": {}}`, "a.b: missing key"},
+		{`{}`, `{"c": {"type": "bool", "value": "true"}}`, "c: unexpected key"},
+	}
+	for _, e := range examples {
+		err := Compare([]byte(e.expected), []byte(e.actual))
+		if e.err == "" && err != nil {
+			t.Errorf("%s and %s: unexpected error %s", e.expected, e.actual, err)
+		} else if e.err != "" && (err == nil || !strings.Contains(err.Error(), e.err)) {
+			t.Errorf("%s and %s: expected error %q, got %v", e.expected, e.actual, e.err, err)
+		}
+	}
+}
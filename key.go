@@ -0,0 +1,251 @@
+// Key paths.
+
+package toml
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Key is the path of a key in a document, made of the unquoted parts of its
+// dotted form: a."b.c" is Key{"a", "b.c"}. A Key can be given to any method
+// accepting a []string path, such as Tree.GetPath.
+//
+// Methods returning a Key never share memory with their receiver or their
+// arguments.
+type Key []string
+
+// ParseKey parses a dotted key as written in a document, such as
+// server."host.name", handling bare, quoted and literal parts, the escape
+// sequences of quoted parts, and whitespace around dots.
+func ParseKey(s string) (Key, error) {
+	var key Key
+	i := 0
+	for {
+		i = skipKeySpace(s, i)
+		if i == len(s) {
+			if len(key) == 0 {
+				return nil, errors.New("empty key")
+			}
+			return nil, errors.New("unexpected end of key")
+		}
+		var part string
+		var err error
+		switch c := s[i]; {
+		case c == '"':
+			part, i, err = parseQuotedKeyPart(s, i+1)
+			if err != nil {
+				return nil, err
+			}
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unclosed single-quoted key")
+			}
+			part, i = s[i+1:i+1+end], i+end+2
+		case isValidBareChar(rune(c)):
+			start := i
+			for i < len(s) && isValidBareChar(rune(s[i])) {
+				i++
+			}
+			part = s[start:i]
+		default:
+			r, _ := utf8.DecodeRuneInString(s[i:])
+			return nil, fmt.Errorf("invalid key character: %c", r)
+		}
+		key = append(key, part)
+
+		i = skipKeySpace(s, i)
+		if i == len(s) {
+			return key, nil
+		}
+		if s[i] != '.' {
+			r, _ := utf8.DecodeRuneInString(s[i:])
+			return nil, fmt.Errorf("expected a dot after %s, got %c", key, r)
+		}
+		i++
+	}
+}
+
+func skipKeySpace(s string, i int) int {
+	for i < len(s) && isSpace(rune(s[i])) {
+		i++
+	}
+	return i
+}
+
+// Parse the quoted part of a key starting at s[i], after its opening quote,
+// returning its unescaped value and the index following its closing quote.
+func parseQuotedKeyPart(s string, i int) (string, int, error) {
+	var b strings.Builder
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		switch {
+		case r == '"':
+			return b.String(), i, nil
+		case r < 0x20 && r != '\t', r == 0x7f:
+			return "", i, fmt.Errorf("unescaped control character %U in key", r)
+		case r != '\\':
+			b.WriteRune(r)
+			continue
+		}
+		if i == len(s) {
+			break
+		}
+		escape := s[i]
+		i++
+		digits := 0
+		switch escape {
+		case 'b':
+			b.WriteByte('\b')
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'f':
+			b.WriteByte('\f')
+		case 'r':
+			b.WriteByte('\r')
+		case 'e':
+			b.WriteByte(0x1b)
+		case '"', '\\':
+			b.WriteByte(escape)
+		case 'x':
+			digits = 2
+		case 'u':
+			digits = 4
+		case 'U':
+			digits = 8
+		default:
+			return "", i, fmt.Errorf("invalid escape sequence \\%c in key", escape)
+		}
+		if digits == 0 {
+			continue
+		}
+		if i+digits > len(s) {
+			return "", i, fmt.Errorf("unfinished escape sequence \\%s in key", s[i-1:])
+		}
+		code, err := strconv.ParseUint(s[i:i+digits], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return "", i, fmt.Errorf("invalid escape sequence \\%s in key", s[i-1:i+digits])
+		}
+		b.WriteRune(rune(code))
+		i += digits
+	}
+	return "", i, errors.New("unclosed double-quoted key")
+}
+
+// String returns the dotted form of the key, quoting the parts that are not
+// valid bare keys, so that parsing it with ParseKey gives back the same key.
+func (k Key) String() string {
+	quoted := make([]string, len(k))
+	for i, part := range k {
+		if isBareKey(part) {
+			quoted[i] = part
+		} else {
+			quoted[i] = quoteKey(part)
+		}
+	}
+	return strings.Join(quoted, ".")
+}
+
+// Equal reports whether k and other are made of the same parts.
+func (k Key) Equal(other Key) bool {
+	if len(k) != len(other) {
+		return false
+	}
+	for i := range k {
+		if k[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare compares the parts of k and other one by one, and returns -1, 0 or
+// 1 when k sorts before, is equal to, or sorts after other. A key sorts right
+// after its prefixes.
+func (k Key) Compare(other Key) int {
+	for i := 0; i < len(k) && i < len(other); i++ {
+		if c := strings.Compare(k[i], other[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(k) < len(other):
+		return -1
+	case len(k) > len(other):
+		return 1
+	}
+	return 0
+}
+
+// HasPrefix reports whether the first parts of k are the parts of prefix. A
+// key is a prefix of itself.
+func (k Key) HasPrefix(prefix Key) bool {
+	return len(k) >= len(prefix) && k[:len(prefix)].Equal(prefix)
+}
+
+// TrimPrefix returns k without the leading parts of prefix. k is returned
+// unchanged if it does not start with prefix.
+func (k Key) TrimPrefix(prefix Key) Key {
+	if !k.HasPrefix(prefix) {
+		return k.Append()
+	}
+	return k[len(prefix):].Append()
+}
+
+// Parent returns the key of the table containing k, which is empty for a
+// top-level key.
+func (k Key) Parent() Key {
+	if len(k) == 0 {
+		return Key{}
+	}
+	return k[:len(k)-1].Append()
+}
+
+// Match reports whether k matches pattern, whose parts match the parts of k
+// equal to them. In pattern, a part "*" matches any single part, and a part
+// "**" matches any number of parts, including none: servers.*.host matches the
+// host of every server, and **.password any password.
+func (k Key) Match(pattern Key) bool {
+	if len(pattern) == 0 {
+		return len(k) == 0
+	}
+	switch pattern[0] {
+	case "**":
+		for i := 0; i <= len(k); i++ {
+			if k[i:].Match(pattern[1:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(k) > 0 && k[1:].Match(pattern[1:])
+	}
+	return len(k) > 0 && k[0] == pattern[0] && k[1:].Match(pattern[1:])
+}
+
+// Append returns a new key made of the parts of k followed by parts.
+func (k Key) Append(parts ...string) Key {
+	result := make(Key, 0, len(k)+len(parts))
+	result = append(result, k...)
+	return append(result, parts...)
+}
+
+// Whether s can be written as a bare key.
+func isBareKey(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !isValidBareChar(r) {
+			return false
+		}
+	}
+	return true
+}
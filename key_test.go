@@ -0,0 +1,138 @@
+package toml
+
+import (
+	"testing"
+)
+
+func TestParseKeyString(t *testing.T) {
+	tests := []struct {
+		input    string
+		key      Key
+		rendered string
+	}{
+		{"a", Key{"a"}, "a"},
+		{"a.b.c", Key{"a", "b", "c"}, "a.b.c"},
+		{`server."host.name"`, Key{"server", "host.name"}, `server."host.name"`},
+		{"a . 'b c'", Key{"a", "b c"}, `a."b c"`},
+		{`""`, Key{""}, `""`},
+		{`"café"`, Key{"café"}, `"café"`},
+		{`"a\"b".c`, Key{`a"b`, "c"}, `"a\"b".c`},
+		{`'a"b'`, Key{`a"b`}, `"a\"b"`},
+		{`"tab\tand\\"`, Key{"tab\tand\\"}, `"tab\tand\\"`},
+		{`"\u00e9\U0001F600"`, Key{"\u00e9\U0001F600"}, "\"\u00e9\U0001F600\""},
+		{"\"\\u007F\\u001F\"", Key{"\x7f\x1f"}, "\"\\u007F\\u001F\""},
+	}
+	for _, test := range tests {
+		key, err := ParseKey(test.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.input, err)
+			continue
+		}
+		if !key.Equal(test.key) {
+			t.Errorf("%s: expected %q, got %q", test.input, test.key, key)
+		}
+		if key.String() != test.rendered {
+			t.Errorf("%s: expected %s, got %s", test.input, test.rendered, key.String())
+		}
+		again, err := ParseKey(key.String())
+		if err != nil || !again.Equal(key) {
+			t.Errorf("%s: %s does not parse back to %q: %v %v", test.input, key, key, again, err)
+		}
+	}
+
+	if _, err := ParseKey(""); err == nil {
+		t.Error("expected an error for an empty key")
+	}
+	for input, expected := range map[string]string{
+		"a..b":     "invalid key character: .",
+		".a":       "invalid key character: .",
+		"a.":       "unexpected end of key",
+		`"a" b`:    "expected a dot after a, got b",
+		`"a`:       "unclosed double-quoted key",
+		`"\q"`:     `invalid escape sequence \q in key`,
+		`"\uD800"`: `invalid escape sequence \uD800 in key`,
+	} {
+		_, err := ParseKey(input)
+		assertErrorString(t, expected, err)
+	}
+}
+
+func TestKeyMatch(t *testing.T) {
+	tests := []struct {
+		key, pattern Key
+		expected     bool
+	}{
+		{Key{"a", "b"}, Key{"a", "b"}, true},
+		{Key{"a", "b"}, Key{"a"}, false},
+		{Key{"a"}, Key{"a", "b"}, false},
+		{Key{"servers", "alpha", "host"}, Key{"servers", "*", "host"}, true},
+		{Key{"servers", "host"}, Key{"servers", "*", "host"}, false},
+		{Key{"db", "password"}, Key{"**", "password"}, true},
+		{Key{"password"}, Key{"**", "password"}, true},
+		{Key{"a", "b", "password", "x"}, Key{"**", "password"}, false},
+		{Key{"a", "b", "c"}, Key{"a", "**"}, true},
+		{Key{}, Key{"**"}, true},
+		{Key{}, Key{}, true},
+	}
+	for _, test := range tests {
+		if match := test.key.Match(test.pattern); match != test.expected {
+			t.Errorf("%q.Match(%q): expected %v, got %v", test.key, test.pattern, test.expected, match)
+		}
+	}
+}
+
+func TestKeyCompare(t *testing.T) {
+	tests := []struct {
+		a, b     Key
+		expected int
+	}{
+		{Key{"a"}, Key{"a"}, 0},
+		{Key{"a"}, Key{"b"}, -1},
+		{Key{"a", "z"}, Key{"b"}, -1},
+		{Key{"a"}, Key{"a", "b"}, -1},
+		{Key{"a", "b"}, Key{"a"}, 1},
+		{Key{}, Key{}, 0},
+	}
+	for _, test := range tests {
+		if c := test.a.Compare(test.b); c != test.expected {
+			t.Errorf("%q.Compare(%q): expected %d, got %d", test.a, test.b, test.expected, c)
+		}
+		if test.a.Equal(test.b) != (test.expected == 0) {
+			t.Errorf("%q.Equal(%q) does not agree with Compare", test.a, test.b)
+		}
+	}
+}
+
+func TestKeyPrefix(t *testing.T) {
+	key := Key{"a", "b", "c"}
+	if !key.HasPrefix(Key{"a", "b"}) || !key.HasPrefix(key) || !key.HasPrefix(Key{}) {
+		t.Error("expected prefixes to match")
+	}
+	if key.HasPrefix(Key{"a", "c"}) || key.HasPrefix(Key{"a", "b", "c", "d"}) {
+		t.Error("expected non prefixes not to match")
+	}
+	if rest := key.TrimPrefix(Key{"a"}); !rest.Equal(Key{"b", "c"}) {
+		t.Errorf("unexpected trimmed key %q", rest)
+	}
+	if rest := key.TrimPrefix(Key{"b"}); !rest.Equal(key) {
+		t.Errorf("unexpected trimmed key %q", rest)
+	}
+	if parent := key.Parent(); !parent.Equal(Key{"a", "b"}) {
+		t.Errorf("unexpected parent %q", parent)
+	}
+	if parent := (Key{}).Parent(); len(parent) != 0 {
+		t.Errorf("unexpected parent %q", parent)
+	}
+
+	// derived keys do not share memory with their receiver
+	parent := key.Parent()
+	child := parent.Append("x")
+	if !key.Equal(Key{"a", "b", "c"}) || !child.Equal(Key{"a", "b", "x"}) {
+		t.Errorf("unexpected keys %q and %q", key, child)
+	}
+
+	tree, _ := Load(`a = { b = { c = 42 } }`)
+	if v := tree.GetPath(key); v != int64(42) {
+		t.Errorf("expected a Key to be usable as a path, got %v", v)
+	}
+}
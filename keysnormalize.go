@@ -0,0 +1,70 @@
+// Normalization of arbitrary map keys into bare keys.
+
+package toml
+
+import (
+	"strings"
+	"unicode"
+)
+
+// KeyCollision describes distinct map keys that were normalized to the same
+// bare key by an Encoder configured with NormalizeMapKeys. Only the value of
+// the first original key (in lexicographic order) is written to the output.
+type KeyCollision struct {
+	Path      Key      // path of the table containing the keys
+	Key       string   // normalized key
+	Originals []string // original keys, the first one being the one kept
+}
+
+// Transliteration of common latin characters to their ASCII equivalent.
+var keyTransliterations = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'æ': "ae", 'ç': "c", 'ć': "c", 'č': "c", 'ď': "d", 'đ': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ğ': "g", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'į': "i", 'ı': "i",
+	'ł': "l", 'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o", 'œ': "oe",
+	'ř': "r", 'ś': "s", 'š': "s", 'ş': "s", 'ß': "ss", 'ť': "t", 'ţ': "t", 'þ': "th",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ý': "y", 'ÿ': "y", 'ź': "z", 'ż': "z", 'ž': "z",
+}
+
+// normalizeKey converts k into a snake_case bare key: latin letters are
+// transliterated to ASCII, camelCase humps are split, and any sequence of
+// characters that are not allowed in bare keys becomes a single underscore.
+// The second return value is false when nothing of k could be preserved, in
+// which case k should be quoted instead.
+func normalizeKey(k string) (string, bool) {
+	var b strings.Builder
+	pendingSep := false
+	var prev rune
+
+	write := func(s string) {
+		if pendingSep && b.Len() > 0 {
+			b.WriteByte('_')
+		}
+		pendingSep = false
+		b.WriteString(s)
+	}
+
+	for _, r := range k {
+		lower := unicode.ToLower(r)
+		switch {
+		case r < unicode.MaxASCII && (isAlphanumeric(r) && r != '_' || isDigit(r)):
+			if unicode.IsUpper(r) && (unicode.IsLower(prev) || isDigit(prev)) {
+				pendingSep = true
+			}
+			write(string(lower))
+		case keyTransliterations[lower] != "":
+			write(keyTransliterations[lower])
+		default:
+			pendingSep = true
+		}
+		prev = r
+	}
+
+	if b.Len() == 0 {
+		return k, false
+	}
+	return b.String(), true
+}
@@ -0,0 +1,83 @@
+package toml
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeKey(t *testing.T) {
+	cases := []struct {
+		in       string
+		expected string
+		ok       bool
+	}{
+		{"simple", "simple", true},
+		{"Max Connections", "max_connections", true},
+		{"maxConnections", "max_connections", true},
+		{"HTTPServer", "httpserver", true},
+		{"ipv4Address", "ipv4_address", true},
+		{"Café crème", "cafe_creme", true},
+		{"Straße", "strasse", true},
+		{"  leading/trailing--", "leading_trailing", true},
+		{"a.b", "a_b", true},
+		{"日本", "日本", false},
+	}
+	for _, c := range cases {
+		result, ok := normalizeKey(c.in)
+		if result != c.expected || ok != c.ok {
+			t.Errorf("normalizeKey(%q): expected (%q, %v), got (%q, %v)", c.in, c.expected, c.ok, result, ok)
+		}
+	}
+}
+
+func TestEncoderNormalizeMapKeys(t *testing.T) {
+	data := map[string]interface{}{
+		"Server Name": "main",
+		"servers": map[string]interface{}{
+			"Max Connections": 10,
+			"max-connections": 20,
+			"日本":              "jp",
+		},
+	}
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf).NormalizeMapKeys(true)
+	if err := enc.Encode(data); err != nil {
+		t.Fatal(err)
+	}
+	expected := `server_name = "main"
+
+[servers]
+  max_connections = 10
+  "日本" = "jp"
+`
+	if buf.String() != expected {
+		t.Errorf("Bad marshal: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, buf.String())
+	}
+
+	collisions := enc.KeyCollisions()
+	expectedCollisions := []KeyCollision{{
+		Path:      []string{"servers"},
+		Key:       "max_connections",
+		Originals: []string{"Max Connections", "max-connections"},
+	}}
+	if !reflect.DeepEqual(collisions, expectedCollisions) {
+		t.Errorf("Bad collisions: expected %v, got %v", expectedCollisions, collisions)
+	}
+}
+
+func TestEncoderNormalizeMapKeysDisabled(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := enc.Encode(map[string]interface{}{"Max Connections": 1}); err != nil {
+		t.Fatal(err)
+	}
+	expected := "\"Max Connections\" = 1\n"
+	if buf.String() != expected {
+		t.Errorf("Bad marshal: expected %q, got %q", expected, buf.String())
+	}
+	if len(enc.KeyCollisions()) != 0 {
+		t.Errorf("expected no collisions, got %v", enc.KeyCollisions())
+	}
+}
@@ -0,0 +1,265 @@
+// Unicode normalization and confusable detection of keys.
+
+package toml
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// NormalizeKeys makes the decoder normalize the keys of documents to the
+// Unicode Normalization Form C before matching them, so that "café" written
+// with a precomposed é and with an e followed by a combining acute accent are
+// the same key, both for the fields and map keys they are decoded into and for
+// the detection of duplicate keys. The normalization covers the characters of
+// the alphabetic scripts below U+2000, such as Latin, Greek and Cyrillic.
+func (d *Decoder) NormalizeKeys(v bool) *Decoder {
+	d.normalizeKeys = v
+	return d
+}
+
+// ConfusableKeyPolicy defines how keys that can be mistaken for other keys,
+// such as a key written with a Cyrillic "а" in place of a Latin "a", are
+// handled.
+type ConfusableKeyPolicy int
+
+const (
+	// ConfusableKeysAllow accepts all keys, as required by the
+	// specification.
+	ConfusableKeysAllow ConfusableKeyPolicy = iota
+	// ConfusableKeysWarn accepts confusable keys and reports them by
+	// Warnings.
+	ConfusableKeysWarn
+	// ConfusableKeysError rejects documents holding confusable keys with a
+	// ConfusableKeyError.
+	ConfusableKeysError
+)
+
+// ConfusableKeys sets the policy for keys that can be mistaken for other keys,
+// which is useful when loading security-sensitive configurations written by
+// untrusted parties. A key is confusable if it holds invisible characters, if
+// it mixes letters of several scripts, or if it is written in another script
+// with letters that all look like Latin letters. The policy is
+// ConfusableKeysAllow by default.
+func (d *Decoder) ConfusableKeys(policy ConfusableKeyPolicy) *Decoder {
+	d.confusableKeys = policy
+	return d
+}
+
+// ConfusableKeyError is the error returned when a document holds a
+// confusable key under the ConfusableKeysError policy.
+type ConfusableKeyError struct {
+	Key      Key      // full path of the key
+	Position Position // position of the key
+	Message  string   // reason why the key is confusable
+}
+
+func (e *ConfusableKeyError) Error() string {
+	return fmt.Sprintf("%s: confusable key %s: %s", e.Position, e.Key, e.Message)
+}
+
+// Check the keys of tree under the policy of the decoder, reporting confusable
+// keys as warnings or as an error.
+func (d *Decoder) checkKeys(tree *Tree, path Key) error {
+	if d.confusableKeys == ConfusableKeysAllow || tree == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(tree.values))
+	for k := range tree.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		key := append(path[:len(path):len(path)], k)
+		if message := confusableKey(k); message != "" {
+			pos := tree.GetPositionPath([]string{k})
+			if d.confusableKeys == ConfusableKeysError {
+				return &ConfusableKeyError{Key: key, Position: pos, Message: message}
+			}
+			d.warnings = append(d.warnings, DecodeWarning{Key: key, Position: pos, Message: "confusable key: " + message})
+		}
+		var err error
+		switch node := tree.values[k].(type) {
+		case *Tree:
+			err = d.checkKeys(node, key)
+		case []*Tree:
+			for _, t := range node {
+				if err = d.checkKeys(t, key); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Scripts the letters of keys are checked against.
+var keyScripts = []struct {
+	name  string
+	table *unicode.RangeTable
+}{
+	{"Latin", unicode.Latin},
+	{"Greek", unicode.Greek},
+	{"Cyrillic", unicode.Cyrillic},
+	{"Armenian", unicode.Armenian},
+	{"Hebrew", unicode.Hebrew},
+	{"Arabic", unicode.Arabic},
+	{"Devanagari", unicode.Devanagari},
+	{"Thai", unicode.Thai},
+	{"Georgian", unicode.Georgian},
+	{"Cherokee", unicode.Cherokee},
+	{"Han", unicode.Han},
+	{"Hiragana", unicode.Hiragana},
+	{"Katakana", unicode.Katakana},
+	{"Hangul", unicode.Hangul},
+	{"Bopomofo", unicode.Bopomofo},
+}
+
+// Scripts that are written together with Han characters.
+var hanScripts = map[string]bool{"Han": true, "Hiragana": true, "Katakana": true, "Hangul": true, "Bopomofo": true}
+
+// Letters of other scripts that look like Latin letters.
+var latinHomoglyphs = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'о': 'o', 'р': 'p', 'с': 'c', 'у': 'y', 'х': 'x',
+	'і': 'i', 'ј': 'j', 'ѕ': 's', 'һ': 'h', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'ӏ': 'l',
+	'А': 'A', 'В': 'B', 'Е': 'E', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O', 'Р': 'P',
+	'С': 'C', 'Т': 'T', 'Х': 'X', 'У': 'Y', 'І': 'I', 'Ј': 'J', 'Ѕ': 'S',
+	// Greek
+	'α': 'a', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'υ': 'u',
+	'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I', 'Κ': 'K', 'Μ': 'M',
+	'Ν': 'N', 'Ο': 'O', 'Ρ': 'P', 'Τ': 'T', 'Υ': 'Y', 'Χ': 'X',
+}
+
+// Return why the key k can be mistaken for another key, or the empty string.
+func confusableKey(k string) string {
+	if isASCII(k) {
+		return ""
+	}
+	var scripts []string
+	lookalike, looksLatin := make([]rune, 0, len(k)), true
+	for _, r := range k {
+		if unicode.Is(unicode.Cf, r) || unicode.IsSpace(r) && r != ' ' {
+			return fmt.Sprintf("invisible character %U", r)
+		}
+		if !unicode.IsLetter(r) {
+			lookalike = append(lookalike, r)
+			continue
+		}
+		l, ok := latinHomoglyphs[r]
+		lookalike, looksLatin = append(lookalike, l), looksLatin && ok
+		for _, s := range keyScripts {
+			if !unicode.Is(s.table, r) {
+				continue
+			}
+			if len(scripts) == 0 || scripts[len(scripts)-1] != s.name && !(hanScripts[s.name] && hanScripts[scripts[len(scripts)-1]]) {
+				scripts = append(scripts, s.name)
+			}
+			break
+		}
+	}
+	switch {
+	case len(scripts) > 1:
+		return fmt.Sprintf("mixes the %s and %s scripts", scripts[0], scripts[1])
+	case looksLatin && len(scripts) == 1 && scripts[0] != "Latin":
+		return fmt.Sprintf("%s letters looking like %q", scripts[0], string(lookalike))
+	}
+	return ""
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// Canonical decompositions, the inverse of nfcCompositions.
+var (
+	nfcDecompositions     map[rune][2]rune
+	nfcDecompositionsOnce sync.Once
+)
+
+// Return s in the Unicode Normalization Form C, as far as the tables cover
+// its characters.
+func normalizeNFC(s string) string {
+	if isASCII(s) {
+		return s
+	}
+	nfcDecompositionsOnce.Do(func() {
+		nfcDecompositions = make(map[rune][2]rune, len(nfcCompositions))
+		for pair, r := range nfcCompositions {
+			nfcDecompositions[r] = pair
+		}
+	})
+
+	// canonical decomposition
+	runes := make([]rune, 0, len(s)+4)
+	for _, r := range s {
+		runes = decomposeRune(runes, r)
+	}
+
+	// canonical ordering of the combining marks
+	for i := 1; i < len(runes); i++ {
+		for j := i; j > 0; j-- {
+			class := combiningClass(runes[j])
+			if class == 0 || combiningClass(runes[j-1]) <= class {
+				break
+			}
+			runes[j-1], runes[j] = runes[j], runes[j-1]
+		}
+	}
+
+	// canonical composition
+	composed := runes[:0]
+	starter, lastClass := -1, -1 // lastClass is -1 when following the starter
+	for _, r := range runes {
+		class := int(combiningClass(r))
+		if starter >= 0 && lastClass < class {
+			if c, ok := nfcCompositions[[2]rune{composed[starter], r}]; ok {
+				composed[starter] = c
+				continue
+			}
+		}
+		if class == 0 {
+			starter, lastClass = len(composed), -1
+		} else {
+			lastClass = class
+		}
+		composed = append(composed, r)
+	}
+	return string(composed)
+}
+
+// Append the canonical decomposition of r to runes.
+func decomposeRune(runes []rune, r rune) []rune {
+	if pair, ok := nfcDecompositions[r]; ok {
+		return append(decomposeRune(runes, pair[0]), pair[1])
+	}
+	if parts, ok := nfcExclusions[r]; ok {
+		for _, part := range parts {
+			runes = decomposeRune(runes, part)
+		}
+		return runes
+	}
+	return append(runes, r)
+}
+
+// Return the canonical combining class of r, 0 for starters.
+func combiningClass(r rune) uint8 {
+	i := sort.Search(len(nfcCombiningClasses), func(i int) bool {
+		return nfcCombiningClasses[i].hi >= r
+	})
+	if i < len(nfcCombiningClasses) && nfcCombiningClasses[i].lo <= r {
+		return nfcCombiningClasses[i].class
+	}
+	return 0
+}
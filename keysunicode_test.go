@@ -0,0 +1,107 @@
+package toml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeNFC(t *testing.T) {
+	cases := map[string]string{
+		"plain":              "plain",
+		"caf\u00e9":          "caf\u00e9",
+		"cafe\u0301":         "caf\u00e9",
+		"A\u030a":            "\u00c5",
+		"\u212b":             "\u212b", // outside of the tables
+		"e\u0323\u0302":      "\u1ec7",
+		"e\u0302\u0323":      "\u1ec7",
+		"\u00ea\u0323":       "\u1ec7",
+		"\u0438\u0306":       "\u0439",
+		"\u0958":             "\u0915\u093c", // excluded from composition
+		"o\u0308\u0304x":     "\u022bx",
+		"a\u0301\u0301":      "\u00e1\u0301",
+		"\u0391\u0301\u0345": "\u0386\u0345",
+	}
+	for in, expected := range cases {
+		if result := normalizeNFC(in); result != expected {
+			t.Errorf("normalizeNFC(%+q): expected %+q, got %+q", in, expected, result)
+		}
+	}
+}
+
+func TestConfusableKey(t *testing.T) {
+	cases := map[string]string{
+		"path":               "",
+		"café":               "",
+		"日本語":                "",
+		"ひらがなと漢字":            "",
+		"πόλη":               "",
+		"москва":             "",
+		"\u0440\u0430th":     "mixes the Cyrillic and Latin scripts",
+		"p\u0430th":          "mixes the Latin and Cyrillic scripts",
+		"\u0440\u043e\u0440": `Cyrillic letters looking like "pop"`,
+		"\u0391\u0392_1":     `Greek letters looking like "AB_1"`,
+		"admin\u200b":        "invisible character U+200B",
+		"user\u00a0name":     "invisible character U+00A0",
+	}
+	for key, expected := range cases {
+		if result := confusableKey(key); result != expected {
+			t.Errorf("confusableKey(%q): expected %q, got %q", key, expected, result)
+		}
+	}
+}
+
+func TestDecoderNormalizeKeys(t *testing.T) {
+	doc := "\"caf\u00e9\" = 1\n[tables]\n\"cafe\u0301\" = 2\n"
+	var v struct {
+		Cafe   int `toml:"caf\u00e9"`
+		Tables map[string]int
+	}
+	if err := NewDecoder(strings.NewReader(doc)).NormalizeKeys(true).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Cafe != 1 || !reflect.DeepEqual(v.Tables, map[string]int{"caf\u00e9": 2}) {
+		t.Errorf("unexpected values %+v", v)
+	}
+
+	doc = "\"caf\u00e9\" = 1\n\"cafe\u0301\" = 2\n"
+	var m map[string]int
+	if err := NewDecoder(strings.NewReader(doc)).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 2 {
+		t.Errorf("keys normalized by default: %q", m)
+	}
+	err := NewDecoder(strings.NewReader(doc)).NormalizeKeys(true).Decode(&m)
+	assertErrorString(t, "(2, 1): The following key was defined twice: caf\u00e9 (previously defined at (1, 1))", err)
+}
+
+func TestDecoderConfusableKeys(t *testing.T) {
+	doc := "path = 1\n[servers]\n\"\u0440\u0430th\" = 2\nname = \"ok\"\n[[users]]\n\"admin\u200b\" = true\n"
+	var m map[string]interface{}
+	d := NewDecoder(strings.NewReader(doc)).ConfusableKeys(ConfusableKeysWarn)
+	if err := d.Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	var warnings []string
+	for _, w := range d.Warnings() {
+		warnings = append(warnings, w.String())
+	}
+	expected := []string{
+		"(3, 1): servers.\"\u0440\u0430th\": confusable key: mixes the Cyrillic and Latin scripts",
+		"(6, 1): users.\"admin\u200b\": confusable key: invisible character U+200B",
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("expected warnings\n%q\ngot\n%q", expected, warnings)
+	}
+
+	err := NewDecoder(strings.NewReader(doc)).ConfusableKeys(ConfusableKeysError).Decode(&m)
+	assertErrorString(t, "(3, 1): confusable key servers.\"\u0440\u0430th\": mixes the Cyrillic and Latin scripts", err)
+	if e, ok := err.(*ConfusableKeyError); !ok || e.Key.String() != "servers.\"\u0440\u0430th\"" {
+		t.Errorf("unexpected error %#v", err)
+	}
+
+	if err := NewDecoder(strings.NewReader(doc)).Decode(&m); err != nil {
+		t.Errorf("confusable keys rejected by default: %s", err)
+	}
+}
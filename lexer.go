@@ -11,15 +11,17 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 // Define state functions
-type tomlLexStateFn func() tomlLexStateFn
+type tomlLexStateFn func(*tomlLexer) tomlLexStateFn
 
-// Define lexer
+// Define lexer. Indexes are byte offsets in the input, so that the values of
+// tokens are substrings of the input rather than copies.
 type tomlLexer struct {
 	inputIdx          int
-	input             []rune // Textual source
+	input             string // Textual source
 	currentTokenStart int
 	currentTokenStop  int
 	tokens            []token
@@ -28,28 +30,29 @@ type tomlLexer struct {
 	col               int
 	endbufferLine     int
 	endbufferCol      int
+	version           TOMLVersion
 }
 
 // Basic read operations on input
 
-func (l *tomlLexer) read() rune {
-	r := l.peek()
+func (l *tomlLexer) read() (rune, int) {
+	r, size := l.peekSize()
 	if r == '\n' {
 		l.endbufferLine++
 		l.endbufferCol = 1
 	} else {
 		l.endbufferCol++
 	}
-	l.inputIdx++
-	return r
+	l.inputIdx += size
+	if r == eof {
+		l.inputIdx++
+	}
+	return r, size
 }
 
 func (l *tomlLexer) next() rune {
-	r := l.read()
-
-	if r != eof {
-		l.currentTokenStop++
-	}
+	r, size := l.read()
+	l.currentTokenStop += size
 	return r
 }
 
@@ -80,27 +83,39 @@ func (l *tomlLexer) emitWithValue(t tokenType, value string) {
 }
 
 func (l *tomlLexer) emit(t tokenType) {
-	l.emitWithValue(t, string(l.input[l.currentTokenStart:l.currentTokenStop]))
+	l.emitWithValue(t, l.input[l.currentTokenStart:l.currentTokenStop])
 }
 
 func (l *tomlLexer) peek() rune {
+	r, _ := l.peekSize()
+	return r
+}
+
+// Next rune of the input and its size in bytes.
+func (l *tomlLexer) peekSize() (rune, int) {
 	if l.inputIdx >= len(l.input) {
-		return eof
+		return eof, 0
+	}
+	if c := l.input[l.inputIdx]; c < utf8.RuneSelf {
+		return rune(c), 1
 	}
-	return l.input[l.inputIdx]
+	return utf8.DecodeRuneInString(l.input[l.inputIdx:])
 }
 
+// Next size bytes of the input, or less at its end. Only used to look ahead
+// for ASCII characters.
 func (l *tomlLexer) peekString(size int) string {
-	maxIdx := len(l.input)
-	upperIdx := l.inputIdx + size // FIXME: potential overflow
-	if upperIdx > maxIdx {
-		upperIdx = maxIdx
+	if l.inputIdx >= len(l.input) {
+		return ""
+	}
+	if rest := l.input[l.inputIdx:]; len(rest) > size {
+		return rest[:size]
 	}
-	return string(l.input[l.inputIdx:upperIdx])
+	return l.input[l.inputIdx:]
 }
 
 func (l *tomlLexer) follow(next string) bool {
-	return next == l.peekString(len(next))
+	return l.inputIdx < len(l.input) && strings.HasPrefix(l.input[l.inputIdx:], next)
 }
 
 // Error management
@@ -121,16 +136,19 @@ func (l *tomlLexer) lexVoid() tomlLexStateFn {
 		next := l.peek()
 		switch next {
 		case '}': // after '{'
-			return l.lexRightCurlyBrace
+			return (*tomlLexer).lexRightCurlyBrace
 		case '[':
-			return l.lexTableKey
+			return (*tomlLexer).lexTableKey
 		case '#':
-			return l.lexComment(l.lexVoid)
+			return l.lexComment((*tomlLexer).lexVoid)
 		case '=':
-			return l.lexEqual
+			return (*tomlLexer).lexEqual
 		case '\r':
 			fallthrough
 		case '\n':
+			if l.inInlineTable() && l.version < TOML11 {
+				return l.errorf("newlines are not allowed in inline tables")
+			}
 			l.skip()
 			continue
 		}
@@ -140,7 +158,7 @@ func (l *tomlLexer) lexVoid() tomlLexStateFn {
 		}
 
 		if isKeyStartChar(next) {
-			return l.lexKey
+			return (*tomlLexer).lexKey
 		}
 
 		if next == eof {
@@ -160,47 +178,50 @@ func (l *tomlLexer) lexRvalue() tomlLexStateFn {
 		case '.':
 			return l.errorf("cannot start float with a dot")
 		case '=':
-			return l.lexEqual
+			return (*tomlLexer).lexEqual
 		case '[':
-			return l.lexLeftBracket
+			return (*tomlLexer).lexLeftBracket
 		case ']':
-			return l.lexRightBracket
+			return (*tomlLexer).lexRightBracket
 		case '{':
-			return l.lexLeftCurlyBrace
+			return (*tomlLexer).lexLeftCurlyBrace
 		case '}':
-			return l.lexRightCurlyBrace
+			return (*tomlLexer).lexRightCurlyBrace
 		case '#':
-			return l.lexComment(l.lexRvalue)
+			return l.lexComment((*tomlLexer).lexRvalue)
 		case '"':
-			return l.lexString
+			return (*tomlLexer).lexString
 		case '\'':
-			return l.lexLiteralString
+			return (*tomlLexer).lexLiteralString
 		case ',':
-			return l.lexComma
+			return (*tomlLexer).lexComma
 		case '\r':
 			fallthrough
 		case '\n':
+			if l.inInlineTable() && l.version < TOML11 {
+				return l.errorf("newlines are not allowed in inline tables")
+			}
 			l.skip()
 			if len(l.brackets) > 0 && l.brackets[len(l.brackets)-1] == '[' {
-				return l.lexRvalue
+				return (*tomlLexer).lexRvalue
 			}
-			return l.lexVoid
+			return (*tomlLexer).lexVoid
 		}
 
 		if l.follow("true") {
-			return l.lexTrue
+			return (*tomlLexer).lexTrue
 		}
 
 		if l.follow("false") {
-			return l.lexFalse
+			return (*tomlLexer).lexFalse
 		}
 
 		if l.follow("inf") {
-			return l.lexInf
+			return (*tomlLexer).lexInf
 		}
 
 		if l.follow("nan") {
-			return l.lexNan
+			return (*tomlLexer).lexNan
 		}
 
 		if isSpace(next) {
@@ -214,11 +235,11 @@ func (l *tomlLexer) lexRvalue() tomlLexStateFn {
 		}
 
 		if next == '+' || next == '-' {
-			return l.lexNumber
+			return (*tomlLexer).lexNumber
 		}
 
 		if isDigit(next) {
-			return l.lexDateTimeOrNumber
+			return (*tomlLexer).lexDateTimeOrNumber
 		}
 
 		return l.errorf("no value can start with %c", next)
@@ -258,7 +279,7 @@ func (l *tomlLexer) lexLeftCurlyBrace() tomlLexStateFn {
 	l.next()
 	l.emit(tokenLeftCurlyBrace)
 	l.brackets = append(l.brackets, '{')
-	return l.lexVoid
+	return (*tomlLexer).lexVoid
 }
 
 func (l *tomlLexer) lexRightCurlyBrace() tomlLexStateFn {
@@ -268,7 +289,7 @@ func (l *tomlLexer) lexRightCurlyBrace() tomlLexStateFn {
 		return l.errorf("cannot have '}' here")
 	}
 	l.brackets = l.brackets[:len(l.brackets)-1]
-	return l.lexRvalue
+	return (*tomlLexer).lexRvalue
 }
 
 func (l *tomlLexer) lexDateTimeOrTime() tomlLexStateFn {
@@ -346,23 +367,20 @@ func (l *tomlLexer) lexDateTime() tomlLexStateFn {
 
 	r = l.peek()
 
-	if r == eof {
-
-		return l.lexRvalue
-	}
-
-	if r != ' ' && r != 'T' {
-		return l.errorf("incorrect date/time separation character: %c", r)
+	// a local date can be followed by anything that can follow a value, in
+	// which case there is no time to lex.
+	if r != ' ' && r != 'T' && r != 't' {
+		return (*tomlLexer).lexRvalue
 	}
 
 	if r == ' ' {
 		lookAhead := l.peekString(3)[1:]
 		if len(lookAhead) < 2 {
-			return l.lexRvalue
+			return (*tomlLexer).lexRvalue
 		}
 		for _, r := range lookAhead {
 			if !isDigit(r) {
-				return l.lexRvalue
+				return (*tomlLexer).lexRvalue
 			}
 		}
 	}
@@ -390,6 +408,10 @@ func (l *tomlLexer) lexDateTime() tomlLexStateFn {
 		}
 	}
 
+	if l.omitsSeconds() {
+		return (*tomlLexer).lexTimeOffset
+	}
+
 	r = l.next()
 	if r != ':' {
 		return l.errorf("time minute/second separator should be :, not %c", r)
@@ -421,7 +443,7 @@ func (l *tomlLexer) lexDateTime() tomlLexStateFn {
 
 	l.emit(tokenLocalTime)
 
-	return l.lexTimeOffset
+	return (*tomlLexer).lexTimeOffset
 
 }
 
@@ -435,9 +457,9 @@ func (l *tomlLexer) lexTimeOffset() tomlLexStateFn {
 
 	r := l.peek()
 
-	if r == 'Z' {
+	if r == 'Z' || r == 'z' {
 		l.next()
-		l.emit(tokenTimeOffset)
+		l.emitWithValue(tokenTimeOffset, "Z")
 	} else if r == '+' || r == '-' {
 		l.next()
 
@@ -463,7 +485,17 @@ func (l *tomlLexer) lexTimeOffset() tomlLexStateFn {
 		l.emit(tokenTimeOffset)
 	}
 
-	return l.lexRvalue
+	return (*tomlLexer).lexRvalue
+}
+
+// Emit the local time lexed so far when it has no seconds, which TOML 1.1
+// allows, completing it with zero seconds.
+func (l *tomlLexer) omitsSeconds() bool {
+	if l.version < TOML11 || l.peek() == ':' {
+		return false
+	}
+	l.emitWithValue(tokenLocalTime, l.input[l.currentTokenStart:l.currentTokenStop]+":00")
+	return true
 }
 
 func (l *tomlLexer) lexTime() tomlLexStateFn {
@@ -478,6 +510,10 @@ func (l *tomlLexer) lexTime() tomlLexStateFn {
 		}
 	}
 
+	if l.omitsSeconds() {
+		return (*tomlLexer).lexRvalue
+	}
+
 	r := l.next()
 	if r != ':' {
 		return l.errorf("time minute/second separator should be :, not %c", r)
@@ -508,47 +544,52 @@ func (l *tomlLexer) lexTime() tomlLexStateFn {
 	}
 
 	l.emit(tokenLocalTime)
-	return l.lexRvalue
+	return (*tomlLexer).lexRvalue
 
 }
 
 func (l *tomlLexer) lexTrue() tomlLexStateFn {
 	l.fastForward(4)
 	l.emit(tokenTrue)
-	return l.lexRvalue
+	return (*tomlLexer).lexRvalue
 }
 
 func (l *tomlLexer) lexFalse() tomlLexStateFn {
 	l.fastForward(5)
 	l.emit(tokenFalse)
-	return l.lexRvalue
+	return (*tomlLexer).lexRvalue
 }
 
 func (l *tomlLexer) lexInf() tomlLexStateFn {
 	l.fastForward(3)
 	l.emit(tokenInf)
-	return l.lexRvalue
+	return (*tomlLexer).lexRvalue
 }
 
 func (l *tomlLexer) lexNan() tomlLexStateFn {
 	l.fastForward(3)
 	l.emit(tokenNan)
-	return l.lexRvalue
+	return (*tomlLexer).lexRvalue
 }
 
 func (l *tomlLexer) lexEqual() tomlLexStateFn {
 	l.next()
 	l.emit(tokenEqual)
-	return l.lexRvalue
+	return (*tomlLexer).lexRvalue
+}
+
+// Whether the innermost bracket being lexed is that of an inline table.
+func (l *tomlLexer) inInlineTable() bool {
+	return len(l.brackets) > 0 && l.brackets[len(l.brackets)-1] == '{'
 }
 
 func (l *tomlLexer) lexComma() tomlLexStateFn {
 	l.next()
 	l.emit(tokenComma)
-	if len(l.brackets) > 0 && l.brackets[len(l.brackets)-1] == '{' {
-		return l.lexVoid
+	if l.inInlineTable() {
+		return (*tomlLexer).lexVoid
 	}
-	return l.lexRvalue
+	return (*tomlLexer).lexRvalue
 }
 
 // Parse the key and emits its value without escape sequences.
@@ -556,8 +597,18 @@ func (l *tomlLexer) lexComma() tomlLexStateFn {
 func (l *tomlLexer) lexKey() tomlLexStateFn {
 	var sb strings.Builder
 
+	// bare and dotted keys are substrings of the input, other keys are
+	// rewritten in sb from the first quote or space around a dot
+	start, plain := l.inputIdx, true
+	rewrite := func(end int) {
+		if plain {
+			sb.WriteString(l.input[start:end])
+			plain = false
+		}
+	}
 	for r := l.peek(); isKeyChar(r) || r == '\n' || r == '\r'; r = l.peek() {
 		if r == '"' {
+			rewrite(l.inputIdx)
 			l.next()
 			str, err := l.lexStringAsString(`"`, false, true)
 			if err != nil {
@@ -569,6 +620,7 @@ func (l *tomlLexer) lexKey() tomlLexStateFn {
 			l.next()
 			continue
 		} else if r == '\'' {
+			rewrite(l.inputIdx)
 			l.next()
 			str, err := l.lexLiteralStringAsString(`'`, false)
 			if err != nil {
@@ -582,6 +634,7 @@ func (l *tomlLexer) lexKey() tomlLexStateFn {
 		} else if r == '\n' {
 			return l.errorf("keys cannot contain new lines")
 		} else if isSpace(r) {
+			end := l.inputIdx
 			var str strings.Builder
 			str.WriteString(" ")
 
@@ -593,8 +646,13 @@ func (l *tomlLexer) lexKey() tomlLexStateFn {
 			}
 			// break loop if not a dot
 			if r != '.' {
+				if plain {
+					l.emitWithValue(tokenKey, l.input[start:end])
+					return (*tomlLexer).lexVoid
+				}
 				break
 			}
+			rewrite(end)
 			str.WriteString(".")
 			// skip trailing whitespace after dot
 			l.next()
@@ -609,15 +667,21 @@ func (l *tomlLexer) lexKey() tomlLexStateFn {
 		} else if !isValidBareChar(r) {
 			return l.errorf("keys cannot contain %c character", r)
 		}
-		sb.WriteRune(r)
+		if !plain {
+			sb.WriteRune(r)
+		}
 		l.next()
 	}
-	l.emitWithValue(tokenKey, sb.String())
-	return l.lexVoid
+	if plain {
+		l.emitWithValue(tokenKey, l.input[start:l.inputIdx])
+	} else {
+		l.emitWithValue(tokenKey, sb.String())
+	}
+	return (*tomlLexer).lexVoid
 }
 
 func (l *tomlLexer) lexComment(previousState tomlLexStateFn) tomlLexStateFn {
-	return func() tomlLexStateFn {
+	return func(l *tomlLexer) tomlLexStateFn {
 		for next := l.peek(); next != '\n' && next != eof; next = l.peek() {
 			if next == '\r' && l.follow("\r\n") {
 				break
@@ -633,12 +697,10 @@ func (l *tomlLexer) lexLeftBracket() tomlLexStateFn {
 	l.next()
 	l.emit(tokenLeftBracket)
 	l.brackets = append(l.brackets, '[')
-	return l.lexRvalue
+	return (*tomlLexer).lexRvalue
 }
 
 func (l *tomlLexer) lexLiteralStringAsString(terminator string, discardLeadingNewLine bool) (string, error) {
-	var sb strings.Builder
-
 	if discardLeadingNewLine {
 		if l.follow("\r\n") {
 			l.skip()
@@ -649,16 +711,17 @@ func (l *tomlLexer) lexLiteralStringAsString(terminator string, discardLeadingNe
 	}
 
 	// find end of string
+	start := l.inputIdx
 	for {
 		if l.follow(terminator) {
-			return sb.String(), nil
+			return l.input[start:l.inputIdx], nil
 		}
 
 		next := l.peek()
 		if next == eof {
 			break
 		}
-		sb.WriteRune(l.next())
+		l.next()
 	}
 
 	return "", errors.New("unclosed string")
@@ -685,7 +748,7 @@ func (l *tomlLexer) lexLiteralString() tomlLexStateFn {
 	l.emitWithValue(tokenString, str)
 	l.fastForward(len(terminator))
 	l.ignore()
-	return l.lexRvalue
+	return (*tomlLexer).lexRvalue
 }
 
 // Lex a string and return the results as a string.
@@ -703,12 +766,21 @@ func (l *tomlLexer) lexStringAsString(terminator string, discardLeadingNewLine,
 		}
 	}
 
+	// until the first escape sequence, the string is a substring of the input
+	start, escaped := l.inputIdx, false
 	for {
 		if l.follow(terminator) {
+			if !escaped {
+				return l.input[start:l.inputIdx], nil
+			}
 			return sb.String(), nil
 		}
 
 		if l.follow("\\") {
+			if !escaped {
+				sb.WriteString(l.input[start:l.inputIdx])
+				escaped = true
+			}
 			l.next()
 			switch l.peek() {
 			case '\r':
@@ -746,6 +818,28 @@ func (l *tomlLexer) lexStringAsString(terminator string, discardLeadingNewLine,
 			case '\\':
 				sb.WriteString("\\")
 				l.next()
+			case 'e':
+				if l.version < TOML11 {
+					return "", errors.New("invalid escape sequence: \\e")
+				}
+				sb.WriteString("\x1b")
+				l.next()
+			case 'x':
+				if l.version < TOML11 {
+					return "", errors.New("invalid escape sequence: \\x")
+				}
+				l.next()
+				var code strings.Builder
+				for i := 0; i < 2; i++ {
+					c := l.peek()
+					if !isHexDigit(c) {
+						return "", errors.New("unfinished hexadecimal escape")
+					}
+					l.next()
+					code.WriteRune(c)
+				}
+				intcode, _ := strconv.ParseInt(code.String(), 16, 32)
+				sb.WriteRune(rune(intcode))
 			case 'u':
 				l.next()
 				var code strings.Builder
@@ -788,7 +882,9 @@ func (l *tomlLexer) lexStringAsString(terminator string, discardLeadingNewLine,
 				return "", fmt.Errorf("unescaped control character %U", r)
 			}
 			l.next()
-			sb.WriteRune(r)
+			if escaped {
+				sb.WriteRune(r)
+			}
 		}
 
 		if l.peek() == eof {
@@ -822,7 +918,7 @@ func (l *tomlLexer) lexString() tomlLexStateFn {
 	l.emitWithValue(tokenString, str)
 	l.fastForward(len(terminator))
 	l.ignore()
-	return l.lexRvalue
+	return (*tomlLexer).lexRvalue
 }
 
 func (l *tomlLexer) lexTableKey() tomlLexStateFn {
@@ -832,11 +928,11 @@ func (l *tomlLexer) lexTableKey() tomlLexStateFn {
 		// token '[[' signifies an array of tables
 		l.next()
 		l.emit(tokenDoubleLeftBracket)
-		return l.lexInsideTableArrayKey
+		return (*tomlLexer).lexInsideTableArrayKey
 	}
 	// vanilla table key
 	l.emit(tokenLeftBracket)
-	return l.lexInsideTableKey
+	return (*tomlLexer).lexInsideTableKey
 }
 
 // Parse the key till "]]", but only bare keys are supported
@@ -853,7 +949,7 @@ func (l *tomlLexer) lexInsideTableArrayKey() tomlLexStateFn {
 			}
 			l.next()
 			l.emit(tokenDoubleRightBracket)
-			return l.lexVoid
+			return (*tomlLexer).lexVoid
 		case '[':
 			return l.errorf("table array key cannot contain ']'")
 		default:
@@ -873,7 +969,7 @@ func (l *tomlLexer) lexInsideTableKey() tomlLexStateFn {
 			}
 			l.next()
 			l.emit(tokenRightBracket)
-			return l.lexVoid
+			return (*tomlLexer).lexVoid
 		case '[':
 			return l.errorf("table key cannot contain ']'")
 		default:
@@ -890,7 +986,7 @@ func (l *tomlLexer) lexRightBracket() tomlLexStateFn {
 		return l.errorf("cannot have ']' here")
 	}
 	l.brackets = l.brackets[:len(l.brackets)-1]
-	return l.lexRvalue
+	return (*tomlLexer).lexRvalue
 }
 
 type validRuneFn func(r rune) bool
@@ -949,7 +1045,7 @@ func (l *tomlLexer) lexNumber() tomlLexStateFn {
 
 				l.emit(tokenInteger)
 
-				return l.lexRvalue
+				return (*tomlLexer).lexRvalue
 			}
 		}
 	}
@@ -957,10 +1053,10 @@ func (l *tomlLexer) lexNumber() tomlLexStateFn {
 	if r == '+' || r == '-' {
 		l.next()
 		if l.follow("inf") {
-			return l.lexInf
+			return (*tomlLexer).lexInf
 		}
 		if l.follow("nan") {
-			return l.lexNan
+			return (*tomlLexer).lexNan
 		}
 	}
 
@@ -1006,25 +1102,34 @@ func (l *tomlLexer) lexNumber() tomlLexStateFn {
 	} else {
 		l.emit(tokenInteger)
 	}
-	return l.lexRvalue
+	return (*tomlLexer).lexRvalue
 }
 
 func (l *tomlLexer) run() {
-	for state := l.lexVoid; state != nil; {
-		state = state()
+	for state := tomlLexStateFn((*tomlLexer).lexVoid); state != nil; {
+		state = state(l)
 	}
 }
 
 // Entry point
 func lexToml(inputBytes []byte) []token {
-	runes := bytes.Runes(inputBytes)
+	return lexTomlVersion(inputBytes, TOML10)
+}
+
+func lexTomlVersion(inputBytes []byte, version TOMLVersion) []token {
+	input := string(inputBytes)
+	if !utf8.ValidString(input) {
+		// invalid bytes become U+FFFD
+		input = string(bytes.Runes(inputBytes))
+	}
 	l := &tomlLexer{
-		input:         runes,
-		tokens:        make([]token, 0, 256),
+		input:         input,
+		tokens:        getTokens(),
 		line:          1,
 		col:           1,
 		endbufferLine: 1,
 		endbufferCol:  1,
+		version:       version,
 	}
 	l.run()
 	return l.tokens
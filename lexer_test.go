@@ -195,6 +195,15 @@ func TestKeyEqualStringEscape(t *testing.T) {
 	})
 }
 
+func TestKeyEqualStringInvalidUTF8(t *testing.T) {
+	testFlow(t, "foo = \"h\xffé\\t\"", []token{
+		{Position{1, 1}, tokenKey, "foo"},
+		{Position{1, 5}, tokenEqual, "="},
+		{Position{1, 8}, tokenString, "h\uFFFDé\t"},
+		{Position{1, 14}, tokenEOF, ""},
+	})
+}
+
 func TestKeyEqualStringUnfinished(t *testing.T) {
 	testFlow(t, `foo = "bar`, []token{
 		{Position{1, 1}, tokenKey, "foo"},
@@ -1240,6 +1249,25 @@ pluralizeListTitles = false
 	url = "https://github.com/spf13/hugo/releases"
 	weight = -200
 `
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lexToml([]byte(sample))
+	}
+}
+
+func BenchmarkLexerEscapes(b *testing.B) {
+	sample := `"quoted key" = "tab\there, \"quotes\" and \u00e9"
+'literal key' = 'C:\Users\nobody'
+name = "Ünïcödé ✓ ☃"
+text = """
+first line \
+  continued\nsecond line"""
+path = '''
+raw \n text
+'''
+`
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		lexToml([]byte(sample))
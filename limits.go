@@ -0,0 +1,82 @@
+// Limits of Decoders for untrusted input.
+
+package toml
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Limits set on a Decoder, zero meaning no limit.
+type decoderLimits struct {
+	maxInputBytes  int64
+	maxArrayLength int
+	maxKeys        int
+}
+
+// MaxInputBytes sets the maximum size of the input of the decoder. Decoding
+// a larger input fails without reading more than n+1 bytes. The default, 0,
+// sets no limit.
+func (d *Decoder) MaxInputBytes(n int64) *Decoder {
+	d.limits.maxInputBytes = n
+	return d
+}
+
+// MaxArrayLength sets the maximum number of elements of arrays and arrays of
+// tables of the decoded document, checked while parsing. The default, 0, sets
+// no limit.
+func (d *Decoder) MaxArrayLength(n int) *Decoder {
+	d.limits.maxArrayLength = n
+	return d
+}
+
+// MaxKeys sets the maximum number of keys of the decoded document, counting
+// key/value pairs, including those of inline tables, and table headers. It is
+// checked while parsing. The default, 0, sets no limit.
+func (d *Decoder) MaxKeys(n int) *Decoder {
+	d.limits.maxKeys = n
+	return d
+}
+
+// DecodeContext is like Decode, but stops with the error of ctx once ctx is
+// done. Cancellation is checked between reads of the input, between the lines
+// of the document while parsing, and between tables while decoding. A read
+// blocked on the input is not interrupted: network connections need a
+// deadline for that.
+func (d *Decoder) DecodeContext(ctx context.Context, v interface{}) error {
+	d.ctx = ctx
+	defer func() { d.ctx = nil }()
+	return d.Decode(v)
+}
+
+// Whether the context of DecodeContext is done.
+func (d *Decoder) canceled() bool {
+	return d.ctx != nil && d.ctx.Err() != nil
+}
+
+// Options of the parser of the input.
+func (d *Decoder) parseOptions() parseOptions {
+	maxDepth := d.maxDepth
+	if maxDepth == 0 {
+		maxDepth = defaultMaxDepth
+	} else if maxDepth < 0 {
+		maxDepth = 0
+	}
+	return parseOptions{
+		version:        d.version,
+		ctx:            d.ctx,
+		maxDepth:       maxDepth,
+		maxArrayLength: d.limits.maxArrayLength,
+		maxKeys:        d.limits.maxKeys,
+		latin1:         d.latin1,
+		normalizeKeys:  d.normalizeKeys,
+	}
+}
+
+// Returned by decoderInput when the input exceeds MaxInputBytes.
+var errInputTooLarge = errors.New("input too large")
+
+func inputTooLargeError(max int64) error {
+	return fmt.Errorf("input exceeds the maximum size of %d bytes", max)
+}
@@ -0,0 +1,110 @@
+package toml
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Reader counting the bytes read from it.
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+func TestDecoderMaxInputBytes(t *testing.T) {
+	doc := "a = 1\nb = 2\n"
+	var m map[string]interface{}
+	if err := NewDecoder(strings.NewReader(doc)).MaxInputBytes(int64(len(doc))).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &countingReader{r: strings.NewReader(doc + strings.Repeat("# padding\n", 1000))}
+	err := NewDecoder(r).MaxInputBytes(int64(len(doc))).Decode(&m)
+	assertErrorString(t, "input exceeds the maximum size of 12 bytes", err)
+	if r.read != len(doc)+1 {
+		t.Errorf("expected %d bytes to be read, got %d", len(doc)+1, r.read)
+	}
+}
+
+func TestDecoderMaxArrayLength(t *testing.T) {
+	var m map[string]interface{}
+	d := NewDecoder(strings.NewReader("a = [1, 2]\nb = [[3], [4, 5]]\n")).MaxArrayLength(2)
+	if err := d.Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+
+	err := NewDecoder(strings.NewReader("a = [1, 2, 3]\n")).MaxArrayLength(2).Decode(&m)
+	assertErrorString(t, "(1, 12): maximum array length of 2 exceeded", err)
+
+	err = NewDecoder(strings.NewReader("[[t]]\n[[t]]\n[[t]]\n")).MaxArrayLength(2).Decode(&m)
+	assertErrorString(t, "(3, 3): maximum array length of 2 exceeded", err)
+}
+
+func TestDecoderMaxKeys(t *testing.T) {
+	var m map[string]interface{}
+	doc := "a = 1\n[t]\nb = { c = 1 }\n"
+	if err := NewDecoder(strings.NewReader(doc)).MaxKeys(4).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	err := NewDecoder(strings.NewReader(doc)).MaxKeys(3).Decode(&m)
+	assertErrorString(t, "(3, 7): maximum number of keys of 3 exceeded", err)
+}
+
+func TestDecoderMaxDepthWhileParsing(t *testing.T) {
+	var m map[string]interface{}
+	doc := "a = [[1], { b = [2] }]\n"
+	if err := NewDecoder(strings.NewReader(doc)).MaxDepth(3).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	err := NewDecoder(strings.NewReader("a = [[[1]]]\n")).MaxDepth(2).Decode(&m)
+	assertErrorString(t, "(1, 8): maximum depth of 2 exceeded", err)
+
+	// the default limit protects the parser from deeply nested input
+	deep := "a = " + strings.Repeat("[", 2000) + strings.Repeat("]", 2000) + "\n"
+	err = NewDecoder(strings.NewReader(deep)).Decode(&m)
+	assertErrorString(t, "(1, 1006): maximum depth of 1000 exceeded", err)
+	if _, err := Load(deep); err != nil {
+		t.Errorf("Load should not be limited, got %s", err)
+	}
+}
+
+func TestDecodeContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var m map[string]interface{}
+	if err := NewDecoder(strings.NewReader("a = 1\n")).DecodeContext(ctx, &m); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	// canceled while decoding, by a hook
+	type config struct {
+		A struct{ V int }
+		B struct{ V int }
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	hook := func(from, to reflect.Type, data interface{}) (interface{}, error) {
+		cancel()
+		return data, nil
+	}
+	var c config
+	d := NewDecoder(strings.NewReader("[A]\nV = 1\n[B]\nV = 2\n")).DecodeHook(hook).CollectErrors(true)
+	if err := d.DecodeContext(ctx, &c); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	// the decoder can be used without a context afterwards
+	c = config{}
+	if err := NewDecoder(strings.NewReader("[A]\nV = 1\n")).DecodeContext(context.Background(), &c); err != nil || c.A.V != 1 {
+		t.Errorf("unexpected result %+v, %v", c, err)
+	}
+}
@@ -0,0 +1,520 @@
+// Linting of TOML documents.
+
+package toml
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Identifiers of the rules applied by Lint.
+const (
+	// LintDuplicateTable reports tables whose header appears more than once.
+	// The spec forbids it, but relaxed parsers merge the definitions.
+	LintDuplicateTable = "duplicate-table"
+	// LintTableOrder reports tables defined away from the other tables
+	// sharing their top-level key.
+	LintTableOrder = "table-order"
+	// LintMixedArray reports arrays whose elements are not all of the same
+	// type. TOML allows them, but they usually denote a mistake and many
+	// tools cannot represent them.
+	LintMixedArray = "mixed-array"
+	// LintSuspiciousKey reports bare keys likely written by mistake: keys
+	// looking like values, dotted keys looking like decimal numbers, and keys
+	// differing only by case from another key of the same table.
+	LintSuspiciousKey = "suspicious-key"
+)
+
+// LintWarning describes a problem found by Lint.
+type LintWarning struct {
+	Rule     string     // identifier of the rule that produced the warning
+	Message  string     // human readable description of the problem
+	Position Position   // location of the problem in the document
+	Related  []Position // other locations involved in the problem
+	Fixable  bool       // whether LintFix can solve the problem
+}
+
+func (w LintWarning) String() string {
+	return fmt.Sprintf("%s: %s [%s]", w.Position, w.Message, w.Rule)
+}
+
+// Lint checks the document for problems and returns the list of warnings
+// found, in document order. Contrary to the parser, Lint does not stop at
+// problems it knows about: a document defining the same table twice is
+// reported rather than rejected. An error is returned if the document is
+// invalid for another reason.
+func Lint(doc []byte) ([]LintWarning, error) {
+	l, err := newLinter(doc)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := loadBytes(doc, DuplicateKeysLastWins, parseOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	warnings := l.duplicateTables()
+	warnings = append(warnings, l.tableOrder()...)
+	warnings = append(warnings, lintMixedArrays(tree, nil, tree.position)...)
+	warnings = append(warnings, l.suspiciousKeys()...)
+	sort.SliceStable(warnings, func(i, j int) bool {
+		a, b := warnings[i].Position, warnings[j].Position
+		return a.Line < b.Line || a.Line == b.Line && a.Col < b.Col
+	})
+	return warnings, nil
+}
+
+// LintFix applies the automatic fixes of the problems reported by Lint and
+// returns the fixed document. Fixes operate on the text of the document, so
+// comments and formatting are preserved. Problems that cannot be fixed are
+// left untouched.
+//
+// Duplicate tables are consolidated into the first definition of the table:
+// the keys of the later definitions, along with the comments preceding them,
+// are moved at the end of the first one.
+//
+// An error is returned if the fixed document does not parse, as when a moved
+// key collides with a sub-table of the first definition. The document is then
+// left for the user to fix.
+func LintFix(doc []byte) ([]byte, error) {
+	l, err := newLinter(doc)
+	if err != nil {
+		return nil, err
+	}
+	fixed, complete := l.fixDuplicateTables()
+	if _, err := LoadBytes(fixed); err != nil {
+		// duplicates that could not be merged are still in the document
+		if complete {
+			return nil, fmt.Errorf("fixing the document would make it invalid: %s", err)
+		}
+		if _, err := loadBytes(fixed, DuplicateKeysLastWins, parseOptions{}); err != nil {
+			return nil, fmt.Errorf("fixing the document would make it invalid: %s", err)
+		}
+	}
+	return fixed, nil
+}
+
+// lintHeader is a [table] or [[array]] header of the document.
+type lintHeader struct {
+	position Position
+	path     []string
+	array    bool
+	keys     map[string]bool // keys defined directly below the header
+	comment  string          // comment following the header on the same line
+}
+
+// lintKey is a key of a key/value pair of the document.
+type lintKey struct {
+	position Position
+	raw      string   // key as written in the document
+	path     []string // parsed key
+	header   int      // index of the header of the table, -1 for the root
+	inline   bool     // whether the key is part of an inline table
+}
+
+type linter struct {
+	lines   []string // lines of the document, ending with \r for CRLF line endings
+	crlf    bool     // whether the document has CRLF line endings
+	headers []*lintHeader
+	keys    []lintKey
+}
+
+func newLinter(doc []byte) (*linter, error) {
+	l := &linter{lines: strings.Split(string(doc), "\n"), crlf: bytes.Contains(doc, []byte("\r\n"))}
+
+	var current *lintHeader
+	depth := 0
+	for _, tok := range lexToml(doc) {
+		switch tok.typ {
+		case tokenError:
+			return nil, errors.New(tok.Position.String() + ": " + tok.val)
+		case tokenLeftCurlyBrace:
+			depth++
+		case tokenRightCurlyBrace:
+			depth--
+		case tokenKeyGroup, tokenKeyGroupArray:
+			path, err := parseKey(tok.val)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid table key: %s", tok.Position, err)
+			}
+			current = &lintHeader{
+				position: Position{Line: tok.Line, Col: tok.Col - 1},
+				path:     path,
+				array:    tok.typ == tokenKeyGroupArray,
+				keys:     map[string]bool{},
+			}
+			if current.array {
+				current.position.Col--
+			}
+			current.comment = headerComment(l.lines[tok.Line-1])
+			l.headers = append(l.headers, current)
+		case tokenKey:
+			key, err := parseKey(tok.val)
+			if err != nil {
+				continue
+			}
+			if current != nil && depth == 0 {
+				current.keys[key[0]] = true
+			}
+			l.keys = append(l.keys, lintKey{
+				position: tok.Position,
+				raw:      tok.val,
+				path:     key,
+				header:   len(l.headers) - 1,
+				inline:   depth > 0,
+			})
+		}
+	}
+	return l, nil
+}
+
+// Extract the comment following a table header on its line.
+func headerComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return strings.TrimSpace(line[i:])
+		}
+	}
+	return ""
+}
+
+// Find, for each header, the header of the first definition of the same table
+// when the header is a duplicate, following the parser semantics regarding
+// arrays of tables.
+func (l *linter) duplicateOf() []int {
+	result := make([]int, len(l.headers))
+	seen := map[string]int{}
+	for i, h := range l.headers {
+		result[i] = -1
+		key := strings.Join(h.path, "\x00")
+		if h.array {
+			for k := range seen {
+				if strings.HasPrefix(k, key+"\x00") {
+					delete(seen, k)
+				}
+			}
+			continue
+		}
+		if first, ok := seen[key]; ok {
+			result[i] = first
+			continue
+		}
+		seen[key] = i
+	}
+	return result
+}
+
+// Compute for each duplicate header whether it can be merged in its first
+// definition without redefining a key.
+func (l *linter) mergeable(duplicates []int) []bool {
+	result := make([]bool, len(l.headers))
+	merged := map[int]map[string]bool{}
+	for i, first := range duplicates {
+		if first < 0 {
+			continue
+		}
+		keys, ok := merged[first]
+		if !ok {
+			keys = map[string]bool{}
+			for k := range l.headers[first].keys {
+				keys[k] = true
+			}
+			merged[first] = keys
+		}
+		result[i] = true
+		for k := range l.headers[i].keys {
+			if keys[k] {
+				result[i] = false
+			}
+		}
+		if result[i] {
+			for k := range l.headers[i].keys {
+				keys[k] = true
+			}
+		}
+	}
+	return result
+}
+
+func (l *linter) duplicateTables() []LintWarning {
+	var warnings []LintWarning
+	duplicates := l.duplicateOf()
+	mergeable := l.mergeable(duplicates)
+	for i, first := range duplicates {
+		if first < 0 {
+			continue
+		}
+		h := l.headers[i]
+		warnings = append(warnings, LintWarning{
+			Rule:     LintDuplicateTable,
+			Message:  fmt.Sprintf("table %s is already defined at %s", Key(h.path).String(), l.headers[first].position),
+			Position: h.position,
+			Related:  []Position{l.headers[first].position},
+			Fixable:  mergeable[i],
+		})
+	}
+	return warnings
+}
+
+// Report the tables that are not grouped with the previous tables sharing
+// their top-level key. Duplicate tables are left to the duplicate-table rule.
+func (l *linter) tableOrder() []LintWarning {
+	var warnings []LintWarning
+	duplicates := l.duplicateOf()
+	for i, h := range l.headers {
+		if duplicates[i] >= 0 || i == 0 {
+			continue
+		}
+		previous := -1
+		for j := i - 1; j >= 0; j-- {
+			if l.headers[j].path[0] == h.path[0] {
+				previous = j
+				break
+			}
+		}
+		if previous < 0 || previous == i-1 {
+			continue
+		}
+		warnings = append(warnings, LintWarning{
+			Rule: LintTableOrder,
+			Message: fmt.Sprintf("table %s is separated from the other tables of %s, last defined at %s",
+				Key(h.path).String(), Key(h.path[:1]).String(), l.headers[previous].position),
+			Position: h.position,
+			Related:  []Position{l.headers[previous].position},
+		})
+	}
+	return warnings
+}
+
+// Report the arrays of t mixing values of different types. Values without
+// a position, such as the ones of inline tables, are reported at the position
+// of their parent.
+func lintMixedArrays(t *Tree, path []string, fallback Position) []LintWarning {
+	keys := t.Keys()
+	sort.Strings(keys)
+
+	var warnings []LintWarning
+	for _, k := range keys {
+		keyPath := append(append([]string{}, path...), k)
+		switch node := t.values[k].(type) {
+		case *Tree:
+			warnings = append(warnings, lintMixedArrays(node, keyPath, lintPosition(node.position, fallback))...)
+		case []*Tree:
+			for _, tree := range node {
+				warnings = append(warnings, lintMixedArrays(tree, keyPath, lintPosition(tree.position, fallback))...)
+			}
+		case *tomlValue:
+			warnings = append(warnings, lintMixedArray(node.value, keyPath, lintPosition(node.position, fallback))...)
+		}
+	}
+	return warnings
+}
+
+func lintMixedArray(value interface{}, path []string, position Position) []LintWarning {
+	array, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	var warnings []LintWarning
+	var kinds []string
+	seen := map[Kind]bool{}
+	for _, element := range array {
+		kind := nodeValue{node: element}.Kind()
+		if !seen[kind] {
+			seen[kind] = true
+			kinds = append(kinds, kind.String())
+		}
+		switch e := element.(type) {
+		case *Tree:
+			warnings = append(warnings, lintMixedArrays(e, path, position)...)
+		case []interface{}:
+			warnings = append(warnings, lintMixedArray(e, path, position)...)
+		}
+	}
+	if len(kinds) > 1 {
+		warnings = append([]LintWarning{{
+			Rule:     LintMixedArray,
+			Message:  fmt.Sprintf("array %s mixes %s values", Key(path).String(), strings.Join(kinds, ", ")),
+			Position: position,
+		}}, warnings...)
+	}
+	return warnings
+}
+
+func lintPosition(position, fallback Position) Position {
+	if position.Invalid() {
+		return fallback
+	}
+	return position
+}
+
+// Bare keys that are easily mistaken for values.
+var valueLikeKeys = map[string]bool{"true": true, "false": true, "inf": true, "nan": true}
+
+func (l *linter) suspiciousKeys() []LintWarning {
+	var warnings []LintWarning
+	type definition struct {
+		key      string
+		position Position
+	}
+	scopes := map[int]map[string]definition{}
+
+	for _, k := range l.keys {
+		if strings.ContainsAny(k.raw, "\"'") {
+			continue
+		}
+		warn := func(format string, args ...interface{}) {
+			warnings = append(warnings, LintWarning{
+				Rule:     LintSuspiciousKey,
+				Message:  fmt.Sprintf(format, args...),
+				Position: k.position,
+			})
+		}
+
+		digits := 0
+		for _, segment := range k.path {
+			if isNumericKey(segment) {
+				digits++
+			}
+		}
+		switch {
+		case len(k.path) > 1 && digits == len(k.path):
+			warn("key %s is a dotted key defining table %s, not a number", k.raw, k.path[0])
+		default:
+			for _, segment := range k.path {
+				if isNumericKey(segment) || valueLikeKeys[strings.ToLower(segment)] {
+					warn("bare key %s looks like a value", segment)
+				}
+			}
+		}
+
+		if k.inline {
+			continue
+		}
+		scope, ok := scopes[k.header]
+		if !ok {
+			scope = map[string]definition{}
+			scopes[k.header] = scope
+		}
+		name := strings.Join(k.path, ".")
+		folded := strings.ToLower(name)
+		if previous, ok := scope[folded]; ok && previous.key != name {
+			warn("key %s differs only by case from key %s defined at %s", name, previous.key, previous.position)
+			warnings[len(warnings)-1].Related = []Position{previous.position}
+		} else if !ok {
+			scope[folded] = definition{key: name, position: k.position}
+		}
+	}
+	return warnings
+}
+
+func isNumericKey(key string) bool {
+	for _, r := range key {
+		if !isDigit(r) {
+			return false
+		}
+	}
+	return key != ""
+}
+
+// Index of the first line (0-based) of the section introduced by the given
+// header, including the comment lines directly above the header.
+func (l *linter) sectionStart(i int) int {
+	start := l.headers[i].position.Line - 1
+	limit := 0
+	if i > 0 {
+		limit = l.headers[i-1].position.Line
+	}
+	for start > limit && strings.HasPrefix(strings.TrimSpace(l.lines[start-1]), "#") {
+		start--
+	}
+	return start
+}
+
+// Index of the line following the last line of the section introduced by the
+// given header.
+func (l *linter) sectionEnd(i int) int {
+	if i+1 < len(l.headers) {
+		return l.sectionStart(i + 1)
+	}
+	return len(l.lines)
+}
+
+// Split the lines of a section at the trailing blank lines.
+func trimTrailingBlankLines(lines []string) ([]string, []string) {
+	end := len(lines)
+	for end > 0 && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+	return lines[:end], lines[end:]
+}
+
+// Consolidate the duplicate tables that can be merged, and return the fixed
+// document and whether all duplicates were merged.
+func (l *linter) fixDuplicateTables() ([]byte, bool) {
+	duplicates := l.duplicateOf()
+	mergeable := l.mergeable(duplicates)
+
+	complete := true
+	moved := map[int][]int{}
+	for i, first := range duplicates {
+		if first >= 0 && mergeable[i] {
+			moved[first] = append(moved[first], i)
+		} else if first >= 0 {
+			complete = false
+		}
+	}
+	if len(moved) == 0 {
+		return []byte(strings.Join(l.lines, "\n")), complete
+	}
+
+	out := append([]string{}, l.lines[:l.sectionStart(0)]...)
+	for i := range l.headers {
+		if duplicates[i] >= 0 && mergeable[i] {
+			continue
+		}
+		content, blanks := trimTrailingBlankLines(l.lines[l.sectionStart(i):l.sectionEnd(i)])
+		out = append(out, content...)
+		for _, dup := range moved[i] {
+			header := l.headers[dup].position.Line - 1
+			out = append(out, l.lines[l.sectionStart(dup):header]...)
+			if comment := l.headers[dup].comment; comment != "" {
+				out = append(out, comment)
+			}
+			body, _ := trimTrailingBlankLines(l.lines[header+1 : l.sectionEnd(dup)])
+			out = append(out, body...)
+		}
+		out = append(out, blanks...)
+	}
+
+	// the end of the document may have been moved with a duplicate
+	out, _ = trimTrailingBlankLines(out)
+	_, tail := trimTrailingBlankLines(l.lines)
+	out = append(out, tail...)
+
+	// the comments of moved headers have no line ending, and the last line
+	// of the document, without line ending, may have been moved before others
+	if l.crlf {
+		for i := range out[:len(out)-1] {
+			if !strings.HasSuffix(out[i], "\r") {
+				out[i] += "\r"
+			}
+		}
+		if last := l.lines[len(l.lines)-1]; !strings.HasSuffix(last, "\r") {
+			out[len(out)-1] = strings.TrimSuffix(out[len(out)-1], "\r")
+		}
+	}
+	return []byte(strings.Join(out, "\n")), complete
+}
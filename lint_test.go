@@ -0,0 +1,248 @@
+package toml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLintDuplicateTables(t *testing.T) {
+	doc := []byte(`[a]
+x = 1
+
+[b]
+y = 2
+
+[a]
+z = 3
+
+[a]
+x = 4
+`)
+	warnings, err := Lint(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []LintWarning{
+		{
+			Rule:     LintDuplicateTable,
+			Message:  "table a is already defined at (1, 1)",
+			Position: Position{7, 1},
+			Related:  []Position{{1, 1}},
+			Fixable:  true,
+		},
+		{
+			Rule:     LintDuplicateTable,
+			Message:  "table a is already defined at (1, 1)",
+			Position: Position{10, 1},
+			Related:  []Position{{1, 1}},
+			Fixable:  false,
+		},
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("expected %v, got %v", expected, warnings)
+	}
+}
+
+func TestLintDuplicateTablesInArrays(t *testing.T) {
+	doc := []byte(`[[servers]]
+[servers.tls]
+cert = "a"
+
+[[servers]]
+[servers.tls]
+cert = "b"
+`)
+	warnings, err := Lint(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("sub-tables of different array elements are not duplicates: %v", warnings)
+	}
+}
+
+func TestLintSyntaxError(t *testing.T) {
+	_, err := Lint([]byte("a = \"unclosed\n"))
+	assertErrorString(t, "(1, 6): unescaped control character U+000A", err)
+}
+
+func TestLintFixDuplicateTables(t *testing.T) {
+	doc := []byte(`# root comment
+title = "x"
+
+[a] # first
+x = 1
+
+# about b
+[b]
+y = 2
+
+# more about a
+[a] # second
+z = 3
+[c]
+w = 4
+[a]
+x = 2
+`)
+	expected := `# root comment
+title = "x"
+
+[a] # first
+x = 1
+# more about a
+# second
+z = 3
+
+# about b
+[b]
+y = 2
+
+[c]
+w = 4
+[a]
+x = 2
+`
+	fixed, err := LintFix(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(fixed) != expected {
+		t.Errorf("expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, fixed)
+	}
+}
+
+func TestLintFixProducesValidDocument(t *testing.T) {
+	doc := []byte("[a]\nx = 1\n[a.b]\ny = 2\n[a]\nz = 3\n")
+	fixed, err := LintFix(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "[a]\nx = 1\nz = 3\n[a.b]\ny = 2\n"
+	if string(fixed) != expected {
+		t.Errorf("expected %q, got %q", expected, fixed)
+	}
+	tree, err := LoadBytes(fixed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Get("a.z") != int64(3) || tree.Get("a.b.y") != int64(2) {
+		t.Errorf("unexpected tree: %v", tree.ToMap())
+	}
+}
+
+func TestLintTableOrder(t *testing.T) {
+	doc := []byte(`[a]
+[b]
+[a.x]
+[[c]]
+[c.d]
+[[c]]
+[b.y]
+`)
+	warnings, err := Lint(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []LintWarning{
+		{
+			Rule:     LintTableOrder,
+			Message:  "table a.x is separated from the other tables of a, last defined at (1, 1)",
+			Position: Position{3, 1},
+			Related:  []Position{{1, 1}},
+		},
+		{
+			Rule:     LintTableOrder,
+			Message:  "table b.y is separated from the other tables of b, last defined at (2, 1)",
+			Position: Position{7, 1},
+			Related:  []Position{{2, 1}},
+		},
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("expected %v, got %v", expected, warnings)
+	}
+}
+
+func TestLintMixedArrays(t *testing.T) {
+	doc := []byte(`ints = [1, 2]
+mixed = [1, 2.0, "three", 4]
+nested = [[1, 2], ["a", true]]
+
+[t]
+inline = { a = [1, "b"] }
+`)
+	warnings, err := Lint(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	for _, w := range warnings {
+		if w.Rule != LintMixedArray {
+			t.Errorf("unexpected warning %s", w)
+		}
+		messages = append(messages, w.String())
+	}
+	expected := []string{
+		"(2, 1): array mixed mixes integer, float, string values [mixed-array]",
+		"(3, 1): array nested mixes string, bool values [mixed-array]",
+		"(6, 12): array t.inline.a mixes integer, string values [mixed-array]",
+	}
+	if !reflect.DeepEqual(messages, expected) {
+		t.Errorf("expected %v, got %v", expected, messages)
+	}
+}
+
+func TestLintSuspiciousKeys(t *testing.T) {
+	doc := []byte(`true = 1
+3.14 = "pi"
+"1" = "quoted keys are explicit"
+name = "a"
+Name = "b"
+
+[other]
+NAME = "c"
+`)
+	warnings, err := Lint(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []LintWarning{
+		{Rule: LintSuspiciousKey, Message: "bare key true looks like a value", Position: Position{1, 1}},
+		{Rule: LintSuspiciousKey, Message: "key 3.14 is a dotted key defining table 3, not a number", Position: Position{2, 1}},
+		{Rule: LintSuspiciousKey, Message: "key Name differs only by case from key name defined at (4, 1)", Position: Position{5, 1}, Related: []Position{{4, 1}}},
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("expected %v, got %v", expected, warnings)
+	}
+}
+
+func TestValid(t *testing.T) {
+	if !Valid([]byte("a = 1\n[b]\nc = 2\n")) {
+		t.Error("document should be valid")
+	}
+	if Valid([]byte("a = 1\na = 2\n")) {
+		t.Error("duplicate keys should make the document invalid")
+	}
+}
+
+func TestLintFixCRLF(t *testing.T) {
+	doc := []byte("[a]\r\nx = 1\r\n[b]\r\ny = 2\r\n[a] # more a\r\nz = 3")
+	fixed, err := LintFix(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "[a]\r\nx = 1\r\n# more a\r\nz = 3\r\n[b]\r\ny = 2"
+	if string(fixed) != expected {
+		t.Errorf("expected %q, got %q", expected, fixed)
+	}
+}
+
+func TestLintFixInvalidResult(t *testing.T) {
+	// b of the second [a] collides with the table a.b once merged
+	doc := []byte("[a]\nx = 1\n[a.b]\ny = 2\n[a]\nb = 3\n")
+	_, err := LintFix(doc)
+	if err == nil || !strings.HasPrefix(err.Error(), "fixing the document would make it invalid: ") {
+		t.Errorf("expected an invalid result error, got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+// Dotted keys on generic maps.
+
+package toml
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// GetMapPath returns the value at key in m, following the TOML dotted keys
+// semantics: key is parsed like the keys of a document (e.g. a."b.c"), and
+// arrays of tables are traversed through their last element. Nested tables are
+// expected to be of type map[string]interface{}, as returned by Tree.ToMap.
+// The second return value is false if key is invalid or does not exist.
+func GetMapPath(m map[string]interface{}, key string) (interface{}, bool) {
+	keys, err := parseKey(key)
+	if err != nil {
+		return nil, false
+	}
+	for _, k := range keys[:len(keys)-1] {
+		if m = mapTable(m[k]); m == nil {
+			return nil, false
+		}
+	}
+	v, ok := m[keys[len(keys)-1]]
+	return v, ok
+}
+
+// SetMapPath sets the value at key in m, following the TOML dotted keys
+// semantics: intermediate tables are created as needed, and arrays of tables
+// are traversed through their last element. An error is returned if key is
+// invalid, or if one of its intermediate keys is not a table.
+func SetMapPath(m map[string]interface{}, key string, v interface{}) error {
+	keys, err := parseKey(key)
+	if err != nil {
+		return err
+	}
+	for i, k := range keys[:len(keys)-1] {
+		next, exists := m[k]
+		if !exists {
+			table := map[string]interface{}{}
+			m[k] = table
+			m = table
+			continue
+		}
+		if m = mapTable(next); m == nil {
+			return fmt.Errorf("key %s is not a table", Key(keys[:i+1]).String())
+		}
+	}
+	m[keys[len(keys)-1]] = v
+	return nil
+}
+
+// DeleteMapPath removes the value at key from m, following the TOML dotted
+// keys semantics. An error is returned if key is invalid or does not exist.
+func DeleteMapPath(m map[string]interface{}, key string) error {
+	keys, err := parseKey(key)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys[:len(keys)-1] {
+		if m = mapTable(m[k]); m == nil {
+			return errors.New("no such key to delete")
+		}
+	}
+	if _, ok := m[keys[len(keys)-1]]; !ok {
+		return errors.New("no such key to delete")
+	}
+	delete(m, keys[len(keys)-1])
+	return nil
+}
+
+// FlattenMap returns the values of m and of its nested tables in a single map,
+// at their dotted keys, like server.http.port. Parts of keys that are not bare
+// keys are quoted, as by Key.String. Arrays, including arrays of tables, are
+// values, and empty tables are kept as empty maps. Nested tables are expected
+// to be of type map[string]interface{}, as returned by Tree.ToMap.
+func FlattenMap(m map[string]interface{}) map[string]interface{} {
+	flat := map[string]interface{}{}
+	flattenMap(flat, nil, m)
+	return flat
+}
+
+func flattenMap(flat map[string]interface{}, prefix Key, m map[string]interface{}) {
+	for k, v := range m {
+		key := prefix.Append(k)
+		if table, ok := v.(map[string]interface{}); ok && len(table) > 0 {
+			flattenMap(flat, key, table)
+			continue
+		}
+		flat[key.String()] = v
+	}
+}
+
+// ExpandMap builds the nested tables described by a map with dotted keys, such
+// as the one returned by FlattenMap, or overrides read from the environment.
+// Keys are set in sorted order with SetMapPath. An error is returned if a key
+// is invalid, or if a key is given both a value and keys of its own, such as
+// a and a.b with a = 1.
+func ExpandMap(flat map[string]interface{}) (map[string]interface{}, error) {
+	keys := make([]string, 0, len(flat))
+	for k := range flat {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	m := map[string]interface{}{}
+	for _, k := range keys {
+		if _, ok := GetMapPath(m, k); ok {
+			return nil, fmt.Errorf("key %s is defined more than once", k)
+		}
+		v := flat[k]
+		if table, ok := v.(map[string]interface{}); ok {
+			// the tables of flat are not modified by the keys set in them
+			copied := make(map[string]interface{}, len(table))
+			for tk, tv := range table {
+				copied[tk] = tv
+			}
+			v = copied
+		}
+		if err := SetMapPath(m, k, v); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Return the table designated by a value of a map: the value itself if it is
+// a table, or its last element if it is an array of tables.
+func mapTable(v interface{}) map[string]interface{} {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		return node
+	case []map[string]interface{}:
+		if len(node) > 0 {
+			return node[len(node)-1]
+		}
+	case []interface{}:
+		if len(node) > 0 {
+			if table, ok := node[len(node)-1].(map[string]interface{}); ok {
+				return table
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package toml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMapPath(t *testing.T) {
+	m := map[string]interface{}{
+		"title": "x",
+		"users": []interface{}{
+			map[string]interface{}{"name": "a"},
+			map[string]interface{}{"name": "b"},
+		},
+	}
+
+	if err := SetMapPath(m, `server."tls.cert".path`, "cert.pem"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetMapPath(m, "users.admin", true); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"title": "x",
+		"server": map[string]interface{}{
+			"tls.cert": map[string]interface{}{"path": "cert.pem"},
+		},
+		"users": []interface{}{
+			map[string]interface{}{"name": "a"},
+			map[string]interface{}{"name": "b", "admin": true},
+		},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("expected %v, got %v", expected, m)
+	}
+
+	if v, ok := GetMapPath(m, `server."tls.cert".path`); !ok || v != "cert.pem" {
+		t.Errorf("unexpected value %v %v", v, ok)
+	}
+	if v, ok := GetMapPath(m, "users.name"); !ok || v != "b" {
+		t.Errorf("arrays of tables should be traversed through their last element, got %v", v)
+	}
+	if _, ok := GetMapPath(m, "title.x"); ok {
+		t.Error("values are not tables")
+	}
+	if _, ok := GetMapPath(m, "a..b"); ok {
+		t.Error("invalid keys should not be found")
+	}
+
+	err := SetMapPath(m, "title.sub", 1)
+	assertErrorString(t, "key title is not a table", err)
+
+	if err := DeleteMapPath(m, `server."tls.cert"`); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := GetMapPath(m, `server."tls.cert"`); ok {
+		t.Error("key should be deleted")
+	}
+	assertErrorString(t, "no such key to delete", DeleteMapPath(m, "server.missing"))
+	assertErrorString(t, "no such key to delete", DeleteMapPath(m, "title.x"))
+}
+
+func TestFlattenExpandMap(t *testing.T) {
+	tree, err := Load(`
+title = "x"
+ports = [80, 443]
+
+[server.http]
+host = "localhost"
+"read.timeout" = 5
+
+[empty]
+
+[[users]]
+name = "a"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := tree.ToMap()
+	flat := FlattenMap(m)
+	expected := map[string]interface{}{
+		"title":                      "x",
+		"ports":                      []interface{}{int64(80), int64(443)},
+		"server.http.host":           "localhost",
+		`server.http."read.timeout"`: int64(5),
+		"empty":                      map[string]interface{}{},
+		"users":                      []interface{}{map[string]interface{}{"name": "a"}},
+	}
+	if !reflect.DeepEqual(flat, expected) {
+		t.Errorf("expected %v, got %v", expected, flat)
+	}
+
+	expanded, err := ExpandMap(flat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expanded, m) {
+		t.Errorf("expected %v, got %v", m, expanded)
+	}
+
+	// tables given as values are merged with dotted keys, without being modified
+	overrides := map[string]interface{}{
+		"server":      map[string]interface{}{"host": "a"},
+		"server.port": 80,
+	}
+	expanded, err = ExpandMap(overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expanded, map[string]interface{}{"server": map[string]interface{}{"host": "a", "port": 80}}) {
+		t.Errorf("unexpected expansion %v", expanded)
+	}
+	if len(overrides["server"].(map[string]interface{})) != 1 {
+		t.Error("tables of the flat map should not be modified")
+	}
+
+	_, err = ExpandMap(map[string]interface{}{"a": 1, "a.b": 2})
+	assertErrorString(t, "key a is not a table", err)
+	_, err = ExpandMap(map[string]interface{}{"a.b": 1, `a."b"`: 2})
+	assertErrorString(t, "key a.b is defined more than once", err)
+	_, err = ExpandMap(map[string]interface{}{"a..b": 1})
+	if err == nil {
+		t.Error("expected an error for an invalid key")
+	}
+}
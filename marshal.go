@@ -1,15 +1,23 @@
 package toml
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"database/sql/driver"
 	"encoding"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/big"
 	"reflect"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -20,8 +28,24 @@ const (
 	tagMultiline    = "multiline"
 	tagLiteral      = "literal"
 	tagDefault      = "default"
+	tagRequired     = "required"
 )
 
+// Nesting depth of tables past which Encoder and Decoder fail, unless set with
+// MaxDepth.
+const defaultMaxDepth = 1000
+
+// Check depth against a MaxDepth setting.
+func depthExceeded(depth, max int) error {
+	if max == 0 {
+		max = defaultMaxDepth
+	}
+	if max > 0 && depth > max {
+		return fmt.Errorf("maximum depth of %d exceeded", max)
+	}
+	return nil
+}
+
 type tomlOpts struct {
 	name         string
 	nameFromTag  bool
@@ -31,11 +55,19 @@ type tomlOpts struct {
 	literal      bool
 	include      bool
 	omitempty    bool
+	omitzero     bool
+	bytes        string
+	base         int
+	layout       string
+	asString     bool
+	secret       bool
 	defaultValue string
+	required     bool
 }
 
 type encOpts struct {
 	quoteMapKeys            bool
+	normalizeMapKeys        bool
 	arraysOneElementPerLine bool
 }
 
@@ -45,6 +77,7 @@ var encOptsDefaults = encOpts{
 
 type annotation struct {
 	tag          string
+	fallbackTag  string // tag used when tag is absent, if not empty
 	comment      string
 	commented    string
 	multiline    string
@@ -68,7 +101,7 @@ const (
 	// Sort fields alphabetically.
 	OrderAlphabetical MarshalOrder = iota + 1
 	// Preserve the order the fields are encountered. For example, the order of fields in
-	// a struct.
+	// a struct, or the order of the entries of an OrderedMap.
 	OrderPreserve
 )
 
@@ -80,7 +113,11 @@ var textUnmarshalerType = reflect.TypeOf(new(encoding.TextUnmarshaler)).Elem()
 var localDateType = reflect.TypeOf(LocalDate{})
 var localTimeType = reflect.TypeOf(LocalTime{})
 var localDateTimeType = reflect.TypeOf(LocalDateTime{})
+var bigIntType = reflect.TypeOf(big.Int{})
+var bigFloatType = reflect.TypeOf(big.Float{})
 var mapStringInterfaceType = reflect.TypeOf(map[string]interface{}{})
+var optionalType = reflect.TypeOf(new(optional)).Elem()
+var valuerType = reflect.TypeOf(new(driver.Valuer)).Elem()
 
 // Check if the given marshal type maps to a Tree primitive
 func isPrimitive(mtype reflect.Type) bool {
@@ -98,12 +135,35 @@ func isPrimitive(mtype reflect.Type) bool {
 	case reflect.String:
 		return true
 	case reflect.Struct:
-		return isTimeType(mtype)
+		if isOptional(mtype) {
+			return isPrimitive(mtype.Field(0).Type)
+		}
+		return isTimeType(mtype) || mtype == bigIntType || mtype == bigFloatType
 	default:
 		return false
 	}
 }
 
+// Encodings of []byte values, selected with the options of the toml tag.
+const (
+	bytesBase64 = "base64"
+	bytesHex    = "hex"
+	bytesArray  = "array"
+)
+
+// Option of the toml tag preceding the layout of time.Time fields, which takes
+// the rest of the tag.
+const tagLayout = "layout:"
+
+// Check if the given marshal type is a byte slice without its own encoding
+func isByteSlice(mtype reflect.Type) bool {
+	if mtype.Kind() != reflect.Slice || mtype.Elem().Kind() != reflect.Uint8 {
+		return false
+	}
+	ptype := reflect.PtrTo(mtype)
+	return !isCustomMarshaler(mtype) && !isTextMarshaler(mtype) && !isCustomUnmarshaler(ptype) && !isTextUnmarshaler(ptype)
+}
+
 func isTimeType(mtype reflect.Type) bool {
 	return mtype == timeType || mtype == localDateType || mtype == localDateTimeType || mtype == localTimeType
 }
@@ -163,13 +223,37 @@ func isTree(mtype reflect.Type) bool {
 		return isTree(mtype.Elem())
 	case reflect.Map:
 		return true
+	case reflect.Slice:
+		return mtype == orderedMapType
 	case reflect.Struct:
+		if isOptional(mtype) {
+			return isTree(mtype.Field(0).Type)
+		}
 		return !isPrimitive(mtype)
 	default:
 		return false
 	}
 }
 
+// optional is implemented by Optional, whose first field is the value and
+// second field whether it is present. Optional requires go1.18.
+type optional interface {
+	isOptional()
+}
+
+func isOptional(mtype reflect.Type) bool {
+	return mtype.Kind() == reflect.Struct && (mtype.Implements(optionalType) || isNullType(mtype))
+}
+
+// Whether mtype is a nullable type of database/sql, such as sql.NullString, or
+// of a database driver: a driver.Valuer whose first field is the value and
+// second field, Valid, whether it is not NULL. They are handled as Optional.
+func isNullType(mtype reflect.Type) bool {
+	return mtype.NumField() == 2 && mtype.Field(0).PkgPath == "" &&
+		mtype.Field(1).Name == "Valid" && mtype.Field(1).Type.Kind() == reflect.Bool &&
+		mtype.Implements(valuerType)
+}
+
 func isCustomMarshaler(mtype reflect.Type) bool {
 	return mtype.Implements(marshalerType)
 }
@@ -223,37 +307,97 @@ function for sub-structs, and currently only definite types can be marshaled
 The following struct annotations are supported:
 
   toml:"Field"      Overrides the field's name to output.
-  omitempty         When set, empty values and groups are not emitted.
-  comment:"comment" Emits a # comment on the same line. This supports new lines.
-  commented:"true"  Emits the value as commented.
-
-Note that pointers are automatically assigned the "omitempty" option, as TOML
+  toml:"a.b.c"      Writes the field as key c of table a.b, so that a flat
+                    struct maps to a nested document. Quote the name to use
+                    a key containing dots: toml:"'a.b'".
+  omitempty         When set, empty values and groups are not emitted:
+                    false, 0, "", nil pointers and interfaces, empty
+                    slices and maps, and structs whose fields are all
+                    zero, which encoding/json would emit.
+  omitzero          When set, zero values are not emitted: values whose
+                    IsZero method returns true, like the zero time.Time,
+                    and otherwise the zero value of their type. Empty
+                    slices and maps that are not nil are emitted.
+  comment:"comment" Emits a # comment on the line above the key or table
+                    header. This supports new lines, each line becoming a
+                    comment line.
+  commented:"true"  Emits the value as commented, which is handy to
+                    document optional settings with their default value.
+                    Applies to all the keys of a table.
+  toml:",hex"       Encodes a []byte field as a hexadecimal string rather than
+                    the default base64 string. Use ",array" for an array of
+                    integers. Arrays are decoded whatever the option.
+                    Encodes an integer field as a hexadecimal integer, like
+                    0xff. Use ",octal" or ",binary" for 0o377 or 0b11111111.
+                    Negative integers are written in base 10.
+  toml:",literal"   Writes strings as 'literal strings', without escaping
+                    backslashes, when they contain no single quote nor
+                    control character. Applies to the strings of arrays.
+  toml:",string"    Encodes a number or boolean field as a string, and
+                    decodes it from strings, as with encoding/json.
+  toml:",layout:Jan 2, 2006"
+                    Encodes a time.Time field as a string formatted with
+                    the layout, as for time.Format, and decodes strings
+                    with it. The layout is the rest of the tag.
+  toml:",secret"    Marks a field holding a credential, whose value is
+                    replaced by RedactedValue by Encoders in Redact mode.
+
+Note that pointers and Deferred are automatically assigned the "omitempty" option, as TOML
 explicitly does not handle null values (saying instead the label should be
 dropped).
+Optional values that are not present are always omitted, and so are the
+nullable types of database/sql, such as sql.NullString and sql.NullInt64, that
+are not Valid. Missing keys leave them, as other fields, unchanged: invalid
+unless set before decoding.
 
 Tree structural types and corresponding marshal types:
 
-  *Tree                            (*)struct, (*)map[string]interface{}
-  []*Tree                          (*)[](*)struct, (*)[](*)map[string]interface{}
+  *Tree                            (*)struct, (*)map[string]interface{}, OrderedMap
+  []*Tree                          (*)[](*)struct, (*)[](*)map[string]interface{}, []OrderedMap
   []interface{} (as interface{})   (*)[]primitive, (*)[]([]interface{})
   interface{}                      (*)primitive
+  any of the above                 Deferred
 
 Tree primitive types and corresponding marshal types:
 
   uint64     uint, uint8-uint64, pointers to same
   int64      int, int8-uint64, pointers to same
   float64    float32, float64, pointers to same
-  string     string, pointers to same
+  string     string, []byte (base64), pointers to same
   bool       bool, pointers to same
   time.LocalTime  time.LocalTime{}, pointers to same
 
+big.Int and big.Float values are written as integers and floats when they fit
+in an int64, a uint64 or a float64, and as strings of all their digits
+otherwise. They are decoded from integers, floats and strings.
+
+As with encoding/json, the keys of maps are strings, integers, or types
+implementing encoding.TextMarshaler, and encoding.TextUnmarshaler to be decoded.
+
+The fields of embedded structs and pointers to structs are promoted as with
+encoding/json, unless the embedded field is named by its tag: when several
+fields have the same name, the least nested one is used, or else the only one
+named by a tag, and otherwise none. Nil embedded pointers are skipped, and
+allocated when decoding.
+
+Marshal never modifies v, so it may be called from several goroutines on the
+same value, as long as the value is not modified meanwhile. To marshal values
+that other goroutines modify under a lock, see Encoder.Locker.
+
 For additional flexibility, use the Encoder API.
 */
 func Marshal(v interface{}) ([]byte, error) {
-	return NewEncoder(nil).marshal(v)
+	e := encoderPool.Get().(*Encoder)
+	defer encoderPool.Put(e)
+	e.Reset(nil)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	err := e.marshal(buf, v)
+	return append([]byte{}, buf.Bytes()...), err
 }
 
-// Encoder writes TOML values to an output stream.
+// Encoder writes TOML values to an output stream. An Encoder must not be used
+// by several goroutines at once.
 type Encoder struct {
 	w io.Writer
 	encOpts
@@ -263,7 +407,35 @@ type Encoder struct {
 	order           MarshalOrder
 	promoteAnon     bool
 	compactComments bool
+	tabularArrays   bool
+	wrapStrings     int
+	arrayWrapItems  int
+	arrayWrapWidth  int
 	indentation     string
+	layout          treeLayout
+	timeLocation    *time.Location
+	timeFormat      TimeFormat
+	floatFormat     floatFormat
+	rejectNaNInf    bool
+	literalStrings  bool
+	redact          bool
+	canonical       bool
+	maxDepth        int
+	depth           int
+	visiting        map[interface{}]bool        // pointers, maps and slices being encoded
+	styles          map[interface{}]fieldSource // sources of the fields of PreserveStyle
+	typeEncoders    map[reflect.Type]TypeEncoderFunc
+	unsupported     UnsupportedTypePolicy
+	fallback        func(path Key, v interface{}) (interface{}, error)
+	inFallback      bool // whether the value returned by fallback is being encoded
+	locker          sync.Locker
+	path            []string
+	collisions      []KeyCollision
+	// separator of the documents of streams, number of documents written,
+	// and whether the last one ends with a newline
+	separator       string
+	documents       int
+	endsWithNewline bool
 }
 
 // NewEncoder returns a new encoder that writes to w.
@@ -276,6 +448,7 @@ func NewEncoder(w io.Writer) *Encoder {
 		col:         1,
 		order:       OrderAlphabetical,
 		indentation: "  ",
+		layout:      defaultLayout,
 	}
 }
 
@@ -283,16 +456,39 @@ func NewEncoder(w io.Writer) *Encoder {
 //
 // See the documentation for Marshal for details.
 func (e *Encoder) Encode(v interface{}) error {
-	b, err := e.marshal(v)
-	if err != nil {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := e.marshal(buf, v); err != nil {
 		return err
 	}
-	if _, err := e.w.Write(b); err != nil {
+	if sep := e.separatorLine(); sep != "" {
+		if _, err := io.WriteString(e.w, sep); err != nil {
+			return err
+		}
+		e.endsWithNewline = true
+	}
+	if _, err := e.w.Write(buf.Bytes()); err != nil {
 		return err
 	}
+	e.documents++
+	if buf.Len() > 0 {
+		e.endsWithNewline = bytes.HasSuffix(buf.Bytes(), []byte("\n"))
+	}
 	return nil
 }
 
+// Reset makes the encoder write to w, keeping its options, so that it can be
+// reused rather than allocating a new encoder for each value.
+func (e *Encoder) Reset(w io.Writer) {
+	e.w = w
+	e.line = 0
+	e.col = 1
+	e.path = e.path[:0]
+	e.depth = 0
+	e.collisions = nil
+	e.documents, e.endsWithNewline = 0, false
+}
+
 // QuoteMapKeys sets up the encoder to encode
 // maps with string type keys with quoted TOML keys.
 //
@@ -302,6 +498,26 @@ func (e *Encoder) QuoteMapKeys(v bool) *Encoder {
 	return e
 }
 
+// NormalizeMapKeys sets up the encoder to convert map keys that are not valid
+// bare keys into snake_case bare keys instead of quoting them. Latin letters
+// are transliterated to ASCII and any other invalid character is replaced by
+// an underscore, so that "Max Connections" becomes max_connections and
+// "Café" becomes cafe. Keys that cannot be transliterated at all are quoted.
+//
+// When several keys of the same map normalize to the same bare key, only the
+// first one in lexicographic order is written; the others are reported by
+// KeyCollisions.
+func (e *Encoder) NormalizeMapKeys(v bool) *Encoder {
+	e.normalizeMapKeys = v
+	return e
+}
+
+// KeyCollisions returns the map keys that collided during the last call to
+// Encode when NormalizeMapKeys is enabled.
+func (e *Encoder) KeyCollisions() []KeyCollision {
+	return e.collisions
+}
+
 // ArraysWithOneElementPerLine sets up the encoder to encode arrays
 // with more than one element on multiple lines instead of one.
 //
@@ -321,7 +537,36 @@ func (e *Encoder) ArraysWithOneElementPerLine(v bool) *Encoder {
 	return e
 }
 
-// Order allows to change in which order fields will be written to the output stream.
+// ArrayWrap sets up the encoder to write arrays with one element per line,
+// as ArraysWithOneElementPerLine, when they have more than items elements or
+// when they would be wider than width characters on a single line. Zero
+// disables either threshold; both are disabled by default.
+func (e *Encoder) ArrayWrap(items, width int) *Encoder {
+	e.arrayWrapItems = items
+	e.arrayWrapWidth = width
+	return e
+}
+
+// TableSpacing sets the number of blank lines written before table headers,
+// or before the comments above them. It is one by default.
+func (e *Encoder) TableSpacing(n int) *Encoder {
+	e.layout.blankLines = n
+	return e
+}
+
+// KeyValueSeparator sets the separator written between keys and values,
+// " = " by default. It must be an equal sign surrounded by any number of
+// spaces and tabs, like "=" or "  =  ", or Encode returns an error.
+func (e *Encoder) KeyValueSeparator(sep string) *Encoder {
+	e.layout.separator = sep
+	return e
+}
+
+// Order allows to change in which order fields will be written to the output
+// stream. With OrderAlphabetical, the default, keys are sorted so that the
+// output does not depend on the declaration order of struct fields. With
+// OrderPreserve, struct fields are written in declaration order, the entries of
+// an OrderedMap in the order of the slice, and map keys in sorted order.
 func (e *Encoder) Order(ord MarshalOrder) *Encoder {
 	e.order = ord
 	return e
@@ -339,6 +584,17 @@ func (e *Encoder) SetTagName(v string) *Encoder {
 	return e
 }
 
+// SetFallbackTagName sets a tag giving the name and options of the fields
+// without the "toml" tag, such as "json" to encode structs annotated for
+// encoding/json. The "toml" tag, or the one set with SetTagName, takes
+// precedence. The options of the fallback tag are read as those of the toml
+// tag, so that encoding/json options like omitempty and ",string" apply.
+// Options that this package does not know are ignored.
+func (e *Encoder) SetFallbackTagName(v string) *Encoder {
+	e.fallbackTag = v
+	return e
+}
+
 // SetTagComment allows changing default tag "comment"
 func (e *Encoder) SetTagComment(v string) *Encoder {
 	e.comment = v
@@ -376,48 +632,285 @@ func (e *Encoder) CompactComments(cc bool) *Encoder {
 	return e
 }
 
-func (e *Encoder) marshal(v interface{}) ([]byte, error) {
+// TabularArrays sets up the encoder to write arrays of tables whose tables
+// all have the same keys, and no sub-tables nor comments, as arrays of inline
+// tables with one table per line and the values aligned in columns.
+//
+// For example:
+//
+//   [[hosts]]
+//     name = "alpha"
+//     port = 80
+//
+//   [[hosts]]
+//     name = "b"
+//     port = 8080
+//
+// Becomes
+//
+//   hosts = [
+//     { name = "alpha", port = 80   },
+//     { name = "b",     port = 8080 },
+//   ]
+func (e *Encoder) TabularArrays(v bool) *Encoder {
+	e.tabularArrays = v
+	return e
+}
+
+// WrapStrings sets the width past which string values are written as
+// multiline strings, broken into lines of at most width characters with
+// line-ending backslashes. Lines are broken after spaces when possible. Zero,
+// the default, disables wrapping.
+//
+//   description = """
+//   A long description that goes on \
+//   and on."""
+func (e *Encoder) WrapStrings(width int) *Encoder {
+	e.wrapStrings = width
+	return e
+}
+
+// LiteralStrings makes the encoder write strings as literal strings, between
+// single quotes, so that regular expressions and Windows paths are written
+// without escaping their backslashes. Strings that cannot be literal, because
+// they contain single quotes or control characters, are still written as basic
+// strings. The ",literal" option of the toml tag, or the literal tag, applies
+// it to a single field.
+func (e *Encoder) LiteralStrings(v bool) *Encoder {
+	e.literalStrings = v
+	return e
+}
+
+// PreserveStyle makes the encoder write the struct fields decoded by the
+// Decoder m describes in the style of the document they were read from:
+// integers in the same base and with the same digit groups, such as 0x1F90 or
+// 1_000_000, and literal strings as literal strings. Saving a configuration
+// edited by a program then keeps the style of its user:
+//
+//	d := toml.NewDecoder(r)
+//	if err := d.Decode(&config); err != nil {
+//	  return err
+//	}
+//	...
+//	err := toml.NewEncoder(w).PreserveStyle(d.MetaData()).Encode(&config)
+//
+// Fields are recognized by their address, as by MetaData.FieldPosition, so the
+// structs must be encoded through pointers to the decoded values, and the
+// elements of slices appended to since are not recognized. The style of
+// the document prevails over the options of the toml tag and of the encoder,
+// unless the value of a field changed type.
+func (e *Encoder) PreserveStyle(m MetaData) *Encoder {
+	e.styles = m.fields
+	return e
+}
+
+// RedactedValue replaces the values of the fields with the ",secret" option
+// of the toml tag when encoding in Redact mode.
+const RedactedValue = "[redacted]"
+
+// Redact makes the encoder write RedactedValue instead of the values of the
+// fields with the ",secret" option of the toml tag, such as passwords and
+// tokens, so that configurations can be written to logs or debug dumps.
+// Marshal and Encoders not in Redact mode write the real values.
+func (e *Encoder) Redact(v bool) *Encoder {
+	e.redact = v
+	return e
+}
+
+// FloatPrecision sets the number of digits written after the decimal point
+// of floats, rounding them. When n <= 0, the default, floats are written with
+// the fewest digits that read back as the same value.
+func (e *Encoder) FloatPrecision(n int) *Encoder {
+	e.floatFormat.precision = n
+	return e
+}
+
+// FloatExponent sets the order of magnitude past which floats are written
+// with an exponent: those whose absolute value is at least 1e<n>, or lower
+// than 1e-<n>, are written like 6.02214076e+23. Zero, the default, always
+// writes floats in decimal notation.
+func (e *Encoder) FloatExponent(n int) *Encoder {
+	e.floatFormat.exponent = n
+	return e
+}
+
+// FloatDecimalPoint makes the encoder always write a decimal point in floats,
+// including in the mantissa of floats with an exponent: 1.0e+06 rather than
+// 1e+06. Floats without exponent always have one, like 3.0.
+func (e *Encoder) FloatDecimalPoint(v bool) *Encoder {
+	e.floatFormat.decimalPoint = v
+	return e
+}
+
+// RejectNaNInf makes the encoder fail on NaN and infinite floats, instead of
+// writing them as nan, +inf and -inf, for documents read by applications that
+// do not expect them.
+func (e *Encoder) RejectNaNInf(reject bool) *Encoder {
+	e.rejectNaNInf = reject
+	return e
+}
+
+// Canonical makes the encoder write a canonical form of the documents: keys
+// sorted, no comments, no commented keys, no inline tables, and strings and
+// numbers written in a single way, whatever the formatting options of the
+// encoder, the tags of the fields, and the documents written by marshalers.
+// Values with the same content then give the same bytes, which can be hashed,
+// signed or compared to deduplicate configurations.
+func (e *Encoder) Canonical(v bool) *Encoder {
+	e.canonical = v
+	return e
+}
+
+// Locker sets a lock held while Encode reads the value to encode, such as the
+// RLocker of a sync.RWMutex guarding it. The value is copied into a Tree under
+// the lock, and written once the lock is released, so that writers of the
+// value are not blocked by a slow output stream. Marshalers of the value are
+// called with the lock held.
+func (e *Encoder) Locker(l sync.Locker) *Encoder {
+	e.locker = l
+	return e
+}
+
+// MaxDepth sets how deeply tables and arrays may be nested. Encoding a value
+// nested deeper fails. The default is 1000, and n < 0 removes the limit.
+// Self-referential values, such as a struct pointing to itself, always fail
+// to encode, whatever the limit.
+func (e *Encoder) MaxDepth(n int) *Encoder {
+	e.maxDepth = n
+	return e
+}
+
+// TimeLocation sets up the encoder to convert time.Time values to the given
+// location before writing them, so that all offset date-times of the output
+// share the same offset. Use time.UTC to normalize them to UTC. When loc is nil
+// (the default), times are written with their own offset.
+func (e *Encoder) TimeLocation(loc *time.Location) *Encoder {
+	e.timeLocation = loc
+	return e
+}
+
+// TimeFormat sets how time.Time values are written. It applies after the
+// conversion to the location set by TimeLocation, which also sets the offset
+// dropped by TimeFormatLocal and the day checked by TimeFormatDateOnly.
+func (e *Encoder) TimeFormat(f TimeFormat) *Encoder {
+	e.timeFormat = f
+	return e
+}
+
+// UnsupportedTypes sets how the encoder handles values of types that have no
+// TOML representation, such as channels, functions and complex numbers. By
+// default, encoding them fails with an *UnsupportedTypeError.
+func (e *Encoder) UnsupportedTypes(policy UnsupportedTypePolicy) *Encoder {
+	e.unsupported = policy
+	return e
+}
+
+// UnsupportedTypeFallback sets a function called with the key and the value
+// of values of unsupported types, whatever the UnsupportedTypes policy. The
+// value it returns is encoded instead, as by Marshal, and a nil value leaves
+// the key out of the document. For example, complex numbers can be written as
+// strings:
+//
+//	e.UnsupportedTypeFallback(func(path toml.Key, v interface{}) (interface{}, error) {
+//	  if c, ok := v.(complex128); ok {
+//	    return fmt.Sprint(c), nil
+//	  }
+//	  return nil, nil
+//	})
+//
+// Values of unsupported types returned by f follow the UnsupportedTypes
+// policy.
+func (e *Encoder) UnsupportedTypeFallback(f func(path Key, v interface{}) (interface{}, error)) *Encoder {
+	e.fallback = f
+	return e
+}
+
+// Check that the encoder settings are valid and that v is a value that can
+// be marshaled as a document.
+func (e *Encoder) checkMarshalable(v interface{}) (reflect.Type, error) {
 	// Check if indentation is valid
 	for _, char := range e.indentation {
 		if !isSpace(char) {
-			return []byte{}, fmt.Errorf("invalid indentation: must only contains space or tab characters")
+			return nil, fmt.Errorf("invalid indentation: must only contains space or tab characters")
 		}
 	}
 
 	mtype := reflect.TypeOf(v)
 	if mtype == nil {
-		return []byte{}, errors.New("nil cannot be marshaled to TOML")
+		return nil, errors.New("nil cannot be marshaled to TOML")
 	}
 
 	switch mtype.Kind() {
 	case reflect.Struct, reflect.Map:
+	case reflect.Slice:
+		if mtype != orderedMapType {
+			return nil, errors.New("Only a struct or map can be marshaled to TOML")
+		}
 	case reflect.Ptr:
 		if mtype.Elem().Kind() != reflect.Struct {
-			return []byte{}, errors.New("Only pointer to struct can be marshaled to TOML")
+			return nil, errors.New("Only pointer to struct can be marshaled to TOML")
 		}
 		if reflect.ValueOf(v).IsNil() {
-			return []byte{}, errors.New("nil pointer cannot be marshaled to TOML")
+			return nil, errors.New("nil pointer cannot be marshaled to TOML")
 		}
 	default:
-		return []byte{}, errors.New("Only a struct or map can be marshaled to TOML")
+		return nil, errors.New("Only a struct or map can be marshaled to TOML")
+	}
+	return mtype, nil
+}
+
+// Write the encoding of v to buf.
+func (e *Encoder) marshal(buf *bytes.Buffer, v interface{}) error {
+	mtype, err := e.checkMarshalable(v)
+	if err != nil {
+		return err
+	}
+	e.path = e.path[:0]
+	e.depth = 0
+	e.collisions = nil
+	if err := e.layout.validate(); err != nil {
+		return err
+	}
+
+	t, b, err := e.readValue(mtype, reflect.ValueOf(v))
+	if e.canonical && err == nil {
+		if t == nil {
+			if t, err = LoadBytes(b); err != nil {
+				return err
+			}
+		}
+		_, err = canonicalTree(t).writeToOrdered(buf, "", "", 0, false, OrderAlphabetical, "", defaultLayout, true, false, false)
+		return err
 	}
+	if t == nil || err != nil {
+		buf.Write(b)
+		return err
+	}
+
+	_, err = t.writeToOrdered(buf, "", "", 0, e.arraysOneElementPerLine, e.order, e.indentation, e.layout, e.compactComments, e.tabularArrays, false)
+	return err
+}
 
-	sval := reflect.ValueOf(v)
+// Convert the value to encode to a tree, or to bytes for marshalers, under
+// the lock set with Locker.
+func (e *Encoder) readValue(mtype reflect.Type, sval reflect.Value) (*Tree, []byte, error) {
+	if e.locker != nil {
+		e.locker.Lock()
+		defer e.locker.Unlock()
+	}
 	if isCustomMarshaler(mtype) {
-		return callCustomMarshaler(sval)
+		b, err := callCustomMarshaler(sval)
+		return nil, b, err
 	}
 	if isTextMarshaler(mtype) {
-		return callTextMarshaler(sval)
+		b, err := callTextMarshaler(sval)
+		return nil, b, err
 	}
 	t, err := e.valueToTree(mtype, sval)
 	if err != nil {
-		return []byte{}, err
+		return nil, []byte{}, err
 	}
-
-	var buf bytes.Buffer
-	_, err = t.writeToOrdered(&buf, "", "", 0, e.arraysOneElementPerLine, e.order, e.indentation, e.compactComments, false)
-
-	return buf.Bytes(), err
+	return t, nil, nil
 }
 
 // Create next tree with a position based on Encoder.line
@@ -427,33 +920,95 @@ func (e *Encoder) nextTree() *Tree {
 
 // Convert given marshal struct or map value to toml tree
 func (e *Encoder) valueToTree(mtype reflect.Type, mval reflect.Value) (*Tree, error) {
+	if mtype.Kind() == reflect.Ptr || mtype.Kind() == reflect.Map {
+		if err := e.enter(mval); err != nil {
+			return nil, err
+		}
+		defer e.leave(mval)
+	}
 	if mtype.Kind() == reflect.Ptr {
 		return e.valueToTree(mtype.Elem(), mval.Elem())
 	}
+	e.depth++
+	defer func() { e.depth-- }()
+	if err := depthExceeded(e.depth, e.maxDepth); err != nil {
+		return nil, err
+	}
+	if mtype == orderedMapType {
+		return e.orderedMapToTree(mval)
+	}
 	tval := e.nextTree()
 	switch mtype.Kind() {
 	case reflect.Struct:
-		switch mval.Interface().(type) {
+		switch tree := mval.Interface().(type) {
 		case Tree:
-			reflect.ValueOf(tval).Elem().Set(mval)
+			if e.locker != nil {
+				// the tree is written after the lock is released
+				tval = tree.clone()
+			} else {
+				reflect.ValueOf(tval).Elem().Set(mval)
+			}
 		default:
-			for i := 0; i < mtype.NumField(); i++ {
-				mtypef, mvalf := mtype.Field(i), mval.Field(i)
-				opts := tomlOptions(mtypef, e.annotation)
+			fields := promotedFields(mtype, e.annotation).fields
+			if e.promoteAnon {
+				fields = cachedFields(mtype, e.annotation)
+			}
+			for _, field := range fields {
+				mtypef, opts := field.StructField, field.opts
+				mvalf, _ := fieldByIndex(mval, field.index, false)
+				if !mvalf.IsValid() {
+					// promoted from a nil embedded pointer
+					continue
+				}
+				if opts.omitzero && isOmittedZero(mvalf) {
+					continue
+				}
+				if isOptional(mtypef.Type) && !mvalf.Field(1).Bool() {
+					continue
+				}
 				if opts.include && ((mtypef.Type.Kind() != reflect.Interface && !opts.omitempty) || !isZero(mvalf)) {
-					val, err := e.valueToToml(mtypef.Type, mvalf)
+					e.path = append(e.path, opts.name)
+					var val interface{}
+					var err error
+					if opts.secret && e.redact {
+						val = RedactedValue
+					} else if opts.bytes != "" && isByteSlice(mtypef.Type) {
+						val, err = e.bytesToToml(mtypef.Type, mvalf, opts.bytes)
+					} else if opts.layout != "" && isTimeField(mtypef.Type) {
+						val = e.timeToLayout(mvalf, opts.layout)
+					} else {
+						val, err = e.valueToToml(mtypef.Type, mvalf)
+					}
+					e.path = e.path[:len(e.path)-1]
+					if err == errSkipValue {
+						continue
+					}
 					if err != nil {
 						return nil, err
 					}
+					if opts.base != 0 {
+						val = withBase(val, opts.base)
+					}
+					if opts.asString {
+						val = scalarToString(val)
+					}
+					literal := opts.literal || e.literalStrings
+					if source := e.styleSource(mvalf); source != nil && !opts.asString {
+						val, literal = withStyle(val, source, literal)
+					}
 					if tree, ok := val.(*Tree); ok && mtypef.Anonymous && !opts.nameFromTag && !e.promoteAnon {
 						e.appendTree(tval, tree)
 					} else {
 						val = e.wrapTomlValue(val, tval)
-						tval.SetPathWithOptions([]string{opts.name}, SetOptions{
+						key := []string{opts.name}
+						if field.path != nil {
+							key = field.path
+						}
+						tval.SetPathWithOptions(key, SetOptions{
 							Comment:   opts.comment,
 							Commented: opts.commented,
 							Multiline: opts.multiline,
-							Literal:   opts.literal,
+							Literal:   literal,
 						}, val)
 					}
 				}
@@ -461,50 +1016,109 @@ func (e *Encoder) valueToTree(mtype reflect.Type, mval reflect.Value) (*Tree, er
 		}
 	case reflect.Map:
 		keys := mval.MapKeys()
-		if e.order == OrderPreserve && len(keys) > 0 {
-			// Sorting []reflect.Value is not straight forward.
-			//
-			// OrderPreserve will support deterministic results when string is used
-			// as the key to maps.
-			typ := keys[0].Type()
-			kind := keys[0].Kind()
-			if kind == reflect.String {
-				ikeys := make([]string, len(keys))
-				for i := range keys {
-					ikeys[i] = keys[i].Interface().(string)
-				}
-				sort.Strings(ikeys)
-				for i := range ikeys {
-					keys[i] = reflect.ValueOf(ikeys[i]).Convert(typ)
-				}
+		keyStrs := make([]string, len(keys))
+		for i, key := range keys {
+			keyStr, err := mapKeyToString(key)
+			if err != nil {
+				return nil, err
 			}
+			keyStrs[i] = keyStr
+		}
+		if e.order == OrderPreserve || e.normalizeMapKeys {
+			// OrderPreserve gives deterministic results by sorting the keys
+			// of maps.
+			sort.Sort(mapKeys{keys, keyStrs})
 		}
-		for _, key := range keys {
+		normalized := map[string][]string{}
+		var normalizedKeys []string
+		for i, key := range keys {
 			mvalf := mval.MapIndex(key)
 			if (mtype.Elem().Kind() == reflect.Ptr || mtype.Elem().Kind() == reflect.Interface) && mvalf.IsNil() {
 				continue
 			}
+			keyStr := keyStrs[i]
+			if e.normalizeMapKeys {
+				normalizedKey, _ := normalizeKey(keyStr)
+				if originals, exists := normalized[normalizedKey]; exists {
+					normalized[normalizedKey] = append(originals, keyStr)
+					continue
+				}
+				normalized[normalizedKey] = []string{keyStr}
+				normalizedKeys = append(normalizedKeys, normalizedKey)
+				keyStr = normalizedKey
+			}
+			e.path = append(e.path, keyStr)
 			val, err := e.valueToToml(mtype.Elem(), mvalf)
+			e.path = e.path[:len(e.path)-1]
+			if err == errSkipValue {
+				continue
+			}
 			if err != nil {
 				return nil, err
 			}
 			val = e.wrapTomlValue(val, tval)
-			if e.quoteMapKeys {
-				keyStr, err := tomlValueStringRepresentation(key.String(), "", "", e.order, e.arraysOneElementPerLine)
+			if e.quoteMapKeys && !e.normalizeMapKeys {
+				keyStr, err = tomlValueStringRepresentation(keyStr, "", "", e.order, e.arraysOneElementPerLine)
 				if err != nil {
 					return nil, err
 				}
-				tval.SetPath([]string{keyStr}, val)
-			} else {
-				tval.SetPath([]string{key.String()}, val)
+			}
+			tval.SetPath([]string{keyStr}, val)
+		}
+		for _, key := range normalizedKeys {
+			if originals := normalized[key]; len(originals) > 1 {
+				e.collisions = append(e.collisions, KeyCollision{
+					Path:      append([]string(nil), e.path...),
+					Key:       key,
+					Originals: originals,
+				})
 			}
 		}
 	}
 	return tval, nil
 }
 
+// Keys of a map sorted by their string form.
+type mapKeys struct {
+	keys []reflect.Value
+	strs []string
+}
+
+func (k mapKeys) Len() int           { return len(k.keys) }
+func (k mapKeys) Less(i, j int) bool { return k.strs[i] < k.strs[j] }
+func (k mapKeys) Swap(i, j int) {
+	k.keys[i], k.keys[j] = k.keys[j], k.keys[i]
+	k.strs[i], k.strs[j] = k.strs[j], k.strs[i]
+}
+
+// Convert a map key to a TOML key. As with encoding/json, keys are strings,
+// integers, or implement encoding.TextMarshaler.
+func mapKeyToString(key reflect.Value) (string, error) {
+	if key.Kind() == reflect.String {
+		return key.String(), nil
+	}
+	if tm, ok := key.Interface().(encoding.TextMarshaler); ok {
+		if key.Kind() == reflect.Ptr && key.IsNil() {
+			return "", nil
+		}
+		b, err := tm.MarshalText()
+		return string(b), err
+	}
+	switch key.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(key.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("unsupported map key type %v", key.Type())
+}
+
 // Convert given marshal slice to slice of Toml trees
 func (e *Encoder) valueToTreeSlice(mtype reflect.Type, mval reflect.Value) ([]*Tree, error) {
+	if err := e.enter(mval); err != nil {
+		return nil, err
+	}
+	defer e.leave(mval)
 	tval := make([]*Tree, mval.Len(), mval.Len())
 	for i := 0; i < mval.Len(); i++ {
 		val, err := e.valueToTree(mtype.Elem(), mval.Index(i))
@@ -518,41 +1132,146 @@ func (e *Encoder) valueToTreeSlice(mtype reflect.Type, mval reflect.Value) ([]*T
 
 // Convert given marshal slice to slice of toml values
 func (e *Encoder) valueToOtherSlice(mtype reflect.Type, mval reflect.Value) (interface{}, error) {
-	tval := make([]interface{}, mval.Len(), mval.Len())
+	if err := e.enter(mval); err != nil {
+		return nil, err
+	}
+	defer e.leave(mval)
+	e.depth++
+	defer func() { e.depth-- }()
+	if err := depthExceeded(e.depth, e.maxDepth); err != nil {
+		return nil, err
+	}
+	tval := make([]interface{}, 0, mval.Len())
 	for i := 0; i < mval.Len(); i++ {
 		val, err := e.valueToToml(mtype.Elem(), mval.Index(i))
+		if err == errSkipValue {
+			continue
+		}
 		if err != nil {
 			return nil, err
 		}
-		tval[i] = val
+		if tv, ok := val.(*tomlValue); ok {
+			val = tv.value // array elements are written in base 10
+		}
+		tval = append(tval, val)
 	}
 	return tval, nil
 }
 
+// Identity of a pointer, map or slice being encoded. The type distinguishes a
+// struct from its first field, and the length a slice from its prefixes.
+type visit struct {
+	ptr    uintptr
+	length int
+	typ    reflect.Type
+}
+
+func visitOf(mval reflect.Value) (visit, bool) {
+	switch mval.Kind() {
+	case reflect.Ptr, reflect.Map:
+		if mval.IsNil() {
+			return visit{}, false
+		}
+		return visit{ptr: mval.Pointer(), typ: mval.Type()}, true
+	case reflect.Slice:
+		if mval.Len() == 0 {
+			return visit{}, false
+		}
+		return visit{ptr: mval.Pointer(), length: mval.Len(), typ: mval.Type()}, true
+	}
+	return visit{}, false
+}
+
+// Mark the pointer, map or slice mval as being encoded, failing if it already
+// is, as it then contains itself.
+func (e *Encoder) enter(mval reflect.Value) error {
+	v, ok := visitOf(mval)
+	if !ok {
+		return nil
+	}
+	if e.visiting[v] {
+		return fmt.Errorf("cannot encode %s: the %v value contains itself", Key(e.path), mval.Type())
+	}
+	if e.visiting == nil {
+		e.visiting = map[interface{}]bool{}
+	}
+	e.visiting[v] = true
+	return nil
+}
+
+func (e *Encoder) leave(mval reflect.Value) {
+	if v, ok := visitOf(mval); ok {
+		delete(e.visiting, v)
+	}
+}
+
+// Have an integer written in base, other values being left as is.
+func withBase(val interface{}, base int) interface{} {
+	switch v := val.(type) {
+	case int64, uint64:
+		return &tomlValue{value: v, base: base}
+	case *tomlValue:
+		switch v.value.(type) {
+		case int64, uint64:
+			v.base = base
+		}
+	}
+	return val
+}
+
 // Convert given marshal value to toml value
 func (e *Encoder) valueToToml(mtype reflect.Type, mval reflect.Value) (interface{}, error) {
+	if f, ok := e.typeEncoders[mtype]; ok {
+		return e.registeredToToml(f, mtype, mval)
+	}
 	if mtype.Kind() == reflect.Ptr {
 		switch {
+		case mtype.Elem() == bigIntType || mtype.Elem() == bigFloatType:
+			return e.valueToToml(mtype.Elem(), mval.Elem())
 		case isCustomMarshaler(mtype):
 			return callCustomMarshaler(mval)
 		case isTextMarshaler(mtype):
 			b, err := callTextMarshaler(mval)
 			return string(b), err
 		default:
+			if err := e.enter(mval); err != nil {
+				return nil, err
+			}
+			defer e.leave(mval)
 			return e.valueToToml(mtype.Elem(), mval.Elem())
 		}
 	}
 	if mtype.Kind() == reflect.Interface {
 		return e.valueToToml(mval.Elem().Type(), mval.Elem())
 	}
+	if opts, ok := typeOptionsOf(mtype); ok && opts.Base != 0 {
+		switch mtype.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return &tomlValue{value: mval.Int(), base: opts.Base}, nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return &tomlValue{value: mval.Uint(), base: opts.Base}, nil
+		}
+	}
 	switch {
+	case mtype == bigIntType:
+		return bigIntToToml(mval.Interface().(big.Int)), nil
+	case mtype == bigFloatType:
+		return bigFloatToToml(mval.Interface().(big.Float)), nil
 	case isCustomMarshaler(mtype):
 		return callCustomMarshaler(mval)
 	case isTextMarshaler(mtype):
 		b, err := callTextMarshaler(mval)
 		return string(b), err
+	case mtype == deferredType:
+		return mval.Interface().(Deferred).value()
+	case isOptional(mtype):
+		return e.valueToToml(mtype.Field(0).Type, mval.Field(0))
 	case isTree(mtype):
 		return e.valueToTree(mtype, mval)
+	case e.isRegisteredTypeSequence(mtype):
+		return e.valueToOtherSlice(mtype, mval)
+	case isByteSlice(mtype):
+		return e.bytesToToml(mtype, mval, bytesBase64)
 	case isOtherSequence(mtype), isCustomMarshalerSequence(mtype), isTextMarshalerSequence(mtype):
 		return e.valueToOtherSlice(mtype, mval)
 	case isTreeSequence(mtype):
@@ -569,46 +1288,167 @@ func (e *Encoder) valueToToml(mtype reflect.Type, mval reflect.Value) (interface
 		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 			return mval.Uint(), nil
 		case reflect.Float32, reflect.Float64:
-			return mval.Float(), nil
+			f := mval.Float()
+			if e.rejectNaNInf && (math.IsNaN(f) || math.IsInf(f, 0)) {
+				return nil, fmt.Errorf("cannot encode %v at %s: NaN and infinite floats are rejected", f, Key(e.path))
+			}
+			return f, nil
 		case reflect.String:
 			return mval.String(), nil
 		case reflect.Struct:
+			if t, ok := mval.Interface().(time.Time); ok {
+				return e.timeToToml(t), nil
+			}
 			return mval.Interface(), nil
 		default:
-			return nil, fmt.Errorf("Marshal can't handle %v(%v)", mtype, mtype.Kind())
+			return e.unsupportedToToml(mtype, mval)
 		}
 	}
 }
 
-func (e *Encoder) appendTree(t, o *Tree) error {
-	for key, value := range o.values {
-		if _, ok := t.values[key]; ok {
-			continue
+// errSkipValue is returned for the values left out of the document by the
+// UnsupportedTypes policy or the fallback of the encoder.
+var errSkipValue = errors.New("value skipped")
+
+// Handle a value of a type with no TOML representation.
+func (e *Encoder) unsupportedToToml(mtype reflect.Type, mval reflect.Value) (interface{}, error) {
+	if e.fallback != nil && !e.inFallback {
+		v, err := e.fallback(Key(e.path).Append(), mval.Interface())
+		if err != nil {
+			return nil, err
 		}
-		if tomlValue, ok := value.(*tomlValue); ok {
-			tomlValue.position.Col = t.position.Col
+		if v == nil {
+			return nil, errSkipValue
+		}
+		e.inFallback = true
+		defer func() { e.inFallback = false }()
+		return e.valueToToml(reflect.TypeOf(v), reflect.ValueOf(v))
+	}
+	if e.unsupported == UnsupportedTypesSkip {
+		return nil, errSkipValue
+	}
+	return nil, &UnsupportedTypeError{Path: Key(e.path).Append(), Type: mtype}
+}
+
+// Convert a time to the value written for it, following the location and the
+// time format of the encoder.
+func (e *Encoder) timeToToml(t time.Time) interface{} {
+	if e.timeLocation != nil {
+		t = t.In(e.timeLocation)
+	}
+	switch e.timeFormat {
+	case TimeFormatUTC:
+		return t.UTC()
+	case TimeFormatLocal:
+		return LocalDateTimeOf(t)
+	case TimeFormatDateOnly:
+		if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0 {
+			return LocalDateOf(t)
 		}
-		t.values[key] = value
 	}
-	return nil
+	return t
 }
 
-// Create a toml value with the current line number as the position line
-func (e *Encoder) wrapTomlValue(val interface{}, parent *Tree) interface{} {
-	_, isTree := val.(*Tree)
-	_, isTreeS := val.([]*Tree)
-	if isTree || isTreeS {
-		e.line++
-		return val
+// Convert a big integer to an integer if it fits in 64 bits, or to a string
+// otherwise, which the Decoder reads back.
+func bigIntToToml(x big.Int) interface{} {
+	switch {
+	case x.IsInt64():
+		return x.Int64()
+	case x.IsUint64():
+		return x.Uint64()
 	}
+	return x.String()
+}
 
-	ret := &tomlValue{
-		value: val,
-		position: Position{
-			e.line,
-			parent.position.Col,
+// Convert a big float to a float if it is a float64 exactly, or to a string
+// holding all its digits otherwise.
+func bigFloatToToml(x big.Float) interface{} {
+	if f, acc := x.Float64(); acc == big.Exact {
+		return f
+	}
+	return x.Text('g', -1)
+}
+
+// Convert a byte slice to a string or an array of integers, depending on format
+func (e *Encoder) bytesToToml(mtype reflect.Type, mval reflect.Value, format string) (interface{}, error) {
+	switch format {
+	case bytesArray:
+		return e.valueToOtherSlice(mtype, mval)
+	case bytesHex:
+		return hex.EncodeToString(mval.Bytes()), nil
+	default:
+		return base64.StdEncoding.EncodeToString(mval.Bytes()), nil
+	}
+}
+
+// Convert the numbers and booleans of fields with the ",string" option to
+// strings, other values being left as is.
+func scalarToString(val interface{}) interface{} {
+	switch v := val.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return val
+}
+
+// Format the time of mval, a time.Time or a non-nil *time.Time, with a layout.
+func (e *Encoder) timeToLayout(mval reflect.Value, layout string) string {
+	t := reflect.Indirect(mval).Interface().(time.Time)
+	if e.timeLocation != nil {
+		t = t.In(e.timeLocation)
+	}
+	return t.Format(layout)
+}
+
+func (e *Encoder) appendTree(t, o *Tree) error {
+	for key, value := range o.values {
+		if _, ok := t.values[key]; ok {
+			continue
+		}
+		if tomlValue, ok := value.(*tomlValue); ok {
+			tomlValue.position.Col = t.position.Col
+		}
+		t.values[key] = value
+	}
+	return nil
+}
+
+// Create a toml value with the current line number as the position line
+func (e *Encoder) wrapTomlValue(val interface{}, parent *Tree) interface{} {
+	_, isTree := val.(*Tree)
+	_, isTreeS := val.([]*Tree)
+	if isTree || isTreeS {
+		e.line++
+		return val
+	}
+	if tv, ok := val.(*tomlValue); ok {
+		tv.position = Position{e.line, parent.position.Col}
+		e.line++
+		return tv
+	}
+
+	ret := &tomlValue{
+		value: val,
+		position: Position{
+			e.line,
+			parent.position.Col,
 		},
 	}
+	if _, ok := val.(string); ok {
+		ret.wrapWidth = e.wrapStrings
+	}
+	ret.literal = e.literalStrings
+	ret.arrayWrapItems, ret.arrayWrapWidth = e.arrayWrapItems, e.arrayWrapWidth
+	if e.floatFormat != (floatFormat{}) {
+		ret.floatFormat = &e.floatFormat
+	}
 	e.line++
 	return ret
 }
@@ -642,6 +1482,10 @@ func (t *Tree) Marshal() ([]byte, error) {
 //
 //   toml:"Field" Overrides the field's name to map to.
 //   default:"foo" Provides a default value.
+//   toml:",required" or required:"true" Reports an error if the key is missing.
+//
+// Required keys are only checked in tables present in the document. When some
+// are missing, the returned error is a *MissingKeysError listing all of them.
 //
 // For default values, only fields of the following types are supported:
 //   * string
@@ -652,22 +1496,94 @@ func (t *Tree) Marshal() ([]byte, error) {
 //
 // See Marshal() documentation for types mapping table.
 func Unmarshal(data []byte, v interface{}) error {
-	t, err := LoadReader(bytes.NewReader(data))
+	t, err := LoadBytes(data)
 	if err != nil {
 		return err
 	}
 	return t.Unmarshal(v)
 }
 
-// Decoder reads and decodes TOML values from an input stream.
+// Decoder reads and decodes TOML values from an input stream. A Decoder must
+// not be used by several goroutines at once.
 type Decoder struct {
-	r    io.Reader
-	tval *Tree
+	r        io.Reader
+	input    decoderInput
+	tval     *Tree
+	document *Tree
 	encOpts
-	tagName string
-	strict  bool
-	visitor visitorState
-}
+	tagName      string
+	fallbackTag  string
+	strict       bool
+	foldKeys     bool
+	lookupEnv    func(string) (string, bool)
+	includes     func(*Tree) error
+	timeLocation *time.Location
+	timeLayouts  []string
+	rejectLocal  bool
+	decodeHooks  []DecodeHookFunc
+	duplicates   DuplicateKeyPolicy
+	version      TOMLVersion
+	scalarArray  bool
+	mixedArrays  MixedArrayPolicy
+	pointers     PointerPolicy
+	visitor      visitorState
+	collect      bool
+	maxDepth     int
+	depth        int
+	lenientBools bool
+	latin1       bool
+	interfaces   map[reflect.Type]interfaceTypes
+	typeDecoders map[reflect.Type]TypeDecoderFunc
+	limits       decoderLimits
+	ctx          context.Context
+	onUnknownKey func(path Key, v Value)
+	// normalization of keys, and policy for confusable keys
+	normalizeKeys  bool
+	confusableKeys ConfusableKeyPolicy
+	// coercion of scalars, and the coercions of the last call to Decode
+	coerceScalars bool
+	coercions     []Coercion
+	// separator of the documents of streams, and buffered input of streams
+	separator     string
+	stream        *bufio.Reader
+	streamStarted bool
+
+	// keys of tables decoded into structs that have a destination, and the
+	// table an anonymous struct field is being decoded from
+	known    map[*Tree]map[string]bool
+	embedded *Tree
+	// keys and positions of the values decoded into struct fields, by
+	// pointer to the field, when decoding a document
+	fields map[interface{}]fieldSource
+
+	// positions of the elements of the array being decoded, if known
+	elementPositions []Position
+	arrayWarnings    []ArrayElementError
+
+	// key of the table decoded by DecodeAt, key and position of the value
+	// being decoded, and required keys found missing
+	prefix   Key
+	path     Key
+	position Position
+	missing  []Key
+	errors   DecodeErrors
+	warnings []DecodeWarning
+}
+
+// DecodeHookFunc is a function called by the Decoder before converting a TOML
+// value to a Go value. from is the type of data and to is the type of the
+// destination, which is never a pointer type: pointers are allocated by the
+// decoder. Tables are given as *Tree, arrays as []interface{}, and other
+// values as they are returned by Tree.Get. Hooks converting tables can call
+// ToMap on them.
+//
+// If the returned value is of a different type than data and is assignable to
+// the destination, it is used as is. Otherwise decoding proceeds with the
+// returned value in place of data, which allows hooks to be chained. Hooks can
+// replace a table by a *Tree, such as the one given after editing it, which
+// keeps the positions of its values for errors, or by a
+// map[string]interface{}.
+type DecodeHookFunc func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error)
 
 // NewDecoder returns a new decoder that reads from r.
 func NewDecoder(r io.Reader) *Decoder {
@@ -681,13 +1597,59 @@ func NewDecoder(r io.Reader) *Decoder {
 // Decode reads a TOML-encoded value from it's input
 // and unmarshals it in the value pointed at by v.
 //
+// The input is read until EOF, or until the next separator of a stream of
+// documents, as set by Separator. If reading fails, a *ReadError is returned
+// and the data read so far is kept, so that calling Decode again resumes
+// reading.
+//
 // See the documentation for Marshal for details.
 func (d *Decoder) Decode(v interface{}) error {
-	var err error
-	d.tval, err = LoadReader(d.r)
+	tree, err := d.load()
 	if err != nil {
 		return err
 	}
+	d.tval, d.document = tree, tree
+	return d.unmarshal(v)
+}
+
+// Reset makes the decoder read from r, keeping its options, so that it can be
+// reused rather than allocating a new decoder for each document. Input kept
+// after a ReadError is discarded.
+func (d *Decoder) Reset(r io.Reader) {
+	d.r = r
+	d.input.reset()
+	d.stream, d.streamStarted = nil, false
+	d.tval, d.document = nil, nil
+	d.known, d.embedded, d.fields = nil, nil, nil
+	d.elementPositions, d.arrayWarnings = nil, nil
+	d.path, d.missing, d.errors, d.warnings = nil, nil, nil, nil
+	d.coercions = nil
+}
+
+// DecodeAt reads a TOML document from its input and unmarshals only the table
+// at key, such as "server.tls", in the value pointed at by v. The rest of the
+// document is parsed but not decoded, and keys reported in errors and warnings
+// are complete.
+func (d *Decoder) DecodeAt(key string, v interface{}) error {
+	k, err := ParseKey(key)
+	if err != nil {
+		return err
+	}
+	tree, err := d.load()
+	if err != nil {
+		return err
+	}
+	d.document = tree
+	switch node := tree.GetPath(k).(type) {
+	case *Tree:
+		d.tval = node
+	case nil:
+		return fmt.Errorf("key %s not found", k)
+	default:
+		return fmt.Errorf("%s: key %s is not a table", tree.GetPositionPath(k), k)
+	}
+	d.prefix = k
+	defer func() { d.prefix = nil }()
 	return d.unmarshal(v)
 }
 
@@ -697,6 +1659,26 @@ func (d *Decoder) SetTagName(v string) *Decoder {
 	return d
 }
 
+// SetFallbackTagName sets a tag giving the name and options of the fields
+// without the "toml" tag, such as "json" to decode into structs annotated for
+// encoding/json. See Encoder.SetFallbackTagName.
+func (d *Decoder) SetFallbackTagName(v string) *Decoder {
+	d.fallbackTag = v
+	return d
+}
+
+// CaseInsensitive makes the decoder match the keys of tables with the names of
+// struct fields ignoring case, like encoding/json, so that Port is decoded
+// from port, PORT or pOrT. A key matching a name exactly is decoded into that
+// field. Otherwise, it is decoded into the first field matching it ignoring
+// case, fields named by a tag taking priority over the others. Without this
+// option, only the lower case, upper case and capitalized forms of names are
+// tried.
+func (d *Decoder) CaseInsensitive(v bool) *Decoder {
+	d.foldKeys = v
+	return d
+}
+
 // Strict allows changing to strict decoding. Any fields that are found in the
 // input data and do not have a corresponding struct member cause an error.
 func (d *Decoder) Strict(strict bool) *Decoder {
@@ -704,6 +1686,444 @@ func (d *Decoder) Strict(strict bool) *Decoder {
 	return d
 }
 
+// DuplicateKeys sets how keys and tables defined more than once in the
+// document are handled. The default, DuplicateKeysError, fails with a
+// *DuplicateKeyError reporting both definitions. With the other policies,
+// tables defined more than once are merged, and the first or the last value
+// of a redefined key is decoded.
+func (d *Decoder) DuplicateKeys(policy DuplicateKeyPolicy) *Decoder {
+	d.duplicates = policy
+	return d
+}
+
+// Version sets the version of the TOML specification the document must
+// conform to. The default, TOML10, rejects the syntax added by TOML11.
+func (d *Decoder) Version(version TOMLVersion) *Decoder {
+	d.version = version
+	return d
+}
+
+// ScalarToArray allows a single value to be decoded into a slice or array, as
+// if it were an array of one element. For example, tags = "web" decodes into a
+// []string field as []string{"web"}. This is useful for hand-written
+// documents, where brackets are easily forgotten.
+func (d *Decoder) ScalarToArray(enabled bool) *Decoder {
+	d.scalarArray = enabled
+	return d
+}
+
+// TimeFormat defines how the Encoder writes time.Time values.
+type TimeFormat int
+
+const (
+	// TimeFormatOffset writes offset date-times with the offset of the
+	// time, like 1979-05-27T07:32:00-07:00. It is the default.
+	TimeFormatOffset TimeFormat = iota
+	// TimeFormatUTC converts times to UTC and writes them as offset
+	// date-times ending with Z, like 1979-05-27T14:32:00Z.
+	TimeFormatUTC
+	// TimeFormatLocal writes local date-times, without offset, like
+	// 1979-05-27T07:32:00.
+	TimeFormatLocal
+	// TimeFormatDateOnly writes local dates, like 1979-05-27, for times at
+	// midnight, and offset date-times otherwise.
+	TimeFormatDateOnly
+)
+
+// UnsupportedTypePolicy defines how the Encoder handles values of types that
+// have no TOML representation: channels, functions, complex numbers and
+// unsafe pointers.
+type UnsupportedTypePolicy int
+
+const (
+	// UnsupportedTypesError fails encoding with an *UnsupportedTypeError. It
+	// is the default.
+	UnsupportedTypesError UnsupportedTypePolicy = iota
+	// UnsupportedTypesSkip leaves the values out of the document: the keys
+	// of struct fields and maps are omitted, as are the elements of arrays.
+	UnsupportedTypesSkip
+)
+
+// MixedArrayPolicy defines how the Decoder handles the elements of an array
+// that cannot be decoded into the element type of a Go slice or array, as
+// found in mixed-type arrays such as [1, "two", 3.0].
+type MixedArrayPolicy int
+
+const (
+	// MixedArraysError fails decoding with an *ArrayElementError.
+	MixedArraysError MixedArrayPolicy = iota
+	// MixedArraysSkip leaves the offending elements out of the slice and
+	// reports them as warnings.
+	MixedArraysSkip
+	// MixedArraysConvert converts the offending elements when a sensible
+	// conversion exists and reports them as warnings: numbers and booleans
+	// to strings, strings to numbers and booleans, integers to floats and
+	// integral floats to integers. Elements that cannot be converted fail
+	// decoding with an *ArrayElementError.
+	MixedArraysConvert
+)
+
+// PointerPolicy defines how the Decoder handles pointer fields whose key is
+// absent from the document, or holds a value that cannot be decoded into them.
+type PointerPolicy int
+
+const (
+	// PointersDefault leaves the pointers of absent keys unchanged, nil for
+	// new values, and fails decoding for values that cannot be decoded.
+	PointersDefault PointerPolicy = iota
+	// PointersNil leaves the pointers of absent keys unchanged, and sets the
+	// pointers of values that cannot be decoded to nil, reporting them as
+	// warnings.
+	PointersNil
+	// PointersZero allocates the zero value for the nil pointers of absent
+	// keys, and for values that cannot be decoded, reporting them as
+	// warnings.
+	PointersZero
+	// PointersError reports absent keys as missing required keys, and fails
+	// decoding for values that cannot be decoded.
+	PointersError
+)
+
+// ArrayElementError describes an element of a TOML array that could not be
+// decoded into the element type of a Go slice or array.
+type ArrayElementError struct {
+	Index     int          // index of the element in the TOML array
+	Position  Position     // position of the element, invalid if unknown
+	Value     interface{}  // the TOML value of the element
+	Type      reflect.Type // element type of the destination
+	Err       error        // why the element could not be decoded
+	Converted bool         // whether the element was converted by MixedArraysConvert
+}
+
+func (e *ArrayElementError) Error() string {
+	msg := fmt.Sprintf("array element %d: %s", e.Index, e.Err)
+	if e.Converted {
+		msg = fmt.Sprintf("array element %d: %v(%T) converted to %v", e.Index, e.Value, e.Value, e.Type)
+	}
+	if e.Position.Invalid() {
+		return msg
+	}
+	return fmt.Sprintf("%s: %s", e.Position, msg)
+}
+
+// UnsupportedTypeError is returned when encoding a value of a type that has
+// no TOML representation.
+type UnsupportedTypeError struct {
+	Path Key          // key of the value, empty for the document itself
+	Type reflect.Type // type of the value
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	if len(e.Path) == 0 {
+		return fmt.Sprintf("Marshal can't handle %v(%v)", e.Type, e.Type.Kind())
+	}
+	return fmt.Sprintf("Marshal can't handle %v(%v) at %s", e.Type, e.Type.Kind(), e.Path)
+}
+
+// MissingKeysError is returned when decoding a document that lacks keys of
+// fields tagged as required.
+type MissingKeysError struct {
+	Keys []Key
+}
+
+func (e *MissingKeysError) Error() string {
+	keys := make([]string, len(e.Keys))
+	for i, k := range e.Keys {
+		keys[i] = k.String()
+	}
+	if len(keys) == 1 {
+		return "missing required key " + keys[0]
+	}
+	return "missing required keys " + strings.Join(keys, ", ")
+}
+
+// DecodeError describes a key of the document that could not be decoded.
+type DecodeError struct {
+	Key      Key      // key of the value, with indexes for array elements
+	Position Position // position of the value, invalid if unknown
+	Err      error    // why the value could not be decoded
+}
+
+func (e *DecodeError) Error() string {
+	if e.Position.Invalid() {
+		return fmt.Sprintf("%s: %s", e.Key, e.Err)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Position, e.Key, e.Err)
+}
+
+// DecodeErrors is returned by Decode when the Decoder collects errors, and
+// lists them in document order.
+type DecodeErrors []*DecodeError
+
+func (e DecodeErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// CollectErrors makes the Decoder carry on when a value cannot be decoded,
+// leaving the destination unchanged, so that all the problems of a document
+// can be reported at once. Decode then returns a DecodeErrors listing them,
+// including missing required keys.
+func (d *Decoder) CollectErrors(v bool) *Decoder {
+	d.collect = v
+	return d
+}
+
+// Record a decoding error about the value at the current path. Reports
+// whether decoding can go on.
+func (d *Decoder) collectError(err error, pos Position) bool {
+	if !d.collect || d.canceled() {
+		return false
+	}
+	d.errors = append(d.errors, &DecodeError{Key: d.path.Append(), Position: pos, Err: err})
+	d.visitor.visitAll()
+	return true
+}
+
+// DecodeWarning describes a value of the document that was decoded only thanks
+// to a lenient Decoder option.
+type DecodeWarning struct {
+	Key      Key      // key of the value, with indexes for array elements
+	Position Position // position of the value, invalid if unknown
+	Message  string
+}
+
+func (w DecodeWarning) String() string {
+	if w.Position.Invalid() {
+		return fmt.Sprintf("%s: %s", w.Key, w.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", w.Position, w.Key, w.Message)
+}
+
+// LenientBools makes the Decoder accept "yes", "no", "on", "off", "true",
+// "false", "1" and "0" strings in any case, as well as the integers 1 and 0,
+// for bool fields. Each such value is reported by Warnings.
+func (d *Decoder) LenientBools(v bool) *Decoder {
+	d.lenientBools = v
+	return d
+}
+
+// Latin1Fallback sets up the decoder to accept documents that are not valid
+// UTF-8, as written by legacy editors: the bytes that are not part of valid
+// UTF-8 sequences are decoded as Latin-1 (ISO 8859-1) characters, such as é
+// for 0xE9. By default, such documents are rejected with an error giving the
+// position of the first invalid byte.
+func (d *Decoder) Latin1Fallback(v bool) *Decoder {
+	d.latin1 = v
+	return d
+}
+
+// Warnings returns the values accepted by lenient options during the last call
+// to Decode.
+func (d *Decoder) Warnings() []DecodeWarning {
+	return d.warnings
+}
+
+func (d *Decoder) warn(format string, args ...interface{}) {
+	d.warnings = append(d.warnings, DecodeWarning{
+		Key:      d.path.Append(),
+		Position: d.position,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Convert a string or integer to a bool for LenientBools.
+func lenientBool(v interface{}) (bool, bool) {
+	switch value := v.(type) {
+	case string:
+		switch strings.ToLower(value) {
+		case "yes", "on", "true", "1":
+			return true, true
+		case "no", "off", "false", "0":
+			return false, true
+		}
+	case int64:
+		if value == 0 || value == 1 {
+			return value == 1, true
+		}
+	}
+	return false, false
+}
+
+// OnUnknownKey sets a function called for every key of the document decoded
+// into a struct that has no field for it, with the complete key and its value.
+// Unknown tables are reported as a whole. This allows to log or collect extra
+// keys, or to reject some of them by recording an error to return after
+// Decode, unlike Strict which rejects them all.
+func (d *Decoder) OnUnknownKey(f func(path Key, v Value)) *Decoder {
+	d.onUnknownKey = f
+	return d
+}
+
+// Record that key of tval has a destination, for OnUnknownKey.
+func (d *Decoder) markKnown(tval *Tree, key string) {
+	if d.onUnknownKey == nil {
+		return
+	}
+	if d.known == nil {
+		d.known = map[*Tree]map[string]bool{}
+	}
+	if d.known[tval] == nil {
+		d.known[tval] = map[string]bool{}
+	}
+	d.known[tval][key] = true
+}
+
+// Call OnUnknownKey for the keys of tval that have no destination, in the
+// order of the document.
+func (d *Decoder) reportUnknownKeys(tval *Tree) {
+	if d.onUnknownKey == nil || tval == nil {
+		return
+	}
+	for _, node := range sortByLines(tval) {
+		if !d.known[tval][node.key] {
+			d.onUnknownKey(d.path.Append(node.key), tval.GetValuePath([]string{node.key}))
+		}
+	}
+}
+
+// MaxDepth sets how deeply tables may be nested in the decoded document. The
+// default is 1000, and n < 0 removes the limit. The limit also applies while
+// parsing, to the number of parts of keys and to the nesting of arrays and
+// inline tables.
+func (d *Decoder) MaxDepth(n int) *Decoder {
+	d.maxDepth = n
+	return d
+}
+
+// MixedArrays sets how elements of arrays that cannot be decoded into the
+// element type of the destination slice or array are handled. By default,
+// decoding fails.
+func (d *Decoder) MixedArrays(policy MixedArrayPolicy) *Decoder {
+	d.mixedArrays = policy
+	return d
+}
+
+// PointerPolicy sets how pointer fields are decoded when their key is absent
+// from the document, or holds a value of a type that cannot be decoded into
+// them, like a string for a *int. By default, the pointers of absent keys are
+// left nil and values that cannot be decoded fail decoding.
+func (d *Decoder) PointerPolicy(policy PointerPolicy) *Decoder {
+	d.pointers = policy
+	return d
+}
+
+// Set a pointer to nil or to the zero value for the PointerPolicy, after the
+// value of its key could not be decoded.
+func (d *Decoder) setPointerPolicy(fval reflect.Value, reason string) {
+	if d.pointers == PointersZero {
+		fval.Set(reflect.New(fval.Type().Elem()))
+		d.warn("%s, set to the zero value", reason)
+		return
+	}
+	fval.Set(reflect.Zero(fval.Type()))
+	d.warn("%s, left nil", reason)
+}
+
+// ArrayWarnings returns the array elements skipped or converted during the
+// last call to Decode, depending on the MixedArrays policy.
+func (d *Decoder) ArrayWarnings() []ArrayElementError {
+	return d.arrayWarnings
+}
+
+// TimeLocation sets the location offset date-times are converted to when
+// decoded. Use time.UTC to normalize them to UTC. The location is also used to
+// interpret local date-times and local dates decoded into time.Time fields,
+// which otherwise use time.Local. When loc is nil (the default), offset
+// date-times keep the offset written in the document.
+func (d *Decoder) TimeLocation(loc *time.Location) *Decoder {
+	d.timeLocation = loc
+	return d
+}
+
+// TimeLayouts sets the layouts, as for time.Parse, of the strings decoded into
+// time.Time values. Strings are parsed with the first layout they match. Layouts without offset are interpreted in the location
+// set by TimeLocation, or time.Local. The ",layout:" option of the toml tag
+// sets the layout of a single field.
+func (d *Decoder) TimeLayouts(layouts ...string) *Decoder {
+	d.timeLayouts = layouts
+	return d
+}
+
+// RejectLocalDateTimes makes the decoder return an error when the document
+// contains a local date-time (a date-time without offset), for applications
+// that require every date-time to designate an unambiguous instant.
+func (d *Decoder) RejectLocalDateTimes(reject bool) *Decoder {
+	d.rejectLocal = reject
+	return d
+}
+
+// DecodeHook registers functions called for every value of the document before
+// it is converted to its destination type, in the order they are given. This
+// lets applications define conversions for types that cannot implement the
+// Unmarshaler interface, such as string to *regexp.Regexp.
+//
+// See DecodeHookFunc for details.
+func (d *Decoder) DecodeHook(hooks ...DecodeHookFunc) *Decoder {
+	d.decodeHooks = append(d.decodeHooks, hooks...)
+	return d
+}
+
+// Run the decode hooks on a toml value. The returned boolean indicates whether
+// the result is the final value to assign to the destination.
+func (d *Decoder) runDecodeHooks(mtype reflect.Type, tval interface{}) (interface{}, bool, error) {
+	data := tval
+	for _, hook := range d.decodeHooks {
+		var err error
+		data, err = hook(reflect.TypeOf(data), mtype, data)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	dataType := reflect.TypeOf(data)
+	if dataType != nil && dataType != reflect.TypeOf(tval) && dataType.AssignableTo(mtype) {
+		return data, true, nil
+	}
+	if tree, isTree := tval.(*Tree); isTree {
+		switch v := data.(type) {
+		case *Tree:
+			return v, false, nil
+		case map[string]interface{}:
+			// only a table replaced by a hook loses its positions
+			newTree, err := TreeFromMap(v)
+			if err != nil {
+				return nil, false, err
+			}
+			newTree.position = tree.position
+			return newTree, false, nil
+		}
+		return tval, false, nil
+	}
+	return data, false, nil
+}
+
+// Location used to interpret local date-times decoded into time.Time.
+func (d *Decoder) localLocation() *time.Location {
+	if d.timeLocation != nil {
+		return d.timeLocation
+	}
+	return time.Local
+}
+
+// Apply the time zone settings of the decoder to a toml value.
+func (d *Decoder) applyTimePolicy(tval interface{}) (interface{}, error) {
+	switch t := tval.(type) {
+	case time.Time:
+		if d.timeLocation != nil {
+			return t.In(d.timeLocation), nil
+		}
+	case LocalDateTime:
+		if d.rejectLocal {
+			return nil, fmt.Errorf("local date-time %s is not allowed, an offset is required", t)
+		}
+	}
+	return tval, nil
+}
+
 func (d *Decoder) unmarshal(v interface{}) error {
 	mtype := reflect.TypeOf(v)
 	if mtype == nil {
@@ -720,7 +2140,9 @@ func (d *Decoder) unmarshal(v interface{}) error {
 	case reflect.Interface:
 		elem = mapStringInterfaceType
 	default:
-		return errors.New("only a pointer to struct or map can be unmarshaled from TOML")
+		if elem != orderedMapType {
+			return errors.New("only a pointer to struct or map can be unmarshaled from TOML")
+		}
 	}
 
 	if reflect.ValueOf(v).IsNil() {
@@ -728,6 +2150,14 @@ func (d *Decoder) unmarshal(v interface{}) error {
 	}
 
 	vv := reflect.ValueOf(v).Elem()
+	d.arrayWarnings = nil
+	d.path, d.missing, d.errors, d.warnings = d.prefix.Append(), nil, nil, nil
+	d.coercions = nil
+	d.depth = 0
+	d.known, d.embedded, d.fields = nil, nil, nil
+	if err := d.checkKeys(d.document, nil); err != nil {
+		return err
+	}
 
 	if d.strict {
 		d.visitor = newVisitorState(d.tval)
@@ -735,8 +2165,21 @@ func (d *Decoder) unmarshal(v interface{}) error {
 
 	sval, err := d.valueFromTree(elem, d.tval, &vv)
 	if err != nil {
+		if d.canceled() {
+			return d.ctx.Err()
+		}
 		return err
 	}
+	if len(d.errors) > 0 {
+		sort.SliceStable(d.errors, func(i, j int) bool {
+			a, b := d.errors[i].Position, d.errors[j].Position
+			return a.Line < b.Line || (a.Line == b.Line && a.Col < b.Col)
+		})
+		return d.errors
+	}
+	if len(d.missing) > 0 {
+		return &MissingKeysError{Keys: d.missing}
+	}
 	if err := d.visitor.validate(); err != nil {
 		return err
 	}
@@ -751,14 +2194,33 @@ func (d *Decoder) valueFromTree(mtype reflect.Type, tval *Tree, mval1 *reflect.V
 		return d.unwrapPointer(mtype, tval, mval1)
 	}
 
+	d.depth++
+	defer func() { d.depth-- }()
+	if err := depthExceeded(d.depth, d.maxDepth); err != nil {
+		return reflect.ValueOf(nil), err
+	}
+	if d.canceled() {
+		return reflect.ValueOf(nil), d.ctx.Err()
+	}
+
+	if mtype == orderedMapType {
+		d.visitor.visitAll()
+		if tval == nil {
+			return reflect.Zero(mtype), nil
+		}
+		m, err := d.orderedMapFromTree(tval)
+		return reflect.ValueOf(m), err
+	}
+
 	// Check if pointer to value implements the Unmarshaler interface.
-	if mvalPtr := reflect.New(mtype); isCustomUnmarshaler(mvalPtr.Type()) {
+	if planFor(mtype).customUnmarshaler {
 		d.visitor.visitAll()
 
 		if tval == nil {
-			return mvalPtr.Elem(), nil
+			return reflect.New(mtype).Elem(), nil
 		}
 
+		mvalPtr := reflect.New(mtype)
 		if err := callCustomUnmarshaler(mvalPtr, tval.ToMap()); err != nil {
 			return reflect.ValueOf(nil), fmt.Errorf("unmarshal toml: %v", err)
 		}
@@ -774,27 +2236,42 @@ func (d *Decoder) valueFromTree(mtype reflect.Type, tval *Tree, mval1 *reflect.V
 			mval = reflect.New(mtype).Elem()
 		}
 
+		embedded := tval != nil && d.embedded == tval
+		d.embedded = nil
+
 		switch mval.Interface().(type) {
 		case Tree:
 			mval.Set(reflect.ValueOf(tval).Elem())
 		default:
-			for i := 0; i < mtype.NumField(); i++ {
-				mtypef := mtype.Field(i)
-				an := annotation{tag: d.tagName}
-				opts := tomlOptions(mtypef, an)
+			promoted := promotedFields(mtype, annotation{tag: d.tagName, fallbackTag: d.fallbackTag})
+			fields := promoted.fields
+			for i, field := range fields {
+				mtypef, opts := field.StructField, field.opts
 				if !opts.include {
 					continue
 				}
 				baseKey := opts.name
-				keysToTry := []string{
-					baseKey,
-					strings.ToLower(baseKey),
-					strings.ToTitle(baseKey),
-					strings.ToLower(string(baseKey[0])) + baseKey[1:],
-				}
 
 				found := false
-				if tval != nil {
+				// fields with a dotted name are decoded from a sub-table
+				table, prefix := tval, []string(nil)
+				if field.path != nil && tval != nil {
+					prefix = field.path[:len(field.path)-1]
+					table, _ = tval.GetPath(prefix).(*Tree)
+					if table != nil {
+						d.markKnown(tval, prefix[0])
+						for _, key := range prefix {
+							d.visitor.push(key)
+						}
+						d.path = append(d.path, prefix...)
+					}
+				}
+				if table != nil {
+					tval := table
+					keysToTry := field.keysToTry
+					if d.foldKeys && prefix == nil {
+						keysToTry = append(keysToTry[:len(keysToTry):len(keysToTry)], foldedKeys(fields, i, tval)...)
+					}
 					for _, key := range keysToTry {
 						exists := tval.HasPath([]string{key})
 						if !exists {
@@ -802,74 +2279,83 @@ func (d *Decoder) valueFromTree(mtype reflect.Type, tval *Tree, mval1 *reflect.V
 						}
 
 						d.visitor.push(key)
+						d.path = append(d.path, key)
 						val := tval.GetPath([]string{key})
-						fval := mval.Field(i)
-						mvalf, err := d.valueFromToml(mtypef.Type, val, &fval)
-						if err != nil {
+						fval, err := fieldByIndex(mval, field.index, true)
+						if err == nil {
+							var mvalf reflect.Value
+							if s, ok := val.(string); ok && opts.bytes != "" && isByteSlice(mtypef.Type) {
+								d.visitor.visit()
+								mvalf, err = bytesFromToml(mtypef.Type, s, opts.bytes)
+							} else if s, ok := val.(string); ok && opts.layout != "" && isTimeField(mtypef.Type) {
+								d.visitor.visit()
+								mvalf, err = d.timeFromLayouts(mtypef.Type, s, []string{opts.layout})
+							} else if s, ok := val.(string); ok && opts.asString && isStringScalar(mtypef.Type) {
+								d.position = tval.GetPositionPath([]string{key})
+								if val, err = scalarFromString(mtypef.Type, s); err == nil {
+									mvalf, err = d.valueFromToml(mtypef.Type, val, &fval)
+								}
+							} else {
+								d.elementPositions = tval.elementPositions(key)
+								d.position = tval.GetPositionPath([]string{key})
+								mvalf, err = d.valueFromToml(mtypef.Type, val, &fval)
+							}
+							if err == nil {
+								fval.Set(mvalf)
+								d.recordField(fval, tval.GetPositionPath([]string{key}), tval.values[key])
+							} else if mtypef.Type.Kind() == reflect.Ptr && (d.pointers == PointersNil || d.pointers == PointersZero) {
+								d.position = tval.GetPositionPath([]string{key})
+								d.setPointerPolicy(fval, fmt.Sprintf("cannot decode %s into %v (%s)", nodeValue{node: val}.Kind(), mtypef.Type, err))
+								err = nil
+							}
+						}
+						if err != nil && !d.collectError(err, tval.GetPositionPath([]string{key})) {
 							return mval, formatError(err, tval.GetPositionPath([]string{key}))
 						}
-						mval.Field(i).Set(mvalf)
+						d.markKnown(tval, key)
 						found = true
 						d.visitor.pop()
+						d.path = d.path[:len(d.path)-1]
 						break
 					}
 				}
+				if table != nil && prefix != nil {
+					for range prefix {
+						d.visitor.pop()
+					}
+					d.path = d.path[:len(d.path)-len(prefix)]
+				}
 
-				if !found && opts.defaultValue != "" {
-					mvalf := mval.Field(i)
-					var val interface{}
-					var err error
-					switch mvalf.Kind() {
-					case reflect.String:
-						val = opts.defaultValue
-					case reflect.Bool:
-						val, err = strconv.ParseBool(opts.defaultValue)
-					case reflect.Uint:
-						val, err = strconv.ParseUint(opts.defaultValue, 10, 0)
-					case reflect.Uint8:
-						val, err = strconv.ParseUint(opts.defaultValue, 10, 8)
-					case reflect.Uint16:
-						val, err = strconv.ParseUint(opts.defaultValue, 10, 16)
-					case reflect.Uint32:
-						val, err = strconv.ParseUint(opts.defaultValue, 10, 32)
-					case reflect.Uint64:
-						val, err = strconv.ParseUint(opts.defaultValue, 10, 64)
-					case reflect.Int:
-						val, err = strconv.ParseInt(opts.defaultValue, 10, 0)
-					case reflect.Int8:
-						val, err = strconv.ParseInt(opts.defaultValue, 10, 8)
-					case reflect.Int16:
-						val, err = strconv.ParseInt(opts.defaultValue, 10, 16)
-					case reflect.Int32:
-						val, err = strconv.ParseInt(opts.defaultValue, 10, 32)
-					case reflect.Int64:
-						// Check if the provided number has a non-numeric extension.
-						var hasExtension bool
-						if len(opts.defaultValue) > 0 {
-							lastChar := opts.defaultValue[len(opts.defaultValue)-1]
-							if lastChar < '0' || lastChar > '9' {
-								hasExtension = true
-							}
-						}
-						// If the value is a time.Duration with extension, parse as duration.
-						// If the value is an int64 or a time.Duration without extension, parse as number.
-						if hasExtension && mvalf.Type().String() == "time.Duration" {
-							val, err = time.ParseDuration(opts.defaultValue)
-						} else {
-							val, err = strconv.ParseInt(opts.defaultValue, 10, 64)
-						}
-					case reflect.Float32:
-						val, err = strconv.ParseFloat(opts.defaultValue, 32)
-					case reflect.Float64:
-						val, err = strconv.ParseFloat(opts.defaultValue, 64)
-					default:
-						return mvalf, fmt.Errorf("unsupported field type for default option")
+				if !found && mtypef.Type.Kind() == reflect.Ptr && d.pointers == PointersZero {
+					if fval, err := fieldByIndex(mval, field.index, false); err == nil && fval.IsValid() && fval.IsNil() {
+						fval.Set(reflect.New(mtypef.Type.Elem()))
 					}
+				}
+				if !found && (opts.required || mtypef.Type.Kind() == reflect.Ptr && d.pointers == PointersError) && tval != nil {
+					missing := d.path.Append(baseKey)
+					if field.path != nil {
+						missing = d.path.Append(field.path...)
+					}
+					if d.collect {
+						d.errors = append(d.errors, &DecodeError{
+							Key:      missing,
+							Position: tval.Position(),
+							Err:      errors.New("missing required key"),
+						})
+					} else {
+						d.missing = append(d.missing, missing)
+					}
+				}
 
+				if !found && opts.defaultValue != "" {
+					if field.defaultErr != nil {
+						return mval, field.defaultErr
+					}
+					fval, err := fieldByIndex(mval, field.index, true)
 					if err != nil {
-						return mvalf, err
+						return mval, err
 					}
-					mvalf.Set(reflect.ValueOf(val).Convert(mvalf.Type()))
+					fval.Set(field.defaultVal)
 				}
 
 				// save the old behavior above and try to check structs
@@ -878,32 +2364,101 @@ func (d *Decoder) valueFromTree(mtype reflect.Type, tval *Tree, mval1 *reflect.V
 					if !mtypef.Anonymous {
 						tmpTval = nil
 					}
-					fval := mval.Field(i)
+					d.embedded = tmpTval
+					fval, err := fieldByIndex(mval, field.index, true)
+					if err != nil {
+						return mval, err
+					}
 					v, err := d.valueFromTree(mtypef.Type, tmpTval, &fval)
 					if err != nil {
 						return v, err
 					}
-					mval.Field(i).Set(v)
+					fval.Set(v)
 				}
 			}
+			for _, field := range promoted.hidden {
+				if field.defaultErr != nil {
+					return mval, field.defaultErr
+				}
+				if fval, _ := fieldByIndex(mval, field.index, false); fval.IsValid() {
+					fval.Set(field.defaultVal)
+				}
+			}
+			if !embedded {
+				d.reportUnknownKeys(tval)
+			}
 		}
 	case reflect.Map:
 		mval = reflect.MakeMap(mtype)
+		// string keys and interface values are set through reused values,
+		// which saves an allocation for each of them
+		var mkeyString, melem reflect.Value
+		if mtype.Key().Kind() == reflect.String {
+			mkeyString = reflect.New(mtype.Key()).Elem()
+		}
+		if mtype.Elem().Kind() == reflect.Interface {
+			melem = reflect.New(mtype.Elem()).Elem()
+		}
 		for _, key := range tval.Keys() {
 			d.visitor.push(key)
+			d.path = append(d.path, key)
 			// TODO: path splits key
 			val := tval.GetPath([]string{key})
+			d.elementPositions = tval.elementPositions(key)
+			d.position = tval.GetPositionPath([]string{key})
 			mvalf, err := d.valueFromToml(mtype.Elem(), val, nil)
-			if err != nil {
+			var mkey reflect.Value
+			if err == nil && mkeyString.IsValid() {
+				mkeyString.SetString(key)
+				mkey = mkeyString
+			} else if err == nil {
+				mkey, err = mapKeyFromString(mtype.Key(), key)
+			}
+			if err == nil && melem.IsValid() && mvalf.IsValid() {
+				melem.Set(mvalf)
+				mvalf = melem
+			}
+			if err == nil {
+				mval.SetMapIndex(mkey, mvalf)
+			} else if !d.collectError(err, tval.GetPositionPath([]string{key})) {
 				return mval, formatError(err, tval.GetPositionPath([]string{key}))
 			}
-			mval.SetMapIndex(reflect.ValueOf(key).Convert(mtype.Key()), mvalf)
 			d.visitor.pop()
+			d.path = d.path[:len(d.path)-1]
 		}
 	}
 	return mval, nil
 }
 
+// Convert a TOML key to a map key of type mtype, as mapKeyToString.
+func mapKeyFromString(mtype reflect.Type, key string) (reflect.Value, error) {
+	if mtype.Kind() == reflect.String {
+		return reflect.ValueOf(key).Convert(mtype), nil
+	}
+	if reflect.PtrTo(mtype).Implements(textUnmarshalerType) {
+		mkey := reflect.New(mtype)
+		if err := mkey.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(key)); err != nil {
+			return reflect.ValueOf(nil), fmt.Errorf("cannot decode key %q into %v: %s", key, mtype, err)
+		}
+		return mkey.Elem(), nil
+	}
+	switch mtype.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(key, 10, mtype.Bits())
+		if err != nil {
+			return reflect.ValueOf(nil), fmt.Errorf("cannot decode key %q into %v", key, mtype)
+		}
+		return reflect.ValueOf(i).Convert(mtype), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(key, 10, mtype.Bits())
+		if err != nil {
+			return reflect.ValueOf(nil), fmt.Errorf("cannot decode key %q into %v", key, mtype)
+		}
+		return reflect.ValueOf(u).Convert(mtype), nil
+	}
+	return reflect.ValueOf(nil), fmt.Errorf("unsupported map key type %v", mtype)
+}
+
 // Convert toml value to marshal struct/map slice, using marshal type
 func (d *Decoder) valueFromTreeSlice(mtype reflect.Type, tval []*Tree) (reflect.Value, error) {
 	mval, err := makeSliceOrArray(mtype, len(tval))
@@ -913,51 +2468,142 @@ func (d *Decoder) valueFromTreeSlice(mtype reflect.Type, tval []*Tree) (reflect.
 
 	for i := 0; i < len(tval); i++ {
 		d.visitor.push(strconv.Itoa(i))
-		val, err := d.valueFromTree(mtype.Elem(), tval[i], nil)
+		d.path = append(d.path, strconv.Itoa(i))
+		var val reflect.Value
+		var err error
+		switch mtype.Elem().Kind() {
+		case reflect.Interface:
+			val, err = d.valueFromToml(mtype.Elem(), tval[i], nil)
+			if err != nil {
+				err = &ArrayElementError{Index: i, Position: tval[i].position, Value: tval[i], Type: mtype.Elem(), Err: err}
+			}
+		case reflect.Struct:
+			elem := mval.Index(i)
+			val, err = d.valueFromTree(mtype.Elem(), tval[i], &elem)
+		default:
+			val, err = d.valueFromTree(mtype.Elem(), tval[i], nil)
+		}
 		if err != nil {
 			return mval, err
 		}
 		mval.Index(i).Set(val)
 		d.visitor.pop()
+		d.path = d.path[:len(d.path)-1]
 	}
 	return mval, nil
 }
 
 // Convert toml value to marshal primitive slice, using marshal type
 func (d *Decoder) valueFromOtherSlice(mtype reflect.Type, tval []interface{}) (reflect.Value, error) {
+	positions := d.elementPositions
+	d.elementPositions = nil
 	mval, err := makeSliceOrArray(mtype, len(tval))
 	if err != nil {
 		return mval, err
 	}
 
+	length := 0
 	for i := 0; i < len(tval); i++ {
+		d.path = append(d.path, strconv.Itoa(i))
+		d.position = Position{}
+		if i < len(positions) {
+			d.position = positions[i]
+		}
 		val, err := d.valueFromToml(mtype.Elem(), tval[i], nil)
+		d.path = d.path[:len(d.path)-1]
 		if err != nil {
-			return mval, err
+			elementErr := ArrayElementError{Index: i, Value: tval[i], Type: mtype.Elem(), Err: err}
+			if i < len(positions) {
+				elementErr.Position = positions[i]
+			}
+			switch d.mixedArrays {
+			case MixedArraysSkip:
+				d.arrayWarnings = append(d.arrayWarnings, elementErr)
+				continue
+			case MixedArraysConvert:
+				if converted, ok := convertArrayElement(mtype.Elem(), tval[i]); ok {
+					val, err = d.valueFromToml(mtype.Elem(), converted, nil)
+				}
+			}
+			if err != nil {
+				if d.collect {
+					d.errors = append(d.errors, &DecodeError{Key: d.path.Append(strconv.Itoa(i)), Position: elementErr.Position, Err: err})
+					continue
+				}
+				return mval, &elementErr
+			}
+			elementErr.Converted = true
+			d.arrayWarnings = append(d.arrayWarnings, elementErr)
 		}
-		mval.Index(i).Set(val)
+		mval.Index(length).Set(val)
+		length++
+	}
+	if mtype.Kind() == reflect.Slice {
+		mval = mval.Slice(0, length)
 	}
 	return mval, nil
 }
 
-// Convert toml value to marshal primitive slice, using marshal type
-func (d *Decoder) valueFromOtherSliceI(mtype reflect.Type, tval interface{}) (reflect.Value, error) {
-	val := reflect.ValueOf(tval)
-	length := val.Len()
-
-	mval, err := makeSliceOrArray(mtype, length)
-	if err != nil {
-		return mval, err
+// Positions of the elements of the array value at key, if known.
+func (t *Tree) elementPositions(key string) []Position {
+	if value, ok := t.values[key].(*tomlValue); ok {
+		return value.elementPositions
 	}
+	return nil
+}
 
-	for i := 0; i < length; i++ {
-		val, err := d.valueFromToml(mtype.Elem(), val.Index(i).Interface(), nil)
-		if err != nil {
-			return mval, err
+// Convert a TOML value to a value of another TOML type decodable into mtype,
+// for MixedArraysConvert.
+func convertArrayElement(mtype reflect.Type, v interface{}) (interface{}, bool) {
+	for mtype.Kind() == reflect.Ptr {
+		mtype = mtype.Elem()
+	}
+	switch mtype.Kind() {
+	case reflect.String:
+		switch value := v.(type) {
+		case int64, uint64, float64, bool, LocalDate, LocalTime, LocalDateTime:
+			return fmt.Sprint(value), true
+		case time.Time:
+			return value.Format(time.RFC3339Nano), true
+		}
+	case reflect.Bool:
+		if s, ok := v.(string); ok {
+			b, err := strconv.ParseBool(strings.TrimSpace(s))
+			return b, err == nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch value := v.(type) {
+		case float64:
+			if value == math.Trunc(value) && math.Abs(value) < 1<<63 {
+				return int64(value), true
+			}
+		case string:
+			i, err := strconv.ParseInt(strings.TrimSpace(value), 0, 64)
+			return i, err == nil
+		}
+	case reflect.Float32, reflect.Float64:
+		switch value := v.(type) {
+		case int64:
+			return float64(value), true
+		case uint64:
+			return float64(value), true
+		case string:
+			f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			return f, err == nil
 		}
-		mval.Index(i).Set(val)
 	}
-	return mval, nil
+	return nil, false
+}
+
+// Convert toml value to marshal primitive slice, using marshal type
+func (d *Decoder) valueFromOtherSliceI(mtype reflect.Type, tval interface{}) (reflect.Value, error) {
+	val := reflect.ValueOf(tval)
+	elements := make([]interface{}, val.Len())
+	for i := range elements {
+		elements[i] = val.Index(i).Interface()
+	}
+	return d.valueFromOtherSlice(mtype, elements)
 }
 
 // Create a new slice or a new array with specified length
@@ -978,10 +2624,54 @@ func makeSliceOrArray(mtype reflect.Type, tLength int) (reflect.Value, error) {
 // Convert toml value to marshal value, using marshal type. When mval1 is non-nil
 // and the given type is a struct value, merge fields into it.
 func (d *Decoder) valueFromToml(mtype reflect.Type, tval interface{}, mval1 *reflect.Value) (reflect.Value, error) {
-	if mtype.Kind() == reflect.Ptr {
+	val, err := d.convertFromToml(mtype, tval, mval1)
+	if err != nil {
+		return val, err
+	}
+	return val, checkTypeOptions(mtype, val)
+}
+
+func (d *Decoder) convertFromToml(mtype reflect.Type, tval interface{}, mval1 *reflect.Value) (reflect.Value, error) {
+	decode, registered := d.typeDecoders[mtype]
+	if mtype.Kind() == reflect.Ptr && !registered {
 		return d.unwrapPointer(mtype, tval, mval1)
 	}
 
+	if mtype == deferredType {
+		d.visitor.visitAll()
+		r, err := deferredFromToml(tval)
+		return reflect.ValueOf(r), err
+	}
+
+	if len(d.decodeHooks) > 0 {
+		hooked, final, err := d.runDecodeHooks(mtype, tval)
+		if err != nil {
+			return reflect.ValueOf(nil), err
+		}
+		if final {
+			d.visitor.visitAll()
+			val := reflect.New(mtype).Elem()
+			val.Set(reflect.ValueOf(hooked))
+			return val, nil
+		}
+		tval = hooked
+	}
+
+	if registered {
+		return d.registeredFromToml(decode, mtype, tval)
+	}
+
+	plan := planFor(mtype)
+	if plan.optional {
+		val, err := d.valueFromToml(mtype.Field(0).Type, tval, nil)
+		if err != nil {
+			return val, err
+		}
+		mval := reflect.New(mtype).Elem()
+		mval.Field(0).Set(val)
+		mval.Field(1).SetBool(true)
+		return mval, nil
+	}
 	switch t := tval.(type) {
 	case *Tree:
 		var mval11 *reflect.Value
@@ -989,11 +2679,18 @@ func (d *Decoder) valueFromToml(mtype reflect.Type, tval interface{}, mval1 *ref
 			mval11 = mval1
 		}
 
-		if isTree(mtype) {
+		if plan.tree {
 			return d.valueFromTree(mtype, t, mval11)
 		}
 
+		if registered, ok := d.interfaces[mtype]; ok {
+			return d.valueFromRegisteredType(registered, mtype, t)
+		}
+
 		if mtype.Kind() == reflect.Interface {
+			if mtype.NumMethod() > 0 && (mval1 == nil || mval1.IsNil()) {
+				return reflect.ValueOf(nil), unregisteredInterfaceError("a table", mtype)
+			}
 			if mval1 == nil || mval1.IsNil() {
 				return d.valueFromTree(reflect.TypeOf(map[string]interface{}{}), t, nil)
 			} else {
@@ -1003,10 +2700,13 @@ func (d *Decoder) valueFromToml(mtype reflect.Type, tval interface{}, mval1 *ref
 
 		return reflect.ValueOf(nil), fmt.Errorf("Can't convert %v(%T) to a tree", tval, tval)
 	case []*Tree:
-		if isTreeSequence(mtype) {
+		if plan.treeSequence || d.isRegisteredSequence(mtype) {
 			return d.valueFromTreeSlice(mtype, t)
 		}
 		if mtype.Kind() == reflect.Interface {
+			if mtype.NumMethod() > 0 && (mval1 == nil || mval1.IsNil()) {
+				return reflect.ValueOf(nil), unregisteredInterfaceError("an array of tables", mtype)
+			}
 			if mval1 == nil || mval1.IsNil() {
 				return d.valueFromTreeSlice(reflect.TypeOf([]map[string]interface{}{}), t)
 			} else {
@@ -1017,10 +2717,14 @@ func (d *Decoder) valueFromToml(mtype reflect.Type, tval interface{}, mval1 *ref
 		return reflect.ValueOf(nil), fmt.Errorf("Can't convert %v(%T) to trees", tval, tval)
 	case []interface{}:
 		d.visitor.visit()
-		if isOtherSequence(mtype) {
+		// with decode hooks, elements may be converted to tables
+		if plan.otherSequence || (len(d.decodeHooks) > 0 || d.isRegisteredTypeSequence(mtype)) && (mtype.Kind() == reflect.Slice || mtype.Kind() == reflect.Array) {
 			return d.valueFromOtherSlice(mtype, t)
 		}
 		if mtype.Kind() == reflect.Interface {
+			if mtype.NumMethod() > 0 && (mval1 == nil || mval1.IsNil()) {
+				return reflect.ValueOf(nil), unregisteredInterfaceError("an array", mtype)
+			}
 			if mval1 == nil || mval1.IsNil() {
 				return d.valueFromOtherSlice(reflect.TypeOf([]interface{}{}), t)
 			} else {
@@ -1031,10 +2735,29 @@ func (d *Decoder) valueFromToml(mtype reflect.Type, tval interface{}, mval1 *ref
 		return reflect.ValueOf(nil), fmt.Errorf("Can't convert %v(%T) to a slice", tval, tval)
 	default:
 		d.visitor.visit()
-		mvalPtr := reflect.New(mtype)
+		tval, err := d.applyTimePolicy(tval)
+		if err != nil {
+			return reflect.ValueOf(nil), err
+		}
+		if s, ok := tval.(string); ok && isByteSlice(mtype) {
+			return bytesFromToml(mtype, s, bytesBase64)
+		}
+		if d.scalarArray && (mtype.Kind() == reflect.Slice || mtype.Kind() == reflect.Array) &&
+			!plan.customUnmarshaler && !isTextUnmarshaler(reflect.PtrTo(mtype)) {
+			return d.valueFromOtherSlice(mtype, []interface{}{tval})
+		}
+
+		if mtype == bigFloatType {
+			return bigFloatFromToml(tval)
+		}
+
+		if s, ok := tval.(string); ok && mtype == timeType && len(d.timeLayouts) > 0 {
+			return d.timeFromLayouts(mtype, s, d.timeLayouts)
+		}
 
 		// Check if pointer to value implements the Unmarshaler interface.
-		if isCustomUnmarshaler(mvalPtr.Type()) {
+		if plan.customUnmarshaler {
+			mvalPtr := reflect.New(mtype)
 			if err := callCustomUnmarshaler(mvalPtr, tval); err != nil {
 				return reflect.ValueOf(nil), fmt.Errorf("unmarshal toml: %v", err)
 			}
@@ -1042,13 +2765,15 @@ func (d *Decoder) valueFromToml(mtype reflect.Type, tval interface{}, mval1 *ref
 		}
 
 		// Check if pointer to value implements the encoding.TextUnmarshaler.
-		if isTextUnmarshaler(mvalPtr.Type()) && !isTimeType(mtype) {
+		if plan.textUnmarshaler {
+			mvalPtr := reflect.New(mtype)
 			if err := d.unmarshalText(tval, mvalPtr); err != nil {
 				return reflect.ValueOf(nil), fmt.Errorf("unmarshal text: %v", err)
 			}
 			return mvalPtr.Elem(), nil
 		}
 
+		tval = d.coerceScalar(mtype, tval)
 		switch mtype.Kind() {
 		case reflect.Bool, reflect.Struct:
 			val := reflect.ValueOf(tval)
@@ -1058,7 +2783,7 @@ func (d *Decoder) valueFromToml(mtype reflect.Type, tval interface{}, mval1 *ref
 				localDate := val.Interface().(LocalDate)
 				switch mtype {
 				case timeType:
-					return reflect.ValueOf(time.Date(localDate.Year, localDate.Month, localDate.Day, 0, 0, 0, 0, time.Local)), nil
+					return reflect.ValueOf(time.Date(localDate.Year, localDate.Month, localDate.Day, 0, 0, 0, 0, d.localLocation())), nil
 				}
 			case localDateTimeType:
 				localDateTime := val.Interface().(LocalDateTime)
@@ -1072,7 +2797,14 @@ func (d *Decoder) valueFromToml(mtype reflect.Type, tval interface{}, mval1 *ref
 						localDateTime.Time.Minute,
 						localDateTime.Time.Second,
 						localDateTime.Time.Nanosecond,
-						time.Local)), nil
+						d.localLocation())), nil
+				}
+			}
+
+			if mtype.Kind() == reflect.Bool && d.lenientBools && val.Kind() != reflect.Bool {
+				if b, ok := lenientBool(tval); ok {
+					d.warn("converted %v(%T) to %v", tval, tval, b)
+					return reflect.ValueOf(b).Convert(mtype), nil
 				}
 			}
 
@@ -1102,7 +2834,8 @@ func (d *Decoder) valueFromToml(mtype reflect.Type, tval interface{}, mval1 *ref
 			if !val.Type().ConvertibleTo(mtype) || val.Kind() == reflect.Float64 {
 				return reflect.ValueOf(nil), fmt.Errorf("Can't convert %v(%T) to %v", tval, tval, mtype.String())
 			}
-			if reflect.Indirect(reflect.New(mtype)).OverflowInt(val.Convert(reflect.TypeOf(int64(0))).Int()) {
+			if val.Kind() == reflect.Uint64 && val.Uint() > math.MaxInt64 ||
+				reflect.Indirect(reflect.New(mtype)).OverflowInt(val.Convert(reflect.TypeOf(int64(0))).Int()) {
 				return reflect.ValueOf(nil), fmt.Errorf("%v(%T) would overflow %v", tval, tval, mtype.String())
 			}
 
@@ -1133,7 +2866,11 @@ func (d *Decoder) valueFromToml(mtype reflect.Type, tval interface{}, mval1 *ref
 			return val.Convert(mtype), nil
 		case reflect.Interface:
 			if mval1 == nil || mval1.IsNil() {
-				return reflect.ValueOf(tval), nil
+				val := reflect.ValueOf(tval)
+				if !val.Type().AssignableTo(mtype) {
+					return reflect.ValueOf(nil), fmt.Errorf("Can't convert %v(%T) to %v", tval, tval, mtype.String())
+				}
+				return val, nil
 			} else {
 				ival := mval1.Elem()
 				return d.valueFromToml(mval1.Elem().Type(), t, &ival)
@@ -1149,6 +2886,34 @@ func (d *Decoder) valueFromToml(mtype reflect.Type, tval interface{}, mval1 *ref
 	}
 }
 
+// Decode a big float from a number, or from a string with enough precision for
+// all its digits.
+func bigFloatFromToml(tval interface{}) (reflect.Value, error) {
+	var x big.Float
+	switch v := tval.(type) {
+	case int64:
+		x.SetInt64(v)
+	case uint64:
+		x.SetUint64(v)
+	case float64:
+		if math.IsNaN(v) {
+			return reflect.ValueOf(nil), fmt.Errorf("Can't convert %v(%T) to big.Float", tval, tval)
+		}
+		x.SetFloat64(v)
+	case string:
+		prec := uint(len(v)) * 4
+		if prec < 64 {
+			prec = 64
+		}
+		if _, ok := x.SetPrec(prec).SetString(v); !ok {
+			return reflect.ValueOf(nil), fmt.Errorf("Can't convert %q to big.Float", v)
+		}
+	default:
+		return reflect.ValueOf(nil), fmt.Errorf("Can't convert %v(%T) to big.Float", tval, tval)
+	}
+	return reflect.ValueOf(x), nil
+}
+
 func (d *Decoder) unwrapPointer(mtype reflect.Type, tval interface{}, mval1 *reflect.Value) (reflect.Value, error) {
 	var melem *reflect.Value
 
@@ -1157,15 +2922,98 @@ func (d *Decoder) unwrapPointer(mtype reflect.Type, tval interface{}, mval1 *ref
 		melem = &elem
 	}
 
+	mval := reflect.New(mtype.Elem())
+	if melem == nil && mtype.Elem().Kind() == reflect.Struct {
+		// decode in place, so that the fields keep their address
+		elem := mval.Elem()
+		melem = &elem
+	}
 	val, err := d.valueFromToml(mtype.Elem(), tval, melem)
 	if err != nil {
 		return reflect.ValueOf(nil), err
 	}
-	mval := reflect.New(mtype.Elem())
 	mval.Elem().Set(val)
 	return mval, nil
 }
 
+// Decode a byte slice from its string encoding. Strings are in base64 unless
+// format is hex.
+func bytesFromToml(mtype reflect.Type, s string, format string) (reflect.Value, error) {
+	var b []byte
+	var err error
+	if format == bytesHex {
+		b, err = hex.DecodeString(s)
+	} else {
+		format = bytesBase64
+		b, err = base64.StdEncoding.DecodeString(s)
+	}
+	if err != nil {
+		return reflect.ValueOf(nil), fmt.Errorf("cannot decode %s string into %v: %s", format, mtype, err)
+	}
+	return reflect.ValueOf(b).Convert(mtype), nil
+}
+
+// Whether mtype is time.Time or *time.Time.
+func isTimeField(mtype reflect.Type) bool {
+	return mtype == timeType || mtype.Kind() == reflect.Ptr && mtype.Elem() == timeType
+}
+
+// Parse s with the first of layouts it matches, into a value of type mtype,
+// time.Time or *time.Time. Times without offset are in the location of the
+// decoder.
+func (d *Decoder) timeFromLayouts(mtype reflect.Type, s string, layouts []string) (reflect.Value, error) {
+	for _, layout := range layouts {
+		t, err := time.ParseInLocation(layout, s, d.localLocation())
+		if err != nil {
+			continue
+		}
+		if d.timeLocation != nil {
+			t = t.In(d.timeLocation)
+		}
+		if mtype.Kind() == reflect.Ptr {
+			return reflect.ValueOf(&t), nil
+		}
+		return reflect.ValueOf(t), nil
+	}
+	if len(layouts) == 1 {
+		return reflect.ValueOf(nil), fmt.Errorf("cannot parse %q as a time with layout %q", s, layouts[0])
+	}
+	return reflect.ValueOf(nil), fmt.Errorf("cannot parse %q as a time with layouts %q", s, layouts)
+}
+
+// Whether mtype is a number or a boolean, or a pointer to one, which fields
+// with the ",string" option decode from strings.
+func isStringScalar(mtype reflect.Type) bool {
+	switch derefType(mtype).Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return derefType(mtype) != reflect.TypeOf(time.Duration(0))
+	}
+	return false
+}
+
+// Parse the string of a field with the ",string" option into the TOML value
+// decoded into mtype.
+func scalarFromString(mtype reflect.Type, s string) (interface{}, error) {
+	var val interface{}
+	var err error
+	switch derefType(mtype).Kind() {
+	case reflect.Bool:
+		val, err = strconv.ParseBool(s)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		val, err = strconv.ParseUint(s, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		val, err = strconv.ParseFloat(s, 64)
+	default:
+		val, err = strconv.ParseInt(s, 10, 64)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode %q into %v", s, mtype)
+	}
+	return val, nil
+}
+
 func (d *Decoder) unmarshalText(tval interface{}, mval reflect.Value) error {
 	var buf bytes.Buffer
 	fmt.Fprint(&buf, tval)
@@ -1173,7 +3021,10 @@ func (d *Decoder) unmarshalText(tval interface{}, mval reflect.Value) error {
 }
 
 func tomlOptions(vf reflect.StructField, an annotation) tomlOpts {
-	tag := vf.Tag.Get(an.tag)
+	tag, ok := vf.Tag.Lookup(an.tag)
+	if !ok && an.fallbackTag != "" {
+		tag = vf.Tag.Get(an.fallbackTag)
+	}
 	parse := strings.Split(tag, ",")
 	var comment string
 	if c := vf.Tag.Get(an.comment); c != "" {
@@ -1183,6 +3034,7 @@ func tomlOptions(vf reflect.StructField, an annotation) tomlOpts {
 	multiline, _ := strconv.ParseBool(vf.Tag.Get(an.multiline))
 	literal, _ := strconv.ParseBool(vf.Tag.Get(an.literal))
 	defaultValue := vf.Tag.Get(tagDefault)
+	required, _ := strconv.ParseBool(vf.Tag.Get(tagRequired))
 	result := tomlOpts{
 		name:         vf.Name,
 		nameFromTag:  false,
@@ -1193,6 +3045,7 @@ func tomlOptions(vf reflect.StructField, an annotation) tomlOpts {
 		include:      true,
 		omitempty:    false,
 		defaultValue: defaultValue,
+		required:     required,
 	}
 	if parse[0] != "" {
 		if parse[0] == "-" && len(parse) == 1 {
@@ -1205,15 +3058,100 @@ func tomlOptions(vf reflect.StructField, an annotation) tomlOpts {
 	if vf.PkgPath != "" {
 		result.include = false
 	}
-	if len(parse) > 1 && strings.Trim(parse[1], " ") == "omitempty" {
-		result.omitempty = true
+options:
+	for i, option := range parse[1:] {
+		if strings.HasPrefix(strings.TrimLeft(option, " "), tagLayout) {
+			// layouts may contain commas
+			result.layout = strings.TrimPrefix(strings.TrimLeft(strings.Join(parse[i+1:], ","), " "), tagLayout)
+			break options
+		}
+		switch strings.Trim(option, " ") {
+		case "omitempty":
+			result.omitempty = true
+		case "omitzero":
+			result.omitzero = true
+		case "required":
+			result.required = true
+		case bytesBase64, bytesHex, bytesArray:
+			result.bytes = strings.Trim(option, " ")
+			if result.bytes == bytesHex {
+				result.base = 16
+			}
+		case "literal":
+			result.literal = true
+		case "string":
+			result.asString = true
+		case "secret":
+			result.secret = true
+		case "octal":
+			result.base = 8
+		case "binary":
+			result.base = 2
+		}
 	}
-	if vf.Type.Kind() == reflect.Ptr {
+	if vf.Type.Kind() == reflect.Ptr || vf.Type == deferredType {
 		result.omitempty = true
 	}
 	return result
 }
 
+// Parse the value of the default tag of a field of type mtype.
+func parseDefaultValue(mtype reflect.Type, defaultValue string) (reflect.Value, error) {
+	var val interface{}
+	var err error
+	switch mtype.Kind() {
+	case reflect.String:
+		val = defaultValue
+	case reflect.Bool:
+		val, err = strconv.ParseBool(defaultValue)
+	case reflect.Uint:
+		val, err = strconv.ParseUint(defaultValue, 10, 0)
+	case reflect.Uint8:
+		val, err = strconv.ParseUint(defaultValue, 10, 8)
+	case reflect.Uint16:
+		val, err = strconv.ParseUint(defaultValue, 10, 16)
+	case reflect.Uint32:
+		val, err = strconv.ParseUint(defaultValue, 10, 32)
+	case reflect.Uint64:
+		val, err = strconv.ParseUint(defaultValue, 10, 64)
+	case reflect.Int:
+		val, err = strconv.ParseInt(defaultValue, 10, 0)
+	case reflect.Int8:
+		val, err = strconv.ParseInt(defaultValue, 10, 8)
+	case reflect.Int16:
+		val, err = strconv.ParseInt(defaultValue, 10, 16)
+	case reflect.Int32:
+		val, err = strconv.ParseInt(defaultValue, 10, 32)
+	case reflect.Int64:
+		// Check if the provided number has a non-numeric extension.
+		var hasExtension bool
+		if len(defaultValue) > 0 {
+			lastChar := defaultValue[len(defaultValue)-1]
+			if lastChar < '0' || lastChar > '9' {
+				hasExtension = true
+			}
+		}
+		// If the value is a time.Duration with extension, parse as duration.
+		// If the value is an int64 or a time.Duration without extension, parse as number.
+		if hasExtension && mtype.String() == "time.Duration" {
+			val, err = time.ParseDuration(defaultValue)
+		} else {
+			val, err = strconv.ParseInt(defaultValue, 10, 64)
+		}
+	case reflect.Float32:
+		val, err = strconv.ParseFloat(defaultValue, 32)
+	case reflect.Float64:
+		val, err = strconv.ParseFloat(defaultValue, 64)
+	default:
+		return reflect.Value{}, fmt.Errorf("unsupported field type for default option")
+	}
+
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return reflect.ValueOf(val).Convert(mtype), nil
+}
+
 func isZero(val reflect.Value) bool {
 	switch val.Type().Kind() {
 	case reflect.Slice, reflect.Array, reflect.Map:
@@ -1223,6 +3161,30 @@ func isZero(val reflect.Value) bool {
 	}
 }
 
+// Implemented by types reporting whether they are zero, like time.Time.
+type zeroer interface {
+	IsZero() bool
+}
+
+// Whether the value of a field with the "omitzero" option is skipped: it is
+// zero according to its IsZero method, or else when it is the zero value of
+// its type. Unlike with omitempty, empty slices and maps that are not nil are
+// not zero.
+func isOmittedZero(val reflect.Value) bool {
+	if val.Kind() == reflect.Ptr && val.IsNil() {
+		return true
+	}
+	if z, ok := val.Interface().(zeroer); ok {
+		return z.IsZero()
+	}
+	if val.CanAddr() {
+		if z, ok := val.Addr().Interface().(zeroer); ok {
+			return z.IsZero()
+		}
+	}
+	return reflect.DeepEqual(val.Interface(), reflect.Zero(val.Type()).Interface())
+}
+
 func formatError(err error, pos Position) error {
 	if err.Error()[0] == '(' { // Error already contains position information
 		return err
@@ -0,0 +1,190 @@
+package toml
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// MarshalFragment returns the TOML encoding of v as a fragment rooted at the
+// table designated by keys. For example, marshaling a struct with the keys
+// {"server", "tls"} produces a document starting with a [server.tls] header,
+// with any nested tables emitted below it with fully qualified headers.
+//
+// See the documentation for Marshal for details about how v is encoded.
+func MarshalFragment(keys []string, v interface{}) ([]byte, error) {
+	return NewEncoder(nil).marshalFragment(keys, v)
+}
+
+// EncodeFragment writes the TOML encoding of v to the stream, rooted at the
+// table designated by keys.
+//
+// See the documentation for MarshalFragment for details.
+func (e *Encoder) EncodeFragment(keys []string, v interface{}) error {
+	b, err := e.marshalFragment(keys, v)
+	if err != nil {
+		return err
+	}
+	if _, err := e.w.Write(b); err != nil {
+		return err
+	}
+	return nil
+}
+
+// AppendFragment appends the TOML encoding of v, rooted at the table
+// designated by keys, to the TOML document doc and returns the result.
+//
+// An error is returned if doc is not a valid document, if it already defines
+// the table designated by keys, or if one of the intermediate keys refers to a
+// value that is not a table. The original document is left untouched: the
+// fragment is only ever added after its last byte.
+func AppendFragment(doc []byte, keys []string, v interface{}) ([]byte, error) {
+	fragment, err := appendableFragment(doc, keys, v)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]byte, 0, len(doc)+len(fragment))
+	result = append(result, doc...)
+	return append(result, fragment...), nil
+}
+
+// AppendFragmentFile appends the TOML encoding of v, rooted at the table
+// designated by keys, to the file at path. The file is created if it does not
+// exist.
+//
+// See the documentation for AppendFragment for the checks performed before
+// the file is modified.
+func AppendFragmentFile(path string, keys []string, v interface{}) error {
+	doc, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	fragment, err := appendableFragment(doc, keys, v)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(fragment); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Generate the bytes to add at the end of doc so that it contains the fragment
+// for v, making sure the resulting document is still valid.
+func appendableFragment(doc []byte, keys []string, v interface{}) ([]byte, error) {
+	tree, err := LoadBytes(doc)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkFragmentPath(tree, keys); err != nil {
+		return nil, err
+	}
+	fragment, err := MarshalFragment(keys, v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if len(bytes.TrimSpace(doc)) > 0 {
+		if !bytes.HasSuffix(doc, []byte("\n")) {
+			buf.WriteString("\n")
+		}
+		buf.WriteString("\n")
+	}
+	buf.Write(fragment)
+
+	combined := make([]byte, 0, len(doc)+buf.Len())
+	combined = append(combined, doc...)
+	combined = append(combined, buf.Bytes()...)
+	if _, err := LoadBytes(combined); err != nil {
+		return nil, fmt.Errorf("appending fragment would produce an invalid document: %s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Check that a table can be created at keys in the given tree.
+func checkFragmentPath(tree *Tree, keys []string) error {
+	if len(keys) == 0 {
+		return errors.New("fragment key path cannot be empty")
+	}
+	for i := range keys {
+		node := tree.GetPath(keys[:i+1])
+		if node == nil {
+			return nil
+		}
+		if i == len(keys)-1 {
+			return fmt.Errorf("key %s is already defined", strings.Join(keys, "."))
+		}
+		switch n := node.(type) {
+		case *Tree:
+			if n.inline {
+				return fmt.Errorf("key %s is an inline table and cannot be extended", strings.Join(keys[:i+1], "."))
+			}
+		case []*Tree:
+		default:
+			return fmt.Errorf("key %s is not a table", strings.Join(keys[:i+1], "."))
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) marshalFragment(keys []string, v interface{}) ([]byte, error) {
+	if len(keys) == 0 {
+		return []byte{}, errors.New("fragment key path cannot be empty")
+	}
+	t, err := e.fragmentTree(keys, v)
+	if err != nil {
+		return []byte{}, err
+	}
+	var buf bytes.Buffer
+	err = e.writeFragment(&buf, "[", keys, "]", t)
+	return buf.Bytes(), err
+}
+
+// Convert v to the tree of a fragment rooted at keys.
+func (e *Encoder) fragmentTree(keys []string, v interface{}) (*Tree, error) {
+	mtype, err := e.checkMarshalable(v)
+	if err != nil {
+		return nil, err
+	}
+	e.path = append(e.path[:0], keys...)
+	e.depth = 0
+	e.collisions = nil
+
+	sval := reflect.ValueOf(v)
+	switch {
+	case isCustomMarshaler(mtype), isTextMarshaler(mtype):
+		var b []byte
+		if isCustomMarshaler(mtype) {
+			b, err = callCustomMarshaler(sval)
+		} else {
+			b, err = callTextMarshaler(sval)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return LoadBytes(b)
+	}
+	return e.valueToTree(mtype, sval)
+}
+
+// Write the tree t of a fragment rooted at keys, below a header made of keys
+// between open and close.
+func (e *Encoder) writeFragment(w io.Writer, open string, keys []string, close string, t *Tree) error {
+	keyspace := Key(keys).String()
+	if _, err := writeStrings(w, open, keyspace, close, "\n"); err != nil {
+		return err
+	}
+	_, err := t.writeToOrdered(w, e.indentation, keyspace, 0, e.arraysOneElementPerLine, e.order, e.indentation, e.layout, e.compactComments, e.tabularArrays, false)
+	return err
+}
@@ -0,0 +1,119 @@
+package toml
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type fragmentTestStruct struct {
+	Cert string `toml:"cert"`
+	Key  string `toml:"key"`
+	Peer struct {
+		Verify bool `toml:"verify"`
+	} `toml:"peer"`
+}
+
+func TestMarshalFragment(t *testing.T) {
+	v := fragmentTestStruct{Cert: "a.pem", Key: "a.key"}
+	v.Peer.Verify = true
+
+	result, err := MarshalFragment([]string{"server", "tls"}, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[server.tls]
+  cert = "a.pem"
+  key = "a.key"
+
+  [server.tls.peer]
+    verify = true
+`
+	if string(result) != expected {
+		t.Errorf("Bad fragment: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, result)
+	}
+
+	tree, err := LoadBytes(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Get("server.tls.peer.verify") != true {
+		t.Errorf("fragment does not round trip: %v", tree.ToMap())
+	}
+}
+
+func TestMarshalFragmentQuotedKeys(t *testing.T) {
+	result, err := MarshalFragment([]string{"plugins", "my plugin"}, map[string]interface{}{"enabled": false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "[plugins.\"my plugin\"]\n  enabled = false\n"
+	if string(result) != expected {
+		t.Errorf("Bad fragment: expected %q, got %q", expected, result)
+	}
+}
+
+func TestMarshalFragmentEmptyPath(t *testing.T) {
+	_, err := MarshalFragment(nil, map[string]interface{}{})
+	assertErrorString(t, "fragment key path cannot be empty", err)
+}
+
+func TestAppendFragment(t *testing.T) {
+	doc := []byte("# shared config\ntitle = \"x\"\n\n[server]\n  port = 80")
+	result, err := AppendFragment(doc, []string{"server", "tls"}, map[string]interface{}{"cert": "a.pem"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "# shared config\ntitle = \"x\"\n\n[server]\n  port = 80\n\n[server.tls]\n  cert = \"a.pem\"\n"
+	if string(result) != expected {
+		t.Errorf("Bad append: expected %q, got %q", expected, result)
+	}
+}
+
+func TestAppendFragmentErrors(t *testing.T) {
+	doc := []byte("title = \"x\"\ninline = { a = 1 }\n[server]\nport = 80\n")
+	v := map[string]interface{}{"a": 1}
+
+	_, err := AppendFragment(doc, []string{"server"}, v)
+	assertErrorString(t, "key server is already defined", err)
+
+	_, err = AppendFragment(doc, []string{"title", "sub"}, v)
+	assertErrorString(t, "key title is not a table", err)
+
+	_, err = AppendFragment(doc, []string{"inline", "sub"}, v)
+	assertErrorString(t, "key inline is an inline table and cannot be extended", err)
+
+	_, err = AppendFragment([]byte("a = "), []string{"b"}, v)
+	if err == nil {
+		t.Error("expected an error for an invalid document")
+	}
+}
+
+func TestAppendFragmentFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "toml-fragment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.toml")
+
+	if err := AppendFragmentFile(path, []string{"a"}, map[string]interface{}{"x": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AppendFragmentFile(path, []string{"b"}, map[string]interface{}{"y": 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := AppendFragmentFile(path, []string{"a"}, map[string]interface{}{"z": 3}); err == nil {
+		t.Error("expected an error when appending an existing table")
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "[a]\n  x = 1\n\n[b]\n  y = 2\n"
+	if string(content) != expected {
+		t.Errorf("Bad file content: expected %q, got %q", expected, content)
+	}
+}
@@ -2,14 +2,21 @@ package toml
 
 import (
 	"bytes"
+	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
+	"math/big"
+	"net"
 	"os"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -836,6 +843,67 @@ func TestEmptyUnmarshalOmit(t *testing.T) {
 	}
 }
 
+func TestMarshalOmitEmptyKinds(t *testing.T) {
+	type inner struct {
+		A int
+	}
+	type omitStruct struct {
+		Title   string                 `toml:"title"`
+		Uint    uint                   `toml:"uint,omitempty"`
+		Float   float64                `toml:"float,omitempty"`
+		Iface   interface{}            `toml:"iface,omitempty"`
+		NilList []int                  `toml:"nillist,omitempty"`
+		NilMap  map[string]interface{} `toml:"nilmap,omitempty"`
+		Struct  inner                  `toml:"struct,omitempty"`
+		Kept    float64                `toml:"kept,omitempty"`
+	}
+
+	result, err := Marshal(omitStruct{Title: "t", Kept: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte("kept = 0.5\ntitle = \"t\"\n")
+	if !bytes.Equal(result, expected) {
+		t.Errorf("Bad omitempty marshal: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, result)
+	}
+}
+
+func TestMarshalOmitEmptyStructs(t *testing.T) {
+	type inner struct {
+		A int      `toml:"a"`
+		B []string `toml:"b"`
+	}
+	type omitStruct struct {
+		Zero    inner  `toml:"zero,omitempty"`
+		Set     inner  `toml:"set,omitempty"`
+		Empty   inner  `toml:"empty,omitempty"`
+		Pointer *inner `toml:"pointer,omitempty"`
+	}
+
+	// structs whose fields are all zero are empty, but not those holding
+	// an empty slice that is not nil, nor pointers to zero structs
+	result, err := Marshal(omitStruct{Set: inner{A: 1}, Empty: inner{B: []string{}}, Pointer: &inner{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+[empty]
+  a = 0
+  b = []
+
+[pointer]
+  a = 0
+  b = []
+
+[set]
+  a = 1
+  b = []
+`
+	if string(result) != expected {
+		t.Errorf("Bad omitempty marshal: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, result)
+	}
+}
+
 type pointerMarshalTestStruct struct {
 	Str       *string
 	List      *[]string
@@ -2635,10 +2703,125 @@ func TestUnmarshalNestedAnonymousStructs_Controversial(t *testing.T) {
 
 	var doc Document
 
+	// as with encoding/json, embedded structs are not keys themselves: nested
+	// is the key of the promoted field rather than of the Nested struct
 	err := Unmarshal([]byte(`nested = "nested value"`+"\n"+`own = "own value"`), &doc)
-	if err == nil {
-		t.Fatal("should error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Value != "own value" || doc.Nested.Value != "nested value" {
+		t.Fatal("unexpected values")
+	}
+}
+
+type PromotionBase struct {
+	ID   string `toml:"id" json:"id"`
+	Name string `toml:"name" json:"name"`
+}
+
+type promotionMeta struct {
+	Name  string `json:"label" toml:"label"`
+	Owner string
+}
+
+type promotionOther struct {
+	Owner string
+}
+
+func TestEmbeddedStructPromotion(t *testing.T) {
+	type config struct {
+		*PromotionBase
+		promotionMeta
+		promotionOther
+		Name  string `toml:"name" json:"name"`
+		Level struct {
+			PromotionBase
+		} `toml:"level" json:"level"`
+	}
+	c := config{
+		PromotionBase:  &PromotionBase{ID: "a", Name: "hidden"},
+		promotionMeta:  promotionMeta{Name: "meta", Owner: "conflicting"},
+		promotionOther: promotionOther{Owner: "conflicting"},
+		Name:           "outer",
+	}
+	c.Level.ID = "b"
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Order(OrderPreserve).Encode(c); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	expected := `id = "a"
+label = "meta"
+name = "outer"
+
+[level]
+  id = "b"
+  name = ""
+`
+	if string(b) != expected {
+		t.Errorf("Bad marshal: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, string(b))
+	}
+
+	// the same keys as encoding/json
+	j, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fromJSON, fromTOML map[string]interface{}
+	if err := json.Unmarshal(j, &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	if err := Unmarshal(b, &fromTOML); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromJSON, fromTOML) {
+		t.Errorf("expected the keys of encoding/json %v, got %v", fromJSON, fromTOML)
+	}
+
+	// embedded pointers are allocated when decoding
+	var out config
+	if err := Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.PromotionBase == nil || out.ID != "a" || out.PromotionBase.Name != "" || out.Name != "outer" ||
+		out.promotionMeta.Name != "meta" || out.Level.ID != "b" {
+		t.Errorf("unexpected result %+v", out)
+	}
+	out = config{}
+	if err := Unmarshal([]byte(`name = "outer"`), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.PromotionBase != nil {
+		t.Errorf("embedded pointer should not be allocated, got %+v", out.PromotionBase)
 	}
+
+	// and skipped when nil when encoding
+	out.promotionMeta.Name = "meta"
+	b, err = Marshal(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "label = \"meta\"\nname = \"outer\"\n\n[level]\n  id = \"\"\n  name = \"\"\n"
+	if string(b) != expected {
+		t.Errorf("Bad marshal: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, string(b))
+	}
+
+	// pointers to unexported types are encoded, but cannot be allocated
+	var unexported struct {
+		*promotionMeta
+	}
+	unexported.promotionMeta = &promotionMeta{Owner: "me"}
+	b, err = Marshal(unexported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Owner = \"me\"\nlabel = \"\"\n"; string(b) != expected {
+		t.Errorf("expected %q, got %q", expected, string(b))
+	}
+	unexported.promotionMeta = nil
+	err = Unmarshal(b, &unexported)
+	assertErrorString(t, "(2, 1): cannot set embedded pointer to unexported struct type toml.promotionMeta", err)
 }
 
 type unexportedFieldPreservationTest struct {
@@ -3573,8 +3756,8 @@ func TestUnmarshalSliceFail(t *testing.T) {
 
 	var actual sliceStruct
 	err := tree.Unmarshal(&actual)
-	if err.Error() != "(0, 0): Can't convert 1(int64) to string" {
-		t.Error("expect err:(0, 0): Can't convert 1(int64) to string but got ", err)
+	if err.Error() != "(0, 0): array element 0: Can't convert 1(int64) to string" {
+		t.Error("expect err:(0, 0): array element 0: Can't convert 1(int64) to string but got ", err)
 	}
 }
 
@@ -3583,8 +3766,8 @@ func TestUnmarshalSliceFail2(t *testing.T) {
 
 	var actual sliceStruct
 	err := tree.Unmarshal(&actual)
-	if err.Error() != "(1, 1): Can't convert 1(int64) to string" {
-		t.Error("expect err:(1, 1): Can't convert 1(int64) to string but got ", err)
+	if err.Error() != "(1, 12): array element 0: Can't convert 1(int64) to string" {
+		t.Error("expect err:(1, 12): array element 0: Can't convert 1(int64) to string but got ", err)
 	}
 
 }
@@ -4129,3 +4312,2044 @@ func TestGithubIssue732(t *testing.T) {
 		t.Fatalf("error was expected")
 	}
 }
+
+func TestDecoderTimeLocation(t *testing.T) {
+	doc := []byte(`
+offset = 1979-05-27T00:32:00-07:00
+local = 1979-05-27T07:32:00
+date = 1979-05-27
+list = [1979-05-27T00:32:00-07:00]
+`)
+	type config struct {
+		Offset time.Time
+		Local  time.Time
+		Date   time.Time
+		List   []time.Time
+	}
+
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("time zone database not available:", err)
+	}
+	instant := time.Date(1979, time.May, 27, 7, 32, 0, 0, time.UTC)
+
+	var preserved config
+	if err := NewDecoder(bytes.NewReader(doc)).Decode(&preserved); err != nil {
+		t.Fatal(err)
+	}
+	if _, offset := preserved.Offset.Zone(); offset != -7*60*60 || !preserved.Offset.Equal(instant) {
+		t.Errorf("offset should be preserved, got %v", preserved.Offset)
+	}
+
+	var utc config
+	if err := NewDecoder(bytes.NewReader(doc)).TimeLocation(time.UTC).Decode(&utc); err != nil {
+		t.Fatal(err)
+	}
+	if utc.Offset.Location() != time.UTC || !utc.Offset.Equal(instant) {
+		t.Errorf("offset should be converted to UTC, got %v", utc.Offset)
+	}
+	if utc.List[0].Location() != time.UTC {
+		t.Errorf("array element should be converted to UTC, got %v", utc.List[0])
+	}
+	if !utc.Local.Equal(instant) {
+		t.Errorf("local date-time should be interpreted in UTC, got %v", utc.Local)
+	}
+
+	var local config
+	if err := NewDecoder(bytes.NewReader(doc)).TimeLocation(paris).Decode(&local); err != nil {
+		t.Fatal(err)
+	}
+	if local.Offset.Location() != paris || !local.Offset.Equal(instant) {
+		t.Errorf("offset should be converted to Europe/Paris, got %v", local.Offset)
+	}
+	expectedDate := time.Date(1979, time.May, 27, 0, 0, 0, 0, paris)
+	if !local.Date.Equal(expectedDate) {
+		t.Errorf("local date should be interpreted in Europe/Paris, expected %v got %v", expectedDate, local.Date)
+	}
+
+	var generic map[string]interface{}
+	if err := NewDecoder(bytes.NewReader(doc)).TimeLocation(time.UTC).Decode(&generic); err != nil {
+		t.Fatal(err)
+	}
+	if generic["offset"].(time.Time).Location() != time.UTC {
+		t.Errorf("offset should be converted to UTC in maps, got %v", generic["offset"])
+	}
+}
+
+func TestDecoderRejectLocalDateTimes(t *testing.T) {
+	var v map[string]interface{}
+	err := NewDecoder(bytes.NewReader([]byte("a = 1979-05-27T00:32:00Z\nb = 1979-05-27T07:32:00\n"))).RejectLocalDateTimes(true).Decode(&v)
+	assertErrorString(t, "(2, 1): local date-time 1979-05-27T07:32:00 is not allowed, an offset is required", err)
+
+	err = NewDecoder(bytes.NewReader([]byte("a = 1979-05-27T00:32:00Z\nb = 1979-05-27\n"))).RejectLocalDateTimes(true).Decode(&v)
+	if err != nil {
+		t.Errorf("offset date-times and local dates should be accepted: %s", err)
+	}
+}
+
+func TestEncoderTimeLocation(t *testing.T) {
+	type config struct {
+		When time.Time `toml:"when"`
+	}
+	v := config{When: time.Date(1979, time.May, 27, 0, 32, 0, 0, time.FixedZone("", -7*60*60))}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "when = 1979-05-27T00:32:00-07:00\n"; buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := NewEncoder(&buf).TimeLocation(time.UTC).Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "when = 1979-05-27T07:32:00Z\n"; buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestEncoderTimeFormat(t *testing.T) {
+	type config struct {
+		When  time.Time   `toml:"when"`
+		Day   time.Time   `toml:"day"`
+		Times []time.Time `toml:"times"`
+	}
+	zone := time.FixedZone("", -7*60*60)
+	v := config{
+		When:  time.Date(1979, time.May, 27, 20, 32, 0, 0, zone),
+		Day:   time.Date(1979, time.May, 27, 0, 0, 0, 0, zone),
+		Times: []time.Time{time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	examples := []struct {
+		format   TimeFormat
+		expected string
+	}{
+		{TimeFormatOffset, "day = 1979-05-27T00:00:00-07:00\ntimes = [2000-01-01T00:00:00Z]\nwhen = 1979-05-27T20:32:00-07:00\n"},
+		{TimeFormatUTC, "day = 1979-05-27T07:00:00Z\ntimes = [2000-01-01T00:00:00Z]\nwhen = 1979-05-28T03:32:00Z\n"},
+		{TimeFormatLocal, "day = 1979-05-27T00:00:00\ntimes = [2000-01-01T00:00:00]\nwhen = 1979-05-27T20:32:00\n"},
+		{TimeFormatDateOnly, "day = 1979-05-27\ntimes = [2000-01-01]\nwhen = 1979-05-27T20:32:00-07:00\n"},
+	}
+	for _, example := range examples {
+		var buf bytes.Buffer
+		if err := NewEncoder(&buf).TimeFormat(example.format).Encode(v); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != example.expected {
+			t.Errorf("format %d: expected %q, got %q", example.format, example.expected, buf.String())
+		}
+	}
+
+	// the day is checked in the location of the encoder
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).TimeLocation(zone).TimeFormat(TimeFormatDateOnly).Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "day = 1979-05-27\ntimes = [1999-12-31T17:00:00-07:00]\nwhen = 1979-05-27T20:32:00-07:00\n"; buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestTimeLayout(t *testing.T) {
+	type config struct {
+		Day     time.Time  `toml:"day,layout:02/01/2006"`
+		Stamp   *time.Time `toml:"stamp,layout:Jan 2, 2006 15:04 MST"`
+		Created time.Time  `toml:"created"`
+	}
+	stamp := time.Date(2021, time.March, 4, 15, 30, 0, 0, time.UTC)
+	c := config{
+		Day:     time.Date(2021, time.March, 4, 0, 0, 0, 0, time.UTC),
+		Stamp:   &stamp,
+		Created: time.Date(2021, time.March, 4, 15, 30, 0, 0, time.UTC),
+	}
+	b, err := Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `created = 2021-03-04T15:30:00Z
+day = "04/03/2021"
+stamp = "Mar 4, 2021 15:30 UTC"
+`
+	if string(b) != expected {
+		t.Errorf("Bad marshal: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, string(b))
+	}
+
+	var out config
+	if err := NewDecoder(bytes.NewReader(b)).TimeLocation(time.UTC).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Day.Equal(c.Day) || out.Stamp == nil || !out.Stamp.Equal(stamp) || !out.Created.Equal(c.Created) {
+		t.Errorf("bad round trip: expected %+v, got %+v", c, out)
+	}
+
+	err = Unmarshal([]byte(`day = "2021-03-04"`), &out)
+	assertErrorString(t, `(1, 1): cannot parse "2021-03-04" as a time with layout "02/01/2006"`, err)
+
+	// layouts of the decoder apply to all time.Time values
+	var m struct {
+		A time.Time
+		B []time.Time
+	}
+	doc := "A = \"04/03/2021\"\nB = [\"2021-03-05\", 2021-03-06T00:00:00Z]\n"
+	if err := NewDecoder(strings.NewReader(doc)).TimeLocation(time.UTC).TimeLayouts("02/01/2006", "2006-01-02").Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if !m.A.Equal(c.Day) || len(m.B) != 2 || m.B[0].Day() != 5 || m.B[1].Day() != 6 {
+		t.Errorf("unexpected result %+v", m)
+	}
+	err = NewDecoder(strings.NewReader(`A = "March 4"`)).TimeLayouts("02/01/2006", "2006-01-02").Decode(&m)
+	assertErrorString(t, `(1, 1): cannot parse "March 4" as a time with layouts ["02/01/2006" "2006-01-02"]`, err)
+}
+
+func TestEncoderFloatFormat(t *testing.T) {
+	type config struct {
+		Pi     float64            `toml:"pi"`
+		Big    float64            `toml:"big"`
+		Small  float32            `toml:"small"`
+		Whole  float64            `toml:"whole"`
+		Values []float64          `toml:"values"`
+		Map    map[string]float64 `toml:"map"`
+	}
+	v := config{Pi: 3.14159, Big: 2e6, Small: 0.0001, Whole: 3, Values: []float64{1, 0.5}, Map: map[string]float64{"k": 1.25}}
+	examples := []struct {
+		encoder  func(*Encoder) *Encoder
+		expected string
+	}{
+		{
+			func(e *Encoder) *Encoder { return e },
+			"big = 2000000.0\npi = 3.14159\nsmall = 0.0001\nvalues = [1.0, 0.5]\nwhole = 3.0\n\n[map]\n  k = 1.25\n",
+		},
+		{
+			func(e *Encoder) *Encoder { return e.FloatPrecision(2) },
+			"big = 2000000.00\npi = 3.14\nsmall = 0.00\nvalues = [1.00, 0.50]\nwhole = 3.00\n\n[map]\n  k = 1.25\n",
+		},
+		{
+			func(e *Encoder) *Encoder { return e.FloatExponent(3) },
+			"big = 2e+06\npi = 3.14159\nsmall = 1e-04\nvalues = [1.0, 0.5]\nwhole = 3.0\n\n[map]\n  k = 1.25\n",
+		},
+		{
+			func(e *Encoder) *Encoder { return e.FloatExponent(3).FloatDecimalPoint(true) },
+			"big = 2.0e+06\npi = 3.14159\nsmall = 1.0e-04\nvalues = [1.0, 0.5]\nwhole = 3.0\n\n[map]\n  k = 1.25\n",
+		},
+	}
+	for i, e := range examples {
+		var buf bytes.Buffer
+		if err := e.encoder(NewEncoder(&buf)).Encode(v); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != e.expected {
+			t.Errorf("%d: expected:\n%s\ngot:\n%s", i, e.expected, buf.String())
+		}
+		var decoded config
+		if err := Unmarshal(buf.Bytes(), &decoded); err != nil {
+			t.Errorf("%d: %s", i, err)
+		}
+	}
+}
+
+func TestEncoderRejectNaNInf(t *testing.T) {
+	type config struct {
+		Limits struct {
+			Max float64 `toml:"max"`
+		} `toml:"limits"`
+	}
+	var v config
+	v.Limits.Max = math.Inf(1)
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "\n[limits]\n  max = +inf\n"; string(b) != expected {
+		t.Errorf("expected %q, got %q", expected, b)
+	}
+
+	var buf bytes.Buffer
+	err = NewEncoder(&buf).RejectNaNInf(true).Encode(v)
+	assertErrorString(t, "cannot encode +Inf at limits.max: NaN and infinite floats are rejected", err)
+	err = NewEncoder(&buf).RejectNaNInf(true).Encode(map[string]interface{}{"values": []float64{1, math.NaN()}})
+	assertErrorString(t, "cannot encode NaN at values: NaN and infinite floats are rejected", err)
+}
+
+type canonicalMarshaler struct{}
+
+func (canonicalMarshaler) MarshalTOML() ([]byte, error) {
+	return []byte("# header\nname = 'app'\nmode = 0o755\n[server]\nport = 8_080\n"), nil
+}
+
+func TestEncoderCanonical(t *testing.T) {
+	type config struct {
+		Server struct {
+			Port int64 `toml:"port" comment:"the port"`
+		} `toml:"server"`
+		Name string `toml:"name" literal:"true"`
+		Mode int64  `toml:"mode,octal"`
+		Old  string `toml:"old" commented:"true"`
+	}
+	c := config{Name: "app", Mode: 0755}
+	c.Server.Port = 8080
+	expected := "mode = 493\nname = \"app\"\n\n[server]\nport = 8080\n"
+
+	var buf bytes.Buffer
+	err := NewEncoder(&buf).Canonical(true).Order(OrderPreserve).Indentation("\t").
+		ArraysWithOneElementPerLine(true).WrapStrings(2).FloatPrecision(2).Encode(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := NewEncoder(&buf).Canonical(true).Encode(canonicalMarshaler{}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	m := map[string]interface{}{"server": map[string]interface{}{"port": 8080}, "name": "app", "mode": 0755}
+	if err := NewEncoder(&buf).Canonical(true).Encode(m); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+type hookPoint struct {
+	X, Y int64
+}
+
+func TestDecoderDecodeHook(t *testing.T) {
+	type config struct {
+		Pattern *regexp.Regexp `toml:"pattern"`
+		Origin  hookPoint      `toml:"origin"`
+		Name    string         `toml:"name"`
+		Points  []hookPoint    `toml:"points"`
+	}
+	doc := []byte(`
+pattern = "^a+$"
+name = "  spaced  "
+points = ["1,2", "3,4"]
+
+[origin]
+coords = "5,6"
+`)
+
+	parsePoint := func(s string) (hookPoint, error) {
+		var p hookPoint
+		_, err := fmt.Sscanf(s, "%d,%d", &p.X, &p.Y)
+		return p, err
+	}
+	regexpHook := func(from, to reflect.Type, data interface{}) (interface{}, error) {
+		if s, ok := data.(string); ok && to == reflect.TypeOf(regexp.Regexp{}) {
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return nil, err
+			}
+			return *re, nil
+		}
+		return data, nil
+	}
+	pointHook := func(from, to reflect.Type, data interface{}) (interface{}, error) {
+		if to != reflect.TypeOf(hookPoint{}) {
+			return data, nil
+		}
+		switch v := data.(type) {
+		case string:
+			return parsePoint(v)
+		case *Tree:
+			return parsePoint(v.Get("coords").(string))
+		}
+		return data, nil
+	}
+	trimHook := func(from, to reflect.Type, data interface{}) (interface{}, error) {
+		if s, ok := data.(string); ok {
+			return strings.TrimSpace(s), nil
+		}
+		return data, nil
+	}
+
+	var c config
+	err := NewDecoder(bytes.NewReader(doc)).DecodeHook(regexpHook, pointHook).DecodeHook(trimHook).Strict(true).Decode(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Pattern == nil || c.Pattern.String() != "^a+$" {
+		t.Errorf("pattern should be compiled by the hook, got %v", c.Pattern)
+	}
+	if c.Origin != (hookPoint{5, 6}) {
+		t.Errorf("table should be converted by the hook, got %v", c.Origin)
+	}
+	if c.Name != "spaced" {
+		t.Errorf("string should be trimmed by the chained hook, got %q", c.Name)
+	}
+	if !reflect.DeepEqual(c.Points, []hookPoint{{1, 2}, {3, 4}}) {
+		t.Errorf("array elements should be converted by the hook, got %v", c.Points)
+	}
+
+	err = NewDecoder(bytes.NewReader([]byte(`pattern = "("`))).DecodeHook(regexpHook).Decode(&c)
+	if err == nil {
+		t.Error("error returned by the hook should be reported")
+	}
+}
+
+func TestDecoderDecodeHookRewritesTable(t *testing.T) {
+	type config struct {
+		Server struct {
+			Port int64 `toml:"port"`
+		} `toml:"server"`
+	}
+	defaults := func(from, to reflect.Type, data interface{}) (interface{}, error) {
+		if tree, ok := data.(*Tree); ok && to.Kind() == reflect.Struct && !tree.Has("port") {
+			return map[string]interface{}{"port": int64(8080)}, nil
+		}
+		return data, nil
+	}
+	var c config
+	if err := NewDecoder(bytes.NewReader([]byte("[server]\n"))).DecodeHook(defaults).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Server.Port != 8080 {
+		t.Errorf("decoding should proceed with the table returned by the hook, got %d", c.Server.Port)
+	}
+
+	// tables edited in place keep the positions of their values
+	type hosts struct {
+		Server struct {
+			Port int64  `toml:"port"`
+			Host string `toml:"host"`
+		} `toml:"server"`
+	}
+	setHost := func(from, to reflect.Type, data interface{}) (interface{}, error) {
+		if tree, ok := data.(*Tree); ok && tree.Has("port") {
+			tree.Set("host", "localhost")
+		}
+		return data, nil
+	}
+	var h hosts
+	err := NewDecoder(bytes.NewReader([]byte("[server]\n\nport = \"x\"\n"))).DecodeHook(setHost).Decode(&h)
+	assertErrorString(t, "(3, 1): Can't convert x(string) to int64", err)
+	if err := NewDecoder(bytes.NewReader([]byte("[server]\nport = 1\n"))).DecodeHook(setHost).Decode(&h); err != nil {
+		t.Fatal(err)
+	}
+	if h.Server.Host != "localhost" || h.Server.Port != 1 {
+		t.Errorf("decoding should proceed with the edited table, got %+v", h.Server)
+	}
+}
+
+func TestDecoderDuplicateKeys(t *testing.T) {
+	doc := []byte(`
+name = "first"
+name = "second"
+inline = { a = 1, a = 2 }
+
+[server]
+port = 80
+
+[server]
+host = "localhost"
+port = 8080
+`)
+	type config struct {
+		Name   string `toml:"name"`
+		Inline struct {
+			A int64 `toml:"a"`
+		} `toml:"inline"`
+		Server struct {
+			Host string `toml:"host"`
+			Port int64  `toml:"port"`
+		} `toml:"server"`
+	}
+
+	var c config
+	err := NewDecoder(bytes.NewReader(doc)).Decode(&c)
+	dupErr, ok := err.(*DuplicateKeyError)
+	if !ok {
+		t.Fatalf("expected a *DuplicateKeyError, got %v", err)
+	}
+	if !dupErr.Key.Equal(Key{"name"}) || dupErr.Position.Line != 3 || dupErr.Previous.Line != 2 {
+		t.Errorf("unexpected duplicate key error %+v", dupErr)
+	}
+
+	c = config{}
+	if err := NewDecoder(bytes.NewReader(doc)).DuplicateKeys(DuplicateKeysFirstWins).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "first" || c.Inline.A != 1 || c.Server.Port != 80 || c.Server.Host != "localhost" {
+		t.Errorf("first definitions should be kept, got %+v", c)
+	}
+
+	c = config{}
+	if err := NewDecoder(bytes.NewReader(doc)).DuplicateKeys(DuplicateKeysLastWins).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "second" || c.Inline.A != 2 || c.Server.Port != 8080 || c.Server.Host != "localhost" {
+		t.Errorf("last definitions should be kept, got %+v", c)
+	}
+}
+
+func TestMarshalByteSlices(t *testing.T) {
+	type config struct {
+		Default []byte            `toml:"default"`
+		Hex     []byte            `toml:"hex,hex"`
+		Array   []byte            `toml:"array,array"`
+		Empty   []byte            `toml:"empty,omitempty"`
+		Map     map[string][]byte `toml:"map"`
+		IP      net.IP            `toml:"ip"`
+	}
+	v := config{
+		Default: []byte("hello"),
+		Hex:     []byte{0xde, 0xad},
+		Array:   []byte{1, 2},
+		Map:     map[string][]byte{"k": []byte("v")},
+		IP:      net.IPv4(127, 0, 0, 1),
+	}
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `array = [1, 2]
+default = "aGVsbG8="
+hex = "dead"
+ip = "127.0.0.1"
+
+[map]
+  k = "dg=="
+`
+	if string(b) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, b)
+	}
+
+	var decoded config
+	if err := Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, v) {
+		t.Errorf("round trip failed: %#v", decoded)
+	}
+
+	// arrays of integers are accepted whatever the option
+	if err := Unmarshal([]byte("default = [104, 105]\nhex = [1]"), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded.Default) != "hi" || !bytes.Equal(decoded.Hex, []byte{1}) {
+		t.Errorf("unexpected decoding of arrays: %#v", decoded)
+	}
+
+	err = Unmarshal([]byte(`hex = "xyz"`), &decoded)
+	assertErrorString(t, "(1, 1): cannot decode hex string into []uint8: encoding/hex: invalid byte: U+0078 'x'", err)
+}
+
+func TestMarshalIntegerBases(t *testing.T) {
+	type config struct {
+		Hex      uint32   `toml:"hex,hex"`
+		Octal    int      `toml:"octal,octal"`
+		Binary   *uint8   `toml:"binary,binary"`
+		Negative int      `toml:"negative,hex"`
+		Mode     testMode `toml:"mode,hex"`
+		Name     string   `toml:"name,hex"`
+	}
+	flags := uint8(5)
+	v := config{Hex: 0xcafe, Octal: 0755, Binary: &flags, Negative: -1, Mode: 8, Name: "n"}
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `binary = 0b101
+hex = 0xcafe
+mode = 0x8
+name = "n"
+negative = -1
+octal = 0o755
+`
+	if string(b) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, b)
+	}
+
+	var decoded config
+	if err := Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, v) {
+		t.Errorf("round trip failed: %#v", decoded)
+	}
+}
+
+func TestFallbackTagName(t *testing.T) {
+	type server struct {
+		Host     string `json:"host"`
+		Port     int    `json:"port,omitempty"`
+		Password string `json:"-"`
+		Debug    bool   `json:"debug,string" toml:"verbose"`
+		Timeout  int
+	}
+	v := server{Host: "localhost", Password: "secret", Debug: true, Timeout: 5}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).SetFallbackTagName("json").Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	expected := "Timeout = 5\nhost = \"localhost\"\nverbose = true\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+
+	var decoded server
+	doc := "host = \"example.com\"\nport = 80\nPassword = \"x\"\nverbose = true\ntimeout = 3\n"
+	if err := NewDecoder(strings.NewReader(doc)).SetFallbackTagName("json").Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if expected := (server{Host: "example.com", Port: 80, Debug: true, Timeout: 3}); decoded != expected {
+		t.Errorf("expected %+v, got %+v", expected, decoded)
+	}
+
+	// without the option, json tags are ignored
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "Host = ") || !strings.Contains(string(b), "Password = ") {
+		t.Errorf("unexpected output %s", b)
+	}
+}
+
+func TestFallbackTagNameStringOption(t *testing.T) {
+	type limits struct {
+		Max   int64   `json:"max,string"`
+		Ratio float64 `json:"ratio,string"`
+		Debug bool    `json:"debug,string"`
+	}
+	doc := "debug = \"true\"\nmax = \"42\"\nratio = \"0.5\"\n"
+	var decoded limits
+	if err := NewDecoder(strings.NewReader(doc)).SetFallbackTagName("json").Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if expected := (limits{Max: 42, Ratio: 0.5, Debug: true}); decoded != expected {
+		t.Errorf("expected %+v, got %+v", expected, decoded)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).SetFallbackTagName("json").Encode(decoded); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != doc {
+		t.Errorf("expected %q, got %q", doc, buf.String())
+	}
+}
+
+func TestDecoderCaseInsensitive(t *testing.T) {
+	type config struct {
+		MaxConns int
+		Name     string
+		Label    string `toml:"name_label"`
+		Alias    string `toml:"NAME"`
+	}
+	doc := "MAXconns = 10\nnAmE = \"folded\"\nName_Label = \"tagged\"\n"
+	var c config
+	if err := NewDecoder(strings.NewReader(doc)).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c != (config{}) {
+		t.Errorf("keys should not match ignoring case by default, got %+v", c)
+	}
+
+	if err := NewDecoder(strings.NewReader(doc)).CaseInsensitive(true).Strict(true).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	// the tagged Alias field takes nAmE over the Name field
+	if expected := (config{MaxConns: 10, Alias: "folded", Label: "tagged"}); c != expected {
+		t.Errorf("expected %+v, got %+v", expected, c)
+	}
+
+	// exact matches take priority
+	c = config{}
+	doc = "Name = \"exact\"\n"
+	if err := NewDecoder(strings.NewReader(doc)).CaseInsensitive(true).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "exact" || c.Alias != "" {
+		t.Errorf("unexpected decoding %+v", c)
+	}
+}
+
+func TestMarshalDottedTags(t *testing.T) {
+	type config struct {
+		Name    string `toml:"name"`
+		Port    int    `toml:"server.http.port" comment:"Listening port"`
+		Host    string `toml:"server.http.host"`
+		Debug   bool   `toml:"server.debug,omitempty"`
+		Version string `toml:"'v.1'"`
+	}
+	v := config{Name: "app", Port: 8080, Host: "localhost", Version: "x"}
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `name = "app"
+"v.1" = "x"
+
+[server]
+
+  [server.http]
+    host = "localhost"
+
+    # Listening port
+    port = 8080
+`
+	if string(b) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, b)
+	}
+
+	var decoded config
+	if err := NewDecoder(bytes.NewReader(b)).Strict(true).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != v {
+		t.Errorf("expected %+v, got %+v", v, decoded)
+	}
+
+	doc := "server = { debug = true, http = { port = 1 } }"
+	if err := Unmarshal([]byte(doc), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Debug || decoded.Port != 1 {
+		t.Errorf("unexpected decoding %+v", decoded)
+	}
+
+	type required struct {
+		Port int `toml:"server.port" required:"true"`
+	}
+	err = Unmarshal([]byte("[server]\nhost = 1\n"), &required{})
+	assertErrorString(t, "missing required key server.port", err)
+	err = NewDecoder(strings.NewReader("[server]\nhost = 1\nport = 2\n")).Strict(true).Decode(&required{})
+	assertErrorString(t, `undecoded keys: ["server.host"]`, err)
+}
+
+func TestMarshalBigNumbers(t *testing.T) {
+	type config struct {
+		Small   big.Int    `toml:"small"`
+		Large   *big.Int   `toml:"large"`
+		Huge    *big.Int   `toml:"huge"`
+		Exact   big.Float  `toml:"exact"`
+		Precise *big.Float `toml:"precise"`
+		List    []*big.Int `toml:"list"`
+		Missing *big.Float `toml:"missing"`
+	}
+	var v config
+	v.Small.SetInt64(-42)
+	v.Large = new(big.Int).SetUint64(math.MaxUint64)
+	v.Huge, _ = new(big.Int).SetString("123456789012345678901234567890", 10)
+	v.Exact.SetFloat64(2.5)
+	v.Precise, _ = new(big.Float).SetPrec(200).SetString("3.14159265358979323846264338327950288")
+	v.List = []*big.Int{big.NewInt(1), big.NewInt(2)}
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `exact = 2.5
+huge = "123456789012345678901234567890"
+large = 18446744073709551615
+list = [1, 2]
+precise = "3.14159265358979323846264338327950288"
+small = -42
+`
+	if string(b) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, b)
+	}
+
+	var decoded config
+	if err := Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Small.Cmp(&v.Small) != 0 || decoded.Large.Cmp(v.Large) != 0 || decoded.Huge.Cmp(v.Huge) != 0 ||
+		decoded.Exact.Cmp(&v.Exact) != 0 || decoded.Precise.Text('g', -1) != v.Precise.Text('g', -1) ||
+		len(decoded.List) != 2 || decoded.List[1].Int64() != 2 || decoded.Missing != nil {
+		t.Errorf("round trip failed: %+v", decoded)
+	}
+
+	err = Unmarshal([]byte("small = 1.5"), &decoded)
+	assertErrorString(t, `(1, 1): unmarshal text: math/big: cannot unmarshal "1.5" into a *big.Int`, err)
+	err = Unmarshal([]byte(`exact = "x"`), &decoded)
+	assertErrorString(t, `(1, 1): Can't convert "x" to big.Float`, err)
+	_, err = Load("i = 123456789012345678901234567890")
+	assertErrorString(t, "(1, 5): integer 123456789012345678901234567890 does not fit in 64 bits: write it as a string to decode it into a big.Int", err)
+}
+
+func TestUnmarshalIntegerOverflow(t *testing.T) {
+	var v struct {
+		I int64
+		U uint64
+	}
+	err := Unmarshal([]byte("I = 18446744073709551615"), &v)
+	assertErrorString(t, "(1, 1): 18446744073709551615(uint64) would overflow int64", err)
+	if err := Unmarshal([]byte("I = 9223372036854775807\nU = 18446744073709551615"), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.I != math.MaxInt64 || v.U != math.MaxUint64 {
+		t.Errorf("unexpected values %+v", v)
+	}
+}
+
+func TestDecoderScalarToArray(t *testing.T) {
+	type config struct {
+		Tags   []string  `toml:"tags"`
+		Ports  [2]int    `toml:"ports"`
+		Ratios []float64 `toml:"ratios"`
+		List   []string  `toml:"list"`
+		IP     net.IP    `toml:"ip"`
+	}
+	doc := []byte(`tags = "web"
+ports = 80
+ratios = 0.5
+list = ["a", "b"]
+ip = "10.0.0.1"
+`)
+
+	var c config
+	if err := NewDecoder(bytes.NewReader(doc)).Decode(&c); err == nil {
+		t.Error("scalars should not be decoded into slices by default")
+	}
+
+	c = config{}
+	if err := NewDecoder(bytes.NewReader(doc)).ScalarToArray(true).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	expected := config{
+		Tags:   []string{"web"},
+		Ports:  [2]int{80, 0},
+		Ratios: []float64{0.5},
+		List:   []string{"a", "b"},
+		IP:     net.IPv4(10, 0, 0, 1),
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("expected %v, got %v", expected, c)
+	}
+}
+
+func TestDecoderMixedArrays(t *testing.T) {
+	type config struct {
+		Ports  []int
+		Names  []string
+		Ratios [3]float64
+	}
+	doc := []byte(`ports = [80, "443", 8080.0]
+names = ["a", 2, true]
+ratios = [0.5, 1, "x"]
+`)
+
+	var c config
+	err := NewDecoder(bytes.NewReader(doc)).Decode(&c)
+	elementErr, ok := err.(*ArrayElementError)
+	if !ok {
+		t.Fatalf("expected an *ArrayElementError, got %T: %v", err, err)
+	}
+	if elementErr.Index != 1 || elementErr.Position != (Position{1, 15}) || elementErr.Value != "443" {
+		t.Errorf("unexpected error: %#v", elementErr)
+	}
+	assertErrorString(t, "(1, 15): array element 1: Can't convert 443(string) to int", err)
+
+	c = config{}
+	decoder := NewDecoder(bytes.NewReader(doc)).MixedArrays(MixedArraysSkip)
+	if err := decoder.Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	expected := config{
+		Ports:  []int{80},
+		Names:  []string{"a"},
+		Ratios: [3]float64{0.5},
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("expected %v, got %v", expected, c)
+	}
+	var warnings []string
+	for _, w := range decoder.ArrayWarnings() {
+		warnings = append(warnings, w.Error())
+	}
+	expectedWarnings := []string{
+		"(1, 15): array element 1: Can't convert 443(string) to int",
+		"(1, 21): array element 2: Can't convert 8080(float64) to int",
+		"(2, 15): array element 1: Can't convert 2(int64) to string",
+		"(2, 18): array element 2: Can't convert true(bool) to string",
+		"(3, 16): array element 1: Can't convert 1(int64) to float64",
+		"(3, 20): array element 2: Can't convert x(string) to float64",
+	}
+	if !reflect.DeepEqual(warnings, expectedWarnings) {
+		t.Errorf("unexpected warnings:\n%q\nexpected:\n%q", warnings, expectedWarnings)
+	}
+
+	c = config{}
+	decoder = NewDecoder(bytes.NewReader(doc)).MixedArrays(MixedArraysConvert)
+	err = decoder.Decode(&c)
+	assertErrorString(t, "(3, 20): array element 2: Can't convert x(string) to float64", err)
+
+	c = config{}
+	doc = doc[:bytes.LastIndex(doc, []byte("ratios"))]
+	decoder = NewDecoder(bytes.NewReader(doc)).MixedArrays(MixedArraysConvert)
+	if err := decoder.Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	expected = config{
+		Ports: []int{80, 443, 8080},
+		Names: []string{"a", "2", "true"},
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("expected %v, got %v", expected, c)
+	}
+	if len(decoder.ArrayWarnings()) != 4 || !decoder.ArrayWarnings()[0].Converted {
+		t.Errorf("unexpected warnings: %v", decoder.ArrayWarnings())
+	}
+}
+
+func TestMarshalCommentTags(t *testing.T) {
+	type server struct {
+		Host string `toml:"host" comment:"Host name"`
+		Port int    `toml:"port" comment:"Port to listen on.\nDefaults to 8080." commented:"true"`
+	}
+	type config struct {
+		Title   string   `toml:"title" comment:"Title of the document"`
+		Backup  server   `toml:"backup" comment:"Optional backup server" commented:"true"`
+		Servers []server `toml:"servers" comment:"Servers to connect to"`
+	}
+	var result bytes.Buffer
+	err := NewEncoder(&result).Indentation("").Encode(config{
+		Title:   "example",
+		Backup:  server{Host: "backup", Port: 8080},
+		Servers: []server{{Host: "a", Port: 8080}, {Host: "b", Port: 8080}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# Title of the document
+title = "example"
+
+# Optional backup server
+# [backup]
+
+# Host name
+# host = "backup"
+
+# Port to listen on.
+# Defaults to 8080.
+# port = 8080
+
+# Servers to connect to
+[[servers]]
+
+# Host name
+host = "a"
+
+# Port to listen on.
+# Defaults to 8080.
+# port = 8080
+
+[[servers]]
+
+# Host name
+host = "b"
+
+# Port to listen on.
+# Defaults to 8080.
+# port = 8080
+`
+	if result.String() != expected {
+		t.Errorf("Bad marshal: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, result.String())
+	}
+
+	tree, err := LoadBytes(result.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Has("backup") || tree.Get("servers").([]*Tree)[1].Get("host") != "b" {
+		t.Errorf("unexpected document %v", tree.ToMap())
+	}
+}
+
+func TestMarshalTabularArrays(t *testing.T) {
+	type host struct {
+		Name string   `toml:"name"`
+		Port int      `toml:"port"`
+		Tags []string `toml:"tags"`
+	}
+	type inventory struct {
+		Hosts []host `toml:"hosts"`
+		Other []map[string]interface{}
+		Title string `toml:"title"`
+	}
+	data := inventory{
+		Hosts: []host{
+			{Name: "alpha", Port: 80, Tags: []string{"web"}},
+			{Name: "b", Port: 8080, Tags: []string{}},
+			{Name: "gamma-ray", Port: 443, Tags: []string{"web", "tls"}},
+		},
+		Other: []map[string]interface{}{{"a": 1}, {"b": 2}},
+		Title: "inventory",
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).TabularArrays(true).Encode(data); err != nil {
+		t.Fatal(err)
+	}
+	expected := `title = "inventory"
+hosts = [
+  { name = "alpha",     port = 80,   tags = ["web"]        },
+  { name = "b",         port = 8080, tags = []             },
+  { name = "gamma-ray", port = 443,  tags = ["web", "tls"] },
+]
+
+[[Other]]
+  a = 1
+
+[[Other]]
+  b = 2
+`
+	if buf.String() != expected {
+		t.Errorf("Bad marshal: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, buf.String())
+	}
+
+	var decoded inventory
+	if err := Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.Hosts, data.Hosts) {
+		t.Errorf("expected %v, got %v", data.Hosts, decoded.Hosts)
+	}
+}
+
+func TestMarshalOrderPreserveValuesBeforeTables(t *testing.T) {
+	var buf bytes.Buffer
+	err := NewEncoder(&buf).Order(OrderPreserve).Encode(OrderedMap{
+		{"server", OrderedMap{{"port", 80}}},
+		{"name", "x"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `name = "x"
+
+[server]
+  port = 80
+`
+	if buf.String() != expected {
+		t.Errorf("Bad marshal: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, buf.String())
+	}
+}
+
+func TestUnmarshalRequired(t *testing.T) {
+	type server struct {
+		Host string `toml:"host,required"`
+		Port int    `toml:"port" required:"true"`
+	}
+	type tls struct {
+		Cert string `toml:"cert,required"`
+	}
+	type config struct {
+		Name    string   `toml:"name,required"`
+		Server  server   `toml:"server,required"`
+		Backups []server `toml:"backups"`
+		TLS     tls      `toml:"tls"`
+	}
+
+	var c config
+	err := Unmarshal([]byte(`
+[server]
+port = 80
+
+[[backups]]
+host = "b"
+
+[[backups]]
+port = 81
+`), &c)
+	missing, ok := err.(*MissingKeysError)
+	if !ok {
+		t.Fatalf("expected a *MissingKeysError, got %v", err)
+	}
+	expected := []Key{{"name"}, {"server", "host"}, {"backups", "0", "port"}, {"backups", "1", "host"}}
+	if !reflect.DeepEqual(missing.Keys, expected) {
+		t.Errorf("expected %v, got %v", expected, missing.Keys)
+	}
+	assertErrorString(t, "missing required keys name, server.host, backups.0.port, backups.1.host", err)
+
+	err = Unmarshal([]byte("name = \"a\"\n"), &c)
+	assertErrorString(t, "missing required key server", err)
+
+	err = Unmarshal([]byte("name = \"a\"\n[server]\nhost = \"h\"\nport = 1\n"), &c)
+	if err != nil {
+		t.Errorf("tables missing from the document are not checked: %v", err)
+	}
+}
+
+func TestDecoderCollectErrors(t *testing.T) {
+	type server struct {
+		Host string `toml:"host,required"`
+		Port int    `toml:"port"`
+	}
+	type config struct {
+		Name    string         `toml:"name"`
+		Ports   []int          `toml:"ports"`
+		Servers []server       `toml:"servers"`
+		Limits  map[string]int `toml:"limits"`
+		Debug   bool           `toml:"debug"`
+	}
+	doc := `name = 1
+ports = [80, "http", 443]
+debug = true
+
+[limits]
+max = 10
+min = "none"
+
+[[servers]]
+host = "a"
+port = "eighty"
+
+[[servers]]
+port = 81
+`
+	var c config
+	err := NewDecoder(strings.NewReader(doc)).CollectErrors(true).Decode(&c)
+	errs, ok := err.(DecodeErrors)
+	if !ok {
+		t.Fatalf("expected DecodeErrors, got %v", err)
+	}
+	var keys []string
+	for _, e := range errs {
+		keys = append(keys, e.Key.String())
+	}
+	expected := []string{"name", "ports.1", "limits.min", "servers.0.port", "servers.1.host"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected keys %v, got %v", expected, keys)
+	}
+	if p := errs[1].Position; p.Line != 2 || p.Col != 15 {
+		t.Errorf("unexpected position %v for %s", p, errs[1].Key)
+	}
+	if msg := errs[4].Error(); msg != "(13, 1): servers.1.host: missing required key" {
+		t.Errorf("unexpected message %q", msg)
+	}
+	if !c.Debug || !reflect.DeepEqual(c.Ports, []int{80, 443}) || c.Limits["max"] != 10 || c.Servers[1].Port != 81 {
+		t.Errorf("valid values should be decoded, got %+v", c)
+	}
+
+	err = NewDecoder(strings.NewReader(doc)).Decode(&c)
+	if _, ok := err.(DecodeErrors); ok || err == nil {
+		t.Errorf("decoding should stop at the first error by default, got %v", err)
+	}
+}
+
+type recursiveNode struct {
+	Name     string                    `toml:"name"`
+	Next     *recursiveNode            `toml:"next"`
+	Children []recursiveNode           `toml:"children"`
+	Index    map[string]*recursiveNode `toml:"index,omitempty"`
+}
+
+func TestMarshalRecursiveTypes(t *testing.T) {
+	n := recursiveNode{
+		Name: "root",
+		Next: &recursiveNode{Name: "next"},
+		Children: []recursiveNode{
+			{Name: "a", Children: []recursiveNode{{Name: "a1"}}},
+		},
+		Index: map[string]*recursiveNode{"b": {Name: "b"}},
+	}
+	b, err := Marshal(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out recursiveNode
+	if err := Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Next == nil || out.Next.Name != "next" || out.Next.Next != nil ||
+		len(out.Children) != 1 || out.Children[0].Children[0].Name != "a1" ||
+		out.Index["b"].Name != "b" {
+		t.Errorf("bad round trip of\n%s\ngot %+v", b, out)
+	}
+}
+
+func TestMarshalMaxDepth(t *testing.T) {
+	cycle := &recursiveNode{Name: "a"}
+	cycle.Next = cycle
+	_, err := Marshal(cycle)
+	assertErrorString(t, "cannot encode next: the *toml.recursiveNode value contains itself", err)
+	m := map[string]interface{}{"name": "m"}
+	m["sub"] = map[string]interface{}{"self": m}
+	_, err = Marshal(m)
+	assertErrorString(t, "cannot encode sub.self: the map[string]interface {} value contains itself", err)
+	s := []interface{}{1, nil}
+	s[1] = s
+	_, err = Marshal(map[string]interface{}{"s": s})
+	assertErrorString(t, "cannot encode s: the []interface {} value contains itself", err)
+
+	shared := &recursiveNode{Name: "shared"}
+	dag := struct{ A, B *recursiveNode }{shared, shared}
+	b, err := Marshal(dag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "\n[A]\n  name = \"shared\"\n\n[B]\n  name = \"shared\"\n"; string(b) != expected {
+		t.Errorf("expected %q, got %q", expected, b)
+	}
+	nested := map[string]interface{}{"a": []interface{}{[]interface{}{1}}}
+	err = NewEncoder(ioutil.Discard).MaxDepth(2).Encode(nested)
+	assertErrorString(t, "maximum depth of 2 exceeded", err)
+
+	deep := &recursiveNode{Name: "a", Next: &recursiveNode{Name: "b", Next: &recursiveNode{Name: "c"}}}
+	err = NewEncoder(ioutil.Discard).MaxDepth(2).Encode(deep)
+	assertErrorString(t, "maximum depth of 2 exceeded", err)
+	if err := NewEncoder(ioutil.Discard).MaxDepth(3).Encode(deep); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUnmarshalMaxDepth(t *testing.T) {
+	doc := "name = \"a\"\n[next]\nname = \"b\"\n[next.next]\nname = \"c\"\n"
+	var n recursiveNode
+	err := NewDecoder(strings.NewReader(doc)).MaxDepth(2).Decode(&n)
+	assertErrorString(t, "(4, 1): maximum depth of 2 exceeded", err)
+	if err := NewDecoder(strings.NewReader(doc)).MaxDepth(-1).Decode(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n.Next.Next.Name != "c" {
+		t.Errorf("unexpected value %+v", n)
+	}
+}
+
+func TestDecoderLenientBools(t *testing.T) {
+	type config struct {
+		A bool   `toml:"a"`
+		B bool   `toml:"b"`
+		C bool   `toml:"c"`
+		D bool   `toml:"d"`
+		E []bool `toml:"e"`
+	}
+	doc := `a = "Yes"
+b = 0
+c = true
+d = "off"
+e = ["on", 1]
+`
+	var c config
+	err := NewDecoder(strings.NewReader(doc)).Decode(&c)
+	assertErrorString(t, "(1, 1): Can't convert Yes(string) to bool", err)
+
+	dec := NewDecoder(strings.NewReader(doc)).LenientBools(true)
+	if err := dec.Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if expected := (config{A: true, D: false, C: true, E: []bool{true, true}}); !reflect.DeepEqual(c, expected) {
+		t.Errorf("expected %+v, got %+v", expected, c)
+	}
+	var warnings []string
+	for _, w := range dec.Warnings() {
+		warnings = append(warnings, w.String())
+	}
+	expected := []string{
+		"(1, 1): a: converted Yes(string) to true",
+		"(2, 1): b: converted 0(int64) to false",
+		"(4, 1): d: converted off(string) to false",
+		"(5, 7): e.0: converted on(string) to true",
+		"(5, 12): e.1: converted 1(int64) to true",
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("expected %v, got %v", expected, warnings)
+	}
+
+	err = NewDecoder(strings.NewReader(`a = "maybe"`)).LenientBools(true).Decode(&c)
+	assertErrorString(t, "(1, 1): Can't convert maybe(string) to bool", err)
+}
+
+func TestDecoderDecodeAt(t *testing.T) {
+	type tls struct {
+		Cert string `toml:"cert"`
+		Port int    `toml:"port,required"`
+	}
+	doc := `title = 1
+
+[server]
+name = "a"
+
+[server.tls]
+cert = "c.pem"
+port = 443
+
+[other]
+unrelated = true
+`
+	var c tls
+	if err := NewDecoder(strings.NewReader(doc)).Strict(true).DecodeAt("server.tls", &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Cert != "c.pem" || c.Port != 443 {
+		t.Errorf("unexpected value %+v", c)
+	}
+
+	err := NewDecoder(strings.NewReader("[server.tls]\ncert = 1\n")).DecodeAt("server.tls", &c)
+	assertErrorString(t, "(2, 1): Can't convert 1(int64) to string", err)
+	err = NewDecoder(strings.NewReader("[server.tls]\n")).DecodeAt("server.tls", &c)
+	assertErrorString(t, "missing required key server.tls.port", err)
+	err = NewDecoder(strings.NewReader(doc)).DecodeAt("server.missing", &c)
+	assertErrorString(t, "key server.missing not found", err)
+	err = NewDecoder(strings.NewReader(doc)).DecodeAt("server.name", &c)
+	assertErrorString(t, "(4, 1): key server.name is not a table", err)
+}
+
+func TestMarshalWrapStrings(t *testing.T) {
+	type config struct {
+		Short string `toml:"short"`
+		Long  string `toml:"long"`
+		Token string `toml:"token"`
+		Odd   string `toml:"odd" commented:"true"`
+	}
+	c := config{
+		Short: "fits on one line",
+		Long:  "The quick brown fox jumps over the lazy dog, \"twice\"\nthen sleeps.",
+		Token: "0123456789abcdefghijklmnopqrstuvwxyz",
+		Odd:   "  leading and   many    spaces between words",
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).WrapStrings(20).Encode(c); err != nil {
+		t.Fatal(err)
+	}
+	expected := `long = """
+The quick brown \
+fox jumps over the \
+lazy dog, \
+\"twice\"\nthen \
+sleeps."""
+# odd = """
+#   leading and   \
+# many    spaces \
+# between words"""
+short = "fits on one line"
+token = """
+0123456789abcdefghi\
+jklmnopqrstuvwxyz"""
+`
+	if buf.String() != expected {
+		t.Errorf("Bad marshal: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, buf.String())
+	}
+
+	var out config
+	doc := strings.Replace(buf.String(), "# ", "", -1)
+	if err := Unmarshal([]byte(doc), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, c) {
+		t.Errorf("bad round trip: expected %+v, got %+v", c, out)
+	}
+}
+
+func TestEncoderLiteralStrings(t *testing.T) {
+	type config struct {
+		Pattern string   `toml:"pattern,literal"`
+		Path    string   `toml:"path"`
+		Quote   string   `toml:"quote,literal"`
+		Paths   []string `toml:"paths,literal"`
+	}
+	c := config{
+		Pattern: `^\d+\.\d+$`,
+		Path:    `C:\Users\go`,
+		Quote:   `it's`,
+		Paths:   []string{`C:\a`, "it's", "d\ne"},
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(c); err != nil {
+		t.Fatal(err)
+	}
+	expected := `path = "C:\\Users\\go"
+paths = ['C:\a', "it's", "d\ne"]
+pattern = '^\d+\.\d+$'
+quote = "it's"
+`
+	if buf.String() != expected {
+		t.Errorf("Bad marshal: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := NewEncoder(&buf).LiteralStrings(true).Encode(c); err != nil {
+		t.Fatal(err)
+	}
+	expected = strings.Replace(expected, `"C:\\Users\\go"`, `'C:\Users\go'`, 1)
+	if buf.String() != expected {
+		t.Errorf("Bad marshal: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, buf.String())
+	}
+
+	var out config
+	if err := Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, c) {
+		t.Errorf("bad round trip: expected %+v, got %+v", c, out)
+	}
+}
+
+func TestDecoderOnUnknownKey(t *testing.T) {
+	type Common struct {
+		ID string `toml:"id"`
+	}
+	type server struct {
+		Host string `toml:"host"`
+	}
+	type config struct {
+		Common
+		Name    string            `toml:"name"`
+		Servers []server          `toml:"servers"`
+		Labels  map[string]string `toml:"labels"`
+	}
+	doc := `id = "x"
+name = "n"
+nmae = "typo"
+
+[labels]
+anything = "goes"
+
+[[servers]]
+host = "a"
+port = 80
+
+[extra]
+a = 1
+b = 2
+`
+	var unknown []string
+	var c config
+	err := NewDecoder(strings.NewReader(doc)).OnUnknownKey(func(path Key, v Value) {
+		unknown = append(unknown, fmt.Sprintf("%s %s %s", v.Position(), path, v.Kind()))
+	}).Decode(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"(10, 1) servers.0.port integer",
+		"(3, 1) nmae string",
+		"(12, 1) extra table",
+	}
+	if !reflect.DeepEqual(unknown, expected) {
+		t.Errorf("expected %v, got %v", expected, unknown)
+	}
+	if c.ID != "x" || c.Name != "n" || c.Servers[0].Host != "a" {
+		t.Errorf("unexpected value %+v", c)
+	}
+}
+
+type sharedConfig struct {
+	Name    string
+	Ports   []int
+	Labels  map[string]string
+	Extra   *Tree
+	Servers []struct{ Host string }
+}
+
+func newSharedConfig(t *testing.T) sharedConfig {
+	extra, err := Load("# about\n[a]\nb = [1, 2]\n[[c]]\nd = { e = 1 }\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sharedConfig{
+		Name:    "shared",
+		Ports:   []int{80, 443},
+		Labels:  map[string]string{"env": "prod"},
+		Extra:   extra,
+		Servers: []struct{ Host string }{{"a"}, {"b"}},
+	}
+}
+
+func TestMarshalConcurrently(t *testing.T) {
+	c := newSharedConfig(t)
+	extra := c.Extra.String()
+	expected, err := Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var buf bytes.Buffer
+			enc := NewEncoder(&buf)
+			if i%2 == 0 {
+				enc.Order(OrderPreserve).TabularArrays(true)
+			}
+			if err := enc.Encode(c); err != nil {
+				t.Error(err)
+			}
+			if b, err := Marshal(c); err != nil || !bytes.Equal(b, expected) {
+				t.Errorf("unexpected result %s: %v", b, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if !reflect.DeepEqual(c, newSharedConfig(t)) || c.Extra.String() != extra {
+		t.Errorf("Marshal modified its input: %+v", c)
+	}
+}
+
+func TestEncoderLocker(t *testing.T) {
+	var mu sync.RWMutex
+	c := newSharedConfig(t)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			mu.Lock()
+			c.Ports = append(c.Ports, i)
+			c.Labels["i"] = strconv.Itoa(i)
+			c.Extra.Set("a.i", int64(i))
+			mu.Unlock()
+		}
+	}()
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				var buf bytes.Buffer
+				if err := NewEncoder(&buf).Locker(mu.RLocker()).Encode(&c); err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := LoadBytes(buf.Bytes()); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Map key implementing encoding.TextMarshaler and encoding.TextUnmarshaler.
+type pointKey struct{ X, Y int }
+
+func (p pointKey) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d:%d", p.X, p.Y)), nil
+}
+
+func (p *pointKey) UnmarshalText(b []byte) error {
+	_, err := fmt.Sscanf(string(b), "%d:%d", &p.X, &p.Y)
+	return err
+}
+
+func TestMarshalNonStringMapKeys(t *testing.T) {
+	type config struct {
+		Ports  map[int]string     `toml:"ports"`
+		Sizes  map[uint8]bool     `toml:"sizes"`
+		Points map[pointKey]int64 `toml:"points"`
+	}
+	c := config{
+		Ports:  map[int]string{80: "http", -1: "none", 443: "https"},
+		Sizes:  map[uint8]bool{8: true},
+		Points: map[pointKey]int64{{1, 2}: 3},
+	}
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Order(OrderPreserve).Encode(c); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+[ports]
+  -1 = "none"
+  443 = "https"
+  80 = "http"
+
+[sizes]
+  8 = true
+
+[points]
+  "1:2" = 3
+`
+	if buf.String() != expected {
+		t.Errorf("Bad marshal: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, buf.String())
+	}
+
+	var out config
+	if err := Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, c) {
+		t.Errorf("bad round trip: expected %+v, got %+v", c, out)
+	}
+
+	err := Unmarshal([]byte("[sizes]\n256 = true\n"), &out)
+	assertErrorString(t, `(2, 1): cannot decode key "256" into uint8`, err)
+	err = Unmarshal([]byte("[points]\nx = 1\n"), &out)
+	assertErrorString(t, `(2, 1): cannot decode key "x" into toml.pointKey: expected integer`, err)
+
+	_, err = Marshal(map[float64]int{1.5: 1})
+	assertErrorString(t, "unsupported map key type float64", err)
+	var floats map[float64]int
+	err = Unmarshal([]byte("a = 1\n"), &floats)
+	assertErrorString(t, "(1, 1): unsupported map key type float64", err)
+}
+
+func TestMarshalStringOption(t *testing.T) {
+	type config struct {
+		ID      uint64        `toml:"id,string"`
+		Port    int16         `toml:"port,string"`
+		Ratio   float32       `toml:"ratio,string"`
+		Enabled *bool         `toml:"enabled,string"`
+		Name    string        `toml:"name,string"`
+		Timeout time.Duration `toml:"timeout,string"`
+	}
+	enabled := true
+	c := config{ID: 18446744073709551615, Port: -1, Ratio: 0.5, Enabled: &enabled, Name: "n", Timeout: time.Second}
+	b, err := Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `enabled = "true"
+id = "18446744073709551615"
+name = "n"
+port = "-1"
+ratio = "0.5"
+timeout = "1s"
+`
+	if string(b) != expected {
+		t.Errorf("Bad marshal: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, string(b))
+	}
+
+	var out config
+	if err := Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, c) {
+		t.Errorf("bad round trip: expected %+v, got %+v", c, out)
+	}
+
+	// values that are not strings are still accepted
+	out = config{}
+	if err := Unmarshal([]byte("port = 80\nenabled = false\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Port != 80 || out.Enabled == nil || *out.Enabled {
+		t.Errorf("unexpected result %+v", out)
+	}
+
+	err = Unmarshal([]byte(`port = "eighty"`), &out)
+	assertErrorString(t, `(1, 1): cannot decode "eighty" into int16`, err)
+	err = Unmarshal([]byte(`port = "100000"`), &out)
+	assertErrorString(t, "(1, 1): 100000(int64) would overflow int16", err)
+}
+
+// zeroVersion is zero when it has no major version, whatever its label.
+type zeroVersion struct {
+	Major int
+	Label string
+}
+
+func (v zeroVersion) IsZero() bool { return v.Major == 0 }
+
+func TestMarshalOmitZero(t *testing.T) {
+	type config struct {
+		Time     time.Time       `toml:"time,omitzero"`
+		Local    time.Time       `toml:"local,omitzero"`
+		Version  zeroVersion     `toml:"version,omitzero"`
+		Count    int             `toml:"count,omitzero"`
+		Empty    []string        `toml:"empty,omitzero"`
+		Nil      []string        `toml:"nil,omitzero"`
+		Labels   map[string]int  `toml:"labels,omitzero"`
+		Inner    struct{ A int } `toml:"inner,omitzero"`
+		Required int             `toml:"required"`
+	}
+	c := config{
+		// zero according to IsZero, although its location is not nil
+		Local:   time.Time{}.In(time.FixedZone("", 3600)),
+		Version: zeroVersion{Label: "dev"},
+		Empty:   []string{},
+		Labels:  map[string]int{},
+	}
+	b, err := Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "empty = []\nrequired = 0\n\n[labels]\n"
+	if string(b) != expected {
+		t.Errorf("Bad marshal: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, string(b))
+	}
+
+	c = config{Time: time.Date(2021, time.March, 4, 0, 0, 0, 0, time.UTC), Version: zeroVersion{Major: 1}, Count: 2}
+	c.Inner.A = 3
+	b, err = Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `count = 2
+required = 0
+time = 2021-03-04T00:00:00Z
+
+[inner]
+  A = 3
+
+[version]
+  Label = ""
+  Major = 1
+`
+	if string(b) != expected {
+		t.Errorf("Bad marshal: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, string(b))
+	}
+}
+
+func TestDecoderPointerPolicy(t *testing.T) {
+	type server struct {
+		Host string
+	}
+	type config struct {
+		Port    *int    `toml:"port"`
+		Name    *string `toml:"name"`
+		Server  *server `toml:"server"`
+		Enabled bool    `toml:"enabled"`
+	}
+	doc := `port = "eighty"`
+
+	var c config
+	err := NewDecoder(strings.NewReader(doc)).Decode(&c)
+	assertErrorString(t, "(1, 1): Can't convert eighty(string) to int", err)
+
+	d := NewDecoder(strings.NewReader(doc)).PointerPolicy(PointersNil)
+	if err := d.Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Port != nil || c.Name != nil || c.Server != nil {
+		t.Errorf("unexpected result %+v", c)
+	}
+	warnings := fmt.Sprint(d.Warnings())
+	if expected := "[(1, 1): port: cannot decode string into *int (Can't convert eighty(string) to int), left nil]"; warnings != expected {
+		t.Errorf("expected warnings %s, got %s", expected, warnings)
+	}
+
+	d = NewDecoder(strings.NewReader(doc)).PointerPolicy(PointersZero)
+	if err := d.Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Port == nil || *c.Port != 0 || c.Name == nil || c.Server == nil {
+		t.Errorf("unexpected result %+v", c)
+	}
+	if len(d.Warnings()) != 1 {
+		t.Errorf("expected a warning, got %v", d.Warnings())
+	}
+
+	c = config{}
+	err = NewDecoder(strings.NewReader("port = 80\n")).PointerPolicy(PointersError).Decode(&c)
+	assertErrorString(t, "missing required keys name, server", err)
+}
+
+func TestEncoderRedact(t *testing.T) {
+	type database struct {
+		User     string `toml:"user"`
+		Password string `toml:"password,secret"`
+		Port     int    `toml:"port,secret"`
+	}
+	type config struct {
+		Name     string   `toml:"name"`
+		Token    string   `toml:"token,secret,omitempty"`
+		APIKey   string   `toml:"api_key,secret,omitempty"`
+		Database database `toml:"database"`
+	}
+	c := config{
+		Name:     "app",
+		Token:    "s3cr3t",
+		Database: database{User: "admin", Password: "hunter2", Port: 5432},
+	}
+
+	b, err := Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `password = "hunter2"`) || !strings.Contains(string(b), `token = "s3cr3t"`) {
+		t.Errorf("secrets not written by Marshal:\n%s", b)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Redact(true).Encode(c); err != nil {
+		t.Fatal(err)
+	}
+	expected := `name = "app"
+token = "[redacted]"
+
+[database]
+  password = "[redacted]"
+  port = "[redacted]"
+  user = "admin"
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestEncoderLayout(t *testing.T) {
+	type server struct {
+		Hosts []string `toml:"hosts"`
+		Ports []int    `toml:"ports" comment:"listening ports"`
+	}
+	type config struct {
+		Title   string   `toml:"title"`
+		Servers []server `toml:"servers"`
+		Main    server   `toml:"main"`
+	}
+	c := config{
+		Title:   "app",
+		Servers: []server{{Hosts: []string{"a"}, Ports: []int{1, 2, 3}}},
+		Main:    server{Hosts: []string{"alpha.example.com", "beta.example.com"}, Ports: []int{80}},
+	}
+
+	var buf bytes.Buffer
+	err := NewEncoder(&buf).Indentation("").TableSpacing(0).KeyValueSeparator("=").ArrayWrap(2, 30).Encode(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `title="app"
+[main]
+hosts=[
+  "alpha.example.com",
+  "beta.example.com",
+]
+
+# listening ports
+ports=[80]
+[[servers]]
+hosts=["a"]
+
+# listening ports
+ports=[
+  1,
+  2,
+  3,
+]
+`
+	if buf.String() != expected {
+		t.Errorf("Bad marshal: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, buf.String())
+	}
+	var decoded config
+	if err := Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, c) {
+		t.Errorf("expected %v, got %v", c, decoded)
+	}
+
+	buf.Reset()
+	err = NewEncoder(&buf).TableSpacing(2).KeyValueSeparator("  =  ").Encode(map[string]interface{}{"a": map[string]interface{}{"b": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "\n\n[a]\n  b  =  1\n"; buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+
+	err = NewEncoder(&buf).KeyValueSeparator(":").Encode(c)
+	assertErrorString(t, `invalid key/value separator ":"`, err)
+}
+
+// Document of n tables of an array of tables, as exported from a database.
+func arrayOfTablesDocument(n int) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&buf, "[[rows]]\nid = %d\nname = \"row %d\"\nprice = %d.5\nactive = true\n\n", i, i, i)
+	}
+	return buf.Bytes()
+}
+
+func BenchmarkLoadArrayOfTables(b *testing.B) {
+	doc := arrayOfTablesDocument(5000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := LoadBytes(doc); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalArrayOfTablesMap(b *testing.B) {
+	doc := arrayOfTablesDocument(5000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var m map[string]interface{}
+		if err := Unmarshal(doc, &m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalArrayOfTablesStruct(b *testing.B) {
+	doc := arrayOfTablesDocument(5000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var v struct {
+			Rows []struct {
+				ID     int `toml:"id"`
+				Name   string
+				Price  float64
+				Active bool
+			}
+		}
+		if err := Unmarshal(doc, &v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Nullable type of a database driver.
+type nullPort struct {
+	Port  uint16
+	Valid bool
+}
+
+func (n nullPort) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return int64(n.Port), nil
+}
+
+func TestMarshalSQLNullTypes(t *testing.T) {
+	type config struct {
+		Name    sql.NullString  `toml:"name"`
+		Size    sql.NullInt64   `toml:"size"`
+		Debug   sql.NullBool    `toml:"debug"`
+		Ratio   sql.NullFloat64 `toml:"ratio"`
+		Port    nullPort        `toml:"port"`
+		Tags    *[]string       `toml:"tags"`
+		Servers *[]struct {
+			Host sql.NullString `toml:"host"`
+		} `toml:"servers"`
+	}
+	doc := `debug = false
+port = 8080
+size = 0
+tags = ["a", "b"]
+
+[[servers]]
+  host = "a"
+
+[[servers]]
+`
+	var c config
+	if err := Unmarshal([]byte(doc), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Name.Valid || c.Ratio.Valid {
+		t.Errorf("missing keys should not be valid: %+v, %+v", c.Name, c.Ratio)
+	}
+	if c.Size != (sql.NullInt64{Int64: 0, Valid: true}) || c.Debug != (sql.NullBool{Bool: false, Valid: true}) || c.Port != (nullPort{8080, true}) {
+		t.Errorf("unexpected values %+v, %+v, %+v", c.Size, c.Debug, c.Port)
+	}
+	if c.Tags == nil || !reflect.DeepEqual(*c.Tags, []string{"a", "b"}) {
+		t.Errorf("unexpected tags %v", c.Tags)
+	}
+	if c.Servers == nil || len(*c.Servers) != 2 || (*c.Servers)[0].Host.String != "a" || (*c.Servers)[1].Host.Valid {
+		t.Errorf("unexpected servers %+v", c.Servers)
+	}
+
+	b, err := Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != doc {
+		t.Errorf("expected:\n%s\ngot:\n%s", doc, b)
+	}
+
+	err = Unmarshal([]byte(`size = "large"`), &c)
+	assertErrorString(t, "(1, 1): Can't convert large(string) to int64", err)
+}
+
+func TestEncoderUnsupportedTypes(t *testing.T) {
+	type inner struct {
+		Done chan bool `toml:"done"`
+	}
+	type config struct {
+		Name     string                 `toml:"name"`
+		Callback func()                 `toml:"callback"`
+		Ratio    complex128             `toml:"ratio"`
+		Values   []interface{}          `toml:"values"`
+		Extra    map[string]interface{} `toml:"extra"`
+		Inner    inner                  `toml:"inner"`
+	}
+	c := config{
+		Name:     "a",
+		Callback: func() {},
+		Ratio:    1 + 2i,
+		Values:   []interface{}{1, make(chan int), "b"},
+		Extra:    map[string]interface{}{"f": func() {}, "n": 1},
+		Inner:    inner{Done: make(chan bool)},
+	}
+
+	var buf bytes.Buffer
+	err := NewEncoder(&buf).Encode(struct {
+		Name  string `toml:"name"`
+		Inner inner  `toml:"inner"`
+	}{"a", inner{Done: make(chan bool)}})
+	unsupported, ok := err.(*UnsupportedTypeError)
+	if !ok {
+		t.Fatalf("expected an *UnsupportedTypeError, got %v", err)
+	}
+	if !unsupported.Path.Equal([]string{"inner", "done"}) || unsupported.Type != reflect.TypeOf(make(chan bool)) {
+		t.Errorf("unexpected error %+v", unsupported)
+	}
+	assertErrorString(t, "Marshal can't handle chan bool(chan) at inner.done", err)
+
+	buf.Reset()
+	if err := NewEncoder(&buf).UnsupportedTypes(UnsupportedTypesSkip).Encode(c); err != nil {
+		t.Fatal(err)
+	}
+	expected := `name = "a"
+values = [1, "b"]
+
+[extra]
+  n = 1
+
+[inner]
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	paths := map[string]bool{}
+	fallback := func(path Key, v interface{}) (interface{}, error) {
+		paths[path.String()] = true
+		switch v := v.(type) {
+		case complex128:
+			return fmt.Sprint(v), nil
+		case chan bool:
+			return make(chan int), nil
+		}
+		return nil, nil
+	}
+	buf.Reset()
+	err = NewEncoder(&buf).UnsupportedTypeFallback(fallback).Encode(c)
+	assertErrorString(t, "Marshal can't handle chan int(chan) at inner.done", err)
+	buf.Reset()
+	paths = map[string]bool{}
+	err = NewEncoder(&buf).UnsupportedTypeFallback(fallback).UnsupportedTypes(UnsupportedTypesSkip).Encode(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `name = "a"
+ratio = "(1+2i)"
+values = [1, "b"]
+
+[extra]
+  n = 1
+
+[inner]
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+	if !reflect.DeepEqual(paths, map[string]bool{"callback": true, "extra.f": true, "inner.done": true, "ratio": true, "values": true}) {
+		t.Errorf("unexpected paths %v", paths)
+	}
+
+	buf.Reset()
+	failure := errors.New("failure")
+	err = NewEncoder(&buf).UnsupportedTypeFallback(func(Key, interface{}) (interface{}, error) { return nil, failure }).Encode(c)
+	if err != failure {
+		t.Errorf("expected the error of the fallback, got %v", err)
+	}
+}
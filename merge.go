@@ -0,0 +1,241 @@
+// Merging of documents.
+
+package toml
+
+import (
+	"reflect"
+)
+
+// ArrayMergeMode defines how arrays present in both documents are merged.
+type ArrayMergeMode int
+
+const (
+	// ArraysReplace keeps the array of the overlay.
+	ArraysReplace ArrayMergeMode = iota
+	// ArraysAppend appends the elements of the overlay array to the ones of
+	// the base array. This also applies to arrays of tables.
+	ArraysAppend
+)
+
+// TableMergeMode defines how tables present in both documents are merged.
+type TableMergeMode int
+
+const (
+	// TablesDeepMerge merges the keys of the tables recursively.
+	TablesDeepMerge TableMergeMode = iota
+	// TablesReplace keeps the table of the overlay.
+	TablesReplace
+)
+
+// MergeOptions are supplied to MergeWithOptions and MergeMapsWithOptions to
+// configure how documents are merged. The default values within the struct
+// are valid default options.
+type MergeOptions struct {
+	Arrays ArrayMergeMode
+	Tables TableMergeMode
+}
+
+// Merge returns a new tree made of the values of base overridden by the
+// values of overlay: tables are merged recursively and other values of
+// overlay replace the ones of base. The given trees are not modified.
+//
+// This enables layered configurations, such as defaults overridden by
+// environment specific files. The result records the source of each of its
+// values, as set by SetSource or LoadFile on the trees merged, which its
+// GetSource method and MetaData report.
+func Merge(base, overlay *Tree) *Tree {
+	return MergeWithOptions(base, overlay, MergeOptions{})
+}
+
+// MergeWithOptions is the same as Merge, but allows configuring how arrays
+// and tables present in both trees are merged.
+func MergeWithOptions(base, overlay *Tree, opts MergeOptions) *Tree {
+	result := base.clone()
+	mergeTree(result, overlay, opts, overlay.source)
+	return result
+}
+
+// Merge src into dst, source being the name of the document of src.
+func mergeTree(dst, src *Tree, opts MergeOptions, source string) {
+	for k, v := range src.values {
+		existing, exists := dst.values[k]
+		if !exists {
+			dst.values[k] = cloneTreeNodeFrom(v, source)
+			continue
+		}
+		switch node := v.(type) {
+		case *Tree:
+			if tree, ok := existing.(*Tree); ok && opts.Tables == TablesDeepMerge {
+				if node.source != "" {
+					mergeTree(tree, node, opts, node.source)
+				} else {
+					mergeTree(tree, node, opts, source)
+				}
+				continue
+			}
+		case []*Tree:
+			if trees, ok := existing.([]*Tree); ok && opts.Arrays == ArraysAppend {
+				dst.values[k] = append(trees, cloneTreeNodeFrom(node, source).([]*Tree)...)
+				continue
+			}
+		case *tomlValue:
+			if value, ok := existing.(*tomlValue); ok && opts.Arrays == ArraysAppend {
+				if array, ok := appendArrays(value.value, node.value); ok {
+					merged := *node
+					merged.value = cloneValue(array)
+					setNodeSource(&merged, source)
+					dst.values[k] = &merged
+					continue
+				}
+			}
+		}
+		dst.values[k] = cloneTreeNodeFrom(v, source)
+	}
+}
+
+// Copy node, which comes from the document named source.
+func cloneTreeNodeFrom(node interface{}, source string) interface{} {
+	node = cloneTreeNode(node)
+	if source != "" {
+		setNodeSource(node, source)
+	}
+	return node
+}
+
+// MergeMaps returns a new map made of the values of base overridden by the
+// values of overlay, with the same semantics as Merge. Nested tables are
+// expected to be of type map[string]interface{}, as returned by Tree.ToMap.
+// The given maps are not modified, but values that are not tables or arrays
+// are shared with the result.
+func MergeMaps(base, overlay map[string]interface{}) map[string]interface{} {
+	return MergeMapsWithOptions(base, overlay, MergeOptions{})
+}
+
+// MergeMapsWithOptions is the same as MergeMaps, but allows configuring how
+// arrays and tables present in both maps are merged.
+func MergeMapsWithOptions(base, overlay map[string]interface{}, opts MergeOptions) map[string]interface{} {
+	result := cloneMap(base)
+	mergeMap(result, overlay, opts)
+	return result
+}
+
+func mergeMap(dst, src map[string]interface{}, opts MergeOptions) {
+	for k, v := range src {
+		existing, exists := dst[k]
+		if exists {
+			if m, ok := v.(map[string]interface{}); ok && opts.Tables == TablesDeepMerge {
+				if target, ok := existing.(map[string]interface{}); ok {
+					mergeMap(target, m, opts)
+					continue
+				}
+			}
+			if opts.Arrays == ArraysAppend {
+				if array, ok := appendArrays(existing, v); ok {
+					dst[k] = cloneMapValue(array)
+					continue
+				}
+			}
+		}
+		dst[k] = cloneMapValue(v)
+	}
+}
+
+// Concatenate two arrays. The result has the type of a if both arrays are of
+// the same type, and is a []interface{} otherwise.
+func appendArrays(a, b interface{}) (interface{}, bool) {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Kind() != reflect.Slice || vb.Kind() != reflect.Slice {
+		return nil, false
+	}
+	if va.Type() == vb.Type() {
+		result := reflect.MakeSlice(va.Type(), 0, va.Len()+vb.Len())
+		return reflect.AppendSlice(reflect.AppendSlice(result, va), vb).Interface(), true
+	}
+	result := make([]interface{}, 0, va.Len()+vb.Len())
+	for _, v := range []reflect.Value{va, vb} {
+		for i := 0; i < v.Len(); i++ {
+			result = append(result, v.Index(i).Interface())
+		}
+	}
+	return result, true
+}
+
+// clone returns a deep copy of the tree.
+func (t *Tree) clone() *Tree {
+	result := newTreeWithPosition(t.position)
+	result.comment = t.comment
+	result.commented = t.commented
+	result.inline = t.inline
+	result.source = t.source
+	for k, v := range t.values {
+		result.values[k] = cloneTreeNode(v)
+	}
+	return result
+}
+
+func cloneTreeNode(node interface{}) interface{} {
+	switch n := node.(type) {
+	case *Tree:
+		return n.clone()
+	case []*Tree:
+		trees := make([]*Tree, len(n))
+		for i, tree := range n {
+			trees[i] = tree.clone()
+		}
+		return trees
+	case *tomlValue:
+		value := *n
+		value.value = cloneValue(n.value)
+		return &value
+	}
+	return node
+}
+
+// Copy the arrays and inline tables of a value of a tomlValue.
+func cloneValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case *Tree:
+		return value.clone()
+	case []interface{}:
+		array := make([]interface{}, len(value))
+		for i, element := range value {
+			array[i] = cloneValue(element)
+		}
+		return array
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice {
+		array := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		reflect.Copy(array, rv)
+		return array.Interface()
+	}
+	return v
+}
+
+func cloneMap(m map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		result[k] = cloneMapValue(v)
+	}
+	return result
+}
+
+func cloneMapValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		return cloneMap(value)
+	case []interface{}:
+		array := make([]interface{}, len(value))
+		for i, element := range value {
+			array[i] = cloneMapValue(element)
+		}
+		return array
+	case []map[string]interface{}:
+		array := make([]map[string]interface{}, len(value))
+		for i, element := range value {
+			array[i] = cloneMap(element)
+		}
+		return array
+	}
+	return v
+}
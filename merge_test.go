@@ -0,0 +1,176 @@
+package toml
+
+import (
+	"reflect"
+	"testing"
+)
+
+const mergeBase = `
+title = "base"
+tags = ["a", "b"]
+
+[server]
+host = "localhost"
+port = 80
+
+[server.tls]
+enabled = false
+
+[[users]]
+name = "admin"
+`
+
+const mergeOverlay = `
+tags = ["c"]
+
+[server]
+port = 8080
+
+[server.tls]
+cert = "cert.pem"
+
+[[users]]
+name = "guest"
+`
+
+func loadMergeTrees(t *testing.T) (*Tree, *Tree) {
+	base, err := Load(mergeBase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlay, err := Load(mergeOverlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base, overlay
+}
+
+func TestMerge(t *testing.T) {
+	base, overlay := loadMergeTrees(t)
+	merged := Merge(base, overlay)
+
+	expected := map[string]interface{}{
+		"title": "base",
+		"tags":  []interface{}{"c"},
+		"server": map[string]interface{}{
+			"host": "localhost",
+			"port": int64(8080),
+			"tls": map[string]interface{}{
+				"enabled": false,
+				"cert":    "cert.pem",
+			},
+		},
+		"users": []interface{}{
+			map[string]interface{}{"name": "guest"},
+		},
+	}
+	if !reflect.DeepEqual(merged.ToMap(), expected) {
+		t.Errorf("expected %v, got %v", expected, merged.ToMap())
+	}
+
+	if base.Get("server.port") != int64(80) || base.Has("server.tls.cert") {
+		t.Error("the base tree should not be modified")
+	}
+	merged.Set("title", "changed")
+	if base.Get("title") != "base" {
+		t.Error("the merged tree should not share values with the base tree")
+	}
+}
+
+func TestMergeWithOptions(t *testing.T) {
+	base, overlay := loadMergeTrees(t)
+	merged := MergeWithOptions(base, overlay, MergeOptions{Arrays: ArraysAppend, Tables: TablesReplace})
+
+	expected := map[string]interface{}{
+		"title": "base",
+		"tags":  []interface{}{"a", "b", "c"},
+		"server": map[string]interface{}{
+			"port": int64(8080),
+			"tls": map[string]interface{}{
+				"cert": "cert.pem",
+			},
+		},
+		"users": []interface{}{
+			map[string]interface{}{"name": "admin"},
+			map[string]interface{}{"name": "guest"},
+		},
+	}
+	if !reflect.DeepEqual(merged.ToMap(), expected) {
+		t.Errorf("expected %v, got %v", expected, merged.ToMap())
+	}
+}
+
+func TestMergeMaps(t *testing.T) {
+	base := map[string]interface{}{
+		"a": map[string]interface{}{"x": 1, "y": 2},
+		"b": []string{"one"},
+		"c": "base",
+	}
+	overlay := map[string]interface{}{
+		"a": map[string]interface{}{"y": 3},
+		"b": []string{"two"},
+		"d": true,
+	}
+
+	merged := MergeMaps(base, overlay)
+	expected := map[string]interface{}{
+		"a": map[string]interface{}{"x": 1, "y": 3},
+		"b": []string{"two"},
+		"c": "base",
+		"d": true,
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected %v, got %v", expected, merged)
+	}
+	if base["a"].(map[string]interface{})["y"] != 2 {
+		t.Error("the base map should not be modified")
+	}
+
+	merged = MergeMapsWithOptions(base, overlay, MergeOptions{Arrays: ArraysAppend})
+	if !reflect.DeepEqual(merged["b"], []string{"one", "two"}) {
+		t.Errorf("arrays should be appended, got %v", merged["b"])
+	}
+	merged = MergeMapsWithOptions(base, map[string]interface{}{"b": []interface{}{2}}, MergeOptions{Arrays: ArraysAppend})
+	if !reflect.DeepEqual(merged["b"], []interface{}{"one", 2}) {
+		t.Errorf("arrays of different types should be appended, got %v", merged["b"])
+	}
+}
+
+func TestMergeSources(t *testing.T) {
+	base, overlay := loadMergeTrees(t)
+	base.SetSource("base.toml")
+	overlay.SetSource("overlay.toml")
+	local, err := Load("[server]\nhost = \"example.com\"\n[[users]]\nname = \"root\"")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local.SetSource("local.toml")
+	merged := MergeWithOptions(Merge(base, overlay), local, MergeOptions{Arrays: ArraysAppend})
+
+	m := merged.MetaData()
+	for _, test := range []struct {
+		key    []string
+		source string
+	}{
+		{[]string{"title"}, "base.toml"},
+		{[]string{"tags"}, "overlay.toml"},
+		{[]string{"server"}, "base.toml"},
+		{[]string{"server", "host"}, "local.toml"},
+		{[]string{"server", "port"}, "overlay.toml"},
+		{[]string{"server", "tls", "enabled"}, "base.toml"},
+		{[]string{"server", "tls", "cert"}, "overlay.toml"},
+		{[]string{"users", "name"}, "local.toml"},
+		{[]string{"missing"}, ""},
+		{[]string{"title", "missing"}, ""},
+	} {
+		if source := m.Source(test.key...); source != test.source {
+			t.Errorf("expected %v to come from %q, got %q", test.key, test.source, source)
+		}
+	}
+	if users := merged.Get("users").([]*Tree); len(users) != 2 || users[0].GetSource("name") != "overlay.toml" {
+		t.Errorf("unexpected users %v", users)
+	}
+	if base.GetSource("server.port") != "base.toml" || overlay.GetSource("server.port") != "overlay.toml" {
+		t.Error("the merged trees should not be modified")
+	}
+}
@@ -0,0 +1,162 @@
+// TOML types and positions of the keys of decoded documents.
+
+package toml
+
+import "reflect"
+
+// MetaData describes the keys of a document read by a Decoder and their TOML
+// types, which are lost once decoded into interface{} or into Go types that
+// accept several TOML types: a validation layer can tell port = "8080" from
+// port = 8080.
+type MetaData struct {
+	tree      *Tree
+	fields    map[interface{}]fieldSource
+	coercions []Coercion
+}
+
+// Key and position of the value decoded into a struct field.
+type fieldSource struct {
+	key      Key
+	position Position
+	value    *tomlValue // value of the document, nil for tables and arrays of tables
+}
+
+// Style of a value in the document it was parsed from, beyond its base.
+type valueStyle struct {
+	grouping int  // size of the digit groups of integers written with underscores
+	literal  bool // whether a string is a literal string
+}
+
+// MetaData returns the description of the document read by the last call to
+// Decode or DecodeAt. The whole document is described, even if only a table
+// of it was decoded.
+func (d *Decoder) MetaData() MetaData {
+	return MetaData{tree: d.document, fields: d.fields, coercions: d.coercions}
+}
+
+// Record the source of the value decoded into the struct field fval.
+func (d *Decoder) recordField(fval reflect.Value, pos Position, node interface{}) {
+	if d.document == nil || !fval.CanAddr() || !fval.Addr().CanInterface() {
+		return
+	}
+	if d.fields == nil {
+		d.fields = map[interface{}]fieldSource{}
+	}
+	value, _ := node.(*tomlValue)
+	d.fields[fval.Addr().Interface()] = fieldSource{key: d.path.Append(), position: pos, value: value}
+}
+
+// Value of the document the struct field fval was decoded from, if the encoder
+// preserves the style of the decoder that did.
+func (e *Encoder) styleSource(fval reflect.Value) *tomlValue {
+	if e.styles == nil || !fval.CanAddr() || !fval.Addr().CanInterface() {
+		return nil
+	}
+	return e.styles[fval.Addr().Interface()].value
+}
+
+// Give val, the encoded value of a field decoded from source, the style of
+// source if it still is of the same type, and return whether it is to be
+// written as a literal string, literal being the default.
+func withStyle(val interface{}, source *tomlValue, literal bool) (interface{}, bool) {
+	tv, wrapped := val.(*tomlValue)
+	if wrapped {
+		val = tv.value
+	}
+	switch source.value.(type) {
+	case int64, uint64:
+		switch val.(type) {
+		case int64, uint64:
+			if !wrapped {
+				tv = &tomlValue{value: val}
+			}
+			tv.base, tv.grouping = source.base, source.style.grouping
+			return tv, literal
+		}
+	case string:
+		if _, ok := val.(string); ok {
+			literal = source.style.literal
+		}
+	}
+	if wrapped {
+		return tv, literal
+	}
+	return val, literal
+}
+
+// Keys returns the complete keys defined in the document, in the order of the
+// document, tables before their keys. Keys of arrays of tables are listed
+// once, whatever the number of tables defining them.
+func (m MetaData) Keys() []Key {
+	if m.tree == nil {
+		return nil
+	}
+	var keys []Key
+	metaDataKeys(m.tree, Key{}, map[string]bool{}, &keys)
+	return keys
+}
+
+func metaDataKeys(t *Tree, prefix Key, seen map[string]bool, keys *[]Key) {
+	for _, node := range sortByLines(t) {
+		key := prefix.Append(node.key)
+		if s := key.String(); !seen[s] {
+			seen[s] = true
+			*keys = append(*keys, key)
+		}
+		switch v := t.values[node.key].(type) {
+		case *Tree:
+			metaDataKeys(v, key, seen, keys)
+		case []*Tree:
+			for _, t := range v {
+				metaDataKeys(t, key, seen, keys)
+			}
+		}
+	}
+}
+
+// IsDefined returns true if the key, given as its parts, is defined in the
+// document.
+func (m MetaData) IsDefined(key ...string) bool {
+	return m.Kind(key...) != KindInvalid
+}
+
+// Kind returns the TOML type of the value at key, given as its parts, or
+// KindInvalid if it is not defined. Arrays of tables are of kind KindArray,
+// and keys below them designate the keys of their last table.
+func (m MetaData) Kind(key ...string) Kind {
+	if m.tree == nil || len(key) == 0 {
+		return KindInvalid
+	}
+	v := m.tree.GetValuePath(key)
+	if v == nil {
+		return KindInvalid
+	}
+	return v.Kind()
+}
+
+// Position returns the position of the value at key, given as its parts, or
+// an invalid position if it is not defined. Keys below arrays of tables
+// designate the keys of their last table.
+func (m MetaData) Position(key ...string) Position {
+	if m.tree == nil || len(key) == 0 || m.tree.GetPath(key) == nil {
+		return Position{}
+	}
+	return m.tree.GetPositionPath(key)
+}
+
+// FieldPosition returns the key and the position of the value decoded into
+// the struct field pointed at by field, so that errors found validating a
+// decoded configuration can point at the document:
+//
+//	if c.Port > 65535 {
+//	  _, pos, _ := d.MetaData().FieldPosition(&c.Port)
+//	  return fmt.Errorf("config.toml:%d: port out of range", pos.Line)
+//	}
+//
+// The key includes the indexes of arrays, like servers.1.port. The last
+// return value is false if the field was not decoded from the document, or
+// if it was decoded into a copy of its struct, such as the values of maps.
+func (m MetaData) FieldPosition(field interface{}) (Key, Position, bool) {
+	source, ok := m.fields[field]
+	return source.key, source.position, ok
+}
@@ -0,0 +1,222 @@
+package toml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecoderMetaData(t *testing.T) {
+	doc := `title = "app"
+port = "8080"
+hosts = ["a", "b"]
+
+[server]
+port = 8080
+started = 1979-05-27T07:32:00Z
+tls = { enabled = true }
+
+[[routes]]
+path = "/a"
+
+[[routes]]
+path = "/b"
+weight = 1.5
+`
+	d := NewDecoder(strings.NewReader(doc))
+	var m map[string]interface{}
+	if err := d.Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	md := d.MetaData()
+
+	keys := []string{}
+	for _, k := range md.Keys() {
+		keys = append(keys, k.String())
+	}
+	expected := []string{"title", "port", "hosts", "server", "server.port", "server.started", "server.tls", "server.tls.enabled", "routes", "routes.path", "routes.weight"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected keys %v, got %v", expected, keys)
+	}
+
+	kinds := map[string]Kind{
+		"port":               KindString,
+		"server.port":        KindInteger,
+		"server.started":     KindOffsetDateTime,
+		"server.tls":         KindTable,
+		"server.tls.enabled": KindBool,
+		"hosts":              KindArray,
+		"routes":             KindArray,
+		"routes.weight":      KindFloat,
+		"server.host":        KindInvalid,
+	}
+	for key, kind := range kinds {
+		k, _ := ParseKey(key)
+		if md.Kind(k...) != kind {
+			t.Errorf("%s: expected %s, got %s", key, kind, md.Kind(k...))
+		}
+	}
+	if !md.IsDefined("server", "port") || md.IsDefined("server", "host") || md.IsDefined() {
+		t.Error("unexpected IsDefined results")
+	}
+
+	var server struct{ Port int }
+	d = NewDecoder(strings.NewReader(doc))
+	if err := d.DecodeAt("server", &server); err != nil {
+		t.Fatal(err)
+	}
+	if d.MetaData().Kind("port") != KindString {
+		t.Error("the whole document should be described")
+	}
+	if (MetaData{}).Keys() != nil || (MetaData{}).Kind("a") != KindInvalid {
+		t.Error("expected an empty description")
+	}
+}
+
+func TestMetaDataPositions(t *testing.T) {
+	type server struct {
+		Host string `toml:"host"`
+		Port int    `toml:"port"`
+	}
+	type config struct {
+		Title   string            `toml:"title"`
+		Main    *server           `toml:"main"`
+		Servers []server          `toml:"servers"`
+		Extra   map[string]server `toml:"extra"`
+		Unset   string            `toml:"unset"`
+	}
+	doc := `title = "app"
+
+[main]
+  port = 80
+
+[[servers]]
+host = "a"
+
+[[servers]]
+host = "b"
+port = 70000
+
+[extra.x]
+port = 1
+`
+	var c config
+	d := NewDecoder(strings.NewReader(doc))
+	if err := d.Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	m := d.MetaData()
+
+	for _, test := range []struct {
+		field interface{}
+		key   string
+		line  int
+		col   int
+	}{
+		{&c.Title, "title", 1, 1},
+		{&c.Main.Port, "main.port", 4, 3},
+		{&c.Servers[0].Host, "servers.0.host", 7, 1},
+		{&c.Servers[1].Port, "servers.1.port", 11, 1},
+	} {
+		key, pos, ok := m.FieldPosition(test.field)
+		if !ok || key.String() != test.key || pos.Line != test.line || pos.Col != test.col {
+			t.Errorf("expected %s at (%d, %d), got %s at %s (%v)", test.key, test.line, test.col, key, pos, ok)
+		}
+	}
+	for _, field := range []interface{}{&c.Unset, &c.Servers[0].Port, c.Main} {
+		if key, _, ok := m.FieldPosition(field); ok {
+			t.Errorf("unexpected key %s", key)
+		}
+	}
+
+	if pos := m.Position("servers", "port"); pos.Line != 11 {
+		t.Errorf("unexpected position %s", pos)
+	}
+	if pos := m.Position("extra", "x"); pos.Line != 13 {
+		t.Errorf("unexpected position %s", pos)
+	}
+	if pos := m.Position("missing"); !pos.Invalid() {
+		t.Errorf("unexpected position %s", pos)
+	}
+}
+
+func TestEncoderPreserveStyle(t *testing.T) {
+	type server struct {
+		Port    int    `toml:"port"`
+		Mask    uint32 `toml:"mask,hex"`
+		Pattern string `toml:"pattern"`
+	}
+	type config struct {
+		Size    int64       `toml:"size"`
+		Path    string      `toml:"path"`
+		Name    string      `toml:"name,literal"`
+		Mode    interface{} `toml:"mode"`
+		Limits  server      `toml:"limits"`
+		Servers []server    `toml:"servers"`
+	}
+	doc := `size = 1_000_000
+path = 'C:\Users'
+name = "app"
+mode = 0o755
+
+[limits]
+port = 0x1F90
+mask = 255
+pattern = '''\d+'''
+
+[[servers]]
+port = 80_80
+
+[[servers]]
+port = 9_090
+pattern = '.*'
+`
+	var c config
+	d := NewDecoder(strings.NewReader(doc))
+	if err := d.Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	c.Size *= 2
+	c.Path += `\me`
+	c.Mode = "rwx"
+	c.Limits.Port++
+	c.Servers[1].Port = 12345
+	c.Servers[1].Pattern = `\w`
+
+	var buf strings.Builder
+	if err := NewEncoder(&buf).PreserveStyle(d.MetaData()).Encode(&c); err != nil {
+		t.Fatal(err)
+	}
+	expected := `mode = "rwx"
+name = "app"
+path = 'C:\Users\me'
+size = 2_000_000
+
+[limits]
+  mask = 255
+  pattern = '\d+'
+  port = 0x1f91
+
+[[servers]]
+  mask = 0x0
+  pattern = ""
+  port = 80_80
+
+[[servers]]
+  mask = 0x0
+  pattern = '\w'
+  port = 12_345
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	// copies of the decoded structs are written with the default style
+	buf.Reset()
+	if err := NewEncoder(&buf).PreserveStyle(d.MetaData()).Encode(c.Limits); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "mask = 0xff\npattern = \"\\\\d+\"\nport = 8081\n"; buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
@@ -0,0 +1,40 @@
+//go:build go1.18
+// +build go1.18
+
+// Values that may be absent.
+
+package toml
+
+// Optional is a value that may be absent from a document, to tell a key set
+// to the zero value of its type from a missing key without using a pointer.
+// When unmarshaled, Present is set if the key is in the document, Value
+// being decoded as a field of type T. When marshaled, an Optional that is not
+// present is omitted.
+//
+//	type Config struct {
+//	  Port toml.Optional[int]
+//	}
+type Optional[T any] struct {
+	Value   T
+	Present bool
+}
+
+// Some returns a present Optional holding v.
+func Some[T any](v T) Optional[T] {
+	return Optional[T]{Value: v, Present: true}
+}
+
+// Get returns the value and whether it is present.
+func (o Optional[T]) Get() (T, bool) {
+	return o.Value, o.Present
+}
+
+// Or returns the value if it is present, fallback otherwise.
+func (o Optional[T]) Or(fallback T) T {
+	if o.Present {
+		return o.Value
+	}
+	return fallback
+}
+
+func (Optional[T]) isOptional() {}
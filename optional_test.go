@@ -0,0 +1,65 @@
+//go:build go1.18
+// +build go1.18
+
+package toml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOptional(t *testing.T) {
+	type server struct {
+		Host string `toml:"host"`
+	}
+	type config struct {
+		Port    Optional[int]      `toml:"port"`
+		Debug   Optional[bool]     `toml:"debug"`
+		Name    Optional[string]   `toml:"name"`
+		Tags    Optional[[]string] `toml:"tags"`
+		Server  Optional[server]   `toml:"server"`
+		Missing Optional[server]   `toml:"missing"`
+	}
+
+	var c config
+	err := Unmarshal([]byte(`port = 0
+tags = ["a"]
+
+[server]
+host = "localhost"
+`), &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := config{
+		Port:   Some(0),
+		Tags:   Some([]string{"a"}),
+		Server: Some(server{Host: "localhost"}),
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("expected %+v, got %+v", expected, c)
+	}
+	if port, ok := c.Port.Get(); !ok || port != 0 {
+		t.Errorf("unexpected port %d, %v", port, ok)
+	}
+	if name := c.Name.Or("default"); name != "default" {
+		t.Errorf("unexpected name %q", name)
+	}
+
+	b, err := Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedDoc := `port = 0
+tags = ["a"]
+
+[server]
+  host = "localhost"
+`
+	if string(b) != expectedDoc {
+		t.Errorf("expected:\n%s\ngot:\n%s", expectedDoc, b)
+	}
+
+	err = Unmarshal([]byte(`port = "80"`), &c)
+	assertErrorString(t, "(1, 1): Can't convert 80(string) to int", err)
+}
@@ -0,0 +1,152 @@
+// Ordered maps.
+
+package toml
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// KeyValue is an entry of an OrderedMap.
+type KeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+// OrderedMap is a table whose keys keep the order of the slice. It can be
+// marshaled wherever a map[string]interface{} can: with OrderPreserve, its
+// entries are written in the order of the slice rather than sorted. Values
+// may be any marshalable value, including OrderedMap and []OrderedMap.
+//
+// When unmarshaled, entries are in the order of the document. Tables are
+// decoded as OrderedMap, arrays of tables as []OrderedMap, and other values
+// as they would be in an interface{}. Decoding a document of unknown shape
+// into an OrderedMap and encoding it back with OrderPreserve keeps its keys in
+// order.
+type OrderedMap []KeyValue
+
+// Get returns the value of key, and whether it is present.
+func (m OrderedMap) Get(key string) (interface{}, bool) {
+	for _, kv := range m {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Set replaces the value of key, or appends it if it is not present.
+func (m *OrderedMap) Set(key string, value interface{}) {
+	for i := range *m {
+		if (*m)[i].Key == key {
+			(*m)[i].Value = value
+			return
+		}
+	}
+	*m = append(*m, KeyValue{Key: key, Value: value})
+}
+
+// Delete removes key, keeping the order of the other entries.
+func (m *OrderedMap) Delete(key string) {
+	for i := range *m {
+		if (*m)[i].Key == key {
+			*m = append((*m)[:i], (*m)[i+1:]...)
+			return
+		}
+	}
+}
+
+// Keys returns the keys in order.
+func (m OrderedMap) Keys() []string {
+	keys := make([]string, len(m))
+	for i, kv := range m {
+		keys[i] = kv.Key
+	}
+	return keys
+}
+
+var orderedMapType = reflect.TypeOf(OrderedMap{})
+
+// Convert an OrderedMap to a tree, wrapping the values in order so that their
+// positions reflect the order of the entries.
+func (e *Encoder) orderedMapToTree(mval reflect.Value) (*Tree, error) {
+	tval := e.nextTree()
+	seen := make(map[string]bool, mval.Len())
+	for i := 0; i < mval.Len(); i++ {
+		entry := mval.Index(i)
+		key, mvalf := entry.Field(0).String(), entry.Field(1)
+		if mvalf.IsNil() {
+			continue
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate key %s in OrderedMap", Key(e.path).Append(key))
+		}
+		seen[key] = true
+		e.path = append(e.path, key)
+		val, err := e.valueToToml(mvalf.Type(), mvalf)
+		e.path = e.path[:len(e.path)-1]
+		if err == errSkipValue {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		val = e.wrapTomlValue(val, tval)
+		if e.quoteMapKeys {
+			key, err = tomlValueStringRepresentation(key, "", "", e.order, e.arraysOneElementPerLine)
+			if err != nil {
+				return nil, err
+			}
+		}
+		tval.SetPath([]string{key}, val)
+	}
+	return tval, nil
+}
+
+// Convert a tree to an OrderedMap, with its keys in document order.
+func (d *Decoder) orderedMapFromTree(tval *Tree) (OrderedMap, error) {
+	nodes := sortByLines(tval)
+	result := make(OrderedMap, 0, len(nodes))
+	for _, node := range nodes {
+		value, err := d.orderedMapValue(tval.values[node.key])
+		if err != nil {
+			return nil, formatError(err, tval.GetPositionPath([]string{node.key}))
+		}
+		result = append(result, KeyValue{Key: node.key, Value: value})
+	}
+	return result, nil
+}
+
+func (d *Decoder) orderedMapValue(node interface{}) (interface{}, error) {
+	switch n := node.(type) {
+	case *Tree:
+		return d.orderedMapFromTree(n)
+	case []*Tree:
+		maps := make([]OrderedMap, len(n))
+		for i, tree := range n {
+			m, err := d.orderedMapFromTree(tree)
+			if err != nil {
+				return nil, err
+			}
+			maps[i] = m
+		}
+		return maps, nil
+	case *tomlValue:
+		return d.orderedMapValue(n.value)
+	case []interface{}:
+		array := make([]interface{}, len(n))
+		for i, element := range n {
+			value, err := d.orderedMapValue(element)
+			if err != nil {
+				return nil, err
+			}
+			array[i] = value
+		}
+		return array, nil
+	}
+	value, err := d.valueFromToml(reflect.TypeOf((*interface{})(nil)).Elem(), node, nil)
+	if err != nil {
+		return nil, err
+	}
+	return value.Interface(), nil
+}
@@ -0,0 +1,206 @@
+package toml
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+var orderedMapTestData = OrderedMap{
+	{"name", "example"},
+	{"version", 2},
+	{"authors", []string{"b", "a"}},
+	{"skipped", nil},
+	{"server", OrderedMap{
+		{"port", 8080},
+		{"host", "localhost"},
+	}},
+	{"bins", []OrderedMap{
+		{{"path", "main.go"}, {"name", "tool"}},
+	}},
+}
+
+func TestMarshalOrderedMap(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Order(OrderPreserve).Encode(orderedMapTestData); err != nil {
+		t.Fatal(err)
+	}
+	expected := `name = "example"
+version = 2
+authors = ["b", "a"]
+
+[server]
+  port = 8080
+  host = "localhost"
+
+[[bins]]
+  path = "main.go"
+  name = "tool"
+`
+	if buf.String() != expected {
+		t.Errorf("Bad marshal: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, buf.String())
+	}
+}
+
+func TestMarshalOrderedMapAlphabetical(t *testing.T) {
+	result, err := Marshal(orderedMapTestData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `authors = ["b", "a"]
+name = "example"
+version = 2
+
+[[bins]]
+  name = "tool"
+  path = "main.go"
+
+[server]
+  host = "localhost"
+  port = 8080
+`
+	if string(result) != expected {
+		t.Errorf("Bad marshal: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, result)
+	}
+}
+
+func TestMarshalOrderedMapInStruct(t *testing.T) {
+	type config struct {
+		Title string
+		Extra OrderedMap
+	}
+	var buf bytes.Buffer
+	err := NewEncoder(&buf).Order(OrderPreserve).Encode(config{
+		Title: "t",
+		Extra: OrderedMap{{"z", 1}, {"a", 2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `Title = "t"
+
+[Extra]
+  z = 1
+  a = 2
+`
+	if buf.String() != expected {
+		t.Errorf("Bad marshal: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, buf.String())
+	}
+}
+
+func TestMarshalOrderedMapDuplicateKey(t *testing.T) {
+	_, err := Marshal(OrderedMap{{"a", OrderedMap{{"b", 1}, {"b", 2}}}})
+	assertErrorString(t, "duplicate key a.b in OrderedMap", err)
+}
+
+func TestUnmarshalOrderedMap(t *testing.T) {
+	doc := []byte(`zeta = 1
+alpha = "two"
+mixed = [3, { y = 1, x = 2 }]
+
+[server]
+port = 8080
+host = "localhost"
+limits = { max = 10, min = 1 }
+
+[[bins]]
+path = "main.go"
+name = "tool"
+`)
+	var m OrderedMap
+	if err := Unmarshal(doc, &m); err != nil {
+		t.Fatal(err)
+	}
+	if keys := m.Keys(); !reflect.DeepEqual(keys, []string{"zeta", "alpha", "mixed", "server", "bins"}) {
+		t.Errorf("unexpected keys %v", keys)
+	}
+	server, _ := m.Get("server")
+	expectedServer := OrderedMap{
+		{"port", int64(8080)},
+		{"host", "localhost"},
+		{"limits", OrderedMap{{"max", int64(10)}, {"min", int64(1)}}},
+	}
+	if !reflect.DeepEqual(server, expectedServer) {
+		t.Errorf("expected %v, got %v", expectedServer, server)
+	}
+	mixed, _ := m.Get("mixed")
+	expectedMixed := []interface{}{int64(3), OrderedMap{{"y", int64(1)}, {"x", int64(2)}}}
+	if !reflect.DeepEqual(mixed, expectedMixed) {
+		t.Errorf("expected %v, got %v", expectedMixed, mixed)
+	}
+	bins, _ := m.Get("bins")
+	if expected := []OrderedMap{{{"path", "main.go"}, {"name", "tool"}}}; !reflect.DeepEqual(bins, expected) {
+		t.Errorf("expected %v, got %v", expected, bins)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Order(OrderPreserve).Indentation("").Encode(m); err != nil {
+		t.Fatal(err)
+	}
+	expected := `zeta = 1
+alpha = "two"
+mixed = [3, { y = 1, x = 2 }]
+
+[server]
+port = 8080
+host = "localhost"
+
+[server.limits]
+max = 10
+min = 1
+
+[[bins]]
+path = "main.go"
+name = "tool"
+`
+	if buf.String() != expected {
+		t.Errorf("Bad round trip: expected\n-----\n%s\n-----\ngot\n-----\n%s\n-----\n", expected, buf.String())
+	}
+}
+
+func TestUnmarshalOrderedMapField(t *testing.T) {
+	type config struct {
+		Name   string
+		Extra  OrderedMap
+		Others []OrderedMap
+	}
+	var c config
+	err := NewDecoder(bytes.NewReader([]byte(`name = "n"
+[extra]
+b = 1
+a = 2
+[[others]]
+d = 3
+c = 4
+`))).Strict(true).Decode(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := config{
+		Name:   "n",
+		Extra:  OrderedMap{{"b", int64(1)}, {"a", int64(2)}},
+		Others: []OrderedMap{{{"d", int64(3)}, {"c", int64(4)}}},
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("expected %v, got %v", expected, c)
+	}
+}
+
+func TestOrderedMapMethods(t *testing.T) {
+	var m OrderedMap
+	m.Set("b", 1)
+	m.Set("a", 2)
+	m.Set("b", 3)
+	m.Set("c", 4)
+	m.Delete("a")
+	m.Delete("missing")
+	if expected := (OrderedMap{{"b", 3}, {"c", 4}}); !reflect.DeepEqual(m, expected) {
+		t.Errorf("expected %v, got %v", expected, m)
+	}
+	if v, ok := m.Get("c"); !ok || v != 4 {
+		t.Errorf("unexpected value %v", v)
+	}
+	if _, ok := m.Get("a"); ok {
+		t.Error("a should have been deleted")
+	}
+}
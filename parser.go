@@ -3,6 +3,7 @@
 package toml
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math"
@@ -10,18 +11,122 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type tomlParser struct {
-	flowIdx       int
-	flow          []token
-	tree          *Tree
-	currentTable  []string
-	seenTableKeys []string
+	flowIdx        int
+	flow           []token
+	tree           *Tree
+	currentTable   []string
+	seenTableKeys  []string
+	tablePositions map[string]Position
+	duplicates     DuplicateKeyPolicy
+	arrayPositions []Position // positions of the elements of the last parsed array
+	base           int        // base of the last parsed integer
+	grouping       int        // size of the digit groups of the last parsed integer
+	literal        bool       // whether the last parsed string is a literal string
+	src            []byte     // document the tokens are read from
+	lineStarts     []int      // offsets of the lines of src, computed when needed
+	options        parseOptions
+	depth          int // nesting of the arrays and inline tables being parsed
+	keys           int // number of keys and tables parsed
+	// key strings of the document, so that the keys repeated in many tables,
+	// such as those of large arrays of tables, share their storage
+	interned map[string]string
+}
+
+// Options of the parser: the version of the specification to enforce, and
+// limits for untrusted input, zero meaning no limit.
+type parseOptions struct {
+	version        TOMLVersion
+	ctx            context.Context
+	maxDepth       int
+	maxArrayLength int
+	maxKeys        int
+	latin1         bool // decode invalid UTF-8 bytes as Latin-1
+	normalizeKeys  bool // normalize keys to NFC
+}
+
+// Count a key or a table at tok against the limits. depth is the nesting of
+// the table holding the key, or of the table itself, the root being at depth 1
+// as for the Decoder.
+func (p *tomlParser) checkKey(tok *token, depth int) {
+	p.keys++
+	if max := p.options.maxKeys; max > 0 && p.keys > max {
+		p.raiseError(tok, "maximum number of keys of %d exceeded", max)
+	}
+	p.checkDepth(tok, depth)
+}
+
+func (p *tomlParser) checkDepth(tok *token, depth int) {
+	if max := p.options.maxDepth; max > 0 && depth > max {
+		p.raiseError(tok, "maximum depth of %d exceeded", max)
+	}
+}
+
+// DuplicateKeyPolicy defines how keys and tables defined more than once in a
+// document are handled.
+type DuplicateKeyPolicy int
+
+const (
+	// DuplicateKeysError rejects documents redefining a key or a table, as
+	// required by the specification.
+	DuplicateKeysError DuplicateKeyPolicy = iota
+	// DuplicateKeysFirstWins keeps the first value of a key defined more
+	// than once.
+	DuplicateKeysFirstWins
+	// DuplicateKeysLastWins keeps the last value of a key defined more than
+	// once.
+	DuplicateKeysLastWins
+)
+
+// DuplicateKeyError is the error returned when a document defines a key or a
+// table more than once under the DuplicateKeysError policy.
+type DuplicateKeyError struct {
+	Key      Key      // full path of the key
+	Position Position // position of the duplicate definition
+	Previous Position // position of the first definition
+	message  string
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("%s: %s (previously defined at %s)", e.Position, e.message, e.Previous)
 }
 
 type tomlParserStateFn func() tomlParserStateFn
 
+// Split the key s into its parts, normalized if the parser is configured to.
+func (p *tomlParser) parseKey(s string) ([]string, error) {
+	var keys []string
+	var err error
+	if isBareKey(s) {
+		// the common case of a key made of a single bare key
+		keys = []string{s}
+	} else {
+		keys, err = parseKey(s)
+	}
+	for i, k := range keys {
+		if p.options.normalizeKeys {
+			k = normalizeNFC(k)
+		}
+		keys[i] = p.intern(k)
+	}
+	return keys, err
+}
+
+// Return the first occurrence of the key s in the document.
+func (p *tomlParser) intern(s string) string {
+	if interned, ok := p.interned[s]; ok {
+		return interned
+	}
+	if p.interned == nil {
+		p.interned = make(map[string]string)
+	}
+	p.interned[s] = s
+	return s
+}
+
 // Formats and panics an error message based on a token
 func (p *tomlParser) raiseError(tok *token, msg string, args ...interface{}) {
 	panic(tok.Position.String() + ": " + fmt.Sprintf(msg, args...))
@@ -60,6 +165,11 @@ func (p *tomlParser) getToken() *token {
 }
 
 func (p *tomlParser) parseStart() tomlParserStateFn {
+	if ctx := p.options.ctx; ctx != nil {
+		if err := ctx.Err(); err != nil {
+			panic(err)
+		}
+	}
 	tok := p.peek()
 
 	// end of stream, parsing is finished
@@ -92,10 +202,11 @@ func (p *tomlParser) parseGroupArray() tomlParserStateFn {
 	}
 
 	// get or create table array element at the indicated part in the path
-	keys, err := parseKey(key.val)
+	keys, err := p.parseKey(key.val)
 	if err != nil {
 		p.raiseError(key, "invalid table array key: %s", err)
 	}
+	p.checkKey(startToken, len(keys)+1)
 	p.tree.createSubTree(keys[:len(keys)-1], startToken.Position) // create parent entries
 	destTree := p.tree.GetPath(keys)
 	var array []*Tree
@@ -112,6 +223,9 @@ func (p *tomlParser) parseGroupArray() tomlParserStateFn {
 	newTree := newTree()
 	newTree.position = startToken.Position
 	array = append(array, newTree)
+	if max := p.options.maxArrayLength; max > 0 && len(array) > max {
+		p.raiseError(key, "maximum array length of %d exceeded", max)
+	}
 	p.tree.SetPath(p.currentTable, array)
 
 	// remove all keys that were children of this table array
@@ -143,16 +257,28 @@ func (p *tomlParser) parseGroup() tomlParserStateFn {
 	if key.typ != tokenKeyGroup {
 		p.raiseError(key, "unexpected token %s, was expecting a table key", key)
 	}
+	keys, err := p.parseKey(key.val)
+	if err != nil {
+		p.raiseError(key, "invalid table array key: %s", err)
+	}
+	p.checkKey(startToken, len(keys)+1)
+	duplicate := false
 	for _, item := range p.seenTableKeys {
 		if item == key.val {
-			p.raiseError(key, "duplicated tables")
+			duplicate = true
 		}
 	}
-
-	p.seenTableKeys = append(p.seenTableKeys, key.val)
-	keys, err := parseKey(key.val)
-	if err != nil {
-		p.raiseError(key, "invalid table array key: %s", err)
+	if !duplicate {
+		p.seenTableKeys = append(p.seenTableKeys, key.val)
+		p.tablePositions[key.val] = key.Position
+	} else if p.duplicates == DuplicateKeysError {
+		// redefined tables are merged under the lenient policies
+		panic(&DuplicateKeyError{
+			Key:      keys,
+			Position: key.Position,
+			Previous: p.tablePositions[key.val],
+			message:  "duplicated tables",
+		})
 	}
 	if err := p.tree.createSubTree(keys, startToken.Position); err != nil {
 		p.raiseError(key, "%s", err)
@@ -171,11 +297,13 @@ func (p *tomlParser) parseAssign() tomlParserStateFn {
 	key := p.getToken()
 	p.assume(tokenEqual)
 
-	parsedKey, err := parseKey(key.val)
+	parsedKey, err := p.parseKey(key.val)
 	if err != nil {
 		p.raiseError(key, "invalid key: %s", err.Error())
 	}
+	p.checkKey(key, len(p.currentTable)+len(parsedKey))
 
+	p.arrayPositions = nil
 	value := p.parseRvalue()
 	var tableKey []string
 	if len(p.currentTable) > 0 {
@@ -215,16 +343,29 @@ func (p *tomlParser) parseAssign() tomlParserStateFn {
 	localKey := []string{keyVal}
 	finalKey := append(tableKey, keyVal)
 	if targetNode.GetPath(localKey) != nil {
-		p.raiseError(key, "The following key was defined twice: %s",
-			strings.Join(finalKey, "."))
+		switch p.duplicates {
+		case DuplicateKeysFirstWins:
+			return p.parseStart
+		case DuplicateKeysError:
+			panic(&DuplicateKeyError{
+				Key:      finalKey,
+				Position: key.Position,
+				Previous: targetNode.GetPositionPath(localKey),
+				message:  "The following key was defined twice: " + strings.Join(finalKey, "."),
+			})
+		}
 	}
 	var toInsert interface{}
 
-	switch value.(type) {
-	case *Tree, []*Tree:
+	switch v := value.(type) {
+	case *Tree:
+		// inline tables are located at their key
+		v.position = key.Position
+		toInsert = value
+	case []*Tree:
 		toInsert = value
 	default:
-		toInsert = &tomlValue{value: value, position: key.Position}
+		toInsert = &tomlValue{value: value, position: key.Position, elementPositions: p.arrayPositions, base: p.integerBase(value), style: p.style(value)}
 	}
 	targetNode.values[keyVal] = toInsert
 	return p.parseStart
@@ -279,6 +420,7 @@ func (p *tomlParser) parseRvalue() interface{} {
 
 	switch tok.typ {
 	case tokenString:
+		p.literal = p.isLiteralString(tok)
 		return tok.val
 	case tokenTrue:
 		return true
@@ -316,6 +458,12 @@ func (p *tomlParser) parseRvalue() interface{} {
 			p.raiseError(tok, "%s", err)
 		}
 
+		if base != 10 {
+			p.base = base
+		} else {
+			p.base = 0
+		}
+		p.grouping = digitGrouping(tok.val)
 		var val interface{}
 		val, err = strconv.ParseInt(s, base, 64)
 		if err == nil {
@@ -327,6 +475,9 @@ func (p *tomlParser) parseRvalue() interface{} {
 				return val
 			}
 		}
+		if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+			p.raiseError(tok, "integer %s does not fit in 64 bits: write it as a string to decode it into a big.Int", tok.val)
+		}
 		p.raiseError(tok, "%s", err)
 	case tokenFloat:
 		err := numberContainsInvalidUnderscore(tok.val)
@@ -396,12 +547,74 @@ func (p *tomlParser) parseRvalue() interface{} {
 	return nil
 }
 
+// Base value was written in, if it is the integer that was just parsed and
+// was not written in base 10, so that it is written back the same way.
+func (p *tomlParser) integerBase(value interface{}) int {
+	switch value.(type) {
+	case int64, uint64:
+		return p.base
+	}
+	return 0
+}
+
+// Style of the value that was just parsed: the digit groups of integers and
+// the quoting of strings.
+func (p *tomlParser) style(value interface{}) valueStyle {
+	switch value.(type) {
+	case int64, uint64:
+		return valueStyle{grouping: p.grouping}
+	case string:
+		return valueStyle{literal: p.literal}
+	}
+	return valueStyle{}
+}
+
+// Whether the string token tok was written as a literal string. String tokens
+// start after their opening quotes, and after the newline following the quotes
+// of multiline strings.
+func (p *tomlParser) isLiteralString(tok *token) bool {
+	if p.src == nil {
+		return false
+	}
+	if p.lineStarts == nil {
+		p.lineStarts = lineStarts(p.src)
+	}
+	if tok.Line < 1 || tok.Line > len(p.lineStarts) {
+		return false
+	}
+	off := p.lineStarts[tok.Line-1]
+	for col := 1; col < tok.Col && off < len(p.src); col++ {
+		_, size := utf8.DecodeRune(p.src[off:])
+		off += size
+	}
+	if off > 0 && p.src[off-1] == '\n' {
+		off--
+		if off > 0 && p.src[off-1] == '\r' {
+			off--
+		}
+	}
+	return off > 0 && p.src[off-1] == '\''
+}
+
+// Size of the digit groups of an integer written with underscores, such as 3
+// for 1_000_000, taken from its last group; 0 if it has no underscores.
+func digitGrouping(s string) int {
+	i := strings.LastIndexByte(s, '_')
+	if i < 0 {
+		return 0
+	}
+	return len(s) - i - 1
+}
+
 func tokenIsComma(t *token) bool {
 	return t != nil && t.typ == tokenComma
 }
 
 func (p *tomlParser) parseInlineTable() *Tree {
+	p.depth++
+	defer func() { p.depth-- }()
 	tree := newTree()
+	positions := map[string]Position{}
 	var previous *token
 Loop:
 	for {
@@ -420,13 +633,42 @@ Loop:
 			key := p.getToken()
 			p.assume(tokenEqual)
 
-			parsedKey, err := parseKey(key.val)
+			parsedKey, err := p.parseKey(key.val)
 			if err != nil {
 				p.raiseError(key, "invalid key: %s", err)
 			}
+			p.checkKey(key, p.depth+len(parsedKey))
 
 			value := p.parseRvalue()
+			if base, style := p.integerBase(value), p.style(value); base != 0 || style != (valueStyle{}) {
+				value = &tomlValue{value: value, base: base, style: style}
+			}
+			id := strings.Join(parsedKey, "\x00")
+			if previousPosition, ok := positions[id]; ok {
+				if p.duplicates == DuplicateKeysError {
+					panic(&DuplicateKeyError{
+						Key:      parsedKey,
+						Position: key.Position,
+						Previous: previousPosition,
+						message:  "The following key was defined twice: " + strings.Join(parsedKey, "."),
+					})
+				}
+				if p.duplicates == DuplicateKeysFirstWins {
+					previous = follow
+					continue
+				}
+			} else {
+				positions[id] = key.Position
+			}
+			created := len(parsedKey)
+			for created > 1 && !tree.HasPath(parsedKey[:created-1]) {
+				created--
+			}
 			tree.SetPath(parsedKey, value)
+			// locate the value and the tables created for it at the key
+			for i := created; i <= len(parsedKey); i++ {
+				tree.SetPositionPath(parsedKey[:i], key.Position)
+			}
 		case tokenComma:
 			if tokenIsComma(previous) {
 				p.raiseError(follow, "need field between two commas in inline table")
@@ -437,7 +679,7 @@ Loop:
 		}
 		previous = follow
 	}
-	if tokenIsComma(previous) {
+	if tokenIsComma(previous) && p.options.version < TOML11 {
 		p.raiseError(previous, "trailing comma at the end of inline table")
 	}
 	tree.inline = true
@@ -445,7 +687,10 @@ Loop:
 }
 
 func (p *tomlParser) parseArray() interface{} {
+	p.depth++
+	defer func() { p.depth-- }()
 	var array []interface{}
+	var positions []Position
 	arrayType := reflect.TypeOf(newTree())
 	for {
 		follow := p.peek()
@@ -456,6 +701,11 @@ func (p *tomlParser) parseArray() interface{} {
 			p.getToken()
 			break
 		}
+		p.checkDepth(follow, p.depth)
+		if max := p.options.maxArrayLength; max > 0 && len(array) >= max {
+			p.raiseError(follow, "maximum array length of %d exceeded", max)
+		}
+		positions = append(positions, follow.Position)
 		val := p.parseRvalue()
 		if reflect.TypeOf(val) != arrayType {
 			arrayType = nil
@@ -489,18 +739,23 @@ func (p *tomlParser) parseArray() interface{} {
 		}
 		return tomlArray
 	}
+	p.arrayPositions = positions
 	return array
 }
 
-func parseToml(flow []token) *Tree {
+func parseToml(src []byte, flow []token, duplicates DuplicateKeyPolicy, options parseOptions) *Tree {
 	result := newTree()
 	result.position = Position{1, 1}
 	parser := &tomlParser{
-		flowIdx:       0,
-		flow:          flow,
-		tree:          result,
-		currentTable:  make([]string, 0),
-		seenTableKeys: make([]string, 0),
+		flowIdx:        0,
+		flow:           flow,
+		src:            src,
+		tree:           result,
+		currentTable:   make([]string, 0),
+		seenTableKeys:  make([]string, 0),
+		tablePositions: make(map[string]Position),
+		duplicates:     duplicates,
+		options:        options,
 	}
 	parser.run()
 	return result
@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"testing"
 	"time"
+	"unsafe"
 )
 
 func assertSubTree(t *testing.T, path []string, tree *Tree, err error, ref map[string]interface{}) {
@@ -272,6 +273,25 @@ func TestLocalDate(t *testing.T) {
 	})
 }
 
+func TestLocalDateFollowedByDelimiters(t *testing.T) {
+	date := LocalDate{Year: 1979, Month: 5, Day: 27}
+	tree, err := Load("a = 1979-05-27\r\nb = [1979-05-27, 1979-05-27]\nc = { d = 1979-05-27 }\n")
+	assertTree(t, tree, err, map[string]interface{}{
+		"a": date,
+		"b": []interface{}{date, date},
+		"c": map[string]interface{}{
+			"d": date,
+		},
+	})
+}
+
+func TestLowercaseDateTimeSeparators(t *testing.T) {
+	tree, err := Load("a = 1979-05-27t07:32:00z")
+	assertTree(t, tree, err, map[string]interface{}{
+		"a": time.Date(1979, time.May, 27, 7, 32, 0, 0, time.UTC),
+	})
+}
+
 func TestLocalDateError(t *testing.T) {
 	_, err := Load("a = 2020-09-31")
 	if err == nil {
@@ -749,14 +769,21 @@ func TestReDefineInlineTable(t *testing.T) {
 
 func TestDuplicateGroups(t *testing.T) {
 	_, err := Load("[foo]\na=2\n[foo]b=3")
-	if err.Error() != "(3, 2): duplicated tables" {
+	if err.Error() != "(3, 2): duplicated tables (previously defined at (1, 2))" {
 		t.Error("Bad error message:", err.Error())
 	}
 }
 
+func TestDuplicateKeysInInlineTable(t *testing.T) {
+	_, err := Load("a = { b = 1, c = 2, b = 3 }")
+	if err == nil || err.Error() != "(1, 21): The following key was defined twice: b (previously defined at (1, 7))" {
+		t.Error("Bad error message:", err)
+	}
+}
+
 func TestDuplicateKeys(t *testing.T) {
 	_, err := Load("foo = 2\nfoo = 3")
-	if err.Error() != "(2, 1): The following key was defined twice: foo" {
+	if err.Error() != "(2, 1): The following key was defined twice: foo (previously defined at (1, 1))" {
 		t.Error("Bad error message:", err.Error())
 	}
 }
@@ -837,6 +864,9 @@ func TestParseFile(t *testing.T) {
 			"score": 4e-08,
 		},
 	})
+	if source := tree.GetSource("owner.name"); source != "example.toml" {
+		t.Errorf("unexpected source %q", source)
+	}
 }
 
 func TestParseFileCRLF(t *testing.T) {
@@ -1169,3 +1199,25 @@ func TestUint(t *testing.T) {
 		"hello": uint64(math.MaxUint64),
 	})
 }
+
+func TestParseInternsKeys(t *testing.T) {
+	tree, err := Load("[[rows]]\nid = 1\n\"a.b\" = 1\n[[rows]]\nid = 2\n\"a.b\" = 2\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := func(row *Tree, key string) uintptr {
+		for k := range row.values {
+			if k == key {
+				return (*reflect.StringHeader)(unsafe.Pointer(&k)).Data
+			}
+		}
+		t.Fatalf("missing key %q", key)
+		return 0
+	}
+	rows := tree.Get("rows").([]*Tree)
+	for _, key := range []string{"id", "a.b"} {
+		if data(rows[0], key) != data(rows[1], key) {
+			t.Errorf("key %q not shared by the tables", key)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// Reuse of the buffers of encoders, decoders and the lexer.
+
+package toml
+
+import (
+	"bytes"
+	"sync"
+)
+
+// Buffers grown beyond these sizes, by a large document, are not reused, so
+// that the memory they hold can be freed.
+const (
+	maxPooledBufferSize = 64 << 10
+	maxPooledTokens     = 4096
+)
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBufferSize {
+		bufferPool.Put(buf)
+	}
+}
+
+// Token slices of the lexer. Pointers to slices are pooled, as putting a
+// slice in an interface would allocate.
+var tokensPool = sync.Pool{
+	New: func() interface{} {
+		tokens := make([]token, 0, 256)
+		return &tokens
+	},
+}
+
+func getTokens() []token {
+	return (*tokensPool.Get().(*[]token))[:0]
+}
+
+// Return the tokens to the pool once they are no longer used. Their values
+// are cleared, so that the pool does not keep the input alive.
+func putTokens(tokens []token) {
+	if cap(tokens) > maxPooledTokens {
+		return
+	}
+	for i := range tokens {
+		tokens[i] = token{}
+	}
+	tokens = tokens[:0]
+	tokensPool.Put(&tokens)
+}
+
+// Encoders used by Marshal, which never sets options on them.
+var encoderPool = sync.Pool{
+	New: func() interface{} { return NewEncoder(nil) },
+}
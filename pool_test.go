@@ -0,0 +1,109 @@
+package toml
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type pooledConfig struct {
+	Name string   `toml:"name"`
+	Port int      `toml:"port"`
+	Tags []string `toml:"tags"`
+}
+
+var (
+	pooledValue    = pooledConfig{Name: "a", Port: 8080, Tags: []string{"x", "y"}}
+	pooledDocument = []byte("name = \"a\"\nport = 8080\ntags = [\"x\", \"y\"]\n")
+)
+
+func TestEncoderReset(t *testing.T) {
+	var first, second bytes.Buffer
+	e := NewEncoder(&first).ArraysWithOneElementPerLine(true)
+	if err := e.Encode(pooledValue); err != nil {
+		t.Fatal(err)
+	}
+	e.Reset(&second)
+	if err := e.Encode(pooledValue); err != nil {
+		t.Fatal(err)
+	}
+	if first.String() != second.String() {
+		t.Errorf("expected:\n%s\ngot:\n%s", first.String(), second.String())
+	}
+	if !strings.Contains(second.String(), "tags = [\n") {
+		t.Errorf("options should be kept by Reset, got:\n%s", second.String())
+	}
+}
+
+func TestDecoderReset(t *testing.T) {
+	d := NewDecoder(strings.NewReader("name = \"a\"\nunknown = 1\n")).Strict(true)
+	var c pooledConfig
+	if err := d.Decode(&c); err == nil {
+		t.Fatal("expected an error for the unknown key")
+	}
+	d.Reset(bytes.NewReader(pooledDocument))
+	c = pooledConfig{}
+	if err := d.Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "a" || c.Port != 8080 || len(c.Tags) != 2 {
+		t.Errorf("unexpected value %+v", c)
+	}
+	d.Reset(strings.NewReader("name = \"a\"\nunknown = 1\n"))
+	if err := d.Decode(&c); err == nil {
+		t.Error("options should be kept by Reset")
+	}
+}
+
+func TestMarshalReentrant(t *testing.T) {
+	// Marshal called from a marshaler uses its own pooled encoder and buffer.
+	b, err := Marshal(reentrantMarshaler{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "inner = 1\n" {
+		t.Errorf("unexpected output %q", b)
+	}
+}
+
+type reentrantMarshaler struct{}
+
+func (reentrantMarshaler) MarshalTOML() ([]byte, error) {
+	return Marshal(map[string]int{"inner": 1})
+}
+
+func BenchmarkMarshalSmall(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(pooledValue); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncoderReset(b *testing.B) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		e.Reset(&buf)
+		if err := e.Encode(pooledValue); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecoderReset(b *testing.B) {
+	r := bytes.NewReader(pooledDocument)
+	d := NewDecoder(r)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.Reset(pooledDocument)
+		d.Reset(r)
+		var c pooledConfig
+		if err := d.Decode(&c); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
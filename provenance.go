@@ -0,0 +1,101 @@
+// Documents the values of trees come from, across merges.
+
+package toml
+
+import "strings"
+
+// SetSource names the document t was loaded from, such as the path of its
+// file, which LoadFile sets. Merge records the source of each value of the
+// trees it merges, so that layered configurations can tell where a setting is
+// defined.
+func (t *Tree) SetSource(name string) {
+	t.source = name
+}
+
+// GetSource returns the name of the document the value at key comes from, as
+// set by SetSource on the tree it was loaded in, or an empty string if it is
+// unknown. The key is a dot-separated path (e.g. a.b.c) without single or
+// double quoted strings.
+//
+// See GetSourcePath for details.
+func (t *Tree) GetSource(key string) string {
+	if key == "" {
+		return t.source
+	}
+	return t.GetSourcePath(strings.Split(key, "."))
+}
+
+// GetSourcePath returns the name of the document the value at the path
+// indicated by keys comes from, or an empty string if it is unknown. Keys
+// below arrays of tables designate the keys of their last table. Tables
+// present in several merged documents come from the first one defining them,
+// and arrays appended to one another from the last one.
+func (t *Tree) GetSourcePath(keys []string) string {
+	source := t.source
+	var node interface{} = t
+	for _, key := range keys {
+		tree, ok := node.(*Tree)
+		if !ok {
+			return ""
+		}
+		node = tree.values[key]
+		if trees, ok := node.([]*Tree); ok && len(trees) > 0 {
+			node = trees[len(trees)-1]
+		}
+		if s := nodeSource(node); s != "" {
+			source = s
+		}
+	}
+	if node == nil {
+		return ""
+	}
+	return source
+}
+
+// MetaData returns the description of the keys of t, as a Decoder would of
+// the document of t, so that merged trees can be described with the sources
+// of their keys.
+func (t *Tree) MetaData() MetaData {
+	return MetaData{tree: t}
+}
+
+// Source returns the name of the document the value at key, given as its
+// parts, comes from, or an empty string if it is unknown or not defined. It is
+// only known for trees loaded by LoadFile or named with SetSource, and for the
+// trees Merge makes of them.
+func (m MetaData) Source(key ...string) string {
+	if m.tree == nil || len(key) == 0 {
+		return ""
+	}
+	return m.tree.GetSourcePath(key)
+}
+
+// Source recorded in a node of a tree, if any.
+func nodeSource(node interface{}) string {
+	switch n := node.(type) {
+	case *Tree:
+		return n.source
+	case *tomlValue:
+		return n.source
+	}
+	return ""
+}
+
+// Record that node, copied from a document named source, comes from it unless
+// it already records its own source.
+func setNodeSource(node interface{}, source string) {
+	switch n := node.(type) {
+	case *Tree:
+		if n.source == "" {
+			n.source = source
+		}
+	case []*Tree:
+		for _, tree := range n {
+			setNodeSource(tree, source)
+		}
+	case *tomlValue:
+		if n.source == "" {
+			n.source = source
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Adapters for configuration libraries.
+
+package toml
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// Provider reads the configuration in a TOML file. It implements the
+// Provider interface of koanf, and the Read and Watch methods found in the
+// configuration providers of other libraries, so that go-toml can be used as
+// their TOML backend:
+//
+//	k.Load(toml.NewProvider("config.toml"), nil)
+type Provider struct {
+	path     string
+	interval time.Duration
+
+	mu   sync.Mutex
+	stop chan struct{}
+}
+
+// NewProvider returns a Provider reading the file at path.
+func NewProvider(path string) *Provider {
+	return &Provider{path: path, interval: time.Second}
+}
+
+// PollInterval sets how often Watch checks the file for changes. It is one
+// second by default.
+func (p *Provider) PollInterval(d time.Duration) *Provider {
+	p.interval = d
+	return p
+}
+
+// ReadBytes returns the content of the file.
+func (p *Provider) ReadBytes() ([]byte, error) {
+	return ioutil.ReadFile(p.path)
+}
+
+// Read parses the file and returns its values as nested maps, as Tree.ToMap.
+func (p *Provider) Read() (map[string]interface{}, error) {
+	b, err := p.ReadBytes()
+	if err != nil {
+		return nil, err
+	}
+	return Codec{}.Unmarshal(b)
+}
+
+// Watch polls the file for changes until Unwatch is called, calling cb from
+// another goroutine with a nil error each time its content changes, or with
+// the error if it cannot be read. The file is not parsed: callers are
+// expected to Read it again. An error is returned if the Provider is already
+// watching the file.
+func (p *Provider) Watch(cb func(event interface{}, err error)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stop != nil {
+		return errors.New("the file is already watched")
+	}
+	last, _ := p.ReadBytes()
+	stop := make(chan struct{})
+	p.stop = stop
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			b, err := p.ReadBytes()
+			if err != nil {
+				cb(nil, err)
+				continue
+			}
+			if !bytes.Equal(b, last) {
+				last = b
+				cb(nil, nil)
+			}
+		}
+	}()
+	return nil
+}
+
+// Unwatch stops watching the file. Callbacks may still be running when it
+// returns.
+func (p *Provider) Unwatch() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+	}
+	return nil
+}
+
+// Codec converts between TOML documents and nested maps. It implements the
+// Parser interface of koanf, and the codec interfaces of viper.
+type Codec struct{}
+
+// Unmarshal parses a TOML document into nested maps, as Tree.ToMap.
+func (Codec) Unmarshal(b []byte) (map[string]interface{}, error) {
+	tree, err := LoadBytes(b)
+	if err != nil {
+		return nil, err
+	}
+	return tree.ToMap(), nil
+}
+
+// Marshal writes nested maps as a TOML document.
+func (Codec) Marshal(m map[string]interface{}) ([]byte, error) {
+	return Marshal(m)
+}
+
+// Decode parses a TOML document and stores its values in m.
+func (c Codec) Decode(b []byte, m map[string]interface{}) error {
+	values, err := c.Unmarshal(b)
+	if err != nil {
+		return err
+	}
+	for k, v := range values {
+		m[k] = v
+	}
+	return nil
+}
+
+// Encode writes nested maps as a TOML document, as Marshal.
+func (c Codec) Encode(m map[string]interface{}) ([]byte, error) {
+	return c.Marshal(m)
+}
@@ -0,0 +1,76 @@
+package toml
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "toml-provider")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.toml")
+	if err := ioutil.WriteFile(path, []byte("[server]\nport = 80\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewProvider(path).PollInterval(10 * time.Millisecond)
+	m, err := p.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"server": map[string]interface{}{"port": int64(80)}}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("expected %v, got %v", expected, m)
+	}
+
+	events := make(chan error, 10)
+	if err := p.Watch(func(_ interface{}, err error) { events <- err }); err != nil {
+		t.Fatal(err)
+	}
+	assertErrorString(t, "the file is already watched", p.Watch(func(interface{}, error) {}))
+	if err := ioutil.WriteFile(path, []byte("[server]\nport = 8080\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-events:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event after the file changed")
+	}
+	if err := p.Unwatch(); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := p.Read(); err != nil || m["server"].(map[string]interface{})["port"] != int64(8080) {
+		t.Errorf("unexpected values %v, %v", m, err)
+	}
+}
+
+func TestCodec(t *testing.T) {
+	var c Codec
+	m := map[string]interface{}{"title": "app"}
+	if err := c.Decode([]byte("port = 80"), m); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"title": "app", "port": int64(80)}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("expected %v, got %v", expected, m)
+	}
+	b, err := c.Encode(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "port = 80\ntitle = \"app\"\n" {
+		t.Errorf("unexpected document %q", b)
+	}
+	_, err = c.Unmarshal([]byte("a = "))
+	assertErrorString(t, "(1, 5): expecting a value", err)
+}
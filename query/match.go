@@ -3,6 +3,7 @@ package query
 import (
 	"fmt"
 	"reflect"
+	"strconv"
 
 	"github.com/pelletier/go-toml"
 )
@@ -30,7 +31,7 @@ func (f *terminatingFn) setNext(next pathFn) {
 }
 
 func (f *terminatingFn) call(node interface{}, ctx *queryContext) {
-	ctx.result.appendResult(node, ctx.lastPosition)
+	ctx.result.appendResult(node, ctx.lastPosition, ctx.lastKey)
 }
 
 // match single key
@@ -44,11 +45,13 @@ func newMatchKeyFn(name string) *matchKeyFn {
 }
 
 func (f *matchKeyFn) call(node interface{}, ctx *queryContext) {
+	key := ctx.lastKey
 	if array, ok := node.([]*toml.Tree); ok {
-		for _, tree := range array {
+		for idx, tree := range array {
 			item := tree.GetPath([]string{f.Name})
 			if item != nil {
 				ctx.lastPosition = tree.GetPositionPath([]string{f.Name})
+				ctx.lastKey = key.Append(strconv.Itoa(idx), f.Name)
 				f.next.call(item, ctx)
 			}
 		}
@@ -56,6 +59,7 @@ func (f *matchKeyFn) call(node interface{}, ctx *queryContext) {
 		item := tree.GetPath([]string{f.Name})
 		if item != nil {
 			ctx.lastPosition = tree.GetPositionPath([]string{f.Name})
+			ctx.lastKey = key.Append(f.Name)
 			f.next.call(item, ctx)
 		}
 	}
@@ -84,16 +88,17 @@ func (f *matchIndexFn) call(node interface{}, ctx *queryContext) {
 			idx += v.Len()
 		}
 		if 0 <= idx && idx < v.Len() {
-			callNextIndexSlice(f.next, node, ctx, v.Index(idx).Interface())
+			callNextIndexSlice(f.next, node, ctx, idx, ctx.lastKey)
 		}
 	}
 }
 
-func callNextIndexSlice(next pathFn, node interface{}, ctx *queryContext, value interface{}) {
+func callNextIndexSlice(next pathFn, node interface{}, ctx *queryContext, idx int, key toml.Key) {
 	if treesArray, ok := node.([]*toml.Tree); ok {
 		ctx.lastPosition = treesArray[0].Position()
 	}
-	next.call(value, ctx)
+	ctx.lastKey = key.Append(strconv.Itoa(idx))
+	next.call(reflect.ValueOf(node).Index(idx).Interface(), ctx)
 }
 
 // filter by slicing
@@ -170,13 +175,14 @@ func (f *matchSliceFn) call(node interface{}, ctx *queryContext) {
 		}
 
 		// Loop on values
+		key := ctx.lastKey
 		if step > 0 {
 			for idx := start; idx < end; idx += step {
-				callNextIndexSlice(f.next, node, ctx, v.Index(idx).Interface())
+				callNextIndexSlice(f.next, node, ctx, idx, key)
 			}
 		} else {
 			for idx := start; idx > end; idx += step {
-				callNextIndexSlice(f.next, node, ctx, v.Index(idx).Interface())
+				callNextIndexSlice(f.next, node, ctx, idx, key)
 			}
 		}
 	}
@@ -207,9 +213,11 @@ func newMatchAnyFn() *matchAnyFn {
 
 func (f *matchAnyFn) call(node interface{}, ctx *queryContext) {
 	if tree, ok := node.(*toml.Tree); ok {
+		key := ctx.lastKey
 		for _, k := range tree.Keys() {
 			v := tree.GetPath([]string{k})
 			ctx.lastPosition = tree.GetPositionPath([]string{k})
+			ctx.lastKey = key.Append(k)
 			f.next.call(v, ctx)
 		}
 	}
@@ -227,7 +235,9 @@ func (f *matchUnionFn) setNext(next pathFn) {
 }
 
 func (f *matchUnionFn) call(node interface{}, ctx *queryContext) {
+	key := ctx.lastKey
 	for _, fn := range f.Union {
+		ctx.lastKey = key
 		fn.call(node, ctx)
 	}
 }
@@ -243,26 +253,29 @@ func newMatchRecursiveFn() *matchRecursiveFn {
 
 func (f *matchRecursiveFn) call(node interface{}, ctx *queryContext) {
 	originalPosition := ctx.lastPosition
+	originalKey := ctx.lastKey
 	if tree, ok := node.(*toml.Tree); ok {
-		var visit func(tree *toml.Tree)
-		visit = func(tree *toml.Tree) {
+		var visit func(tree *toml.Tree, key toml.Key)
+		visit = func(tree *toml.Tree, key toml.Key) {
 			for _, k := range tree.Keys() {
 				v := tree.GetPath([]string{k})
 				ctx.lastPosition = tree.GetPositionPath([]string{k})
+				ctx.lastKey = key.Append(k)
 				f.next.call(v, ctx)
 				switch node := v.(type) {
 				case *toml.Tree:
-					visit(node)
+					visit(node, key.Append(k))
 				case []*toml.Tree:
-					for _, subtree := range node {
-						visit(subtree)
+					for idx, subtree := range node {
+						visit(subtree, key.Append(k, strconv.Itoa(idx)))
 					}
 				}
 			}
 		}
 		ctx.lastPosition = originalPosition
+		ctx.lastKey = originalKey
 		f.next.call(tree, ctx)
-		visit(tree)
+		visit(tree, originalKey)
 	}
 }
 
@@ -283,27 +296,31 @@ func (f *matchFilterFn) call(node interface{}, ctx *queryContext) {
 		panic(fmt.Sprintf("%s: query context does not have filter '%s'",
 			f.Pos.String(), f.Name))
 	}
+	key := ctx.lastKey
 	switch castNode := node.(type) {
 	case *toml.Tree:
 		for _, k := range castNode.Keys() {
 			v := castNode.GetPath([]string{k})
 			if fn(v) {
 				ctx.lastPosition = castNode.GetPositionPath([]string{k})
+				ctx.lastKey = key.Append(k)
 				f.next.call(v, ctx)
 			}
 		}
 	case []*toml.Tree:
-		for _, v := range castNode {
+		for idx, v := range castNode {
 			if fn(v) {
 				if len(castNode) > 0 {
 					ctx.lastPosition = castNode[0].Position()
 				}
+				ctx.lastKey = key.Append(strconv.Itoa(idx))
 				f.next.call(v, ctx)
 			}
 		}
 	case []interface{}:
-		for _, v := range castNode {
+		for idx, v := range castNode {
 			if fn(v) {
+				ctx.lastKey = key.Append(strconv.Itoa(idx))
 				f.next.call(v, ctx)
 			}
 		}
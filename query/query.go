@@ -21,12 +21,14 @@ type NodeFilterFn func(node interface{}) bool
 type Result struct {
 	items     []interface{}
 	positions []toml.Position
+	keys      []toml.Key
 }
 
-// appends a value/position pair to the result set.
-func (r *Result) appendResult(node interface{}, pos toml.Position) {
+// appends a value/position/key triple to the result set.
+func (r *Result) appendResult(node interface{}, pos toml.Position, key toml.Key) {
 	r.items = append(r.items, node)
 	r.positions = append(r.positions, pos)
+	r.keys = append(r.keys, key.Append())
 }
 
 // Values is a set of values within a Result.  The order of values is not
@@ -42,17 +44,27 @@ func (r Result) Positions() []toml.Position {
 	return r.positions
 }
 
+// Keys is a set of keys for values within a Result.  Each index in Keys()
+// corresponds to the entry in Value() of the same index.  Elements of arrays
+// are designated by their index, so $.servers[1].name matches the key
+// servers.1.name.
+func (r Result) Keys() []toml.Key {
+	return r.keys
+}
+
 // runtime context for executing query paths
 type queryContext struct {
 	result       *Result
 	filters      *map[string]NodeFilterFn
 	lastPosition toml.Position
+	lastKey      toml.Key
 }
 
 // generic path functor interface
 type pathFn interface {
 	setNext(next pathFn)
-	// it is the caller's responsibility to set the ctx.lastPosition before invoking call()
+	// it is the caller's responsibility to set the ctx.lastPosition and
+	// ctx.lastKey before invoking call()
 	// node can be one of: *toml.Tree, []*toml.Tree, or a scalar
 	call(node interface{}, ctx *queryContext)
 }
@@ -94,9 +106,10 @@ func (q *Query) Execute(tree *toml.Tree) *Result {
 	result := &Result{
 		items:     []interface{}{},
 		positions: []toml.Position{},
+		keys:      []toml.Key{},
 	}
 	if q.root == nil {
-		result.appendResult(tree, tree.GetPosition(""))
+		result.appendResult(tree, tree.GetPosition(""), toml.Key{})
 	} else {
 		ctx := &queryContext{
 			result:  result,
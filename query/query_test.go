@@ -149,3 +149,40 @@ func TestTomlQuery(t *testing.T) {
 		t.Errorf("Expected 'b' with a value 2: %v", tt.Get("b"))
 	}
 }
+
+func TestQueryKeys(t *testing.T) {
+	config, _ := toml.Load(`
+      ports = [80, 443]
+      [[book]]
+      title = "The Stand"
+      [[book]]
+      title = "Neuromancer"
+      [server."host.name"]
+      port = 8080
+	`)
+
+	checkKeys := func(query string, expected ...string) {
+		results, err := CompileAndExecute(query, config)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		keys := results.Keys()
+		if len(keys) != len(expected) {
+			t.Fatalf("%s: expected %d keys, got %v", query, len(expected), keys)
+		}
+		for i, key := range keys {
+			if key.String() != expected[i] {
+				t.Errorf("%s: expected key %s, got %s", query, expected[i], key)
+			}
+		}
+	}
+
+	checkKeys("$", "")
+	checkKeys("$.book.title", "book.0.title", "book.1.title")
+	checkKeys("$.book[1].title", "book.1.title")
+	checkKeys("$.book[::-1].title", "book.1.title", "book.0.title")
+	checkKeys("$.ports[-1]", "ports.1")
+	checkKeys("$.server.*.port", `server."host.name".port`)
+	checkKeys("$.server['host.name'][port]", `server."host.name".port`)
+	checkKeys("$..port", `server."host.name".port`)
+}
@@ -0,0 +1,95 @@
+// Decoding of tables into interface types.
+
+package toml
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Concrete types registered for an interface type with RegisterTypes.
+type interfaceTypes struct {
+	field string
+	types map[string]reflect.Type
+}
+
+// RegisterTypes lets the Decoder decode tables into fields, slices and maps of
+// the interface type pointed at by iface. The string value of the field key
+// of a table, its discriminator, selects the concrete type the table is
+// decoded into among types, which maps discriminators to values of each type:
+//
+//	type Backend interface{ Open() error }
+//
+//	dec.RegisterTypes((*Backend)(nil), "type", map[string]interface{}{
+//		"s3":    S3Config{},
+//		"local": &LocalConfig{},
+//	})
+//
+// With this, the table
+//
+//	[backend]
+//	type = "s3"
+//	bucket = "b"
+//
+// is decoded in a Backend field as an S3Config. Types given as pointers are
+// decoded as pointers. The discriminator key does not need a field in the
+// concrete types. RegisterTypes panics if iface is not a pointer to an
+// interface, or if a type does not implement it.
+//
+// Arrays mixing tables with other values can be decoded into slices of the
+// interface type by converting the other values with a DecodeHook. Elements
+// that cannot be decoded fail with an *ArrayElementError.
+func (d *Decoder) RegisterTypes(iface interface{}, field string, types map[string]interface{}) *Decoder {
+	itype := reflect.TypeOf(iface)
+	if itype == nil || itype.Kind() != reflect.Ptr || itype.Elem().Kind() != reflect.Interface {
+		panic("toml: RegisterTypes needs a pointer to an interface type")
+	}
+	itype = itype.Elem()
+	registered := interfaceTypes{field: field, types: make(map[string]reflect.Type, len(types))}
+	for name, v := range types {
+		vtype := reflect.TypeOf(v)
+		if vtype == nil || !vtype.Implements(itype) {
+			panic(fmt.Sprintf("toml: type %v registered as %q does not implement %v", vtype, name, itype))
+		}
+		registered.types[name] = vtype
+	}
+	if d.interfaces == nil {
+		d.interfaces = map[reflect.Type]interfaceTypes{}
+	}
+	d.interfaces[itype] = registered
+	return d
+}
+
+// Check whether mtype is a slice or array of a registered interface type.
+func (d *Decoder) isRegisteredSequence(mtype reflect.Type) bool {
+	switch mtype.Kind() {
+	case reflect.Slice, reflect.Array:
+		_, ok := d.interfaces[mtype.Elem()]
+		return ok
+	default:
+		return false
+	}
+}
+
+// Decode tval into the concrete type selected by its discriminator.
+func (d *Decoder) valueFromRegisteredType(registered interfaceTypes, mtype reflect.Type, tval *Tree) (reflect.Value, error) {
+	discriminator, ok := tval.GetPath([]string{registered.field}).(string)
+	if !ok {
+		return reflect.ValueOf(nil), fmt.Errorf("missing %s key selecting the type of %v", registered.field, mtype)
+	}
+	ctype, ok := registered.types[discriminator]
+	if !ok {
+		return reflect.ValueOf(nil), fmt.Errorf("unknown %s %q for %v", registered.field, discriminator, mtype)
+	}
+	d.visitor.push(registered.field)
+	d.visitor.visit()
+	d.visitor.pop()
+	d.markKnown(tval, registered.field)
+	return d.valueFromTree(ctype, tval, nil)
+}
+
+// Error for values decoded into an interface type that has methods, but no
+// types registered with RegisterTypes.
+func unregisteredInterfaceError(value string, mtype reflect.Type) error {
+	return fmt.Errorf("cannot decode %s into %v, which has no types registered with RegisterTypes", value, mtype)
+}
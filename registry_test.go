@@ -0,0 +1,131 @@
+package toml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testBackend interface {
+	Kind() string
+}
+
+type testS3Backend struct {
+	Bucket string `toml:"bucket"`
+}
+
+func (testS3Backend) Kind() string { return "s3" }
+
+type testLocalBackend struct {
+	Type string `toml:"type"`
+	Path string `toml:"path"`
+}
+
+func (*testLocalBackend) Kind() string { return "local" }
+
+func newBackendDecoder(doc string) *Decoder {
+	return NewDecoder(strings.NewReader(doc)).RegisterTypes((*testBackend)(nil), "type", map[string]interface{}{
+		"s3":    testS3Backend{},
+		"local": &testLocalBackend{},
+	})
+}
+
+func TestDecoderRegisterTypes(t *testing.T) {
+	type config struct {
+		Main     testBackend            `toml:"main"`
+		Backups  []testBackend          `toml:"backups"`
+		Inline   []testBackend          `toml:"inline"`
+		ByRegion map[string]testBackend `toml:"by_region"`
+	}
+	doc := `inline = [{ type = "s3", bucket = "i" }]
+
+[main]
+type = "s3"
+bucket = "m"
+
+[[backups]]
+type = "local"
+path = "/b"
+
+[[backups]]
+type = "s3"
+bucket = "b"
+
+[by_region.eu]
+type = "local"
+path = "/eu"
+`
+	var c config
+	if err := newBackendDecoder(doc).Strict(true).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	expected := config{
+		Main:     testS3Backend{Bucket: "m"},
+		Backups:  []testBackend{&testLocalBackend{Type: "local", Path: "/b"}, testS3Backend{Bucket: "b"}},
+		Inline:   []testBackend{testS3Backend{Bucket: "i"}},
+		ByRegion: map[string]testBackend{"eu": &testLocalBackend{Type: "local", Path: "/eu"}},
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("expected %+v, got %+v", expected, c)
+	}
+
+	err := newBackendDecoder("[main]\nbucket = \"m\"\n").Decode(&c)
+	assertErrorString(t, "(1, 1): missing type key selecting the type of toml.testBackend", err)
+	err = newBackendDecoder("[main]\ntype = \"gcs\"\n").Decode(&c)
+	assertErrorString(t, "(1, 1): unknown type \"gcs\" for toml.testBackend", err)
+}
+
+func TestDecoderRegisterTypesPanics(t *testing.T) {
+	for _, f := range []func(){
+		func() { NewDecoder(nil).RegisterTypes(testS3Backend{}, "type", nil) },
+		func() {
+			NewDecoder(nil).RegisterTypes((*testBackend)(nil), "type", map[string]interface{}{"local": testLocalBackend{}})
+		},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected a panic")
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestDecoderMixedArrayElements(t *testing.T) {
+	doc := `mixed = [1, "two", 3.0, { x = 1 }, [1, 2], 1979-05-27]
+backends = [{ type = "s3", bucket = "b" }, "/srv"]
+`
+	var v struct {
+		Mixed    []interface{} `toml:"mixed"`
+		Backends []testBackend `toml:"backends"`
+	}
+	d := newBackendDecoder(doc).DecodeHook(func(from, to reflect.Type, data interface{}) (interface{}, error) {
+		if path, ok := data.(string); ok && to == reflect.TypeOf((*testBackend)(nil)).Elem() {
+			return &testLocalBackend{Type: "local", Path: path}, nil
+		}
+		return data, nil
+	})
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	mixed := []interface{}{int64(1), "two", 3.0, map[string]interface{}{"x": int64(1)}, []interface{}{int64(1), int64(2)},
+		LocalDate{1979, 5, 27}}
+	if !reflect.DeepEqual(v.Mixed, mixed) {
+		t.Errorf("expected %#v, got %#v", mixed, v.Mixed)
+	}
+	backends := []testBackend{testS3Backend{Bucket: "b"}, &testLocalBackend{Type: "local", Path: "/srv"}}
+	if !reflect.DeepEqual(v.Backends, backends) {
+		t.Errorf("expected %#v, got %#v", backends, v.Backends)
+	}
+
+	err := newBackendDecoder(doc).Decode(&v)
+	assertErrorString(t, "(2, 45): array element 1: Can't convert /srv(string) to toml.testBackend", err)
+	err = newBackendDecoder("[[backups]]\ntype = \"s3\"\n[[backups]]\ntype = \"gcs\"\n").Decode(&struct{ Backups []testBackend }{})
+	assertErrorString(t, "(3, 1): array element 1: unknown type \"gcs\" for toml.testBackend", err)
+	err = NewDecoder(strings.NewReader("ints = [1, 2, \"three\"]")).Decode(&struct{ Ints []int }{})
+	assertErrorString(t, "(1, 16): array element 2: Can't convert three(string) to int", err)
+	err = NewDecoder(strings.NewReader("[backend]\ntype = \"s3\"\n")).Decode(&struct{ Backend testBackend }{})
+	assertErrorString(t, "(1, 1): cannot decode a table into toml.testBackend, which has no types registered with RegisterTypes", err)
+}
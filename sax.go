@@ -0,0 +1,101 @@
+// Event-based parsing of documents.
+
+package toml
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// Handler receives the table headers and key/value pairs of a document
+// parsed by Parse.
+type Handler interface {
+	// Table is called for each table header, array being true for the
+	// headers of arrays of tables.
+	Table(key Key, array bool, position Position) error
+	// KeyValue is called for each key/value pair. key is complete: it is made
+	// of the key of the table of the pair followed by the parts of its dotted
+	// key. Arrays and inline tables are given as a single value.
+	KeyValue(key Key, value Value, position Position) error
+}
+
+// Parse reads a TOML document from r and calls handler for each of its table
+// headers and key/value pairs, in the order of the document, without building
+// a Tree. This lets single-pass analyzers, such as secret scanners or
+// indexers, process large documents in little memory.
+//
+// Parse stops at the first error returned by handler, and returns it. Syntax
+// errors are returned once the handler has been called for what precedes
+// them. Parse does not check that keys and tables are defined only once: a
+// document can be checked with Valid first if needed.
+func Parse(r io.Reader, handler Handler) (err error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if _, err := buf.ReadFrom(r); err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(runtime.Error); ok {
+				panic(r)
+			}
+			if e, ok := r.(error); ok {
+				err = e
+				return
+			}
+			err = fmt.Errorf("%s", r)
+		}
+	}()
+
+	tokens := lexToml(trimBOM(buf.Bytes()))
+	defer putTokens(tokens)
+	p := &tomlParser{flow: tokens}
+	table := Key{}
+	for {
+		tok := p.getToken()
+		if tok == nil || tok.typ == tokenEOF {
+			return nil
+		}
+		switch tok.typ {
+		case tokenLeftBracket, tokenDoubleLeftBracket:
+			array := tok.typ == tokenDoubleLeftBracket
+			keyTok := p.getToken()
+			if keyTok == nil || (keyTok.typ != tokenKeyGroup && !array) || (keyTok.typ != tokenKeyGroupArray && array) {
+				p.raiseError(tok, "was expecting a table key")
+			}
+			keys, err := parseKey(keyTok.val)
+			if err != nil {
+				p.raiseError(keyTok, "invalid table key: %s", err)
+			}
+			if array {
+				p.assume(tokenDoubleRightBracket)
+			} else {
+				p.assume(tokenRightBracket)
+			}
+			table = Key(keys)
+			if err := handler.Table(table.Append(), array, tok.Position); err != nil {
+				return err
+			}
+		case tokenKey:
+			p.assume(tokenEqual)
+			keys, err := parseKey(tok.val)
+			if err != nil {
+				p.raiseError(tok, "invalid key: %s", err)
+			}
+			position := Position{}
+			if next := p.peek(); next != nil {
+				position = next.Position
+			}
+			value := nodeValue{node: p.parseRvalue(), position: position}
+			if err := handler.KeyValue(table.Append(keys...), value, tok.Position); err != nil {
+				return err
+			}
+		case tokenError:
+			p.raiseError(tok, "parsing error: %s", tok.String())
+		default:
+			p.raiseError(tok, "unexpected token %s", tok.typ)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package toml
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Handler recording the events it receives.
+type recordingHandler struct {
+	events []string
+	stopAt string
+}
+
+func (h *recordingHandler) Table(key Key, array bool, position Position) error {
+	if array {
+		h.events = append(h.events, fmt.Sprintf("%s [[%s]]", position, key))
+	} else {
+		h.events = append(h.events, fmt.Sprintf("%s [%s]", position, key))
+	}
+	return nil
+}
+
+func (h *recordingHandler) KeyValue(key Key, value Value, position Position) error {
+	h.events = append(h.events, fmt.Sprintf("%s %s = %s %v at %s", position, key, value.Kind(), value.Interface(), value.Position()))
+	if key.String() == h.stopAt {
+		return errors.New("stop")
+	}
+	return nil
+}
+
+func TestParse(t *testing.T) {
+	doc := "\xEF\xBB\xBFa = 1\nb.c = \"x\"\n\n[t . u]\nd = [true, false]\ne = { f = 1.5 }\n\n[[arr]]\ng = 1979-05-27\n"
+	h := &recordingHandler{}
+	if err := Parse(strings.NewReader(doc), h); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"(1, 1) a = integer 1 at (1, 5)",
+		"(2, 1) b.c = string x at (2, 8)",
+		"(4, 1) [t.u]",
+		"(5, 1) t.u.d = array [true false] at (5, 5)",
+		"(6, 1) t.u.e = table f = 1.5\n at (6, 5)",
+		"(8, 1) [[arr]]",
+		"(9, 1) arr.g = local date 1979-05-27 at (9, 5)",
+	}
+	if !reflect.DeepEqual(h.events, expected) {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(h.events, "\n"))
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	h := &recordingHandler{stopAt: "b"}
+	err := Parse(strings.NewReader("a = 1\nb = 2\nc = 3\n"), h)
+	if err == nil || err.Error() != "stop" {
+		t.Errorf("expected the error of the handler, got %v", err)
+	}
+	if len(h.events) != 2 {
+		t.Errorf("parsing should stop at the error of the handler, got %v", h.events)
+	}
+
+	h = &recordingHandler{}
+	err = Parse(strings.NewReader("a = 1\nb = \n"), h)
+	if err == nil || err.Error() != "(3, 1): expecting a value" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if len(h.events) != 1 {
+		t.Errorf("pairs before the syntax error should be reported, got %v", h.events)
+	}
+
+	for _, doc := range []string{"[a\n", "[[a]\n", "= 1\n", "a = [1,\n"} {
+		if err := Parse(strings.NewReader(doc), &recordingHandler{}); err == nil {
+			t.Errorf("%q: expected an error", doc)
+		}
+	}
+
+	// keys defined twice are not checked
+	if err := Parse(strings.NewReader("a = 1\na = 2\n"), &recordingHandler{}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,459 @@
+// Validation of documents against JSON Schemas.
+
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pelletier/go-toml"
+)
+
+// JSONSchema is a JSON Schema documents can be validated against, as if they
+// were converted to JSON: tables are objects, date-times are strings, and
+// integers are also numbers.
+//
+// The validation keywords of drafts 6 to 2020-12 are supported, except
+// format, contentEncoding and the conditional and dynamic keywords: $ref
+// only resolves JSON pointers within the schema, such as
+// "#/definitions/server". Keywords that are not supported are ignored.
+type JSONSchema struct {
+	root     interface{}
+	patterns map[string]*regexp.Regexp
+}
+
+// CompileJSONSchema parses a JSON Schema.
+func CompileJSONSchema(b []byte) (*JSONSchema, error) {
+	s := &JSONSchema{patterns: map[string]*regexp.Regexp{}}
+	if err := json.Unmarshal(b, &s.root); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %s", err)
+	}
+	if err := s.compilePatterns(s.root); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Compile the pattern and patternProperties regular expressions of schema
+// ahead of validation.
+func (s *JSONSchema) compilePatterns(schema interface{}) error {
+	switch schema := schema.(type) {
+	case map[string]interface{}:
+		var patterns []string
+		if p, ok := schema["pattern"].(string); ok {
+			patterns = append(patterns, p)
+		}
+		if props, ok := schema["patternProperties"].(map[string]interface{}); ok {
+			for p := range props {
+				patterns = append(patterns, p)
+			}
+		}
+		for _, p := range patterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return fmt.Errorf("invalid pattern %q in JSON schema: %s", p, err)
+			}
+			s.patterns[p] = re
+		}
+		for _, v := range schema {
+			if err := s.compilePatterns(v); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, v := range schema {
+			if err := s.compilePatterns(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Validate parses doc and returns the violations of the schema it contains,
+// with the positions of the values in doc. An error is returned if doc is
+// invalid.
+func (s *JSONSchema) Validate(doc []byte) ([]Violation, error) {
+	tree, err := toml.LoadBytes(doc)
+	if err != nil {
+		return nil, err
+	}
+	return s.ValidateTree(tree), nil
+}
+
+// ValidateTree returns the violations of the schema in tree.
+func (s *JSONSchema) ValidateTree(tree *toml.Tree) []Violation {
+	v := &jsonValidator{schema: s}
+	v.validate(s.root, tree.AsValue(), toml.Key{}, "", 0)
+	return v.violations
+}
+
+type jsonValidator struct {
+	schema     *JSONSchema
+	violations []Violation
+}
+
+func (v *jsonValidator) report(key toml.Key, element string, pos toml.Position, format string, args ...interface{}) {
+	v.violations = append(v.violations, Violation{Key: key, Position: pos, Message: element + fmt.Sprintf(format, args...)})
+}
+
+// Maximum number of $ref followed without reaching a value, to stop on
+// recursive references.
+const maxJSONSchemaRefs = 100
+
+// Validate value, at key, against schema. Elements of arrays have the key of
+// their array, and are designated in the messages by element.
+func (v *jsonValidator) validate(schema interface{}, value toml.Value, key toml.Key, element string, refs int) {
+	pos := value.Position()
+	if allowed, ok := schema.(bool); ok {
+		if !allowed {
+			v.report(key, element, pos, "no value is allowed")
+		}
+		return
+	}
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	if ref, ok := s["$ref"].(string); ok {
+		target, err := v.schema.resolve(ref)
+		if err != nil || refs >= maxJSONSchemaRefs {
+			v.report(key, element, pos, "cannot resolve $ref %q", ref)
+		} else {
+			v.validate(target, value, key, element, refs+1)
+		}
+	}
+
+	data := jsonData(value)
+	if t, ok := s["type"]; ok && !jsonTypeMatches(t, value, data) {
+		v.report(key, element, pos, "expected a value of type %s, got %s", jsonTypeString(t), jsonType(value))
+		return
+	}
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(data, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.report(key, element, pos, "value %s is not one of %s", jsonString(data), jsonString(enum))
+		}
+	}
+	if c, ok := s["const"]; ok && !jsonEqual(data, c) {
+		v.report(key, element, pos, "value %s is not %s", jsonString(data), jsonString(c))
+	}
+
+	v.combinators(s, value, key, element, refs)
+
+	switch data := data.(type) {
+	case float64:
+		v.number(s, data, key, element, pos)
+	case string:
+		length := float64(utf8.RuneCountInString(data))
+		if min, ok := s["minLength"].(float64); ok && length < min {
+			v.report(key, element, pos, "length %v is less than the minimum %v", length, min)
+		}
+		if max, ok := s["maxLength"].(float64); ok && length > max {
+			v.report(key, element, pos, "length %v is greater than the maximum %v", length, max)
+		}
+		if p, ok := s["pattern"].(string); ok && !v.schema.patterns[p].MatchString(data) {
+			v.report(key, element, pos, "value %q does not match %q", data, p)
+		}
+	case []interface{}:
+		v.array(s, value, data, key, element)
+	case map[string]interface{}:
+		t, _ := value.AsTable()
+		v.object(s, t, key, element)
+	}
+}
+
+func (v *jsonValidator) number(s map[string]interface{}, n float64, key toml.Key, element string, pos toml.Position) {
+	if min, ok := s["minimum"].(float64); ok && n < min {
+		v.report(key, element, pos, "value %v is less than the minimum %v", n, min)
+	}
+	if max, ok := s["maximum"].(float64); ok && n > max {
+		v.report(key, element, pos, "value %v is greater than the maximum %v", n, max)
+	}
+	if min, ok := s["exclusiveMinimum"].(float64); ok && n <= min {
+		v.report(key, element, pos, "value %v is not greater than %v", n, min)
+	}
+	if max, ok := s["exclusiveMaximum"].(float64); ok && n >= max {
+		v.report(key, element, pos, "value %v is not less than %v", n, max)
+	}
+	if m, ok := s["multipleOf"].(float64); ok && m > 0 {
+		if q := n / m; q != math.Trunc(q) {
+			v.report(key, element, pos, "value %v is not a multiple of %v", n, m)
+		}
+	}
+}
+
+func (v *jsonValidator) array(s map[string]interface{}, value toml.Value, data []interface{}, key toml.Key, element string) {
+	pos := value.Position()
+	length := float64(len(data))
+	if min, ok := s["minItems"].(float64); ok && length < min {
+		v.report(key, element, pos, "length %v is less than the minimum %v", length, min)
+	}
+	if max, ok := s["maxItems"].(float64); ok && length > max {
+		v.report(key, element, pos, "length %v is greater than the maximum %v", length, max)
+	}
+	if unique, _ := s["uniqueItems"].(bool); unique {
+		for i := range data {
+			for j := 0; j < i; j++ {
+				if jsonEqual(data[i], data[j]) {
+					v.report(key, element, pos, "elements %d and %d are equal", j, i)
+				}
+			}
+		}
+	}
+
+	elements, _ := value.AsArray()
+	// before draft 2020-12, the schemas of the first elements are given by
+	// items as a list, and those of the other elements by additionalItems
+	prefix, _ := s["prefixItems"].([]interface{})
+	items, hasItems := s["items"]
+	if list, ok := items.([]interface{}); ok {
+		prefix, items, hasItems = list, s["additionalItems"], s["additionalItems"] != nil
+	}
+	for i, e := range elements {
+		name := fmt.Sprintf("%selement %d: ", element, i)
+		if i < len(prefix) {
+			v.validate(prefix[i], e, key, name, 0)
+		} else if hasItems {
+			v.validate(items, e, key, name, 0)
+		}
+	}
+	if contains, ok := s["contains"]; ok {
+		found := false
+		for _, e := range elements {
+			probe := &jsonValidator{schema: v.schema}
+			probe.validate(contains, e, key, "", 0)
+			if len(probe.violations) == 0 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.report(key, element, pos, "no element matches the contains schema")
+		}
+	}
+}
+
+func (v *jsonValidator) object(s map[string]interface{}, t *toml.Tree, key toml.Key, element string) {
+	pos := t.Position()
+	keys := t.Keys()
+	sort.Strings(keys)
+	count := float64(len(keys))
+	if min, ok := s["minProperties"].(float64); ok && count < min {
+		v.report(key, element, pos, "number of keys %v is less than the minimum %v", count, min)
+	}
+	if max, ok := s["maxProperties"].(float64); ok && count > max {
+		v.report(key, element, pos, "number of keys %v is greater than the maximum %v", count, max)
+	}
+	if required, ok := s["required"].([]interface{}); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok && !t.HasPath([]string{name}) {
+				v.report(key.Append(name), element, pos, "required key is missing")
+			}
+		}
+	}
+
+	properties, _ := s["properties"].(map[string]interface{})
+	patterns, _ := s["patternProperties"].(map[string]interface{})
+	additional, hasAdditional := s["additionalProperties"]
+	for _, k := range keys {
+		value := t.GetValuePath([]string{k})
+		if names, ok := s["propertyNames"]; ok {
+			name, _ := toml.TreeFromMap(map[string]interface{}{"name": k})
+			probe := &jsonValidator{schema: v.schema}
+			probe.validate(names, name.GetValuePath([]string{"name"}), key.Append(k), "", 0)
+			if len(probe.violations) > 0 {
+				v.report(key.Append(k), element, value.Position(), "key name is not allowed")
+			}
+		}
+		matched := false
+		if p, ok := properties[k]; ok {
+			matched = true
+			v.validate(p, value, key.Append(k), element, 0)
+		}
+		for pattern, p := range patterns {
+			if v.schema.patterns[pattern].MatchString(k) {
+				matched = true
+				v.validate(p, value, key.Append(k), element, 0)
+			}
+		}
+		if !matched && hasAdditional {
+			if allowed, ok := additional.(bool); ok && !allowed {
+				v.report(key.Append(k), element, value.Position(), "key is not allowed")
+			} else {
+				v.validate(additional, value, key.Append(k), element, 0)
+			}
+		}
+	}
+}
+
+// Apply allOf, anyOf, oneOf and not.
+func (v *jsonValidator) combinators(s map[string]interface{}, value toml.Value, key toml.Key, element string, refs int) {
+	pos := value.Position()
+	matches := func(schemas []interface{}) int {
+		n := 0
+		for _, schema := range schemas {
+			probe := &jsonValidator{schema: v.schema}
+			probe.validate(schema, value, key, "", refs)
+			if len(probe.violations) == 0 {
+				n++
+			}
+		}
+		return n
+	}
+	if all, ok := s["allOf"].([]interface{}); ok {
+		for _, schema := range all {
+			v.validate(schema, value, key, element, refs)
+		}
+	}
+	if any, ok := s["anyOf"].([]interface{}); ok && matches(any) == 0 {
+		v.report(key, element, pos, "value matches none of the anyOf schemas")
+	}
+	if one, ok := s["oneOf"].([]interface{}); ok {
+		if n := matches(one); n != 1 {
+			v.report(key, element, pos, "value matches %d of the oneOf schemas instead of one", n)
+		}
+	}
+	if not, ok := s["not"]; ok && matches([]interface{}{not}) == 1 {
+		v.report(key, element, pos, "value matches the not schema")
+	}
+}
+
+// Resolve a reference to a part of the schema, given as a JSON pointer.
+func (s *JSONSchema) resolve(ref string) (interface{}, error) {
+	if ref == "#" {
+		return s.root, nil
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported reference %s", ref)
+	}
+	node := s.root
+	for _, part := range strings.Split(ref[2:], "/") {
+		part = strings.Replace(strings.Replace(part, "~1", "/", -1), "~0", "~", -1)
+		switch n := node.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if node, ok = n[part]; !ok {
+				return nil, fmt.Errorf("reference %s not found", ref)
+			}
+		default:
+			return nil, fmt.Errorf("reference %s not found", ref)
+		}
+	}
+	return node, nil
+}
+
+// The JSON representation of a value: float64 for numbers, strings for
+// date-times, []interface{} for arrays and map[string]interface{} for
+// tables.
+func jsonData(value toml.Value) interface{} {
+	switch value.Kind() {
+	case toml.KindInteger:
+		if i, ok := value.AsInteger(); ok {
+			return float64(i)
+		}
+		return float64(value.Interface().(uint64))
+	case toml.KindFloat:
+		f, _ := value.AsFloat()
+		return f
+	case toml.KindString:
+		s, _ := value.AsString()
+		return s
+	case toml.KindBool:
+		b, _ := value.AsBool()
+		return b
+	case toml.KindArray:
+		elements, _ := value.AsArray()
+		data := make([]interface{}, len(elements))
+		for i, e := range elements {
+			data[i] = jsonData(e)
+		}
+		return data
+	case toml.KindTable:
+		t, _ := value.AsTable()
+		data := map[string]interface{}{}
+		for _, k := range t.Keys() {
+			data[k] = jsonData(t.GetValuePath([]string{k}))
+		}
+		return data
+	case toml.KindOffsetDateTime:
+		tm, _ := value.AsTime()
+		return tm.Format("2006-01-02T15:04:05.999999999Z07:00")
+	}
+	return fmt.Sprint(value.Interface())
+}
+
+// JSON type of a value.
+func jsonType(value toml.Value) string {
+	switch value.Kind() {
+	case toml.KindInteger:
+		return "integer"
+	case toml.KindFloat:
+		return "number"
+	case toml.KindBool:
+		return "boolean"
+	case toml.KindArray:
+		return "array"
+	case toml.KindTable:
+		return "object"
+	}
+	return "string"
+}
+
+// Whether the value is of one of the types t, a type name or a list of them.
+func jsonTypeMatches(t interface{}, value toml.Value, data interface{}) bool {
+	names, ok := t.([]interface{})
+	if !ok {
+		names = []interface{}{t}
+	}
+	actual := jsonType(value)
+	for _, name := range names {
+		switch {
+		case name == actual:
+			return true
+		case name == "number" && actual == "integer":
+			return true
+		case name == "integer" && actual == "number":
+			if f := data.(float64); f == math.Trunc(f) && !math.IsInf(f, 0) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jsonTypeString(t interface{}) string {
+	if names, ok := t.([]interface{}); ok {
+		s := make([]string, len(names))
+		for i, name := range names {
+			s[i] = fmt.Sprint(name)
+		}
+		return strings.Join(s, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func jsonEqual(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func jsonString(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,157 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const jsonSchemaDocument = `{
+  "type": "object",
+  "required": ["title", "server"],
+  "additionalProperties": false,
+  "properties": {
+    "title": {"type": "string", "minLength": 1, "pattern": "^[a-z]+$"},
+    "level": {"enum": ["debug", "info"]},
+    "ratio": {"type": "number", "exclusiveMaximum": 1},
+    "started": {"type": "string"},
+    "server": {"$ref": "#/definitions/server"},
+    "tags": {"type": "array", "items": {"type": "string"}, "uniqueItems": true, "maxItems": 3},
+    "routes": {
+      "type": "array",
+      "items": {"type": "object", "required": ["path"], "properties": {"path": {"type": "string"}}}
+    },
+    "limits": {"type": "object", "patternProperties": {"^max_": {"type": "integer", "minimum": 0}}},
+    "mode": {"oneOf": [{"type": "integer"}, {"type": "string", "maxLength": 3}]}
+  },
+  "definitions": {
+    "server": {
+      "type": "object",
+      "properties": {"port": {"type": "integer", "minimum": 1, "maximum": 65535}}
+    }
+  }
+}`
+
+func TestJSONSchema(t *testing.T) {
+	s, err := CompileJSONSchema([]byte(jsonSchemaDocument))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := `title = "app"
+level = "info"
+ratio = 0.5
+started = 1979-05-27T07:32:00Z
+tags = ["a", "b"]
+mode = 1
+
+[server]
+port = 8080
+
+[limits]
+max_conns = 10
+other = "x"
+
+[[routes]]
+path = "/"
+`
+	violations, err := s.Validate([]byte(valid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 0 {
+		t.Errorf("expected no violations, got %v", violationStrings(violations))
+	}
+
+	invalid := `title = "App"
+level = "verbose"
+ratio = 1
+tags = ["a", 2, "a", "c"]
+mode = "long"
+extra = true
+
+[server]
+port = 0
+
+[limits]
+max_conns = 1.5
+
+[[routes]]
+path = "/"
+
+[[routes]]
+name = "x"
+`
+	violations, err = s.Validate([]byte(invalid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"(6, 1): extra: key is not allowed",
+		`(2, 1): level: value "verbose" is not one of ["debug","info"]`,
+		"(12, 1): limits.max_conns: expected a value of type integer, got number",
+		"(5, 1): mode: value matches 0 of the oneOf schemas instead of one",
+		"(3, 1): ratio: value 1 is not less than 1",
+		"(17, 1): routes.path: element 1: required key is missing",
+		"(9, 1): server.port: value 0 is less than the minimum 1",
+		"(4, 1): tags: length 4 is greater than the maximum 3",
+		"(4, 1): tags: elements 0 and 2 are equal",
+		"(4, 1): tags: element 1: expected a value of type string, got integer",
+		`(1, 1): title: value "App" does not match "^[a-z]+$"`,
+	}
+	if got := violationStrings(violations); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	violations, _ = s.Validate([]byte("title = \"a\"\n"))
+	expected = []string{"(1, 1): server: required key is missing"}
+	if got := violationStrings(violations); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestJSONSchemaKeywords(t *testing.T) {
+	examples := []struct {
+		schema   string
+		doc      string
+		expected []string
+	}{
+		{`{"properties": {"a": false}}`, "a = 1", []string{"(1, 1): a: no value is allowed"}},
+		{`{"properties": {"a": {"const": 2}}}`, "a = 2.0", []string{}},
+		{`{"properties": {"a": {"type": ["integer", "boolean"]}}}`, "a = \"x\"", []string{"(1, 1): a: expected a value of type integer or boolean, got string"}},
+		{`{"properties": {"a": {"multipleOf": 5}}}`, "a = 12", []string{"(1, 1): a: value 12 is not a multiple of 5"}},
+		{`{"properties": {"a": {"not": {"type": "string"}}}}`, "a = \"x\"", []string{"(1, 1): a: value matches the not schema"}},
+		{`{"properties": {"a": {"anyOf": [{"minimum": 5}, {"maximum": 1}]}}}`, "a = 3", []string{"(1, 1): a: value matches none of the anyOf schemas"}},
+		{`{"properties": {"a": {"allOf": [{"minimum": 5}, {"maximum": 1}]}}}`, "a = 3", []string{"(1, 1): a: value 3 is less than the minimum 5", "(1, 1): a: value 3 is greater than the maximum 1"}},
+		{`{"properties": {"a": {"contains": {"type": "integer"}}}}`, "a = [\"x\"]", []string{"(1, 1): a: no element matches the contains schema"}},
+		{`{"properties": {"a": {"prefixItems": [{"type": "string"}], "items": false}}}`, "a = [\"x\", 1]", []string{"(1, 1): a: element 1: no value is allowed"}},
+		{`{"properties": {"a": {"items": [{"type": "string"}], "additionalItems": {"type": "string"}}}}`, "a = [\"x\", 1]", []string{"(1, 1): a: element 1: expected a value of type string, got integer"}},
+		{`{"propertyNames": {"maxLength": 3}, "maxProperties": 1}`, "abcd = 1\nb = 2", []string{"(1, 1): number of keys 2 is greater than the maximum 1", "(1, 1): abcd: key name is not allowed"}},
+		{`{"additionalProperties": {"type": "string"}}`, "a = 1", []string{"(1, 1): a: expected a value of type string, got integer"}},
+		{`{"$ref": "#/$defs/missing"}`, "a = 1", []string{"(1, 1): cannot resolve $ref \"#/$defs/missing\""}},
+		{`{"$defs": {"t": {"properties": {"next": {"$ref": "#/$defs/t"}, "v": {"type": "integer"}}}}, "$ref": "#/$defs/t"}`, "next.next.v = \"x\"", []string{"(1, 1): next.next.v: expected a value of type integer, got string"}},
+	}
+	for _, e := range examples {
+		s, err := CompileJSONSchema([]byte(e.schema))
+		if err != nil {
+			t.Fatal(err)
+		}
+		violations, err := s.Validate([]byte(e.doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := violationStrings(violations); !reflect.DeepEqual(got, e.expected) {
+			t.Errorf("%s: expected %v, got %v", e.schema, e.expected, got)
+		}
+	}
+}
+
+func TestCompileJSONSchemaErrors(t *testing.T) {
+	if _, err := CompileJSONSchema([]byte("{")); err == nil {
+		t.Error("expected an error")
+	}
+	_, err := CompileJSONSchema([]byte(`{"properties": {"a": {"pattern": "("}}}`))
+	if err == nil || !strings.HasPrefix(err.Error(), `invalid pattern "(" in JSON schema`) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,286 @@
+// Package schema validates TOML documents against a description of the keys
+// they are expected to define.
+//
+// A schema lists the keys of a document with their type, whether they are
+// required, and the values they accept. It is built in Go:
+//
+//	s := &schema.Schema{Fields: map[string]*schema.Field{
+//	  "port": {Type: schema.TypeInteger, Required: true, Min: schema.Bound(1), Max: schema.Bound(65535)},
+//	}}
+//
+// or loaded from a TOML file with Load:
+//
+//	[fields.port]
+//	type = "integer"
+//	required = true
+//	min = 1
+//	max = 65535
+//
+// Validate then reports every violation of the schema found in a document,
+// with the key and the position it applies to.
+//
+// Documents can also be validated against the JSON Schemas published for the
+// configurations of many tools, with CompileJSONSchema.
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Type is the TOML type of a value, named as by toml.Kind.
+type Type string
+
+// Types accepted by fields. The empty type accepts any value.
+const (
+	TypeAny            Type = ""
+	TypeString         Type = "string"
+	TypeInteger        Type = "integer"
+	TypeFloat          Type = "float"
+	TypeBool           Type = "bool"
+	TypeOffsetDateTime Type = "offset date-time"
+	TypeLocalDateTime  Type = "local date-time"
+	TypeLocalDate      Type = "local date"
+	TypeLocalTime      Type = "local time"
+	TypeArray          Type = "array"
+	TypeTable          Type = "table"
+)
+
+var types = map[Type]bool{
+	TypeAny: true, TypeString: true, TypeInteger: true, TypeFloat: true, TypeBool: true,
+	TypeOffsetDateTime: true, TypeLocalDateTime: true, TypeLocalDate: true, TypeLocalTime: true,
+	TypeArray: true, TypeTable: true,
+}
+
+// Schema describes the top-level table of a document.
+type Schema struct {
+	// Fields are the keys of the table.
+	Fields map[string]*Field `toml:"fields"`
+	// Closed rejects the keys of the table that are not in Fields.
+	Closed bool `toml:"closed"`
+}
+
+// Field describes the value of a key.
+type Field struct {
+	Type     Type `toml:"type"`
+	Required bool `toml:"required"`
+	// Min and Max bound numbers, and the length of strings and arrays.
+	Min *float64 `toml:"min"`
+	Max *float64 `toml:"max"`
+	// Enum lists the values accepted, if not empty.
+	Enum []interface{} `toml:"enum"`
+	// Fields and Closed describe the keys of tables, as for Schema.
+	Fields map[string]*Field `toml:"fields"`
+	Closed bool              `toml:"closed"`
+	// Items describes the elements of arrays, and the tables of arrays of
+	// tables.
+	Items *Field `toml:"items"`
+}
+
+// Bound returns a pointer to v, for the bounds of fields.
+func Bound(v float64) *float64 {
+	return &v
+}
+
+// Violation describes a value that does not follow the schema.
+type Violation struct {
+	Key      toml.Key      // complete key of the value, or of its table
+	Position toml.Position // position of the value, or of its table
+	Message  string
+}
+
+func (v Violation) String() string {
+	if len(v.Key) == 0 {
+		return fmt.Sprintf("%s: %s", v.Position, v.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", v.Position, v.Key, v.Message)
+}
+
+// Load reads a schema from a TOML document, whose keys are those of the
+// Schema and Field structs.
+func Load(b []byte) (*Schema, error) {
+	s := &Schema{}
+	d := toml.NewDecoder(bytes.NewReader(b)).Strict(true).DecodeHook(integerBounds)
+	if err := d.Decode(s); err != nil {
+		return nil, err
+	}
+	if err := checkFields(s.Fields, toml.Key{}); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Accept integer bounds.
+func integerBounds(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if i, ok := data.(int64); ok && to.Kind() == reflect.Float64 {
+		return float64(i), nil
+	}
+	return data, nil
+}
+
+// Check the types of the fields of a loaded schema.
+func checkFields(fields map[string]*Field, prefix toml.Key) error {
+	for name, f := range fields {
+		if err := checkField(f, prefix.Append(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkField(f *Field, key toml.Key) error {
+	if f == nil {
+		return nil
+	}
+	if !types[f.Type] {
+		return fmt.Errorf("%s: unknown type %q", key, f.Type)
+	}
+	if err := checkFields(f.Fields, key); err != nil {
+		return err
+	}
+	return checkField(f.Items, key)
+}
+
+// Validate parses doc and returns the violations of the schema it contains,
+// in the order of the keys. An error is returned if doc is invalid.
+func (s *Schema) Validate(doc []byte) ([]Violation, error) {
+	tree, err := toml.LoadBytes(doc)
+	if err != nil {
+		return nil, err
+	}
+	return s.ValidateTree(tree), nil
+}
+
+// ValidateTree returns the violations of the schema in tree.
+func (s *Schema) ValidateTree(tree *toml.Tree) []Violation {
+	v := &validator{}
+	v.table(tree, toml.Key{}, s.Fields, s.Closed)
+	return v.violations
+}
+
+type validator struct {
+	violations []Violation
+}
+
+func (v *validator) report(key toml.Key, pos toml.Position, format string, args ...interface{}) {
+	v.violations = append(v.violations, Violation{Key: key, Position: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) table(t *toml.Tree, key toml.Key, fields map[string]*Field, closed bool) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := t.GetValuePath([]string{name})
+		if value == nil {
+			if fields[name] != nil && fields[name].Required {
+				v.report(key.Append(name), t.Position(), "required key is missing")
+			}
+			continue
+		}
+		v.value(value, key.Append(name), fields[name])
+	}
+
+	if !closed {
+		return
+	}
+	keys := t.Keys()
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, ok := fields[k]; !ok {
+			v.report(key.Append(k), t.GetPositionPath([]string{k}), "key is not allowed")
+		}
+	}
+}
+
+func (v *validator) value(value toml.Value, key toml.Key, f *Field) {
+	if f == nil {
+		return
+	}
+	kind := value.Kind()
+	if f.Type != TypeAny && Type(kind.String()) != f.Type {
+		v.report(key, value.Position(), "expected a value of type %s, got %s", f.Type, kind)
+		return
+	}
+
+	if f.Min != nil || f.Max != nil {
+		if n, what, ok := measure(value); ok {
+			if f.Min != nil && n < *f.Min {
+				v.report(key, value.Position(), "%s %v is less than the minimum %v", what, n, *f.Min)
+			}
+			if f.Max != nil && n > *f.Max {
+				v.report(key, value.Position(), "%s %v is greater than the maximum %v", what, n, *f.Max)
+			}
+		}
+	}
+	if len(f.Enum) > 0 && !inEnum(value.Interface(), f.Enum) {
+		v.report(key, value.Position(), "value %v is not one of %v", value.Interface(), f.Enum)
+	}
+
+	switch kind {
+	case toml.KindTable:
+		t, _ := value.AsTable()
+		v.table(t, key, f.Fields, f.Closed)
+	case toml.KindArray:
+		if f.Items == nil {
+			return
+		}
+		elements, _ := value.AsArray()
+		for _, e := range elements {
+			v.value(e, key, f.Items)
+		}
+	}
+}
+
+// The quantity bounded by Min and Max for a value, and its name.
+func measure(value toml.Value) (float64, string, bool) {
+	if i, ok := value.AsInteger(); ok {
+		return float64(i), "value", true
+	}
+	if f, ok := value.AsFloat(); ok {
+		return f, "value", true
+	}
+	if s, ok := value.AsString(); ok {
+		return float64(len([]rune(s))), "length", true
+	}
+	if a, ok := value.AsArray(); ok {
+		return float64(len(a)), "length", true
+	}
+	return 0, "", false
+}
+
+// Whether v is one of the values of enum. Integers and floats of the same
+// value are equal.
+func inEnum(v interface{}, enum []interface{}) bool {
+	for _, e := range enum {
+		n, isNumber := number(v)
+		m, isEnumNumber := number(e)
+		if isNumber || isEnumNumber {
+			if isNumber && isEnumNumber && n == m {
+				return true
+			}
+		} else if reflect.DeepEqual(v, e) {
+			return true
+		}
+	}
+	return false
+}
+
+func number(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,155 @@
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const schemaDocument = `closed = true
+
+[fields.title]
+type = "string"
+required = true
+min = 1
+
+[fields.level]
+type = "string"
+enum = ["debug", "info", "error"]
+
+[fields.server]
+type = "table"
+required = true
+closed = true
+
+[fields.server.fields.port]
+type = "integer"
+min = 1
+max = 65535
+
+[fields.server.fields.host]
+type = "string"
+
+[fields.ratios]
+type = "array"
+max = 2
+items = { type = "float", enum = [0.5, 1] }
+
+[fields.routes]
+type = "array"
+[fields.routes.items]
+type = "table"
+[fields.routes.items.fields.path]
+type = "string"
+required = true
+`
+
+func violationStrings(violations []Violation) []string {
+	s := []string{}
+	for _, v := range violations {
+		s = append(s, v.String())
+	}
+	return s
+}
+
+func TestValidate(t *testing.T) {
+	s, err := Load([]byte(schemaDocument))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := `title = "app"
+level = "info"
+ratios = [0.5, 1.0]
+
+[server]
+port = 8080
+
+[[routes]]
+path = "/"
+`
+	violations, err := s.Validate([]byte(valid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 0 {
+		t.Errorf("expected no violations, got %v", violationStrings(violations))
+	}
+
+	invalid := `title = ""
+level = "verbose"
+ratios = [0.5, 2.0, 1.0]
+extra = true
+
+[server]
+port = "8080"
+user = "root"
+
+[[routes]]
+path = "/"
+
+[[routes]]
+name = "x"
+`
+	violations, err = s.Validate([]byte(invalid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"(2, 1): level: value verbose is not one of [debug info error]",
+		"(3, 1): ratios: length 3 is greater than the maximum 2",
+		"(3, 1): ratios: value 2 is not one of [0.5 1]",
+		"(13, 1): routes.path: required key is missing",
+		"(7, 1): server.port: expected a value of type integer, got string",
+		"(8, 1): server.user: key is not allowed",
+		"(1, 1): title: length 0 is less than the minimum 1",
+		"(4, 1): extra: key is not allowed",
+	}
+	if got := violationStrings(violations); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	violations, _ = s.Validate([]byte("level = 1\n"))
+	expected = []string{
+		"(1, 1): level: expected a value of type string, got integer",
+		"(1, 1): server: required key is missing",
+		"(1, 1): title: required key is missing",
+	}
+	if got := violationStrings(violations); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	if _, err := s.Validate([]byte("a = ")); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestSchemaInGo(t *testing.T) {
+	s := &Schema{Fields: map[string]*Field{
+		"port":  {Type: TypeInteger, Required: true, Min: Bound(1), Max: Bound(65535)},
+		"mode":  {Enum: []interface{}{"a", 1}},
+		"other": nil,
+	}}
+	violations, err := s.Validate([]byte("port = 0\nmode = 1.0\nother = 1\nunknown = 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"(1, 1): port: value 0 is less than the minimum 1"}
+	if got := violationStrings(violations); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	violations, _ = s.Validate([]byte("port = 1\nmode = \"1\"\n"))
+	expected = []string{"(2, 1): mode: value 1 is not one of [a 1]"}
+	if got := violationStrings(violations); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	if _, err := Load([]byte("[fields.a]\ntype = \"number\"\n")); err == nil || err.Error() != `a: unknown type "number"` {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err := Load([]byte("[fields.a]\nkind = \"string\"\n")); err == nil {
+		t.Error("unknown keys of schemas should be rejected")
+	}
+}
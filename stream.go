@@ -0,0 +1,120 @@
+// Streams of documents.
+
+package toml
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// Separator makes the decoder read a stream of documents separated by lines
+// holding only sep, such as "+++", rather than a single document. Each call
+// to Decode then reads the next document of the stream, and returns io.EOF
+// once there is none left, as with encoding/json:
+//
+//	d := toml.NewDecoder(r).Separator("+++")
+//	for d.More() {
+//	  var entry Entry
+//	  if err := d.Decode(&entry); err != nil {
+//	    return err
+//	  }
+//	  ...
+//	}
+//
+// A separator on the first line of the stream is skipped, so that the TOML
+// front matter of a file can be decoded, the rest of the file being left
+// unread. The limits of the decoder apply to each document, and positions
+// reported in errors are relative to the start of the document.
+func (d *Decoder) Separator(sep string) *Decoder {
+	d.separator = sep
+	return d
+}
+
+// More reports whether there is another document to decode in the input,
+// that is whether it holds more than whitespace. Without a Separator, the
+// whole input is a single document.
+func (d *Decoder) More() bool {
+	if d.input.pending != nil && d.input.pending.Len() > 0 {
+		return true
+	}
+	d.input.r, d.input.ctx = d.r, d.ctx
+	d.input.read, d.input.max = 0, 0
+	defer func() { d.input.r, d.input.ctx = nil, nil }()
+	s := d.streamReader()
+	for {
+		b, err := s.Peek(1)
+		if err != nil {
+			return false
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			s.ReadByte()
+		default:
+			return true
+		}
+	}
+}
+
+// Buffered input of streams of documents.
+func (d *Decoder) streamReader() *bufio.Reader {
+	if d.stream == nil {
+		d.stream = bufio.NewReader(&d.input)
+	}
+	return d.stream
+}
+
+// Read the next document of the stream into buf, up to the next separator
+// line, which is consumed. io.EOF is returned if the stream has ended.
+func (d *Decoder) readDocument(buf *bytes.Buffer) error {
+	s := d.streamReader()
+	read := buf.Len() > 0
+	for {
+		start := bytes.LastIndexByte(buf.Bytes(), '\n') + 1
+		line, err := s.ReadBytes('\n')
+		buf.Write(line)
+		read = read || len(line) > 0
+		if max := d.limits.maxInputBytes; max > 0 && int64(buf.Len()) > max {
+			return errInputTooLarge
+		}
+		if err == nil || err == io.EOF && len(line) > 0 {
+			if string(bytes.TrimRight(buf.Bytes()[start:], " \t\r\n")) == d.separator {
+				buf.Truncate(start)
+				if start > 0 || d.streamStarted {
+					return nil
+				}
+				// separator opening the stream, as in front matter
+			}
+			d.streamStarted = true
+		}
+		switch {
+		case err == io.EOF && !read:
+			return io.EOF
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		}
+	}
+}
+
+// Separator makes the encoder write a stream of documents: each call to
+// Encode after the first one writes a line holding only sep, such as "+++",
+// before the document. The documents can be read back with the Separator of a
+// Decoder.
+func (e *Encoder) Separator(sep string) *Encoder {
+	e.separator = sep
+	return e
+}
+
+// Line separating the next document of the stream from the previous one, if
+// any.
+func (e *Encoder) separatorLine() string {
+	switch {
+	case e.separator == "" || e.documents == 0:
+		return ""
+	case !e.endsWithNewline:
+		return "\n" + e.separator + "\n"
+	}
+	return e.separator + "\n"
+}
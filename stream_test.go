@@ -0,0 +1,92 @@
+package toml
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecoderSeparator(t *testing.T) {
+	type entry struct {
+		Level   string `toml:"level"`
+		Message string `toml:"message"`
+	}
+	input := `level = "info"
+message = "started"
++++
+level = "error"
+message = "failed"
++++  
+
+`
+	d := NewDecoder(strings.NewReader(input)).Separator("+++")
+	var entries []entry
+	for d.More() {
+		var e entry
+		if err := d.Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	expected := []entry{{"info", "started"}, {"error", "failed"}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %v, got %v", expected, entries)
+	}
+	if err := d.Decode(&entry{}); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+
+	// front matter
+	d = NewDecoder(strings.NewReader("+++\ntitle = \"post\"\n+++\n# Post\n\n[link](url)\n")).Separator("+++")
+	m := map[string]interface{}{}
+	if err := d.Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m["title"] != "post" {
+		t.Errorf("unexpected front matter %v", m)
+	}
+
+	// errors are reported for each document, with positions in the document
+	d = NewDecoder(strings.NewReader("a = 1\n---\na = \n---\na = 3\n")).Separator("---")
+	var results []string
+	for d.More() {
+		m := map[string]int{}
+		if err := d.Decode(&m); err != nil {
+			results = append(results, err.Error())
+			continue
+		}
+		results = append(results, strings.Repeat("a", m["a"]))
+	}
+	if expected := []string{"a", "(2, 1): expecting a value", "aaa"}; !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected %q, got %q", expected, results)
+	}
+}
+
+func TestEncoderSeparator(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf).Separator("+++")
+	for _, v := range []interface{}{map[string]int{"a": 1}, map[string]int{}, map[string]int{"b": 2}} {
+		if err := e.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := "a = 1\n+++\n+++\nb = 2\n"
+	if buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+
+	d := NewDecoder(&buf).Separator("+++")
+	var documents []map[string]int
+	for d.More() {
+		m := map[string]int{}
+		if err := d.Decode(&m); err != nil {
+			t.Fatal(err)
+		}
+		documents = append(documents, m)
+	}
+	if len(documents) != 3 || documents[2]["b"] != 2 {
+		t.Errorf("unexpected documents %v", documents)
+	}
+}
@@ -0,0 +1,177 @@
+// Incremental writing of documents.
+
+package toml
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// StreamEncoder writes a document piece by piece: its top-level keys, then
+// tables and the elements of arrays of tables one at a time, each piece being
+// written to the output as soon as it is given. Export jobs can write millions
+// of records as an array of tables without holding them in memory:
+//
+//	s := toml.NewStreamEncoder(w)
+//	if err := s.Encode(header); err != nil {
+//	  return err
+//	}
+//	if err := s.BeginTableArray(toml.Key{"rows"}); err != nil {
+//	  return err
+//	}
+//	for rows.Next() {
+//	  ...
+//	  if err := s.Element(row); err != nil {
+//	    return err
+//	  }
+//	}
+//
+// Values are encoded as by Marshal, and the output of a StreamEncoder is the
+// document Marshal would write for them, with the tables in the order they are
+// given. The StreamEncoder checks that the
+// document stays valid, rejecting tables defined twice, but it does not look
+// into the elements of arrays of tables, whose tables are not retained: the
+// tables below an array of tables must be part of its elements.
+type StreamEncoder struct {
+	e     *Encoder
+	array Key // array of tables the elements are added to, nil if none
+	// what the keys written at the top of the document and the headers
+	// written are: "value", "table" or "array of tables"
+	defined map[string]string
+	// whether anything was written, and whether a table was
+	started, tables bool
+}
+
+// NewStreamEncoder returns a StreamEncoder writing to w with the default
+// options of Encoders.
+func NewStreamEncoder(w io.Writer) *StreamEncoder {
+	return NewEncoder(w).Stream()
+}
+
+// Stream returns a StreamEncoder writing to the output of e, with its
+// options. e must not be used while the StreamEncoder is.
+func (e *Encoder) Stream() *StreamEncoder {
+	return &StreamEncoder{e: e, defined: map[string]string{}}
+}
+
+// Encode writes the keys of v, a struct or a map, at the root of the document.
+// Its key/value pairs, which cannot follow tables, must be written before any
+// call to Table or BeginTableArray.
+func (s *StreamEncoder) Encode(v interface{}) error {
+	t, err := s.e.fragmentTree(nil, v)
+	if err != nil {
+		return err
+	}
+	kinds := make(map[string]string, len(t.values))
+	tables := false
+	for k, node := range t.values {
+		switch node.(type) {
+		case *Tree:
+			kinds[k] = "table"
+		case []*Tree:
+			kinds[k] = "array of tables"
+		default:
+			kinds[k] = "value"
+			if s.tables {
+				return fmt.Errorf("cannot write key %s after tables", Key{k})
+			}
+		}
+		if _, ok := s.defined[Key{k}.String()]; ok {
+			return fmt.Errorf("key %s is already defined", Key{k})
+		}
+		tables = tables || kinds[k] != "value"
+	}
+	for k, kind := range kinds {
+		s.defined[Key{k}.String()] = kind
+	}
+
+	var buf bytes.Buffer
+	if _, err := t.writeToOrdered(&buf, "", "", 0, s.e.arraysOneElementPerLine, s.e.order, s.e.indentation, s.e.layout, s.e.compactComments, s.e.tabularArrays, false); err != nil {
+		return err
+	}
+	b := buf.Bytes()
+	if !s.started {
+		b = bytes.TrimLeft(b, "\n")
+	}
+	s.array = nil
+	s.tables = s.tables || tables
+	return s.write(b, len(t.values) > 0)
+}
+
+// Table writes the table at key holding the keys of v, a struct or a map.
+func (s *StreamEncoder) Table(key Key, v interface{}) error {
+	if err := s.define(key, "table"); err != nil {
+		return err
+	}
+	s.array = nil
+	return s.writeTable("[", key, "]", v)
+}
+
+// BeginTableArray makes the following calls to Element add tables to the
+// array of tables at key. An array of tables can be continued after other
+// tables were written.
+func (s *StreamEncoder) BeginTableArray(key Key) error {
+	if err := s.define(key, "array of tables"); err != nil {
+		return err
+	}
+	s.array = key.Append()
+	return nil
+}
+
+// Element writes v, a struct or a map, as the next table of the array of
+// tables started by BeginTableArray.
+func (s *StreamEncoder) Element(v interface{}) error {
+	if s.array == nil {
+		return errors.New("no array of tables started with BeginTableArray")
+	}
+	return s.writeTable("[[", s.array, "]]", v)
+}
+
+// Record that the table or array of tables at key is written, checking that
+// the document stays valid.
+func (s *StreamEncoder) define(key Key, kind string) error {
+	if len(key) == 0 {
+		return errors.New("table key cannot be empty")
+	}
+	for i := 1; i < len(key); i++ {
+		if parent := s.defined[key[:i].String()]; parent != "" && parent != "table" {
+			return fmt.Errorf("cannot write %s %s below the %s %s", kind, key, parent, key[:i])
+		}
+	}
+	// arrays of tables can be continued
+	if defined := s.defined[key.String()]; defined != "" && (defined != kind || kind != "array of tables") {
+		return fmt.Errorf("key %s is already defined", key)
+	}
+	s.defined[key.String()] = kind
+	return nil
+}
+
+func (s *StreamEncoder) writeTable(open string, key Key, close string, v interface{}) error {
+	t, err := s.e.fragmentTree(key, v)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if s.started {
+		buf.WriteString(strings.Repeat("\n", s.e.layout.blankLines))
+	}
+	if err := s.e.writeFragment(&buf, open, key, close, t); err != nil {
+		return err
+	}
+	s.tables = true
+	return s.write(buf.Bytes(), true)
+}
+
+func (s *StreamEncoder) write(b []byte, started bool) error {
+	if err := s.e.layout.validate(); err != nil {
+		return err
+	}
+	if _, err := s.e.w.Write(b); err != nil {
+		return err
+	}
+	s.started = s.started || started
+	return nil
+}
@@ -0,0 +1,103 @@
+package toml
+
+import (
+	"bytes"
+	"testing"
+)
+
+type streamHeader struct {
+	Title  string `toml:"title"`
+	Origin struct {
+		Name string `toml:"name"`
+	} `toml:"origin"`
+}
+
+type streamRow struct {
+	ID   int      `toml:"id"`
+	Tags []string `toml:"tags"`
+	Meta struct {
+		Owner string `toml:"owner"`
+	} `toml:"meta"`
+}
+
+func TestStreamEncoder(t *testing.T) {
+	var header streamHeader
+	header.Title = "export"
+	header.Origin.Name = "db"
+	rows := []streamRow{{ID: 1, Tags: []string{"a"}}, {ID: 2}}
+	rows[1].Meta.Owner = "me"
+
+	var buf bytes.Buffer
+	s := NewStreamEncoder(&buf)
+	if err := s.Encode(header); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.BeginTableArray(Key{"rows"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := s.Element(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected, err := Marshal(struct {
+		streamHeader
+		Rows []streamRow `toml:"rows"`
+	}{header, rows})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != string(expected) {
+		t.Errorf("expected\n%s\ngot\n%s", expected, buf.String())
+	}
+}
+
+func TestStreamEncoderTables(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewEncoder(&buf).Indentation("").Stream()
+	if err := s.BeginTableArray(Key{"a", "rows"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Element(map[string]int{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Table(Key{"b"}, map[string]string{"k": "v"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.BeginTableArray(Key{"a", "rows"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Element(map[string]int{"n": 2}); err != nil {
+		t.Fatal(err)
+	}
+	expected := "[[a.rows]]\nn = 1\n\n[b]\nk = \"v\"\n\n[[a.rows]]\nn = 2\n"
+	if buf.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, buf.String())
+	}
+	tree, err := LoadBytes(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows := tree.GetPath([]string{"a", "rows"}).([]*Tree); len(rows) != 2 {
+		t.Errorf("expected 2 rows, got %d", len(rows))
+	}
+
+	err = s.Encode(map[string]int{"late": 1})
+	assertErrorString(t, "cannot write key late after tables", err)
+	err = s.Table(Key{"b"}, map[string]int{})
+	assertErrorString(t, "key b is already defined", err)
+	err = s.BeginTableArray(Key{"b"})
+	assertErrorString(t, "key b is already defined", err)
+	err = s.Table(Key{"a", "rows", "meta"}, map[string]int{})
+	assertErrorString(t, "cannot write table a.rows.meta below the array of tables a.rows", err)
+	err = NewStreamEncoder(&buf).Element(map[string]int{"n": 3})
+	assertErrorString(t, "no array of tables started with BeginTableArray", err)
+
+	s = NewStreamEncoder(&buf)
+	if err := s.Encode(map[string]int{"x": 1}); err != nil {
+		t.Fatal(err)
+	}
+	err = s.Table(Key{"x", "y"}, map[string]int{})
+	assertErrorString(t, "cannot write table x.y below the value x", err)
+}
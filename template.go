@@ -0,0 +1,203 @@
+// Generation of example configuration files.
+
+package toml
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+)
+
+// GenerateTemplate returns an example configuration file for v, a struct or
+// a pointer to a struct, such as the config.example.toml file of a program.
+// Every key v is decoded from is written, in the order of the fields, below
+// the text of its comment tag.
+//
+// Keys take the value of their field in v when it is not zero, and else the
+// value of their default tag. Optional keys having neither are written
+// commented out with the zero value of their type, ready to be filled in, as
+// are the tables holding only such keys. Keys tagged as required are never
+// commented out, and their comment says they are required.
+//
+// Slices of structs are written as arrays of tables, holding the elements of
+// their field in v, or else a single commented out table listing their keys.
+// Maps are written as tables holding the entries of their field in v.
+func GenerateTemplate(v interface{}) ([]byte, error) {
+	mval := reflect.ValueOf(v)
+	for mval.Kind() == reflect.Ptr {
+		if mval.IsNil() {
+			mval = reflect.Zero(mval.Type().Elem())
+		} else {
+			mval = mval.Elem()
+		}
+	}
+	if mval.Kind() != reflect.Struct || !isTree(mval.Type()) {
+		return nil, errors.New("only a struct or a pointer to a struct can be used as a template")
+	}
+	g := templateGenerator{e: NewEncoder(nil).Order(OrderPreserve)}
+	tree := g.e.nextTree()
+	if err := g.table(tree, mval); err != nil {
+		return nil, err
+	}
+	commentTables(tree)
+	var buf bytes.Buffer
+	if _, err := tree.writeToOrdered(&buf, "", "", 0, false, OrderPreserve, g.e.indentation, g.e.layout, false, false, false); err != nil {
+		return nil, err
+	}
+	return bytes.TrimLeft(buf.Bytes(), "\n"), nil
+}
+
+type templateGenerator struct {
+	e *Encoder // converts values, and numbers the lines of the template
+}
+
+// Set the keys of the struct mval in t.
+func (g *templateGenerator) table(t *Tree, mval reflect.Value) error {
+	for _, f := range promotedFields(mval.Type(), g.e.annotation).fields {
+		fval, _ := fieldByIndex(mval, f.index, false)
+		if !fval.IsValid() {
+			// promoted from a nil embedded pointer
+			fval = reflect.Zero(f.Type)
+		}
+		key := []string{f.opts.name}
+		if f.path != nil {
+			key = f.path
+		}
+		g.e.path = append(g.e.path, key...)
+		node, keyCommented, err := g.node(t, fval, f)
+		g.e.path = g.e.path[:len(g.e.path)-len(key)]
+		if err != nil {
+			return err
+		}
+		if node == nil {
+			continue
+		}
+		comment := f.opts.comment
+		if f.opts.required {
+			if comment != "" {
+				comment += "\n"
+			}
+			comment += "Required."
+			keyCommented = false
+		}
+		created := 0
+		for created < len(key)-1 && t.GetPath(key[:created+1]) != nil {
+			created++
+		}
+		t.SetPathWithOptions(key, SetOptions{
+			Comment:   comment,
+			Commented: keyCommented,
+			Multiline: f.opts.multiline,
+			Literal:   f.opts.literal,
+		}, node)
+		// tables created for dotted names go where their first key is
+		for i := created + 1; i < len(key); i++ {
+			t.SetPositionPath(key[:i], t.GetPositionPath(key))
+		}
+	}
+	return nil
+}
+
+// Comment out the tables of t whose keys are all commented out.
+func commentTables(t *Tree) bool {
+	commented := len(t.values) > 0
+	for _, node := range t.values {
+		switch n := node.(type) {
+		case *Tree:
+			n.commented = commentTables(n) || n.commented
+			commented = commented && n.commented
+		case []*Tree:
+			for _, element := range n {
+				element.commented = commentTables(element) || element.commented
+				commented = commented && element.commented
+			}
+		case *tomlValue:
+			commented = commented && n.commented
+		}
+	}
+	return commented
+}
+
+// Return the node of the field f of value fval, and whether it is commented
+// out. The node is nil for values of unknown types, such as nil interfaces.
+func (g *templateGenerator) node(parent *Tree, fval reflect.Value, f structField) (interface{}, bool, error) {
+	for fval.Kind() == reflect.Ptr && !isCustomMarshaler(fval.Type()) && !isTextMarshaler(fval.Type()) {
+		if fval.IsNil() {
+			fval = reflect.Zero(fval.Type().Elem())
+		} else {
+			fval = fval.Elem()
+		}
+	}
+	mtype := fval.Type()
+	if templateTable(mtype) {
+		tree := g.e.nextTree()
+		err := g.table(tree, fval)
+		return g.e.wrapTomlValue(tree, parent), false, err
+	}
+	if (mtype.Kind() == reflect.Slice || mtype.Kind() == reflect.Array) && templateTable(derefType(mtype.Elem())) {
+		elements := make([]reflect.Value, fval.Len())
+		for i := range elements {
+			elements[i] = reflect.Indirect(fval.Index(i))
+		}
+		commented := len(elements) == 0
+		if commented {
+			elements = append(elements, reflect.Zero(derefType(mtype.Elem())))
+		}
+		trees := make([]*Tree, len(elements))
+		for i, element := range elements {
+			if !element.IsValid() {
+				element = reflect.Zero(derefType(mtype.Elem()))
+			}
+			trees[i] = g.e.nextTree()
+			if err := g.table(trees[i], element); err != nil {
+				return nil, false, err
+			}
+		}
+		return g.e.wrapTomlValue(trees, parent), commented, nil
+	}
+
+	commented := false
+	if isZero(fval) {
+		if f.defaultVal.IsValid() {
+			fval = reflect.Indirect(f.defaultVal)
+		} else {
+			commented = true
+		}
+	}
+	if fval.Kind() == reflect.Interface {
+		if fval.IsNil() {
+			return nil, false, nil
+		}
+		fval = fval.Elem()
+	}
+	var val interface{}
+	var err error
+	switch {
+	case f.opts.bytes != "" && isByteSlice(fval.Type()):
+		val, err = g.e.bytesToToml(fval.Type(), fval, f.opts.bytes)
+	case f.opts.layout != "" && isTimeField(fval.Type()):
+		val = g.e.timeToLayout(fval, f.opts.layout)
+	default:
+		val, err = g.e.valueToToml(fval.Type(), fval)
+	}
+	if err == errSkipValue {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if f.opts.base != 0 {
+		val = withBase(val, f.opts.base)
+	}
+	if f.opts.asString {
+		val = scalarToString(val)
+	}
+	return g.e.wrapTomlValue(val, parent), commented, nil
+}
+
+// Whether values of mtype are written as tables whose keys are listed.
+func templateTable(mtype reflect.Type) bool {
+	return mtype.Kind() == reflect.Struct && isTree(mtype) && !isOptional(mtype) && mtype != reflect.TypeOf(Tree{}) &&
+		!isCustomMarshaler(mtype) && !isTextMarshaler(mtype) &&
+		!isCustomMarshaler(reflect.PtrTo(mtype)) && !isTextMarshaler(reflect.PtrTo(mtype))
+}
@@ -0,0 +1,130 @@
+package toml
+
+import (
+	"testing"
+	"time"
+)
+
+type templateDatabase struct {
+	Host string `comment:"host of the database server" required:"true"`
+	Port int    `default:"5432"`
+	User string
+}
+
+type templateBackend struct {
+	Name string
+	URL  string `toml:"url"`
+}
+
+type templateConfig struct {
+	Title   string        `comment:"title of the site"`
+	Debug   bool          `toml:"debug" comment:"verbose logging"`
+	Timeout time.Duration `default:"5s"`
+	Mode    int           `toml:",hex" default:"420"`
+	Tags    []string
+	DB      templateDatabase `toml:"database"`
+	Cache   struct {
+		Size int
+		Path string
+	}
+	Backends []templateBackend `comment:"load balanced backends"`
+	Any      interface{}
+	Level    string `toml:"log.level"`
+}
+
+func TestGenerateTemplate(t *testing.T) {
+	b, err := GenerateTemplate(&templateConfig{Title: "my site"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `# title of the site
+Title = "my site"
+
+# verbose logging
+# debug = false
+Timeout = "5s"
+Mode = 0x1a4
+# Tags = []
+
+[database]
+
+  # host of the database server
+  # Required.
+  Host = ""
+  Port = 5432
+  # User = ""
+
+# [Cache]
+  # Size = 0
+  # Path = ""
+
+# load balanced backends
+# [[Backends]]
+  # Name = ""
+  # url = ""
+
+# [log]
+  # level = ""
+`
+	if string(b) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, b)
+	}
+
+	var config templateConfig
+	if err := Unmarshal(b, &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Title != "my site" || config.Timeout != 5*time.Second || config.DB.Port != 5432 {
+		t.Errorf("unexpected decoded template %+v", config)
+	}
+}
+
+func TestGenerateTemplateValues(t *testing.T) {
+	b, err := GenerateTemplate(templateConfig{
+		Backends: []templateBackend{{Name: "a", URL: "http://a"}, {Name: "b"}},
+		Level:    "debug",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `# title of the site
+# Title = ""
+
+# verbose logging
+# debug = false
+Timeout = "5s"
+Mode = 0x1a4
+# Tags = []
+
+[database]
+
+  # host of the database server
+  # Required.
+  Host = ""
+  Port = 5432
+  # User = ""
+
+# [Cache]
+  # Size = 0
+  # Path = ""
+
+# load balanced backends
+[[Backends]]
+  Name = "a"
+  url = "http://a"
+
+[[Backends]]
+  Name = "b"
+  # url = ""
+
+[log]
+  level = "debug"
+`
+	if string(b) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, b)
+	}
+
+	if _, err := GenerateTemplate(map[string]int{}); err == nil {
+		t.Error("expected an error for a map")
+	}
+}
@@ -17,15 +17,39 @@ type tomlValue struct {
 	multiline bool
 	literal   bool
 	position  Position
-}
-
-// Tree is the result of the parsing of a TOML file.
+	// positions of the elements of an array value, when parsed
+	elementPositions []Position
+	// width long strings are wrapped at when written, if not zero
+	wrapWidth int
+	// base integers are written in, if not zero
+	base int
+	// size of the groups of digits of integers, separated by underscores, if
+	// not zero
+	grouping int
+	// style of the value in the document it was parsed from, which trees do
+	// not keep when written, but encoders preserving the style of decoded
+	// structs do
+	style valueStyle
+	// name of the document the value comes from, if not that of its table
+	source string
+	// format floats are written in, if not the default
+	floatFormat *floatFormat
+	// number of elements and width past which arrays are written with one
+	// element per line, if not zero
+	arrayWrapItems int
+	arrayWrapWidth int
+}
+
+// Tree is the result of the parsing of a TOML file. A Tree can be read by
+// several goroutines at once, including to marshal or unmarshal it, but must
+// not be modified while it is read.
 type Tree struct {
 	values    map[string]interface{} // string -> *tomlValue, *Tree, []*Tree
 	comment   string
 	commented bool
 	inline    bool
 	position  Position
+	source    string // name of the document the tree comes from, if known
 }
 
 func newTree() *Tree {
@@ -359,6 +383,10 @@ func (t *Tree) SetPathWithOptions(keys []string, opts SetOptions, value interfac
 		for i := range v {
 			v[i].commented = opts.Commented
 		}
+		// the comment is written once, above the first table
+		if len(v) > 0 {
+			v[0].comment = opts.Comment
+		}
 		toInsert = value
 	case *tomlValue:
 		v.comment = opts.Comment
@@ -466,25 +494,49 @@ func (t *Tree) createSubTree(keys []string, pos Position) error {
 
 // LoadBytes creates a Tree from a []byte.
 func LoadBytes(b []byte) (tree *Tree, err error) {
+	return loadBytes(b, DuplicateKeysError, parseOptions{})
+}
+
+// Valid reports whether b is a valid TOML document.
+func Valid(b []byte) bool {
+	_, err := LoadBytes(b)
+	return err == nil
+}
+
+func loadBytes(b []byte, duplicates DuplicateKeyPolicy, options parseOptions) (tree *Tree, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			if _, ok := r.(runtime.Error); ok {
 				panic(r)
 			}
+			if e, ok := r.(error); ok {
+				err = e
+				return
+			}
 			err = fmt.Errorf("%s", r)
 		}
 	}()
 
+	if b, err = checkEncoding(b, options.latin1); err != nil {
+		return nil, err
+	}
+	b = trimBOM(b)
+	tokens := lexTomlVersion(b, options.version)
+	defer putTokens(tokens)
+	tree = parseToml(b, tokens, duplicates, options)
+	return
+}
+
+// Remove the byte order mark b may start with.
+func trimBOM(b []byte) []byte {
 	if len(b) >= 4 && (hasUTF32BigEndianBOM4(b) || hasUTF32LittleEndianBOM4(b)) {
-		b = b[4:]
+		return b[4:]
 	} else if len(b) >= 3 && hasUTF8BOM3(b) {
-		b = b[3:]
+		return b[3:]
 	} else if len(b) >= 2 && (hasUTF16BigEndianBOM2(b) || hasUTF16LittleEndianBOM2(b)) {
-		b = b[2:]
+		return b[2:]
 	}
-
-	tree = parseToml(lexToml(b))
-	return
+	return b
 }
 
 func hasUTF16BigEndianBOM2(b []byte) bool {
@@ -522,12 +574,16 @@ func Load(content string) (tree *Tree, err error) {
 	return LoadBytes([]byte(content))
 }
 
-// LoadFile creates a Tree from a file.
+// LoadFile creates a Tree from a file, whose path is the source of the tree.
 func LoadFile(path string) (tree *Tree, err error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
-	return LoadReader(file)
+	tree, err = LoadReader(file)
+	if err == nil {
+		tree.source = path
+	}
+	return tree, err
 }
@@ -240,6 +240,24 @@ func TestTomlFromMap(t *testing.T) {
 	}
 }
 
+func TestTomlFromMapLocalTypes(t *testing.T) {
+	tree, err := Load("d = 1979-05-27\nt = 07:32:00\ndt = 1979-05-27T07:32:00\narr = [1979-05-27]\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := TreeFromMap(tree.ToMap())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	expected := "arr = [1979-05-27]\nd = 1979-05-27\ndt = 1979-05-27T07:32:00\nt = 07:32:00\n"
+	if result.String() != expected {
+		t.Errorf("expected %q, got %q", expected, result.String())
+	}
+	if _, ok := result.Get("d").(LocalDate); !ok {
+		t.Errorf("d should be a LocalDate, not %T", result.Get("d"))
+	}
+}
+
 func TestLoadBytesBOM(t *testing.T) {
 	payloads := [][]byte{
 		[]byte("\xFE\xFFhello=1"),
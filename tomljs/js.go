@@ -0,0 +1,100 @@
+//go:build js && wasm
+// +build js,wasm
+
+package tomljs
+
+import (
+	"strconv"
+	"syscall/js"
+	"time"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Register sets the format, toJSON, fromJSON, validate and parse functions on
+// obj. toJSON takes the indentation as an optional second argument.
+func Register(obj js.Value) {
+	obj.Set("format", stringFunc(func(args []js.Value) (interface{}, error) {
+		return Format(stringArg(args, 0))
+	}))
+	obj.Set("toJSON", stringFunc(func(args []js.Value) (interface{}, error) {
+		return ToJSON(stringArg(args, 0), stringArg(args, 1))
+	}))
+	obj.Set("fromJSON", stringFunc(func(args []js.Value) (interface{}, error) {
+		return FromJSON(stringArg(args, 0))
+	}))
+	obj.Set("validate", stringFunc(func(args []js.Value) (interface{}, error) {
+		messages, err := Validate(stringArg(args, 0))
+		if err != nil {
+			return nil, err
+		}
+		warnings := make([]interface{}, len(messages))
+		for i, m := range messages {
+			warnings[i] = m
+		}
+		return warnings, nil
+	}))
+	obj.Set("parse", stringFunc(func(args []js.Value) (interface{}, error) {
+		tree, err := toml.Load(stringArg(args, 0))
+		if err != nil {
+			return nil, err
+		}
+		return jsValue(tree.ToMap()), nil
+	}))
+}
+
+// Wrap f in a JavaScript function returning {result} or {error}. Errors are
+// not thrown: panicking in a js.Func would stop the Go program.
+func stringFunc(f func(args []js.Value) (interface{}, error)) js.Func {
+	return js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		result, err := f(args)
+		if err != nil {
+			return map[string]interface{}{"error": err.Error()}
+		}
+		return map[string]interface{}{"result": result}
+	})
+}
+
+// The i-th argument as a string, empty if missing or not a string.
+func stringArg(args []js.Value, i int) string {
+	if i >= len(args) || args[i].Type() != js.TypeString {
+		return ""
+	}
+	return args[i].String()
+}
+
+// Convert the values of Tree.ToMap to values js.ValueOf accepts. Integers
+// that do not fit in a JavaScript number become BigInts, offset date-times
+// become Dates, and local dates and times become strings.
+func jsValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = jsValue(e)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, e := range v {
+			s[i] = jsValue(e)
+		}
+		return s
+	case int64:
+		if v > 1<<53 || v < -(1<<53) {
+			return js.Global().Get("BigInt").Invoke(strconv.FormatInt(v, 10))
+		}
+		return float64(v)
+	case uint64:
+		if v > 1<<53 {
+			return js.Global().Get("BigInt").Invoke(strconv.FormatUint(v, 10))
+		}
+		return float64(v)
+	case time.Time:
+		return js.Global().Get("Date").New(v.Format(time.RFC3339Nano))
+	case toml.LocalDate, toml.LocalTime, toml.LocalDateTime:
+		return v.(interface{ String() string }).String()
+	default:
+		return v
+	}
+}
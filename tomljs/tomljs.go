@@ -0,0 +1,95 @@
+// Package tomljs exposes go-toml to JavaScript when compiled to WebAssembly,
+// to power browser-based TOML editors and playgrounds.
+//
+// The functions of this package work on strings only and never touch the file
+// system. When built for js/wasm, Register installs them on a JavaScript
+// object:
+//
+//	//go:build js && wasm
+//
+//	package main
+//
+//	import (
+//		"syscall/js"
+//
+//		"github.com/pelletier/go-toml/tomljs"
+//	)
+//
+//	func main() {
+//		toml := js.Global().Get("Object").New()
+//		tomljs.Register(toml)
+//		js.Global().Set("toml", toml)
+//		select {}
+//	}
+//
+// JavaScript code can then call toml.format(text), toml.toJSON(text),
+// toml.fromJSON(text), toml.validate(text) and toml.parse(text). Each returns
+// an object whose result property holds the result, or whose error property
+// holds the error message.
+package tomljs
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Format parses a TOML document and writes it back in the canonical format
+// of go-toml, keeping the order of its keys.
+func Format(input string) (string, error) {
+	tree, err := toml.Load(input)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Order(toml.OrderPreserve).Encode(tree); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// ToJSON converts a TOML document to JSON, indented with indent if not empty.
+func ToJSON(input, indent string) (string, error) {
+	tree, err := toml.Load(input)
+	if err != nil {
+		return "", err
+	}
+	var b []byte
+	if indent != "" {
+		b, err = json.MarshalIndent(tree.ToMap(), "", indent)
+	} else {
+		b, err = json.Marshal(tree.ToMap())
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// FromJSON converts a JSON object to a TOML document.
+func FromJSON(input string) (string, error) {
+	m := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(input), &m); err != nil {
+		return "", err
+	}
+	tree, err := toml.TreeFromMap(m)
+	if err != nil {
+		return "", err
+	}
+	return tree.ToTomlString()
+}
+
+// Validate checks that input is a valid TOML document and returns the
+// messages of the lint warnings found in it.
+func Validate(input string) ([]string, error) {
+	warnings, err := toml.Lint([]byte(input))
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]string, len(warnings))
+	for i, w := range warnings {
+		messages[i] = w.String()
+	}
+	return messages, nil
+}
@@ -0,0 +1,54 @@
+package tomljs
+
+import (
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	out, err := Format("b = 1\na   =  \"x\"\n[t]\nk=true\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "b = 1\na = \"x\"\n\n[t]\n  k = true\n"
+	if out != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	if _, err := Format("a = "); err == nil || err.Error() != "(1, 5): expecting a value" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	out, err := ToJSON("a = 1\n[t]\nk = [true]\n", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != `{"a":1,"t":{"k":[true]}}` {
+		t.Errorf("unexpected JSON %s", out)
+	}
+
+	out, err = FromJSON(`{"t": {"k": "v"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "\n[t]\n  k = \"v\"\n" {
+		t.Errorf("unexpected TOML %q", out)
+	}
+	if _, err := FromJSON(`[1]`); err == nil {
+		t.Error("expected an error for a JSON array")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	warnings, err := Validate("[t]\n[u]\n[t]\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("expected one warning, got %v", warnings)
+	}
+	if _, err := Validate("a = = 1"); err == nil {
+		t.Error("expected an error for an invalid document")
+	}
+}
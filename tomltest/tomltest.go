@@ -0,0 +1,216 @@
+// Package tomltest helps testing code generating TOML documents, by comparing
+// the documents it writes to expected ones, or to golden files:
+//
+//	func TestWriteConfig(t *testing.T) {
+//	  b, err := toml.Marshal(config)
+//	  if err != nil {
+//	    t.Fatal(err)
+//	  }
+//	  tomltest.RequireGolden(t, "testdata/config.toml", b, tomltest.IgnoreComments())
+//	}
+//
+// Documents are compared line by line, so that failures show the lines that
+// differ, or as data with IgnoreKeyOrder.
+package tomltest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+	"github.com/pelletier/go-toml/ast"
+)
+
+// UpdateEnv is the environment variable that makes RequireGolden write the
+// golden files instead of comparing documents to them, when not empty:
+//
+//	TOMLTEST_UPDATE=1 go test ./...
+const UpdateEnv = "TOMLTEST_UPDATE"
+
+// TB is the part of testing.TB used to report failures.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// Option configures how documents are compared.
+type Option func(*options)
+
+type options struct {
+	ignoreComments bool
+	ignoreKeyOrder bool
+}
+
+// IgnoreComments makes the comparison ignore comments, and the lines left
+// empty by removing them. Differences are reported with the line numbers of
+// the documents without comments.
+func IgnoreComments() Option {
+	return func(o *options) { o.ignoreComments = true }
+}
+
+// IgnoreKeyOrder makes the comparison ignore the order of keys and tables,
+// comparing the values of the documents as toml.Diff does. Their formatting
+// and comments are then ignored too.
+func IgnoreKeyOrder() Option {
+	return func(o *options) { o.ignoreKeyOrder = true }
+}
+
+// Compare compares the documents want and got, and returns a description of
+// their differences, empty if they are equal. Line endings are not compared.
+// An error is returned if one of the documents is invalid.
+func Compare(want, got string, opts ...Option) (string, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	docs := [2]string{want, got}
+	for i, name := range []string{"want", "got"} {
+		doc := strings.Replace(docs[i], "\r\n", "\n", -1)
+		f, err := ast.Parse([]byte(doc))
+		if err != nil {
+			return "", fmt.Errorf("%s is not a valid document: %s", name, err)
+		}
+		if o.ignoreComments {
+			doc = removeComments(doc, f.Comments)
+		}
+		docs[i] = doc
+	}
+
+	if o.ignoreKeyOrder {
+		wantTree, _ := toml.Load(docs[0])
+		gotTree, _ := toml.Load(docs[1])
+		var lines []string
+		for _, d := range toml.Diff(wantTree, gotTree) {
+			lines = append(lines, d.String())
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+	if docs[0] == docs[1] {
+		return "", nil
+	}
+	return diffLines(strings.Split(docs[0], "\n"), strings.Split(docs[1], "\n")), nil
+}
+
+// AssertEqualDocuments reports an error through t if the documents want and
+// got differ, as compared by Compare, and returns whether they are equal.
+func AssertEqualDocuments(t TB, want, got string, opts ...Option) bool {
+	t.Helper()
+	diff, err := Compare(want, got, opts...)
+	if err != nil {
+		t.Errorf("%s", err)
+		return false
+	}
+	if diff != "" {
+		t.Errorf("documents differ (-want +got):\n%s", diff)
+		return false
+	}
+	return true
+}
+
+// RequireEqualDocuments is the same as AssertEqualDocuments, but stops the
+// test if the documents differ.
+func RequireEqualDocuments(t TB, want, got string, opts ...Option) {
+	t.Helper()
+	diff, err := Compare(want, got, opts...)
+	if err != nil {
+		t.Fatalf("%s", err)
+	} else if diff != "" {
+		t.Fatalf("documents differ (-want +got):\n%s", diff)
+	}
+}
+
+// RequireGolden compares got to the document of the golden file at path, as
+// RequireEqualDocuments does, or writes got to the file, creating its
+// directory, if the environment variable of UpdateEnv is set.
+func RequireGolden(t TB, path string, got []byte, opts ...Option) {
+	t.Helper()
+	if os.Getenv(UpdateEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("%s", err)
+			return
+		}
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("%s", err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s (set %s to write the golden file)", err, UpdateEnv)
+		return
+	}
+	diff, err := Compare(string(want), string(got), opts...)
+	if err != nil {
+		t.Fatalf("%s", err)
+	} else if diff != "" {
+		t.Fatalf("document differs from %s (-want +got):\n%s", path, diff)
+	}
+}
+
+// Remove the comments of doc, and the lines holding only comments.
+func removeComments(doc string, comments []*ast.Comment) string {
+	var b strings.Builder
+	start := 0
+	for _, c := range comments {
+		lineStart := strings.LastIndexByte(doc[:c.Range.Start.Offset], '\n') + 1
+		before := doc[start:c.Range.Start.Offset]
+		if strings.TrimLeft(doc[lineStart:c.Range.Start.Offset], " \t\ufeff") == "" {
+			// drop the whole line, and its newline
+			before = doc[start:lineStart]
+			if c.Range.End.Offset < len(doc) {
+				c.Range.End.Offset++
+			}
+		} else {
+			before = strings.TrimRight(before, " \t")
+		}
+		b.WriteString(before)
+		start = c.Range.End.Offset
+	}
+	b.WriteString(doc[start:])
+	return b.String()
+}
+
+// Describe the differences between the lines of two documents, as the lines
+// to remove from want, prefixed by -, and to add, prefixed by +, with their
+// line numbers once normalized, from the longest common subsequence of their
+// lines.
+func diffLines(want, got []string) string {
+	// common[i][j] is the length of the longest common subsequence of
+	// want[i:] and got[j:]
+	common := make([][]int, len(want)+1)
+	for i := range common {
+		common[i] = make([]int, len(got)+1)
+	}
+	for i := len(want) - 1; i >= 0; i-- {
+		for j := len(got) - 1; j >= 0; j-- {
+			if want[i] == got[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+	var buf bytes.Buffer
+	i, j := 0, 0
+	for i < len(want) || j < len(got) {
+		switch {
+		case i < len(want) && j < len(got) && want[i] == got[j]:
+			i++
+			j++
+		case j == len(got) || (i < len(want) && common[i+1][j] >= common[i][j+1]):
+			fmt.Fprintf(&buf, "-%d: %s\n", i+1, want[i])
+			i++
+		default:
+			fmt.Fprintf(&buf, "+%d: %s\n", j+1, got[j])
+			j++
+		}
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
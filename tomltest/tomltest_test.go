@@ -0,0 +1,107 @@
+package tomltest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TB recording the failures.
+type recorder struct {
+	errors []string
+	fatal  bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+	r.fatal = true
+}
+
+const document = `# the title
+title = "app"
+
+[server]
+host = "localhost" # the host
+port = 8080
+`
+
+func TestCompare(t *testing.T) {
+	for _, test := range []struct {
+		got  string
+		opts []Option
+		diff string
+	}{
+		{document, nil, ""},
+		{strings.Replace(document, "\n", "\r\n", -1), nil, ""},
+		{"title = \"app\"\n\n[server]\nhost = \"localhost\"\nport = 8080\n", nil, "-1: # the title\n-5: host = \"localhost\" # the host\n+4: host = \"localhost\""},
+		{"title = \"app\"\n\n[server]\nhost = \"localhost\"   # localhost\nport = 8080\n", []Option{IgnoreComments()}, ""},
+		{"title = \"app\"\n\n[server]\nhost = \"localhost\"\nport = 80\n", []Option{IgnoreComments()}, "-5: port = 8080\n+5: port = 80"},
+		{"server = { port = 8080, host = \"localhost\" }\ntitle = 'app'", []Option{IgnoreKeyOrder()}, ""},
+		{"title = \"app\"\n[server]\nport = 8081\nname = \"a\"", []Option{IgnoreKeyOrder()}, "- server.host = \"localhost\"\n+ server.name = \"a\"\n~ server.port = 8080 -> 8081"},
+	} {
+		diff, err := Compare(document, test.got, test.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff != test.diff {
+			t.Errorf("comparing to %q: expected diff:\n%s\ngot:\n%s", test.got, test.diff, diff)
+		}
+	}
+
+	if _, err := Compare(document, "a = "); err == nil || !strings.HasPrefix(err.Error(), "got is not a valid document: ") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestEqualDocuments(t *testing.T) {
+	r := &recorder{}
+	if !AssertEqualDocuments(r, document, document) || len(r.errors) != 0 {
+		t.Errorf("unexpected failures %v", r.errors)
+	}
+	if AssertEqualDocuments(r, document, "title = \"app\"", IgnoreKeyOrder()) || r.fatal {
+		t.Error("expected a failure, not fatal")
+	}
+	RequireEqualDocuments(r, document, "title = \"app\"", IgnoreKeyOrder())
+	expected := "documents differ (-want +got):\n- server = { host = \"localhost\", port = 8080 }"
+	if len(r.errors) != 2 || r.errors[1] != expected || !r.fatal {
+		t.Errorf("expected error %q, got %q", expected, r.errors)
+	}
+}
+
+func TestRequireGolden(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tomltest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "testdata", "config.toml")
+
+	r := &recorder{}
+	RequireGolden(r, path, []byte(document))
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "set TOMLTEST_UPDATE to write the golden file") {
+		t.Errorf("unexpected errors %q", r.errors)
+	}
+
+	os.Setenv(UpdateEnv, "1")
+	r = &recorder{}
+	RequireGolden(r, path, []byte(document))
+	os.Unsetenv(UpdateEnv)
+	if b, err := ioutil.ReadFile(path); err != nil || string(b) != document || len(r.errors) != 0 {
+		t.Fatalf("golden file not written: %v, %q", err, r.errors)
+	}
+
+	RequireGolden(r, path, []byte(strings.Replace(document, "8080", "80", 1)))
+	expected := "document differs from " + path + " (-want +got):\n-6: port = 8080\n+6: port = 80"
+	if len(r.errors) != 1 || r.errors[0] != expected {
+		t.Errorf("expected error %q, got %q", expected, r.errors)
+	}
+}
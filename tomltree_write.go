@@ -11,6 +11,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type valueComplexity int
@@ -18,6 +19,7 @@ type valueComplexity int
 const (
 	valueSimple valueComplexity = iota + 1
 	valueComplex
+	valueTabular // array of tables written as aligned inline tables
 )
 
 type sortNode struct {
@@ -60,9 +62,8 @@ func encodeMultilineTomlString(value string, commented string) string {
 		case '\\':
 			b.WriteString(`\`)
 		default:
-			intRr := uint16(rr)
-			if intRr < 0x001F {
-				b.WriteString(fmt.Sprintf("\\u%0.4X", intRr))
+			if rr < 0x20 || rr == 0x7F {
+				b.WriteString(fmt.Sprintf("\\u%0.4X", rr))
 			} else {
 				b.WriteRune(rr)
 			}
@@ -73,6 +74,9 @@ func encodeMultilineTomlString(value string, commented string) string {
 
 // Encodes a string to a TOML-compliant string value
 func encodeTomlString(value string) string {
+	if isPlainASCII(value) {
+		return value
+	}
 	var b bytes.Buffer
 
 	for _, rr := range value {
@@ -92,9 +96,8 @@ func encodeTomlString(value string) string {
 		case '\\':
 			b.WriteString(`\\`)
 		default:
-			intRr := uint16(rr)
-			if intRr < 0x001F {
-				b.WriteString(fmt.Sprintf("\\u%0.4X", intRr))
+			if rr < 0x20 || rr == 0x7F {
+				b.WriteString(fmt.Sprintf("\\u%0.4X", rr))
 			} else {
 				b.WriteRune(rr)
 			}
@@ -103,6 +106,145 @@ func encodeTomlString(value string) string {
 	return b.String()
 }
 
+// Whether s is made of printable ASCII characters that are not escaped in
+// basic strings.
+func isPlainASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c >= 0x7F || c == '"' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+// Write an encoded string as a multiline string whose lines are at most width
+// characters, using line-ending backslashes. Lines never start with spaces, as
+// those would be trimmed along with the line ending.
+func wrapTomlString(encoded string, width int, commented string) string {
+	// units are escape sequences or single characters
+	var units []string
+	for i := 0; i < len(encoded); {
+		size := 1
+		if encoded[i] == '\\' {
+			size = 2
+			if encoded[i+1] == 'u' {
+				size = 6
+			}
+		} else {
+			_, size = utf8.DecodeRuneInString(encoded[i:])
+		}
+		units = append(units, encoded[i:i+size])
+		i += size
+	}
+
+	max := width - 1 // room for the backslash
+	var lines []string
+	start, lastBreak, lineWidth := 0, -1, 0
+	for i, unit := range units {
+		if i > start && unit != " " && units[i-1] == " " {
+			lastBreak = i
+		}
+		if lineWidth+unitWidth(unit) <= max || i == start {
+			lineWidth += unitWidth(unit)
+			continue
+		}
+		end := i
+		if lastBreak > start {
+			end = lastBreak
+		} else if unit == " " {
+			lineWidth += unitWidth(unit) // cannot break before a space
+			continue
+		}
+		lines = append(lines, strings.Join(units[start:end], ""))
+		start = end
+		lineWidth = 0
+		for _, u := range units[start : i+1] {
+			lineWidth += unitWidth(u)
+		}
+	}
+	lines = append(lines, strings.Join(units[start:], ""))
+	return "\"\"\"\n" + commented + strings.Join(lines, "\\\n"+commented) + "\"\"\""
+}
+
+// Write a non-negative integer in base 2, 8 or 16 with its prefix, or in base
+// 10 otherwise, with its digits in groups of grouping digits if not zero.
+func formatInteger(value uint64, base int, grouping int) string {
+	switch base {
+	case 2:
+		return "0b" + groupDigits(strconv.FormatUint(value, 2), grouping)
+	case 8:
+		return "0o" + groupDigits(strconv.FormatUint(value, 8), grouping)
+	case 16:
+		return "0x" + groupDigits(strconv.FormatUint(value, 16), grouping)
+	}
+	return groupDigits(strconv.FormatUint(value, 10), grouping)
+}
+
+// Separate the digits of an integer, possibly negative, in groups of size
+// digits with underscores, such as 1_000_000.
+func groupDigits(digits string, size int) string {
+	sign := ""
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+	if size <= 0 || len(digits) <= size {
+		return sign + digits
+	}
+	var b strings.Builder
+	b.WriteString(sign)
+	first := len(digits) % size
+	if first == 0 {
+		first = size
+	}
+	b.WriteString(digits[:first])
+	for i := first; i < len(digits); i += size {
+		b.WriteByte('_')
+		b.WriteString(digits[i : i+size])
+	}
+	return b.String()
+}
+
+// Format of floats set with the options of an Encoder.
+type floatFormat struct {
+	precision    int
+	exponent     int
+	decimalPoint bool
+}
+
+// Write a finite float, with a decimal point or an exponent so that it is not
+// read back as an integer.
+func (f *floatFormat) format(value float64) string {
+	precision, bits := -1, 64
+	if f.precision > 0 {
+		precision = f.precision
+	} else if _, acc := big.NewFloat(value).Float32(); acc == big.Exact {
+		// the shortest representation of float32 values
+		bits = 32
+	}
+	if abs := math.Abs(value); f.exponent > 0 && abs != 0 &&
+		(abs >= math.Pow10(f.exponent) || abs < math.Pow10(-f.exponent)) {
+		s := strconv.FormatFloat(value, 'e', precision, bits)
+		if f.decimalPoint && !strings.Contains(s, ".") {
+			i := strings.IndexByte(s, 'e')
+			s = s[:i] + ".0" + s[i:]
+		}
+		return s
+	}
+	s := strconv.FormatFloat(value, 'f', precision, bits)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+// Width of a unit of an encoded string: escape sequences are written as is.
+func unitWidth(unit string) int {
+	if unit[0] == '\\' {
+		return len(unit)
+	}
+	return 1
+}
+
 func tomlTreeStringRepresentation(t *Tree, ord MarshalOrder) (string, error) {
 	var orderedVals []sortNode
 	switch ord {
@@ -138,10 +280,16 @@ func tomlValueStringRepresentation(v interface{}, commented string, indent strin
 
 	switch value := v.(type) {
 	case uint64:
-		return strconv.FormatUint(value, 10), nil
+		return formatInteger(value, tv.base, tv.grouping), nil
 	case int64:
-		return strconv.FormatInt(value, 10), nil
+		if value < 0 {
+			return groupDigits(strconv.FormatInt(value, 10), tv.grouping), nil
+		}
+		return formatInteger(uint64(value), tv.base, tv.grouping), nil
 	case float64:
+		if tv.floatFormat != nil && !math.IsNaN(value) && !math.IsInf(value, 0) {
+			return tv.floatFormat.format(value), nil
+		}
 		// Default bit length is full 64
 		bits := 64
 		// Float panics if nan is used
@@ -158,7 +306,7 @@ func tomlValueStringRepresentation(v interface{}, commented string, indent strin
 		return strings.ToLower(strconv.FormatFloat(value, 'f', -1, bits)), nil
 	case string:
 		if tv.multiline {
-			if tv.literal {
+			if tv.literal && !strings.Contains(value, "'''") {
 				b := strings.Builder{}
 				b.WriteString("'''\n")
 				b.Write([]byte(value))
@@ -168,7 +316,14 @@ func tomlValueStringRepresentation(v interface{}, commented string, indent strin
 				return "\"\"\"\n" + encodeMultilineTomlString(value, commented) + "\"\"\"", nil
 			}
 		}
-		return "\"" + encodeTomlString(value) + "\"", nil
+		if tv.literal && canBeLiteral(value) {
+			return "'" + value + "'", nil
+		}
+		encoded := encodeTomlString(value)
+		if tv.wrapWidth > 0 && utf8.RuneCountInString(encoded)+2 > tv.wrapWidth {
+			return wrapTomlString(encoded, tv.wrapWidth, commented), nil
+		}
+		return "\"" + encoded + "\"", nil
 	case []byte:
 		b, _ := v.([]byte)
 		return string(b), nil
@@ -197,13 +352,16 @@ func tomlValueStringRepresentation(v interface{}, commented string, indent strin
 		var values []string
 		for i := 0; i < rv.Len(); i++ {
 			item := rv.Index(i).Interface()
+			if _, ok := item.(*tomlValue); !ok && (tv.floatFormat != nil || tv.literal) {
+				item = &tomlValue{value: item, floatFormat: tv.floatFormat, literal: tv.literal}
+			}
 			itemRepr, err := tomlValueStringRepresentation(item, commented, indent, ord, arraysOneElementPerLine)
 			if err != nil {
 				return "", err
 			}
 			values = append(values, itemRepr)
 		}
-		if arraysOneElementPerLine && len(values) > 1 {
+		if len(values) > 1 && (arraysOneElementPerLine || tv.wrapsArray(values)) {
 			stringBuffer := bytes.Buffer{}
 			valueIndent := indent + `  ` // TODO: move that to a shared encoder state
 
@@ -225,6 +383,34 @@ func tomlValueStringRepresentation(v interface{}, commented string, indent strin
 	return "", fmt.Errorf("unsupported value type %T: %v", v, v)
 }
 
+// Whether an array whose elements are written as values is written with one
+// element per line, because it has too many elements or is too wide.
+func (tv *tomlValue) wrapsArray(values []string) bool {
+	if tv.arrayWrapItems > 0 && len(values) > tv.arrayWrapItems {
+		return true
+	}
+	if tv.arrayWrapWidth > 0 {
+		width := len("[]") + len(", ")*(len(values)-1)
+		for _, v := range values {
+			width += utf8.RuneCountInString(v)
+		}
+		return width > tv.arrayWrapWidth
+	}
+	return false
+}
+
+// Whether s can be written as a single-line literal string: literal strings
+// have no escape sequences, so they cannot contain single quotes nor control
+// characters other than tabs.
+func canBeLiteral(s string) bool {
+	for _, r := range s {
+		if r == '\'' || (r < 0x20 && r != '\t') || r == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
 func getTreeArrayLine(trees []*Tree) (line int) {
 	// Prevent returning 0 for empty trees
 	line = int(^uint(0) >> 1)
@@ -240,38 +426,45 @@ func getTreeArrayLine(trees []*Tree) (line int) {
 func sortByLines(t *Tree) (vals []sortNode) {
 	var (
 		line  int
-		lines []int
+		col   int
 		tv    *Tree
 		tom   *tomlValue
 		node  sortNode
+		lines = make(map[string]Position, len(t.values))
 	)
-	vals = make([]sortNode, 0)
-	m := make(map[int]sortNode)
+	vals = make([]sortNode, 0, len(t.values))
 
 	for k := range t.values {
 		v := t.values[k]
 		switch v.(type) {
 		case *Tree:
 			tv = v.(*Tree)
-			line = tv.position.Line
+			line, col = tv.position.Line, tv.position.Col
 			node = sortNode{key: k, complexity: valueComplex}
 		case []*Tree:
-			line = getTreeArrayLine(v.([]*Tree))
+			line, col = getTreeArrayLine(v.([]*Tree)), 0
 			node = sortNode{key: k, complexity: valueComplex}
 		default:
 			tom = v.(*tomlValue)
-			line = tom.position.Line
+			line, col = tom.position.Line, tom.position.Col
 			node = sortNode{key: k, complexity: valueSimple}
 		}
-		lines = append(lines, line)
+		lines[k] = Position{Line: line, Col: col}
 		vals = append(vals, node)
-		m[line] = node
 	}
-	sort.Ints(lines)
 
-	for i, line := range lines {
-		vals[i] = m[line]
-	}
+	// keys on the same line, as in inline tables, are ordered by column, and
+	// keys at the same position by name so that the output is deterministic
+	sort.Slice(vals, func(i, j int) bool {
+		a, b := lines[vals[i].key], lines[vals[j].key]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Col != b.Col {
+			return a.Col < b.Col
+		}
+		return vals[i].key < vals[j].key
+	})
 
 	return vals
 }
@@ -316,11 +509,32 @@ func sortAlphabetical(t *Tree) (vals []sortNode) {
 	return vals
 }
 
+// Layout of the key/value pairs and tables written by writeToOrdered.
+type treeLayout struct {
+	// number of blank lines written before table headers, and the comments
+	// above them
+	blankLines int
+	// separator of keys and values, an equal sign surrounded by blanks
+	separator string
+}
+
+var defaultLayout = treeLayout{blankLines: 1, separator: " = "}
+
+func (l treeLayout) validate() error {
+	if l.blankLines < 0 {
+		return fmt.Errorf("invalid number of blank lines %d", l.blankLines)
+	}
+	if strings.Trim(l.separator, " \t") != "=" {
+		return fmt.Errorf("invalid key/value separator %q", l.separator)
+	}
+	return nil
+}
+
 func (t *Tree) writeTo(w io.Writer, indent, keyspace string, bytesCount int64, arraysOneElementPerLine bool) (int64, error) {
-	return t.writeToOrdered(w, indent, keyspace, bytesCount, arraysOneElementPerLine, OrderAlphabetical, "  ", false, false)
+	return t.writeToOrdered(w, indent, keyspace, bytesCount, arraysOneElementPerLine, OrderAlphabetical, "  ", defaultLayout, false, false, false)
 }
 
-func (t *Tree) writeToOrdered(w io.Writer, indent, keyspace string, bytesCount int64, arraysOneElementPerLine bool, ord MarshalOrder, indentString string, compactComments, parentCommented bool) (int64, error) {
+func (t *Tree) writeToOrdered(w io.Writer, indent, keyspace string, bytesCount int64, arraysOneElementPerLine bool, ord MarshalOrder, indentString string, layout treeLayout, compactComments, tabularArrays, parentCommented bool) (int64, error) {
 	var orderedVals []sortNode
 
 	switch ord {
@@ -330,8 +544,28 @@ func (t *Tree) writeToOrdered(w io.Writer, indent, keyspace string, bytesCount i
 		orderedVals = sortAlphabetical(t)
 	}
 
+	for i, node := range orderedVals {
+		if trees, ok := t.values[node.key].([]*Tree); ok && tabularArrays && !parentCommented && !t.commented && isTabular(trees) {
+			orderedVals[i].complexity = valueTabular
+		}
+	}
+	// values written after a table header would belong to that table
+	sort.SliceStable(orderedVals, func(i, j int) bool {
+		return orderedVals[i].complexity != valueComplex && orderedVals[j].complexity == valueComplex
+	})
+
 	for _, node := range orderedVals {
 		switch node.complexity {
+		case valueTabular:
+			repr, err := tabularRepresentation(t.values[node.key].([]*Tree), indent, indentString, ord)
+			if err != nil {
+				return bytesCount, err
+			}
+			writtenBytesCount, err := writeStrings(w, indent, quoteKeyIfNeeded(node.key), layout.separator, repr, "\n")
+			bytesCount += int64(writtenBytesCount)
+			if err != nil {
+				return bytesCount, err
+			}
 		case valueComplex:
 			k := node.key
 			v := t.values[k]
@@ -348,13 +582,10 @@ func (t *Tree) writeToOrdered(w io.Writer, indent, keyspace string, bytesCount i
 				if !ok {
 					return bytesCount, fmt.Errorf("invalid value type at %s: %T", k, t.values[k])
 				}
+				blankLines := strings.Repeat("\n", layout.blankLines)
 				if tv.comment != "" {
-					comment := strings.Replace(tv.comment, "\n", "\n"+indent+"#", -1)
-					start := "# "
-					if strings.HasPrefix(comment, "#") {
-						start = ""
-					}
-					writtenBytesCountComment, errc := writeStrings(w, "\n", indent, start, comment)
+					writtenBytesCountComment, errc := writeStrings(w, blankLines, formatComment(tv.comment, indent), "\n")
+					blankLines = ""
 					bytesCount += int64(writtenBytesCountComment)
 					if errc != nil {
 						return bytesCount, errc
@@ -365,28 +596,37 @@ func (t *Tree) writeToOrdered(w io.Writer, indent, keyspace string, bytesCount i
 				if parentCommented || t.commented || tv.commented {
 					commented = "# "
 				}
-				writtenBytesCount, err := writeStrings(w, "\n", indent, commented, "[", combinedKey, "]\n")
+				writtenBytesCount, err := writeStrings(w, blankLines, indent, commented, "[", combinedKey, "]\n")
 				bytesCount += int64(writtenBytesCount)
 				if err != nil {
 					return bytesCount, err
 				}
-				bytesCount, err = node.writeToOrdered(w, indent+indentString, combinedKey, bytesCount, arraysOneElementPerLine, ord, indentString, compactComments, parentCommented || t.commented || tv.commented)
+				bytesCount, err = node.writeToOrdered(w, indent+indentString, combinedKey, bytesCount, arraysOneElementPerLine, ord, indentString, layout, compactComments, tabularArrays, parentCommented || t.commented || tv.commented)
 				if err != nil {
 					return bytesCount, err
 				}
 			case []*Tree:
 				for _, subTree := range node {
+					blankLines := strings.Repeat("\n", layout.blankLines)
+					if subTree.comment != "" {
+						writtenBytesCountComment, errc := writeStrings(w, blankLines, formatComment(subTree.comment, indent), "\n")
+						blankLines = ""
+						bytesCount += int64(writtenBytesCountComment)
+						if errc != nil {
+							return bytesCount, errc
+						}
+					}
 					var commented string
 					if parentCommented || t.commented || subTree.commented {
 						commented = "# "
 					}
-					writtenBytesCount, err := writeStrings(w, "\n", indent, commented, "[[", combinedKey, "]]\n")
+					writtenBytesCount, err := writeStrings(w, blankLines, indent, commented, "[[", combinedKey, "]]\n")
 					bytesCount += int64(writtenBytesCount)
 					if err != nil {
 						return bytesCount, err
 					}
 
-					bytesCount, err = subTree.writeToOrdered(w, indent+indentString, combinedKey, bytesCount, arraysOneElementPerLine, ord, indentString, compactComments, parentCommented || t.commented || subTree.commented)
+					bytesCount, err = subTree.writeToOrdered(w, indent+indentString, combinedKey, bytesCount, arraysOneElementPerLine, ord, indentString, layout, compactComments, tabularArrays, parentCommented || t.commented || subTree.commented)
 					if err != nil {
 						return bytesCount, err
 					}
@@ -409,11 +649,6 @@ func (t *Tree) writeToOrdered(w io.Writer, indent, keyspace string, bytesCount i
 			}
 
 			if v.comment != "" {
-				comment := strings.Replace(v.comment, "\n", "\n"+indent+"#", -1)
-				start := "# "
-				if strings.HasPrefix(comment, "#") {
-					start = ""
-				}
 				if !compactComments {
 					writtenBytesCountComment, errc := writeStrings(w, "\n")
 					bytesCount += int64(writtenBytesCountComment)
@@ -421,7 +656,7 @@ func (t *Tree) writeToOrdered(w io.Writer, indent, keyspace string, bytesCount i
 						return bytesCount, errc
 					}
 				}
-				writtenBytesCountComment, errc := writeStrings(w, indent, start, comment, "\n")
+				writtenBytesCountComment, errc := writeStrings(w, formatComment(v.comment, indent), "\n")
 				bytesCount += int64(writtenBytesCountComment)
 				if errc != nil {
 					return bytesCount, errc
@@ -429,7 +664,7 @@ func (t *Tree) writeToOrdered(w io.Writer, indent, keyspace string, bytesCount i
 			}
 
 			quotedKey := quoteKeyIfNeeded(k)
-			writtenBytesCount, err := writeStrings(w, indent, commented, quotedKey, " = ", repr, "\n")
+			writtenBytesCount, err := writeStrings(w, indent, commented, quotedKey, layout.separator, repr, "\n")
 			bytesCount += int64(writtenBytesCount)
 			if err != nil {
 				return bytesCount, err
@@ -440,6 +675,96 @@ func (t *Tree) writeToOrdered(w io.Writer, indent, keyspace string, bytesCount i
 	return bytesCount, nil
 }
 
+// Whether an array of tables can be written as aligned inline tables: all the
+// tables have the same keys, and neither sub-tables nor comments.
+func isTabular(trees []*Tree) bool {
+	if len(trees) == 0 {
+		return false
+	}
+	for _, tree := range trees {
+		if tree.commented || tree.comment != "" || len(tree.values) != len(trees[0].values) {
+			return false
+		}
+		for k, v := range tree.values {
+			value, ok := v.(*tomlValue)
+			if !ok || value.commented || value.comment != "" {
+				return false
+			}
+			if _, ok := trees[0].values[k]; !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Render an array of tables as an array of inline tables, one per line, with
+// the values of each key aligned in columns.
+func tabularRepresentation(trees []*Tree, indent, indentString string, ord MarshalOrder) (string, error) {
+	var columns []sortNode
+	switch ord {
+	case OrderPreserve:
+		columns = sortByLines(trees[0])
+	default:
+		columns = sortAlphabetical(trees[0])
+	}
+
+	cells := make([][]string, len(trees))
+	widths := make([]int, len(columns))
+	for i, tree := range trees {
+		cells[i] = make([]string, len(columns))
+		for j, column := range columns {
+			repr, err := tomlValueStringRepresentation(tree.values[column.key], "", "", ord, false)
+			if err != nil {
+				return "", err
+			}
+			cell := quoteKeyIfNeeded(column.key) + " = " + repr
+			if j < len(columns)-1 {
+				cell += ","
+			}
+			cells[i][j] = cell
+			if width := utf8.RuneCountInString(cell); width > widths[j] {
+				widths[j] = width
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString("[\n")
+	for _, row := range cells {
+		b.WriteString(indent + indentString + "{ ")
+		for j, cell := range row {
+			b.WriteString(cell)
+			padding := widths[j] - utf8.RuneCountInString(cell)
+			if j < len(row)-1 {
+				padding++
+			}
+			b.WriteString(strings.Repeat(" ", padding))
+		}
+		b.WriteString(" },\n")
+	}
+	b.WriteString(indent + "]")
+	return b.String(), nil
+}
+
+// Render a comment, possibly made of several lines, written above a key or a
+// table header. Lines not starting with # are prefixed with "# ", or only
+// with "#" if they already start with a space.
+func formatComment(comment, indent string) string {
+	lines := strings.Split(comment, "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "#"):
+		case line == "" || line[0] == ' ' || line[0] == '\t':
+			line = "#" + line
+		default:
+			line = "# " + line
+		}
+		lines[i] = indent + line
+	}
+	return strings.Join(lines, "\n")
+}
+
 // quote a key if it does not fit the bare key format (A-Za-z0-9_-)
 // quoted keys use the same rules as strings
 func quoteKeyIfNeeded(k string) string {
@@ -364,6 +364,39 @@ c = nan`
 	}
 }
 
+func TestTreeWriteToIntegerBases(t *testing.T) {
+	doc := `big = 0xffff_ffff_ffff_ffff
+bin = 0b101
+dec = 1_000
+hex = 0xDEAD
+inline = { a = 0o17, b = 2 }
+list = [0x1, 2]
+oct = 0o755
+`
+	tree, err := Load(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	str, err := tree.ToTomlString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `big = 0xffffffffffffffff
+bin = 0b101
+dec = 1000
+hex = 0xdead
+list = [1, 2]
+oct = 0o755
+
+[inline]
+  a = 0o17
+  b = 2
+`
+	if str != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, str)
+	}
+}
+
 func TestOrderedEmptyTrees(t *testing.T) {
 	type val struct {
 		Key string `toml:"key"`
@@ -0,0 +1,105 @@
+// Tomlyaml converts TOML to YAML, and YAML to TOML.
+//
+// Usage:
+//
+//	tomlyaml [file.toml] > file.yaml
+//	tomlyaml -reverse [-nulls error|omit|empty] [-keys error|string] [-anchors error|expand] [file.yaml] > file.toml
+//
+// The document is read from the file, or from the standard input if no file
+// is given. The -nulls, -keys and -anchors flags set how the YAML nulls, map
+// keys that are not strings and aliases, which TOML cannot express, are
+// converted. By default documents using them are rejected.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pelletier/go-toml/tomlyaml"
+)
+
+func main() {
+	reverse := flag.Bool("reverse", false, "convert YAML to TOML")
+	nulls := flag.String("nulls", "error", "YAML nulls: error, omit or empty (string)")
+	keys := flag.String("keys", "error", "YAML keys that are not strings: error or string")
+	anchors := flag.String("anchors", "error", "YAML aliases and merge keys: error or expand")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "tomlyaml converts TOML to YAML, and YAML to TOML with -reverse:")
+		fmt.Fprintln(os.Stderr, "  tomlyaml [file.toml] > file.yaml")
+		fmt.Fprintln(os.Stderr, "  tomlyaml -reverse [file.yaml] > file.toml")
+		fmt.Fprintln(os.Stderr, "")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	opts, err := options(*nulls, *keys, *anchors)
+	if err != nil {
+		printError(err, os.Stderr)
+		os.Exit(2)
+	}
+	os.Exit(processMain(*reverse, opts, flag.Args(), os.Stdin, os.Stdout, os.Stderr))
+}
+
+// Conversion options from the values of the flags.
+func options(nulls, keys, anchors string) (tomlyaml.Options, error) {
+	opts := tomlyaml.Options{}
+	switch nulls {
+	case "error":
+	case "omit":
+		opts.Nulls = tomlyaml.NullsOmit
+	case "empty":
+		opts.Nulls = tomlyaml.NullsEmptyString
+	default:
+		return opts, fmt.Errorf("unknown nulls policy %q", nulls)
+	}
+	switch keys {
+	case "error":
+	case "string":
+		opts.Keys = tomlyaml.KeysStringify
+	default:
+		return opts, fmt.Errorf("unknown keys policy %q", keys)
+	}
+	switch anchors {
+	case "error":
+	case "expand":
+		opts.Anchors = tomlyaml.AnchorsExpand
+	default:
+		return opts, fmt.Errorf("unknown anchors policy %q", anchors)
+	}
+	return opts, nil
+}
+
+func processMain(reverse bool, opts tomlyaml.Options, files []string, defaultInput io.Reader, output io.Writer, errorOutput io.Writer) int {
+	input := defaultInput
+	if len(files) > 0 {
+		file, err := os.Open(files[0])
+		if err != nil {
+			printError(err, errorOutput)
+			return 1
+		}
+		defer file.Close()
+		input = file
+	}
+	b, err := ioutil.ReadAll(input)
+	if err != nil {
+		printError(err, errorOutput)
+		return 1
+	}
+	if reverse {
+		b, err = tomlyaml.YAMLToTOML(b, opts)
+	} else {
+		b, err = tomlyaml.TOMLToYAML(b)
+	}
+	if err != nil {
+		printError(err, errorOutput)
+		return 1
+	}
+	output.Write(b)
+	return 0
+}
+
+func printError(err error, output io.Writer) {
+	io.WriteString(output, err.Error()+"\n")
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pelletier/go-toml/tomlyaml"
+)
+
+func expectProcessMainResults(t *testing.T, reverse bool, opts tomlyaml.Options, args []string, input string, exitCode int, expectedOutput string, expectedError string) {
+	outputBuffer := new(bytes.Buffer)
+	errorBuffer := new(bytes.Buffer)
+
+	returnCode := processMain(reverse, opts, args, strings.NewReader(input), outputBuffer, errorBuffer)
+
+	if outputBuffer.String() != expectedOutput {
+		t.Errorf("incorrect output:\n%s\n\nexpected output:\n%s", outputBuffer.String(), expectedOutput)
+	}
+	if errorBuffer.String() != expectedError {
+		t.Errorf("incorrect error:\n%s\n\nexpected error:\n%s", errorBuffer.String(), expectedError)
+	}
+	if returnCode != exitCode {
+		t.Error("incorrect return code:", returnCode, "expected", exitCode)
+	}
+}
+
+func TestProcessMain(t *testing.T) {
+	expectProcessMainResults(t, false, tomlyaml.Options{}, nil, "a = 1\n[t]\nb = \"x\"\n", 0, "a: 1\nt:\n  b: x\n", "")
+	expectProcessMainResults(t, true, tomlyaml.Options{}, nil, "a: 1\nt:\n  b: x\n", 0, "a = 1\n\n[t]\n  b = \"x\"\n", "")
+	expectProcessMainResults(t, true, tomlyaml.Options{}, nil, "a: ~\n", 1, "", "line 1: null cannot be converted\n")
+	expectProcessMainResults(t, true, tomlyaml.Options{Nulls: tomlyaml.NullsOmit}, nil, "a: ~\nb: 1\n", 0, "b = 1\n", "")
+	expectProcessMainResults(t, false, tomlyaml.Options{}, nil, "a = \n", 1, "", "(2, 1): expecting a value\n")
+
+	dir, err := ioutil.TempDir("", "tomlyaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.toml")
+	if err := ioutil.WriteFile(path, []byte("a = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectProcessMainResults(t, false, tomlyaml.Options{}, []string{path}, "", 0, "a: 1\n", "")
+}
+
+func TestOptions(t *testing.T) {
+	opts, err := options("empty", "string", "expand")
+	expected := tomlyaml.Options{Nulls: tomlyaml.NullsEmptyString, Keys: tomlyaml.KeysStringify, Anchors: tomlyaml.AnchorsExpand}
+	if err != nil || opts != expected {
+		t.Errorf("unexpected options %+v, %v", opts, err)
+	}
+	for _, args := range [][3]string{{"none", "error", "error"}, {"error", "int", "error"}, {"error", "error", "keep"}} {
+		if _, err := options(args[0], args[1], args[2]); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
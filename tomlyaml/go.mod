@@ -0,0 +1,10 @@
+module github.com/pelletier/go-toml/tomlyaml
+
+go 1.12
+
+require (
+	github.com/pelletier/go-toml v0.0.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+replace github.com/pelletier/go-toml => ../
@@ -0,0 +1,382 @@
+// Package tomlyaml converts documents between TOML and YAML.
+//
+// YAML can express values TOML cannot: nulls, map keys that are not strings,
+// and anchors and aliases sharing values. Options sets how each of them is
+// converted to TOML, rejecting documents that use them by default, so that
+// nothing is lost silently when migrating configuration files.
+//
+// It is a separate module, so that go-toml does not depend on a YAML library.
+package tomlyaml
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v3"
+)
+
+// NullPolicy sets how YAML nulls are converted.
+type NullPolicy int
+
+const (
+	// NullsError rejects documents containing nulls.
+	NullsError NullPolicy = iota
+	// NullsOmit drops the keys and the elements of sequences whose value is
+	// null.
+	NullsOmit
+	// NullsEmptyString converts nulls to empty strings.
+	NullsEmptyString
+)
+
+// KeyPolicy sets how the keys of YAML mappings that are not strings, such as
+// 1 or true, are converted.
+type KeyPolicy int
+
+const (
+	// KeysError rejects documents containing keys that are not strings.
+	KeysError KeyPolicy = iota
+	// KeysStringify converts keys to their YAML text: 1 becomes "1".
+	// Mappings and sequences used as keys are always rejected.
+	KeysStringify
+)
+
+// AnchorPolicy sets how YAML aliases are converted.
+type AnchorPolicy int
+
+const (
+	// AnchorsError rejects documents containing aliases or merge keys.
+	AnchorsError AnchorPolicy = iota
+	// AnchorsExpand replaces aliases by a copy of the value they refer to,
+	// and applies merge keys (<<), keys of the mapping taking precedence
+	// over merged keys.
+	AnchorsExpand
+)
+
+// Options sets how the values of YAML documents that TOML cannot express are
+// converted. The zero value rejects all of them.
+type Options struct {
+	Nulls   NullPolicy
+	Keys    KeyPolicy
+	Anchors AnchorPolicy
+}
+
+// YAMLToTOML converts a YAML document, whose top-level value must be a
+// mapping, to TOML. Keys are kept in the order of the YAML document.
+func YAMLToTOML(b []byte, opts Options) ([]byte, error) {
+	m, err := yamlToOrderedMap(b, opts)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Order(toml.OrderPreserve).Encode(m); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// YAMLToTree converts a YAML document, whose top-level value must be a
+// mapping, to a Tree.
+func YAMLToTree(b []byte, opts Options) (*toml.Tree, error) {
+	doc, err := YAMLToTOML(b, opts)
+	if err != nil {
+		return nil, err
+	}
+	return toml.LoadBytes(doc)
+}
+
+func yamlToOrderedMap(b []byte, opts Options) (toml.OrderedMap, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return toml.OrderedMap{}, nil
+	}
+	root := doc.Content[0]
+	if root.Kind == yaml.AliasNode && opts.Anchors == AnchorsExpand {
+		root = root.Alias
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: the top-level value must be a mapping", root.Line)
+	}
+	c := &converter{opts: opts}
+	return c.mapping(root)
+}
+
+// Converter of YAML nodes to the values encoded by go-toml.
+type converter struct {
+	opts Options
+	// depth of aliases being expanded, to stop on recursive aliases
+	aliases int
+}
+
+// Returned by value for nulls that are omitted.
+type omitted struct{}
+
+func (c *converter) value(n *yaml.Node) (interface{}, error) {
+	switch n.Kind {
+	case yaml.AliasNode:
+		if c.opts.Anchors != AnchorsExpand {
+			return nil, fmt.Errorf("line %d: alias *%s cannot be converted without expanding anchors", n.Line, n.Value)
+		}
+		if c.aliases > 100 {
+			return nil, fmt.Errorf("line %d: alias *%s is recursive", n.Line, n.Value)
+		}
+		c.aliases++
+		defer func() { c.aliases-- }()
+		return c.value(n.Alias)
+	case yaml.MappingNode:
+		return c.mapping(n)
+	case yaml.SequenceNode:
+		return c.sequence(n)
+	case yaml.ScalarNode:
+		return c.scalar(n)
+	}
+	return nil, fmt.Errorf("line %d: unexpected YAML node", n.Line)
+}
+
+func (c *converter) mapping(n *yaml.Node) (toml.OrderedMap, error) {
+	m := toml.OrderedMap{}
+	var merged []toml.OrderedMap
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		if k.Kind == yaml.ScalarNode && k.Tag == "!!merge" {
+			maps, err := c.merge(k, v)
+			if err != nil {
+				return nil, err
+			}
+			merged = append(merged, maps...)
+			continue
+		}
+		key, err := c.key(k)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := m.Get(key); ok {
+			return nil, fmt.Errorf("line %d: key %s is defined more than once", k.Line, toml.Key{key})
+		}
+		value, err := c.value(v)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := value.(omitted); !ok {
+			m.Set(key, value)
+		}
+	}
+	// the first merged mappings take precedence over the following ones
+	for _, mm := range merged {
+		for _, kv := range mm {
+			if _, ok := m.Get(kv.Key); !ok {
+				m.Set(kv.Key, kv.Value)
+			}
+		}
+	}
+	return m, nil
+}
+
+// Mappings merged by the merge key k.
+func (c *converter) merge(k, v *yaml.Node) ([]toml.OrderedMap, error) {
+	if c.opts.Anchors != AnchorsExpand {
+		return nil, fmt.Errorf("line %d: merge key cannot be converted without expanding anchors", k.Line)
+	}
+	nodes := []*yaml.Node{v}
+	if v.Kind == yaml.SequenceNode {
+		nodes = v.Content
+	}
+	var maps []toml.OrderedMap
+	for _, node := range nodes {
+		value, err := c.value(node)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := value.(toml.OrderedMap)
+		if !ok {
+			return nil, fmt.Errorf("line %d: merge key expects mappings", node.Line)
+		}
+		maps = append(maps, m)
+	}
+	return maps, nil
+}
+
+func (c *converter) key(k *yaml.Node) (string, error) {
+	if k.Kind == yaml.AliasNode && c.opts.Anchors == AnchorsExpand {
+		k = k.Alias
+	}
+	if k.Kind != yaml.ScalarNode {
+		return "", fmt.Errorf("line %d: keys must be scalars", k.Line)
+	}
+	if k.Tag != "!!str" && c.opts.Keys != KeysStringify {
+		return "", fmt.Errorf("line %d: key %s is not a string", k.Line, k.Value)
+	}
+	return k.Value, nil
+}
+
+func (c *converter) sequence(n *yaml.Node) (interface{}, error) {
+	values := make([]interface{}, 0, len(n.Content))
+	maps := make([]toml.OrderedMap, 0, len(n.Content))
+	for _, e := range n.Content {
+		value, err := c.value(e)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := value.(omitted); ok {
+			continue
+		}
+		values = append(values, value)
+		if m, ok := value.(toml.OrderedMap); ok {
+			maps = append(maps, m)
+		}
+	}
+	// sequences of mappings are arrays of tables
+	if len(maps) > 0 && len(maps) == len(values) {
+		return maps, nil
+	}
+	return values, nil
+}
+
+func (c *converter) scalar(n *yaml.Node) (interface{}, error) {
+	switch n.Tag {
+	case "!!null":
+		switch c.opts.Nulls {
+		case NullsOmit:
+			return omitted{}, nil
+		case NullsEmptyString:
+			return "", nil
+		}
+		return nil, fmt.Errorf("line %d: null cannot be converted", n.Line)
+	case "!!int":
+		var i int64
+		if err := n.Decode(&i); err != nil {
+			var u uint64
+			if n.Decode(&u) == nil {
+				return u, nil
+			}
+			return nil, err
+		}
+		return i, nil
+	case "!!float":
+		var f float64
+		err := n.Decode(&f)
+		return f, err
+	case "!!bool":
+		var b bool
+		err := n.Decode(&b)
+		return b, err
+	case "!!timestamp":
+		return timestamp(n)
+	}
+	return n.Value, nil
+}
+
+// Convert a YAML timestamp to a date-time, or to a local date if it has no
+// time.
+func timestamp(n *yaml.Node) (interface{}, error) {
+	if len(n.Value) == len("2006-01-02") {
+		return toml.ParseLocalDate(n.Value)
+	}
+	var t time.Time
+	err := n.Decode(&t)
+	return t, err
+}
+
+// TOMLToYAML converts a TOML document to YAML. Keys are kept in the order of
+// the TOML document. Offset date-times, local date-times and local dates are
+// written as YAML timestamps, and local times as strings.
+func TOMLToYAML(b []byte) ([]byte, error) {
+	var m toml.OrderedMap
+	if err := toml.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return encodeYAML(m)
+}
+
+// TreeToYAML converts a Tree to YAML, as TOMLToYAML.
+func TreeToYAML(t *toml.Tree) ([]byte, error) {
+	var m toml.OrderedMap
+	if err := t.Unmarshal(&m); err != nil {
+		return nil, err
+	}
+	return encodeYAML(m)
+}
+
+func encodeYAML(m toml.OrderedMap) ([]byte, error) {
+	node, err := yamlNode(m)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	e := yaml.NewEncoder(&buf)
+	e.SetIndent(2)
+	if err := e.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Convert a value decoded by go-toml into a YAML node.
+func yamlNode(v interface{}) (*yaml.Node, error) {
+	switch v := v.(type) {
+	case toml.OrderedMap:
+		n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, kv := range v {
+			value, err := yamlNode(kv.Value)
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: kv.Key}, value)
+		}
+		return n, nil
+	case []toml.OrderedMap:
+		n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, m := range v {
+			e, err := yamlNode(m)
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, e)
+		}
+		return n, nil
+	case []interface{}:
+		n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Style: yaml.FlowStyle}
+		for _, e := range v {
+			node, err := yamlNode(e)
+			if err != nil {
+				return nil, err
+			}
+			if node.Kind != yaml.ScalarNode {
+				n.Style = 0
+			}
+			n.Content = append(n.Content, node)
+		}
+		return n, nil
+	case *toml.Tree:
+		var m toml.OrderedMap
+		if err := v.Unmarshal(&m); err != nil {
+			return nil, err
+		}
+		return yamlNode(m)
+	case toml.LocalDate, toml.LocalDateTime:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!timestamp", Value: fmt.Sprint(v)}, nil
+	case toml.LocalTime:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v.String()}, nil
+	case time.Time:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!timestamp", Value: v.Format(time.RFC3339Nano)}, nil
+	case string:
+		n := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}
+		if strings.Contains(v, "\n") {
+			n.Style = yaml.LiteralStyle
+		}
+		return n, nil
+	}
+	n := &yaml.Node{}
+	if err := n.Encode(v); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
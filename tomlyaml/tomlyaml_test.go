@@ -0,0 +1,151 @@
+package tomlyaml
+
+import (
+	"testing"
+)
+
+func TestYAMLToTOML(t *testing.T) {
+	yamlDoc := `title: app
+port: 8080
+ratio: 0.5
+debug: true
+released: 2001-12-14
+started: 2001-12-14T21:59:43Z
+tags: [a, b]
+server:
+  host: localhost
+routes:
+  - path: /a
+  - path: /b
+`
+	b, err := YAMLToTOML([]byte(yamlDoc), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `title = "app"
+port = 8080
+ratio = 0.5
+debug = true
+released = 2001-12-14
+started = 2001-12-14T21:59:43Z
+tags = ["a", "b"]
+
+[server]
+  host = "localhost"
+
+[[routes]]
+  path = "/a"
+
+[[routes]]
+  path = "/b"
+`
+	if string(b) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, b)
+	}
+}
+
+func TestYAMLToTOMLPolicies(t *testing.T) {
+	examples := []struct {
+		doc      string
+		opts     Options
+		expected string
+		err      string
+	}{
+		{doc: "a: ~\n", err: "line 1: null cannot be converted"},
+		{doc: "a: ~\nb: [1, null]\n", opts: Options{Nulls: NullsOmit}, expected: "b = [1]\n"},
+		{doc: "a: null\n", opts: Options{Nulls: NullsEmptyString}, expected: "a = \"\"\n"},
+		{doc: "1: a\n", err: "line 1: key 1 is not a string"},
+		{doc: "1: a\ntrue: b\n", opts: Options{Keys: KeysStringify}, expected: "1 = \"a\"\ntrue = \"b\"\n"},
+		{doc: "? [a]\n: b\n", opts: Options{Keys: KeysStringify}, err: "line 1: keys must be scalars"},
+		{doc: "a: &x 1\nb: *x\n", err: "line 2: alias *x cannot be converted without expanding anchors"},
+		{doc: "a: &x 1\nb: *x\n", opts: Options{Anchors: AnchorsExpand}, expected: "a = 1\nb = 1\n"},
+		{
+			doc:      "base: &base\n  host: h\n  port: 1\nprod:\n  <<: *base\n  port: 2\n",
+			opts:     Options{Anchors: AnchorsExpand},
+			expected: "\n[base]\n  host = \"h\"\n  port = 1\n\n[prod]\n  port = 2\n  host = \"h\"\n",
+		},
+		{doc: "a:\n  <<: {b: 1}\n", err: "line 2: merge key cannot be converted without expanding anchors"},
+		{doc: "- a\n", err: "line 1: the top-level value must be a mapping"},
+		{doc: "a: [1, x]\n", expected: "a = [1, \"x\"]\n"},
+		{doc: "", expected: ""},
+	}
+	for _, e := range examples {
+		b, err := YAMLToTOML([]byte(e.doc), e.opts)
+		if e.err != "" {
+			if err == nil || err.Error() != e.err {
+				t.Errorf("%q: expected error %q, got %v", e.doc, e.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", e.doc, err)
+			continue
+		}
+		if string(b) != e.expected {
+			t.Errorf("%q: expected:\n%s\ngot:\n%s", e.doc, e.expected, b)
+		}
+	}
+}
+
+func TestTOMLToYAML(t *testing.T) {
+	tomlDoc := `title = "app"
+quoted = "true"
+text = """
+line one
+line two"""
+port = 8080
+released = 2001-12-14
+started = 2001-12-14T21:59:43Z
+at = 07:32:00
+tags = ["a", "b"]
+nested = [[1], { k = 1 }]
+
+[server]
+host = "localhost"
+
+[[routes]]
+path = "/a"
+`
+	b, err := TOMLToYAML([]byte(tomlDoc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `title: app
+quoted: "true"
+text: |-
+  line one
+  line two
+port: 8080
+released: 2001-12-14
+started: 2001-12-14T21:59:43Z
+at: 07:32:00
+tags: [a, b]
+nested:
+  - [1]
+  - k: 1
+server:
+  host: localhost
+routes:
+  - path: /a
+`
+	if string(b) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, b)
+	}
+
+	// the YAML converts back to the same document
+	back, err := YAMLToTree(b, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.Get("server.host") != "localhost" || back.Get("quoted") != "true" || back.Get("text") != "line one\nline two" {
+		t.Errorf("unexpected document %v", back)
+	}
+
+	tree, _ := YAMLToTree([]byte("a: 1\n"), Options{})
+	if b, err := TreeToYAML(tree); err != nil || string(b) != "a: 1\n" {
+		t.Errorf("unexpected result %q, %v", b, err)
+	}
+	if _, err := TOMLToYAML([]byte("a = ")); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,123 @@
+// Encoding and decoding of types with functions registered by applications.
+
+package toml
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// TypeEncoderFunc returns the value written for v, a value of the type it is
+// registered for with RegisterTypeEncoder.
+type TypeEncoderFunc func(v interface{}) (interface{}, error)
+
+// TypeDecoderFunc returns the value decoded from v, the TOML value of a key,
+// into a destination of the type it is registered for with
+// RegisterTypeDecoder. Tables are given as map[string]interface{}.
+type TypeDecoderFunc func(v interface{}) (interface{}, error)
+
+// RegisterTypeEncoder makes the Encoder write values of type t, in fields,
+// maps and slices, as the value returned by f, which is encoded as by Marshal
+// instead. A nil value leaves the key out of the document. For example,
+// third-party types that do not implement Marshaler can be written as strings:
+//
+//	e.RegisterTypeEncoder(reflect.TypeOf(decimal.Decimal{}), func(v interface{}) (interface{}, error) {
+//	  return v.(decimal.Decimal).String(), nil
+//	})
+//
+// Registered functions take precedence over the Marshaler and TextMarshaler
+// methods of t. Pointers to t are encoded as the value they point to, unless
+// a function is registered for the pointer type. f must not return a value of
+// type t.
+func (e *Encoder) RegisterTypeEncoder(t reflect.Type, f TypeEncoderFunc) *Encoder {
+	if e.typeEncoders == nil {
+		e.typeEncoders = map[reflect.Type]TypeEncoderFunc{}
+	}
+	e.typeEncoders[t] = f
+	return e
+}
+
+// RegisterTypeDecoder makes the Decoder decode the values of keys into
+// fields, maps and slices of type t with f, which returns a value assignable
+// to t. For example, strings can be decoded into a third-party type:
+//
+//	d.RegisterTypeDecoder(reflect.TypeOf(decimal.Decimal{}), func(v interface{}) (interface{}, error) {
+//	  s, ok := v.(string)
+//	  if !ok {
+//	    return nil, fmt.Errorf("expected a string, not %T", v)
+//	  }
+//	  return decimal.NewFromString(s)
+//	})
+//
+// Registered functions take precedence over the Unmarshaler and
+// TextUnmarshaler methods of t, and are called after DecodeHooks. Pointers to
+// t are decoded with f, unless a function is registered for the pointer type.
+func (d *Decoder) RegisterTypeDecoder(t reflect.Type, f TypeDecoderFunc) *Decoder {
+	if d.typeDecoders == nil {
+		d.typeDecoders = map[reflect.Type]TypeDecoderFunc{}
+	}
+	d.typeDecoders[t] = f
+	return d
+}
+
+// Encode mval with the function registered for its type.
+func (e *Encoder) registeredToToml(f TypeEncoderFunc, mtype reflect.Type, mval reflect.Value) (interface{}, error) {
+	v, err := f(mval.Interface())
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, errSkipValue
+	}
+	if reflect.TypeOf(v) == mtype {
+		return nil, fmt.Errorf("encoder registered for %v returned a value of the same type", mtype)
+	}
+	return e.valueToToml(reflect.TypeOf(v), reflect.ValueOf(v))
+}
+
+// Whether mtype is a slice or array whose elements are encoded by a
+// registered function, and are not written as tables.
+func (e *Encoder) isRegisteredTypeSequence(mtype reflect.Type) bool {
+	switch mtype.Kind() {
+	case reflect.Slice, reflect.Array:
+		_, ok := e.typeEncoders[mtype.Elem()]
+		_, okPtr := e.typeEncoders[derefType(mtype.Elem())]
+		return ok || okPtr
+	default:
+		return false
+	}
+}
+
+// Decode tval with the function registered for mtype.
+func (d *Decoder) registeredFromToml(f TypeDecoderFunc, mtype reflect.Type, tval interface{}) (reflect.Value, error) {
+	d.visitor.visitAll()
+	if tree, ok := tval.(*Tree); ok {
+		tval = tree.ToMap()
+	}
+	v, err := f(tval)
+	if err != nil {
+		return reflect.ValueOf(nil), err
+	}
+	mval := reflect.New(mtype).Elem()
+	if v == nil {
+		return mval, nil
+	}
+	if vtype := reflect.TypeOf(v); !vtype.AssignableTo(mtype) {
+		return reflect.ValueOf(nil), fmt.Errorf("decoder registered for %v returned a value of type %v", mtype, vtype)
+	}
+	mval.Set(reflect.ValueOf(v))
+	return mval, nil
+}
+
+// Whether mtype is a slice or array whose elements are decoded by a
+// registered function, and may not be tables.
+func (d *Decoder) isRegisteredTypeSequence(mtype reflect.Type) bool {
+	switch mtype.Kind() {
+	case reflect.Slice, reflect.Array:
+		_, ok := d.typeDecoders[mtype.Elem()]
+		_, okPtr := d.typeDecoders[derefType(mtype.Elem())]
+		return ok || okPtr
+	default:
+		return false
+	}
+}
@@ -0,0 +1,132 @@
+package toml
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// A third-party type, without marshalers, written as a string.
+type testMoney struct {
+	cents int64
+}
+
+var testMoneyType = reflect.TypeOf(testMoney{})
+
+func encodeTestMoney(v interface{}) (interface{}, error) {
+	m := v.(testMoney)
+	return fmt.Sprintf("%d.%02d", m.cents/100, m.cents%100), nil
+}
+
+func decodeTestMoney(v interface{}) (interface{}, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected a string, not %T", v)
+	}
+	var units, cents int64
+	if _, err := fmt.Sscanf(s, "%d.%02d", &units, &cents); err != nil {
+		return nil, err
+	}
+	return testMoney{units*100 + cents}, nil
+}
+
+func TestRegisterTypeCodecs(t *testing.T) {
+	type config struct {
+		Price    testMoney            `toml:"price"`
+		Discount *testMoney           `toml:"discount"`
+		History  []testMoney          `toml:"history"`
+		ByRegion map[string]testMoney `toml:"by_region"`
+	}
+	doc := `discount = "1.50"
+history = ["10.00", "12.25"]
+price = "12.99"
+
+[by_region]
+  eu = "11.00"
+`
+	var c config
+	err := NewDecoder(strings.NewReader(doc)).Strict(true).RegisterTypeDecoder(testMoneyType, decodeTestMoney).Decode(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := config{
+		Price:    testMoney{1299},
+		Discount: &testMoney{150},
+		History:  []testMoney{{1000}, {1225}},
+		ByRegion: map[string]testMoney{"eu": {1100}},
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("expected %+v, got %+v", expected, c)
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).RegisterTypeEncoder(testMoneyType, encodeTestMoney).Encode(c); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != doc {
+		t.Errorf("expected:\n%s\ngot:\n%s", doc, buf.String())
+	}
+
+	err = NewDecoder(strings.NewReader("price = 12")).RegisterTypeDecoder(testMoneyType, decodeTestMoney).Decode(&c)
+	assertErrorString(t, "(1, 1): expected a string, not int64", err)
+	err = NewDecoder(strings.NewReader(`price = "12.00"`)).RegisterTypeDecoder(testMoneyType, func(interface{}) (interface{}, error) {
+		return 12, nil
+	}).Decode(&c)
+	assertErrorString(t, "(1, 1): decoder registered for toml.testMoney returned a value of type int", err)
+}
+
+func TestRegisterTypeCodecsOverrideMarshalers(t *testing.T) {
+	type config struct {
+		Start  LocalDate   `toml:"start"`
+		Points []testPoint `toml:"points"`
+		Skip   testMoney   `toml:"skip"`
+	}
+	e := func(v interface{}) (interface{}, error) {
+		return v.(LocalDate).Year, nil
+	}
+	var buf bytes.Buffer
+	err := NewEncoder(&buf).
+		RegisterTypeEncoder(reflect.TypeOf(LocalDate{}), e).
+		RegisterTypeEncoder(reflect.TypeOf(testPoint{}), func(v interface{}) (interface{}, error) {
+			p := v.(testPoint)
+			return []int{p.X, p.Y}, nil
+		}).
+		RegisterTypeEncoder(testMoneyType, func(interface{}) (interface{}, error) { return nil, nil }).
+		Encode(config{Start: LocalDate{2021, 3, 4}, Points: []testPoint{{1, 2}, {3, 4}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := `points = [[1, 2], [3, 4]]
+start = 2021
+`
+	if buf.String() != doc {
+		t.Errorf("expected:\n%s\ngot:\n%s", doc, buf.String())
+	}
+
+	var c config
+	err = NewDecoder(strings.NewReader(doc)).
+		RegisterTypeDecoder(reflect.TypeOf(LocalDate{}), func(v interface{}) (interface{}, error) {
+			return LocalDate{Year: int(v.(int64)), Month: 1, Day: 1}, nil
+		}).
+		RegisterTypeDecoder(reflect.TypeOf(testPoint{}), func(v interface{}) (interface{}, error) {
+			a := v.([]interface{})
+			return testPoint{int(a[0].(int64)), int(a[1].(int64))}, nil
+		}).
+		Decode(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Start != (LocalDate{2021, 1, 1}) || !reflect.DeepEqual(c.Points, []testPoint{{1, 2}, {3, 4}}) {
+		t.Errorf("unexpected %+v", c)
+	}
+
+	err = NewEncoder(&buf).RegisterTypeEncoder(testMoneyType, func(v interface{}) (interface{}, error) { return v, nil }).Encode(config{})
+	assertErrorString(t, "encoder registered for toml.testMoney returned a value of the same type", err)
+}
+
+type testPoint struct {
+	X int `toml:"x"`
+	Y int `toml:"y"`
+}
@@ -0,0 +1,77 @@
+// Options declared by types.
+
+package toml
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// TypeOptions are encoding and validation options declared by a type for all
+// its values, wherever the type is used: in struct fields, slices, maps or
+// pointers. They avoid repeating the same tags on every field of the type.
+type TypeOptions struct {
+	// Min and Max bound the values of numeric types accepted by Unmarshal,
+	// when Min < Max.
+	Min, Max float64
+	// Base is the base integer types are written in by Marshal: 2, 8 or 16.
+	// Negative values, and values in arrays, are always written in base 10.
+	Base int
+	// Values are the values Complete suggests for the type, such as the
+	// constants of an enumeration, of any type accepted by TreeFromMap. They
+	// are not enforced by Unmarshal.
+	Values []interface{}
+}
+
+// TypeOptionsProvider is implemented by types declaring TypeOptions, usually
+// named types wrapping a primitive type:
+//
+//	type Port int
+//
+//	func (Port) TOMLTypeOptions() toml.TypeOptions {
+//		return toml.TypeOptions{Min: 1, Max: 65535}
+//	}
+//
+// TOMLTypeOptions is called on the zero value of the type.
+type TypeOptionsProvider interface {
+	TOMLTypeOptions() TypeOptions
+}
+
+var typeOptionsProviderType = reflect.TypeOf((*TypeOptionsProvider)(nil)).Elem()
+
+// Options declared by mtype, if it implements TypeOptionsProvider.
+func typeOptionsOf(mtype reflect.Type) (TypeOptions, bool) {
+	switch {
+	case mtype.Kind() == reflect.Interface, mtype.Kind() == reflect.Ptr:
+		return TypeOptions{}, false // options apply to the values pointed at
+	case mtype.Implements(typeOptionsProviderType):
+		return reflect.Zero(mtype).Interface().(TypeOptionsProvider).TOMLTypeOptions(), true
+	case reflect.PtrTo(mtype).Implements(typeOptionsProviderType):
+		return reflect.New(mtype).Interface().(TypeOptionsProvider).TOMLTypeOptions(), true
+	}
+	return TypeOptions{}, false
+}
+
+// Check a decoded value against the options of its type.
+func checkTypeOptions(mtype reflect.Type, val reflect.Value) error {
+	plan := planFor(mtype)
+	if !plan.checkRange {
+		return nil
+	}
+	opts := plan.options
+	var f float64
+	switch mtype.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f = float64(val.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f = float64(val.Uint())
+	case reflect.Float32, reflect.Float64:
+		f = val.Float()
+	default:
+		return nil
+	}
+	if f < opts.Min || f > opts.Max {
+		return fmt.Errorf("%v is out of range [%v, %v] for %v", val.Interface(), opts.Min, opts.Max, mtype)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package toml
+
+import (
+	"testing"
+)
+
+type testPort int
+
+func (testPort) TOMLTypeOptions() TypeOptions {
+	return TypeOptions{Min: 1, Max: 65535}
+}
+
+type testMode uint32
+
+func (*testMode) TOMLTypeOptions() TypeOptions {
+	return TypeOptions{Base: 8}
+}
+
+func TestUnmarshalTypeOptions(t *testing.T) {
+	type config struct {
+		Port    testPort            `toml:"port"`
+		Backup  *testPort           `toml:"backup"`
+		Others  []testPort          `toml:"others"`
+		ByName  map[string]testPort `toml:"by_name"`
+		Percent float64             `toml:"percent"`
+	}
+	var c config
+	err := Unmarshal([]byte("port = 80\nbackup = 8080\nothers = [1, 2]\npercent = 100.0\n[by_name]\nweb = 443\n"), &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Port != 80 || *c.Backup != 8080 || c.Others[1] != 2 || c.ByName["web"] != 443 {
+		t.Errorf("unexpected value %+v", c)
+	}
+
+	for _, doc := range []struct {
+		toml, err string
+	}{
+		{"port = 0", "(1, 1): 0 is out of range [1, 65535] for toml.testPort"},
+		{"backup = 70000", "(1, 1): 70000 is out of range [1, 65535] for toml.testPort"},
+		{"others = [1, 99999]", "(1, 14): array element 1: 99999 is out of range [1, 65535] for toml.testPort"},
+		{"[by_name]\nweb = -1", "(2, 1): -1 is out of range [1, 65535] for toml.testPort"},
+	} {
+		err := Unmarshal([]byte(doc.toml), &c)
+		assertErrorString(t, doc.err, err)
+	}
+}
+
+func TestMarshalTypeOptions(t *testing.T) {
+	type config struct {
+		Mode  testMode   `toml:"mode"`
+		Modes []testMode `toml:"modes"`
+		Port  testPort   `toml:"port"`
+	}
+	b, err := Marshal(config{Mode: 0755, Modes: []testMode{0644}, Port: 80})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "mode = 0o755\nmodes = [420]\nport = 80\n"
+	if string(b) != expected {
+		t.Errorf("expected %q, got %q", expected, b)
+	}
+	var c config
+	if err := Unmarshal(b, &c); err != nil || c.Mode != 0755 {
+		t.Errorf("bad round trip %+v: %v", c, err)
+	}
+}
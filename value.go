@@ -0,0 +1,235 @@
+// Generic access to the values of a document.
+
+package toml
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Kind identifies the TOML type of a Value.
+type Kind int
+
+// Kinds of TOML values.
+const (
+	KindInvalid Kind = iota
+	KindString
+	KindInteger
+	KindFloat
+	KindBool
+	KindOffsetDateTime
+	KindLocalDateTime
+	KindLocalDate
+	KindLocalTime
+	KindArray
+	KindTable
+)
+
+var kindNames = [...]string{
+	KindInvalid:        "invalid",
+	KindString:         "string",
+	KindInteger:        "integer",
+	KindFloat:          "float",
+	KindBool:           "bool",
+	KindOffsetDateTime: "offset date-time",
+	KindLocalDateTime:  "local date-time",
+	KindLocalDate:      "local date",
+	KindLocalTime:      "local time",
+	KindArray:          "array",
+	KindTable:          "table",
+}
+
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return kindNames[KindInvalid]
+	}
+	return kindNames[k]
+}
+
+// Value is a TOML value of a document. It allows APIs to accept and inspect
+// any TOML value without relying on reflection or on the Go types used to
+// store the values in a Tree.
+//
+// The As methods return the value and true if the value is of the
+// corresponding kind, or the zero value and false otherwise.
+type Value interface {
+	// Kind returns the TOML type of the value.
+	Kind() Kind
+	// Position returns the position of the value in the document it was
+	// parsed from. Elements of arrays share the position of their array.
+	Position() Position
+	// Interface returns the value as it would be returned by Tree.Get.
+	Interface() interface{}
+
+	AsString() (string, bool)
+	AsInteger() (int64, bool)
+	AsFloat() (float64, bool)
+	AsBool() (bool, bool)
+	// AsTime returns the value of an offset date-time.
+	AsTime() (time.Time, bool)
+	// AsArray returns the elements of an array, including arrays of tables.
+	AsArray() ([]Value, bool)
+	// AsTable returns the tree of a table.
+	AsTable() (*Tree, bool)
+}
+
+// AsValue returns the tree as a Value of kind KindTable.
+func (t *Tree) AsValue() Value {
+	return nodeValue{node: t, position: t.position}
+}
+
+// GetValue returns the Value at key in the Tree, or nil if the key does not
+// exist. Key is a dot-separated path, as for Get.
+func (t *Tree) GetValue(key string) Value {
+	if key == "" {
+		return t.AsValue()
+	}
+	return t.GetValuePath(strings.Split(key, "."))
+}
+
+// GetValuePath returns the Value at the path indicated by keys, or nil if the
+// path does not exist. Arrays of tables are traversed through their last
+// element, as for GetPath.
+func (t *Tree) GetValuePath(keys []string) Value {
+	if len(keys) == 0 {
+		return t.AsValue()
+	}
+	subtree := t
+	for _, intermediateKey := range keys[:len(keys)-1] {
+		switch node := subtree.values[intermediateKey].(type) {
+		case *Tree:
+			subtree = node
+		case []*Tree:
+			if len(node) == 0 {
+				return nil
+			}
+			subtree = node[len(node)-1]
+		default:
+			return nil
+		}
+	}
+	switch node := subtree.values[keys[len(keys)-1]].(type) {
+	case *tomlValue:
+		return nodeValue{node: node.value, position: node.position}
+	case *Tree:
+		return node.AsValue()
+	case []*Tree:
+		pos := subtree.position
+		if len(node) > 0 {
+			pos = node[0].position
+		}
+		return nodeValue{node: node, position: pos}
+	default:
+		return nil
+	}
+}
+
+// nodeValue implements Value for the values stored in a Tree.
+type nodeValue struct {
+	node     interface{}
+	position Position
+}
+
+func (v nodeValue) Kind() Kind {
+	switch v.node.(type) {
+	case string:
+		return KindString
+	case int64, uint64:
+		return KindInteger
+	case float64:
+		return KindFloat
+	case bool:
+		return KindBool
+	case time.Time:
+		return KindOffsetDateTime
+	case LocalDateTime:
+		return KindLocalDateTime
+	case LocalDate:
+		return KindLocalDate
+	case LocalTime:
+		return KindLocalTime
+	case []interface{}, []*Tree:
+		return KindArray
+	case *Tree:
+		return KindTable
+	}
+	// arrays created from Go values keep the type of their elements
+	if v.node != nil && reflect.TypeOf(v.node).Kind() == reflect.Slice {
+		return KindArray
+	}
+	return KindInvalid
+}
+
+func (v nodeValue) Position() Position {
+	return v.position
+}
+
+func (v nodeValue) Interface() interface{} {
+	return v.node
+}
+
+func (v nodeValue) AsString() (string, bool) {
+	s, ok := v.node.(string)
+	return s, ok
+}
+
+// AsInteger also reports false for unsigned integers that overflow an int64.
+func (v nodeValue) AsInteger() (int64, bool) {
+	switch n := v.node.(type) {
+	case int64:
+		return n, true
+	case uint64:
+		if n <= math.MaxInt64 {
+			return int64(n), true
+		}
+	}
+	return 0, false
+}
+
+func (v nodeValue) AsFloat() (float64, bool) {
+	f, ok := v.node.(float64)
+	return f, ok
+}
+
+func (v nodeValue) AsBool() (bool, bool) {
+	b, ok := v.node.(bool)
+	return b, ok
+}
+
+func (v nodeValue) AsTime() (time.Time, bool) {
+	t, ok := v.node.(time.Time)
+	return t, ok
+}
+
+func (v nodeValue) AsArray() ([]Value, bool) {
+	switch array := v.node.(type) {
+	case []interface{}:
+		values := make([]Value, len(array))
+		for i, element := range array {
+			values[i] = nodeValue{node: element, position: v.position}
+		}
+		return values, true
+	case []*Tree:
+		values := make([]Value, len(array))
+		for i, tree := range array {
+			values[i] = tree.AsValue()
+		}
+		return values, true
+	}
+	if v.Kind() != KindArray {
+		return nil, false
+	}
+	array := reflect.ValueOf(v.node)
+	values := make([]Value, array.Len())
+	for i := range values {
+		values[i] = nodeValue{node: array.Index(i).Interface(), position: v.position}
+	}
+	return values, true
+}
+
+func (v nodeValue) AsTable() (*Tree, bool) {
+	t, ok := v.node.(*Tree)
+	return t, ok
+}
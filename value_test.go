@@ -0,0 +1,130 @@
+package toml
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValueKinds(t *testing.T) {
+	tree, err := Load(`
+s = "hello"
+i = 42
+f = 4.2
+b = true
+odt = 1979-05-27T07:32:00Z
+ldt = 1979-05-27T07:32:00
+ld = 1979-05-27
+lt = 07:32:00
+a = [1, 2]
+
+[tbl]
+x = 1
+
+[[arr]]
+y = 1
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]Kind{
+		"s":   KindString,
+		"i":   KindInteger,
+		"f":   KindFloat,
+		"b":   KindBool,
+		"odt": KindOffsetDateTime,
+		"ldt": KindLocalDateTime,
+		"ld":  KindLocalDate,
+		"lt":  KindLocalTime,
+		"a":   KindArray,
+		"tbl": KindTable,
+		"arr": KindArray,
+	}
+	for key, kind := range expected {
+		v := tree.GetValue(key)
+		if v == nil {
+			t.Errorf("value %s should exist", key)
+			continue
+		}
+		if v.Kind() != kind {
+			t.Errorf("value %s should be of kind %s, not %s", key, kind, v.Kind())
+		}
+	}
+
+	if tree.GetValue("missing") != nil || tree.GetValue("s.x") != nil {
+		t.Error("missing keys should return a nil value")
+	}
+	if pos := tree.GetValue("i").Position(); pos.Line != 3 {
+		t.Errorf("unexpected position %s", pos)
+	}
+}
+
+func TestValueAccessors(t *testing.T) {
+	tree, err := Load(`
+s = "hello"
+i = 42
+odt = 1979-05-27T07:32:00Z
+a = [[1, 2], ["x"]]
+t = [{ k = 1 }, { k = 2 }]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s, ok := tree.GetValue("s").AsString(); !ok || s != "hello" {
+		t.Errorf("unexpected string %q %v", s, ok)
+	}
+	if _, ok := tree.GetValue("s").AsInteger(); ok {
+		t.Error("a string should not be an integer")
+	}
+	if i, ok := tree.GetValue("i").AsInteger(); !ok || i != 42 {
+		t.Errorf("unexpected integer %d %v", i, ok)
+	}
+	if odt, ok := tree.GetValue("odt").AsTime(); !ok || !odt.Equal(time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC)) {
+		t.Errorf("unexpected time %v %v", odt, ok)
+	}
+
+	outer, ok := tree.GetValue("a").AsArray()
+	if !ok || len(outer) != 2 {
+		t.Fatalf("unexpected array %v", outer)
+	}
+	inner, ok := outer[1].AsArray()
+	if !ok || len(inner) != 1 {
+		t.Fatalf("unexpected nested array %v", inner)
+	}
+	if s, _ := inner[0].AsString(); s != "x" {
+		t.Errorf("unexpected nested element %q", s)
+	}
+
+	tables, ok := tree.GetValue("t").AsArray()
+	if !ok || len(tables) != 2 {
+		t.Fatalf("unexpected array of tables %v", tables)
+	}
+	second, ok := tables[1].AsTable()
+	if !ok {
+		t.Fatal("elements of an array of tables should be tables")
+	}
+	if k, _ := second.GetValue("k").AsInteger(); k != 2 {
+		t.Errorf("unexpected value in array of tables %d", k)
+	}
+
+	root, ok := tree.AsValue().AsTable()
+	if !ok || root != tree {
+		t.Error("the tree value should be the tree itself")
+	}
+}
+
+func TestValueFromGoSlices(t *testing.T) {
+	tree, err := TreeFromMap(map[string]interface{}{"a": []string{"x", "y"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := tree.GetValue("a")
+	if v.Kind() != KindArray {
+		t.Fatalf("typed slices should be arrays, got %s", v.Kind())
+	}
+	elements, _ := v.AsArray()
+	if len(elements) != 2 || elements[1].Kind() != KindString {
+		t.Errorf("unexpected elements %v", elements)
+	}
+}
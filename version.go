@@ -0,0 +1,28 @@
+package toml
+
+// TOMLVersion is a version of the TOML specification.
+type TOMLVersion int
+
+const (
+	// TOML10 is version 1.0.0 of the specification, enforced by default.
+	TOML10 TOMLVersion = iota
+	// TOML11 is the upcoming version 1.1.0 of the specification, which adds:
+	//
+	//   - the \e escape sequence for the escape character, and \xHH for
+	//     code points up to U+00FF, in basic strings;
+	//   - newlines, comments and a trailing comma in inline tables;
+	//   - optional seconds in times, 07:32 standing for 07:32:00.
+	//
+	// Its support is experimental until the specification is released.
+	TOML11
+)
+
+func (v TOMLVersion) String() string {
+	switch v {
+	case TOML10:
+		return "1.0"
+	case TOML11:
+		return "1.1"
+	}
+	return "unknown"
+}
@@ -0,0 +1,72 @@
+package toml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecoderVersion(t *testing.T) {
+	examples := []struct {
+		doc      string
+		expected map[string]interface{}
+		err10    string
+	}{
+		{
+			doc:      `a = "\e[1m\x41\xe9"`,
+			expected: map[string]interface{}{"a": "\x1b[1mAé"},
+			err10:    `(1, 6): invalid escape sequence: \e`,
+		},
+		{
+			doc:      `a = "\x41"`,
+			expected: map[string]interface{}{"a": "A"},
+			err10:    `(1, 6): invalid escape sequence: \x`,
+		},
+		{
+			doc:      "a = { b = 1, c = 2, }",
+			expected: map[string]interface{}{"a": map[string]interface{}{"b": int64(1), "c": int64(2)}},
+			err10:    "(1, 19): trailing comma at the end of inline table",
+		},
+		{
+			doc:      "a = {\n  b = 1, # first\n  c = [\n    2,\n  ],\n}",
+			expected: map[string]interface{}{"a": map[string]interface{}{"b": int64(1), "c": []interface{}{int64(2)}}},
+			err10:    "(1, 6): unexpected token type in inline table: newlines are not allowed in inline tables",
+		},
+		{
+			doc:      "a = { b = 1\n}",
+			expected: map[string]interface{}{"a": map[string]interface{}{"b": int64(1)}},
+			err10:    "(1, 12): unexpected token type in inline table: newlines are not allowed in inline tables",
+		},
+		{
+			doc:      "a = 07:32\nb = 1979-05-27T07:32Z\nc = 1979-05-27 07:32",
+			expected: map[string]interface{}{"a": LocalTime{7, 32, 0, 0}, "b": time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC), "c": LocalDateTime{LocalDate{1979, 5, 27}, LocalTime{7, 32, 0, 0}}},
+			err10:    "(1, 5): time minute/second separator should be :, not \n",
+		},
+	}
+	for _, e := range examples {
+		var m map[string]interface{}
+		err := NewDecoder(strings.NewReader(e.doc)).Decode(&m)
+		if err == nil || err.Error() != e.err10 {
+			t.Errorf("%q: expected error %q with TOML 1.0, got %v", e.doc, e.err10, err)
+		}
+
+		m = nil
+		if err := NewDecoder(strings.NewReader(e.doc)).Version(TOML11).Decode(&m); err != nil {
+			t.Errorf("%q: %s", e.doc, err)
+			continue
+		}
+		if !reflect.DeepEqual(m, e.expected) {
+			t.Errorf("%q: expected %v, got %v", e.doc, e.expected, m)
+		}
+	}
+}
+
+func TestDecoderVersionErrors(t *testing.T) {
+	for _, doc := range []string{`a = "\x4"`, `a = "\xg0"`, "a = { b = 1,, }", "a = { , }", "a = 07:3"} {
+		var m map[string]interface{}
+		if err := NewDecoder(strings.NewReader(doc)).Version(TOML11).Decode(&m); err == nil {
+			t.Errorf("%q: expected an error, got %v", doc, m)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+// Syntax tree of documents.
+
+package toml
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// NodeKind identifies the syntactic element described by a Node.
+type NodeKind int
+
+// Kinds of nodes.
+const (
+	// NodeDocument is the root of a document. Its children are the key/value
+	// pairs preceding the first table header, followed by the tables.
+	NodeDocument NodeKind = iota
+	// NodeTable is a [table] header and the key/value pairs following it.
+	NodeTable
+	// NodeArrayTable is a [[table]] header and the key/value pairs following
+	// it.
+	NodeArrayTable
+	// NodeKeyValue is a key/value pair. Its only child is its value.
+	NodeKeyValue
+	// NodeValue is the value of a key/value pair or an element of an array.
+	// The children of arrays are their elements, and the children of inline
+	// tables are their key/value pairs.
+	NodeValue
+)
+
+var nodeKindNames = [...]string{
+	NodeDocument:   "document",
+	NodeTable:      "table",
+	NodeArrayTable: "array table",
+	NodeKeyValue:   "key/value",
+	NodeValue:      "value",
+}
+
+func (k NodeKind) String() string {
+	if k < 0 || int(k) >= len(nodeKindNames) {
+		return "invalid"
+	}
+	return nodeKindNames[k]
+}
+
+// Range is the part of a document between Start, included, and End,
+// excluded.
+type Range struct {
+	Start Position
+	End   Position
+}
+
+func (r Range) String() string {
+	return r.Start.String() + "-" + r.End.String()
+}
+
+// Node is an element of the syntax tree of a document, as returned by
+// ParseNodes.
+type Node struct {
+	Kind NodeKind
+	// Key is the complete key of tables and key/value pairs. Values have the
+	// key of their pair, elements of arrays the key of their array.
+	Key Key
+	// Value is the value of key/value pairs and values, and the table of
+	// tables.
+	Value Value
+	// Range is the text of the node, from the opening bracket of tables or
+	// the key of pairs to the end of their last value. KeyRange is the text
+	// of the key of tables and pairs.
+	Range    Range
+	KeyRange Range
+	Children []*Node
+}
+
+// ParseNodes parses doc into a syntax tree, for tools working on the text of
+// documents, such as linters, documentation generators or refactoring tools.
+// Comments and whitespace are not part of the tree: the ast package attaches
+// comments to its nodes. An error is returned if the document is invalid.
+func ParseNodes(doc []byte) (*Node, error) {
+	doc = trimBOM(doc)
+	tree, err := LoadBytes(doc)
+	if err != nil {
+		return nil, err
+	}
+	b := &nodeBuilder{src: doc, tokens: lexToml(doc), lineStarts: []int{0}, arrays: map[string]int{}}
+	defer putTokens(b.tokens)
+	for i, c := range doc {
+		if c == '\n' {
+			b.lineStarts = append(b.lineStarts, i+1)
+		}
+	}
+	return b.document(tree), nil
+}
+
+// Visitor is called by Walk for each node of a syntax tree. If the visitor w
+// returned by Visit is not nil, Walk visits each of the children of node with
+// w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node *Node) (w Visitor)
+}
+
+// Walk traverses a syntax tree in depth-first order, as go/ast.Walk: it calls
+// v.Visit(node), and then walks the children of node with the visitor it
+// returns, if not nil.
+func Walk(v Visitor, node *Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	for _, child := range node.Children {
+		Walk(v, child)
+	}
+	v.Visit(nil)
+}
+
+// Builder of the syntax tree of a valid document, from its tokens.
+type nodeBuilder struct {
+	src        []byte
+	tokens     []token
+	next       int
+	lineStarts []int
+	// number of tables of the arrays of tables read so far, by key
+	arrays map[string]int
+}
+
+func (b *nodeBuilder) peek() *token {
+	return &b.tokens[b.next]
+}
+
+// Offset in the document of a position.
+func (b *nodeBuilder) offset(pos Position) int {
+	off := b.lineStarts[pos.Line-1]
+	for col := 1; col < pos.Col && off < len(b.src); col++ {
+		_, size := utf8.DecodeRune(b.src[off:])
+		off += size
+	}
+	return off
+}
+
+// Position of an offset in the document.
+func (b *nodeBuilder) position(off int) Position {
+	line := sort.Search(len(b.lineStarts), func(i int) bool { return b.lineStarts[i] > off })
+	return Position{Line: line, Col: utf8.RuneCount(b.src[b.lineStarts[line-1]:off]) + 1}
+}
+
+// Range of the text of a key token, which may include the spaces around the
+// key of a table header.
+func (b *nodeBuilder) keyRange(tok *token) Range {
+	start := b.offset(tok.Position) + len(tok.val) - len(strings.TrimLeft(tok.val, " \t"))
+	return Range{Start: b.position(start), End: b.position(start + len(strings.TrimSpace(tok.val)))}
+}
+
+func (b *nodeBuilder) document(tree *Tree) *Node {
+	root := &Node{
+		Kind:  NodeDocument,
+		Key:   Key{},
+		Value: tree.AsValue(),
+		Range: Range{Start: Position{Line: 1, Col: 1}, End: b.position(len(b.src))},
+	}
+	b.sections(tree, root)
+	return root
+}
+
+// Add the nodes of the tokens to the children of root: the key/value pairs of
+// the root table, and the tables.
+func (b *nodeBuilder) sections(tree *Tree, root *Node) {
+	parent, table := root, tree
+	for {
+		tok := b.peek()
+		switch tok.typ {
+		case tokenEOF:
+			return
+		case tokenLeftBracket, tokenDoubleLeftBracket:
+			b.next++
+			parent = b.table(tree, tok)
+			root.Children = append(root.Children, parent)
+			table, _ = parent.Value.AsTable()
+		case tokenKey:
+			pair := b.keyValue(Key{}.Append(parent.Key...), table)
+			parent.Children = append(parent.Children, pair)
+			if parent != root {
+				parent.Range.End = pair.Range.End
+			}
+		default:
+			panic(fmt.Sprintf("%s: unexpected token %s", tok.Position, tok.typ))
+		}
+	}
+}
+
+// Table header opened by tok.
+func (b *nodeBuilder) table(tree *Tree, tok *token) *Node {
+	keyTok := b.peek()
+	key, _ := parseKey(keyTok.val)
+	closing := &b.tokens[b.next+1]
+	b.next += 2
+	node := &Node{
+		Kind:     NodeTable,
+		Key:      Key(key),
+		Range:    Range{Start: tok.Position, End: b.position(b.offset(closing.Position) + len(closing.typ.String()))},
+		KeyRange: b.keyRange(keyTok),
+	}
+	if tok.typ == tokenDoubleLeftBracket {
+		node.Kind = NodeArrayTable
+	}
+	b.countTable(node)
+	node.Value = b.tableOf(tree, node.Key).AsValue()
+	return node
+}
+
+// Count the tables of arrays of tables read, up to the table node.
+func (b *nodeBuilder) countTable(node *Node) {
+	// arrays of tables below a new table start again
+	for k := range b.arrays {
+		if strings.HasPrefix(k, node.Key.String()+".") {
+			delete(b.arrays, k)
+		}
+	}
+	if node.Kind == NodeArrayTable {
+		b.arrays[node.Key.String()]++
+	}
+}
+
+// Table of tree at key, the tables of arrays of tables being the last ones
+// read.
+func (b *nodeBuilder) tableOf(tree *Tree, key Key) *Tree {
+	t := tree
+	for i := range key {
+		switch v := t.values[key[i]].(type) {
+		case *Tree:
+			t = v
+		case []*Tree:
+			t = v[b.arrays[key[:i+1].String()]-1]
+		}
+	}
+	return t
+}
+
+// Key/value pair of the table t, whose key is prefix.
+func (b *nodeBuilder) keyValue(prefix Key, t *Tree) *Node {
+	keyTok := b.peek()
+	keys, _ := parseKey(keyTok.val)
+	b.next += 2 // key and equal sign
+	value := b.value(prefix.Append(keys...), t.GetValuePath(keys))
+	return &Node{
+		Kind:     NodeKeyValue,
+		Key:      value.Key,
+		Value:    value.Value,
+		Range:    Range{Start: keyTok.Position, End: value.Range.End},
+		KeyRange: b.keyRange(keyTok),
+		Children: []*Node{value},
+	}
+}
+
+// Value starting at the next token.
+func (b *nodeBuilder) value(key Key, v Value) *Node {
+	tok := b.peek()
+	start := b.offset(tok.Position)
+	if tok.typ == tokenString {
+		// strings tokens start after their opening quotes, and after the
+		// newline following the quotes of multiline strings
+		if start > 0 && b.src[start-1] == '\n' {
+			start--
+			if start > 0 && b.src[start-1] == '\r' {
+				start--
+			}
+		}
+		for quotes := 0; quotes < 3 && start > 0 && (b.src[start-1] == '"' || b.src[start-1] == '\''); quotes++ {
+			start--
+		}
+	}
+	end := skipDocumentValue(b.src, start)
+	node := &Node{
+		Kind:  NodeValue,
+		Key:   key,
+		Value: v,
+		Range: Range{Start: b.position(start), End: b.position(end)},
+	}
+	switch tok.typ {
+	case tokenLeftBracket:
+		b.next++
+		elements, _ := v.AsArray()
+		for b.peek().typ != tokenRightBracket {
+			if b.peek().typ == tokenComma {
+				b.next++
+				continue
+			}
+			node.Children = append(node.Children, b.value(key, elements[len(node.Children)]))
+		}
+		b.next++
+	case tokenLeftCurlyBrace:
+		b.next++
+		table, _ := v.AsTable()
+		for b.peek().typ != tokenRightCurlyBrace {
+			if b.peek().typ == tokenComma {
+				b.next++
+				continue
+			}
+			node.Children = append(node.Children, b.keyValue(key, table))
+		}
+		b.next++
+	default:
+		// date-times are made of several tokens
+		for b.peek().typ != tokenEOF && b.offset(b.peek().Position) < end {
+			b.next++
+		}
+	}
+	return node
+}
@@ -0,0 +1,119 @@
+package toml
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Visitor printing the nodes it visits, indented by depth.
+type printingVisitor struct {
+	lines *[]string
+	depth int
+}
+
+func (v printingVisitor) Visit(node *Node) Visitor {
+	if node == nil {
+		return nil
+	}
+	line := fmt.Sprintf("%s%s %s %s", strings.Repeat("  ", v.depth), node.Kind, node.Key, node.Range)
+	if node.Kind == NodeKeyValue || node.Kind == NodeTable || node.Kind == NodeArrayTable {
+		line += " key " + node.KeyRange.String()
+	}
+	if node.Kind == NodeValue {
+		line += fmt.Sprintf(" %s %v", node.Value.Kind(), node.Value.Interface())
+	}
+	*v.lines = append(*v.lines, line)
+	return printingVisitor{lines: v.lines, depth: v.depth + 1}
+}
+
+func TestWalk(t *testing.T) {
+	doc := `a = 1 # comment
+"b.c" . d = [ "x", [1979-05-27 07:32:00, 2], ]
+
+[ t ]
+e = { f = 'é', g = [] }
+
+[[arr]]
+[[arr.sub]]
+h = 1
+[[arr]]
+[[arr.sub]]
+h = 2
+`
+	root, err := ParseNodes([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := []string{}
+	Walk(printingVisitor{lines: &lines}, root)
+	expected := []string{
+		"document  (1, 1)-(13, 1)",
+		"  key/value a (1, 1)-(1, 6) key (1, 1)-(1, 2)",
+		"    value a (1, 5)-(1, 6) integer 1",
+		`  key/value "b.c".d (2, 1)-(2, 47) key (2, 1)-(2, 10)`,
+		`    value "b.c".d (2, 13)-(2, 47) array [x [1979-05-27T07:32:00 2]]`,
+		`      value "b.c".d (2, 15)-(2, 18) string x`,
+		`      value "b.c".d (2, 20)-(2, 44) array [1979-05-27T07:32:00 2]`,
+		`        value "b.c".d (2, 21)-(2, 40) local date-time 1979-05-27T07:32:00`,
+		`        value "b.c".d (2, 42)-(2, 43) integer 2`,
+		"  table t (4, 1)-(5, 24) key (4, 3)-(4, 4)",
+		"    key/value t.e (5, 1)-(5, 24) key (5, 1)-(5, 2)",
+		"      value t.e (5, 5)-(5, 24) table f = \"é\"\ng = []\n",
+		"        key/value t.e.f (5, 7)-(5, 14) key (5, 7)-(5, 8)",
+		"          value t.e.f (5, 11)-(5, 14) string é",
+		"        key/value t.e.g (5, 16)-(5, 22) key (5, 16)-(5, 17)",
+		"          value t.e.g (5, 20)-(5, 22) array []",
+		"  array table arr (7, 1)-(7, 8) key (7, 3)-(7, 6)",
+		"  array table arr.sub (8, 1)-(9, 6) key (8, 3)-(8, 10)",
+		"    key/value arr.sub.h (9, 1)-(9, 6) key (9, 1)-(9, 2)",
+		"      value arr.sub.h (9, 5)-(9, 6) integer 1",
+		"  array table arr (10, 1)-(10, 8) key (10, 3)-(10, 6)",
+		"  array table arr.sub (11, 1)-(12, 6) key (11, 3)-(11, 10)",
+		"    key/value arr.sub.h (12, 1)-(12, 6) key (12, 1)-(12, 2)",
+		"      value arr.sub.h (12, 5)-(12, 6) integer 2",
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(lines, "\n"))
+	}
+
+	tables := root.Children[2:]
+	if sub, _ := tables[4].Value.AsTable(); sub.Get("h") != int64(2) {
+		t.Errorf("tables of arrays of tables should be those of their header, got %v", sub)
+	}
+	root, err = ParseNodes([]byte("s = \"\"\"\r\nline\"\"\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := root.Children[0].Children[0].Range; r.String() != "(1, 5)-(2, 8)" {
+		t.Errorf("unexpected range of multiline string %s", r)
+	}
+	if _, err := ParseNodes([]byte("a = \n")); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+// Visitor stopping at tables.
+type countingVisitor map[NodeKind]int
+
+func (v countingVisitor) Visit(node *Node) Visitor {
+	if node == nil || node.Kind == NodeTable {
+		return nil
+	}
+	v[node.Kind]++
+	return v
+}
+
+func TestWalkSkipsChildren(t *testing.T) {
+	root, err := ParseNodes([]byte("a = [1, 2]\n[t]\nb = 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := countingVisitor{}
+	Walk(counts, root)
+	expected := countingVisitor{NodeDocument: 1, NodeKeyValue: 1, NodeValue: 3}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("expected %v, got %v", expected, counts)
+	}
+}
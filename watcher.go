@@ -0,0 +1,177 @@
+//go:build go1.18
+// +build go1.18
+
+// Reloading configuration files when they change.
+
+package toml
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// WatchEvent reports a new version of a watched file.
+type WatchEvent[T any] struct {
+	// Config is the new configuration, and Previous the one it replaces.
+	// Config is nil if Err is set.
+	Config   *T
+	Previous *T
+	// Changes lists the keys whose values changed, as returned by Diff.
+	Changes []Difference
+	// Err is set if the new version cannot be read, decoded or is rejected
+	// by the validation function. The Watcher then keeps the previous
+	// configuration.
+	Err error
+}
+
+// Watcher reloads the configuration in a file when it changes, decoding it
+// into a new T, which must be a struct or a map type:
+//
+//	w, err := toml.NewWatcher[Config]("config.toml")
+//	...
+//	for event := range w.Watch(ctx) {
+//	  if event.Err != nil {
+//	    log.Print(event.Err)
+//	    continue
+//	  }
+//	  apply(event.Config)
+//	}
+//
+// Watch polls the file. To be notified by another mechanism, such as
+// fsnotify, call Reload instead when the file changes.
+//
+// Configurations must be treated as read-only, since they may be shared by
+// several goroutines.
+type Watcher[T any] struct {
+	path     string
+	interval time.Duration
+	validate func(previous, next *T) error
+
+	mu       sync.Mutex
+	src      []byte
+	tree     *Tree
+	current  *T
+	accepted []func(*T) // called with each configuration accepted by Reload
+}
+
+// NewWatcher reads the file at path and decodes it into a new T. An error is
+// returned if it cannot.
+func NewWatcher[T any](path string) (*Watcher[T], error) {
+	w := &Watcher[T]{path: path, interval: time.Second}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if w.tree, w.current, err = w.decode(b); err != nil {
+		return nil, err
+	}
+	w.src = b
+	return w, nil
+}
+
+// PollInterval sets how often Watch checks the file for changes. It is one
+// second by default.
+func (w *Watcher[T]) PollInterval(d time.Duration) *Watcher[T] {
+	w.interval = d
+	return w
+}
+
+// Validate sets a function checking a new version of the configuration
+// against the previous one before it is accepted. A new version for which fn
+// returns an error is rejected.
+func (w *Watcher[T]) Validate(fn func(previous, next *T) error) *Watcher[T] {
+	w.validate = fn
+	return w
+}
+
+// Current returns the last accepted configuration.
+func (w *Watcher[T]) Current() *T {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// Reload reads the file and, if its content changed since it was last read,
+// decodes and validates it. It returns the resulting event, and false if the
+// content or the values of the file did not change.
+//
+// A version that is rejected is not reported again until the file changes.
+func (w *Watcher[T]) Reload() (WatchEvent[T], bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	event := WatchEvent[T]{Previous: w.current}
+	b, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		event.Err = err
+		return event, true
+	}
+	if bytes.Equal(b, w.src) {
+		return event, false
+	}
+	w.src = b
+	tree, config, err := w.decode(b)
+	if err != nil {
+		event.Err = err
+		return event, true
+	}
+	changes := Diff(w.tree, tree)
+	if len(changes) == 0 {
+		return event, false
+	}
+	if w.validate != nil {
+		if err := w.validate(w.current, config); err != nil {
+			event.Err = err
+			return event, true
+		}
+	}
+	w.tree, w.current = tree, config
+	for _, f := range w.accepted {
+		f(config)
+	}
+	event.Config, event.Changes = config, changes
+	return event, true
+}
+
+// Watch polls the file until ctx is canceled, sending an event on the
+// returned channel each time Reload reports one. The channel is closed when
+// ctx is canceled.
+func (w *Watcher[T]) Watch(ctx context.Context) <-chan WatchEvent[T] {
+	events := make(chan WatchEvent[T])
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			event, ok := w.Reload()
+			if !ok {
+				continue
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events
+}
+
+func (w *Watcher[T]) decode(b []byte) (*Tree, *T, error) {
+	tree, err := LoadBytes(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	v := new(T)
+	if err := tree.Unmarshal(v); err != nil {
+		return nil, nil, err
+	}
+	return tree, v, nil
+}
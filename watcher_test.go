@@ -0,0 +1,92 @@
+//go:build go1.18
+// +build go1.18
+
+package toml
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	type config struct {
+		Port int `toml:"port"`
+	}
+	dir, err := ioutil.TempDir("", "toml-watcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.toml")
+	write := func(doc string) {
+		// written atomically, so that Watch never reads a partial file
+		if err := WriteFile(path, []byte(doc), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("port = 80\n")
+
+	w, err := NewWatcher[config](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.PollInterval(10 * time.Millisecond).Validate(func(previous, next *config) error {
+		if next.Port == 0 {
+			return errors.New("port is required")
+		}
+		return nil
+	})
+	if w.Current().Port != 80 {
+		t.Errorf("unexpected configuration %+v", w.Current())
+	}
+
+	// comments are not changes
+	write("port = 80 # http\n")
+	if _, ok := w.Reload(); ok {
+		t.Error("unexpected event without changes")
+	}
+
+	write("port = 8080\n")
+	event, ok := w.Reload()
+	if !ok || event.Err != nil {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if event.Previous.Port != 80 || event.Config.Port != 8080 || w.Current() != event.Config {
+		t.Errorf("unexpected configurations %+v, %+v", event.Previous, event.Config)
+	}
+	if len(event.Changes) != 1 || event.Changes[0].String() != "~ port = 80 -> 8080" {
+		t.Errorf("unexpected changes %v", event.Changes)
+	}
+
+	write("port = 0\n")
+	event, ok = w.Reload()
+	if !ok {
+		t.Fatal("rejected version not reported")
+	}
+	assertErrorString(t, "port is required", event.Err)
+	if w.Current().Port != 8080 {
+		t.Errorf("rejected version accepted: %+v", w.Current())
+	}
+	if _, ok := w.Reload(); ok {
+		t.Error("rejected version reported twice")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := w.Watch(ctx)
+	write("port = [\n")
+	event = <-events
+	assertErrorString(t, "(2, 1): unterminated array", event.Err)
+	write("port = 443\n")
+	event = <-events
+	if event.Err != nil || event.Config.Port != 443 || event.Previous.Port != 8080 {
+		t.Errorf("unexpected event %+v", event)
+	}
+	cancel()
+	for range events {
+	}
+}